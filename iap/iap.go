@@ -15,16 +15,19 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"net/url"
 	"sort"
@@ -234,6 +237,348 @@ func ValidateReceiptAppleWithUrl(ctx context.Context, httpc *http.Client, url, r
 	}
 }
 
+// Apple App Store Server API and StoreKit 2 signed data.
+
+const (
+	AppleServerApiUrlProduction = "https://api.storekit.itunes.apple.com"
+	AppleServerApiUrlSandbox    = "https://api.storekit-sandbox.itunes.apple.com"
+)
+
+const (
+	AppleTransactionTypeConsumable                = "Consumable"
+	AppleTransactionTypeNonConsumable             = "Non-Consumable"
+	AppleTransactionTypeAutoRenewableSubscription = "Auto-Renewable Subscription"
+	AppleTransactionTypeNonRenewingSubscription   = "Non-Renewing Subscription"
+)
+
+// Apple Root CA - G3, the trust anchor of all App Store signed data.
+// https://www.apple.com/certificateauthority/
+const AppleRootCertificatePEM = `
+-----BEGIN CERTIFICATE-----
+MIICQzCCAcmgAwIBAgIILcX8iNLFS5UwCgYIKoZIzj0EAwMwZzEbMBkGA1UEAwwS
+QXBwbGUgUm9vdCBDQSAtIEczMSYwJAYDVQQLDB1BcHBsZSBDZXJ0aWZpY2F0aW9u
+IEF1dGhvcml0eTETMBEGA1UECgwKQXBwbGUgSW5jLjELMAkGA1UEBhMCVVMwHhcN
+MTQwNDMwMTgxOTA2WhcNMzkwNDMwMTgxOTA2WjBnMRswGQYDVQQDDBJBcHBsZSBS
+b290IENBIC0gRzMxJjAkBgNVBAsMHUFwcGxlIENlcnRpZmljYXRpb24gQXV0aG9y
+aXR5MRMwEQYDVQQKDApBcHBsZSBJbmMuMQswCQYDVQQGEwJVUzB2MBAGByqGSM49
+AgEGBSuBBAAiA2IABJjpLz1AcqTtkyJygRMc3RCV8cWjTnHcFBbZDuWmBSp3ZHtf
+TjjTuxxEtX/1H7YyYl3J6YRbTzBPEVoA/VhYDKX1DyxNB0cTddqXl5dvMVztK517
+IDvYuVTZXpmkOlEKMaNCMEAwHQYDVR0OBBYEFLuw3qFYM4iapIqZ3r6966/ayySr
+MA8GA1UdEwEB/wQFMAMBAf8wDgYDVR0PAQH/BAQDAgEGMAoGCCqGSM49BAMDA2gA
+MGUCMQCD6cHEFl4aXTQY2e3v9GwOAEZLuN+yRhHFD/3meoyhpmvOwgPUnPWTxnS4
+at+qIxUCMG1mihDK1A3UT82NQz60imOlM27jbdoXt2QfyFMm+YhidDkLF1vLUagM
+6BgD56KyKA==
+-----END CERTIFICATE-----
+`
+
+var (
+	ErrInvalidSignedDataApple = errors.New("invalid Apple signed data")
+	ErrNotFoundServiceApple   = errors.New("not found response from Apple service")
+)
+
+// Marker extensions Apple sets on the certificates it uses to sign App Store data.
+var (
+	appleSignedDataLeafOID         = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	appleSignedDataIntermediateOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+var appleRootCertPool = sync.OnceValue(func() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(AppleRootCertificatePEM))
+	return pool
+})
+
+// https://developer.apple.com/documentation/appstoreserverapi/jwstransactiondecodedpayload
+type AppleJWSTransaction struct {
+	AppAccountToken             string `json:"appAccountToken"`
+	BundleId                    string `json:"bundleId"`
+	Currency                    string `json:"currency"`
+	Environment                 string `json:"environment"` // possible values: 'Sandbox', 'Production'.
+	ExpiresDate                 int64  `json:"expiresDate"` // Only set for subscriptions.
+	InAppOwnershipType          string `json:"inAppOwnershipType"`
+	IsUpgraded                  bool   `json:"isUpgraded"`
+	OfferIdentifier             string `json:"offerIdentifier"`
+	OfferType                   int    `json:"offerType"`
+	OriginalPurchaseDate        int64  `json:"originalPurchaseDate"`
+	OriginalTransactionId       string `json:"originalTransactionId"`
+	Price                       int64  `json:"price"` // Milliunits of the currency.
+	ProductId                   string `json:"productId"`
+	PurchaseDate                int64  `json:"purchaseDate"`
+	Quantity                    int    `json:"quantity"`
+	RevocationDate              int64  `json:"revocationDate"`
+	RevocationReason            *int   `json:"revocationReason"` // 0: other, 1: app issue.
+	SignedDate                  int64  `json:"signedDate"`
+	Storefront                  string `json:"storefront"`
+	StorefrontId                string `json:"storefrontId"`
+	SubscriptionGroupIdentifier string `json:"subscriptionGroupIdentifier"`
+	TransactionId               string `json:"transactionId"`
+	TransactionReason           string `json:"transactionReason"`
+	Type                        string `json:"type"`
+	WebOrderLineItemId          string `json:"webOrderLineItemId"`
+}
+
+// Check if the given data is a JWS compact serialization rather than a legacy base64 encoded receipt. Legacy receipts
+// never contain '.' as it is not part of the standard base64 alphabet.
+func IsSignedDataApple(data string) bool {
+	return strings.Count(data, ".") == 2
+}
+
+// Parse a PEM bundle into a certificate pool. An empty bundle returns nil, which selects the Apple root certificate.
+func ParseRootCertificatesApple(rootsPEM string) (*x509.CertPool, error) {
+	if rootsPEM == "" {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(rootsPEM)) {
+		return nil, errors.New("no valid certificates found in Apple root certificates")
+	}
+	return pool, nil
+}
+
+// Verify App Store signed data in JWS compact serialization and return its decoded JSON payload. The certificate chain
+// in the 'x5c' header must lead to one of the given roots, and the ES256 signature must match the leaf certificate.
+// If roots is nil the Apple Root CA - G3 is used, and the Apple marker extensions must also be present in the chain.
+func VerifySignedDataApple(data string, roots *x509.CertPool) ([]byte, error) {
+	parts := strings.Split(data, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 JWS segments, got %d", ErrInvalidSignedDataApple, len(parts))
+	}
+
+	headerBytes, err := decodeSegmentApple(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %s", ErrInvalidSignedDataApple, err.Error())
+	}
+	var header struct {
+		Alg string   `json:"alg"`
+		X5c []string `json:"x5c"`
+	}
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %s", ErrInvalidSignedDataApple, err.Error())
+	}
+	if header.Alg != "ES256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSignedDataApple, header.Alg)
+	}
+	if len(header.X5c) < 2 {
+		return nil, fmt.Errorf("%w: incomplete certificate chain", ErrInvalidSignedDataApple)
+	}
+
+	certs := make([]*x509.Certificate, 0, len(header.X5c))
+	for _, encoded := range header.X5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: certificate: %s", ErrInvalidSignedDataApple, err.Error())
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: certificate: %s", ErrInvalidSignedDataApple, err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	checkMarkers := roots == nil
+	if checkMarkers {
+		roots = appleRootCertPool()
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: certificate chain: %s", ErrInvalidSignedDataApple, err.Error())
+	}
+	if checkMarkers && (!hasExtensionApple(certs[0], appleSignedDataLeafOID) || !hasExtensionApple(certs[1], appleSignedDataIntermediateOID)) {
+		return nil, fmt.Errorf("%w: certificate chain is not issued for App Store data", ErrInvalidSignedDataApple)
+	}
+
+	pk, ok := certs[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: leaf certificate key must be ECDSA", ErrInvalidSignedDataApple)
+	}
+	sig, err := decodeSegmentApple(parts[2])
+	if err != nil || len(sig) != 64 {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidSignedDataApple)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(pk, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidSignedDataApple)
+	}
+
+	payload, err := decodeSegmentApple(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload: %s", ErrInvalidSignedDataApple, err.Error())
+	}
+	return payload, nil
+}
+
+// Verify and decode a StoreKit 2 signed transaction. Returns the decoded transaction and its raw JSON payload.
+func DecodeSignedTransactionApple(signedTransaction string, roots *x509.CertPool) (*AppleJWSTransaction, []byte, error) {
+	payload, err := VerifySignedDataApple(signedTransaction, roots)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out AppleJWSTransaction
+	if err = json.Unmarshal(payload, &out); err != nil {
+		return nil, nil, err
+	}
+	if out.TransactionId == "" {
+		return nil, nil, fmt.Errorf("%w: missing transaction id", ErrInvalidSignedDataApple)
+	}
+
+	return &out, payload, nil
+}
+
+func decodeSegmentApple(seg string) ([]byte, error) {
+	// Tolerate padded segments, some Apple tooling emits them.
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+}
+
+func hasExtensionApple(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// Create a bearer token for the App Store Server API, signed with an In-App Purchase key from App Store Connect.
+// https://developer.apple.com/documentation/appstoreserverapi/generating_json_web_tokens_for_api_requests
+func GetServerApiTokenApple(issuerID, keyID, bundleID, privateKey string) (string, error) {
+	if len(issuerID) < 1 {
+		return "", errors.New("'issuerID' must not be empty")
+	}
+
+	if len(keyID) < 1 {
+		return "", errors.New("'keyID' must not be empty")
+	}
+
+	if len(bundleID) < 1 {
+		return "", errors.New("'bundleID' must not be empty")
+	}
+
+	pk, err := jwt.ParseECPrivateKeyFromPEM([]byte(privateKey))
+	if err != nil {
+		return "", fmt.Errorf("apple iap private key invalid: %s", err.Error())
+	}
+
+	type AppleClaims struct {
+		BundleId string `json:"bid"`
+		jwt.RegisteredClaims
+	}
+
+	now := time.Now()
+	claims := &AppleClaims{
+		bundleID,
+		jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"appstoreconnect-v1"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(30 * time.Minute)), // Apple rejects tokens valid for more than 60 minutes.
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    issuerID,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = keyID
+
+	return token.SignedString(pk)
+}
+
+type listSignedTransactionsAppleResponse struct {
+	Revision           string   `json:"revision"`
+	HasMore            bool     `json:"hasMore"`
+	SignedTransactions []string `json:"signedTransactions"`
+}
+
+// List the signed transactions in a customer's purchase history, starting from any of their transaction IDs.
+// An empty baseUrl queries production, then the sandbox if the transaction is not found there.
+// https://developer.apple.com/documentation/appstoreserverapi/get_transaction_history
+func ListTransactionHistoryApple(ctx context.Context, httpc *http.Client, baseUrl, token, transactionID string) ([]string, error) {
+	return listSignedTransactionsApple(ctx, httpc, baseUrl, token, "/inApps/v1/history/"+url.PathEscape(transactionID))
+}
+
+// List the signed transactions of a customer that were refunded, starting from any of their transaction IDs.
+// An empty baseUrl queries production, then the sandbox if the transaction is not found there.
+// https://developer.apple.com/documentation/appstoreserverapi/get_refund_history
+func ListRefundHistoryApple(ctx context.Context, httpc *http.Client, baseUrl, token, transactionID string) ([]string, error) {
+	return listSignedTransactionsApple(ctx, httpc, baseUrl, token, "/inApps/v2/refund/lookup/"+url.PathEscape(transactionID))
+}
+
+func listSignedTransactionsApple(ctx context.Context, httpc *http.Client, baseUrl, token, path string) ([]string, error) {
+	if len(token) < 1 {
+		return nil, errors.New("'token' must not be empty")
+	}
+
+	if baseUrl != "" {
+		return listSignedTransactionsAppleWithUrl(ctx, httpc, baseUrl, token, path)
+	}
+
+	out, err := listSignedTransactionsAppleWithUrl(ctx, httpc, AppleServerApiUrlProduction, token, path)
+	if errors.Is(err, ErrNotFoundServiceApple) {
+		// Transaction may belong to the sandbox environment.
+		return listSignedTransactionsAppleWithUrl(ctx, httpc, AppleServerApiUrlSandbox, token, path)
+	}
+	return out, err
+}
+
+func listSignedTransactionsAppleWithUrl(ctx context.Context, httpc *http.Client, baseUrl, token, path string) ([]string, error) {
+	signedTransactions := make([]string, 0)
+	var revision string
+	for {
+		u := strings.TrimSuffix(baseUrl, "/") + path
+		if revision != "" {
+			u += "?revision=" + url.QueryEscape(revision)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := httpc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		buf, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.StatusCode {
+		case 200:
+			var page listSignedTransactionsAppleResponse
+			if err = json.Unmarshal(buf, &page); err != nil {
+				return nil, err
+			}
+			signedTransactions = append(signedTransactions, page.SignedTransactions...)
+			if !page.HasMore || page.Revision == "" || page.Revision == revision {
+				return signedTransactions, nil
+			}
+			revision = page.Revision
+		case 404:
+			return nil, &ValidationError{
+				Err:        ErrNotFoundServiceApple,
+				StatusCode: resp.StatusCode,
+				Payload:    string(buf),
+			}
+		default:
+			return nil, &ValidationError{
+				Err:        ErrNon200ServiceApple,
+				StatusCode: resp.StatusCode,
+				Payload:    string(buf),
+			}
+		}
+	}
+}
+
 // Google
 
 type ReceiptGoogle struct {
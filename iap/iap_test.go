@@ -0,0 +1,233 @@
+// Copyright 2024 Heroic Labs.
+// All rights reserved.
+//
+// NOTICE: All information contained herein is, and remains the property of Heroic
+// Labs. and its suppliers, if any. The intellectual and technical concepts
+// contained herein are proprietary to Heroic Labs. and its suppliers and may be
+// covered by U.S. and Foreign Patents, patents in process, and are protected by
+// trade secret or copyright law. Dissemination of this information or reproduction
+// of this material is strictly forbidden unless prior written permission is
+// obtained from Heroic Labs.
+
+package iap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type testSignerApple struct {
+	roots *x509.CertPool
+	key   *ecdsa.PrivateKey
+	x5c   []string
+}
+
+// Build a root, intermediate and leaf chain shaped like the one Apple uses to sign App Store data.
+func newTestSignerApple(t *testing.T) *testSignerApple {
+	t.Helper()
+
+	newCert := func(template, parent *x509.Certificate, pub *ecdsa.PublicKey, signer *ecdsa.PrivateKey) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+		if err != nil {
+			t.Fatalf("error creating certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("error parsing certificate: %v", err)
+		}
+		return cert
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("error generating key: %v", err)
+		}
+		return key
+	}
+
+	now := time.Now()
+	rootKey, interKey, leafKey := newKey(), newKey(), newKey()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	root := newCert(rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	inter := newCert(&x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, root, &interKey.PublicKey, rootKey)
+	leaf := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Test Leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, inter, &leafKey.PublicKey, interKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	return &testSignerApple{
+		roots: roots,
+		key:   leafKey,
+		x5c: []string{
+			base64.StdEncoding.EncodeToString(leaf.Raw),
+			base64.StdEncoding.EncodeToString(inter.Raw),
+			base64.StdEncoding.EncodeToString(root.Raw),
+		},
+	}
+}
+
+func (s *testSignerApple) sign(t *testing.T, payload interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]interface{}{"alg": "ES256", "x5c": s.x5c})
+	body, _ := json.Marshal(payload)
+	signingString := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	digest := sha256.Sum256([]byte(signingString))
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	ss.FillBytes(sig[32:])
+
+	return signingString + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestDecodeSignedTransactionApple(t *testing.T) {
+	signer := newTestSignerApple(t)
+	signed := signer.sign(t, map[string]interface{}{
+		"transactionId":         "2000000123",
+		"originalTransactionId": "2000000123",
+		"bundleId":              "com.example.game",
+		"productId":             "gems_100",
+		"purchaseDate":          1700000000000,
+		"type":                  AppleTransactionTypeConsumable,
+		"environment":           AppleSandboxEnvironment,
+	})
+
+	if !IsSignedDataApple(signed) {
+		t.Fatal("expected signed data to be detected")
+	}
+	if IsSignedDataApple(base64.StdEncoding.EncodeToString([]byte("legacy receipt"))) {
+		t.Fatal("expected legacy receipt not to be detected as signed data")
+	}
+
+	transaction, _, err := DecodeSignedTransactionApple(signed, signer.roots)
+	if err != nil {
+		t.Fatalf("error decoding: %v", err)
+	}
+	if transaction.TransactionId != "2000000123" || transaction.ProductId != "gems_100" || transaction.Type != AppleTransactionTypeConsumable || transaction.PurchaseDate != 1700000000000 {
+		t.Fatalf("unexpected transaction: %+v", transaction)
+	}
+
+	t.Run("tampered payload", func(t *testing.T) {
+		parts := strings.Split(signed, ".")
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"transactionId":"2000000123","productId":"gems_10000"}`))
+		if _, _, err := DecodeSignedTransactionApple(strings.Join(parts, "."), signer.roots); !errors.Is(err, ErrInvalidSignedDataApple) {
+			t.Fatalf("expected invalid signed data error, got %v", err)
+		}
+	})
+
+	t.Run("untrusted root", func(t *testing.T) {
+		other := newTestSignerApple(t)
+		if _, _, err := DecodeSignedTransactionApple(signed, other.roots); !errors.Is(err, ErrInvalidSignedDataApple) {
+			t.Fatalf("expected invalid signed data error, got %v", err)
+		}
+		// Without configured roots only the Apple root is trusted.
+		if _, _, err := DecodeSignedTransactionApple(signed, nil); !errors.Is(err, ErrInvalidSignedDataApple) {
+			t.Fatalf("expected invalid signed data error, got %v", err)
+		}
+	})
+}
+
+func TestListRefundHistoryApple(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshalling key: %v", err)
+	}
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	token, err := GetServerApiTokenApple("issuer", "key", "com.example.game", privateKey)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parsed, err := jwt.Parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		if err != nil || parsed.Header["kid"] != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims := parsed.Claims.(jwt.MapClaims)
+		if claims["iss"] != "issuer" || claims["bid"] != "com.example.game" || claims["aud"] != "appstoreconnect-v1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/inApps/v2/refund/lookup/1000":
+			// Two pages of results, linked by revision.
+			if r.URL.Query().Get("revision") == "" {
+				fmt.Fprint(w, `{"signedTransactions":["a","b"],"revision":"r1","hasMore":true}`)
+			} else {
+				fmt.Fprint(w, `{"signedTransactions":["c"],"revision":"r2","hasMore":false}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errorCode":4040010,"errorMessage":"Transaction id not found."}`)
+		}
+	}))
+	defer server.Close()
+
+	signedTransactions, err := ListRefundHistoryApple(context.Background(), server.Client(), server.URL, token, "1000")
+	if err != nil {
+		t.Fatalf("error listing refunds: %v", err)
+	}
+	if strings.Join(signedTransactions, ",") != "a,b,c" {
+		t.Fatalf("unexpected signed transactions: %v", signedTransactions)
+	}
+
+	_, err = ListTransactionHistoryApple(context.Background(), server.Client(), server.URL, token, "1000")
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) || vErr.StatusCode != http.StatusNotFound || !errors.Is(err, ErrNotFoundServiceApple) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeProvider keeps sent messages in memory instead of delivering them, for use in tests.
+type FakeProvider struct {
+	sync.Mutex
+	messages []*Message
+	err      error
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+func (p *FakeProvider) Send(ctx context.Context, message *Message) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	m := *message
+	p.messages = append(p.messages, &m)
+	return nil
+}
+
+// Messages returns all messages sent so far, oldest first.
+func (p *FakeProvider) Messages() []*Message {
+	p.Lock()
+	defer p.Unlock()
+	messages := make([]*Message, len(p.messages))
+	copy(messages, p.messages)
+	return messages
+}
+
+// SetError makes subsequent sends fail with the given error, or succeed again if it is nil.
+func (p *FakeProvider) SetError(err error) {
+	p.Lock()
+	p.err = err
+	p.Unlock()
+}
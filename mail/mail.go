@@ -0,0 +1,32 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"context"
+)
+
+// Message is an outbound email. Body is the plain text content, HTML is optional and sent as an alternative part.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+}
+
+// Provider delivers outbound email.
+type Provider interface {
+	Send(ctx context.Context, message *Message) error
+}
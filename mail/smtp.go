@@ -0,0 +1,179 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SMTPProvider sends email through an SMTP relay, upgrading the connection with STARTTLS when the server offers it.
+type SMTPProvider struct {
+	logger   *zap.Logger
+	address  string
+	username string
+	password string
+	from     string
+	timeout  time.Duration
+}
+
+func NewSMTPProvider(logger *zap.Logger, address, username, password, from string, timeout time.Duration) *SMTPProvider {
+	return &SMTPProvider{
+		logger:   logger,
+		address:  address,
+		username: username,
+		password: password,
+		from:     from,
+		timeout:  timeout,
+	}
+}
+
+func (p *SMTPProvider) Send(ctx context.Context, message *Message) error {
+	from, err := mail.ParseAddress(p.from)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %s", err.Error())
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid to address: %s", err.Error())
+	}
+	host, _, err := net.SplitHostPort(p.address)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address: %s", err.Error())
+	}
+
+	data, err := buildMessage(from, to, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, ctxCancelFn := context.WithTimeout(ctx, p.timeout)
+	defer ctxCancelFn()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if p.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", p.username, p.password, host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	p.logger.Debug("Sent email", zap.String("to", to.Address), zap.String("subject", message.Subject))
+	return client.Quit()
+}
+
+// Build the RFC 5322 message, with a multipart/alternative body when an HTML version is set.
+func buildMessage(from, to *mail.Address, message *Message, now time.Time) ([]byte, error) {
+	if strings.ContainsAny(message.Subject, "\r\n") {
+		return nil, errors.New("invalid subject")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from.String() + "\r\n")
+	buf.WriteString("To: " + to.String() + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	buf.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if message.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, message.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	boundaryBytes := make([]byte, 16)
+	if _, err := rand.Read(boundaryBytes); err != nil {
+		return nil, err
+	}
+	boundary := hex.EncodeToString(boundaryBytes)
+	buf.WriteString("Content-Type: multipart/alternative; boundary=" + boundary + "\r\n\r\n")
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", message.Body},
+		{"text/html", message.HTML},
+	} {
+		buf.WriteString("--" + boundary + "\r\n")
+		buf.WriteString("Content-Type: " + part.contentType + "; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, part.content); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--" + boundary + "--\r\n")
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, content string) error {
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(content)); err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMessage(t *testing.T) {
+	from := &mail.Address{Name: "Game", Address: "noreply@example.com"}
+	to := &mail.Address{Address: "player@example.com"}
+	now := time.Date(2024, 5, 20, 10, 0, 0, 0, time.UTC)
+
+	t.Run("plain text", func(t *testing.T) {
+		data, err := buildMessage(from, to, &Message{To: to.Address, Subject: "Verify your email", Body: "Code: abc"}, now)
+		if !assert.NoError(t, err) {
+			return
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(data))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "Verify your email", msg.Header.Get("Subject"))
+		assert.Equal(t, `"Game" <noreply@example.com>`, msg.Header.Get("From"))
+		assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(msg.Body)
+		assert.Equal(t, "Code: abc", string(body))
+	})
+
+	t.Run("html alternative", func(t *testing.T) {
+		data, err := buildMessage(from, to, &Message{To: to.Address, Subject: "Réinitialiser", Body: "text", HTML: "<p>html</p>"}, now)
+		if !assert.NoError(t, err) {
+			return
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(data))
+		if !assert.NoError(t, err) {
+			return
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		assert.NoError(t, err)
+		assert.Equal(t, "Réinitialiser", subject)
+
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "multipart/alternative", mediaType)
+		reader := multipart.NewReader(msg.Body, params["boundary"])
+		var parts []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			content, _ := io.ReadAll(part)
+			parts = append(parts, string(content))
+		}
+		assert.Equal(t, []string{"text", "<p>html</p>"}, parts)
+	})
+
+	t.Run("header injection", func(t *testing.T) {
+		_, err := buildMessage(from, to, &Message{To: to.Address, Subject: "Hi\r\nBcc: someone@example.com", Body: "text"}, now)
+		assert.Error(t, err)
+	})
+}
@@ -144,6 +144,8 @@ func main() {
 	sessionCache := server.NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
 	consoleSessionCache := server.NewLocalSessionCache(config.GetConsole().TokenExpirySec, 0)
 	loginAttemptCache := server.NewLocalLoginAttemptCache()
+	rateLimiter := server.NewLocalRateLimiter(config)
+	namePolicy := server.NewLocalNamePolicy(startupLogger, config)
 	statusRegistry := server.NewLocalStatusRegistry(logger, config, sessionRegistry, jsonpbMarshaler)
 	tracker := server.StartLocalTracker(logger, config, sessionRegistry, statusRegistry, metrics, jsonpbMarshaler)
 	router := server.NewLocalMessageRouter(sessionRegistry, tracker, jsonpbMarshaler)
@@ -151,6 +153,7 @@ func main() {
 	leaderboardRankCache := server.NewLocalLeaderboardRankCache(ctx, startupLogger, db, config.GetLeaderboard(), leaderboardCache)
 	leaderboardScheduler := server.NewLocalLeaderboardScheduler(logger, db, config, leaderboardCache, leaderboardRankCache)
 	googleRefundScheduler := server.NewGoogleRefundScheduler(logger, db, config)
+	appleRefundScheduler := server.NewAppleRefundScheduler(logger, db, config)
 	matchRegistry := server.NewLocalMatchRegistry(logger, startupLogger, config, sessionRegistry, tracker, router, metrics, config.GetName())
 	tracker.SetMatchJoinListener(matchRegistry.Join)
 	tracker.SetMatchLeaveListener(matchRegistry.Leave)
@@ -161,7 +164,15 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to initialize storage index", zap.Error(err))
 	}
-	runtime, runtimeInfo, err := server.NewRuntime(ctx, logger, startupLogger, db, jsonpbMarshaler, jsonpbUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, storageIndex, fmCallbackHandler)
+	storageCollections, err := server.NewLocalStorageCollectionRegistry(logger, config.GetStorage())
+	if err != nil {
+		logger.Fatal("Failed to initialize storage collections", zap.Error(err))
+	}
+	groupIndex, err := server.NewLocalGroupIndex(logger, db, config.GetGroup())
+	if err != nil {
+		logger.Fatal("Failed to initialize group index", zap.Error(err))
+	}
+	runtime, runtimeInfo, err := server.NewRuntime(ctx, logger, startupLogger, db, jsonpbMarshaler, jsonpbUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, storageIndex, storageCollections, groupIndex, rateLimiter, namePolicy, fmCallbackHandler)
 	if err != nil {
 		startupLogger.Fatal("Failed initializing runtime modules", zap.Error(err))
 	}
@@ -176,15 +187,29 @@ func main() {
 			logger.Error("Failed to load storage index entries from database", zap.Error(err))
 		}
 	}()
+	go func() {
+		if err := groupIndex.Load(ctx); err != nil {
+			logger.Error("Failed to load group index entries from database", zap.Error(err))
+		}
+	}()
 
 	leaderboardScheduler.Start(runtime)
 	googleRefundScheduler.Start(runtime)
-
-	pipeline := server.NewPipeline(logger, config, db, jsonpbMarshaler, jsonpbUnmarshaler, sessionRegistry, statusRegistry, matchRegistry, partyRegistry, matchmaker, tracker, router, runtime)
+	appleRefundScheduler.Start(runtime)
+	accountScheduler := server.NewLocalAccountScheduler(logger, db, config, jsonpbMarshaler, metrics, leaderboardCache, leaderboardRankCache, storageIndex, storageCollections, groupIndex, sessionRegistry, sessionCache, tracker, router)
+	accountScheduler.Start()
+	storageExpiryScheduler := server.NewLocalStorageExpiryScheduler(logger, db, config, storageIndex, storageCollections, tracker, router)
+	storageExpiryScheduler.Start(runtime)
+	tradeScheduler := server.NewLocalTradeScheduler(logger, db, config, metrics, storageIndex, storageCollections, tracker, router)
+	tradeScheduler.Start(runtime)
+	walletHoldScheduler := server.NewLocalWalletHoldScheduler(logger, db, config)
+	walletHoldScheduler.Start()
+
+	pipeline := server.NewPipeline(logger, config, db, jsonpbMarshaler, jsonpbUnmarshaler, sessionRegistry, statusRegistry, matchRegistry, partyRegistry, matchmaker, tracker, router, rateLimiter, namePolicy, runtime)
 	statusHandler := server.NewLocalStatusHandler(logger, sessionRegistry, matchRegistry, tracker, metrics, config.GetName())
 
-	apiServer := server.StartApiServer(logger, startupLogger, db, jsonpbMarshaler, jsonpbUnmarshaler, config, version, socialClient, storageIndex, leaderboardCache, leaderboardRankCache, sessionRegistry, sessionCache, statusRegistry, matchRegistry, matchmaker, tracker, router, streamManager, metrics, pipeline, runtime)
-	consoleServer := server.StartConsoleServer(logger, startupLogger, db, config, tracker, router, streamManager, metrics, sessionRegistry, sessionCache, consoleSessionCache, loginAttemptCache, statusRegistry, statusHandler, runtimeInfo, matchRegistry, configWarnings, semver, leaderboardCache, leaderboardRankCache, leaderboardScheduler, storageIndex, apiServer, runtime, cookie)
+	apiServer := server.StartApiServer(logger, startupLogger, db, jsonpbMarshaler, jsonpbUnmarshaler, config, version, socialClient, storageIndex, storageCollections, groupIndex, leaderboardCache, leaderboardRankCache, sessionRegistry, sessionCache, statusRegistry, matchRegistry, matchmaker, tracker, router, streamManager, metrics, rateLimiter, namePolicy, pipeline, runtime)
+	consoleServer := server.StartConsoleServer(logger, startupLogger, db, config, tracker, router, streamManager, metrics, sessionRegistry, sessionCache, consoleSessionCache, loginAttemptCache, statusRegistry, statusHandler, runtimeInfo, matchRegistry, configWarnings, semver, leaderboardCache, leaderboardRankCache, leaderboardScheduler, storageIndex, storageCollections, groupIndex, apiServer, runtime, cookie)
 
 	gaenabled := len(os.Getenv("NAKAMA_TELEMETRY")) < 1
 	console.UIFS.Nt = !gaenabled
@@ -247,12 +272,18 @@ func main() {
 	matchmaker.Stop()
 	leaderboardScheduler.Stop()
 	googleRefundScheduler.Stop()
+	appleRefundScheduler.Stop()
+	accountScheduler.Stop()
+	storageExpiryScheduler.Stop()
+	tradeScheduler.Stop()
+	walletHoldScheduler.Stop()
 	tracker.Stop()
 	statusRegistry.Stop()
 	sessionCache.Stop()
 	sessionRegistry.Stop()
 	metrics.Stop(logger)
 	loginAttemptCache.Stop()
+	rateLimiter.Stop()
 
 	if gaenabled {
 		_ = ga.SendSessionStop(telemetryClient, gacode, cookie)
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS league (
+    PRIMARY KEY (id),
+
+    id             VARCHAR(128) NOT NULL,
+    tiers          JSONB        NOT NULL DEFAULT '[]', -- Ordered tournament IDs, lowest tier first.
+    cohort_size    INT          NOT NULL CHECK (cohort_size > 0),
+    promote_count  INT          NOT NULL DEFAULT 0 CHECK (promote_count >= 0),
+    relegate_count INT          NOT NULL DEFAULT 0 CHECK (relegate_count >= 0),
+    metadata       JSONB        NOT NULL DEFAULT '{}',
+    create_time    TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS league_member (
+    PRIMARY KEY (league_id, owner_id),
+    FOREIGN KEY (league_id) REFERENCES league (id) ON DELETE CASCADE,
+    FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    league_id   VARCHAR(128) NOT NULL,
+    owner_id    UUID         NOT NULL,
+    tier        INT          NOT NULL DEFAULT 0 CHECK (tier >= 0),
+    cohort      INT          NOT NULL DEFAULT 0 CHECK (cohort >= 0),
+    create_time TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    update_time TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS league_member_league_id_tier_cohort_idx ON league_member (league_id, tier, cohort);
+CREATE INDEX IF NOT EXISTS league_member_owner_id_idx ON league_member (owner_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS league_member, league;
@@ -0,0 +1,26 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+-- +migrate Up
+ALTER TABLE leaderboard
+    ADD COLUMN aggregate_source_id VARCHAR(128), -- Source leaderboard when this is a group aggregate, NULL otherwise.
+    ADD COLUMN aggregate_operator  SMALLINT NOT NULL DEFAULT 0 CHECK (aggregate_operator >= 0); -- sum(0), average(1), best(2).
+
+-- +migrate Down
+ALTER TABLE IF EXISTS leaderboard
+    DROP COLUMN IF EXISTS aggregate_source_id,
+    DROP COLUMN IF EXISTS aggregate_operator;
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS group_invite (
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    group_id    UUID        NOT NULL,
+    user_id     UUID        NOT NULL,
+    inviter_id  UUID        NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000', -- Nil for invites sent by the server.
+    expiry_time TIMESTAMPTZ NOT NULL,
+    create_time TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS group_invite_user_id_expiry_time_idx ON group_invite (user_id, expiry_time);
+
+CREATE TABLE IF NOT EXISTS group_application (
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    group_id    UUID        NOT NULL,
+    user_id     UUID        NOT NULL,
+    metadata    JSONB       NOT NULL DEFAULT '{}', -- Application form submitted with a join request.
+    create_time TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS group_application, group_invite;
@@ -0,0 +1,34 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS user_session (
+    PRIMARY KEY (user_id, id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    user_id        UUID         NOT NULL,
+    id             VARCHAR(128) NOT NULL, -- Token ID shared by a session token and its refresh token.
+    device_name    VARCHAR(128) NOT NULL DEFAULT '',
+    platform       VARCHAR(128) NOT NULL DEFAULT '',
+    client_ip      VARCHAR(64)  NOT NULL DEFAULT '',
+    create_time    TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    last_seen_time TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expiry_time    TIMESTAMPTZ  NOT NULL -- Refresh token expiry.
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_session;
@@ -0,0 +1,25 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+-- +migrate Up
+-- Current refresh token ID of a session when refresh tokens are rotated, empty if it is the session ID.
+ALTER TABLE user_session
+    ADD COLUMN IF NOT EXISTS refresh_token_id VARCHAR(128) NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE IF EXISTS user_session
+    DROP COLUMN IF EXISTS refresh_token_id;
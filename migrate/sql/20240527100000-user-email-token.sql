@@ -0,0 +1,33 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS user_email_token (
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    id          VARCHAR(64)  NOT NULL, -- Hex encoded SHA-256 of the token sent to the user.
+    user_id     UUID         NOT NULL,
+    purpose     SMALLINT     NOT NULL, -- 0 verify email, 1 reset password, 2 change email.
+    email       VARCHAR(255) NOT NULL, -- Address the token was sent to.
+    create_time TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expiry_time TIMESTAMPTZ  NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_email_token_user_id_purpose_idx ON user_email_token (user_id, purpose);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_email_token;
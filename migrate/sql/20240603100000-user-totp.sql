@@ -0,0 +1,42 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS user_totp (
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    user_id         UUID        NOT NULL,
+    secret          VARCHAR(64) NOT NULL, -- Base32 encoded shared secret.
+    last_step       BIGINT      NOT NULL DEFAULT 0, -- Time step of the last accepted code, codes cannot be reused.
+    failed_attempts SMALLINT    NOT NULL DEFAULT 0,
+    lockout_time    TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01 00:00:00 UTC',
+    create_time     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    confirm_time    TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01 00:00:00 UTC' -- Two-factor authentication is enabled once set.
+);
+
+CREATE TABLE IF NOT EXISTS user_totp_recovery (
+    PRIMARY KEY (user_id, code),
+    FOREIGN KEY (user_id) REFERENCES user_totp (user_id) ON DELETE CASCADE,
+
+    user_id UUID        NOT NULL,
+    code    VARCHAR(64) NOT NULL -- Hex encoded SHA-256 of a single use recovery code.
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_totp_recovery;
+DROP TABLE IF EXISTS user_totp;
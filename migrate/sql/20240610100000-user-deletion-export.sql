@@ -0,0 +1,45 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS user_deletion (
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    user_id      UUID        NOT NULL,
+    request_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    purge_time   TIMESTAMPTZ NOT NULL -- Account is deleted after this time unless the user logs in.
+);
+CREATE INDEX IF NOT EXISTS user_deletion_purge_time_idx ON user_deletion (purge_time);
+
+CREATE TABLE IF NOT EXISTS user_export (
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    id            UUID        NOT NULL,
+    user_id       UUID        NOT NULL,
+    state         SMALLINT    NOT NULL DEFAULT 0, -- 0 pending, 1 complete, 2 failed.
+    data          BYTEA, -- JSON encoded account export, set once complete.
+    create_time   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    complete_time TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01 00:00:00 UTC',
+    expiry_time   TIMESTAMPTZ NOT NULL -- Export is removed after this time.
+);
+CREATE INDEX IF NOT EXISTS user_export_user_id_create_time_idx ON user_export (user_id, create_time DESC);
+CREATE INDEX IF NOT EXISTS user_export_state_create_time_idx ON user_export (state, create_time);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_export;
+DROP TABLE IF EXISTS user_deletion;
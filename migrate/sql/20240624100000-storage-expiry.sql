@@ -0,0 +1,27 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+-- +migrate Up
+ALTER TABLE storage
+    ADD COLUMN IF NOT EXISTS expiry_time TIMESTAMPTZ; -- NULL if the object does not expire.
+
+CREATE INDEX IF NOT EXISTS storage_expiry_time_idx ON storage (expiry_time) WHERE expiry_time IS NOT NULL;
+
+-- +migrate Down
+DROP INDEX IF EXISTS storage_expiry_time_idx;
+
+ALTER TABLE storage
+    DROP COLUMN IF EXISTS expiry_time;
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS storage_history (
+    PRIMARY KEY (collection, key, user_id, version),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    collection   VARCHAR(128) NOT NULL,
+    key          VARCHAR(128) NOT NULL,
+    user_id      UUID         NOT NULL,
+    value        JSONB        NOT NULL DEFAULT '{}',
+    version      VARCHAR(32)  NOT NULL,
+    read         SMALLINT     NOT NULL DEFAULT 1 CHECK (read >= 0),
+    write        SMALLINT     NOT NULL DEFAULT 1 CHECK (write >= 0),
+    create_time  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    update_time  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    replace_time TIMESTAMPTZ  NOT NULL DEFAULT now() -- When this version was last replaced by a write.
+);
+CREATE INDEX IF NOT EXISTS storage_history_collection_key_user_id_replace_time_idx ON storage_history (collection, key, user_id, replace_time DESC);
+CREATE INDEX IF NOT EXISTS storage_history_auto_index_fk_user_id_ref_users ON storage_history (user_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS storage_history;
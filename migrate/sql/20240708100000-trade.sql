@@ -0,0 +1,39 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS trade (
+    PRIMARY KEY (id),
+    -- Parties are not foreign keys, trades with a deleted user stay in the other party's history.
+
+    id              UUID        NOT NULL,
+    sender_id       UUID        NOT NULL,
+    recipient_id    UUID        NOT NULL,
+    proposer_id     UUID        NOT NULL,               -- The party whose current offer is escrowed, the other party can accept or counter.
+    state           SMALLINT    NOT NULL DEFAULT 0,     -- 0 open, 1 accepted, 2 cancelled, 3 expired.
+    sender_offer    JSONB       NOT NULL DEFAULT '{}',  -- Currencies and storage objects the sender gives.
+    recipient_offer JSONB       NOT NULL DEFAULT '{}',  -- Currencies and storage objects the recipient gives.
+    escrow          JSONB       NOT NULL DEFAULT '[]',  -- Storage objects taken from the proposer while the trade is open.
+    create_time     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    update_time     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expiry_time     TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS trade_sender_id_update_time_idx ON trade (sender_id, update_time DESC);
+CREATE INDEX IF NOT EXISTS trade_recipient_id_update_time_idx ON trade (recipient_id, update_time DESC);
+CREATE INDEX IF NOT EXISTS trade_open_expiry_time_idx ON trade (expiry_time) WHERE state = 0;
+
+-- +migrate Down
+DROP TABLE IF EXISTS trade;
@@ -0,0 +1,36 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS wallet_hold (
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+
+    id          UUID        NOT NULL,
+    user_id     UUID        NOT NULL,
+    state       SMALLINT    NOT NULL DEFAULT 0,    -- 0 held, 1 captured, 2 released, 3 expired.
+    changeset   JSONB       NOT NULL DEFAULT '{}', -- Amounts taken from the wallet while the hold is open.
+    captured    JSONB       NOT NULL DEFAULT '{}', -- Amounts kept when the hold was captured, the rest is returned to the wallet.
+    metadata    JSONB       NOT NULL DEFAULT '{}',
+    create_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    update_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expiry_time TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS wallet_hold_user_id_create_time_idx ON wallet_hold (user_id, create_time DESC);
+CREATE INDEX IF NOT EXISTS wallet_hold_held_expiry_time_idx ON wallet_hold (expiry_time) WHERE state = 0;
+
+-- +migrate Down
+DROP TABLE IF EXISTS wallet_hold;
@@ -0,0 +1,32 @@
+/*
+ * Copyright 2024 The Nakama Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+-- +migrate Up
+ALTER TABLE purchase
+    ADD COLUMN IF NOT EXISTS refund_callback_time TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01 00:00:00 UTC'; -- When the runtime refund function was invoked for the purchase.
+
+-- Refunds recorded before this migration are treated as already delivered.
+UPDATE purchase SET refund_callback_time = refund_time WHERE refund_time <> '1970-01-01 00:00:00 UTC';
+
+CREATE INDEX IF NOT EXISTS purchase_refund_callback_idx
+    ON purchase (store, transaction_id)
+    WHERE refund_time <> '1970-01-01 00:00:00 UTC' AND refund_callback_time = '1970-01-01 00:00:00 UTC';
+
+-- +migrate Down
+DROP INDEX IF EXISTS purchase_refund_callback_idx;
+
+ALTER TABLE purchase
+    DROP COLUMN IF EXISTS refund_callback_time;
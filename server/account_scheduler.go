@@ -0,0 +1,115 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	accountSchedulerPeriod      = 10 * time.Second
+	accountSchedulerExportBatch = 10
+	accountSchedulerPurgeBatch  = 100
+)
+
+// AccountScheduler runs account work in the background: building requested account exports, removing expired ones,
+// and deleting accounts whose deletion grace period has passed.
+type AccountScheduler interface {
+	Start()
+	Stop()
+}
+
+type LocalAccountScheduler struct {
+	logger               *zap.Logger
+	db                   *sql.DB
+	config               Config
+	protojsonMarshaler   *protojson.MarshalOptions
+	metrics              Metrics
+	leaderboardCache     LeaderboardCache
+	leaderboardRankCache LeaderboardRankCache
+	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	groupIndex           GroupIndex
+	sessionRegistry      SessionRegistry
+	sessionCache         SessionCache
+	tracker              Tracker
+	router               MessageRouter
+
+	ctx         context.Context
+	ctxCancelFn context.CancelFunc
+}
+
+func NewLocalAccountScheduler(logger *zap.Logger, db *sql.DB, config Config, protojsonMarshaler *protojson.MarshalOptions, metrics Metrics, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, groupIndex GroupIndex, sessionRegistry SessionRegistry, sessionCache SessionCache, tracker Tracker, router MessageRouter) AccountScheduler {
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+
+	return &LocalAccountScheduler{
+		logger:               logger,
+		db:                   db,
+		config:               config,
+		protojsonMarshaler:   protojsonMarshaler,
+		metrics:              metrics,
+		leaderboardCache:     leaderboardCache,
+		leaderboardRankCache: leaderboardRankCache,
+		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		groupIndex:           groupIndex,
+		sessionRegistry:      sessionRegistry,
+		sessionCache:         sessionCache,
+		tracker:              tracker,
+		router:               router,
+
+		ctx:         ctx,
+		ctxCancelFn: ctxCancelFn,
+	}
+}
+
+func (s *LocalAccountScheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(accountSchedulerPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				// Errors are logged by each step, and retried on the next tick.
+				for {
+					// Keep going while full batches are found, so a backlog is cleared without waiting for more ticks.
+					count, err := AccountExportProcess(s.ctx, s.logger, s.db, s.config, s.protojsonMarshaler, s.tracker, s.router, accountSchedulerExportBatch)
+					if err != nil || count < accountSchedulerExportBatch || s.ctx.Err() != nil {
+						break
+					}
+				}
+				_ = AccountExportExpire(s.ctx, s.logger, s.db)
+				for {
+					count, err := AccountDeletionPurge(s.ctx, s.logger, s.db, s.config, s.metrics, s.leaderboardCache, s.leaderboardRankCache, s.storageIndex, s.storageCollections, s.groupIndex, s.sessionRegistry, s.sessionCache, s.tracker, s.router, accountSchedulerPurgeBatch)
+					if err != nil || count < accountSchedulerPurgeBatch || s.ctx.Err() != nil {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (s *LocalAccountScheduler) Stop() {
+	s.ctxCancelFn()
+}
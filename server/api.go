@@ -23,10 +23,13 @@ import (
 	"crypto/x509"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,6 +40,7 @@ import (
 	grpcgw "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama/v3/apigrpc"
+	"github.com/heroiclabs/nakama/v3/mail"
 	"github.com/heroiclabs/nakama/v3/social"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -49,6 +53,7 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // Used as part of JSON input validation.
@@ -70,6 +75,8 @@ type ApiServer struct {
 	version              string
 	socialClient         *social.Client
 	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	groupIndex           GroupIndex
 	leaderboardCache     LeaderboardCache
 	leaderboardRankCache LeaderboardRankCache
 	sessionCache         SessionCache
@@ -80,12 +87,15 @@ type ApiServer struct {
 	router               MessageRouter
 	streamManager        StreamManager
 	metrics              Metrics
+	rateLimiter          RateLimiter
+	namePolicy           NamePolicy
 	runtime              *Runtime
+	mailProvider         mail.Provider
 	grpcServer           *grpc.Server
 	grpcGatewayServer    *http.Server
 }
 
-func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, storageIndex StorageIndex, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, matchmaker Matchmaker, tracker Tracker, router MessageRouter, streamManager StreamManager, metrics Metrics, pipeline *Pipeline, runtime *Runtime) *ApiServer {
+func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, groupIndex GroupIndex, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, matchmaker Matchmaker, tracker Tracker, router MessageRouter, streamManager StreamManager, metrics Metrics, rateLimiter RateLimiter, namePolicy NamePolicy, pipeline *Pipeline, runtime *Runtime) *ApiServer {
 	var gatewayContextTimeoutMs string
 	if config.GetSocket().IdleTimeoutMs > 500 {
 		// Ensure the GRPC Gateway timeout is just under the idle timeout (if possible) to ensure it has priority.
@@ -104,6 +114,9 @@ func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, p
 			if err != nil {
 				return nil, err
 			}
+			if err := rateLimitInterceptorFunc(logger, rateLimiter, ctx, req, info); err != nil {
+				return nil, err
+			}
 			return handler(ctx, req)
 		}),
 	}
@@ -121,6 +134,8 @@ func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, p
 		leaderboardCache:     leaderboardCache,
 		leaderboardRankCache: leaderboardRankCache,
 		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		groupIndex:           groupIndex,
 		sessionCache:         sessionCache,
 		sessionRegistry:      sessionRegistry,
 		statusRegistry:       statusRegistry,
@@ -129,9 +144,14 @@ func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, p
 		router:               router,
 		streamManager:        streamManager,
 		metrics:              metrics,
+		rateLimiter:          rateLimiter,
+		namePolicy:           namePolicy,
 		runtime:              runtime,
 		grpcServer:           grpcServer,
 	}
+	if mailConfig := config.GetMail(); mailConfig.SmtpAddress != "" {
+		s.mailProvider = mail.NewSMTPProvider(logger, mailConfig.SmtpAddress, mailConfig.SmtpUsername, mailConfig.SmtpPassword, mailConfig.From, time.Duration(mailConfig.TimeoutMs)*time.Millisecond)
+	}
 
 	// Register and start GRPC server.
 	apigrpc.RegisterNakamaServer(grpcServer, s)
@@ -152,6 +172,10 @@ func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, p
 	ctx := context.Background()
 	grpcGateway := grpcgw.NewServeMux(
 		grpcgw.WithMetadata(func(ctx context.Context, r *http.Request) metadata.MD {
+			if md, found := groupQueryMetadata(r); found {
+				return md
+			}
+
 			// For RPC GET operations pass through any custom query parameters.
 			if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, "/v2/rpc/") {
 				return metadata.MD{}
@@ -168,6 +192,13 @@ func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, p
 			}
 			return metadata.MD(p)
 		}),
+		grpcgw.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			// Rate limited clients are told when to retry with the standard HTTP header.
+			if key == rateLimitRetryAfterHeader {
+				return "Retry-After", true
+			}
+			return grpcgw.MetadataHeaderPrefix + key, true
+		}),
 		grpcgw.WithMarshalerOption(grpcgw.MIMEWildcard, &grpcgw.HTTPBodyMarshaler{
 			Marshaler: &grpcgw.JSONPb{
 				MarshalOptions: protojson.MarshalOptions{
@@ -217,6 +248,39 @@ func StartApiServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, p
 	// Another nested router to hijack RPC requests bound for GRPC Gateway.
 	grpcGatewayMux := mux.NewRouter()
 	grpcGatewayMux.HandleFunc("/v2/rpc/{id:.*}", s.RpcFuncHttp).Methods("GET", "POST")
+	grpcGatewayMux.HandleFunc("/v2/account/authenticate/oidc/{provider}", s.AuthenticateOIDCHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/link/oidc/{provider}", s.LinkOIDCHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/unlink/oidc/{provider}", s.UnlinkOIDCHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/session", s.SessionsListHttp).Methods("GET")
+	grpcGatewayMux.HandleFunc("/v2/account/session/{id}", s.SessionRevokeHttp).Methods("DELETE")
+	grpcGatewayMux.HandleFunc("/v2/account/email/verify", s.EmailVerificationRequestHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/email/verify/confirm", s.EmailVerificationConfirmHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/email/password/forgot", s.PasswordResetRequestHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/email/password/reset", s.PasswordResetHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/email/change", s.EmailChangeRequestHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/email/change/confirm", s.EmailChangeConfirmHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/authenticate/totp", s.AuthenticateTotpHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/totp/enrol", s.TotpEnrolHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/totp/confirm", s.TotpConfirmHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/totp/disable", s.TotpDisableHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/totp/recovery", s.TotpRecoveryCodesHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/export", s.AccountExportRequestHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/export/{id}", s.AccountExportGetHttp).Methods("GET")
+	grpcGatewayMux.HandleFunc("/v2/group/invite", s.GroupInvitesListHttp).Methods("GET")
+	grpcGatewayMux.HandleFunc("/v2/group/{id}/invite", s.GroupInviteUsersHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/group/{id}/invite/accept", s.GroupInviteAcceptHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/group/{id}/invite/reject", s.GroupInviteRejectHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/group/{id}/application", s.GroupApplicationsListHttp).Methods("GET")
+	grpcGatewayMux.HandleFunc("/v2/trade", s.TradeProposeHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/trade", s.TradeListHttp).Methods("GET")
+	grpcGatewayMux.HandleFunc("/v2/trade/{id}", s.TradeGetHttp).Methods("GET")
+	grpcGatewayMux.HandleFunc("/v2/trade/{id}/counter", s.TradeCounterHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/trade/{id}/accept", s.TradeAcceptHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/trade/{id}/cancel", s.TradeCancelHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/store/catalog", s.StoreCatalogHttp).Methods("GET")
+	grpcGatewayMux.HandleFunc("/v2/store/purchase", s.StorePurchaseHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/account/merge", s.AccountMergeHttp).Methods("POST")
+	grpcGatewayMux.HandleFunc("/v2/storage/options", s.WriteStorageObjectsOptionsHttp).Methods("PUT")
 	grpcGatewayMux.NewRoute().Handler(grpcGateway)
 
 	// Enable stats recording on all request paths except:
@@ -444,6 +508,29 @@ func securityInterceptorFunc(logger *zap.Logger, config Config, sessionCache Ses
 	return context.WithValue(ctx, ctxFullMethodKey{}, info.FullMethod), nil
 }
 
+func rateLimitInterceptorFunc(logger *zap.Logger, rateLimiter RateLimiter, ctx context.Context, req interface{}, info *grpc.UnaryServerInfo) error {
+	if info.FullMethod == "/nakama.api.Nakama/Healthcheck" {
+		return nil
+	}
+
+	var rpcID string
+	if in, ok := req.(*api.Rpc); ok {
+		rpcID = in.Id
+	}
+	// Unauthenticated requests have no user, and are only limited by client IP.
+	userID, _ := ctx.Value(ctxUserIDKey{}).(uuid.UUID)
+	clientIP, _ := extractClientAddressFromContext(logger, ctx)
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+
+	if allowed, wait := rateLimiter.AllowRequest(method, rpcID, userID, clientIP); !allowed {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(rateLimitRetryAfterHeader, strconv.FormatInt(rateLimitRetryAfterSec(wait), 10))); err != nil {
+			logger.Debug("Error setting rate limit retry header", zap.Error(err))
+		}
+		return status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+	}
+	return nil
+}
+
 func parseBasicAuth(auth string) (username, password string, ok bool) {
 	if auth == "" {
 		return
@@ -476,6 +563,14 @@ func parseBearerAuth(hmacSecretByte []byte, auth string) (userID uuid.UUID, user
 }
 
 func parseToken(hmacSecretByte []byte, tokenString string) (userID uuid.UUID, username string, vars map[string]string, exp int64, tokenId string, ok bool) {
+	claims, userID, ok := parseTokenClaims(hmacSecretByte, tokenString)
+	if !ok {
+		return
+	}
+	return userID, claims.Username, claims.Vars, claims.ExpiresAt, claims.TokenId, true
+}
+
+func parseTokenClaims(hmacSecretByte []byte, tokenString string) (*SessionTokenClaims, uuid.UUID, bool) {
 	jwtToken, err := jwt.ParseWithClaims(tokenString, &SessionTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if s, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || s.Hash != crypto.SHA256 {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -483,17 +578,17 @@ func parseToken(hmacSecretByte []byte, tokenString string) (userID uuid.UUID, us
 		return hmacSecretByte, nil
 	})
 	if err != nil {
-		return
+		return nil, uuid.Nil, false
 	}
 	claims, ok := jwtToken.Claims.(*SessionTokenClaims)
 	if !ok || !jwtToken.Valid {
-		return
+		return nil, uuid.Nil, false
 	}
-	userID, err = uuid.FromString(claims.UserId)
+	userID, err := uuid.FromString(claims.UserId)
 	if err != nil {
-		return
+		return nil, uuid.Nil, false
 	}
-	return userID, claims.Username, claims.Vars, claims.ExpiresAt, claims.TokenId, true
+	return claims, userID, true
 }
 
 func decompressHandler(logger *zap.Logger, h http.Handler) http.HandlerFunc {
@@ -594,3 +689,99 @@ func traceApiAfter(ctx context.Context, logger *zap.Logger, metrics Metrics, ful
 
 	metrics.ApiAfter(fullMethodName, time.Since(start), err != nil)
 }
+
+var serverKeyInvalidBytes = []byte(`{"error":"Server key invalid","message":"Server key invalid","code":16}`)
+
+var rateLimitExceededBytes = []byte(`{"error":"Rate limit exceeded","message":"Rate limit exceeded","code":8}`)
+
+// Check the server key basic auth on a plain HTTP route, writing an unauthorized response if it is not valid.
+func (s *ApiServer) checkHttpServerKey(w http.ResponseWriter, r *http.Request) bool {
+	if auth := r.Header["Authorization"]; len(auth) != 1 {
+		s.writeHttpBytes(w, http.StatusUnauthorized, serverKeyInvalidBytes)
+		return false
+	} else if serverKey, _, ok := parseBasicAuth(auth[0]); !ok || serverKey != s.config.GetSocket().ServerKey {
+		s.writeHttpBytes(w, http.StatusUnauthorized, serverKeyInvalidBytes)
+		return false
+	}
+	return s.checkHttpRateLimit(w, r, "", uuid.Nil)
+}
+
+// Check the bearer session token on a plain HTTP route, writing an unauthorized response if it is not valid.
+func (s *ApiServer) readHttpSession(w http.ResponseWriter, r *http.Request) (uuid.UUID, string, bool) {
+	auth := r.Header["Authorization"]
+	if len(auth) != 1 {
+		s.writeHttpBytes(w, http.StatusUnauthorized, authTokenInvalidBytes)
+		return uuid.Nil, "", false
+	}
+	userID, _, _, expiry, tokenID, ok := parseBearerAuth([]byte(s.config.GetSession().EncryptionKey), auth[0])
+	if !ok || !s.sessionCache.IsValidSession(userID, expiry, tokenID) {
+		s.writeHttpBytes(w, http.StatusUnauthorized, authTokenInvalidBytes)
+		return uuid.Nil, "", false
+	}
+	if !s.checkHttpRateLimit(w, r, "", userID) {
+		return uuid.Nil, "", false
+	}
+	return userID, tokenID, true
+}
+
+// Check the request rate on a plain HTTP route, writing a too many requests response if a limit is exceeded. Routes
+// are limited by their path template, and RPCs by their ID.
+func (s *ApiServer) checkHttpRateLimit(w http.ResponseWriter, r *http.Request, rpcID string, userID uuid.UUID) bool {
+	var method string
+	if route := mux.CurrentRoute(r); route != nil && rpcID == "" {
+		method, _ = route.GetPathTemplate()
+	}
+	clientIP, _ := extractClientAddressFromRequest(s.logger, r)
+
+	if allowed, wait := s.rateLimiter.AllowRequest(method, rpcID, userID, clientIP); !allowed {
+		w.Header().Set("Retry-After", strconv.FormatInt(rateLimitRetryAfterSec(wait), 10))
+		s.writeHttpBytes(w, http.StatusTooManyRequests, rateLimitExceededBytes)
+		return false
+	}
+	return true
+}
+
+// Decode a JSON request body on a plain HTTP route into out, an empty body leaves it unchanged.
+func (s *ApiServer) readHttpBody(w http.ResponseWriter, r *http.Request, out interface{}) bool {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			s.writeHttpBytes(w, http.StatusBadRequest, requestBodyTooLargeBytes)
+		} else {
+			s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		}
+		return false
+	}
+
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, out); err != nil {
+			s.writeHttpError(w, status.Error(codes.InvalidArgument, "Invalid request body."))
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ApiServer) writeHttpError(w http.ResponseWriter, err error) {
+	st, _ := status.FromError(err)
+	body := map[string]interface{}{"error": st.Message(), "message": st.Message(), "code": st.Code()}
+	details := make([]map[string]interface{}, 0)
+	for _, detail := range st.Details() {
+		if d, ok := detail.(*structpb.Struct); ok {
+			details = append(details, d.AsMap())
+		}
+	}
+	if len(details) > 0 {
+		body["details"] = details
+	}
+	response, _ := json.Marshal(body)
+	s.writeHttpBytes(w, grpcgw.HTTPStatusFromCode(st.Code()), response)
+}
+
+func (s *ApiServer) writeHttpBytes(w http.ResponseWriter, code int, response []byte) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(response); err != nil {
+		s.logger.Debug("Error writing response to client", zap.Error(err))
+	}
+}
@@ -93,7 +93,15 @@ func (s *ApiServer) DeleteAccount(ctx context.Context, in *emptypb.Empty) (*empt
 		}
 	}
 
-	if err := DeleteAccount(ctx, s.logger, s.db, s.config, s.leaderboardCache, s.leaderboardRankCache, s.sessionRegistry, s.sessionCache, s.tracker, userID, false); err != nil {
+	if s.config.GetAccount().DeletionGracePeriodSec > 0 {
+		// The account is signed out now, and only deleted if the user does not log in again during the grace period.
+		if _, err := AccountDeletionSchedule(ctx, s.logger, s.db, s.config, s.sessionRegistry, s.sessionCache, s.tracker, userID); err != nil {
+			if err == ErrAccountNotFound {
+				return nil, status.Error(codes.NotFound, "Account not found.")
+			}
+			return nil, status.Error(codes.Internal, "Error deleting user account.")
+		}
+	} else if err := DeleteAccount(ctx, s.logger, s.db, s.config, s.metrics, s.leaderboardCache, s.leaderboardRankCache, s.storageIndex, s.storageCollections, s.groupIndex, s.sessionRegistry, s.sessionCache, s.tracker, s.router, userID, false); err != nil {
 		if err == ErrAccountNotFound {
 			return nil, status.Error(codes.NotFound, "Account not found.")
 		}
@@ -155,8 +163,13 @@ func (s *ApiServer) UpdateAccount(ctx context.Context, in *api.UpdateAccountRequ
 		langTag:     in.GetLangTag(),
 		avatarURL:   in.GetAvatarUrl(),
 		metadata:    nil,
+		namePolicy:  s.namePolicy,
 	}})
 	if err != nil {
+		var violation *NamePolicyViolation
+		if errors.As(err, &violation) {
+			return nil, violation.Status()
+		}
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			return nil, status.Error(codes.Internal, "Error while trying to update account.")
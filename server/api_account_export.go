@@ -0,0 +1,72 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AccountExportRequestHttp queues an export of the session user's account data. The user receives a notification
+// when it is ready to download.
+func (s *ApiServer) AccountExportRequestHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := AccountExportRequest(r.Context(), s.logger, s.db, s.config, userID)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeAccountExportHttpResponse(w, export)
+}
+
+// AccountExportGetHttp returns the state of one of the session user's account exports, with its data once complete.
+func (s *ApiServer) AccountExportGetHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	exportID, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Invalid account export ID."))
+		return
+	}
+
+	export, err := AccountExportGet(r.Context(), s.logger, s.db, userID, exportID)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeAccountExportHttpResponse(w, export)
+}
+
+func (s *ApiServer) writeAccountExportHttpResponse(w http.ResponseWriter, export *AccountExport) {
+	response, err := json.Marshal(export)
+	if err != nil {
+		s.logger.Error("Error marshaling account export response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type accountMergeRequest struct {
+	// Session token of the account merged into the session user's account. It proves the player owns both accounts.
+	SourceToken string `json:"source_token"`
+}
+
+// AccountMergeHttp merges another account the player owns into the session user's account, then deletes it. This is
+// typically used when linking an identity that is already used by another account.
+func (s *ApiServer) AccountMergeHttp(w http.ResponseWriter, r *http.Request) {
+	targetID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	in := &accountMergeRequest{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+	claims, sourceID, ok := parseTokenClaims([]byte(s.config.GetSession().EncryptionKey), in.SourceToken)
+	if !ok || !s.sessionCache.IsValidSession(sourceID, claims.ExpiresAt, claims.TokenId) {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Source session token is invalid."))
+		return
+	}
+	if sourceID == targetID {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, ErrAccountMergeSame.Error()))
+		return
+	}
+	_, targetUsername, _, _, _, _ := parseBearerAuth([]byte(s.config.GetSession().EncryptionKey), r.Header.Get("Authorization"))
+
+	policy, err := accountMergeHook(r.Context(), s.runtime.BeforeAccountMerge(), targetUsername, NewAccountMergePolicy(sourceID, targetID))
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	if err = AccountMerge(r.Context(), s.logger, s.db, s.config, s.metrics, s.leaderboardCache, s.leaderboardRankCache, s.storageIndex, s.storageCollections, s.groupIndex, s.sessionRegistry, s.sessionCache, s.tracker, s.router, policy); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
@@ -38,6 +38,7 @@ var (
 
 type SessionTokenClaims struct {
 	TokenId   string            `json:"tid,omitempty"`
+	FamilyId  string            `json:"fid,omitempty"`
 	UserId    string            `json:"uid,omitempty"`
 	Username  string            `json:"usn,omitempty"`
 	Vars      map[string]string `json:"vrs,omitempty"`
@@ -98,16 +99,15 @@ func (s *ApiServer) AuthenticateApple(ctx context.Context, in *api.AuthenticateA
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, created, err := AuthenticateApple(ctx, s.logger, s.db, s.socialClient, s.config.GetSocial().Apple.BundleId, in.Account.Token, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateApple(ctx, s.logger, s.db, s.socialClient, s.usernamePolicy(in.Username), s.config.GetSocial().Apple.BundleId, in.Account.Token, username, create)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateApple(); fn != nil {
@@ -165,16 +165,15 @@ func (s *ApiServer) AuthenticateCustom(ctx context.Context, in *api.Authenticate
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, created, err := AuthenticateCustom(ctx, s.logger, s.db, in.Account.Id, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateCustom(ctx, s.logger, s.db, s.usernamePolicy(in.Username), in.Account.Id, username, create)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateCustom(); fn != nil {
@@ -232,16 +231,15 @@ func (s *ApiServer) AuthenticateDevice(ctx context.Context, in *api.Authenticate
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, created, err := AuthenticateDevice(ctx, s.logger, s.db, in.Account.Id, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateDevice(ctx, s.logger, s.db, s.usernamePolicy(in.Username), in.Account.Id, username, create)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateDevice(); fn != nil {
@@ -322,23 +320,22 @@ func (s *ApiServer) AuthenticateEmail(ctx context.Context, in *api.AuthenticateE
 
 	if attemptUsernameLogin {
 		// Attempting to log in with username/password. Create flag is ignored, creation is not possible here.
-		dbUserID, err = AuthenticateUsername(ctx, s.logger, s.db, username, email.Password)
+		dbUserID, err = AuthenticateUsername(ctx, s.logger, s.db, s.config, username, email.Password)
 	} else {
 		// Attempting email authentication, may or may not create.
 		cleanEmail := strings.ToLower(email.Email)
 		create := in.Create == nil || in.Create.Value
 
-		dbUserID, username, created, err = AuthenticateEmail(ctx, s.logger, s.db, cleanEmail, email.Password, username, create)
+		dbUserID, username, created, err = AuthenticateEmail(ctx, s.logger, s.db, s.config, s.usernamePolicy(in.Username), cleanEmail, email.Password, username, create)
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, username, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, username, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, username, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateEmail(); fn != nil {
@@ -392,7 +389,7 @@ func (s *ApiServer) AuthenticateFacebook(ctx context.Context, in *api.Authentica
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(ctx, s.logger, s.db, s.socialClient, s.config.GetSocial().FacebookLimitedLogin.AppId, in.Account.Token, username, create)
+	dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(ctx, s.logger, s.db, s.socialClient, s.usernamePolicy(in.Username), s.config.GetSocial().FacebookLimitedLogin.AppId, in.Account.Token, username, create)
 	if err != nil {
 		return nil, err
 	}
@@ -402,11 +399,10 @@ func (s *ApiServer) AuthenticateFacebook(ctx context.Context, in *api.Authentica
 		_ = importFacebookFriends(ctx, s.logger, s.db, s.tracker, s.router, s.socialClient, uuid.FromStringOrNil(dbUserID), dbUsername, in.Account.Token, false)
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateFacebook(); fn != nil {
@@ -460,15 +456,14 @@ func (s *ApiServer) AuthenticateFacebookInstantGame(ctx context.Context, in *api
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, created, err := AuthenticateFacebookInstantGame(ctx, s.logger, s.db, s.socialClient, s.config.GetSocial().FacebookInstantGame.AppSecret, in.Account.SignedPlayerInfo, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateFacebookInstantGame(ctx, s.logger, s.db, s.socialClient, s.usernamePolicy(in.Username), s.config.GetSocial().FacebookInstantGame.AppSecret, in.Account.SignedPlayerInfo, username, create)
+	if err != nil {
+		return nil, err
+	}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
 	if err != nil {
 		return nil, err
 	}
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateFacebookInstantGame(); fn != nil {
@@ -534,16 +529,15 @@ func (s *ApiServer) AuthenticateGameCenter(ctx context.Context, in *api.Authenti
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, created, err := AuthenticateGameCenter(ctx, s.logger, s.db, s.socialClient, in.Account.PlayerId, in.Account.BundleId, in.Account.TimestampSeconds, in.Account.Salt, in.Account.Signature, in.Account.PublicKeyUrl, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateGameCenter(ctx, s.logger, s.db, s.socialClient, s.usernamePolicy(in.Username), in.Account.PlayerId, in.Account.BundleId, in.Account.TimestampSeconds, in.Account.Salt, in.Account.Signature, in.Account.PublicKeyUrl, username, create)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateGameCenter(); fn != nil {
@@ -597,16 +591,15 @@ func (s *ApiServer) AuthenticateGoogle(ctx context.Context, in *api.Authenticate
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, created, err := AuthenticateGoogle(ctx, s.logger, s.db, s.socialClient, in.Account.Token, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateGoogle(ctx, s.logger, s.db, s.socialClient, s.usernamePolicy(in.Username), in.Account.Token, username, create)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateGoogle(); fn != nil {
@@ -664,7 +657,7 @@ func (s *ApiServer) AuthenticateSteam(ctx context.Context, in *api.AuthenticateS
 
 	create := in.Create == nil || in.Create.Value
 
-	dbUserID, dbUsername, steamID, created, err := AuthenticateSteam(ctx, s.logger, s.db, s.socialClient, s.config.GetSocial().Steam.AppID, s.config.GetSocial().Steam.PublisherKey, in.Account.Token, username, create)
+	dbUserID, dbUsername, steamID, created, err := AuthenticateSteam(ctx, s.logger, s.db, s.socialClient, s.usernamePolicy(in.Username), s.config.GetSocial().Steam.AppID, s.config.GetSocial().Steam.PublisherKey, in.Account.Token, username, create)
 	if err != nil {
 		return nil, err
 	}
@@ -674,11 +667,10 @@ func (s *ApiServer) AuthenticateSteam(ctx context.Context, in *api.AuthenticateS
 		_ = importSteamFriends(ctx, s.logger, s.db, s.tracker, s.router, s.socialClient, uuid.FromStringOrNil(dbUserID), dbUsername, s.config.GetSocial().Steam.PublisherKey, steamID, false)
 	}
 
-	tokenID := uuid.Must(uuid.NewV4()).String()
-	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, in.Account.Vars)
-	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
-	session := &api.Session{Created: created, Token: token, RefreshToken: refreshToken}
+	session, exp, err := s.authenticateSession(ctx, dbUserID, dbUsername, in.Account.Vars, created)
+	if err != nil {
+		return nil, err
+	}
 
 	// After hook.
 	if fn := s.runtime.AfterAuthenticateSteam(); fn != nil {
@@ -693,6 +685,38 @@ func (s *ApiServer) AuthenticateSteam(ctx context.Context, in *api.AuthenticateS
 	return session, nil
 }
 
+// The name policy applies to usernames players choose for new accounts, generated usernames are not checked.
+func (s *ApiServer) usernamePolicy(username string) NamePolicy {
+	if username == "" {
+		return nil
+	}
+	return s.namePolicy
+}
+
+// Issue a session for an authenticated account. Existing accounts with two-factor authentication are refused one
+// until they complete the challenge returned in the error details.
+func (s *ApiServer) authenticateSession(ctx context.Context, dbUserID, username string, vars map[string]string, created bool) (*api.Session, int64, error) {
+	userID := uuid.FromStringOrNil(dbUserID)
+	if !created {
+		if err := TotpChallengeCheck(ctx, s.logger, s.db, s.config, userID, username, vars); err != nil {
+			return nil, 0, err
+		}
+		// Authenticating within the grace period restores an account scheduled for deletion.
+		if _, err := AccountDeletionCancel(ctx, s.logger, s.db, userID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	tokenID := uuid.Must(uuid.NewV4()).String()
+	token, exp := generateToken(s.config, tokenID, dbUserID, username, vars)
+	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, username, vars)
+	if err := s.recordSession(ctx, userID, tokenID, tokenID, vars, refreshExp); err != nil {
+		return nil, 0, err
+	}
+	s.sessionCache.Add(userID, exp, tokenID, refreshExp, tokenID)
+	return &api.Session{Created: created, Token: token, RefreshToken: refreshToken}, exp, nil
+}
+
 func generateToken(config Config, tokenID, userID, username string, vars map[string]string) (string, int64) {
 	exp := time.Now().UTC().Add(time.Duration(config.GetSession().TokenExpirySec) * time.Second).Unix()
 	return generateTokenWithExpiry(config.GetSession().EncryptionKey, tokenID, userID, username, vars, exp)
@@ -703,6 +727,21 @@ func generateRefreshToken(config Config, tokenID, userID string, username string
 	return generateTokenWithExpiry(config.GetSession().RefreshEncryptionKey, tokenID, userID, username, vars, exp)
 }
 
+// Generate a refresh token that replaced an earlier one, the family ID is the token ID of the session it belongs to.
+func generateRotatedRefreshToken(config Config, tokenID, familyID, userID string, username string, vars map[string]string) (string, int64) {
+	exp := time.Now().UTC().Add(time.Duration(config.GetSession().RefreshTokenExpirySec) * time.Second).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &SessionTokenClaims{
+		TokenId:   tokenID,
+		FamilyId:  familyID,
+		UserId:    userID,
+		Username:  username,
+		Vars:      vars,
+		ExpiresAt: exp,
+	})
+	signedToken, _ := token.SignedString([]byte(config.GetSession().RefreshEncryptionKey))
+	return signedToken, exp
+}
+
 func generateTokenWithExpiry(signingKey, tokenID, userID, username string, vars map[string]string, exp int64) (string, int64) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &SessionTokenClaims{
 		TokenId:   tokenID,
@@ -0,0 +1,126 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+)
+
+// Request body for the email verification, password reset and email change routes.
+type accountEmailToken struct {
+	Email    string `json:"email"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// EmailVerificationRequestHttp sends a verification token to the session user's email address.
+func (s *ApiServer) EmailVerificationRequestHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+
+	if err := EmailVerificationRequest(r.Context(), s.logger, s.db, s.config, s.mailProvider, s.runtime.EmailTemplate(), userID); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// EmailVerificationConfirmHttp marks an account's email as verified with a token sent to it. The token is the only proof
+// of identity needed, so the route only requires the server key.
+func (s *ApiServer) EmailVerificationConfirmHttp(w http.ResponseWriter, r *http.Request) {
+	in, ok := s.readEmailHttpRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := EmailVerificationConfirm(r.Context(), s.logger, s.db, in.Token); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// PasswordResetRequestHttp sends a password reset token to an email address, if it belongs to an account.
+func (s *ApiServer) PasswordResetRequestHttp(w http.ResponseWriter, r *http.Request) {
+	in, ok := s.readEmailHttpRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := PasswordResetRequest(r.Context(), s.logger, s.db, s.config, s.mailProvider, s.runtime.EmailTemplate(), in.Email); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// PasswordResetHttp sets a new password with a password reset token.
+func (s *ApiServer) PasswordResetHttp(w http.ResponseWriter, r *http.Request) {
+	in, ok := s.readEmailHttpRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := PasswordReset(r.Context(), s.logger, s.db, s.config, s.sessionCache, in.Token, in.Password); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// EmailChangeRequestHttp sends a token to the new email address the session user wants to use.
+func (s *ApiServer) EmailChangeRequestHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	in := &accountEmailToken{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+
+	if err := EmailChangeRequest(r.Context(), s.logger, s.db, s.config, s.mailProvider, s.runtime.EmailTemplate(), userID, in.Email); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// EmailChangeConfirmHttp changes an account's email to the address a change token was sent to.
+func (s *ApiServer) EmailChangeConfirmHttp(w http.ResponseWriter, r *http.Request) {
+	in, ok := s.readEmailHttpRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := EmailChangeConfirm(r.Context(), s.logger, s.db, in.Token); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+func (s *ApiServer) readEmailHttpRequest(w http.ResponseWriter, r *http.Request) (*accountEmailToken, bool) {
+	if !s.checkHttpServerKey(w, r) {
+		return nil, false
+	}
+	in := &accountEmailToken{}
+	if !s.readHttpBody(w, r, in) {
+		return nil, false
+	}
+	return in, true
+}
@@ -16,12 +16,16 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
@@ -54,6 +58,8 @@ func (s *ApiServer) CreateGroup(ctx context.Context, in *api.CreateGroupRequest)
 
 	if in.GetName() == "" {
 		return nil, status.Error(codes.InvalidArgument, "Group name must be set.")
+	} else if err := s.namePolicy.Check(NamePolicyFieldGroupName, in.GetName()); err != nil {
+		return nil, namePolicyStatus(err)
 	}
 
 	maxCount := 100
@@ -64,7 +70,7 @@ func (s *ApiServer) CreateGroup(ctx context.Context, in *api.CreateGroupRequest)
 		maxCount = int(mc)
 	}
 
-	group, err := CreateGroup(ctx, s.logger, s.db, userID, userID, in.GetName(), in.GetLangTag(), in.GetDescription(), in.GetAvatarUrl(), "", in.GetOpen(), maxCount)
+	group, err := CreateGroup(ctx, s.logger, s.db, s.groupIndex, userID, userID, in.GetName(), in.GetLangTag(), in.GetDescription(), in.GetAvatarUrl(), "", in.GetOpen(), maxCount)
 	if err != nil {
 		if err == runtime.ErrGroupNameInUse {
 			return nil, status.Error(codes.AlreadyExists, "Group name is in use.")
@@ -124,6 +130,9 @@ func (s *ApiServer) UpdateGroup(ctx context.Context, in *api.UpdateGroupRequest)
 		if len(in.GetName().String()) < 1 {
 			return nil, status.Error(codes.InvalidArgument, "Group name cannot be empty.")
 		}
+		if err = s.namePolicy.Check(NamePolicyFieldGroupName, in.GetName().GetValue()); err != nil {
+			return nil, namePolicyStatus(err)
+		}
 	}
 
 	if in.GetLangTag() != nil {
@@ -132,7 +141,7 @@ func (s *ApiServer) UpdateGroup(ctx context.Context, in *api.UpdateGroupRequest)
 		}
 	}
 
-	if err = UpdateGroup(ctx, s.logger, s.db, groupID, userID, uuid.Nil, in.GetName(), in.GetLangTag(), in.GetDescription(), in.GetAvatarUrl(), nil, in.GetOpen(), -1); err != nil {
+	if err = UpdateGroup(ctx, s.logger, s.db, s.groupIndex, groupID, userID, uuid.Nil, in.GetName(), in.GetLangTag(), in.GetDescription(), in.GetAvatarUrl(), nil, in.GetOpen(), -1); err != nil {
 		switch err {
 		case runtime.ErrGroupPermissionDenied:
 			return nil, status.Error(codes.NotFound, "Group not found or you're not allowed to update.")
@@ -195,7 +204,7 @@ func (s *ApiServer) DeleteGroup(ctx context.Context, in *api.DeleteGroupRequest)
 		return nil, status.Error(codes.InvalidArgument, "Group ID must be a valid ID.")
 	}
 
-	err = DeleteGroup(ctx, s.logger, s.db, groupID, userID)
+	err = DeleteGroup(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.groupIndex, groupID, userID)
 	if err != nil {
 		if err == runtime.ErrGroupPermissionDenied {
 			return nil, status.Error(codes.InvalidArgument, "Group not found or you're not allowed to delete.")
@@ -252,7 +261,15 @@ func (s *ApiServer) JoinGroup(ctx context.Context, in *api.JoinGroupRequest) (*e
 		return nil, status.Error(codes.InvalidArgument, "Group ID must be a valid ID.")
 	}
 
-	err = JoinGroup(ctx, s.logger, s.db, s.tracker, s.router, groupID, userID, username)
+	application := groupMetadataValue(ctx, groupJoinApplicationMetadataKey)
+	if application != "" {
+		var form map[string]interface{}
+		if json.Unmarshal([]byte(application), &form) != nil {
+			return nil, status.Error(codes.InvalidArgument, "Application must be a JSON object.")
+		}
+	}
+
+	err = JoinGroup(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, groupID, userID, username, application)
 	if err != nil {
 		if err == runtime.ErrGroupNotFound {
 			return nil, status.Error(codes.NotFound, "Group not found.")
@@ -311,7 +328,7 @@ func (s *ApiServer) LeaveGroup(ctx context.Context, in *api.LeaveGroupRequest) (
 		return nil, status.Error(codes.InvalidArgument, "Group ID must be a valid ID.")
 	}
 
-	err = LeaveGroup(ctx, s.logger, s.db, s.tracker, s.router, s.streamManager, groupID, userID, username)
+	err = LeaveGroup(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, s.streamManager, groupID, userID, username)
 	if err != nil {
 		if err == runtime.ErrGroupLastSuperadmin {
 			return nil, status.Error(codes.InvalidArgument, "Cannot leave group when you are the last superadmin.")
@@ -380,7 +397,7 @@ func (s *ApiServer) AddGroupUsers(ctx context.Context, in *api.AddGroupUsersRequ
 		userIDs = append(userIDs, uid)
 	}
 
-	err = AddGroupUsers(ctx, s.logger, s.db, s.tracker, s.router, userID, groupID, userIDs)
+	err = AddGroupUsers(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, userID, groupID, userIDs)
 	if err != nil {
 		if err == runtime.ErrGroupPermissionDenied {
 			return nil, status.Error(codes.NotFound, "Group not found or permission denied.")
@@ -453,7 +470,7 @@ func (s *ApiServer) BanGroupUsers(ctx context.Context, in *api.BanGroupUsersRequ
 		userIDs = append(userIDs, uid)
 	}
 
-	if err = BanGroupUsers(ctx, s.logger, s.db, s.tracker, s.router, s.streamManager, userID, groupID, userIDs); err != nil {
+	if err = BanGroupUsers(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, s.streamManager, userID, groupID, userIDs); err != nil {
 		if err == runtime.ErrGroupPermissionDenied {
 			return nil, status.Error(codes.NotFound, "Group not found or permission denied.")
 		}
@@ -521,7 +538,7 @@ func (s *ApiServer) KickGroupUsers(ctx context.Context, in *api.KickGroupUsersRe
 		userIDs = append(userIDs, uid)
 	}
 
-	if err = KickGroupUsers(ctx, s.logger, s.db, s.tracker, s.router, s.streamManager, userID, groupID, userIDs, false); err != nil {
+	if err = KickGroupUsers(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, s.streamManager, userID, groupID, userIDs, false); err != nil {
 		if err == runtime.ErrGroupPermissionDenied {
 			return nil, status.Error(codes.NotFound, "Group not found or permission denied.")
 		}
@@ -821,6 +838,45 @@ func (s *ApiServer) ListUserGroups(ctx context.Context, in *api.ListUserGroupsRe
 	return userGroups, nil
 }
 
+// Group request options with no field in their request messages, read from query parameters on HTTP routes or from
+// these metadata keys on gRPC.
+const (
+	// Query string search of the group index when listing groups.
+	groupListSearchMetadataKey = "q_search"
+	// JSON object application form attached to a join request.
+	groupJoinApplicationMetadataKey = "q_application"
+)
+
+var groupJoinPathRegex = regexp.MustCompile(`^/v2/group/[^/]+/join$`)
+
+// Pass group route query parameters through the gateway as metadata.
+func groupQueryMetadata(r *http.Request) (metadata.MD, bool) {
+	var param, key string
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v2/group":
+		param, key = "search", groupListSearchMetadataKey
+	case r.Method == http.MethodPost && groupJoinPathRegex.MatchString(r.URL.Path):
+		param, key = "application", groupJoinApplicationMetadataKey
+	default:
+		return nil, false
+	}
+	if value := r.URL.Query().Get(param); value != "" {
+		return metadata.Pairs(key, value), true
+	}
+	return metadata.MD{}, true
+}
+
+func groupMetadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
 func (s *ApiServer) ListGroups(ctx context.Context, in *api.ListGroupsRequest) (*api.GroupList, error) {
 	// Before hook.
 	if fn := s.runtime.BeforeListGroups(); fn != nil {
@@ -865,7 +921,7 @@ func (s *ApiServer) ListGroups(ctx context.Context, in *api.ListGroupsRequest) (
 		edgeCount = int(in.Members.GetValue())
 	}
 
-	groups, err := ListGroups(ctx, s.logger, s.db, in.GetName(), in.GetLangTag(), open, edgeCount, limit, in.GetCursor())
+	groups, err := ListGroups(ctx, s.logger, s.db, s.groupIndex, in.GetName(), in.GetLangTag(), groupMetadataValue(ctx, groupListSearchMetadataKey), open, edgeCount, limit, in.GetCursor())
 	if err != nil {
 		if sErr, ok := err.(*statusError); ok {
 			return nil, sErr.Status()
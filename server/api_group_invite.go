@@ -0,0 +1,159 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/mux"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type groupInviteUsersRequest struct {
+	UserIds   []string `json:"user_ids"`
+	ExpirySec int      `json:"expiry_sec"`
+}
+
+// GroupInviteUsersHttp invites users to a group the session user may invite to.
+func (s *ApiServer) GroupInviteUsersHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, groupID, ok := s.readGroupInviteHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	in := &groupInviteUsersRequest{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+	if len(in.UserIds) == 0 {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "User IDs must be set."))
+		return
+	}
+	userIDs := make([]uuid.UUID, 0, len(in.UserIds))
+	for _, id := range in.UserIds {
+		uid, err := uuid.FromString(id)
+		if err != nil || uid == uuid.Nil {
+			s.writeHttpError(w, status.Error(codes.InvalidArgument, "User IDs must be valid IDs."))
+			return
+		}
+		userIDs = append(userIDs, uid)
+	}
+
+	if err := GroupInviteUsers(r.Context(), s.logger, s.db, s.tracker, s.router, userID, groupID, userIDs, in.ExpirySec); err != nil {
+		s.writeHttpError(w, groupInviteStatus(err))
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// GroupInviteAcceptHttp joins a group the session user holds an invite to.
+func (s *ApiServer) GroupInviteAcceptHttp(w http.ResponseWriter, r *http.Request) {
+	userID, username, groupID, ok := s.readGroupInviteHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := GroupInviteAccept(r.Context(), s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, groupID, userID, username); err != nil {
+		s.writeHttpError(w, groupInviteStatus(err))
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// GroupInviteRejectHttp discards the session user's invite to a group.
+func (s *ApiServer) GroupInviteRejectHttp(w http.ResponseWriter, r *http.Request) {
+	userID, username, groupID, ok := s.readGroupInviteHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := GroupInviteReject(r.Context(), s.logger, s.db, s.tracker, s.router, groupID, userID, username); err != nil {
+		s.writeHttpError(w, groupInviteStatus(err))
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// GroupInvitesListHttp lists the session user's pending group invites.
+func (s *ApiServer) GroupInvitesListHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	invites, err := GroupInvitesList(r.Context(), s.logger, s.db, userID)
+	if err != nil {
+		s.writeHttpError(w, groupInviteStatus(err))
+		return
+	}
+	s.writeGroupInviteHttpResponse(w, map[string]interface{}{"invites": invites})
+}
+
+// GroupApplicationsListHttp lists the applications attached to pending join requests to a group, for users who may
+// accept them.
+func (s *ApiServer) GroupApplicationsListHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, groupID, ok := s.readGroupInviteHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	applications, err := GroupApplicationsList(r.Context(), s.logger, s.db, userID, groupID)
+	if err != nil {
+		s.writeHttpError(w, groupInviteStatus(err))
+		return
+	}
+	s.writeGroupInviteHttpResponse(w, map[string]interface{}{"applications": applications})
+}
+
+func (s *ApiServer) readGroupInviteHttpRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, string, uuid.UUID, bool) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return uuid.Nil, "", uuid.Nil, false
+	}
+	groupID, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Group ID must be a valid ID."))
+		return uuid.Nil, "", uuid.Nil, false
+	}
+	_, username, _, _, _, _ := parseBearerAuth([]byte(s.config.GetSession().EncryptionKey), r.Header.Get("Authorization"))
+	return userID, username, groupID, true
+}
+
+func (s *ApiServer) writeGroupInviteHttpResponse(w http.ResponseWriter, out interface{}) {
+	response, err := json.Marshal(out)
+	if err != nil {
+		s.logger.Error("Error marshaling group invite response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
+
+// Convert group invite and application errors to status errors for clients.
+func groupInviteStatus(err error) error {
+	switch {
+	case errors.Is(err, runtime.ErrGroupPermissionDenied):
+		return status.Error(codes.PermissionDenied, "Group permission denied.")
+	case errors.Is(err, runtime.ErrGroupNotFound):
+		return status.Error(codes.NotFound, "Group not found.")
+	case errors.Is(err, ErrGroupInviteNotFound):
+		return status.Error(codes.NotFound, "Group invite not found or expired.")
+	case errors.Is(err, runtime.ErrGroupFull):
+		return status.Error(codes.InvalidArgument, "Group is full.")
+	default:
+		return status.Error(codes.Internal, "Error while trying to update group invites.")
+	}
+}
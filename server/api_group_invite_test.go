@@ -0,0 +1,44 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGroupInviteStatus(t *testing.T) {
+	assert.Equal(t, codes.PermissionDenied, status.Code(groupInviteStatus(runtime.ErrGroupPermissionDenied)))
+	assert.Equal(t, codes.NotFound, status.Code(groupInviteStatus(ErrGroupInviteNotFound)))
+	assert.Equal(t, codes.InvalidArgument, status.Code(groupInviteStatus(runtime.ErrGroupFull)))
+	assert.Equal(t, codes.Internal, status.Code(groupInviteStatus(errors.New("db error"))))
+}
+
+func TestGroupJoinApplicationMetadata(t *testing.T) {
+	md, found := groupQueryMetadata(httptest.NewRequest(http.MethodPost, `/v2/group/abc/join?application=%7B%22level%22%3A10%7D`, nil))
+	assert.True(t, found)
+	assert.Equal(t, []string{`{"level":10}`}, md.Get(groupJoinApplicationMetadataKey))
+
+	// Other group routes pass nothing through.
+	_, found = groupQueryMetadata(httptest.NewRequest(http.MethodPost, "/v2/group/abc/leave", nil))
+	assert.False(t, found)
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/mux"
+	"github.com/heroiclabs/nakama/v3/social"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Request body for OIDC authenticate, link and unlink routes.
+type accountOIDC struct {
+	Token string            `json:"token"`
+	Vars  map[string]string `json:"vars"`
+}
+
+// AuthenticateOIDCHttp authenticates a user with an ID token issued by a configured OpenID Connect provider. The route
+// mirrors the gateway's other authenticate routes: server key basic auth, the account in the body, and optional
+// "create" and "username" query parameters.
+func (s *ApiServer) AuthenticateOIDCHttp(w http.ResponseWriter, r *http.Request) {
+	if !s.checkHttpServerKey(w, r) {
+		return
+	}
+
+	provider, err := oidcProviderConfig(s.config, mux.Vars(r)["provider"])
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+
+	in := &accountOIDC{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+
+	queryParams := r.URL.Query()
+	create := true
+	if c := queryParams.Get("create"); c != "" {
+		if create, err = strconv.ParseBool(c); err != nil {
+			s.writeHttpError(w, status.Error(codes.InvalidArgument, "Create must be a boolean."))
+			return
+		}
+	}
+
+	request, err := oidcBeforeHook(r.Context(), s.runtime.BeforeOIDC(), "", "", OIDCActionAuthenticate, &OIDCRequest{Provider: provider.Name, Token: in.Token, Vars: in.Vars, Username: queryParams.Get("username"), Create: create})
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	if request.Token == "" {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "OIDC ID token is required."))
+		return
+	}
+
+	username := request.Username
+	if username == "" {
+		username = generateUsername()
+	} else if invalidUsernameRegex.MatchString(username) {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Username invalid, no spaces or control characters allowed."))
+		return
+	} else if len(username) > 128 {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Username invalid, must be 1-128 bytes."))
+		return
+	}
+
+	dbUserID, dbUsername, created, err := AuthenticateOIDC(r.Context(), s.logger, s.db, s.socialClient, s.usernamePolicy(request.Username), provider, request.Token, username, request.Create)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+
+	if !created {
+		if err = TotpChallengeCheck(r.Context(), s.logger, s.db, s.config, uuid.FromStringOrNil(dbUserID), dbUsername, request.Vars); err != nil {
+			s.writeHttpError(w, err)
+			return
+		}
+		// Authenticating within the grace period restores an account scheduled for deletion.
+		if _, err = AccountDeletionCancel(r.Context(), s.logger, s.db, uuid.FromStringOrNil(dbUserID)); err != nil {
+			s.writeHttpError(w, err)
+			return
+		}
+	}
+
+	tokenID := uuid.Must(uuid.NewV4()).String()
+	token, exp := generateToken(s.config, tokenID, dbUserID, dbUsername, request.Vars)
+	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, dbUserID, dbUsername, request.Vars)
+	clientIP, _ := extractClientAddressFromRequest(s.logger, r)
+	if err = SessionRecord(r.Context(), s.logger, s.db, uuid.FromStringOrNil(dbUserID), tokenID, tokenID, request.Vars, clientIP, r.UserAgent(), refreshExp); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.sessionCache.Add(uuid.FromStringOrNil(dbUserID), exp, tokenID, refreshExp, tokenID)
+
+	oidcAfterHook(r.Context(), s.logger, s.runtime.AfterOIDC(), dbUserID, dbUsername, OIDCActionAuthenticate, request)
+
+	response, err := json.Marshal(map[string]interface{}{"created": created, "token": token, "refresh_token": refreshToken})
+	if err != nil {
+		s.logger.Error("Error marshaling session response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
+
+// LinkOIDCHttp adds an OpenID Connect identity to the session user's account.
+func (s *ApiServer) LinkOIDCHttp(w http.ResponseWriter, r *http.Request) {
+	userID, username, provider, request, ok := s.readIdentityHttpSessionRequest(w, r, OIDCActionLink)
+	if !ok {
+		return
+	}
+
+	if err := LinkOIDC(r.Context(), s.logger, s.db, s.socialClient, provider, userID, request.Token); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+
+	oidcAfterHook(r.Context(), s.logger, s.runtime.AfterOIDC(), userID.String(), username, OIDCActionLink, request)
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// UnlinkOIDCHttp removes an OpenID Connect identity from the session user's account.
+func (s *ApiServer) UnlinkOIDCHttp(w http.ResponseWriter, r *http.Request) {
+	userID, username, provider, request, ok := s.readIdentityHttpSessionRequest(w, r, OIDCActionUnlink)
+	if !ok {
+		return
+	}
+
+	if err := UnlinkOIDC(r.Context(), s.logger, s.db, s.socialClient, provider, userID, request.Token); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+
+	oidcAfterHook(r.Context(), s.logger, s.runtime.AfterOIDC(), userID.String(), username, OIDCActionUnlink, request)
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// Read the session, provider and body of a link or unlink request, and run the before hook for the action.
+func (s *ApiServer) readIdentityHttpSessionRequest(w http.ResponseWriter, r *http.Request, action string) (uuid.UUID, string, *social.OIDCProvider, *OIDCRequest, bool) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return uuid.Nil, "", nil, nil, false
+	}
+	_, username, _, _, _, _ := parseBearerAuth([]byte(s.config.GetSession().EncryptionKey), r.Header.Get("Authorization"))
+
+	provider, err := oidcProviderConfig(s.config, mux.Vars(r)["provider"])
+	if err != nil {
+		s.writeHttpError(w, err)
+		return uuid.Nil, "", nil, nil, false
+	}
+
+	in := &accountOIDC{}
+	if !s.readHttpBody(w, r, in) {
+		return uuid.Nil, "", nil, nil, false
+	}
+
+	request, err := oidcBeforeHook(r.Context(), s.runtime.BeforeOIDC(), userID.String(), username, action, &OIDCRequest{Provider: provider.Name, Token: in.Token, Vars: in.Vars})
+	if err != nil {
+		s.writeHttpError(w, err)
+		return uuid.Nil, "", nil, nil, false
+	}
+
+	return userID, username, provider, request, true
+}
@@ -113,12 +113,15 @@ nk.leaderboard_create(%q, %v, %q, %q, reset, metadata)
 		tracker := &LocalTracker{}
 		sessionCache := NewLocalSessionCache(1_000, 3_600)
 
-		pipeline := NewPipeline(logger, cfg, db, protojsonMarshaler, protojsonUnmarshaler, nil, nil, nil, nil, nil, tracker, router, runtime)
+		rateLimiter := NewLocalRateLimiter(cfg)
+
+		namePolicy := NewLocalNamePolicy(logger, cfg)
+		pipeline := NewPipeline(logger, cfg, db, protojsonMarshaler, protojsonUnmarshaler, nil, nil, nil, nil, nil, tracker, router, rateLimiter, namePolicy, runtime)
 
 		apiServer := StartApiServer(logger, logger, db, protojsonMarshaler,
-			protojsonUnmarshaler, cfg, "3.0.0", nil, nil, rtData.leaderboardCache,
+			protojsonUnmarshaler, cfg, "3.0.0", nil, nil, nil, nil, rtData.leaderboardCache,
 			rtData.leaderboardRankCache, nil, sessionCache,
-			nil, nil, nil, tracker, router, nil, metrics, pipeline, runtime)
+			nil, nil, nil, tracker, router, nil, metrics, rateLimiter, namePolicy, pipeline, runtime)
 
 		WaitForSocket(nil, cfg)
 
@@ -183,7 +183,7 @@ func (s *ApiServer) LinkEmail(ctx context.Context, in *api.AccountEmail) (*empty
 		}
 	}
 
-	err := LinkEmail(ctx, s.logger, s.db, userID, in.Email, in.Password)
+	err := LinkEmail(ctx, s.logger, s.db, s.config, userID, in.Email, in.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama/v3/iap"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -50,7 +51,9 @@ func (s *ApiServer) ValidatePurchaseApple(ctx context.Context, in *api.ValidateP
 		}
 	}
 
-	if s.config.GetIAP().Apple.SharedPassword == "" {
+	// StoreKit 2 signed transactions are verified locally against the bundle ID and need no shared password.
+	signed := iap.IsSignedDataApple(in.Receipt)
+	if (signed && s.config.GetIAP().Apple.BundleId == "") || (!signed && s.config.GetIAP().Apple.SharedPassword == "") {
 		return nil, status.Error(codes.FailedPrecondition, "Apple IAP is not configured.")
 	}
 
@@ -63,11 +66,21 @@ func (s *ApiServer) ValidatePurchaseApple(ctx context.Context, in *api.ValidateP
 		persist = in.Persist.GetValue()
 	}
 
-	validation, err := ValidatePurchasesApple(ctx, s.logger, s.db, userID, s.config.GetIAP().Apple.SharedPassword, in.Receipt, persist)
+	var validation *api.ValidatePurchaseResponse
+	var err error
+	if signed {
+		validation, err = ValidatePurchasesAppleSigned(ctx, s.logger, s.db, userID, s.config.GetIAP().Apple, in.Receipt, persist)
+	} else {
+		validation, err = ValidatePurchasesApple(ctx, s.logger, s.db, userID, s.config.GetIAP().Apple.SharedPassword, in.Receipt, persist)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.runtime.StoreCatalog(), userID, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	// After hook.
 	if fn := s.runtime.AfterValidatePurchaseApple(); fn != nil {
 		afterFn := func(clientIP, clientPort string) error {
@@ -125,6 +138,10 @@ func (s *ApiServer) ValidatePurchaseGoogle(ctx context.Context, in *api.Validate
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.runtime.StoreCatalog(), userID, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	// After hook.
 	if fn := s.runtime.AfterValidatePurchaseGoogle(); fn != nil {
 		afterFn := func(clientIP, clientPort string) error {
@@ -188,6 +205,10 @@ func (s *ApiServer) ValidatePurchaseHuawei(ctx context.Context, in *api.Validate
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.runtime.StoreCatalog(), userID, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	// After hook.
 	if fn := s.runtime.AfterValidatePurchaseHuawei(); fn != nil {
 		afterFn := func(clientIP, clientPort string) error {
@@ -245,6 +266,10 @@ func (s *ApiServer) ValidatePurchaseFacebookInstant(ctx context.Context, in *api
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.runtime.StoreCatalog(), userID, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	// After hook.
 	if fn := s.runtime.AfterValidatePurchaseFacebookInstant(); fn != nil {
 		afterFn := func(clientIP, clientPort string) error {
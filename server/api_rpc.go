@@ -124,6 +124,11 @@ func (s *ApiServer) RpcFuncHttp(w http.ResponseWriter, r *http.Request) {
 	}
 	id = strings.ToLower(maybeID)
 
+	// Check the caller's request rate.
+	if !s.checkHttpRateLimit(w, r, id, userID) {
+		return
+	}
+
 	// Find the correct RPC function.
 	fn := s.runtime.Rpc(id)
 	if fn == nil {
@@ -16,13 +16,19 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/mux"
 	"github.com/heroiclabs/nakama-common/api"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func (s *ApiServer) SessionRefresh(ctx context.Context, in *api.SessionRefreshRequest) (*api.Session, error) {
@@ -53,8 +59,12 @@ func (s *ApiServer) SessionRefresh(ctx context.Context, in *api.SessionRefreshRe
 		return nil, status.Error(codes.InvalidArgument, "Refresh token is required.")
 	}
 
-	userID, username, vars, tokenId, err := SessionRefresh(ctx, s.logger, s.db, s.config, s.sessionCache, in.Token)
+	userID, username, vars, tokenId, refreshTokenId, err := SessionRefresh(ctx, s.logger, s.db, s.config, s.sessionCache, s.sessionRegistry, s.tracker, in.Token)
 	if err != nil {
+		if err == ErrRefreshTokenReused {
+			s.refreshTokenReusedEvent(ctx, userID, in.Token)
+			return nil, status.Error(codes.Unauthenticated, "Refresh token invalid or expired.")
+		}
 		return nil, err
 	}
 
@@ -65,16 +75,17 @@ func (s *ApiServer) SessionRefresh(ctx context.Context, in *api.SessionRefreshRe
 	}
 	userIDStr := userID.String()
 
-	//newTokenId := uuid.Must(uuid.NewV4()).String()
-	//token, tokenExp := generateToken(s.config, newTokenId, userIDStr, username, useVars)
-	//refreshToken, refreshTokenExp := generateRefreshToken(s.config, newTokenId, userIDStr, username, useVars)
-	//s.sessionCache.Remove(userID, tokenExp, "", refreshTokenExp, tokenId)
-	//s.sessionCache.Add(userID, tokenExp, newTokenId, refreshTokenExp, newTokenId)
-	//session := &api.Session{Created: false, Token: token, RefreshToken: refreshToken}
-
 	token, tokenExp := generateToken(s.config, tokenId, userIDStr, username, useVars)
-	refreshToken, refreshTokenExp := generateRefreshToken(s.config, tokenId, userIDStr, username, useVars)
-	s.sessionCache.Add(userID, tokenExp, tokenId, refreshTokenExp, tokenId)
+	var refreshToken string
+	var refreshTokenExp int64
+	if refreshTokenId == tokenId {
+		refreshToken, refreshTokenExp = generateRefreshToken(s.config, tokenId, userIDStr, username, useVars)
+	} else {
+		refreshToken, refreshTokenExp = generateRotatedRefreshToken(s.config, refreshTokenId, tokenId, userIDStr, username, useVars)
+	}
+	s.sessionCache.Add(userID, tokenExp, tokenId, refreshTokenExp, refreshTokenId)
+	// Any refresh token rotation is already recorded, this only updates the session's client details and expiry.
+	_ = s.recordSession(ctx, userID, tokenId, refreshTokenId, useVars, refreshTokenExp)
 	session := &api.Session{Created: false, Token: token, RefreshToken: refreshToken}
 
 	// After hook.
@@ -139,3 +150,101 @@ func (s *ApiServer) SessionLogout(ctx context.Context, in *api.SessionLogoutRequ
 
 	return &emptypb.Empty{}, nil
 }
+
+// Record the device and client address a session was issued to, so it can be listed and revoked individually.
+func (s *ApiServer) recordSession(ctx context.Context, userID uuid.UUID, tokenID, refreshTokenID string, vars map[string]string, refreshExp int64) error {
+	clientIP, _ := extractClientAddressFromContext(s.logger, ctx)
+	var userAgent string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ua := md.Get("grpcgateway-user-agent"); len(ua) > 0 {
+		userAgent = ua[0]
+	} else if ua = md.Get("user-agent"); len(ua) > 0 {
+		userAgent = ua[0]
+	}
+	return SessionRecord(ctx, s.logger, s.db, userID, tokenID, refreshTokenID, vars, clientIP, userAgent, refreshExp)
+}
+
+// Emit a "refresh_token_reuse" runtime event when a rotated out refresh token is presented and its session revoked.
+func (s *ApiServer) refreshTokenReusedEvent(ctx context.Context, userID uuid.UUID, refreshToken string) {
+	fn := s.runtime.Event()
+	if fn == nil {
+		return
+	}
+
+	claims, _, _ := parseTokenClaims([]byte(s.config.GetSession().RefreshEncryptionKey), refreshToken)
+	properties := map[string]string{"user_id": userID.String()}
+	if claims != nil {
+		properties["token_id"] = claims.TokenId
+		properties["session_id"] = claims.TokenId
+		if claims.FamilyId != "" {
+			properties["session_id"] = claims.FamilyId
+		}
+	}
+
+	clientIP, clientPort := extractClientAddressFromContext(s.logger, ctx)
+	evtCtx := NewRuntimeGoContext(ctx, s.config.GetName(), s.version, s.config.GetRuntime().Environment, RuntimeExecutionModeEvent, nil, nil, 0, userID.String(), "", nil, "", clientIP, clientPort, "")
+	fn(evtCtx, &api.Event{
+		Name:       "refresh_token_reuse",
+		Properties: properties,
+		Timestamp:  timestamppb.Now(),
+	})
+}
+
+// SessionsListHttp lists the session user's active sessions, flagging the one making the request.
+func (s *ApiServer) SessionsListHttp(w http.ResponseWriter, r *http.Request) {
+	userID, tokenID, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := SessionsList(r.Context(), s.logger, s.db, s.sessionCache, userID)
+	if err != nil {
+		s.writeHttpError(w, status.Error(codes.Internal, "Error listing sessions."))
+		return
+	}
+
+	type userSessionCurrent struct {
+		*UserSession
+		Current bool `json:"current"`
+	}
+	out := make([]*userSessionCurrent, 0, len(sessions))
+	for _, session := range sessions {
+		out = append(out, &userSessionCurrent{UserSession: session, Current: session.Id == tokenID})
+	}
+
+	response, err := json.Marshal(map[string]interface{}{"sessions": out})
+	if err != nil {
+		s.logger.Error("Error marshaling sessions response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
+
+// SessionRevokeHttp ends one of the session user's sessions. With "refresh_only" set the session's socket and session
+// token stay valid until they expire, but it can no longer be refreshed.
+func (s *ApiServer) SessionRevokeHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+
+	var refreshOnly bool
+	if ro := r.URL.Query().Get("refresh_only"); ro != "" {
+		var err error
+		if refreshOnly, err = strconv.ParseBool(ro); err != nil {
+			s.writeHttpError(w, status.Error(codes.InvalidArgument, "Refresh only must be a boolean."))
+			return
+		}
+	}
+
+	if err := SessionRevoke(r.Context(), s.logger, s.db, s.config, s.sessionCache, s.sessionRegistry, s.tracker, userID, mux.Vars(r)["id"], refreshOnly); err != nil {
+		if err == ErrUserSessionNotFound {
+			s.writeHttpError(w, status.Error(codes.NotFound, "Session not found."))
+		} else {
+			s.writeHttpError(w, status.Error(codes.Internal, "Error revoking session."))
+		}
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
@@ -18,15 +18,49 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/heroiclabs/nakama-common/api"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// Context key for the options of objects written through the storage TTL and patch routes.
+type ctxStorageWriteOptionsKey struct{}
+
+type storageWriteObjectID struct {
+	collection string
+	key        string
+}
+
+type storageWriteOptions struct {
+	ttlSec int64
+	patch  string
+}
+
+type storageWriteOptionsRequest struct {
+	Objects []*storageWriteOptionsObject `json:"objects"`
+}
+
+// Same as a storage write object, with a TTL in seconds and a patch type.
+type storageWriteOptionsObject struct {
+	Collection      string `json:"collection"`
+	Key             string `json:"key"`
+	Value           string `json:"value"`
+	Version         string `json:"version"`
+	PermissionRead  *int32 `json:"permission_read"`
+	PermissionWrite *int32 `json:"permission_write"`
+	TtlSec          int64  `json:"ttl_sec"`
+	Patch           string `json:"patch"`
+}
+
 func (s *ApiServer) ListStorageObjects(ctx context.Context, in *api.ListStorageObjectsRequest) (*api.StorageObjectList, error) {
 	caller := ctx.Value(ctxUserIDKey{}).(uuid.UUID)
 
@@ -182,6 +216,8 @@ func (s *ApiServer) WriteStorageObjects(ctx context.Context, in *api.WriteStorag
 		return &api.StorageObjectAcks{}, nil
 	}
 
+	// Options are only set by writes through the storage TTL and patch routes, and are matched to objects after any before hook.
+	options, _ := ctx.Value(ctxStorageWriteOptionsKey{}).(map[storageWriteObjectID]*storageWriteOptions)
 	for _, object := range in.GetObjects() {
 		if object.GetCollection() == "" || object.GetKey() == "" || object.GetValue() == "" {
 			return nil, status.Error(codes.InvalidArgument, "Invalid collection or key value supplied. They must be set.")
@@ -201,24 +237,40 @@ func (s *ApiServer) WriteStorageObjects(ctx context.Context, in *api.WriteStorag
 			}
 		}
 
-		if maybeJSON := []byte(object.GetValue()); !json.Valid(maybeJSON) || bytes.TrimSpace(maybeJSON)[0] != byteBracket {
+		if o := options[storageWriteObjectID{collection: object.Collection, key: object.Key}]; o != nil && o.patch == StoragePatchJson {
+			if !storageWriteValueValid(o.patch, object.GetValue()) {
+				return nil, status.Error(codes.InvalidArgument, "Value must be a JSON array of patch operations.")
+			}
+		} else if maybeJSON := []byte(object.GetValue()); !json.Valid(maybeJSON) || bytes.TrimSpace(maybeJSON)[0] != byteBracket {
 			return nil, status.Error(codes.InvalidArgument, "Value must be a JSON object.")
 		}
 	}
 
 	ops := make(StorageOpWrites, 0, len(in.GetObjects()))
 	for _, object := range in.GetObjects() {
-		ops = append(ops, &StorageOpWrite{
+		op := &StorageOpWrite{
 			OwnerID: userID,
 			Object:  object,
-		})
+		}
+		if o := options[storageWriteObjectID{collection: object.Collection, key: object.Key}]; o != nil {
+			op.TtlSec = o.ttlSec
+			op.Patch = o.patch
+		}
+		ops = append(ops, op)
 	}
 
-	acks, code, err := StorageWriteObjects(ctx, s.logger, s.db, s.metrics, s.storageIndex, false, ops)
+	acks, code, err := StorageWriteObjects(ctx, s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, false, ops)
 	if err != nil {
 		if code == codes.Internal {
 			return nil, status.Error(codes.Internal, "Error writing storage objects.")
 		}
+		var validationErr *StorageValidationError
+		if errors.As(err, &validationErr) {
+			// Include which rule was broken, and where, for clients to act on.
+			if st, detailsErr := status.New(code, err.Error()).WithDetails(validationErr.Details()); detailsErr == nil {
+				return nil, st.Err()
+			}
+		}
 		return nil, status.Error(code, err.Error())
 	}
 
@@ -279,7 +331,7 @@ func (s *ApiServer) DeleteStorageObjects(ctx context.Context, in *api.DeleteStor
 		})
 	}
 
-	if code, err := StorageDeleteObjects(ctx, s.logger, s.db, s.storageIndex, false, ops); err != nil {
+	if code, err := StorageDeleteObjects(ctx, s.logger, s.db, s.storageIndex, s.storageCollections, s.tracker, s.router, false, ops); err != nil {
 		if code == codes.Internal {
 			return nil, status.Error(codes.Internal, "Error deleting storage objects.")
 		}
@@ -298,3 +350,70 @@ func (s *ApiServer) DeleteStorageObjects(ctx context.Context, in *api.DeleteStor
 
 	return &emptypb.Empty{}, nil
 }
+
+// WriteStorageObjectsOptionsHttp writes storage objects like WriteStorageObjects, with an optional TTL and patch type on
+// each object. Expired objects are no longer returned, and are deleted in the background. Patches are applied to the
+// existing value of each object. Storage write hooks run as usual.
+func (s *ApiServer) WriteStorageObjectsOptionsHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	body := &storageWriteOptionsRequest{}
+	if !s.readHttpBody(w, r, body) {
+		return
+	}
+
+	in := &api.WriteStorageObjectsRequest{Objects: make([]*api.WriteStorageObject, 0, len(body.Objects))}
+	options := make(map[storageWriteObjectID]*storageWriteOptions, len(body.Objects))
+	for _, object := range body.Objects {
+		if object == nil {
+			continue
+		}
+		if object.TtlSec < 0 {
+			s.writeHttpError(w, status.Error(codes.InvalidArgument, "Invalid TTL supplied. It must be >= 0."))
+			return
+		}
+		if !storagePatchTypeValid(object.Patch) {
+			s.writeHttpError(w, status.Error(codes.InvalidArgument, "Invalid patch supplied. It must be either empty, 'merge' or 'json'."))
+			return
+		}
+		o := &api.WriteStorageObject{
+			Collection: object.Collection,
+			Key:        object.Key,
+			Value:      object.Value,
+			Version:    object.Version,
+		}
+		if object.PermissionRead != nil {
+			o.PermissionRead = wrapperspb.Int32(*object.PermissionRead)
+		}
+		if object.PermissionWrite != nil {
+			o.PermissionWrite = wrapperspb.Int32(*object.PermissionWrite)
+		}
+		in.Objects = append(in.Objects, o)
+		options[storageWriteObjectID{collection: object.Collection, key: object.Key}] = &storageWriteOptions{ttlSec: object.TtlSec, patch: object.Patch}
+	}
+
+	// Set up the request context as the API authentication interceptor would for the equivalent gRPC call.
+	_, username, vars, expiry, _, _ := parseBearerAuth([]byte(s.config.GetSession().EncryptionKey), r.Header.Get("Authorization"))
+	clientAddr := r.RemoteAddr
+	if ips := r.Header.Get("x-forwarded-for"); ips != "" {
+		clientAddr = ips
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), metadata.Pairs("x-forwarded-for", clientAddr))
+	ctx = context.WithValue(context.WithValue(context.WithValue(context.WithValue(ctx, ctxUserIDKey{}, userID), ctxUsernameKey{}, username), ctxVarsKey{}, vars), ctxExpiryKey{}, expiry)
+	ctx = context.WithValue(context.WithValue(ctx, ctxFullMethodKey{}, "/nakama.api.Nakama/WriteStorageObjects"), ctxStorageWriteOptionsKey{}, options)
+
+	acks, err := s.WriteStorageObjects(ctx, in)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	response, err := protojson.MarshalOptions{UseProtoNames: true, UseEnumNumbers: true}.Marshal(acks)
+	if err != nil {
+		s.logger.Error("Error encoding storage write acks.", zap.Error(err))
+		s.writeHttpError(w, status.Error(codes.Internal, "Error writing storage objects."))
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type storePurchaseRequest struct {
+	ProductId string `json:"product_id"`
+}
+
+// StoreCatalogHttp lists the products in the store catalog.
+func (s *ApiServer) StoreCatalogHttp(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.readHttpSession(w, r); !ok {
+		return
+	}
+	s.writeStoreHttpResponse(w, map[string]interface{}{"products": storeCatalogList(s.runtime.StoreCatalog())})
+}
+
+// StorePurchaseHttp buys a store product with the session user's virtual currency.
+func (s *ApiServer) StorePurchaseHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	in := &storePurchaseRequest{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+	if in.ProductId == "" {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Store product ID is required."))
+		return
+	}
+
+	result, err := StorePurchase(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.runtime.StoreCatalog(), userID, in.ProductId)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeStoreHttpResponse(w, result)
+}
+
+func (s *ApiServer) writeStoreHttpResponse(w http.ResponseWriter, out interface{}) {
+	response, err := json.Marshal(out)
+	if err != nil {
+		s.logger.Error("Error marshaling store response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
@@ -53,9 +53,11 @@ var (
 	protojsonUnmarshaler = &protojson.UnmarshalOptions{
 		DiscardUnknown: false,
 	}
-	metrics       = NewLocalMetrics(logger, logger, nil, cfg)
-	storageIdx, _ = NewLocalStorageIndex(logger, nil, &StorageConfig{DisableIndexOnly: false}, metrics)
-	_             = CheckConfig(logger, cfg)
+	metrics               = NewLocalMetrics(logger, logger, nil, cfg)
+	storageIdx, _         = NewLocalStorageIndex(logger, nil, &StorageConfig{DisableIndexOnly: false}, metrics)
+	storageCollections, _ = NewLocalStorageCollectionRegistry(logger, &StorageConfig{})
+	groupIdx, _           = NewLocalGroupIndex(logger, nil, NewGroupConfig())
+	_                     = CheckConfig(logger, cfg)
 )
 
 type DummyMessageRouter struct{}
@@ -98,6 +100,9 @@ func (d *DummySession) Vars() map[string]string {
 func (d *DummySession) Expiry() int64 {
 	return int64(0)
 }
+func (d *DummySession) TokenID() string {
+	return ""
+}
 func (d *DummySession) Consume() {}
 func (d *DummySession) Format() SessionFormat {
 	return SessionFormatJson
@@ -226,8 +231,10 @@ func NewAPIServer(t *testing.T, runtime *Runtime) (*ApiServer, *Pipeline) {
 	sessionCache := NewLocalSessionCache(3_600, 7_200)
 	sessionRegistry := NewLocalSessionRegistry(metrics)
 	tracker := &LocalTracker{sessionRegistry: sessionRegistry}
-	pipeline := NewPipeline(logger, cfg, db, protojsonMarshaler, protojsonUnmarshaler, sessionRegistry, nil, nil, nil, nil, tracker, router, runtime)
-	apiServer := StartApiServer(logger, logger, db, protojsonMarshaler, protojsonUnmarshaler, cfg, "3.0.0", nil, storageIdx, nil, nil, sessionRegistry, sessionCache, nil, nil, nil, tracker, router, nil, metrics, pipeline, runtime)
+	rateLimiter := NewLocalRateLimiter(cfg)
+	namePolicy := NewLocalNamePolicy(logger, cfg)
+	pipeline := NewPipeline(logger, cfg, db, protojsonMarshaler, protojsonUnmarshaler, sessionRegistry, nil, nil, nil, nil, tracker, router, rateLimiter, namePolicy, runtime)
+	apiServer := StartApiServer(logger, logger, db, protojsonMarshaler, protojsonUnmarshaler, cfg, "3.0.0", nil, storageIdx, storageCollections, groupIdx, nil, nil, sessionRegistry, sessionCache, nil, nil, nil, tracker, router, nil, metrics, rateLimiter, namePolicy, pipeline, runtime)
 
 	WaitForSocket(nil, cfg)
 	return apiServer, pipeline
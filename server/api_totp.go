@@ -0,0 +1,147 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"go.uber.org/zap"
+)
+
+// Request body for the two-factor authentication routes.
+type accountTotp struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// AuthenticateTotpHttp completes authentication for an account with two-factor authentication, exchanging the challenge
+// returned in the error details of the first step and a code from the authenticator app or a recovery code for a session.
+func (s *ApiServer) AuthenticateTotpHttp(w http.ResponseWriter, r *http.Request) {
+	if !s.checkHttpServerKey(w, r) {
+		return
+	}
+	in := &accountTotp{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+
+	userID, username, vars, err := TotpChallengeVerify(r.Context(), s.logger, s.db, s.config, in.Challenge, in.Code)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+
+	// Authenticating within the grace period restores an account scheduled for deletion.
+	if _, err = AccountDeletionCancel(r.Context(), s.logger, s.db, userID); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+
+	userIDStr := userID.String()
+	tokenID := uuid.Must(uuid.NewV4()).String()
+	token, exp := generateToken(s.config, tokenID, userIDStr, username, vars)
+	refreshToken, refreshExp := generateRefreshToken(s.config, tokenID, userIDStr, username, vars)
+	clientIP, _ := extractClientAddressFromRequest(s.logger, r)
+	if err = SessionRecord(r.Context(), s.logger, s.db, userID, tokenID, tokenID, vars, clientIP, r.UserAgent(), refreshExp); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.sessionCache.Add(userID, exp, tokenID, refreshExp, tokenID)
+
+	s.writeTotpHttpResponse(w, map[string]interface{}{"created": false, "token": token, "refresh_token": refreshToken})
+}
+
+// TotpEnrolHttp starts two-factor authentication enrolment for the session user.
+func (s *ApiServer) TotpEnrolHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+
+	enrolment, err := TotpEnrol(r.Context(), s.logger, s.db, s.config, userID)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTotpHttpResponse(w, enrolment)
+}
+
+// TotpConfirmHttp enables two-factor authentication for the session user, returning their recovery codes.
+func (s *ApiServer) TotpConfirmHttp(w http.ResponseWriter, r *http.Request) {
+	userID, in, ok := s.readTotpHttpSessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := TotpConfirm(r.Context(), s.logger, s.db, userID, in.Code)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTotpHttpResponse(w, map[string]interface{}{"recovery_codes": recoveryCodes})
+}
+
+// TotpDisableHttp turns off two-factor authentication for the session user.
+func (s *ApiServer) TotpDisableHttp(w http.ResponseWriter, r *http.Request) {
+	userID, in, ok := s.readTotpHttpSessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := TotpDisable(r.Context(), s.logger, s.db, userID, in.Code); err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, []byte("{}"))
+}
+
+// TotpRecoveryCodesHttp replaces the session user's recovery codes.
+func (s *ApiServer) TotpRecoveryCodesHttp(w http.ResponseWriter, r *http.Request) {
+	userID, in, ok := s.readTotpHttpSessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := TotpRecoveryCodesRegenerate(r.Context(), s.logger, s.db, userID, in.Code)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTotpHttpResponse(w, map[string]interface{}{"recovery_codes": recoveryCodes})
+}
+
+func (s *ApiServer) readTotpHttpSessionRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, *accountTotp, bool) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return uuid.Nil, nil, false
+	}
+	in := &accountTotp{}
+	if !s.readHttpBody(w, r, in) {
+		return uuid.Nil, nil, false
+	}
+	return userID, in, true
+}
+
+func (s *ApiServer) writeTotpHttpResponse(w http.ResponseWriter, out interface{}) {
+	response, err := json.Marshal(out)
+	if err != nil {
+		s.logger.Error("Error marshaling two-factor authentication response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
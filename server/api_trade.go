@@ -0,0 +1,182 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type tradeProposeRequest struct {
+	RecipientId    string      `json:"recipient_id"`
+	SenderOffer    *TradeOffer `json:"sender_offer"`
+	RecipientOffer *TradeOffer `json:"recipient_offer"`
+	ExpirySec      int         `json:"expiry_sec"`
+}
+
+type tradeCounterRequest struct {
+	SenderOffer    *TradeOffer `json:"sender_offer"`
+	RecipientOffer *TradeOffer `json:"recipient_offer"`
+}
+
+// TradeProposeHttp opens a trade from the session user to another user, escrowing the session user's offer.
+func (s *ApiServer) TradeProposeHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	in := &tradeProposeRequest{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+	recipientID, err := uuid.FromString(in.RecipientId)
+	if err != nil {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Invalid recipient ID."))
+		return
+	}
+
+	trade, err := TradePropose(r.Context(), s.logger, s.db, s.config, s.storageIndex, s.storageCollections, s.tracker, s.router, s.tradeHooks(), userID, recipientID, in.SenderOffer, in.RecipientOffer, in.ExpirySec)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTradeHttpResponse(w, trade)
+}
+
+// TradeListHttp lists the trades the session user is a party to, most recently updated first.
+func (s *ApiServer) TradeListHttp(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	limit := tradeListMax
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			s.writeHttpError(w, status.Error(codes.InvalidArgument, "Invalid limit."))
+			return
+		}
+	}
+
+	list, err := TradeListUser(r.Context(), s.logger, s.db, userID, query.Get("state"), limit, query.Get("cursor"))
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	response, err := json.Marshal(list)
+	if err != nil {
+		s.logger.Error("Error marshaling trade list response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
+
+// TradeGetHttp returns a trade the session user is a party to.
+func (s *ApiServer) TradeGetHttp(w http.ResponseWriter, r *http.Request) {
+	userID, tradeID, ok := s.readTradeHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	trade, err := TradeGet(r.Context(), s.logger, s.db, userID, tradeID)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTradeHttpResponse(w, trade)
+}
+
+// TradeCounterHttp replaces the offers of a trade proposed to the session user, escrowing the session user's side.
+func (s *ApiServer) TradeCounterHttp(w http.ResponseWriter, r *http.Request) {
+	userID, tradeID, ok := s.readTradeHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	in := &tradeCounterRequest{}
+	if !s.readHttpBody(w, r, in) {
+		return
+	}
+
+	trade, err := TradeCounter(r.Context(), s.logger, s.db, s.config, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.tradeHooks(), userID, tradeID, in.SenderOffer, in.RecipientOffer)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTradeHttpResponse(w, trade)
+}
+
+// TradeAcceptHttp completes a trade proposed to the session user, exchanging both sides.
+func (s *ApiServer) TradeAcceptHttp(w http.ResponseWriter, r *http.Request) {
+	userID, tradeID, ok := s.readTradeHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	trade, err := TradeAccept(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.tradeHooks(), userID, tradeID)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTradeHttpResponse(w, trade)
+}
+
+// TradeCancelHttp cancels an open trade the session user is a party to, returning escrow to the proposer.
+func (s *ApiServer) TradeCancelHttp(w http.ResponseWriter, r *http.Request) {
+	userID, tradeID, ok := s.readTradeHttpRequest(w, r)
+	if !ok {
+		return
+	}
+	trade, err := TradeCancel(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, s.tradeHooks(), userID, tradeID)
+	if err != nil {
+		s.writeHttpError(w, err)
+		return
+	}
+	s.writeTradeHttpResponse(w, trade)
+}
+
+func (s *ApiServer) readTradeHttpRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, _, ok := s.readHttpSession(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	tradeID, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		s.writeHttpError(w, status.Error(codes.InvalidArgument, "Invalid trade ID."))
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, tradeID, true
+}
+
+func (s *ApiServer) writeTradeHttpResponse(w http.ResponseWriter, trade *Trade) {
+	response, err := json.Marshal(trade)
+	if err != nil {
+		s.logger.Error("Error marshaling trade response to client", zap.Error(err))
+		s.writeHttpBytes(w, http.StatusInternalServerError, internalServerErrorBytes)
+		return
+	}
+	s.writeHttpBytes(w, http.StatusOK, response)
+}
+
+// The runtime functions registered to run before and after trade actions, if any.
+func (s *ApiServer) tradeHooks() *tradeHooks {
+	return newTradeHooks(s.runtime)
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+const (
+	appleRefundCheckBatchSize = 100
+	// How often failed runtime refund function invocations are retried when refund polling is not enabled.
+	appleRefundCallbackRetryPeriodMin = 15
+	// Only customers with a one-time purchase in this window are checked. Their refund history covers all their purchases.
+	appleRefundCheckLookback = 90 * 24 * time.Hour
+)
+
+type AppleRefundScheduler interface {
+	Start(runtime *Runtime)
+	Pause()
+	Resume()
+	Stop()
+}
+
+type LocalAppleRefundScheduler struct {
+	sync.Mutex
+	logger *zap.Logger
+	db     *sql.DB
+	config Config
+
+	active *atomic.Uint32
+
+	fnPurchaseRefund RuntimePurchaseNotificationAppleFunction
+
+	ctx         context.Context
+	ctxCancelFn context.CancelFunc
+}
+
+func NewAppleRefundScheduler(logger *zap.Logger, db *sql.DB, config Config) AppleRefundScheduler {
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+
+	return &LocalAppleRefundScheduler{
+		logger: logger,
+		db:     db,
+		config: config,
+
+		active: atomic.NewUint32(1),
+
+		ctx:         ctx,
+		ctxCancelFn: ctxCancelFn,
+	}
+}
+
+func (a *LocalAppleRefundScheduler) Start(runtime *Runtime) {
+	a.fnPurchaseRefund = runtime.PurchaseNotificationApple()
+
+	period := a.config.GetIAP().Apple.RefundCheckPeriodMin
+	poll := period != 0 && a.config.GetIAP().Apple.ServerApiEnabled()
+	if !poll {
+		if a.fnPurchaseRefund == nil {
+			return
+		}
+		period = appleRefundCallbackRetryPeriodMin
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(period) * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C:
+				if a.active.Load() != 1 {
+					continue
+				}
+
+				if poll {
+					a.checkRefunds()
+				}
+				a.deliverRefunds()
+			}
+		}
+	}()
+}
+
+func (a *LocalAppleRefundScheduler) checkRefunds() {
+	since := time.Now().Add(-appleRefundCheckLookback)
+
+	// Deleted users have the nil user ID, so starting after it skips them.
+	cursor := uuid.Nil
+	for {
+		// One recent transaction per customer is enough to look up their refund history.
+		query := `
+SELECT DISTINCT ON (user_id) user_id, transaction_id
+FROM purchase
+WHERE store = $1 AND user_id > $2 AND purchase_time > $3 AND refund_time = '1970-01-01 00:00:00 UTC'
+ORDER BY user_id, purchase_time DESC
+LIMIT $4`
+		rows, err := a.db.QueryContext(a.ctx, query, api.StoreProvider_APPLE_APP_STORE, cursor, since, appleRefundCheckBatchSize)
+		if err != nil {
+			if a.ctx.Err() == nil {
+				a.logger.Error("Failed to list Apple purchases to check for refunds", zap.Error(err))
+			}
+			return
+		}
+
+		transactionIDs := make([]string, 0, appleRefundCheckBatchSize)
+		for rows.Next() {
+			var transactionID string
+			if err = rows.Scan(&cursor, &transactionID); err != nil {
+				_ = rows.Close()
+				a.logger.Error("Failed to scan Apple purchases to check for refunds", zap.Error(err))
+				return
+			}
+			transactionIDs = append(transactionIDs, transactionID)
+		}
+		_ = rows.Close()
+		if err = rows.Err(); err != nil {
+			a.logger.Error("Failed to list Apple purchases to check for refunds", zap.Error(err))
+			return
+		}
+
+		for _, transactionID := range transactionIDs {
+			refunds, err := ListRefundedPurchasesApple(a.ctx, a.logger, a.config.GetIAP().Apple, transactionID)
+			if err != nil {
+				if a.ctx.Err() != nil {
+					return
+				}
+				// Already logged, move on to the next customer.
+				continue
+			}
+
+			for _, refund := range refunds {
+				if refund.ExpiresDate != 0 || refund.RevocationDate == 0 {
+					// Subscription refunds are handled by App Store notifications.
+					continue
+				}
+
+				payload, err := json.Marshal(refund)
+				if err != nil {
+					a.logger.Error("Failed to marshal Apple refunded purchase", zap.Error(err))
+					continue
+				}
+
+				if err = refundPurchaseApple(a.ctx, a.logger, a.db, a.fnPurchaseRefund, refund, string(payload)); err != nil && err != sql.ErrNoRows {
+					a.logger.Error("Failed to store Apple purchase refund", zap.Error(err), zap.String("transaction_id", refund.TransactionId))
+				}
+			}
+		}
+
+		if len(transactionIDs) < appleRefundCheckBatchSize {
+			return
+		}
+	}
+}
+
+// Retry runtime refund function invocations for refunds that were recorded but not delivered.
+func (a *LocalAppleRefundScheduler) deliverRefunds() {
+	if a.fnPurchaseRefund == nil {
+		return
+	}
+
+	var cursor string
+	for {
+		query := `
+SELECT transaction_id, raw_response
+FROM purchase
+WHERE store = $1 AND transaction_id > $2 AND refund_time <> '1970-01-01 00:00:00 UTC' AND refund_callback_time = '1970-01-01 00:00:00 UTC'
+ORDER BY transaction_id
+LIMIT $3`
+		rows, err := a.db.QueryContext(a.ctx, query, api.StoreProvider_APPLE_APP_STORE, cursor, appleRefundCheckBatchSize)
+		if err != nil {
+			if a.ctx.Err() == nil {
+				a.logger.Error("Failed to list undelivered Apple purchase refunds", zap.Error(err))
+			}
+			return
+		}
+
+		pending := make(map[string]string, appleRefundCheckBatchSize)
+		for rows.Next() {
+			var rawResponse string
+			if err = rows.Scan(&cursor, &rawResponse); err != nil {
+				_ = rows.Close()
+				a.logger.Error("Failed to scan undelivered Apple purchase refunds", zap.Error(err))
+				return
+			}
+			pending[cursor] = rawResponse
+		}
+		_ = rows.Close()
+		if err = rows.Err(); err != nil {
+			a.logger.Error("Failed to list undelivered Apple purchase refunds", zap.Error(err))
+			return
+		}
+
+		for transactionID, rawResponse := range pending {
+			if err = deliverPurchaseRefundApple(a.ctx, a.logger, a.db, a.fnPurchaseRefund, transactionID, rawResponse); err != nil {
+				if a.ctx.Err() != nil {
+					return
+				}
+				a.logger.Warn("Failed to invoke Apple purchase refund hook", zap.Error(err), zap.String("transaction_id", transactionID))
+			}
+		}
+
+		if len(pending) < appleRefundCheckBatchSize {
+			return
+		}
+	}
+}
+
+func (a *LocalAppleRefundScheduler) Pause() {
+	a.active.Store(0)
+}
+
+func (a *LocalAppleRefundScheduler) Resume() {
+	a.active.Store(1)
+}
+
+func (a *LocalAppleRefundScheduler) Stop() {
+	a.ctxCancelFn()
+}
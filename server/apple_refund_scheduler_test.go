@@ -0,0 +1,184 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama/v3/iap"
+)
+
+func insertTestPurchaseApple(t *testing.T, db *sql.DB, userID uuid.UUID, transactionID string) {
+	t.Helper()
+
+	if _, err := upsertPurchases(context.Background(), db, []*storagePurchase{{
+		userID:        userID,
+		store:         api.StoreProvider_APPLE_APP_STORE,
+		productId:     "gems_100",
+		transactionId: transactionID,
+		purchaseTime:  time.Now().Add(-time.Hour),
+		environment:   api.StoreEnvironment_SANDBOX,
+	}}); err != nil {
+		t.Fatalf("error inserting purchase: %v", err)
+	}
+}
+
+func purchaseRefundTimes(t *testing.T, db *sql.DB, transactionID string) (refundTime, refundCallbackTime time.Time) {
+	t.Helper()
+
+	if err := db.QueryRow("SELECT refund_time, refund_callback_time FROM purchase WHERE transaction_id = $1", transactionID).Scan(&refundTime, &refundCallbackTime); err != nil {
+		t.Fatalf("error reading purchase: %v", err)
+	}
+	return refundTime, refundCallbackTime
+}
+
+func TestRefundPurchaseApple(t *testing.T) {
+	db := NewDB(t)
+	defer db.Close()
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	transactionID := "refund-" + userID.String()
+	insertTestPurchaseApple(t, db, userID, transactionID)
+
+	transaction := &iap.AppleJWSTransaction{TransactionId: transactionID, RevocationDate: time.Now().UnixMilli()}
+
+	var calls int
+	fail := true
+	fn := func(ctx context.Context, purchase *api.ValidatedPurchase, providerPayload string) error {
+		calls++
+		if purchase.TransactionId != transactionID || purchase.UserId != userID.String() || purchase.RefundTime == nil {
+			t.Fatalf("unexpected purchase: %+v", purchase)
+		}
+		if fail {
+			return errors.New("runtime error")
+		}
+		return nil
+	}
+
+	// A failed function call keeps the refund, but leaves it undelivered.
+	if err := refundPurchaseApple(context.Background(), logger, db, fn, transaction, "{}"); err != nil {
+		t.Fatalf("error refunding: %v", err)
+	}
+	refundTime, refundCallbackTime := purchaseRefundTimes(t, db, transactionID)
+	if refundTime.Unix() == 0 || refundCallbackTime.Unix() != 0 || calls != 1 {
+		t.Fatalf("unexpected refund state: refund %v, callback %v, calls %d", refundTime, refundCallbackTime, calls)
+	}
+
+	// Seeing the refund again delivers it, once.
+	fail = false
+	for i := 0; i < 2; i++ {
+		if err := refundPurchaseApple(context.Background(), logger, db, fn, transaction, "{}"); err != nil {
+			t.Fatalf("error refunding: %v", err)
+		}
+	}
+	if _, refundCallbackTime = purchaseRefundTimes(t, db, transactionID); refundCallbackTime.Unix() == 0 || calls != 2 {
+		t.Fatalf("unexpected refund state: callback %v, calls %d", refundCallbackTime, calls)
+	}
+
+	// Refunds recorded by purchase validation are still delivered.
+	validatedID := "validated-" + userID.String()
+	if _, err := upsertPurchases(context.Background(), db, []*storagePurchase{{
+		userID:        userID,
+		store:         api.StoreProvider_APPLE_APP_STORE,
+		productId:     "gems_100",
+		transactionId: validatedID,
+		purchaseTime:  time.Now().Add(-time.Hour),
+		refundTime:    time.Now(),
+		environment:   api.StoreEnvironment_SANDBOX,
+	}}); err != nil {
+		t.Fatalf("error inserting purchase: %v", err)
+	}
+	transactionID = validatedID
+	if err := refundPurchaseApple(context.Background(), logger, db, fn, &iap.AppleJWSTransaction{TransactionId: validatedID, RevocationDate: time.Now().UnixMilli()}, "{}"); err != nil {
+		t.Fatalf("error refunding: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected validated refund to be delivered, got %d calls", calls)
+	}
+
+	if err := refundPurchaseApple(context.Background(), logger, db, fn, &iap.AppleJWSTransaction{TransactionId: "unknown-" + userID.String(), RevocationDate: time.Now().UnixMilli()}, "{}"); err != sql.ErrNoRows {
+		t.Fatalf("expected no rows error, got %v", err)
+	}
+}
+
+func TestAppleRefundSchedulerCheckRefunds(t *testing.T) {
+	db := NewDB(t)
+	defer db.Close()
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	purchasedID := "purchased-" + userID.String()
+	refundedID := "refunded-" + userID.String()
+	insertTestPurchaseApple(t, db, userID, purchasedID)
+	insertTestPurchaseApple(t, db, userID, refundedID)
+
+	signer := newTestAppleSigner(t)
+	refund := testAppleTransaction(refundedID, "gems_100", time.Now().UnixMilli())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/inApps/v2/refund/lookup/" + purchasedID, "/inApps/v2/refund/lookup/" + refundedID:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"signedTransactions": []string{signer.sign(t, refund)}, "hasMore": false})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := NewConfig(logger)
+	config.IAP.Apple = signer.config(t, server.URL)
+	scheduler := NewAppleRefundScheduler(logger, db, config).(*LocalAppleRefundScheduler)
+	defer scheduler.Stop()
+
+	var calls int
+	fail := true
+	scheduler.fnPurchaseRefund = func(ctx context.Context, purchase *api.ValidatedPurchase, providerPayload string) error {
+		calls++
+		if purchase.TransactionId != refundedID {
+			t.Fatalf("unexpected purchase: %+v", purchase)
+		}
+		if fail {
+			return errors.New("runtime error")
+		}
+		return nil
+	}
+
+	scheduler.checkRefunds()
+	if refundTime, _ := purchaseRefundTimes(t, db, purchasedID); refundTime.Unix() != 0 {
+		t.Fatalf("expected purchase not to be refunded, got %v", refundTime)
+	}
+	refundTime, refundCallbackTime := purchaseRefundTimes(t, db, refundedID)
+	if refundTime.Unix() == 0 || refundCallbackTime.Unix() != 0 || calls != 1 {
+		t.Fatalf("unexpected refund state: refund %v, callback %v, calls %d", refundTime, refundCallbackTime, calls)
+	}
+
+	// The next run retries the failed delivery, and later runs do not repeat it.
+	fail = false
+	scheduler.deliverRefunds()
+	scheduler.deliverRefunds()
+	scheduler.checkRefunds()
+	if _, refundCallbackTime = purchaseRefundTimes(t, db, refundedID); refundCallbackTime.Unix() == 0 || calls != 2 {
+		t.Fatalf("unexpected refund state: callback %v, calls %d", refundCallbackTime, calls)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
+	"net/mail"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -25,7 +27,9 @@ import (
 	"strings"
 
 	"github.com/heroiclabs/nakama/v3/flags"
+	"github.com/heroiclabs/nakama/v3/iap"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"gopkg.in/yaml.v3"
@@ -52,6 +56,15 @@ type Config interface {
 	GetGoogleAuth() *GoogleAuthConfig
 	GetSatori() *SatoriConfig
 	GetStorage() *StorageConfig
+	GetGroup() *GroupConfig
+	GetMail() *MailConfig
+	GetRateLimit() *RateLimitConfig
+	GetAccount() *AccountConfig
+	GetNamePolicy() *NamePolicyConfig
+	GetPassword() *PasswordConfig
+	GetTrade() *TradeConfig
+	GetStore() *StoreConfig
+	GetWallet() *WalletConfig
 
 	Clone() (Config, error)
 }
@@ -149,6 +162,9 @@ func CheckConfig(logger *zap.Logger, config Config) map[string]string {
 	if config.GetSession().EncryptionKey == config.GetSession().RefreshEncryptionKey {
 		logger.Fatal("Encryption key and refresh token encryption cannot match", zap.Strings("param", []string{"session.encryption_key", "session.refresh_encryption_key"}))
 	}
+	if config.GetSession().TotpChallengeExpirySec < 1 {
+		logger.Fatal("TOTP challenge expiry seconds must be >= 1", zap.String("param", "session.totp_challenge_expiry_sec"))
+	}
 	if config.GetSession().SingleMatch && !config.GetSession().SingleSocket {
 		logger.Fatal("Single match cannot be enabled without single socket", zap.Strings("param", []string{"session.single_match", "session.single_socket"}))
 	}
@@ -308,6 +324,184 @@ func CheckConfig(logger *zap.Logger, config Config) map[string]string {
 		}
 	}
 
+	oidcProviderNames := make(map[string]struct{}, len(config.GetSocial().OIDC))
+	for _, provider := range config.GetSocial().OIDC {
+		if provider.Name == "" || invalidCharsRegex.MatchString(provider.Name) {
+			logger.Fatal("OIDC provider name must be set and valid", zap.String("param", "social.oidc.name"))
+		}
+		if _, found := oidcProviderNames[provider.Name]; found {
+			logger.Fatal("OIDC provider names must be unique", zap.String("social.oidc.name", provider.Name))
+		}
+		oidcProviderNames[provider.Name] = struct{}{}
+		if provider.Issuer == "" || provider.JwksUrl == "" || provider.Audience == "" {
+			logger.Fatal("OIDC provider issuer, JWKS URL and audience must be set", zap.String("social.oidc.name", provider.Name))
+		}
+	}
+
+	if config.GetRateLimit().IpRate < 0 || (config.GetRateLimit().IpRate > 0 && config.GetRateLimit().IpBurst < 1) {
+		logger.Fatal("Rate limit IP rate must be >= 0, and IP burst must be >= 1 if a rate is set", zap.String("param", "rate_limit.ip_rate"))
+	}
+	if config.GetRateLimit().UserRate < 0 || (config.GetRateLimit().UserRate > 0 && config.GetRateLimit().UserBurst < 1) {
+		logger.Fatal("Rate limit user rate must be >= 0, and user burst must be >= 1 if a rate is set", zap.String("param", "rate_limit.user_rate"))
+	}
+	rateLimitRuleNames := make(map[string]struct{}, len(config.GetRateLimit().Rules))
+	for _, rule := range config.GetRateLimit().Rules {
+		if (rule.Method == "") == (rule.RpcId == "") {
+			logger.Fatal("Rate limit rules must set exactly one of method or RPC ID", zap.String("param", "rate_limit.rules"))
+		}
+		name := rule.Method
+		if rule.RpcId != "" {
+			name = "rpc:" + strings.ToLower(rule.RpcId)
+		}
+		if _, found := rateLimitRuleNames[name]; found {
+			logger.Fatal("Rate limit rules must be unique", zap.String("rate_limit.rules", name))
+		}
+		rateLimitRuleNames[name] = struct{}{}
+		if rule.IpRate < 0 || (rule.IpRate > 0 && rule.IpBurst < 1) || rule.UserRate < 0 || (rule.UserRate > 0 && rule.UserBurst < 1) {
+			logger.Fatal("Rate limit rule rates must be >= 0, and bursts must be >= 1 if a rate is set", zap.String("rate_limit.rules", name))
+		}
+	}
+
+	if config.GetAccount().DeletionGracePeriodSec < 0 {
+		logger.Fatal("Account deletion grace period seconds must be >= 0", zap.Int64("account.deletion_grace_period_sec", config.GetAccount().DeletionGracePeriodSec))
+	}
+	if config.GetAccount().ExportExpirySec < 1 {
+		logger.Fatal("Account export expiry seconds must be >= 1", zap.Int64("account.export_expiry_sec", config.GetAccount().ExportExpirySec))
+	}
+
+	if config.GetStorage().ExpirySweepIntervalSec < 1 {
+		logger.Fatal("Storage expiry sweep interval seconds must be >= 1", zap.Int("storage.expiry_sweep_interval_sec", config.GetStorage().ExpirySweepIntervalSec))
+	}
+	if config.GetStorage().ExpirySweepBatchSize < 1 {
+		logger.Fatal("Storage expiry sweep batch size must be >= 1", zap.Int("storage.expiry_sweep_batch_size", config.GetStorage().ExpirySweepBatchSize))
+	}
+	storageRuleCollections := make(map[string]struct{}, len(config.GetStorage().CollectionRules))
+	for _, rules := range config.GetStorage().CollectionRules {
+		if _, err := newStorageCollectionRules(rules); err != nil {
+			logger.Fatal("Storage collection rules must be valid", zap.String("storage.collection_rules.collection", rules.Collection), zap.Error(err))
+		}
+		if _, found := storageRuleCollections[rules.Collection]; found {
+			logger.Fatal("Storage collection rules must be unique per collection", zap.String("storage.collection_rules.collection", rules.Collection))
+		}
+		storageRuleCollections[rules.Collection] = struct{}{}
+	}
+	storageHistoryCollections := make(map[string]struct{}, len(config.GetStorage().History))
+	for _, history := range config.GetStorage().History {
+		if err := storageHistoryConfigValid(history); err != nil {
+			logger.Fatal("Storage history must be valid", zap.String("storage.history.collection", history.Collection), zap.Error(err))
+		}
+		if _, found := storageHistoryCollections[history.Collection]; found {
+			logger.Fatal("Storage history must be unique per collection", zap.String("storage.history.collection", history.Collection))
+		}
+		storageHistoryCollections[history.Collection] = struct{}{}
+	}
+
+	for _, class := range config.GetNamePolicy().AllowedCharacterClasses {
+		if _, found := namePolicyCharacterClasses[class]; !found {
+			logger.Fatal("Name policy allowed character classes must be one of 'letter', 'digit', 'space', 'punctuation', 'symbol' or 'mark'", zap.String("name_policy.allowed_character_classes", class))
+		}
+	}
+	if config.GetNamePolicy().RenameCooldownSec < 0 {
+		logger.Fatal("Name policy rename cooldown seconds must be >= 0", zap.Int64("name_policy.rename_cooldown_sec", config.GetNamePolicy().RenameCooldownSec))
+	}
+
+	if config.GetTrade().MaxItems < 0 {
+		logger.Fatal("Trade max items must be >= 0", zap.Int("trade.max_items", config.GetTrade().MaxItems))
+	}
+	if config.GetTrade().MaxExpirySec < 1 {
+		logger.Fatal("Trade max expiry seconds must be >= 1", zap.Int("trade.max_expiry_sec", config.GetTrade().MaxExpirySec))
+	}
+	if config.GetTrade().DefaultExpirySec < 1 || config.GetTrade().DefaultExpirySec > config.GetTrade().MaxExpirySec {
+		logger.Fatal("Trade default expiry seconds must be >= 1 and <= max expiry seconds", zap.Int("trade.default_expiry_sec", config.GetTrade().DefaultExpirySec))
+	}
+	if config.GetTrade().ExpirySweepIntervalSec < 1 {
+		logger.Fatal("Trade expiry sweep interval seconds must be >= 1", zap.Int("trade.expiry_sweep_interval_sec", config.GetTrade().ExpirySweepIntervalSec))
+	}
+
+	if config.GetWallet().HoldMaxExpirySec < 1 {
+		logger.Fatal("Wallet hold max expiry seconds must be >= 1", zap.Int("wallet.hold_max_expiry_sec", config.GetWallet().HoldMaxExpirySec))
+	}
+	if config.GetWallet().HoldDefaultExpirySec < 1 || config.GetWallet().HoldDefaultExpirySec > config.GetWallet().HoldMaxExpirySec {
+		logger.Fatal("Wallet hold default expiry seconds must be >= 1 and <= max expiry seconds", zap.Int("wallet.hold_default_expiry_sec", config.GetWallet().HoldDefaultExpirySec))
+	}
+	if config.GetWallet().HoldExpirySweepIntervalSec < 1 {
+		logger.Fatal("Wallet hold expiry sweep interval seconds must be >= 1", zap.Int("wallet.hold_expiry_sweep_interval_sec", config.GetWallet().HoldExpirySweepIntervalSec))
+	}
+
+	storeProductIDs := make(map[string]struct{}, len(config.GetStore().Products))
+	for _, product := range config.GetStore().Products {
+		if err := storeProductValid(product); err != nil {
+			logger.Fatal("Store product is invalid", zap.String("store.products", product.Id), zap.Error(err))
+		}
+		if _, found := storeProductIDs[product.Id]; found {
+			logger.Fatal("Store product IDs must be unique", zap.String("store.products", product.Id))
+		}
+		storeProductIDs[product.Id] = struct{}{}
+	}
+
+	switch config.GetPassword().Algorithm {
+	case PasswordAlgorithmBcrypt, PasswordAlgorithmArgon2id:
+	default:
+		logger.Fatal("Password algorithm must be one of 'bcrypt' or 'argon2id'", zap.String("password.algorithm", config.GetPassword().Algorithm))
+	}
+	if config.GetPassword().BcryptCost < bcrypt.MinCost || config.GetPassword().BcryptCost > bcrypt.MaxCost {
+		logger.Fatal(fmt.Sprintf("Password bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost), zap.Int("password.bcrypt_cost", config.GetPassword().BcryptCost))
+	}
+	if config.GetPassword().Argon2idMemoryKib < 8*config.GetPassword().Argon2idParallelism {
+		logger.Fatal("Password Argon2id memory KiB must be at least 8 times the parallelism", zap.Int("password.argon2id_memory_kib", config.GetPassword().Argon2idMemoryKib))
+	}
+	if config.GetPassword().Argon2idIterations < 1 {
+		logger.Fatal("Password Argon2id iterations must be >= 1", zap.Int("password.argon2id_iterations", config.GetPassword().Argon2idIterations))
+	}
+	if config.GetPassword().Argon2idParallelism < 1 || config.GetPassword().Argon2idParallelism > 255 {
+		logger.Fatal("Password Argon2id parallelism must be between 1 and 255", zap.Int("password.argon2id_parallelism", config.GetPassword().Argon2idParallelism))
+	}
+	if config.GetPassword().Argon2idSaltLength < 8 {
+		logger.Fatal("Password Argon2id salt length must be >= 8", zap.Int("password.argon2id_salt_length", config.GetPassword().Argon2idSaltLength))
+	}
+	if config.GetPassword().Argon2idKeyLength < 16 {
+		logger.Fatal("Password Argon2id key length must be >= 16", zap.Int("password.argon2id_key_length", config.GetPassword().Argon2idKeyLength))
+	}
+
+	if config.GetMail().SmtpAddress != "" {
+		if _, _, err := net.SplitHostPort(config.GetMail().SmtpAddress); err != nil {
+			logger.Fatal("Mail SMTP address must be a host and port", zap.String("param", "mail.smtp_address"), zap.Error(err))
+		}
+		if _, err := mail.ParseAddress(config.GetMail().From); err != nil {
+			logger.Fatal("Mail from address must be set and valid when SMTP is enabled", zap.String("param", "mail.from"), zap.Error(err))
+		}
+	}
+	if config.GetMail().TimeoutMs < 1 {
+		logger.Fatal("Mail timeout must be >= 1", zap.Int("mail.timeout_ms", config.GetMail().TimeoutMs))
+	}
+	if config.GetMail().VerificationTokenExpirySec < 1 {
+		logger.Fatal("Mail verification token expiry seconds must be >= 1", zap.Int64("mail.verification_token_expiry_sec", config.GetMail().VerificationTokenExpirySec))
+	}
+	if config.GetMail().ResetTokenExpirySec < 1 {
+		logger.Fatal("Mail reset token expiry seconds must be >= 1", zap.Int64("mail.reset_token_expiry_sec", config.GetMail().ResetTokenExpirySec))
+	}
+
+	if config.GetIAP().Apple.RootCertificates != "" {
+		if _, err := iap.ParseRootCertificatesApple(config.GetIAP().Apple.RootCertificates); err != nil {
+			logger.Fatal("Apple IAP root certificates are invalid", zap.Error(err))
+		}
+	}
+	if config.GetIAP().Apple.NotificationsEndpointId != "" && config.GetIAP().Apple.BundleId == "" {
+		logger.Warn("Apple IAP notifications are rejected until a bundle ID is set", zap.String("param", "iap.apple.bundle_id"))
+	}
+	if appleIAP := config.GetIAP().Apple; (appleIAP.IssuerId != "" || appleIAP.KeyId != "" || appleIAP.PrivateKey != "") && !appleIAP.ServerApiEnabled() {
+		logger.Fatal("Apple IAP App Store Server API requires bundle_id, issuer_id, key_id and private_key to be set together")
+	}
+
+	if config.GetIAP().Apple.RefundCheckPeriodMin != 0 {
+		if config.GetIAP().Apple.RefundCheckPeriodMin < 15 {
+			logger.Fatal("Apple IAP refund check period must be >= 15 min")
+		}
+		if !config.GetIAP().Apple.ServerApiEnabled() {
+			logger.Fatal("Apple IAP refund check requires the App Store Server API credentials")
+		}
+	}
+
 	if config.GetIAP().Google.RefundCheckPeriodMin != 0 {
 		if config.GetIAP().Google.RefundCheckPeriodMin < 15 {
 			logger.Fatal("Google IAP refund check period must be >= 15 min")
@@ -455,6 +649,15 @@ type config struct {
 	GoogleAuth       *GoogleAuthConfig  `yaml:"google_auth" json:"google_auth" usage:"Google's auth settings."`
 	Satori           *SatoriConfig      `yaml:"satori" json:"satori" usage:"Satori integration settings."`
 	Storage          *StorageConfig     `yaml:"storage" json:"storage" usage:"Storage settings."`
+	Group            *GroupConfig       `yaml:"group" json:"group" usage:"Group settings."`
+	Mail             *MailConfig        `yaml:"mail" json:"mail" usage:"Outbound email settings."`
+	RateLimit        *RateLimitConfig   `yaml:"rate_limit" json:"rate_limit" usage:"Request rate limit settings."`
+	Account          *AccountConfig     `yaml:"account" json:"account" usage:"Account deletion, export and merge settings."`
+	NamePolicy       *NamePolicyConfig  `yaml:"name_policy" json:"name_policy" usage:"Username, display name, group name and channel message policy settings."`
+	Password         *PasswordConfig    `yaml:"password" json:"password" usage:"Player and console password hashing settings."`
+	Trade            *TradeConfig       `yaml:"trade" json:"trade" usage:"Player to player trading settings."`
+	Store            *StoreConfig       `yaml:"store" json:"store" usage:"Virtual store catalog settings."`
+	Wallet           *WalletConfig      `yaml:"wallet" json:"wallet" usage:"Wallet settings."`
 }
 
 // NewConfig constructs a Config struct which represents server settings, and populates it with default values.
@@ -483,6 +686,15 @@ func NewConfig(logger *zap.Logger) *config {
 		GoogleAuth:       NewGoogleAuthConfig(),
 		Satori:           NewSatoriConfig(),
 		Storage:          NewStorageConfig(),
+		Group:            NewGroupConfig(),
+		Mail:             NewMailConfig(),
+		RateLimit:        NewRateLimitConfig(),
+		Account:          NewAccountConfig(),
+		NamePolicy:       NewNamePolicyConfig(),
+		Password:         NewPasswordConfig(),
+		Trade:            NewTradeConfig(),
+		Store:            NewStoreConfig(),
+		Wallet:           NewWalletConfig(),
 	}
 }
 
@@ -503,6 +715,15 @@ func (c *config) Clone() (Config, error) {
 	configSatori := *(c.Satori)
 	configStorage := *(c.Storage)
 	configGoogleAuth := *(c.GoogleAuth)
+	configGroup := *(c.Group)
+	configMail := *(c.Mail)
+	configRateLimit := *(c.RateLimit)
+	configAccount := *(c.Account)
+	configNamePolicy := *(c.NamePolicy)
+	configPassword := *(c.Password)
+	configTrade := *(c.Trade)
+	configStore := *(c.Store)
+	configWallet := *(c.Wallet)
 	nc := &config{
 		Name:             c.Name,
 		Datadir:          c.Datadir,
@@ -523,6 +744,15 @@ func (c *config) Clone() (Config, error) {
 		Satori:           &configSatori,
 		GoogleAuth:       &configGoogleAuth,
 		Storage:          &configStorage,
+		Group:            &configGroup,
+		Mail:             &configMail,
+		RateLimit:        &configRateLimit,
+		Account:          &configAccount,
+		NamePolicy:       &configNamePolicy,
+		Password:         &configPassword,
+		Trade:            &configTrade,
+		Store:            &configStore,
+		Wallet:           &configWallet,
 	}
 	nc.Socket.CertPEMBlock = make([]byte, len(c.Socket.CertPEMBlock))
 	copy(nc.Socket.CertPEMBlock, c.Socket.CertPEMBlock)
@@ -545,6 +775,42 @@ func (c *config) Clone() (Config, error) {
 	}
 	nc.Leaderboard.BlacklistRankCache = make([]string, len(c.Leaderboard.BlacklistRankCache))
 	copy(nc.Leaderboard.BlacklistRankCache, c.Leaderboard.BlacklistRankCache)
+	nc.Group.IndexMetadataFields = make([]string, len(c.Group.IndexMetadataFields))
+	copy(nc.Group.IndexMetadataFields, c.Group.IndexMetadataFields)
+	nc.Social.OIDC = make([]*SocialConfigOIDC, 0, len(c.Social.OIDC))
+	for _, provider := range c.Social.OIDC {
+		configProvider := *provider
+		nc.Social.OIDC = append(nc.Social.OIDC, &configProvider)
+	}
+	nc.Storage.CollectionRules = make([]*StorageCollectionRulesConfig, 0, len(c.Storage.CollectionRules))
+	for _, rules := range c.Storage.CollectionRules {
+		configRules := *rules
+		configRules.PermissionRead = append([]int{}, rules.PermissionRead...)
+		configRules.PermissionWrite = append([]int{}, rules.PermissionWrite...)
+		nc.Storage.CollectionRules = append(nc.Storage.CollectionRules, &configRules)
+	}
+	nc.Storage.History = make([]*StorageHistoryConfig, 0, len(c.Storage.History))
+	for _, history := range c.Storage.History {
+		configHistory := *history
+		nc.Storage.History = append(nc.Storage.History, &configHistory)
+	}
+	nc.RateLimit.Rules = make([]*RateLimitRuleConfig, 0, len(c.RateLimit.Rules))
+	for _, rule := range c.RateLimit.Rules {
+		configRule := *rule
+		nc.RateLimit.Rules = append(nc.RateLimit.Rules, &configRule)
+	}
+	nc.NamePolicy.BannedWords = make([]string, len(c.NamePolicy.BannedWords))
+	copy(nc.NamePolicy.BannedWords, c.NamePolicy.BannedWords)
+	nc.NamePolicy.ReservedNames = make([]string, len(c.NamePolicy.ReservedNames))
+	copy(nc.NamePolicy.ReservedNames, c.NamePolicy.ReservedNames)
+	nc.NamePolicy.AllowedCharacterClasses = make([]string, len(c.NamePolicy.AllowedCharacterClasses))
+	copy(nc.NamePolicy.AllowedCharacterClasses, c.NamePolicy.AllowedCharacterClasses)
+	nc.Trade.ItemCollections = make([]string, len(c.Trade.ItemCollections))
+	copy(nc.Trade.ItemCollections, c.Trade.ItemCollections)
+	nc.Store.Products = make([]*StoreProductConfig, 0, len(c.Store.Products))
+	for _, product := range c.Store.Products {
+		nc.Store.Products = append(nc.Store.Products, product.Clone())
+	}
 
 	return nc, nil
 }
@@ -625,6 +891,42 @@ func (c *config) GetStorage() *StorageConfig {
 	return c.Storage
 }
 
+func (c *config) GetGroup() *GroupConfig {
+	return c.Group
+}
+
+func (c *config) GetMail() *MailConfig {
+	return c.Mail
+}
+
+func (c *config) GetRateLimit() *RateLimitConfig {
+	return c.RateLimit
+}
+
+func (c *config) GetAccount() *AccountConfig {
+	return c.Account
+}
+
+func (c *config) GetNamePolicy() *NamePolicyConfig {
+	return c.NamePolicy
+}
+
+func (c *config) GetPassword() *PasswordConfig {
+	return c.Password
+}
+
+func (c *config) GetTrade() *TradeConfig {
+	return c.Trade
+}
+
+func (c *config) GetStore() *StoreConfig {
+	return c.Store
+}
+
+func (c *config) GetWallet() *WalletConfig {
+	return c.Wallet
+}
+
 // LoggerConfig is configuration relevant to logging levels and output.
 type LoggerConfig struct {
 	Level    string `yaml:"level" json:"level" usage:"Log level to set. Valid values are 'debug', 'info', 'warn', 'error'. Default 'info'."`
@@ -676,20 +978,24 @@ func NewMetricsConfig() *MetricsConfig {
 
 // SessionConfig is configuration relevant to the session.
 type SessionConfig struct {
-	EncryptionKey         string `yaml:"encryption_key" json:"encryption_key" usage:"The encryption key used to produce the client token."`
-	TokenExpirySec        int64  `yaml:"token_expiry_sec" json:"token_expiry_sec" usage:"Token expiry in seconds."`
-	RefreshEncryptionKey  string `yaml:"refresh_encryption_key" json:"refresh_encryption_key" usage:"The encryption key used to produce the client refresh token."`
-	RefreshTokenExpirySec int64  `yaml:"refresh_token_expiry_sec" json:"refresh_token_expiry_sec" usage:"Refresh token expiry in seconds."`
-	SingleSocket          bool   `yaml:"single_socket" json:"single_socket" usage:"Only allow one socket per user. Older sessions are disconnected. Default false."`
-	SingleMatch           bool   `yaml:"single_match" json:"single_match" usage:"Only allow one match per user. Older matches receive a leave. Requires single socket to enable. Default false."`
+	EncryptionKey          string `yaml:"encryption_key" json:"encryption_key" usage:"The encryption key used to produce the client token."`
+	TokenExpirySec         int64  `yaml:"token_expiry_sec" json:"token_expiry_sec" usage:"Token expiry in seconds."`
+	RefreshEncryptionKey   string `yaml:"refresh_encryption_key" json:"refresh_encryption_key" usage:"The encryption key used to produce the client refresh token."`
+	RefreshTokenExpirySec  int64  `yaml:"refresh_token_expiry_sec" json:"refresh_token_expiry_sec" usage:"Refresh token expiry in seconds."`
+	SingleSocket           bool   `yaml:"single_socket" json:"single_socket" usage:"Only allow one socket per user. Older sessions are disconnected. Default false."`
+	SingleMatch            bool   `yaml:"single_match" json:"single_match" usage:"Only allow one match per user. Older matches receive a leave. Requires single socket to enable. Default false."`
+	RefreshTokenRotation   bool   `yaml:"refresh_token_rotation" json:"refresh_token_rotation" usage:"Issue a new refresh token on every session refresh and invalidate the one used. Reusing an invalidated refresh token revokes its session. Default false."`
+	TotpIssuer             string `yaml:"totp_issuer" json:"totp_issuer" usage:"Issuer name shown in authenticator apps for two-factor authentication. Defaults to the server name."`
+	TotpChallengeExpirySec int64  `yaml:"totp_challenge_expiry_sec" json:"totp_challenge_expiry_sec" usage:"Seconds a client has to complete a two-factor authentication challenge after the first authentication step. Default 300."`
 }
 
 func NewSessionConfig() *SessionConfig {
 	return &SessionConfig{
-		EncryptionKey:         "defaultencryptionkey",
-		TokenExpirySec:        60,
-		RefreshEncryptionKey:  "defaultrefreshencryptionkey",
-		RefreshTokenExpirySec: 3600,
+		EncryptionKey:          "defaultencryptionkey",
+		TokenExpirySec:         60,
+		RefreshEncryptionKey:   "defaultrefreshencryptionkey",
+		RefreshTokenExpirySec:  3600,
+		TotpChallengeExpirySec: 300,
 	}
 }
 
@@ -768,6 +1074,7 @@ type SocialConfig struct {
 	FacebookInstantGame  *SocialConfigFacebookInstantGame  `yaml:"facebook_instant_game" json:"facebook_instant_game" usage:"Facebook Instant Game configuration."`
 	FacebookLimitedLogin *SocialConfigFacebookLimitedLogin `yaml:"facebook_limited_login" json:"facebook_limited_login" usage:"Facebook Limited Login configuration."`
 	Apple                *SocialConfigApple                `yaml:"apple" json:"apple" usage:"Apple Sign In configuration."`
+	OIDC                 []*SocialConfigOIDC               `yaml:"oidc" json:"oidc" usage:"Named OpenID Connect provider configurations."`
 }
 
 // SocialConfigSteam is configuration relevant to Steam.
@@ -791,6 +1098,19 @@ type SocialConfigApple struct {
 	BundleId string `yaml:"bundle_id" json:"bundle_id" usage:"Apple Sign In bundle ID."`
 }
 
+// SocialConfigOIDC is configuration relevant to a generic OpenID Connect provider.
+type SocialConfigOIDC struct {
+	Name             string `yaml:"name" json:"name" usage:"Unique provider name used by clients and runtime functions, for example 'discord'."`
+	Issuer           string `yaml:"issuer" json:"issuer" usage:"Expected ID token issuer."`
+	JwksUrl          string `yaml:"jwks_url" json:"jwks_url" usage:"URL of the provider's JSON Web Key Set."`
+	Audience         string `yaml:"audience" json:"audience" usage:"Expected ID token audience, usually the client ID. Required."`
+	IdClaim          string `yaml:"id_claim" json:"id_claim" usage:"Claim holding the provider user ID. Default 'sub'."`
+	UsernameClaim    string `yaml:"username_claim" json:"username_claim" usage:"Claim holding the username. Default 'preferred_username'."`
+	DisplayNameClaim string `yaml:"display_name_claim" json:"display_name_claim" usage:"Claim holding the display name. Default 'name'."`
+	EmailClaim       string `yaml:"email_claim" json:"email_claim" usage:"Claim holding the email address. Default 'email'."`
+	AvatarUrlClaim   string `yaml:"avatar_url_claim" json:"avatar_url_claim" usage:"Claim holding the avatar URL. Default 'picture'."`
+}
+
 func NewSocialConfig() *SocialConfig {
 	return &SocialConfig{
 		Steam: &SocialConfigSteam{
@@ -806,6 +1126,7 @@ func NewSocialConfig() *SocialConfig {
 		Apple: &SocialConfigApple{
 			BundleId: "",
 		},
+		OIDC: make([]*SocialConfigOIDC, 0),
 	}
 }
 
@@ -1013,6 +1334,20 @@ func NewIAPConfig() *IAPConfig {
 type IAPAppleConfig struct {
 	SharedPassword          string `yaml:"shared_password" json:"shared_password" usage:"Your Apple Store App IAP shared password. Only necessary for validation of auto-renewable subscriptions."`
 	NotificationsEndpointId string `yaml:"notifications_endpoint_id" json:"notifications_endpoint_id" usage:"The callback endpoint identifier for Apple Store subscription notifications."`
+	BundleId                string `yaml:"bundle_id" json:"bundle_id" usage:"Your app bundle ID. Required to validate StoreKit 2 signed transactions, accept App Store notifications and make App Store Server API requests. Signed data for other bundles is rejected."`
+	IssuerId                string `yaml:"issuer_id" json:"issuer_id" usage:"The issuer ID of your App Store Connect In-App Purchase key, used for App Store Server API requests."`
+	KeyId                   string `yaml:"key_id" json:"key_id" usage:"The key ID of your App Store Connect In-App Purchase key, used for App Store Server API requests."`
+	PrivateKey              string `yaml:"private_key" json:"private_key" usage:"The PEM encoded App Store Connect In-App Purchase private key, used for App Store Server API requests."`
+	ServerApiUrl            string `yaml:"server_api_url" json:"server_api_url" usage:"The App Store Server API base URL. If empty, production is queried first and then the sandbox."`
+	RefundCheckPeriodMin    int    `yaml:"refund_check_period_min" json:"refund_check_period_min" usage:"Defines the polling interval in minutes of the App Store Server API refund history for recent one-time purchases. Requires the App Store Server API credentials."`
+	RootCertificates        string `yaml:"root_certificates" json:"root_certificates" usage:"PEM encoded root certificates used to verify App Store signed data instead of the Apple Root CA - G3. Intended for testing against a local stub only."`
+}
+
+func (iapa *IAPAppleConfig) ServerApiEnabled() bool {
+	if iapa.BundleId != "" && iapa.IssuerId != "" && iapa.KeyId != "" && iapa.PrivateKey != "" {
+		return true
+	}
+	return false
 }
 
 type IAPGoogleConfig struct {
@@ -1085,9 +1420,227 @@ func NewGoogleAuthConfig() *GoogleAuthConfig {
 }
 
 type StorageConfig struct {
-	DisableIndexOnly bool `yaml:"disable_index_only" json:"disable_index_only" usage:"Override and disable 'index_only' storage indices config and fallback to reading from the database."`
+	DisableIndexOnly       bool                            `yaml:"disable_index_only" json:"disable_index_only" usage:"Override and disable 'index_only' storage indices config and fallback to reading from the database."`
+	ExpirySweepIntervalSec int                             `yaml:"expiry_sweep_interval_sec" json:"expiry_sweep_interval_sec" usage:"Seconds between deleting storage objects past their TTL. Expired objects are never returned, even before they are deleted. Default 60."`
+	ExpirySweepBatchSize   int                             `yaml:"expiry_sweep_batch_size" json:"expiry_sweep_batch_size" usage:"Maximum number of expired storage objects deleted in one database operation. Default 1000."`
+	CollectionRules        []*StorageCollectionRulesConfig `yaml:"collection_rules" json:"collection_rules" usage:"Validation rules enforced on writes to storage collections."`
+	History                []*StorageHistoryConfig         `yaml:"history" json:"history" usage:"Storage collections that keep the previous versions of objects when they are written."`
+}
+
+// StorageHistoryConfig is configuration for keeping the previous versions of objects in a storage collection.
+type StorageHistoryConfig struct {
+	Collection  string `yaml:"collection" json:"collection" usage:"Storage collection to keep history for."`
+	MaxVersions int    `yaml:"max_versions" json:"max_versions" usage:"Maximum number of previous versions kept for each object. Default 0, unlimited."`
+	MaxAgeSec   int    `yaml:"max_age_sec" json:"max_age_sec" usage:"Seconds a previous version is kept after it was replaced. Default 0, unlimited. At least one of 'max_versions' and 'max_age_sec' must be set."`
+}
+
+// StorageCollectionRulesConfig is configuration for the validation of writes to a storage collection.
+type StorageCollectionRulesConfig struct {
+	Collection        string `yaml:"collection" json:"collection" usage:"Storage collection the rules apply to."`
+	Schema            string `yaml:"schema" json:"schema" usage:"JSON Schema, as a JSON string, that object values must match. Supports the type, enum, const, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength, pattern, items, minItems, maxItems, uniqueItems, properties, required, additionalProperties, minProperties, maxProperties, allOf, anyOf, oneOf and not keywords. Other keywords are ignored, and references are not supported. Default none."`
+	MaxValueSizeBytes int    `yaml:"max_value_size_bytes" json:"max_value_size_bytes" usage:"Maximum size of object values in bytes. Default 0, unlimited."`
+	MaxObjectsPerUser int    `yaml:"max_objects_per_user" json:"max_objects_per_user" usage:"Maximum number of objects each user can own in the collection. Default 0, unlimited."`
+	PermissionRead    []int  `yaml:"permission_read" json:"permission_read" usage:"Read permission values writes may set. Default all."`
+	PermissionWrite   []int  `yaml:"permission_write" json:"permission_write" usage:"Write permission values writes may set. Default all."`
 }
 
 func NewStorageConfig() *StorageConfig {
-	return &StorageConfig{}
+	return &StorageConfig{
+		ExpirySweepIntervalSec: 60,
+		ExpirySweepBatchSize:   1000,
+		CollectionRules:        make([]*StorageCollectionRulesConfig, 0),
+		History:                make([]*StorageHistoryConfig, 0),
+	}
+}
+
+// GroupConfig is configuration relevant to the group system.
+type GroupConfig struct {
+	IndexMetadataFields []string `yaml:"index_metadata_fields" json:"index_metadata_fields" usage:"Top level group metadata fields to make searchable in group listings, in addition to name, description, language tag and open state. Default none."`
+}
+
+func NewGroupConfig() *GroupConfig {
+	return &GroupConfig{
+		IndexMetadataFields: []string{},
+	}
+}
+
+// MailConfig is configuration relevant to outbound email, used for account email verification and password resets.
+type MailConfig struct {
+	SmtpAddress                string `yaml:"smtp_address" json:"smtp_address" usage:"SMTP relay host and port, for example 'smtp.example.com:587'. Email flows are disabled if not set."`
+	SmtpUsername               string `yaml:"smtp_username" json:"smtp_username" usage:"SMTP username, authentication is skipped if not set."`
+	SmtpPassword               string `yaml:"smtp_password" json:"smtp_password" usage:"SMTP password."`
+	From                       string `yaml:"from" json:"from" usage:"Sender address, optionally with a display name, for example 'Game <noreply@example.com>'."`
+	TimeoutMs                  int    `yaml:"timeout_ms" json:"timeout_ms" usage:"Timeout in milliseconds for delivering a message to the SMTP relay. Default 10000."`
+	VerificationTokenExpirySec int64  `yaml:"verification_token_expiry_sec" json:"verification_token_expiry_sec" usage:"Expiry in seconds of email verification and email change tokens. Default 86400."`
+	ResetTokenExpirySec        int64  `yaml:"reset_token_expiry_sec" json:"reset_token_expiry_sec" usage:"Expiry in seconds of password reset tokens. Default 3600."`
+}
+
+func NewMailConfig() *MailConfig {
+	return &MailConfig{
+		TimeoutMs:                  10_000,
+		VerificationTokenExpirySec: 86_400,
+		ResetTokenExpirySec:        3_600,
+	}
+}
+
+// RateLimitConfig is configuration relevant to token bucket rate limiting of API requests, RPCs and realtime messages.
+type RateLimitConfig struct {
+	IpRate    float64                `yaml:"ip_rate" json:"ip_rate" usage:"Requests per second allowed from each client IP address, across all API requests and realtime messages. Default 0, no limit."`
+	IpBurst   int                    `yaml:"ip_burst" json:"ip_burst" usage:"Requests a client IP address may make in a burst before 'ip_rate' applies."`
+	UserRate  float64                `yaml:"user_rate" json:"user_rate" usage:"Requests per second allowed for each authenticated user, across all API requests and realtime messages. Default 0, no limit."`
+	UserBurst int                    `yaml:"user_burst" json:"user_burst" usage:"Requests a user may make in a burst before 'user_rate' applies."`
+	Rules     []*RateLimitRuleConfig `yaml:"rules" json:"rules" usage:"Additional limits for individual API methods, realtime messages or RPC functions."`
+}
+
+// RateLimitRuleConfig is configuration relevant to the rate limit of a single API method, realtime message or RPC function.
+type RateLimitRuleConfig struct {
+	Method    string  `yaml:"method" json:"method" usage:"API method such as 'AuthenticateEmail', realtime message such as 'ChannelMessageSend', or HTTP route such as '/v2/account/email/password/forgot'."`
+	RpcId     string  `yaml:"rpc_id" json:"rpc_id" usage:"RPC function ID, limited over HTTP, gRPC and realtime sockets. Used instead of 'method'."`
+	IpRate    float64 `yaml:"ip_rate" json:"ip_rate" usage:"Requests per second allowed from each client IP address. Default 0, no limit."`
+	IpBurst   int     `yaml:"ip_burst" json:"ip_burst" usage:"Requests a client IP address may make in a burst before 'ip_rate' applies."`
+	UserRate  float64 `yaml:"user_rate" json:"user_rate" usage:"Requests per second allowed for each authenticated user. Default 0, no limit."`
+	UserBurst int     `yaml:"user_burst" json:"user_burst" usage:"Requests a user may make in a burst before 'user_rate' applies."`
+}
+
+func NewRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		Rules: make([]*RateLimitRuleConfig, 0),
+	}
+}
+
+// AccountConfig is configuration relevant to player initiated account deletion, data export and account merges.
+type AccountConfig struct {
+	DeletionGracePeriodSec int64 `yaml:"deletion_grace_period_sec" json:"deletion_grace_period_sec" usage:"Seconds an account deleted by its user stays signed out before it is purged. Logging in during this period restores the account. Default 0, accounts are deleted immediately."`
+	ExportExpirySec        int64 `yaml:"export_expiry_sec" json:"export_expiry_sec" usage:"Seconds a completed account export stays available to download. Default 604800."`
+}
+
+func NewAccountConfig() *AccountConfig {
+	return &AccountConfig{
+		DeletionGracePeriodSec: 0,
+		ExportExpirySec:        604_800,
+	}
+}
+
+// NamePolicyConfig is configuration relevant to checking usernames, display names, group names and channel messages.
+type NamePolicyConfig struct {
+	BannedWords             []string `yaml:"banned_words" json:"banned_words" usage:"Words not allowed in usernames, display names, group names and checked channel messages. Words match whole words, split at spaces, punctuation and lower to upper case changes, or the whole name. Matching ignores case, accents, repeated characters and common leetspeak substitutions."`
+	BannedWordSubstrings    bool     `yaml:"banned_word_substrings" json:"banned_word_substrings" usage:"Also reject usernames, display names and group names containing a banned word inside a longer word. Default false, as this rejects innocent names containing a banned word."`
+	BannedWordsFile         string   `yaml:"banned_words_file" json:"banned_words_file" usage:"Path to a file of additional banned words, one per line. Blank lines and lines starting with # are ignored."`
+	ReservedNames           []string `yaml:"reserved_names" json:"reserved_names" usage:"Names players cannot use as a username, display name or group name, matched the same way as banned words."`
+	AllowedCharacterClasses []string `yaml:"allowed_character_classes" json:"allowed_character_classes" usage:"Character classes allowed in usernames, display names and group names, any of 'letter', 'digit', 'space', 'punctuation', 'symbol' and 'mark'. Default empty, all characters the server otherwise accepts are allowed."`
+	RenameCooldownSec       int64    `yaml:"rename_cooldown_sec" json:"rename_cooldown_sec" usage:"Minimum seconds between username changes made by a player. Default 0, no cooldown."`
+	FilterChannelMessages   bool     `yaml:"filter_channel_messages" json:"filter_channel_messages" usage:"Reject channel messages containing a banned word. Default false."`
+}
+
+func NewNamePolicyConfig() *NamePolicyConfig {
+	return &NamePolicyConfig{
+		BannedWords:             make([]string, 0),
+		ReservedNames:           make([]string, 0),
+		AllowedCharacterClasses: make([]string, 0),
+	}
+}
+
+// PasswordConfig is configuration relevant to hashing player and console user passwords.
+type PasswordConfig struct {
+	Algorithm           string `yaml:"algorithm" json:"algorithm" usage:"Algorithm used to hash new passwords, one of 'bcrypt' or 'argon2id'. Existing hashes of either algorithm are always accepted, and are rehashed on the next successful login if the algorithm or its parameters have changed. Default 'bcrypt'."`
+	BcryptCost          int    `yaml:"bcrypt_cost" json:"bcrypt_cost" usage:"Cost of new bcrypt hashes. Default 10."`
+	Argon2idMemoryKib   int    `yaml:"argon2id_memory_kib" json:"argon2id_memory_kib" usage:"Memory in KiB used by new Argon2id hashes. Default 65536."`
+	Argon2idIterations  int    `yaml:"argon2id_iterations" json:"argon2id_iterations" usage:"Number of passes over memory made by new Argon2id hashes. Default 3."`
+	Argon2idParallelism int    `yaml:"argon2id_parallelism" json:"argon2id_parallelism" usage:"Number of threads used by new Argon2id hashes. Default 2."`
+	Argon2idSaltLength  int    `yaml:"argon2id_salt_length" json:"argon2id_salt_length" usage:"Length in bytes of the random salt of new Argon2id hashes. Default 16."`
+	Argon2idKeyLength   int    `yaml:"argon2id_key_length" json:"argon2id_key_length" usage:"Length in bytes of new Argon2id hashes. Default 32."`
+}
+
+func NewPasswordConfig() *PasswordConfig {
+	return &PasswordConfig{
+		Algorithm:           PasswordAlgorithmBcrypt,
+		BcryptCost:          bcrypt.DefaultCost,
+		Argon2idMemoryKib:   65536,
+		Argon2idIterations:  3,
+		Argon2idParallelism: 2,
+		Argon2idSaltLength:  16,
+		Argon2idKeyLength:   32,
+	}
+}
+
+// TradeConfig is configuration relevant to player to player trades.
+type TradeConfig struct {
+	ItemCollections        []string `yaml:"item_collections" json:"item_collections" usage:"Storage collections whose objects players can offer in trades. Default empty, only wallet currencies can be traded."`
+	MaxItems               int      `yaml:"max_items" json:"max_items" usage:"Maximum number of storage objects each side of a trade can offer. Default 10."`
+	DefaultExpirySec       int      `yaml:"default_expiry_sec" json:"default_expiry_sec" usage:"Seconds an open trade lasts when the proposal does not set an expiry. Default 86400."`
+	MaxExpirySec           int      `yaml:"max_expiry_sec" json:"max_expiry_sec" usage:"Maximum seconds an open trade can last. Default 604800."`
+	ExpirySweepIntervalSec int      `yaml:"expiry_sweep_interval_sec" json:"expiry_sweep_interval_sec" usage:"Seconds between returning the escrowed assets of expired trades. Default 60."`
+}
+
+// WalletConfig is configuration relevant to user wallets.
+type WalletConfig struct {
+	HoldDefaultExpirySec       int `yaml:"hold_default_expiry_sec" json:"hold_default_expiry_sec" usage:"Seconds a wallet hold lasts when it is created without an expiry. Default 3600."`
+	HoldMaxExpirySec           int `yaml:"hold_max_expiry_sec" json:"hold_max_expiry_sec" usage:"Maximum seconds a wallet hold can last. Default 604800."`
+	HoldExpirySweepIntervalSec int `yaml:"hold_expiry_sweep_interval_sec" json:"hold_expiry_sweep_interval_sec" usage:"Seconds between releasing the amounts of expired wallet holds. Default 60."`
+}
+
+func NewWalletConfig() *WalletConfig {
+	return &WalletConfig{
+		HoldDefaultExpirySec:       3600,
+		HoldMaxExpirySec:           604_800,
+		HoldExpirySweepIntervalSec: 60,
+	}
+}
+
+// StoreConfig is configuration relevant to the virtual store catalog.
+type StoreConfig struct {
+	Products []*StoreProductConfig `yaml:"products" json:"products" usage:"Products in the store catalog, in addition to those registered by the runtime."`
+}
+
+func NewStoreConfig() *StoreConfig {
+	return &StoreConfig{
+		Products: make([]*StoreProductConfig, 0),
+	}
+}
+
+// StoreProductConfig is a product in the store catalog, and the grants given to users who buy it.
+type StoreProductConfig struct {
+	Id            string                    `yaml:"id" json:"id" usage:"Unique ID of the product in the catalog."`
+	IapProductIds []string                  `yaml:"iap_product_ids" json:"iap_product_ids" usage:"In-app purchase product IDs, across all platforms, whose validated purchases are fulfilled with this product. Default the product ID."`
+	Price         map[string]int64          `yaml:"price" json:"price" usage:"Virtual currency price, by wallet currency. Default none, the product can only be bought through in-app purchases."`
+	Wallet        map[string]int64          `yaml:"wallet" json:"wallet" usage:"Wallet currencies granted, by currency."`
+	Items         []*StoreProductItemConfig `yaml:"items" json:"items" usage:"Storage objects granted."`
+}
+
+// StoreProductItemConfig is a storage object granted by a store product.
+type StoreProductItemConfig struct {
+	Collection      string `yaml:"collection" json:"collection" usage:"Storage collection of the object."`
+	Key             string `yaml:"key" json:"key" usage:"Storage key of the object, replacing any existing object. Default a new random key for each grant."`
+	Value           string `yaml:"value" json:"value" usage:"JSON object value of the storage object."`
+	PermissionRead  int    `yaml:"permission_read" json:"permission_read" usage:"Read permission of the object, 0, 1 or 2. Default 0."`
+	PermissionWrite int    `yaml:"permission_write" json:"permission_write" usage:"Write permission of the object, 0 or 1. Default 0."`
+}
+
+func (c *StoreProductConfig) Clone() *StoreProductConfig {
+	product := *c
+	product.IapProductIds = append([]string{}, c.IapProductIds...)
+	product.Price = make(map[string]int64, len(c.Price))
+	for currency, amount := range c.Price {
+		product.Price[currency] = amount
+	}
+	product.Wallet = make(map[string]int64, len(c.Wallet))
+	for currency, amount := range c.Wallet {
+		product.Wallet[currency] = amount
+	}
+	product.Items = make([]*StoreProductItemConfig, 0, len(c.Items))
+	for _, item := range c.Items {
+		configItem := *item
+		product.Items = append(product.Items, &configItem)
+	}
+	return &product
+}
+
+func NewTradeConfig() *TradeConfig {
+	return &TradeConfig{
+		ItemCollections:        make([]string, 0),
+		MaxItems:               10,
+		DefaultExpirySec:       86_400,
+		MaxExpirySec:           604_800,
+		ExpirySweepIntervalSec: 60,
+	}
 }
@@ -150,6 +150,8 @@ type ConsoleServer struct {
 	matchRegistry        MatchRegistry
 	statusHandler        StatusHandler
 	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	groupIndex           GroupIndex
 	runtimeInfo          *RuntimeInfo
 	configWarnings       map[string]string
 	serverVersion        string
@@ -165,7 +167,7 @@ type ConsoleServer struct {
 	httpClient           *http.Client
 }
 
-func StartConsoleServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, config Config, tracker Tracker, router MessageRouter, streamManager StreamManager, metrics Metrics, sessionRegistry SessionRegistry, sessionCache SessionCache, consoleSessionCache SessionCache, loginAttemptCache LoginAttemptCache, statusRegistry StatusRegistry, statusHandler StatusHandler, runtimeInfo *RuntimeInfo, matchRegistry MatchRegistry, configWarnings map[string]string, serverVersion string, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, storageIndex StorageIndex, api *ApiServer, runtime *Runtime, cookie string) *ConsoleServer {
+func StartConsoleServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.DB, config Config, tracker Tracker, router MessageRouter, streamManager StreamManager, metrics Metrics, sessionRegistry SessionRegistry, sessionCache SessionCache, consoleSessionCache SessionCache, loginAttemptCache LoginAttemptCache, statusRegistry StatusRegistry, statusHandler StatusHandler, runtimeInfo *RuntimeInfo, matchRegistry MatchRegistry, configWarnings map[string]string, serverVersion string, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, groupIndex GroupIndex, api *ApiServer, runtime *Runtime, cookie string) *ConsoleServer {
 	var gatewayContextTimeoutMs string
 	if config.GetConsole().IdleTimeoutMs > 500 {
 		// Ensure the GRPC Gateway timeout is just under the idle timeout (if possible) to ensure it has priority.
@@ -207,6 +209,8 @@ func StartConsoleServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.D
 		leaderboardRankCache: leaderboardRankCache,
 		leaderboardScheduler: leaderboardScheduler,
 		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		groupIndex:           groupIndex,
 		api:                  api,
 		cookie:               cookie,
 		httpClient:           &http.Client{Timeout: 5 * time.Second},
@@ -262,11 +266,15 @@ func StartConsoleServer(logger *zap.Logger, startupLogger *zap.Logger, db *sql.D
 
 	grpcGatewayRouter := mux.NewRouter()
 	grpcGatewayRouter.HandleFunc("/v2/console/storage/import", s.importStorage)
+	grpcGatewayRouter.HandleFunc("/v2/console/storage/{collection}/{key}/{user_id}/history", s.listStorageHistory).Methods("GET")
+	grpcGatewayRouter.HandleFunc("/v2/console/storage/{collection}/{key}/{user_id}/history/{version}/restore", s.restoreStorageHistory).Methods("POST")
+	grpcGatewayRouter.HandleFunc("/v2/console/account/{id}/session", s.listAccountSessions).Methods("GET")
+	grpcGatewayRouter.HandleFunc("/v2/console/account/{id}/session/{session_id}", s.revokeAccountSession).Methods("DELETE")
 
 	// Register public subscription callback endpoints
 	if config.GetIAP().Apple.NotificationsEndpointId != "" {
 		endpoint := fmt.Sprintf("/v2/console/apple/subscriptions/%s", config.GetIAP().Apple.NotificationsEndpointId)
-		grpcGatewayRouter.HandleFunc(endpoint, appleNotificationHandler(logger, db, runtime.PurchaseNotificationApple(), runtime.SubscriptionNotificationApple()))
+		grpcGatewayRouter.HandleFunc(endpoint, appleNotificationHandler(logger, db, config.GetIAP().Apple, runtime.PurchaseNotificationApple(), runtime.SubscriptionNotificationApple()))
 		logger.Info("Registered endpoint for Apple subscription notifications callback", zap.String("endpoint", endpoint))
 	}
 
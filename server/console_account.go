@@ -30,7 +30,6 @@ import (
 	"github.com/heroiclabs/nakama/v3/console"
 	"github.com/jackc/pgtype"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -84,7 +83,7 @@ func (s *ConsoleServer) DeleteAccount(ctx context.Context, in *console.AccountDe
 		return nil, status.Error(codes.InvalidArgument, "Requires a valid user ID.")
 	}
 
-	if err = DeleteAccount(ctx, s.logger, s.db, s.config, s.leaderboardCache, s.leaderboardRankCache, s.sessionRegistry, s.sessionCache, s.tracker, userID, in.RecordDeletion != nil && in.RecordDeletion.Value); err != nil {
+	if err = DeleteAccount(ctx, s.logger, s.db, s.config, s.metrics, s.leaderboardCache, s.leaderboardRankCache, s.storageIndex, s.storageCollections, s.groupIndex, s.sessionRegistry, s.sessionCache, s.tracker, s.router, userID, in.RecordDeletion != nil && in.RecordDeletion.Value); err != nil {
 		// Error already logged in function above.
 		return nil, status.Error(codes.Internal, "An error occurred while trying to delete the user.")
 	}
@@ -130,7 +129,7 @@ func (s *ConsoleServer) DeleteGroupUser(ctx context.Context, in *console.DeleteG
 		return nil, status.Error(codes.InvalidArgument, "Requires a valid group ID.")
 	}
 
-	if err = KickGroupUsers(ctx, s.logger, s.db, s.tracker, s.router, s.streamManager, uuid.Nil, groupID, []uuid.UUID{userID}, true); err != nil {
+	if err = KickGroupUsers(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, s.streamManager, uuid.Nil, groupID, []uuid.UUID{userID}, true); err != nil {
 		// Error already logged in function above.
 		if err == ErrEmptyMemberKick {
 			return nil, status.Error(codes.FailedPrecondition, "Cannot kick user from group.")
@@ -646,7 +645,7 @@ func (s *ConsoleServer) UpdateAccount(ctx context.Context, in *console.UpdateAcc
 		if len(p) < 8 {
 			return nil, status.Error(codes.InvalidArgument, "Password must be at least 8 characters long.")
 		}
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
+		hashedPassword, err := HashPassword(s.config, p)
 		if err != nil {
 			s.logger.Error("Error hashing password.", zap.Error(err))
 			return nil, status.Error(codes.Internal, "Error updating user account password.")
@@ -703,7 +702,8 @@ AND (EXISTS (SELECT id FROM users WHERE id = $1 AND
      OR steam_id IS NOT NULL
      OR email IS NOT NULL
      OR custom_id IS NOT NULL))
-   OR EXISTS (SELECT id FROM user_device WHERE user_id = $1 AND id <> $2 LIMIT 1))`
+   OR EXISTS (SELECT id FROM user_device WHERE user_id = $1 AND id <> $2 LIMIT 1)
+   OR EXISTS (SELECT user_id FROM user_identity WHERE user_id = $1 LIMIT 1))`
 
 				res, err := tx.ExecContext(ctx, query, userID, oldDeviceID)
 				if err != nil {
@@ -743,7 +743,9 @@ AND ((facebook_id IS NOT NULL
       OR gamecenter_id IS NOT NULL
       OR steam_id IS NOT NULL)
      OR
-     EXISTS (SELECT id FROM user_device WHERE user_id = $1 LIMIT 1))`
+     EXISTS (SELECT id FROM user_device WHERE user_id = $1 LIMIT 1)
+     OR
+     EXISTS (SELECT user_id FROM user_identity WHERE user_id = $1 LIMIT 1))`
 
 			res, err := tx.ExecContext(ctx, query, userID)
 			if err != nil {
@@ -761,7 +763,9 @@ AND ((facebook_id IS NOT NULL
       OR steam_id IS NOT NULL
       OR email IS NOT NULL)
      OR
-     EXISTS (SELECT id FROM user_device WHERE user_id = $1 LIMIT 1))`
+     EXISTS (SELECT id FROM user_device WHERE user_id = $1 LIMIT 1)
+     OR
+     EXISTS (SELECT user_id FROM user_identity WHERE user_id = $1 LIMIT 1))`
 
 			res, err := tx.ExecContext(ctx, query, userID)
 			if err != nil {
@@ -779,7 +783,9 @@ AND ((facebook_id IS NOT NULL
       OR steam_id IS NOT NULL
       OR custom_id IS NOT NULL)
      OR
-     EXISTS (SELECT id FROM user_device WHERE user_id = $1 LIMIT 1))`
+     EXISTS (SELECT id FROM user_device WHERE user_id = $1 LIMIT 1)
+     OR
+     EXISTS (SELECT user_id FROM user_identity WHERE user_id = $1 LIMIT 1))`
 
 			res, err := tx.ExecContext(ctx, query, userID)
 			if err != nil {
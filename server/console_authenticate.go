@@ -183,8 +183,8 @@ func (s *ConsoleServer) lookupConsoleUser(ctx context.Context, unameOrEmail, pas
 	}
 
 	// Check password
-	err = bcrypt.CompareHashAndPassword(dbPassword, []byte(password))
-	if err != nil {
+	match, rehash := ComparePassword(s.config, dbPassword, password)
+	if !match {
 		if lockout, until := s.loginAttemptCache.Add(uname, ip); lockout != LockoutTypeNone {
 			switch lockout {
 			case LockoutTypeAccount:
@@ -196,6 +196,9 @@ func (s *ConsoleServer) lookupConsoleUser(ctx context.Context, unameOrEmail, pas
 		err = status.Error(codes.Unauthenticated, "Invalid credentials.")
 		return
 	}
+	if rehash {
+		rehashPassword(ctx, s.logger, s.db, s.config, "console_user", id.String(), dbPassword, password)
+	}
 
 	return
 
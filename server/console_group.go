@@ -170,7 +170,7 @@ func (s *ConsoleServer) DeleteGroup(ctx context.Context, in *console.DeleteGroup
 		return nil, status.Error(codes.InvalidArgument, "Requires a valid group ID.")
 	}
 
-	if err = DeleteGroup(ctx, s.logger, s.db, groupID, uuid.Nil); err != nil {
+	if err = DeleteGroup(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.groupIndex, groupID, uuid.Nil); err != nil {
 		// Error already logged in function above.
 		return nil, status.Error(codes.Internal, "An error occurred while trying to delete the user.")
 	}
@@ -234,7 +234,7 @@ func (s *ConsoleServer) UpdateGroup(ctx context.Context, in *console.UpdateGroup
 		maxCount = int(in.MaxCount.Value)
 	}
 
-	err = UpdateGroup(ctx, s.logger, s.db, groupID, uuid.Nil, uuid.Nil, in.Name, in.LangTag, in.Description, in.AvatarUrl, in.Metadata, in.Open, maxCount)
+	err = UpdateGroup(ctx, s.logger, s.db, s.groupIndex, groupID, uuid.Nil, uuid.Nil, in.Name, in.LangTag, in.Description, in.AvatarUrl, in.Metadata, in.Open, maxCount)
 	if err != nil {
 		return nil, err
 	}
@@ -565,12 +565,12 @@ func (s *ConsoleServer) AddGroupUsers(ctx context.Context, in *console.AddGroupU
 				s.logger.Debug("Could not retrieve username to join user to group.", zap.Error(err), zap.String("user_id", uid.String()))
 				return nil, status.Error(codes.Internal, "An error occurred while trying to join the user to the group. Refresh the page to see any updates.")
 			}
-			if err = JoinGroup(ctx, s.logger, s.db, s.tracker, s.router, groupUid, uid, username.String); err != nil {
+			if err = JoinGroup(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, groupUid, uid, username.String, ""); err != nil {
 				return nil, status.Error(codes.Internal, "An error occurred while trying to join an user to the group, refresh the page: "+err.Error()+". Refresh the page to see any updates.")
 			}
 		}
 	} else {
-		if err = AddGroupUsers(ctx, s.logger, s.db, s.tracker, s.router, uuid.Nil, groupUid, uuids); err != nil {
+		if err = AddGroupUsers(ctx, s.logger, s.db, s.leaderboardCache, s.leaderboardRankCache, s.tracker, s.router, uuid.Nil, groupUid, uuids); err != nil {
 			return nil, status.Error(codes.Internal, "An error occurred while trying to add the users: "+err.Error())
 		}
 	}
@@ -0,0 +1,112 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/mux"
+	"github.com/heroiclabs/nakama/v3/console"
+	"go.uber.org/zap"
+)
+
+func (s *ConsoleServer) listAccountSessions(w http.ResponseWriter, r *http.Request) {
+	if !s.checkSessionHttpAuth(w, r, console.UserRole_USER_ROLE_READONLY) {
+		return
+	}
+
+	userID, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		s.writeSessionHttpResponse(w, http.StatusBadRequest, []byte("Requires a valid user ID."))
+		return
+	}
+
+	sessions, err := SessionsList(r.Context(), s.logger, s.db, s.sessionCache, userID)
+	if err != nil {
+		s.writeSessionHttpResponse(w, http.StatusInternalServerError, []byte("An error occurred while trying to list sessions."))
+		return
+	}
+
+	response, err := json.Marshal(map[string]interface{}{"sessions": sessions})
+	if err != nil {
+		s.logger.Error("Error marshaling account sessions response", zap.Error(err))
+		s.writeSessionHttpResponse(w, http.StatusInternalServerError, []byte("An error occurred while trying to list sessions."))
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	s.writeSessionHttpResponse(w, http.StatusOK, response)
+}
+
+func (s *ConsoleServer) revokeAccountSession(w http.ResponseWriter, r *http.Request) {
+	if !s.checkSessionHttpAuth(w, r, console.UserRole_USER_ROLE_MAINTAINER) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := uuid.FromString(vars["id"])
+	if err != nil {
+		s.writeSessionHttpResponse(w, http.StatusBadRequest, []byte("Requires a valid user ID."))
+		return
+	}
+
+	var refreshOnly bool
+	if ro := r.URL.Query().Get("refresh_only"); ro != "" {
+		if refreshOnly, err = strconv.ParseBool(ro); err != nil {
+			s.writeSessionHttpResponse(w, http.StatusBadRequest, []byte("Refresh only must be a boolean."))
+			return
+		}
+	}
+
+	if err = SessionRevoke(r.Context(), s.logger, s.db, s.config, s.sessionCache, s.sessionRegistry, s.tracker, userID, vars["session_id"], refreshOnly); err != nil {
+		if err == ErrUserSessionNotFound {
+			s.writeSessionHttpResponse(w, http.StatusNotFound, []byte("Session not found."))
+		} else {
+			s.writeSessionHttpResponse(w, http.StatusInternalServerError, []byte("An error occurred while trying to revoke the session."))
+		}
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	s.writeSessionHttpResponse(w, http.StatusOK, []byte("{}"))
+}
+
+func (s *ConsoleServer) checkSessionHttpAuth(w http.ResponseWriter, r *http.Request, requiredRole console.UserRole) bool {
+	auth := r.Header.Get("authorization")
+	if len(auth) == 0 {
+		s.writeSessionHttpResponse(w, http.StatusUnauthorized, []byte("Console authentication required."))
+		return false
+	}
+	ctx, ok := checkAuth(r.Context(), s.logger, s.config, auth, s.consoleSessionCache, s.loginAttemptCache)
+	if !ok {
+		s.writeSessionHttpResponse(w, http.StatusUnauthorized, []byte("Console authentication invalid."))
+		return false
+	}
+
+	// Check user role, lower values are more privileged.
+	if role := ctx.Value(ctxConsoleRoleKey{}).(console.UserRole); role > requiredRole {
+		s.writeSessionHttpResponse(w, http.StatusForbidden, []byte("Forbidden"))
+		return false
+	}
+	return true
+}
+
+func (s *ConsoleServer) writeSessionHttpResponse(w http.ResponseWriter, code int, response []byte) {
+	w.WriteHeader(code)
+	if _, err := w.Write(response); err != nil {
+		s.logger.Error("Error writing account session response", zap.Error(err))
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/mux"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama/v3/console"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func (s *ConsoleServer) listStorageHistory(w http.ResponseWriter, r *http.Request) {
+	if !s.checkSessionHttpAuth(w, r, console.UserRole_USER_ROLE_READONLY) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := uuid.FromString(vars["user_id"])
+	if err != nil {
+		s.writeSessionHttpResponse(w, http.StatusBadRequest, []byte("Requires a valid user ID."))
+		return
+	}
+
+	limit := storageHistoryMaxList
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > storageHistoryMaxList {
+			s.writeSessionHttpResponse(w, http.StatusBadRequest, []byte("Limit must be between 1 and 100."))
+			return
+		}
+	}
+
+	objects, err := StorageHistoryList(r.Context(), s.logger, s.db, vars["collection"], vars["key"], userID, limit)
+	if err != nil {
+		s.writeSessionHttpResponse(w, http.StatusInternalServerError, []byte("An error occurred while trying to list storage history."))
+		return
+	}
+
+	response, err := protojson.Marshal(&api.StorageObjects{Objects: objects})
+	if err != nil {
+		s.logger.Error("Error marshaling storage history response", zap.Error(err))
+		s.writeSessionHttpResponse(w, http.StatusInternalServerError, []byte("An error occurred while trying to list storage history."))
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	s.writeSessionHttpResponse(w, http.StatusOK, response)
+}
+
+func (s *ConsoleServer) restoreStorageHistory(w http.ResponseWriter, r *http.Request) {
+	if !s.checkSessionHttpAuth(w, r, console.UserRole_USER_ROLE_MAINTAINER) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := uuid.FromString(vars["user_id"])
+	if err != nil {
+		s.writeSessionHttpResponse(w, http.StatusBadRequest, []byte("Requires a valid user ID."))
+		return
+	}
+
+	ack, code, err := StorageHistoryRestore(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, vars["collection"], vars["key"], userID, vars["version"])
+	if err != nil {
+		switch code {
+		case codes.NotFound:
+			s.writeSessionHttpResponse(w, http.StatusNotFound, []byte("Storage object version not found."))
+		case codes.InvalidArgument:
+			s.writeSessionHttpResponse(w, http.StatusBadRequest, []byte(err.Error()))
+		default:
+			s.writeSessionHttpResponse(w, http.StatusInternalServerError, []byte("An error occurred while trying to restore the storage object."))
+		}
+		return
+	}
+
+	response, err := protojson.Marshal(ack)
+	if err != nil {
+		s.logger.Error("Error marshaling storage restore response", zap.Error(err))
+		s.writeSessionHttpResponse(w, http.StatusInternalServerError, []byte("An error occurred while trying to restore the storage object."))
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	s.writeSessionHttpResponse(w, http.StatusOK, response)
+}
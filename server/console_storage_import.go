@@ -129,10 +129,10 @@ func (s *ConsoleServer) importStorage(w http.ResponseWriter, r *http.Request) {
 	// Examine file name to determine if it's a JSON or CSV import.
 	if strings.HasSuffix(strings.ToLower(filename), ".json") {
 		// File has .json suffix, try to import as JSON.
-		err = importStorageJSON(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, fileBytes)
+		err = importStorageJSON(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, fileBytes)
 	} else {
 		// Assume all other files are CSV.
-		err = importStorageCSV(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, fileBytes)
+		err = importStorageCSV(r.Context(), s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, fileBytes)
 	}
 
 	if err != nil {
@@ -145,7 +145,7 @@ func (s *ConsoleServer) importStorage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func importStorageJSON(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, fileBytes []byte) error {
+func importStorageJSON(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, fileBytes []byte) error {
 	importedData := make([]*importStorageObject, 0)
 	ops := StorageOpWrites{}
 
@@ -200,7 +200,7 @@ func importStorageJSON(ctx context.Context, logger *zap.Logger, db *sql.DB, metr
 		return nil
 	}
 
-	acks, _, err := StorageWriteObjects(ctx, logger, db, metrics, storageIndex, true, ops)
+	acks, _, err := StorageWriteObjects(ctx, logger, db, metrics, storageIndex, storageCollections, tracker, router, true, ops)
 	if err != nil {
 		logger.Warn("Failed to write imported records.", zap.Error(err))
 		return errors.New("could not import records due to an internal error - please consult server logs")
@@ -210,7 +210,7 @@ func importStorageJSON(ctx context.Context, logger *zap.Logger, db *sql.DB, metr
 	return nil
 }
 
-func importStorageCSV(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, fileBytes []byte) error {
+func importStorageCSV(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, fileBytes []byte) error {
 	r := csv.NewReader(bytes.NewReader(fileBytes))
 
 	columnIndexes := make(map[string]int)
@@ -300,7 +300,7 @@ func importStorageCSV(ctx context.Context, logger *zap.Logger, db *sql.DB, metri
 		return nil
 	}
 
-	acks, _, err := StorageWriteObjects(ctx, logger, db, metrics, storageIndex, true, ops)
+	acks, _, err := StorageWriteObjects(ctx, logger, db, metrics, storageIndex, storageCollections, tracker, router, true, ops)
 	if err != nil {
 		logger.Warn("Failed to write imported records.", zap.Error(err))
 		return errors.New("could not import records due to an internal error - please consult server logs")
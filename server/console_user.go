@@ -29,7 +29,6 @@ import (
 	"github.com/heroiclabs/nakama/v3/console"
 	"github.com/jackc/pgconn"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -99,7 +98,7 @@ func (s *ConsoleServer) AddUser(ctx context.Context, in *console.AddUserRequest)
 }
 
 func (s *ConsoleServer) dbInsertConsoleUser(ctx context.Context, in *console.AddUserRequest) (bool, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(s.config, in.Password)
 	if err != nil {
 		return false, err
 	}
@@ -48,6 +48,9 @@ type accountUpdate struct {
 	langTag     *wrapperspb.StringValue
 	avatarURL   *wrapperspb.StringValue
 	metadata    *wrapperspb.StringValue
+	// Checks a changed username or display name, and the minimum time between username changes, if set. Names left
+	// unchanged are not checked, so accounts keep working when the policy changes.
+	namePolicy NamePolicy
 }
 
 func GetAccount(ctx context.Context, logger *zap.Logger, db *sql.DB, statusRegistry StatusRegistry, userID uuid.UUID) (*api.Account, error) {
@@ -267,12 +270,42 @@ func updateAccounts(ctx context.Context, logger *zap.Logger, tx pgx.Tx, updates
 			if invalidUsernameRegex.MatchString(update.username) {
 				return errors.New("Username invalid, no spaces or control characters allowed.")
 			}
+			if update.namePolicy != nil {
+				var username string
+				var usernameUpdateTime pgtype.Timestamptz
+				if err := tx.QueryRow(ctx, "SELECT username, username_update_time FROM users WHERE id = $1 FOR UPDATE", update.userID).Scan(&username, &usernameUpdateTime); err != nil {
+					return err
+				}
+				if username != update.username {
+					if err := update.namePolicy.Check(NamePolicyFieldUsername, update.username); err != nil {
+						return StatusError(codes.InvalidArgument, err.Error(), err)
+					}
+					if cooldown := update.namePolicy.RenameCooldown(); cooldown > 0 {
+						if wait := time.Until(usernameUpdateTime.Time.Add(cooldown)); wait > 0 {
+							violation := &NamePolicyViolation{Field: NamePolicyFieldUsername, Reason: NamePolicyReasonRenameCooldown, Value: strconv.FormatInt(rateLimitRetryAfterSec(wait), 10)}
+							return StatusError(codes.InvalidArgument, violation.Error(), violation)
+						}
+					}
+				}
+			}
 			params = append(params, update.username)
+			updateStatements = append(updateStatements, "username_update_time = CASE WHEN username IS DISTINCT FROM $"+strconv.Itoa(len(params))+" THEN now() ELSE username_update_time END")
 			updateStatements = append(updateStatements, "username = $"+strconv.Itoa(len(params)))
 			distinctStatements = append(distinctStatements, "username IS DISTINCT FROM $"+strconv.Itoa(len(params)))
 		}
 
 		if update.displayName != nil {
+			if d := update.displayName.GetValue(); d != "" && update.namePolicy != nil {
+				var displayName sql.NullString
+				if err := tx.QueryRow(ctx, "SELECT display_name FROM users WHERE id = $1", update.userID).Scan(&displayName); err != nil {
+					return err
+				}
+				if displayName.String != d {
+					if err := update.namePolicy.Check(NamePolicyFieldDisplayName, d); err != nil {
+						return StatusError(codes.InvalidArgument, err.Error(), err)
+					}
+				}
+			}
 			if d := update.displayName.GetValue(); d == "" {
 				updateStatements = append(updateStatements, "display_name = NULL")
 				distinctStatements = append(distinctStatements, "display_name IS NOT NULL")
@@ -458,7 +491,7 @@ func ExportAccount(ctx context.Context, logger *zap.Logger, db *sql.DB, userID u
 	return export, nil
 }
 
-func DeleteAccount(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, sessionRegistry SessionRegistry, sessionCache SessionCache, tracker Tracker, userID uuid.UUID, recorded bool) error {
+func DeleteAccount(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, metrics Metrics, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, groupIndex GroupIndex, sessionRegistry SessionRegistry, sessionCache SessionCache, tracker Tracker, router MessageRouter, userID uuid.UUID, recorded bool) error {
 	if userID == uuid.Nil {
 		return errors.New("cannot delete the system user")
 	}
@@ -466,7 +499,11 @@ func DeleteAccount(ctx context.Context, logger *zap.Logger, db *sql.DB, config C
 	ts := time.Now().UTC().Unix()
 
 	var deleted bool
-	if err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+	var trades []*Trade
+	var groupIDs []uuid.UUID
+	tradeChanges := &tradeStorageChanges{deleteReads: make(map[*StorageOpDelete]int32)}
+	if err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		tradeChanges.deletes, tradeChanges.written = nil, nil
 		count, err := DeleteUser(ctx, tx, userID)
 		if err != nil {
 			logger.Debug("Could not delete user", zap.Error(err), zap.String("user_id", userID.String()))
@@ -476,20 +513,27 @@ func DeleteAccount(ctx context.Context, logger *zap.Logger, db *sql.DB, config C
 			return nil
 		}
 
+		// Open trades are cancelled, returning the other party's escrow to them.
+		trades, err = tradeCancelUser(ctx, logger, tx, metrics, storageCollections, tradeChanges, userID, true)
+		if err != nil {
+			logger.Debug("Could not cancel open trades.", zap.Error(err), zap.String("user_id", userID.String()))
+			return err
+		}
+
 		err = LeaderboardRecordsDeleteAll(ctx, logger, leaderboardCache, leaderboardRankCache, tx, userID, ts)
 		if err != nil {
 			logger.Debug("Could not delete leaderboard records.", zap.Error(err), zap.String("user_id", userID.String()))
 			return err
 		}
 
-		err = GroupDeleteAll(ctx, logger, tx, userID)
+		groupIDs, err = GroupDeleteAll(ctx, logger, tx, userID)
 		if err != nil {
 			logger.Debug("Could not delete groups and relationships.", zap.Error(err), zap.String("user_id", userID.String()))
 			return err
 		}
 
 		if recorded {
-			_, err = tx.ExecContext(ctx, `INSERT INTO user_tombstone (user_id) VALUES ($1) ON CONFLICT(user_id) DO NOTHING`, userID)
+			_, err = tx.Exec(ctx, `INSERT INTO user_tombstone (user_id) VALUES ($1) ON CONFLICT(user_id) DO NOTHING`, userID)
 			if err != nil {
 				logger.Debug("Could not insert user ID into tombstone", zap.Error(err), zap.String("user_id", userID.String()))
 				return err
@@ -505,6 +549,13 @@ func DeleteAccount(ctx context.Context, logger *zap.Logger, db *sql.DB, config C
 	}
 
 	if deleted {
+		groupIndexRefresh(ctx, logger, db, groupIndex, groupIDs...)
+		leaderboardGroupAggregatesGroupsRefresh(ctx, logger, db, leaderboardCache, leaderboardRankCache, groupIDs...)
+		tradeChanges.publish(ctx, logger, storageIndex, tracker, router)
+		for _, trade := range trades {
+			tradeNotify(ctx, logger, db, tracker, router, userID, TradeActionCancel, trade)
+		}
+
 		// Logout and disconnect.
 		if err := SessionLogout(config, sessionCache, userID, "", ""); err != nil {
 			return err
@@ -0,0 +1,125 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Schedule deletion of an account once the configured grace period has passed. Its sessions are revoked and its sockets
+// disconnected, and authenticating again before the purge time cancels the deletion. The pending deletion is kept apart
+// from the account's disable time, so bans are neither set nor lifted by it.
+func AccountDeletionSchedule(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, sessionRegistry SessionRegistry, sessionCache SessionCache, tracker Tracker, userID uuid.UUID) (int64, error) {
+	if userID == uuid.Nil {
+		return 0, errors.New("cannot delete the system user")
+	}
+
+	purgeTime := time.Now().UTC().Add(time.Duration(config.GetAccount().DeletionGracePeriodSec) * time.Second)
+
+	// A repeated request keeps the original purge time.
+	query := `
+INSERT INTO user_deletion (user_id, purge_time)
+SELECT id, $2 FROM users WHERE id = $1
+ON CONFLICT (user_id) DO UPDATE SET purge_time = user_deletion.purge_time
+RETURNING purge_time`
+	if err := db.QueryRowContext(ctx, query, userID, purgeTime).Scan(&purgeTime); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrAccountNotFound
+		}
+		logger.Error("Error scheduling account deletion.", zap.Error(err), zap.String("user_id", userID.String()))
+		return 0, err
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM user_session WHERE user_id = $1", userID); err != nil {
+		logger.Error("Error removing sessions of account scheduled for deletion.", zap.Error(err), zap.String("user_id", userID.String()))
+		return 0, err
+	}
+	if err := SessionLogout(config, sessionCache, userID, "", ""); err != nil {
+		return 0, err
+	}
+	for _, presence := range tracker.ListPresenceIDByStream(PresenceStream{Mode: StreamModeNotifications, Subject: userID}) {
+		if err := sessionRegistry.Disconnect(ctx, presence.SessionID, false); err != nil {
+			return 0, err
+		}
+	}
+
+	logger.Info("Account deletion scheduled.", zap.String("user_id", userID.String()), zap.Time("purge_time", purgeTime))
+	return purgeTime.Unix(), nil
+}
+
+// Cancel a scheduled deletion, returning true if the account had one. Accounts already past their purge time can't be
+// restored.
+func AccountDeletionCancel(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID) (bool, error) {
+	var purgeTime pgtype.Timestamptz
+	if err := db.QueryRowContext(ctx, "SELECT purge_time FROM user_deletion WHERE user_id = $1", userID).Scan(&purgeTime); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		logger.Error("Error checking account deletion.", zap.Error(err), zap.String("user_id", userID.String()))
+		return false, status.Error(codes.Internal, "Error finding user account.")
+	}
+	if !purgeTime.Time.After(time.Now()) {
+		logger.Info("User account is pending deletion.", zap.String("user_id", userID.String()))
+		return false, status.Error(codes.PermissionDenied, "User account deleted.")
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM user_deletion WHERE user_id = $1", userID); err != nil {
+		logger.Error("Error cancelling account deletion.", zap.Error(err), zap.String("user_id", userID.String()))
+		return false, status.Error(codes.Internal, "Error finding user account.")
+	}
+
+	logger.Info("Account deletion cancelled.", zap.String("user_id", userID.String()))
+	return true, nil
+}
+
+// Delete up to limit accounts whose grace period has passed, returning the number deleted.
+func AccountDeletionPurge(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, metrics Metrics, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, groupIndex GroupIndex, sessionRegistry SessionRegistry, sessionCache SessionCache, tracker Tracker, router MessageRouter, limit int) (int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT user_id FROM user_deletion WHERE purge_time <= now() ORDER BY purge_time LIMIT $1", limit)
+	if err != nil {
+		logger.Error("Error listing accounts due for deletion.", zap.Error(err))
+		return 0, err
+	}
+	userIDs := make([]uuid.UUID, 0, limit)
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			_ = rows.Close()
+			logger.Error("Error scanning account due for deletion.", zap.Error(err))
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	_ = rows.Close()
+
+	var count int
+	for _, userID := range userIDs {
+		// The user_deletion row is removed along with the user, and stays in place for a retry if this fails.
+		if err = DeleteAccount(ctx, logger, db, config, metrics, leaderboardCache, leaderboardRankCache, storageIndex, storageCollections, groupIndex, sessionRegistry, sessionCache, tracker, router, userID, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgtype"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func accountDisableTime(t *testing.T, db *sql.DB, userID uuid.UUID) int64 {
+	var disableTime pgtype.Timestamptz
+	if err := db.QueryRow("SELECT disable_time FROM users WHERE id = $1", userID).Scan(&disableTime); err != nil {
+		t.Fatalf("error reading disable time: %v", err)
+	}
+	return disableTime.Time.Unix()
+}
+
+func TestAccountDeletionScheduleAndCancel(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	config.Account.DeletionGracePeriodSec = 3600
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	sessionRegistry := NewLocalSessionRegistry(metrics)
+	tracker := &LocalTracker{}
+
+	customID := uuid.Must(uuid.NewV4()).String()
+	dbUserID, _, _, err := AuthenticateCustom(ctx, logger, db, nil, customID, customID, true)
+	if err != nil {
+		t.Fatalf("error creating account: %v", err)
+	}
+	userID := uuid.FromStringOrNil(dbUserID)
+	tokenID := uuid.Must(uuid.NewV4()).String()
+	refreshExp := time.Now().UTC().Unix() + config.GetSession().RefreshTokenExpirySec
+	assert.NoError(t, SessionRecord(ctx, logger, db, userID, tokenID, tokenID, nil, "", "", refreshExp))
+
+	purgeTime, err := AccountDeletionSchedule(ctx, logger, db, config, sessionRegistry, sessionCache, tracker, userID)
+	if err != nil {
+		t.Fatalf("error scheduling deletion: %v", err)
+	}
+	assert.InDelta(t, time.Now().UTC().Unix()+3600, purgeTime, 5)
+	assert.Zero(t, accountDisableTime(t, db, userID), "A pending deletion is not a ban.")
+	assert.False(t, sessionCache.IsValidRefresh(userID, refreshExp, tokenID))
+	sessions, err := SessionsList(ctx, logger, db, sessionCache, userID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 0)
+
+	// Scheduling again keeps the original purge time.
+	config.Account.DeletionGracePeriodSec = 7200
+	repeatPurgeTime, err := AccountDeletionSchedule(ctx, logger, db, config, sessionRegistry, sessionCache, tracker, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, purgeTime, repeatPurgeTime)
+
+	// The account may still authenticate to cancel the deletion.
+	_, _, _, err = AuthenticateCustom(ctx, logger, db, nil, customID, customID, false)
+	assert.NoError(t, err)
+
+	cancelled, err := AccountDeletionCancel(ctx, logger, db, userID)
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+	assert.Zero(t, accountDisableTime(t, db, userID))
+
+	cancelled, err = AccountDeletionCancel(ctx, logger, db, userID)
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+
+	_, err = AccountDeletionSchedule(ctx, logger, db, config, sessionRegistry, sessionCache, tracker, uuid.Must(uuid.NewV4()))
+	assert.Equal(t, ErrAccountNotFound, err)
+}
+
+func TestAccountDeletionBannedAccount(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	config.Account.DeletionGracePeriodSec = 3600
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	sessionRegistry := NewLocalSessionRegistry(metrics)
+	tracker := &LocalTracker{}
+
+	customID := uuid.Must(uuid.NewV4()).String()
+	dbUserID, _, _, err := AuthenticateCustom(ctx, logger, db, nil, customID, customID, true)
+	if err != nil {
+		t.Fatalf("error creating account: %v", err)
+	}
+	userID := uuid.FromStringOrNil(dbUserID)
+
+	// A ban during the grace period still applies to login.
+	_, err = AccountDeletionSchedule(ctx, logger, db, config, sessionRegistry, sessionCache, tracker, userID)
+	assert.NoError(t, err)
+	assert.NoError(t, BanUsers(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, []uuid.UUID{userID}))
+	_, _, _, err = AuthenticateCustom(ctx, logger, db, nil, customID, customID, false)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Cancelling the deletion leaves the ban in place.
+	cancelled, err := AccountDeletionCancel(ctx, logger, db, userID)
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+	assert.NotZero(t, accountDisableTime(t, db, userID))
+	_, _, _, err = AuthenticateCustom(ctx, logger, db, nil, customID, customID, false)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Scheduling a deletion keeps an existing ban's disable time.
+	if _, err = db.Exec("UPDATE users SET disable_time = '2020-01-01 00:00:00 UTC' WHERE id = $1", userID); err != nil {
+		t.Fatalf("error banning account: %v", err)
+	}
+	_, err = AccountDeletionSchedule(ctx, logger, db, config, sessionRegistry, sessionCache, tracker, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Unix(), accountDisableTime(t, db, userID))
+}
+
+func TestAccountDeletionPurge(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	sessionRegistry := NewLocalSessionRegistry(metrics)
+	tracker := &LocalTracker{}
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	lbRankCache := NewLocalLeaderboardRankCache(ctx, logger, db, config.Leaderboard, lbCache)
+
+	dueCustomID := uuid.Must(uuid.NewV4()).String()
+	dueUserID, _, _, err := AuthenticateCustom(ctx, logger, db, nil, dueCustomID, dueCustomID, true)
+	if err != nil {
+		t.Fatalf("error creating account: %v", err)
+	}
+	pendingUserID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, pendingUserID)
+
+	// With no grace period left the deletion is due immediately.
+	_, err = AccountDeletionSchedule(ctx, logger, db, config, sessionRegistry, sessionCache, tracker, uuid.FromStringOrNil(dueUserID))
+	assert.NoError(t, err)
+	config.Account.DeletionGracePeriodSec = 3600
+	_, err = AccountDeletionSchedule(ctx, logger, db, config, sessionRegistry, sessionCache, tracker, pendingUserID)
+	assert.NoError(t, err)
+
+	// Past the purge time the account can no longer be restored.
+	_, err = AccountDeletionCancel(ctx, logger, db, uuid.FromStringOrNil(dueUserID))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	count, err := AccountDeletionPurge(ctx, logger, db, config, metrics, lbCache, lbRankCache, storageIdx, storageCollections, groupIdx, sessionRegistry, sessionCache, tracker, &DummyMessageRouter{}, 100)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, count, 1)
+
+	var exists bool
+	assert.NoError(t, db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", dueUserID).Scan(&exists))
+	assert.False(t, exists)
+	assert.NoError(t, db.QueryRow("SELECT EXISTS (SELECT 1 FROM user_deletion WHERE user_id = $1)", dueUserID).Scan(&exists))
+	assert.False(t, exists)
+	assert.NoError(t, db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", pendingUserID).Scan(&exists))
+	assert.True(t, exists)
+	assert.NoError(t, db.QueryRow("SELECT EXISTS (SELECT 1 FROM user_deletion WHERE user_id = $1)", pendingUserID).Scan(&exists))
+	assert.True(t, exists)
+}
+
+func TestAccountExport(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	tracker := &LocalTracker{}
+	router := &DummyMessageRouter{}
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+
+	export, err := AccountExportRequest(ctx, logger, db, config, userID)
+	if err != nil {
+		t.Fatalf("error requesting export: %v", err)
+	}
+	assert.Equal(t, "pending", export.State)
+
+	// A pending export is returned instead of queueing another.
+	repeat, err := AccountExportRequest(ctx, logger, db, config, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, export.Id, repeat.Id)
+
+	exportID := uuid.FromStringOrNil(export.Id)
+	pending, err := AccountExportGet(ctx, logger, db, userID, exportID)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", pending.State)
+	assert.Empty(t, pending.Data)
+
+	_, err = AccountExportProcess(ctx, logger, db, config, protojsonMarshaler, tracker, router, 100)
+	assert.NoError(t, err)
+
+	complete, err := AccountExportGet(ctx, logger, db, userID, exportID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "complete", complete.State)
+		assert.NotZero(t, complete.CompleteTime)
+		assert.Contains(t, string(complete.Data), userID.String())
+	}
+
+	var notified bool
+	assert.NoError(t, db.QueryRow("SELECT EXISTS (SELECT 1 FROM notification WHERE user_id = $1 AND code = $2)", userID, NotificationCodeAccountExport).Scan(&notified))
+	assert.True(t, notified)
+
+	// Exports are only visible to their own user.
+	_, err = AccountExportGet(ctx, logger, db, uuid.Must(uuid.NewV4()), exportID)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = AccountExportRequest(ctx, logger, db, config, uuid.Must(uuid.NewV4()))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	accountExportStatePending  = 0
+	accountExportStateComplete = 1
+	accountExportStateFailed   = 2
+)
+
+var accountExportStates = map[int]string{
+	accountExportStatePending:  "pending",
+	accountExportStateComplete: "complete",
+	accountExportStateFailed:   "failed",
+}
+
+// AccountExport is a player requested export of their account data, the data is only set once it is complete.
+type AccountExport struct {
+	Id           string          `json:"id"`
+	State        string          `json:"state"`
+	CreateTime   int64           `json:"create_time"`
+	CompleteTime int64           `json:"complete_time,omitempty"`
+	ExpiryTime   int64           `json:"expiry_time"`
+	Data         json.RawMessage `json:"data,omitempty"`
+}
+
+// Queue an export of the user's account data. If one is already pending it is returned instead of queueing another.
+func AccountExportRequest(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, userID uuid.UUID) (*AccountExport, error) {
+	var export *AccountExport
+	err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		// Serialise requests from the same user.
+		var id uuid.UUID
+		if err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return StatusError(codes.NotFound, "Account not found.", ErrAccountNotFound)
+			}
+			return err
+		}
+
+		var createTime, expiryTime pgtype.Timestamptz
+		query := "SELECT id, create_time, expiry_time FROM user_export WHERE user_id = $1 AND state = $2 LIMIT 1"
+		err := tx.QueryRowContext(ctx, query, userID, accountExportStatePending).Scan(&id, &createTime, &expiryTime)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			export = &AccountExport{Id: id.String(), State: accountExportStates[accountExportStatePending], CreateTime: createTime.Time.Unix(), ExpiryTime: expiryTime.Time.Unix()}
+			return nil
+		}
+
+		id = uuid.Must(uuid.NewV4())
+		now := time.Now().UTC()
+		expiry := now.Add(time.Duration(config.GetAccount().ExportExpirySec) * time.Second)
+		if _, err = tx.ExecContext(ctx, "INSERT INTO user_export (id, user_id, create_time, expiry_time) VALUES ($1, $2, $3, $4)", id, userID, now, expiry); err != nil {
+			return err
+		}
+		export = &AccountExport{Id: id.String(), State: accountExportStates[accountExportStatePending], CreateTime: now.Unix(), ExpiryTime: expiry.Unix()}
+		return nil
+	})
+	if err != nil {
+		if e, ok := err.(*statusError); ok {
+			return nil, e.Status()
+		}
+		logger.Error("Error requesting account export.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error requesting account export.")
+	}
+
+	return export, nil
+}
+
+// Get one of the user's account exports, including its data if it is complete.
+func AccountExportGet(ctx context.Context, logger *zap.Logger, db *sql.DB, userID, exportID uuid.UUID) (*AccountExport, error) {
+	var state int
+	var data []byte
+	var createTime, completeTime, expiryTime pgtype.Timestamptz
+	query := "SELECT state, data, create_time, complete_time, expiry_time FROM user_export WHERE id = $1 AND user_id = $2 AND expiry_time > now()"
+	if err := db.QueryRowContext(ctx, query, exportID, userID).Scan(&state, &data, &createTime, &completeTime, &expiryTime); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "Account export not found.")
+		}
+		logger.Error("Error reading account export.", zap.Error(err), zap.String("user_id", userID.String()), zap.String("export_id", exportID.String()))
+		return nil, status.Error(codes.Internal, "Error reading account export.")
+	}
+
+	export := &AccountExport{
+		Id:         exportID.String(),
+		State:      accountExportStates[state],
+		CreateTime: createTime.Time.Unix(),
+		ExpiryTime: expiryTime.Time.Unix(),
+		Data:       data,
+	}
+	if state != accountExportStatePending {
+		export.CompleteTime = completeTime.Time.Unix()
+	}
+	return export, nil
+}
+
+// Build up to limit pending account exports, oldest first, and notify each user when theirs is ready. Returns the
+// number of exports processed.
+func AccountExportProcess(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, protojsonMarshaler *protojson.MarshalOptions, tracker Tracker, router MessageRouter, limit int) (int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, user_id FROM user_export WHERE state = $1 ORDER BY create_time LIMIT $2", accountExportStatePending, limit)
+	if err != nil {
+		logger.Error("Error listing pending account exports.", zap.Error(err))
+		return 0, err
+	}
+	type pendingExport struct {
+		id     uuid.UUID
+		userID uuid.UUID
+	}
+	pending := make([]*pendingExport, 0, limit)
+	for rows.Next() {
+		p := &pendingExport{}
+		if err := rows.Scan(&p.id, &p.userID); err != nil {
+			_ = rows.Close()
+			logger.Error("Error scanning pending account export.", zap.Error(err))
+			return 0, err
+		}
+		pending = append(pending, p)
+	}
+	_ = rows.Close()
+
+	for _, p := range pending {
+		state := accountExportStateComplete
+		var data []byte
+		export, err := ExportAccount(ctx, logger, db, p.userID)
+		if err == nil {
+			data, err = protojsonMarshaler.Marshal(export)
+		}
+		if err != nil {
+			// Errors are logged by the export itself, the user can request a new one.
+			logger.Warn("Account export failed.", zap.Error(err), zap.String("user_id", p.userID.String()), zap.String("export_id", p.id.String()))
+			state = accountExportStateFailed
+			data = nil
+		}
+
+		now := time.Now().UTC()
+		expiryTime := now.Add(time.Duration(config.GetAccount().ExportExpirySec) * time.Second)
+		query := "UPDATE user_export SET state = $2, data = $3, complete_time = $4, expiry_time = $5 WHERE id = $1 AND state = $6"
+		if _, err = db.ExecContext(ctx, query, p.id, state, data, now, expiryTime, accountExportStatePending); err != nil {
+			logger.Error("Error storing account export.", zap.Error(err), zap.String("user_id", p.userID.String()), zap.String("export_id", p.id.String()))
+			return 0, err
+		}
+
+		content, _ := json.Marshal(map[string]interface{}{"export_id": p.id.String(), "state": accountExportStates[state]})
+		subject := "Your account export is ready."
+		if state == accountExportStateFailed {
+			subject = "Your account export failed."
+		}
+		// Any error is already logged before it's returned here.
+		_ = NotificationSend(ctx, logger, db, tracker, router, map[uuid.UUID][]*api.Notification{p.userID: {{
+			Id:         uuid.Must(uuid.NewV4()).String(),
+			Subject:    subject,
+			Content:    string(content),
+			Code:       NotificationCodeAccountExport,
+			Persistent: true,
+			CreateTime: &timestamppb.Timestamp{Seconds: now.Unix()},
+		}}})
+	}
+
+	return len(pending), nil
+}
+
+// Remove account exports past their expiry time.
+func AccountExportExpire(ctx context.Context, logger *zap.Logger, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM user_export WHERE expiry_time <= now()"); err != nil {
+		logger.Error("Error removing expired account exports.", zap.Error(err))
+		return err
+	}
+	return nil
+}
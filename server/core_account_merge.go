@@ -0,0 +1,796 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// Storage objects both accounts hold under the same collection and key.
+	AccountMergeStorageTarget = "target"
+	AccountMergeStorageSource = "source"
+
+	// Leaderboard records both accounts hold on the same leaderboard and period.
+	AccountMergeLeaderboardBest   = "best"
+	AccountMergeLeaderboardTarget = "target"
+	AccountMergeLeaderboardSource = "source"
+
+	// Wallet balances of the source account.
+	AccountMergeWalletSum    = "sum"
+	AccountMergeWalletTarget = "target"
+)
+
+var ErrAccountMergeSame = errors.New("cannot merge an account into itself")
+
+// AccountMergePolicy decides how data held by both accounts is resolved. It is also the payload sent to, and
+// optionally returned by, the configured merge hook.
+type AccountMergePolicy struct {
+	SourceUserId string `json:"source_user_id"`
+	TargetUserId string `json:"target_user_id"`
+	Storage      string `json:"storage"`
+	Leaderboard  string `json:"leaderboard"`
+	Wallet       string `json:"wallet"`
+}
+
+func NewAccountMergePolicy(sourceID, targetID uuid.UUID) *AccountMergePolicy {
+	return &AccountMergePolicy{
+		SourceUserId: sourceID.String(),
+		TargetUserId: targetID.String(),
+		Storage:      AccountMergeStorageTarget,
+		Leaderboard:  AccountMergeLeaderboardBest,
+		Wallet:       AccountMergeWalletSum,
+	}
+}
+
+func (p *AccountMergePolicy) validate() error {
+	switch p.Storage {
+	case AccountMergeStorageTarget, AccountMergeStorageSource:
+	default:
+		return fmt.Errorf("invalid storage merge policy: %q", p.Storage)
+	}
+	switch p.Leaderboard {
+	case AccountMergeLeaderboardBest, AccountMergeLeaderboardTarget, AccountMergeLeaderboardSource:
+	default:
+		return fmt.Errorf("invalid leaderboard merge policy: %q", p.Leaderboard)
+	}
+	switch p.Wallet {
+	case AccountMergeWalletSum, AccountMergeWalletTarget:
+	default:
+		return fmt.Errorf("invalid wallet merge policy: %q", p.Wallet)
+	}
+	return nil
+}
+
+// Pass the merge policy through the registered hook, which may adjust it or reject the merge by returning an error.
+func accountMergeHook(ctx context.Context, hookFn RuntimeBeforeAccountMergeFunction, targetUsername string, policy *AccountMergePolicy) (*AccountMergePolicy, error) {
+	if hookFn == nil {
+		return policy, nil
+	}
+
+	// Hooks are given a copy, so the default policy stays intact whatever they do with it.
+	policyCopy := *policy
+	updated, err, code := hookFn(ctx, policy.TargetUserId, targetUsername, &policyCopy)
+	if err != nil {
+		return nil, status.Error(code, err.Error())
+	}
+	if updated == nil {
+		return policy, nil
+	}
+	// The hook decides policies, not which accounts are merged.
+	updated.SourceUserId = policy.SourceUserId
+	updated.TargetUserId = policy.TargetUserId
+	if updated.Storage == "" {
+		updated.Storage = policy.Storage
+	}
+	if updated.Leaderboard == "" {
+		updated.Leaderboard = policy.Leaderboard
+	}
+	if updated.Wallet == "" {
+		updated.Wallet = policy.Wallet
+	}
+	return updated, nil
+}
+
+// Move linked identities, friends, group memberships, storage objects, wallet balances and holds, and leaderboard
+// records from the source account into the target account, then delete the source account. Open trades of the source
+// account are cancelled first, returning their escrow. Everything happens in one transaction, storage indices, the
+// group index and group aggregates are updated once it commits.
+func AccountMerge(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, metrics Metrics, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, groupIndex GroupIndex, sessionRegistry SessionRegistry, sessionCache SessionCache, tracker Tracker, router MessageRouter, policy *AccountMergePolicy) error {
+	sourceID, err := uuid.FromString(policy.SourceUserId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Invalid source user ID.")
+	}
+	targetID, err := uuid.FromString(policy.TargetUserId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Invalid target user ID.")
+	}
+	if sourceID == uuid.Nil || targetID == uuid.Nil {
+		return status.Error(codes.InvalidArgument, "Cannot merge the system user.")
+	}
+	if sourceID == targetID {
+		return status.Error(codes.InvalidArgument, ErrAccountMergeSame.Error())
+	}
+	if err = policy.validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Rank cache changes are only applied once the transaction commits.
+	var rankChanges []func()
+	var trades []*Trade
+	var groupIDs []uuid.UUID
+	var storageChanges *accountMergeStorageChanges
+	tradeChanges := &tradeStorageChanges{deleteReads: make(map[*StorageOpDelete]int32)}
+	err = ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		tradeChanges.deletes, tradeChanges.written = nil, nil
+		// Lock both accounts in a consistent order so concurrent merges can't deadlock.
+		var targetUsername string
+		rows, err := tx.Query(ctx, "SELECT id, username FROM users WHERE id = ANY($1::UUID[]) ORDER BY id FOR UPDATE", []uuid.UUID{sourceID, targetID})
+		if err != nil {
+			return err
+		}
+		var found int
+		for rows.Next() {
+			var id uuid.UUID
+			var username string
+			if err := rows.Scan(&id, &username); err != nil {
+				rows.Close()
+				return err
+			}
+			if id == targetID {
+				targetUsername = username
+			}
+			found++
+		}
+		rows.Close()
+		if found != 2 {
+			return StatusError(codes.NotFound, "Account not found.", ErrAccountNotFound)
+		}
+
+		steps := []struct {
+			name string
+			fn   func() error
+		}{
+			{"trades", func() error {
+				// Escrow is returned to the source account before its storage and wallet are merged.
+				cancelled, err := tradeCancelUser(ctx, logger, tx, metrics, storageCollections, tradeChanges, sourceID, false)
+				trades = cancelled
+				return err
+			}},
+			{"identities", func() error { return accountMergeIdentities(ctx, tx, sourceID, targetID) }},
+			{"friends", func() error { return accountMergeFriends(ctx, tx, sourceID, targetID) }},
+			{"groups", func() error {
+				ids, err := accountMergeGroups(ctx, tx, sourceID, targetID)
+				groupIDs = ids
+				return err
+			}},
+			{"storage", func() error {
+				changes, err := accountMergeStorage(ctx, tx, storageCollections, sourceID, targetID, policy.Storage)
+				storageChanges = changes
+				return err
+			}},
+			{"wallet", func() error { return accountMergeWallet(ctx, tx, sourceID, targetID, policy.Wallet) }},
+			{"wallet holds", func() error { return accountMergeWalletHolds(ctx, tx, sourceID, targetID) }},
+			{"leaderboard records", func() error {
+				changes, err := accountMergeLeaderboardRecords(ctx, tx, leaderboardCache, leaderboardRankCache, sourceID, targetID, targetUsername, policy.Leaderboard)
+				rankChanges = changes
+				return err
+			}},
+			{"purchases", func() error { return accountMergePurchases(ctx, tx, sourceID, targetID) }},
+		}
+		for _, step := range steps {
+			if err := step.fn(); err != nil {
+				logger.Debug("Could not merge account data.", zap.String("step", step.name), zap.Error(err), zap.String("source_user_id", sourceID.String()), zap.String("target_user_id", targetID.String()))
+				return err
+			}
+		}
+
+		// Anything left on the source account, such as its sessions and notifications, goes with it.
+		if _, err := DeleteUser(ctx, tx, sourceID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE users SET update_time = now() WHERE id = $1", targetID)
+		return err
+	})
+	if err != nil {
+		if e, ok := err.(*statusError); ok {
+			return e.Status()
+		}
+		logger.Error("Error merging accounts.", zap.Error(err), zap.String("source_user_id", sourceID.String()), zap.String("target_user_id", targetID.String()))
+		return status.Error(codes.Internal, "Error merging accounts.")
+	}
+
+	for _, change := range rankChanges {
+		change()
+	}
+	tradeChanges.publish(ctx, logger, storageIndex, tracker, router)
+	storageIndex.Delete(ctx, storageChanges.deletes)
+	storageIndex.Write(ctx, storageChanges.written)
+	accountMergeGroupsUpdate(ctx, logger, db, leaderboardCache, leaderboardRankCache, groupIndex, sourceID, targetID, groupIDs)
+	for _, trade := range trades {
+		tradeNotify(ctx, logger, db, tracker, router, sourceID, TradeActionCancel, trade)
+	}
+
+	// Logout and disconnect the source account.
+	if err := SessionLogout(config, sessionCache, sourceID, "", ""); err != nil {
+		return err
+	}
+	for _, presence := range tracker.ListPresenceIDByStream(PresenceStream{Mode: StreamModeNotifications, Subject: sourceID}) {
+		if err := sessionRegistry.Disconnect(ctx, presence.SessionID, false); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Accounts merged.", zap.String("source_user_id", sourceID.String()), zap.String("target_user_id", targetID.String()))
+	return nil
+}
+
+// Move each login identity the target account doesn't already have. Identity columns are unique, so they are cleared
+// on the source before being set on the target.
+func accountMergeIdentities(ctx context.Context, tx pgx.Tx, sourceID, targetID uuid.UUID) error {
+	query := `
+WITH source AS (
+	SELECT email, password, custom_id, facebook_id, facebook_instant_game_id, google_id, gamecenter_id, steam_id, apple_id
+	FROM users WHERE id = $1
+), cleared AS (
+	UPDATE users SET email = NULL, password = NULL, custom_id = NULL, facebook_id = NULL, facebook_instant_game_id = NULL,
+		google_id = NULL, gamecenter_id = NULL, steam_id = NULL, apple_id = NULL
+	WHERE id = $1
+	RETURNING id
+)
+SELECT email, password, custom_id, facebook_id, facebook_instant_game_id, google_id, gamecenter_id, steam_id, apple_id
+FROM source, cleared`
+	var email, customID, facebookID, facebookInstantGameID, googleID, gamecenterID, steamID, appleID sql.NullString
+	var password []byte
+	if err := tx.QueryRow(ctx, query, sourceID).Scan(&email, &password, &customID, &facebookID, &facebookInstantGameID, &googleID, &gamecenterID, &steamID, &appleID); err != nil {
+		return err
+	}
+
+	// The email and password only move together.
+	query = `
+UPDATE users SET
+	password = CASE WHEN email IS NULL AND $2::TEXT IS NOT NULL THEN $3 ELSE password END,
+	email = COALESCE(email, $2),
+	custom_id = COALESCE(custom_id, $4),
+	facebook_id = COALESCE(facebook_id, $5),
+	facebook_instant_game_id = COALESCE(facebook_instant_game_id, $6),
+	google_id = COALESCE(google_id, $7),
+	gamecenter_id = COALESCE(gamecenter_id, $8),
+	steam_id = COALESCE(steam_id, $9),
+	apple_id = COALESCE(apple_id, $10)
+WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, targetID, email, password, customID, facebookID, facebookInstantGameID, googleID, gamecenterID, steamID, appleID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE user_device SET user_id = $2 WHERE user_id = $1", sourceID, targetID); err != nil {
+		return err
+	}
+	query = `
+UPDATE user_identity SET user_id = $2, update_time = now()
+WHERE user_id = $1 AND provider NOT IN (SELECT provider FROM user_identity WHERE user_id = $2)`
+	_, err := tx.Exec(ctx, query, sourceID, targetID)
+	return err
+}
+
+// Move friend relationships. Where both accounts already have a relationship with the same user the target's is
+// kept, upgraded to a friendship if the source was friends with them.
+func accountMergeFriends(ctx context.Context, tx pgx.Tx, sourceID, targetID uuid.UUID) error {
+	edges := func(userID uuid.UUID) (map[uuid.UUID]int, map[uuid.UUID]int, error) {
+		rows, err := tx.Query(ctx, "SELECT source_id, destination_id, state FROM user_edge WHERE source_id = $1 OR destination_id = $1", userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+		outgoing, incoming := make(map[uuid.UUID]int), make(map[uuid.UUID]int)
+		for rows.Next() {
+			var src, dst uuid.UUID
+			var state int
+			if err := rows.Scan(&src, &dst, &state); err != nil {
+				return nil, nil, err
+			}
+			if src == userID {
+				outgoing[dst] = state
+			} else {
+				incoming[src] = state
+			}
+		}
+		return outgoing, incoming, rows.Err()
+	}
+	sourceOut, sourceIn, err := edges(sourceID)
+	if err != nil {
+		return err
+	}
+	targetOut, targetIn, err := edges(targetID)
+	if err != nil {
+		return err
+	}
+
+	others := make(map[uuid.UUID]struct{}, len(sourceOut)+len(sourceIn))
+	for id := range sourceOut {
+		others[id] = struct{}{}
+	}
+	for id := range sourceIn {
+		others[id] = struct{}{}
+	}
+	for otherID := range others {
+		if otherID == targetID {
+			continue
+		}
+		_, targetHasOut := targetOut[otherID]
+		_, targetHasIn := targetIn[otherID]
+		if !targetHasOut && !targetHasIn {
+			if _, ok := sourceOut[otherID]; ok {
+				if _, err := tx.Exec(ctx, "UPDATE user_edge SET source_id = $2 WHERE source_id = $1 AND destination_id = $3", sourceID, targetID, otherID); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, "UPDATE users SET edge_count = edge_count + 1 WHERE id = $1", targetID); err != nil {
+					return err
+				}
+			}
+			if _, ok := sourceIn[otherID]; ok {
+				if _, err := tx.Exec(ctx, "UPDATE user_edge SET destination_id = $2 WHERE source_id = $3 AND destination_id = $1", sourceID, targetID, otherID); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// Invites either way become a friendship if the source and the other user were already friends.
+		if state, ok := sourceOut[otherID]; ok && state == 0 && targetHasOut && targetHasIn && targetOut[otherID] != 3 && targetIn[otherID] != 3 {
+			if _, err := tx.Exec(ctx, "UPDATE user_edge SET state = 0, update_time = now() WHERE (source_id = $1 AND destination_id = $2) OR (source_id = $2 AND destination_id = $1)", targetID, otherID); err != nil {
+				return err
+			}
+		}
+		if _, ok := sourceIn[otherID]; ok {
+			if _, err := tx.Exec(ctx, "DELETE FROM user_edge WHERE source_id = $2 AND destination_id = $1", sourceID, otherID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "UPDATE users SET edge_count = edge_count - 1 WHERE id = $1", otherID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Relationships between the two accounts themselves are dropped.
+	if _, ok := targetOut[sourceID]; ok {
+		if _, err := tx.Exec(ctx, "DELETE FROM user_edge WHERE source_id = $1 AND destination_id = $2", targetID, sourceID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE users SET edge_count = edge_count - 1 WHERE id = $1", targetID); err != nil {
+			return err
+		}
+	}
+	// Remaining source edges are removed with the source account.
+	return nil
+}
+
+// Move group memberships. Where both accounts are in the same group the higher role is kept, a ban on either account
+// carries over, and the group's member count is adjusted. Returns the groups the source account belonged to.
+func accountMergeGroups(ctx context.Context, tx pgx.Tx, sourceID, targetID uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+SELECT s.source_id, s.state, t.state FROM group_edge s
+LEFT JOIN group_edge t ON t.source_id = s.source_id AND t.destination_id = $2
+WHERE s.destination_id = $1`
+	rows, err := tx.Query(ctx, query, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	type membership struct {
+		groupID     uuid.UUID
+		sourceState int
+		targetState sql.NullInt64
+	}
+	memberships := make([]*membership, 0, 5)
+	groupIDs := make([]uuid.UUID, 0, 5)
+	for rows.Next() {
+		m := &membership{}
+		if err := rows.Scan(&m.groupID, &m.sourceState, &m.targetState); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		memberships = append(memberships, m)
+		groupIDs = append(groupIDs, m.groupID)
+	}
+	rows.Close()
+
+	counted := func(state int) int {
+		// Superadmins, admins and members count towards the group's edge count.
+		if state <= 2 {
+			return 1
+		}
+		return 0
+	}
+	for _, m := range memberships {
+		if !m.targetState.Valid {
+			if _, err := tx.Exec(ctx, "UPDATE group_edge SET destination_id = $2 WHERE source_id = $3 AND destination_id = $1", sourceID, targetID, m.groupID); err != nil {
+				return nil, err
+			}
+			if _, err := tx.Exec(ctx, "UPDATE group_edge SET source_id = $2 WHERE source_id = $1 AND destination_id = $3", sourceID, targetID, m.groupID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		targetState := int(m.targetState.Int64)
+		state := targetState
+		switch {
+		case targetState == 4:
+		case m.sourceState == 4:
+			// A ban carries over, but never demotes the group's superadmin.
+			if targetState != 0 {
+				state = 4
+			}
+		case m.sourceState < targetState:
+			state = m.sourceState
+		}
+		if state != targetState {
+			if _, err := tx.Exec(ctx, "UPDATE group_edge SET state = $3, update_time = now() WHERE (source_id = $1 AND destination_id = $2) OR (source_id = $2 AND destination_id = $1)", targetID, m.groupID, state); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM group_edge WHERE (source_id = $1 AND destination_id = $2) OR (source_id = $2 AND destination_id = $1)", sourceID, m.groupID); err != nil {
+			return nil, err
+		}
+		if delta := counted(state) - counted(m.sourceState) - counted(targetState); delta != 0 {
+			if _, err := tx.Exec(ctx, "UPDATE groups SET edge_count = edge_count + $2, update_time = now() WHERE id = $1", m.groupID, delta); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, table := range []string{"group_role_member", "group_invite", "group_application"} {
+		query = "UPDATE " + table + " SET user_id = $2 WHERE user_id = $1 AND group_id NOT IN (SELECT group_id FROM " + table + " WHERE user_id = $2)"
+		if _, err := tx.Exec(ctx, query, sourceID, targetID); err != nil {
+			return nil, err
+		}
+	}
+	return groupIDs, nil
+}
+
+// Storage objects moved or removed by a merge, for storage indices to follow once it commits.
+type accountMergeStorageChanges struct {
+	deletes StorageOpDeletes
+	written []*api.StorageObject
+}
+
+// Move storage objects. Objects under the same collection and key are resolved by the policy, a replaced target
+// object is kept in history as with any other write, and the history of moved objects moves with them. Collections
+// with an object limit reject the merge if the target account would own too many objects.
+func accountMergeStorage(ctx context.Context, tx pgx.Tx, storageCollections StorageCollectionRegistry, sourceID, targetID uuid.UUID, policy string) (*accountMergeStorageChanges, error) {
+	if policy == AccountMergeStorageSource {
+		query := "SELECT t.collection, t.key FROM storage t JOIN storage s ON s.collection = t.collection AND s.key = t.key AND s.user_id = $1 WHERE t.user_id = $2"
+		rows, err := tx.Query(ctx, query, sourceID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		replaced := make([]*StorageOpWrite, 0)
+		for rows.Next() {
+			op := &StorageOpWrite{OwnerID: targetID.String(), Object: &api.WriteStorageObject{}}
+			if err := rows.Scan(&op.Object.Collection, &op.Object.Key); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			replaced = append(replaced, op)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		batch := &pgx.Batch{}
+		for _, op := range replaced {
+			if history := storageCollections.CollectionHistory(op.Object.Collection); history != nil {
+				storageHistoryPrepBatch(batch, history, op)
+			}
+		}
+		if batch.Len() > 0 {
+			if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+				return nil, err
+			}
+		}
+
+		query = "DELETE FROM storage t USING storage s WHERE t.user_id = $2 AND s.user_id = $1 AND s.collection = t.collection AND s.key = t.key"
+		if _, err := tx.Exec(ctx, query, sourceID, targetID); err != nil {
+			return nil, err
+		}
+	}
+
+	// History of objects the target account doesn't hold follows them, a version both accounts kept is kept once.
+	query := `
+DELETE FROM storage_history t USING storage_history s
+WHERE t.user_id = $2 AND s.user_id = $1 AND s.collection = t.collection AND s.key = t.key AND s.version = t.version
+AND NOT EXISTS (SELECT 1 FROM storage o WHERE o.user_id = $2 AND o.collection = s.collection AND o.key = s.key)`
+	if _, err := tx.Exec(ctx, query, sourceID, targetID); err != nil {
+		return nil, err
+	}
+	query = `
+UPDATE storage_history SET user_id = $2
+WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM storage o WHERE o.user_id = $2 AND o.collection = storage_history.collection AND o.key = storage_history.key)`
+	if _, err := tx.Exec(ctx, query, sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	query = `
+UPDATE storage SET user_id = $2, update_time = now()
+WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM storage t WHERE t.user_id = $2 AND t.collection = storage.collection AND t.key = storage.key)
+RETURNING collection, key, value, version, read, write, create_time, update_time`
+	rows, err := tx.Query(ctx, query, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	changes := &accountMergeStorageChanges{deletes: make(StorageOpDeletes, 0), written: make([]*api.StorageObject, 0)}
+	ops := make(StorageOpWrites, 0)
+	for rows.Next() {
+		o := &api.StorageObject{UserId: targetID.String()}
+		var createTime pgtype.Timestamptz
+		var updateTime pgtype.Timestamptz
+		if err := rows.Scan(&o.Collection, &o.Key, &o.Value, &o.Version, &o.PermissionRead, &o.PermissionWrite, &createTime, &updateTime); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		o.CreateTime = timestamppb.New(createTime.Time)
+		o.UpdateTime = timestamppb.New(updateTime.Time)
+		changes.written = append(changes.written, o)
+		changes.deletes = append(changes.deletes, &StorageOpDelete{OwnerID: sourceID.String(), ObjectID: &api.DeleteStorageObjectId{Collection: o.Collection, Key: o.Key}})
+		ops = append(ops, &StorageOpWrite{OwnerID: targetID.String(), Object: &api.WriteStorageObject{Collection: o.Collection, Key: o.Key}})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if rules := storageWriteRules(storageCollections, ops); len(rules) > 0 {
+		if err := storageCheckObjectCounts(ctx, tx, rules, ops); err != nil {
+			var validationErr *StorageValidationError
+			if errors.As(err, &validationErr) {
+				return nil, StatusError(codes.FailedPrecondition, validationErr.Error(), err)
+			}
+			return nil, err
+		}
+	}
+
+	// Objects left on the source account are removed with it.
+	rows, err = tx.Query(ctx, "SELECT collection, key FROM storage WHERE user_id = $1", sourceID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		objectID := &api.DeleteStorageObjectId{}
+		if err := rows.Scan(&objectID.Collection, &objectID.Key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changes.deletes = append(changes.deletes, &StorageOpDelete{OwnerID: sourceID.String(), ObjectID: objectID})
+	}
+	rows.Close()
+	return changes, rows.Err()
+}
+
+// Add the source wallet to the target wallet, recording the change in the target's wallet ledger.
+func accountMergeWallet(ctx context.Context, tx pgx.Tx, sourceID, targetID uuid.UUID, policy string) error {
+	if policy != AccountMergeWalletSum {
+		return nil
+	}
+
+	var sourceWallet string
+	if err := tx.QueryRow(ctx, "SELECT wallet FROM users WHERE id = $1", sourceID).Scan(&sourceWallet); err != nil {
+		return err
+	}
+	var changeset map[string]int64
+	if err := json.Unmarshal([]byte(sourceWallet), &changeset); err != nil {
+		return err
+	}
+	for k, v := range changeset {
+		if v == 0 {
+			delete(changeset, k)
+		}
+	}
+	if len(changeset) == 0 {
+		return nil
+	}
+
+	var targetWallet string
+	if err := tx.QueryRow(ctx, "SELECT wallet FROM users WHERE id = $1", targetID).Scan(&targetWallet); err != nil {
+		return err
+	}
+	var wallet map[string]int64
+	if err := json.Unmarshal([]byte(targetWallet), &wallet); err != nil {
+		return err
+	}
+	if wallet == nil {
+		wallet = make(map[string]int64, len(changeset))
+	}
+	for k, v := range changeset {
+		wallet[k] += v
+	}
+
+	walletData, err := json.Marshal(wallet)
+	if err != nil {
+		return err
+	}
+	changesetData, err := json.Marshal(changeset)
+	if err != nil {
+		return err
+	}
+	metadataData, err := json.Marshal(map[string]string{"merge_source_user_id": sourceID.String()})
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, "UPDATE users SET wallet = $2 WHERE id = $1", targetID, walletData); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO wallet_ledger (id, user_id, changeset, metadata) VALUES ($1, $2, $3, $4)", uuid.Must(uuid.NewV4()), targetID, changesetData, metadataData)
+	return err
+}
+
+// Move wallet holds whatever the wallet policy. Held amounts already left the source wallet, so open holds still
+// need to be captured or released by their ID, and a release or expiry returns the amounts to the target wallet.
+func accountMergeWalletHolds(ctx context.Context, tx pgx.Tx, sourceID, targetID uuid.UUID) error {
+	_, err := tx.Exec(ctx, "UPDATE wallet_hold SET user_id = $2 WHERE user_id = $1", sourceID, targetID)
+	return err
+}
+
+// Move leaderboard records, resolving records both accounts hold on the same leaderboard and period by the policy.
+// Returns the rank cache changes to apply once the merge is committed.
+func accountMergeLeaderboardRecords(ctx context.Context, tx pgx.Tx, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, sourceID, targetID uuid.UUID, targetUsername, policy string) ([]func(), error) {
+	query := `
+SELECT s.leaderboard_id, s.expiry_time, s.score, s.subscore, s.num_score, t.score, t.subscore
+FROM leaderboard_record s
+LEFT JOIN leaderboard_record t ON t.leaderboard_id = s.leaderboard_id AND t.expiry_time = s.expiry_time AND t.owner_id = $2
+WHERE s.owner_id = $1`
+	rows, err := tx.Query(ctx, query, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	type record struct {
+		leaderboardID  string
+		expiryTime     pgtype.Timestamptz
+		score          int64
+		subscore       int64
+		numScore       int32
+		targetScore    sql.NullInt64
+		targetSubscore sql.NullInt64
+	}
+	records := make([]*record, 0, 10)
+	for rows.Next() {
+		r := &record{}
+		if err := rows.Scan(&r.leaderboardID, &r.expiryTime, &r.score, &r.subscore, &r.numScore, &r.targetScore, &r.targetSubscore); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+
+	nowUnix := time.Now().UTC().Unix()
+	changes := make([]func(), 0, len(records))
+	for _, r := range records {
+		leaderboardID, expiryUnix := r.leaderboardID, r.expiryTime.Time.Unix()
+
+		move := true
+		if r.targetScore.Valid {
+			switch policy {
+			case AccountMergeLeaderboardTarget:
+				move = false
+			case AccountMergeLeaderboardBest:
+				sortOrder := LeaderboardSortOrderDescending
+				if leaderboard := leaderboardCache.Get(leaderboardID); leaderboard != nil {
+					sortOrder = leaderboard.SortOrder
+				}
+				better := r.score > r.targetScore.Int64 || (r.score == r.targetScore.Int64 && r.subscore > r.targetSubscore.Int64)
+				if sortOrder == LeaderboardSortOrderAscending {
+					better = r.score < r.targetScore.Int64 || (r.score == r.targetScore.Int64 && r.subscore < r.targetSubscore.Int64)
+				}
+				move = better
+			}
+		}
+
+		if !move {
+			if _, err := tx.Exec(ctx, "DELETE FROM leaderboard_record WHERE leaderboard_id = $1 AND expiry_time = $2 AND owner_id = $3", leaderboardID, r.expiryTime, sourceID); err != nil {
+				return nil, err
+			}
+		} else {
+			if r.targetScore.Valid {
+				if _, err := tx.Exec(ctx, "DELETE FROM leaderboard_record WHERE leaderboard_id = $1 AND expiry_time = $2 AND owner_id = $3", leaderboardID, r.expiryTime, targetID); err != nil {
+					return nil, err
+				}
+			}
+			query := "UPDATE leaderboard_record SET owner_id = $4, username = $5, update_time = now() WHERE leaderboard_id = $1 AND expiry_time = $2 AND owner_id = $3"
+			if _, err := tx.Exec(ctx, query, leaderboardID, r.expiryTime, sourceID, targetID, targetUsername); err != nil {
+				return nil, err
+			}
+		}
+
+		if expiryUnix != 0 && expiryUnix <= nowUnix {
+			// Expired ranks are handled by the rank cache itself.
+			continue
+		}
+		score, subscore, numScore := r.score, r.subscore, r.numScore
+		changes = append(changes, func() {
+			leaderboardRankCache.Delete(leaderboardID, expiryUnix, sourceID)
+			if !move {
+				return
+			}
+			if leaderboard := leaderboardCache.Get(leaderboardID); leaderboard != nil {
+				leaderboardRankCache.Insert(leaderboardID, leaderboard.SortOrder, score, subscore, numScore, expiryUnix, targetID)
+			}
+		})
+	}
+
+	// League memberships follow the records.
+	query = "UPDATE league_member SET owner_id = $2, update_time = now() WHERE owner_id = $1 AND league_id NOT IN (SELECT league_id FROM league_member WHERE owner_id = $2)"
+	if _, err := tx.Exec(ctx, query, sourceID, targetID); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Move purchases and subscriptions so entitlements follow the merged account.
+func accountMergePurchases(ctx context.Context, tx pgx.Tx, sourceID, targetID uuid.UUID) error {
+	for _, table := range []string{"purchase", "subscription"} {
+		if _, err := tx.Exec(ctx, "UPDATE "+table+" SET user_id = $2, update_time = now() WHERE user_id = $1", sourceID, targetID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Follow the merge in the group index and group aggregates. Groups the source account belonged to changed members, and
+// aggregates of every group the target account belongs to include the records it gained.
+func accountMergeGroupsUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, groupIndex GroupIndex, sourceID, targetID uuid.UUID, groupIDs []uuid.UUID) {
+	groupIndexRefresh(ctx, logger, db, groupIndex, groupIDs...)
+
+	if len(leaderboardCache.ListAllGroupAggregates()) == 0 {
+		return
+	}
+	updated := make(map[uuid.UUID]struct{}, len(groupIDs))
+	for _, groupID := range groupIDs {
+		updated[groupID] = struct{}{}
+	}
+	rows, err := db.QueryContext(ctx, "SELECT destination_id FROM group_edge WHERE source_id = $1 AND state >= 0 AND state <= 2", targetID)
+	if err != nil {
+		logger.Error("Error listing groups for aggregate update", zap.Error(err), zap.String("owner_id", targetID.String()))
+		return
+	}
+	for rows.Next() {
+		var groupID uuid.UUID
+		if err = rows.Scan(&groupID); err != nil {
+			_ = rows.Close()
+			logger.Error("Error parsing groups for aggregate update", zap.Error(err), zap.String("owner_id", targetID.String()))
+			return
+		}
+		updated[groupID] = struct{}{}
+	}
+	_ = rows.Close()
+
+	for groupID := range updated {
+		leaderboardGroupAggregatesGroupUpdate(ctx, logger, db, leaderboardCache, rankCache, groupID, []uuid.UUID{sourceID, targetID})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestAccountMergePolicyValidate(t *testing.T) {
+	policy := NewAccountMergePolicy(uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()))
+	assert.NoError(t, policy.validate())
+
+	policy.Leaderboard = "worst"
+	assert.Error(t, policy.validate())
+}
+
+func TestAccountMergeHook(t *testing.T) {
+	sourceID, targetID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	hookFn := func(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+		assert.Equal(t, targetID.String(), userID)
+		assert.Equal(t, "target", username)
+		assert.Equal(t, sourceID.String(), policy.SourceUserId)
+		// Attempts to change the merged accounts are ignored.
+		return &AccountMergePolicy{Storage: AccountMergeStorageSource, SourceUserId: uuid.Nil.String()}, nil, codes.OK
+	}
+	policy, err := accountMergeHook(context.Background(), hookFn, "target", NewAccountMergePolicy(sourceID, targetID))
+	assert.NoError(t, err)
+	assert.Equal(t, sourceID.String(), policy.SourceUserId)
+	assert.Equal(t, AccountMergeStorageSource, policy.Storage)
+	assert.Equal(t, AccountMergeLeaderboardBest, policy.Leaderboard)
+	assert.Equal(t, AccountMergeWalletSum, policy.Wallet)
+
+	keepFn := func(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+		return nil, nil, codes.OK
+	}
+	policy, err = accountMergeHook(context.Background(), keepFn, "target", NewAccountMergePolicy(sourceID, targetID))
+	assert.NoError(t, err)
+	assert.Equal(t, NewAccountMergePolicy(sourceID, targetID), policy)
+
+	rejectFn := func(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+		return nil, errors.New("merge not allowed"), codes.FailedPrecondition
+	}
+	_, err = accountMergeHook(context.Background(), rejectFn, "target", NewAccountMergePolicy(sourceID, targetID))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestAccountMergeWalletHolds(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	sourceID, targetID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, sourceID)
+	InsertUser(t, db, targetID)
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	lbRankCache := NewLocalLeaderboardRankCache(ctx, logger, db, cfg.GetLeaderboard(), lbCache)
+	_, err := UpdateWallets(ctx, logger, db, []*walletUpdate{{UserID: sourceID, Changeset: map[string]int64{"coins": 100}, Metadata: "{}"}}, false)
+	if err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+	hold, err := WalletHoldCreate(ctx, logger, db, cfg, sourceID, map[string]int64{"coins": 40}, nil, 0)
+	if err != nil {
+		t.Fatalf("error creating hold: %v", err)
+	}
+
+	policy := NewAccountMergePolicy(sourceID, targetID)
+	policy.Wallet = AccountMergeWalletTarget
+	err = AccountMerge(ctx, logger, db, cfg, metrics, lbCache, lbRankCache, storageIdx, storageCollections, groupIdx, NewLocalSessionRegistry(metrics), NewLocalSessionCache(3_600, 7_200), &LocalTracker{}, &DummyMessageRouter{}, policy)
+	if err != nil {
+		t.Fatalf("error merging accounts: %v", err)
+	}
+
+	// The open hold survives the source account and belongs to the target.
+	holds, err := WalletHoldsList(ctx, logger, db, targetID)
+	assert.NoError(t, err)
+	if assert.Len(t, holds, 1) {
+		assert.Equal(t, hold.Id, holds[0].Id)
+	}
+	released, err := WalletHoldRelease(ctx, logger, db, uuid.FromStringOrNil(hold.Id), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, targetID.String(), released.UserId)
+
+	account, err := GetAccount(ctx, logger, db, nil, targetID)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"coins":40}`, account.Wallet)
+}
+
+func TestAccountMergeStorage(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	collection, limited := GenerateString(), GenerateString()
+	storageIndex, err := NewLocalStorageIndex(logger, db, &StorageConfig{}, metrics)
+	require.NoError(t, err)
+	storageCollections, err := NewLocalStorageCollectionRegistry(logger, &StorageConfig{
+		CollectionRules: []*StorageCollectionRulesConfig{{Collection: limited, MaxObjectsPerUser: 1}},
+		History:         []*StorageHistoryConfig{{Collection: collection, MaxVersions: 5}},
+	})
+	require.NoError(t, err)
+	indexName := GenerateString()
+	require.NoError(t, storageIndex.CreateIndex(ctx, indexName, collection, "", []string{"v"}, 10, false))
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	lbRankCache := NewLocalLeaderboardRankCache(ctx, logger, db, cfg.GetLeaderboard(), lbCache)
+
+	write := func(userID uuid.UUID, collection, key, value string) {
+		ops := StorageOpWrites{{OwnerID: userID.String(), Object: &api.WriteStorageObject{Collection: collection, Key: key, Value: value, PermissionRead: wrapperspb.Int32(2)}}}
+		_, _, err := StorageWriteObjects(ctx, logger, db, metrics, storageIndex, storageCollections, nil, nil, true, ops)
+		require.NoError(t, err)
+	}
+	merge := func(policy *AccountMergePolicy) error {
+		return AccountMerge(ctx, logger, db, cfg, metrics, lbCache, lbRankCache, storageIndex, storageCollections, groupIdx, NewLocalSessionRegistry(metrics), NewLocalSessionCache(3_600, 7_200), &LocalTracker{}, &DummyMessageRouter{}, policy)
+	}
+
+	sourceID, targetID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, sourceID)
+	InsertUser(t, db, targetID)
+	write(sourceID, collection, "shared", `{"v":"source"}`)
+	write(sourceID, collection, "moved", `{"v":"moved"}`)
+	write(targetID, collection, "shared", `{"v":"target"}`)
+
+	policy := NewAccountMergePolicy(sourceID, targetID)
+	policy.Storage = AccountMergeStorageSource
+	require.NoError(t, merge(policy))
+
+	// The storage index follows the objects to the target account.
+	entries, err := storageIndex.List(ctx, uuid.Nil, indexName, "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries.Objects, 2)
+	values := make(map[string]string, 2)
+	for _, o := range entries.Objects {
+		assert.Equal(t, targetID.String(), o.UserId)
+		values[o.Key] = o.Value
+	}
+	assert.JSONEq(t, `{"v":"source"}`, values["shared"])
+	assert.JSONEq(t, `{"v":"moved"}`, values["moved"])
+
+	// The replaced target object is kept in history.
+	history, err := StorageHistoryList(ctx, logger, db, collection, "shared", targetID, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.JSONEq(t, `{"v":"target"}`, history[0].Value)
+
+	// A merge leaving the target over a collection's object limit is rejected.
+	sourceID, targetID = uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, sourceID)
+	InsertUser(t, db, targetID)
+	write(sourceID, limited, "a", `{}`)
+	write(targetID, limited, "b", `{}`)
+	err = merge(NewAccountMergePolicy(sourceID, targetID))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	var exists bool
+	require.NoError(t, db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", sourceID).Scan(&exists))
+	assert.True(t, exists)
+}
+
+func TestAccountMergeGroupAggregates(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	lbRankCache := NewLocalLeaderboardRankCache(ctx, logger, db, cfg.GetLeaderboard(), lbCache)
+
+	sourceId := uuid.Must(uuid.NewV4()).String()
+	_, _, err := lbCache.Create(ctx, sourceId, false, LeaderboardSortOrderDescending, LeaderboardOperatorBest, "", "")
+	require.NoError(t, err)
+	aggregateId := uuid.Must(uuid.NewV4()).String()
+	_, _, err = LeaderboardGroupAggregateCreate(ctx, logger, db, lbCache, lbRankCache, aggregateId, sourceId, LeaderboardAggregateOperatorSum, "")
+	require.NoError(t, err)
+
+	sourceID, targetID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, sourceID)
+	InsertUser(t, db, targetID)
+	group, err := CreateGroup(ctx, logger, db, groupIdx, targetID, targetID, uuid.Must(uuid.NewV4()).String(), "en", "", "", "", true, 10)
+	require.NoError(t, err)
+	groupID := uuid.FromStringOrNil(group.Id)
+	_, err = LeaderboardRecordWrite(ctx, logger, db, lbCache, lbRankCache, uuid.Nil, sourceId, sourceID.String(), sourceID.String(), 5, 0, "", api.Operator_NO_OVERRIDE)
+	require.NoError(t, err)
+	_, _, found := leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.False(t, found)
+
+	// The record the target account gains counts towards its groups.
+	err = AccountMerge(ctx, logger, db, cfg, metrics, lbCache, lbRankCache, storageIdx, storageCollections, groupIdx, NewLocalSessionRegistry(metrics), NewLocalSessionCache(3_600, 7_200), &LocalTracker{}, &DummyMessageRouter{}, NewAccountMergePolicy(sourceID, targetID))
+	require.NoError(t, err)
+	score, _, found := leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.True(t, found)
+	assert.EqualValues(t, 5, score)
+}
@@ -30,13 +30,12 @@ import (
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgtype"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func AuthenticateApple(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, bundleId, token, username string, create bool) (string, string, bool, error) {
+func AuthenticateApple(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, namePolicy NamePolicy, bundleId, token, username string, create bool) (string, string, bool, error) {
 	profile, err := client.CheckAppleToken(ctx, bundleId, token)
 	if err != nil {
 		logger.Info("Could not authenticate Apple profile.", zap.Error(err))
@@ -75,6 +74,11 @@ func AuthenticateApple(ctx context.Context, logger *zap.Logger, db *sql.DB, clie
 		return "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 	query = "INSERT INTO users (id, username, email, apple_id, create_time, update_time) VALUES ($1, $2, nullif($3, ''), $4, now(), now())"
@@ -117,7 +121,7 @@ func AuthenticateApple(ctx context.Context, logger *zap.Logger, db *sql.DB, clie
 	return userID, username, true, nil
 }
 
-func AuthenticateCustom(ctx context.Context, logger *zap.Logger, db *sql.DB, customID, username string, create bool) (string, string, bool, error) {
+func AuthenticateCustom(ctx context.Context, logger *zap.Logger, db *sql.DB, namePolicy NamePolicy, customID, username string, create bool) (string, string, bool, error) {
 	found := true
 
 	// Look for an existing account.
@@ -151,6 +155,11 @@ func AuthenticateCustom(ctx context.Context, logger *zap.Logger, db *sql.DB, cus
 		return "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 	query = "INSERT INTO users (id, username, custom_id, create_time, update_time) VALUES ($1, $2, $3, now(), now())"
@@ -179,7 +188,7 @@ func AuthenticateCustom(ctx context.Context, logger *zap.Logger, db *sql.DB, cus
 	return userID, username, true, nil
 }
 
-func AuthenticateDevice(ctx context.Context, logger *zap.Logger, db *sql.DB, deviceID, username string, create bool) (string, string, bool, error) {
+func AuthenticateDevice(ctx context.Context, logger *zap.Logger, db *sql.DB, namePolicy NamePolicy, deviceID, username string, create bool) (string, string, bool, error) {
 	found := true
 
 	// Look for an existing account.
@@ -221,6 +230,11 @@ func AuthenticateDevice(ctx context.Context, logger *zap.Logger, db *sql.DB, dev
 		return "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 
@@ -281,7 +295,7 @@ WHERE NOT EXISTS
 	return userID, username, true, nil
 }
 
-func AuthenticateEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, email, password, username string, create bool) (string, string, bool, error) {
+func AuthenticateEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, namePolicy NamePolicy, email, password, username string, create bool) (string, string, bool, error) {
 	found := true
 
 	// Look for an existing account.
@@ -309,10 +323,13 @@ func AuthenticateEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, emai
 		}
 
 		// Check if password matches.
-		err = bcrypt.CompareHashAndPassword(dbPassword, []byte(password))
-		if err != nil {
+		match, rehash := ComparePassword(config, dbPassword, password)
+		if !match {
 			return "", "", false, status.Error(codes.Unauthenticated, "Invalid credentials.")
 		}
+		if rehash {
+			rehashPassword(ctx, logger, db, config, "users", dbUserID, dbPassword, password)
+		}
 
 		return dbUserID, dbUsername, false, nil
 	}
@@ -322,9 +339,14 @@ func AuthenticateEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, emai
 		return "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(config, password)
 	if err != nil {
 		logger.Error("Error hashing password.", zap.Error(err), zap.String("email", email), zap.String("username", username), zap.Bool("create", create))
 		return "", "", false, status.Error(codes.Internal, "Error finding or creating user account.")
@@ -355,7 +377,7 @@ func AuthenticateEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, emai
 	return userID, username, true, nil
 }
 
-func AuthenticateUsername(ctx context.Context, logger *zap.Logger, db *sql.DB, username, password string) (string, error) {
+func AuthenticateUsername(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, username, password string) (string, error) {
 	// Look for an existing account.
 	query := "SELECT id, password, disable_time FROM users WHERE username = $1"
 	var dbUserID string
@@ -384,15 +406,18 @@ func AuthenticateUsername(ctx context.Context, logger *zap.Logger, db *sql.DB, u
 	}
 
 	// Check if password matches.
-	err = bcrypt.CompareHashAndPassword(dbPassword, []byte(password))
-	if err != nil {
+	match, rehash := ComparePassword(config, dbPassword, password)
+	if !match {
 		return "", status.Error(codes.Unauthenticated, "Invalid credentials.")
 	}
+	if rehash {
+		rehashPassword(ctx, logger, db, config, "users", dbUserID, dbPassword, password)
+	}
 
 	return dbUserID, nil
 }
 
-func AuthenticateFacebook(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, appId, accessToken, username string, create bool) (string, string, bool, bool, error) {
+func AuthenticateFacebook(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, namePolicy NamePolicy, appId, accessToken, username string, create bool) (string, string, bool, bool, error) {
 	var facebookProfile *social.FacebookProfile
 	var err error
 	var importFriendsPossible bool
@@ -441,6 +466,11 @@ func AuthenticateFacebook(ctx context.Context, logger *zap.Logger, db *sql.DB, c
 		return "", "", false, false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 	query = "INSERT INTO users (id, username, display_name, avatar_url, facebook_id, create_time, update_time) VALUES ($1, $2, $3, $4, $5, now(), now())"
@@ -483,7 +513,7 @@ func AuthenticateFacebook(ctx context.Context, logger *zap.Logger, db *sql.DB, c
 	return userID, username, true, importFriendsPossible, nil
 }
 
-func AuthenticateFacebookInstantGame(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, appSecret string, signedPlayerInfo string, username string, create bool) (string, string, bool, error) {
+func AuthenticateFacebookInstantGame(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, namePolicy NamePolicy, appSecret string, signedPlayerInfo string, username string, create bool) (string, string, bool, error) {
 	facebookInstantGameID, err := client.ExtractFacebookInstantGameID(signedPlayerInfo, appSecret)
 	if err != nil {
 		logger.Error("Error extracting the Facebook Instant Game player ID or validating the signature", zap.Error(err), zap.String("signedPlayerInfo", signedPlayerInfo))
@@ -522,6 +552,11 @@ func AuthenticateFacebookInstantGame(ctx context.Context, logger *zap.Logger, db
 		return "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 	query = "INSERT INTO users (id, username, facebook_instant_game_id, create_time, update_time) VALUES ($1, $2, $3, now(), now())"
@@ -550,7 +585,7 @@ func AuthenticateFacebookInstantGame(ctx context.Context, logger *zap.Logger, db
 	return userID, username, true, nil
 }
 
-func AuthenticateGameCenter(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, playerID, bundleID string, timestamp int64, salt, signature, publicKeyUrl, username string, create bool) (string, string, bool, error) {
+func AuthenticateGameCenter(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, namePolicy NamePolicy, playerID, bundleID string, timestamp int64, salt, signature, publicKeyUrl, username string, create bool) (string, string, bool, error) {
 	valid, err := client.CheckGameCenterID(ctx, playerID, bundleID, timestamp, salt, signature, publicKeyUrl)
 	if !valid || err != nil {
 		logger.Info("Could not authenticate GameCenter profile.", zap.Error(err), zap.Bool("valid", valid))
@@ -589,6 +624,11 @@ func AuthenticateGameCenter(ctx context.Context, logger *zap.Logger, db *sql.DB,
 		return "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 	query = "INSERT INTO users (id, username, gamecenter_id, create_time, update_time) VALUES ($1, $2, $3, now(), now())"
@@ -626,7 +666,7 @@ func RemapGoogleId(ctx context.Context, logger *zap.Logger, db *sql.DB, googlePr
 	return err
 }
 
-func AuthenticateGoogle(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, idToken, username string, create bool) (string, string, bool, error) {
+func AuthenticateGoogle(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, namePolicy NamePolicy, idToken, username string, create bool) (string, string, bool, error) {
 	googleProfile, err := client.CheckGoogleToken(ctx, idToken)
 	if err != nil {
 		logger.Info("Could not authenticate Google profile.", zap.Error(err))
@@ -716,6 +756,11 @@ func AuthenticateGoogle(ctx context.Context, logger *zap.Logger, db *sql.DB, cli
 		return "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 	query = "INSERT INTO users (id, username, google_id, display_name, avatar_url, create_time, update_time) VALUES ($1, $2, $3, $4, $5, now(), now())"
@@ -758,7 +803,7 @@ func AuthenticateGoogle(ctx context.Context, logger *zap.Logger, db *sql.DB, cli
 	return userID, username, true, nil
 }
 
-func AuthenticateSteam(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, appID int, publisherKey, token, username string, create bool) (string, string, string, bool, error) {
+func AuthenticateSteam(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, namePolicy NamePolicy, appID int, publisherKey, token, username string, create bool) (string, string, string, bool, error) {
 	steamProfile, err := client.GetSteamProfile(ctx, publisherKey, appID, token)
 	if err != nil {
 		logger.Info("Could not authenticate Steam profile.", zap.Error(err))
@@ -798,6 +843,11 @@ func AuthenticateSteam(ctx context.Context, logger *zap.Logger, db *sql.DB, clie
 		return "", "", "", false, status.Error(codes.NotFound, "User account not found.")
 	}
 
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", "", false, err
+	}
+
 	// Create a new account.
 	userID := uuid.Must(uuid.NewV4()).String()
 	query = "INSERT INTO users (id, username, steam_id, create_time, update_time) VALUES ($1, $2, $3, now(), now())"
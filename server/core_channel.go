@@ -449,6 +449,40 @@ func ChannelMessageRemove(ctx context.Context, logger *zap.Logger, db *sql.DB, r
 	return ack, nil
 }
 
+// Resolve the original sender of a group channel message when the caller may remove it on their behalf. Group
+// superadmins and admins may moderate the group channel, as may members whose role grants the chat permission.
+func channelGroupMessageModerateSender(ctx context.Context, logger *zap.Logger, db *sql.DB, channelStream PresenceStream, messageId string, caller uuid.UUID) (string, string, bool, error) {
+	if channelStream.Mode != StreamModeGroup {
+		return "", "", false, nil
+	}
+
+	var senderId string
+	var senderUsername string
+	query := "SELECT sender_id, username FROM message WHERE id = $1 AND stream_mode = $2 AND stream_subject = $3::UUID"
+	if err := db.QueryRowContext(ctx, query, messageId, channelStream.Mode, channelStream.Subject).Scan(&senderId, &senderUsername); err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", false, nil
+		}
+		logger.Error("Error looking up group channel message sender", zap.Error(err))
+		return "", "", false, err
+	}
+	if senderId == caller.String() {
+		return "", "", false, nil
+	}
+
+	allowed, err := groupCheckUserPermission(ctx, logger, db, channelStream.Subject, caller, 1)
+	if err != nil {
+		return "", "", false, err
+	}
+	if !allowed {
+		if allowed, err = groupCheckUserRolePermission(ctx, logger, db, channelStream.Subject, caller, GroupPermissionChat); err != nil {
+			return "", "", false, err
+		}
+	}
+
+	return senderId, senderUsername, allowed, nil
+}
+
 func GetChannelMessages(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID) ([]*api.ChannelMessage, error) {
 	query := "SELECT id, code, username, stream_mode, stream_subject, stream_descriptor, stream_label, content, create_time, update_time FROM message WHERE sender_id = $1::UUID"
 	rows, err := db.QueryContext(ctx, query, userID)
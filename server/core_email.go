@@ -0,0 +1,355 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama/v3/mail"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	emailTokenPurposeVerify = iota
+	emailTokenPurposeReset
+	emailTokenPurposeChange
+)
+
+var emailTokenPurposeNames = map[int]string{
+	emailTokenPurposeVerify: "verify_email",
+	emailTokenPurposeReset:  "reset_password",
+	emailTokenPurposeChange: "change_email",
+}
+
+// EmailTemplateRequest is passed to the runtime email template function, with the purpose "verify_email",
+// "reset_password" or "change_email", the recipient address, and the token and its expiry time in seconds since the
+// Unix epoch.
+type EmailTemplateRequest struct {
+	Purpose    string `json:"purpose"`
+	Email      string `json:"email"`
+	Token      string `json:"token"`
+	ExpiryTime int64  `json:"expiry_time"`
+}
+
+// EmailTemplate is the content rendered by the runtime email template function. The HTML body is optional.
+type EmailTemplate struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Html    string `json:"html"`
+}
+
+// Send a verification token to the user's current email address. Confirming it marks the account as verified.
+func EmailVerificationRequest(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, mailProvider mail.Provider, templateFn RuntimeEmailTemplateFunction, userID uuid.UUID) error {
+	if mailProvider == nil {
+		return status.Error(codes.FailedPrecondition, "Email delivery is not configured.")
+	}
+
+	var username string
+	var email sql.NullString
+	var verifyTime pgtype.Timestamptz
+	err := db.QueryRowContext(ctx, "SELECT username, email, verify_time FROM users WHERE id = $1", userID).Scan(&username, &email, &verifyTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return status.Error(codes.NotFound, "User account not found.")
+		}
+		logger.Error("Error looking up user email.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error requesting email verification.")
+	}
+	if !email.Valid || email.String == "" {
+		return status.Error(codes.FailedPrecondition, "Account has no email address.")
+	}
+	if verifyTime.Status == pgtype.Present && verifyTime.Time.Unix() != 0 {
+		return status.Error(codes.FailedPrecondition, "Email address is already verified.")
+	}
+
+	token, expiry, err := emailTokenIssue(ctx, logger, db, userID, emailTokenPurposeVerify, email.String, config.GetMail().VerificationTokenExpirySec)
+	if err != nil {
+		return err
+	}
+	return emailSend(ctx, logger, mailProvider, templateFn, userID, username, emailTokenPurposeVerify, email.String, token, expiry)
+}
+
+// Mark the account the verification token was issued for as verified.
+func EmailVerificationConfirm(ctx context.Context, logger *zap.Logger, db *sql.DB, token string) (uuid.UUID, error) {
+	userID, email, err := emailTokenConsume(ctx, logger, db, emailTokenPurposeVerify, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// The token only proves ownership of the address it was sent to.
+	res, err := db.ExecContext(ctx, "UPDATE users SET verify_time = now(), update_time = now() WHERE id = $1 AND email = $2", userID, email)
+	if err != nil {
+		logger.Error("Error marking email verified.", zap.Error(err), zap.String("user_id", userID.String()))
+		return uuid.Nil, status.Error(codes.Internal, "Error confirming email verification.")
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected != 1 {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "Token invalid or expired.")
+	}
+	return userID, nil
+}
+
+// Send a password reset token to an email address. Requests for addresses without an account succeed without sending
+// anything, so the response does not reveal which addresses are registered.
+func PasswordResetRequest(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, mailProvider mail.Provider, templateFn RuntimeEmailTemplateFunction, email string) error {
+	if mailProvider == nil {
+		return status.Error(codes.FailedPrecondition, "Email delivery is not configured.")
+	}
+	if err := validateEmail(email); err != nil {
+		return err
+	}
+	cleanEmail := strings.ToLower(email)
+
+	var userID uuid.UUID
+	var username string
+	var disableTime pgtype.Timestamptz
+	err := db.QueryRowContext(ctx, "SELECT id, username, disable_time FROM users WHERE email = $1", cleanEmail).Scan(&userID, &username, &disableTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		logger.Error("Error looking up user by email.", zap.Error(err))
+		return status.Error(codes.Internal, "Error requesting password reset.")
+	}
+	if disableTime.Status == pgtype.Present && disableTime.Time.Unix() != 0 {
+		logger.Info("Password reset requested for disabled account.", zap.String("user_id", userID.String()))
+		return nil
+	}
+
+	token, expiry, err := emailTokenIssue(ctx, logger, db, userID, emailTokenPurposeReset, cleanEmail, config.GetMail().ResetTokenExpirySec)
+	if err != nil {
+		return err
+	}
+	return emailSend(ctx, logger, mailProvider, templateFn, userID, username, emailTokenPurposeReset, cleanEmail, token, expiry)
+}
+
+// Set a new password using a password reset token, and sign the account out of all existing sessions.
+func PasswordReset(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, sessionCache SessionCache, token, password string) (uuid.UUID, error) {
+	if len(password) < 8 {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "Password must be at least 8 characters long.")
+	}
+
+	userID, email, err := emailTokenConsume(ctx, logger, db, emailTokenPurposeReset, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	hashedPassword, err := HashPassword(config, password)
+	if err != nil {
+		logger.Error("Error hashing password.", zap.Error(err))
+		return uuid.Nil, status.Error(codes.Internal, "Error resetting password.")
+	}
+
+	// Receiving the reset token also proves ownership of the email address.
+	res, err := db.ExecContext(ctx, "UPDATE users SET password = $3, verify_time = now(), update_time = now() WHERE id = $1 AND email = $2", userID, email, hashedPassword)
+	if err != nil {
+		logger.Error("Error resetting password.", zap.Error(err), zap.String("user_id", userID.String()))
+		return uuid.Nil, status.Error(codes.Internal, "Error resetting password.")
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected != 1 {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "Token invalid or expired.")
+	}
+
+	sessionCache.RemoveAll(userID)
+	return userID, nil
+}
+
+// Send a token to a new email address. The account's email is only changed once the token is confirmed.
+func EmailChangeRequest(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, mailProvider mail.Provider, templateFn RuntimeEmailTemplateFunction, userID uuid.UUID, email string) error {
+	if mailProvider == nil {
+		return status.Error(codes.FailedPrecondition, "Email delivery is not configured.")
+	}
+	if err := validateEmail(email); err != nil {
+		return err
+	}
+	cleanEmail := strings.ToLower(email)
+
+	var username string
+	var inUse bool
+	query := "SELECT username, EXISTS (SELECT id FROM users WHERE email = $2 AND NOT id = $1) FROM users WHERE id = $1"
+	if err := db.QueryRowContext(ctx, query, userID, cleanEmail).Scan(&username, &inUse); err != nil {
+		if err == sql.ErrNoRows {
+			return status.Error(codes.NotFound, "User account not found.")
+		}
+		logger.Error("Error looking up user email.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error requesting email change.")
+	}
+	if inUse {
+		return status.Error(codes.AlreadyExists, "Email is already in use.")
+	}
+
+	token, expiry, err := emailTokenIssue(ctx, logger, db, userID, emailTokenPurposeChange, cleanEmail, config.GetMail().VerificationTokenExpirySec)
+	if err != nil {
+		return err
+	}
+	return emailSend(ctx, logger, mailProvider, templateFn, userID, username, emailTokenPurposeChange, cleanEmail, token, expiry)
+}
+
+// Change the account's email to the address the token was sent to, which is then verified.
+func EmailChangeConfirm(ctx context.Context, logger *zap.Logger, db *sql.DB, token string) (uuid.UUID, error) {
+	userID, email, err := emailTokenConsume(ctx, logger, db, emailTokenPurposeChange, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if _, err = db.ExecContext(ctx, "UPDATE users SET email = $2, verify_time = now(), update_time = now() WHERE id = $1", userID, email); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == dbErrorUniqueViolation {
+			return uuid.Nil, status.Error(codes.AlreadyExists, "Email is already in use.")
+		}
+		logger.Error("Error changing email.", zap.Error(err), zap.String("user_id", userID.String()))
+		return uuid.Nil, status.Error(codes.Internal, "Error confirming email change.")
+	}
+	return userID, nil
+}
+
+func validateEmail(email string) error {
+	if email == "" {
+		return status.Error(codes.InvalidArgument, "Email address is required.")
+	} else if invalidCharsRegex.MatchString(email) {
+		return status.Error(codes.InvalidArgument, "Invalid email address, no spaces or control characters allowed.")
+	} else if !emailRegex.MatchString(email) {
+		return status.Error(codes.InvalidArgument, "Invalid email address format.")
+	} else if len(email) < 10 || len(email) > 255 {
+		return status.Error(codes.InvalidArgument, "Invalid email address, must be 10-255 bytes.")
+	}
+	return nil
+}
+
+// Issue a new token, replacing any earlier token for the same user and purpose. Only a hash of the token is stored.
+func emailTokenIssue(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, purpose int, email string, expirySec int64) (string, time.Time, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		logger.Error("Error generating email token.", zap.Error(err))
+		return "", time.Time{}, status.Error(codes.Internal, "Error generating token.")
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+	expiry := time.Now().UTC().Add(time.Duration(expirySec) * time.Second)
+
+	if err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM user_email_token WHERE user_id = $1 AND purpose = $2", userID, purpose); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO user_email_token (id, user_id, purpose, email, expiry_time) VALUES ($1, $2, $3, $4, $5)", emailTokenHash(token), userID, purpose, email, expiry)
+		return err
+	}); err != nil {
+		logger.Error("Error storing email token.", zap.Error(err), zap.String("user_id", userID.String()))
+		return "", time.Time{}, status.Error(codes.Internal, "Error generating token.")
+	}
+
+	return token, expiry, nil
+}
+
+// Consume a token so it cannot be used again, returning the user and email address it was issued for.
+func emailTokenConsume(ctx context.Context, logger *zap.Logger, db *sql.DB, purpose int, token string) (uuid.UUID, string, error) {
+	if token == "" {
+		return uuid.Nil, "", status.Error(codes.InvalidArgument, "Token is required.")
+	}
+
+	var userID uuid.UUID
+	var email string
+	var expiryTime pgtype.Timestamptz
+	query := "DELETE FROM user_email_token WHERE id = $1 AND purpose = $2 RETURNING user_id, email, expiry_time"
+	if err := db.QueryRowContext(ctx, query, emailTokenHash(token), purpose).Scan(&userID, &email, &expiryTime); err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, "", status.Error(codes.InvalidArgument, "Token invalid or expired.")
+		}
+		logger.Error("Error consuming email token.", zap.Error(err))
+		return uuid.Nil, "", status.Error(codes.Internal, "Error checking token.")
+	}
+	if !expiryTime.Time.After(time.Now()) {
+		return uuid.Nil, "", status.Error(codes.InvalidArgument, "Token invalid or expired.")
+	}
+
+	return userID, email, nil
+}
+
+func emailTokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func emailSend(ctx context.Context, logger *zap.Logger, mailProvider mail.Provider, templateFn RuntimeEmailTemplateFunction, userID uuid.UUID, username string, purpose int, email, token string, expiry time.Time) error {
+	message, err := emailTemplate(ctx, templateFn, userID, username, purpose, email, token, expiry)
+	if err != nil {
+		logger.Error("Error rendering email template.", zap.Error(err), zap.String("purpose", emailTokenPurposeNames[purpose]))
+		return status.Error(codes.Internal, "Error sending email.")
+	}
+
+	if err = mailProvider.Send(ctx, message); err != nil {
+		logger.Error("Error sending email.", zap.Error(err), zap.String("purpose", emailTokenPurposeNames[purpose]), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error sending email.")
+	}
+	return nil
+}
+
+// Render an email with the built-in templates, then let the runtime template function, if any, override the subject and
+// bodies. Fields the function leaves empty keep their built-in content.
+func emailTemplate(ctx context.Context, templateFn RuntimeEmailTemplateFunction, userID uuid.UUID, username string, purpose int, email, token string, expiry time.Time) (*mail.Message, error) {
+	expiryText := expiry.UTC().Format(time.RFC1123)
+	message := &mail.Message{To: email}
+	switch purpose {
+	case emailTokenPurposeVerify:
+		message.Subject = "Verify your email address"
+		message.Body = fmt.Sprintf("Use this code to verify your email address:\n\n%s\n\nThe code expires at %s.\n", token, expiryText)
+	case emailTokenPurposeReset:
+		message.Subject = "Reset your password"
+		message.Body = fmt.Sprintf("Use this code to reset your password:\n\n%s\n\nThe code expires at %s. If you did not request a password reset you can ignore this email.\n", token, expiryText)
+	case emailTokenPurposeChange:
+		message.Subject = "Confirm your new email address"
+		message.Body = fmt.Sprintf("Use this code to confirm your new email address:\n\n%s\n\nThe code expires at %s. If you did not request this change you can ignore this email.\n", token, expiryText)
+	default:
+		return nil, fmt.Errorf("unknown email purpose: %v", purpose)
+	}
+
+	if templateFn == nil {
+		return message, nil
+	}
+
+	rendered, err := templateFn(ctx, userID.String(), username, &EmailTemplateRequest{
+		Purpose:    emailTokenPurposeNames[purpose],
+		Email:      email,
+		Token:      token,
+		ExpiryTime: expiry.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rendered == nil {
+		return message, nil
+	}
+	if rendered.Subject != "" {
+		message.Subject = rendered.Subject
+	}
+	if rendered.Body != "" {
+		message.Body = rendered.Body
+	}
+	message.HTML = rendered.Html
+
+	return message, nil
+}
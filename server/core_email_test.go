@@ -0,0 +1,109 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama/v3/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEmailSend(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.Must(uuid.NewV4())
+	expiry := time.Now().Add(time.Hour)
+
+	t.Run("built-in template", func(t *testing.T) {
+		provider := mail.NewFakeProvider()
+		err := emailSend(ctx, logger, provider, nil, userID, "player", emailTokenPurposeReset, "player@example.com", "token123", expiry)
+		assert.NoError(t, err)
+
+		messages := provider.Messages()
+		if assert.Len(t, messages, 1) {
+			assert.Equal(t, "player@example.com", messages[0].To)
+			assert.Equal(t, "Reset your password", messages[0].Subject)
+			assert.True(t, strings.Contains(messages[0].Body, "token123"))
+			assert.Equal(t, "", messages[0].HTML)
+		}
+	})
+
+	t.Run("template function", func(t *testing.T) {
+		var request *EmailTemplateRequest
+		var requestUserID, requestUsername string
+		templateFn := func(ctx context.Context, userID, username string, r *EmailTemplateRequest) (*EmailTemplate, error) {
+			request, requestUserID, requestUsername = r, userID, username
+			return &EmailTemplate{Subject: "Welcome!", Html: `<a href="https://example.com/verify?t=` + r.Token + `">Verify</a>`}, nil
+		}
+
+		provider := mail.NewFakeProvider()
+		err := emailSend(ctx, logger, provider, templateFn, userID, "player", emailTokenPurposeVerify, "player@example.com", "token456", expiry)
+		assert.NoError(t, err)
+
+		assert.Equal(t, userID.String(), requestUserID)
+		assert.Equal(t, "player", requestUsername)
+		require.NotNil(t, request)
+		assert.Equal(t, "verify_email", request.Purpose)
+		assert.Equal(t, "player@example.com", request.Email)
+		assert.Equal(t, expiry.Unix(), request.ExpiryTime)
+
+		messages := provider.Messages()
+		if assert.Len(t, messages, 1) {
+			assert.Equal(t, "Welcome!", messages[0].Subject)
+			// The body was not overridden, so the built-in one is kept.
+			assert.True(t, strings.Contains(messages[0].Body, "token456"))
+			assert.Equal(t, `<a href="https://example.com/verify?t=token456">Verify</a>`, messages[0].HTML)
+		}
+	})
+
+	t.Run("template function error", func(t *testing.T) {
+		templateFn := func(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error) {
+			return nil, errors.New("template error")
+		}
+
+		provider := mail.NewFakeProvider()
+		err := emailSend(ctx, logger, provider, templateFn, userID, "player", emailTokenPurposeChange, "new@example.com", "token789", expiry)
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Len(t, provider.Messages(), 0)
+	})
+
+	t.Run("template function without result", func(t *testing.T) {
+		templateFn := func(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error) {
+			return nil, nil
+		}
+
+		provider := mail.NewFakeProvider()
+		err := emailSend(ctx, logger, provider, templateFn, userID, "player", emailTokenPurposeReset, "player@example.com", "token321", expiry)
+		assert.NoError(t, err)
+		if messages := provider.Messages(); assert.Len(t, messages, 1) {
+			assert.Equal(t, "Reset your password", messages[0].Subject)
+		}
+	})
+
+	t.Run("delivery error", func(t *testing.T) {
+		provider := mail.NewFakeProvider()
+		provider.SetError(errors.New("smtp unavailable"))
+		err := emailSend(ctx, logger, provider, nil, userID, "player", emailTokenPurposeVerify, "player@example.com", "token", expiry)
+		assert.Equal(t, codes.Internal, status.Code(err))
+	})
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -54,6 +55,7 @@ type groupListCursor struct {
 	Open       bool
 	Name       string
 	UpdateTime int64
+	Offset     int
 }
 
 func (c *groupListCursor) GetState() int {
@@ -66,7 +68,7 @@ func (c *groupListCursor) GetUpdateTime() time.Time {
 	return time.Unix(0, c.UpdateTime)
 }
 
-func CreateGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, creatorID uuid.UUID, name, lang, desc, avatarURL, metadata string, open bool, maxCount int) (*api.Group, error) {
+func CreateGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, groupIndex GroupIndex, userID uuid.UUID, creatorID uuid.UUID, name, lang, desc, avatarURL, metadata string, open bool, maxCount int) (*api.Group, error) {
 	if userID == uuid.Nil {
 		return nil, runtime.ErrGroupCreatorInvalid
 	}
@@ -141,18 +143,30 @@ RETURNING id, creator_id, name, description, avatar_url, state, edge_count, lang
 		return nil, err
 	}
 
+	if groupIndex != nil {
+		groupIndex.Write(ctx, []*api.Group{group})
+	}
+
 	logger.Info("Group created.", zap.String("group_id", group.Id), zap.String("user_id", userID.String()))
 
 	return group, nil
 }
 
-func UpdateGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID uuid.UUID, userID uuid.UUID, creatorID uuid.UUID, name, lang, desc, avatar, metadata *wrapperspb.StringValue, open *wrapperspb.BoolValue, maxCount int) error {
+func UpdateGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, groupIndex GroupIndex, groupID uuid.UUID, userID uuid.UUID, creatorID uuid.UUID, name, lang, desc, avatar, metadata *wrapperspb.StringValue, open *wrapperspb.BoolValue, maxCount int) error {
 	if userID != uuid.Nil {
 		allowedUser, err := groupCheckUserPermission(ctx, logger, db, groupID, userID, 1)
 		if err != nil {
 			return err
 		}
 
+		if !allowedUser && name == nil && metadata == nil && open == nil && maxCount <= 0 && creatorID == uuid.Nil {
+			// Members with a role granting the edit permission may change the group's presentation only.
+			allowedUser, err = groupCheckUserRolePermission(ctx, logger, db, groupID, userID, GroupPermissionEdit)
+			if err != nil {
+				return err
+			}
+		}
+
 		if !allowedUser {
 			logger.Info("User does not have permission to update group.", zap.String("group", groupID.String()), zap.String("user", userID.String()))
 			return runtime.ErrGroupPermissionDenied
@@ -248,12 +262,14 @@ func UpdateGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID uu
 		return runtime.ErrGroupNotUpdated
 	}
 
+	groupIndexRefresh(ctx, logger, db, groupIndex, groupID)
+
 	logger.Info("Group updated.", zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
 
 	return nil
 }
 
-func DeleteGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID uuid.UUID, userID uuid.UUID) error {
+func DeleteGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, groupIndex GroupIndex, groupID uuid.UUID, userID uuid.UUID) error {
 	if userID != uuid.Nil {
 		// only super-admins can delete group.
 		allowedUser, err := groupCheckUserPermission(ctx, logger, db, groupID, userID, 0)
@@ -267,19 +283,25 @@ func DeleteGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID uu
 		}
 	}
 
-	if err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+	if err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
 		return deleteGroup(ctx, logger, tx, groupID)
 	}); err != nil {
 		logger.Error("Error deleting group.", zap.Error(err))
 		return err
 	}
 
+	leaderboardGroupAggregatesGroupDelete(ctx, logger, db, leaderboardCache, rankCache, groupID)
+
+	if groupIndex != nil {
+		groupIndex.Delete(ctx, []uuid.UUID{groupID})
+	}
+
 	logger.Info("Group deleted.", zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
 
 	return nil
 }
 
-func JoinGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, groupID uuid.UUID, userID uuid.UUID, username string) error {
+func JoinGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, tracker Tracker, router MessageRouter, groupID uuid.UUID, userID uuid.UUID, username, application string) error {
 	query := `
 SELECT id, creator_id, name, description, avatar_url, state, edge_count, lang_tag, max_count, metadata, create_time, update_time
 FROM groups
@@ -323,9 +345,19 @@ WHERE (id = $1) AND (disable_time = '1970-01-01 00:00:00 UTC')`
 			return err
 		}
 
+		notificationContentMap := map[string]string{"group_id": groupID.String(), "username": username}
+		if application != "" {
+			if err = groupApplicationUpsert(ctx, db, groupID, userID, application); err != nil {
+				// Errors here will not cause the join operation to fail.
+				logger.Error("Could not store group join request application.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+			} else {
+				notificationContentMap["application"] = application
+			}
+		}
+
 		// If it's a private group notify superadmins/admins that someone has requested to join.
 		// Prepare notification data.
-		notificationContentBytes, err := json.Marshal(map[string]string{"group_id": groupID.String(), "username": username})
+		notificationContentBytes, err := json.Marshal(notificationContentMap)
 		if err != nil {
 			logger.Error("Could not encode notification content.", zap.Error(err))
 		} else {
@@ -424,6 +456,11 @@ WHERE (id = $1) AND (disable_time = '1970-01-01 00:00:00 UTC')`
 			return runtime.ErrGroupFull
 		}
 
+		if err = groupInviteRemoveUser(ctx, tx, groupID, userID); err != nil {
+			logger.Debug("Could not remove group invite.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+			return err
+		}
+
 		query = `INSERT INTO message (id, code, sender_id, username, stream_mode, stream_subject, stream_descriptor, stream_label, content, create_time, update_time)
 VALUES ($1, $2, $3, $4, $5, $6::UUID, $7::UUID, $8, $9, $10, $10)`
 		if _, err = tx.ExecContext(ctx, query, message.MessageId, message.Code.Value, message.SenderId, message.Username, stream.Mode, stream.Subject, stream.Subcontext, stream.Label, message.Content, time.Unix(message.CreateTime.Seconds, 0).UTC()); err != nil {
@@ -445,11 +482,13 @@ VALUES ($1, $2, $3, $4, $5, $6::UUID, $7::UUID, $8, $9, $10, $10)`
 
 	router.SendToStream(logger, stream, &rtapi.Envelope{Message: &rtapi.Envelope_ChannelMessage{ChannelMessage: message}}, true)
 
+	leaderboardGroupAggregatesGroupUpdate(ctx, logger, db, leaderboardCache, rankCache, groupID, []uuid.UUID{userID})
+
 	logger.Info("Successfully joined group.", zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
 	return nil
 }
 
-func LeaveGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, streamManager StreamManager, groupID uuid.UUID, userID uuid.UUID, username string) error {
+func LeaveGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, tracker Tracker, router MessageRouter, streamManager StreamManager, groupID uuid.UUID, userID uuid.UUID, username string) error {
 	var myState sql.NullInt64
 	query := "SELECT state FROM group_edge WHERE source_id = $1::UUID AND destination_id = $2::UUID"
 	if err := db.QueryRowContext(ctx, query, groupID, userID).Scan(&myState); err != nil {
@@ -514,6 +553,16 @@ func LeaveGroup(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tra
 			return err
 		}
 
+		if err = groupRoleRemoveUser(ctx, tx, groupID, userID); err != nil {
+			logger.Debug("Could not remove group role assignment.", zap.Error(err))
+			return err
+		}
+
+		if err = groupInviteRemoveUser(ctx, tx, groupID, userID); err != nil {
+			logger.Debug("Could not remove group invite.", zap.Error(err))
+			return err
+		}
+
 		// check to ensure we are not decrementing the count when the relationship was an invite.
 		if myState.Int64 < 3 {
 			query = "UPDATE groups SET edge_count = edge_count - 1, update_time = now() WHERE (id = $1::UUID) AND (disable_time = '1970-01-01 00:00:00 UTC')"
@@ -560,11 +609,13 @@ VALUES ($1, $2, $3, $4, $5, $6::UUID, $7::UUID, $8, $9, $10, $10)`
 		}
 	}
 
+	leaderboardGroupAggregatesGroupUpdate(ctx, logger, db, leaderboardCache, rankCache, groupID, []uuid.UUID{userID})
+
 	logger.Info("Successfully left group.", zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
 	return nil
 }
 
-func AddGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, caller uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID) error {
+func AddGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, tracker Tracker, router MessageRouter, caller uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID) error {
 	if caller != uuid.Nil {
 		var dbState sql.NullInt64
 		query := "SELECT state FROM group_edge WHERE source_id = $1::UUID AND destination_id = $2::UUID"
@@ -578,8 +629,14 @@ func AddGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker
 		}
 
 		if dbState.Int64 > 1 {
-			logger.Info("Cannot add users as user does not have correct permissions.", zap.String("group_id", groupID.String()), zap.String("user_id", caller.String()), zap.Int64("state", dbState.Int64))
-			return runtime.ErrGroupPermissionDenied
+			allowed, err := groupCheckUserRolePermission(ctx, logger, db, groupID, caller, GroupPermissionInvite)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				logger.Info("Cannot add users as user does not have correct permissions.", zap.String("group_id", groupID.String()), zap.String("user_id", caller.String()), zap.Int64("state", dbState.Int64))
+				return runtime.ErrGroupPermissionDenied
+			}
 		}
 	}
 
@@ -684,6 +741,11 @@ func AddGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker
 				continue
 			}
 
+			if err := groupInviteRemoveUser(ctx, tx, groupID, uid); err != nil {
+				logger.Debug("Could not remove group invite.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", uid.String()))
+				return err
+			}
+
 			message := &api.ChannelMessage{
 				ChannelId:  channelID,
 				MessageId:  uuid.Must(uuid.NewV4()).String(),
@@ -732,10 +794,12 @@ VALUES ($1, $2, $3, $4, $5, $6::UUID, $7::UUID, $8, $9, $10, $10)`
 		_ = NotificationSend(ctx, logger, db, tracker, router, notifications)
 	}
 
+	leaderboardGroupAggregatesGroupUpdate(ctx, logger, db, leaderboardCache, rankCache, groupID, userIDs)
+
 	return nil
 }
 
-func BanGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, streamManager StreamManager, caller uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID) error {
+func BanGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, tracker Tracker, router MessageRouter, streamManager StreamManager, caller uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID) error {
 	myState := 0
 	if caller != uuid.Nil {
 		var dbState sql.NullInt64
@@ -830,6 +894,16 @@ RETURNING state`
 				return err
 			}
 
+			if err := groupRoleRemoveUser(ctx, tx, groupID, uid); err != nil {
+				logger.Debug("Could not remove group role assignment.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", uid.String()))
+				return err
+			}
+
+			if err := groupInviteRemoveUser(ctx, tx, groupID, uid); err != nil {
+				logger.Debug("Could not remove group invite.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", uid.String()))
+				return err
+			}
+
 			query = `
 INSERT INTO group_edge (position, state, source_id, destination_id) VALUES ($1, $2, $3, $4)
 ON CONFLICT (source_id, state, position) DO
@@ -904,10 +978,12 @@ VALUES ($1, $2, $3, $4, $5, $6::UUID, $7::UUID, $8, $9, $10, $10)`
 		}
 	}
 
+	leaderboardGroupAggregatesGroupUpdate(ctx, logger, db, leaderboardCache, rankCache, groupID, userIDs)
+
 	return nil
 }
 
-func KickGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, streamManager StreamManager, caller uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID, strictError bool) error {
+func KickGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, tracker Tracker, router MessageRouter, streamManager StreamManager, caller uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID, strictError bool) error {
 	myState := 0
 	if caller != uuid.Nil {
 		var dbState sql.NullInt64
@@ -923,8 +999,16 @@ func KickGroupUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker
 
 		myState = int(dbState.Int64)
 		if myState > 1 {
-			logger.Info("Cannot kick users as user does not have correct permissions.", zap.String("group_id", groupID.String()), zap.String("user_id", caller.String()), zap.Int("state", myState))
-			return runtime.ErrGroupPermissionDenied
+			allowed, err := groupCheckUserRolePermission(ctx, logger, db, groupID, caller, GroupPermissionKick)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				logger.Info("Cannot kick users as user does not have correct permissions.", zap.String("group_id", groupID.String()), zap.String("user_id", caller.String()), zap.Int("state", myState))
+				return runtime.ErrGroupPermissionDenied
+			}
+			// Kick with the same reach as an admin.
+			myState = 1
 		}
 	}
 
@@ -1017,6 +1101,16 @@ RETURNING state`
 				}
 			}
 
+			if err := groupRoleRemoveUser(ctx, tx, groupID, uid); err != nil {
+				logger.Debug("Could not remove group role assignment.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", uid.String()))
+				return err
+			}
+
+			if err := groupInviteRemoveUser(ctx, tx, groupID, uid); err != nil {
+				logger.Debug("Could not remove group invite.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", uid.String()))
+				return err
+			}
+
 			// Only update group edge count and send messages when we kicked valid members, not invites.
 			if deletedState.Int64 < 3 {
 				query = "UPDATE groups SET edge_count = edge_count - 1, update_time = now() WHERE id = $1::UUID"
@@ -1080,6 +1174,8 @@ VALUES ($1, $2, $3, $4, $5, $6::UUID, $7::UUID, $8, $9, $10, $10)`
 		}
 	}
 
+	leaderboardGroupAggregatesGroupUpdate(ctx, logger, db, leaderboardCache, rankCache, groupID, userIDs)
+
 	return nil
 }
 
@@ -1649,8 +1745,8 @@ WHERE disable_time = '1970-01-01 00:00:00 UTC' AND id = ANY($1)`
 	return groups, nil
 }
 
-func ListGroups(ctx context.Context, logger *zap.Logger, db *sql.DB, name, langTag string, open *bool, edgeCount, limit int, cursorStr string) (*api.GroupList, error) {
-	if name != "" && (langTag != "" || open != nil || edgeCount > -1) {
+func ListGroups(ctx context.Context, logger *zap.Logger, db *sql.DB, groupIndex GroupIndex, name, langTag, search string, open *bool, edgeCount, limit int, cursorStr string) (*api.GroupList, error) {
+	if name != "" && (langTag != "" || search != "" || open != nil || edgeCount > -1) {
 		return nil, StatusError(codes.InvalidArgument, "name filter cannot be combined with any other filter", nil)
 	}
 
@@ -1672,6 +1768,10 @@ func ListGroups(ctx context.Context, logger *zap.Logger, db *sql.DB, name, langT
 		}
 	}
 
+	if search != "" {
+		return listGroupsIndexed(ctx, logger, db, groupIndex, search, langTag, open, edgeCount, limit, cursor)
+	}
+
 	var query string
 	params := []interface{}{limit + 1}
 	switch {
@@ -2000,24 +2100,21 @@ func groupCheckUserPermission(ctx context.Context, logger *zap.Logger, db *sql.D
 	return dbState <= state, nil
 }
 
-func deleteGroup(ctx context.Context, logger *zap.Logger, tx *sql.Tx, groupID uuid.UUID) error {
+func deleteGroup(ctx context.Context, logger *zap.Logger, tx pgx.Tx, groupID uuid.UUID) error {
 	query := "DELETE FROM groups WHERE id = $1::UUID"
-	res, err := tx.ExecContext(ctx, query, groupID)
+	res, err := tx.Exec(ctx, query, groupID)
 	if err != nil {
 		logger.Debug("Could not delete group.", zap.Error(err))
 		return err
 	}
 
-	if rowsAffected, err := res.RowsAffected(); err != nil {
-		logger.Debug("Could not count deleted groups.", zap.Error(err))
-		return err
-	} else if rowsAffected == 0 {
-		logger.Info("Did not delete group as group with given ID does not exist.", zap.Error(err), zap.String("group_id", groupID.String()))
+	if res.RowsAffected() == 0 {
+		logger.Info("Did not delete group as group with given ID does not exist.", zap.String("group_id", groupID.String()))
 		return nil
 	}
 
 	query = "DELETE FROM group_edge WHERE source_id = $1::UUID OR destination_id = $1::UUID"
-	if _, err = tx.ExecContext(ctx, query, groupID); err != nil {
+	if _, err = tx.Exec(ctx, query, groupID); err != nil {
 		logger.Debug("Could not delete group_edge relationships.", zap.Error(err))
 		return err
 	}
@@ -2025,7 +2122,7 @@ func deleteGroup(ctx context.Context, logger *zap.Logger, tx *sql.Tx, groupID uu
 	return nil
 }
 
-func deleteRelationship(ctx context.Context, logger *zap.Logger, tx *sql.Tx, userID uuid.UUID, groupID uuid.UUID) error {
+func deleteRelationship(ctx context.Context, logger *zap.Logger, tx pgx.Tx, userID uuid.UUID, groupID uuid.UUID) error {
 	query := `
 DELETE FROM group_edge
 WHERE
@@ -2038,8 +2135,8 @@ RETURNING state`
 
 	var deletedState sql.NullInt64
 	logger.Debug("Removing relationship from group.", zap.String("query", query), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
-	if err := tx.QueryRowContext(ctx, query, userID, groupID).Scan(&deletedState); err != nil {
-		if err != sql.ErrNoRows {
+	if err := tx.QueryRow(ctx, query, userID, groupID).Scan(&deletedState); err != nil {
+		if err != pgx.ErrNoRows {
 			logger.Debug("Could not delete relationship from group_edge.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
 			return err
 		}
@@ -2047,7 +2144,7 @@ RETURNING state`
 
 	if deletedState.Int64 < 3 {
 		query = "UPDATE groups SET edge_count = edge_count - 1, update_time = now() WHERE id = $1::UUID"
-		_, err := tx.ExecContext(ctx, query, groupID)
+		_, err := tx.Exec(ctx, query, groupID)
 		if err != nil {
 			logger.Debug("Could not update group edge_count.", zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
 			return err
@@ -2057,16 +2154,18 @@ RETURNING state`
 	return nil
 }
 
-func GroupDeleteAll(ctx context.Context, logger *zap.Logger, tx *sql.Tx, userID uuid.UUID) error {
+// GroupDeleteAll removes the user from all their groups, deleting groups left without a superadmin. Returns the IDs of
+// the groups affected, deleted or not, to update the group index with once committed.
+func GroupDeleteAll(ctx context.Context, logger *zap.Logger, tx pgx.Tx, userID uuid.UUID) ([]uuid.UUID, error) {
 	query := `
 SELECT id, edge_count, group_edge.state FROM groups
 JOIN group_edge ON (group_edge.source_id = id)
 WHERE group_edge.destination_id = $1`
 
-	rows, err := tx.QueryContext(ctx, query, userID)
+	rows, err := tx.Query(ctx, query, userID)
 	if err != nil {
 		logger.Debug("Could not list groups for a user.", zap.Error(err), zap.String("user_id", userID.String()))
-		return err
+		return nil, err
 	}
 
 	deleteGroupsAndRelationships := make([]uuid.UUID, 0, 5)
@@ -2079,9 +2178,9 @@ WHERE group_edge.destination_id = $1`
 		var userState sql.NullInt64
 
 		if err := rows.Scan(&id, &edgeCount, &userState); err != nil {
-			_ = rows.Close()
+			rows.Close()
 			logger.Error("Could not parse rows when listing groups for a user.", zap.Error(err), zap.String("user_id", userID.String()))
-			return err
+			return nil, err
 		}
 
 		groupID := uuid.Must(uuid.FromString(id))
@@ -2095,15 +2194,15 @@ WHERE group_edge.destination_id = $1`
 			deleteRelationships = append(deleteRelationships, groupID)
 		}
 	}
-	_ = rows.Close()
+	rows.Close()
 
 	countOtherSuperadminsQuery := "SELECT COUNT(source_id) FROM group_edge WHERE source_id = $1 AND destination_id != $2 AND state = 0"
 	for _, g := range checkForOtherSuperadmins {
 		var otherSuperadminCount sql.NullInt64
-		err := tx.QueryRowContext(ctx, countOtherSuperadminsQuery, g, userID).Scan(&otherSuperadminCount)
+		err := tx.QueryRow(ctx, countOtherSuperadminsQuery, g, userID).Scan(&otherSuperadminCount)
 		if err != nil {
 			logger.Error("Could not parse rows when listing other superadmins.", zap.Error(err), zap.String("group_id", g.String()), zap.String("user_id", userID.String()))
-			return err
+			return nil, err
 		}
 
 		if otherSuperadminCount.Int64 == 0 {
@@ -2115,18 +2214,18 @@ WHERE group_edge.destination_id = $1`
 
 	for _, g := range deleteGroupsAndRelationships {
 		if err := deleteGroup(ctx, logger, tx, g); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	for _, g := range deleteRelationships {
 		err := deleteRelationship(ctx, logger, tx, userID, g)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return append(deleteGroupsAndRelationships, deleteRelationships...), nil
 }
 
 func GetRandomGroups(ctx context.Context, logger *zap.Logger, db *sql.DB, count int) ([]*api.Group, error) {
@@ -0,0 +1,362 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const groupInviteDefaultExpirySec = 7 * 24 * 60 * 60
+
+var ErrGroupInviteNotFound = errors.New("group invite not found or expired")
+
+type GroupInvite struct {
+	GroupId    string `json:"group_id"`
+	UserId     string `json:"user_id"`
+	InviterId  string `json:"inviter_id"`
+	ExpiryTime int64  `json:"expiry_time"`
+	CreateTime int64  `json:"create_time"`
+}
+
+type GroupApplication struct {
+	GroupId    string `json:"group_id"`
+	UserId     string `json:"user_id"`
+	Metadata   string `json:"metadata"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// GroupInviteUsers invites users to join a group, regardless of whether the group is open. Invites expire after the given
+// number of seconds, or a week if not set. Users who already have a relationship with the group, including pending join
+// requests and bans, are skipped.
+func GroupInviteUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, caller, groupID uuid.UUID, userIDs []uuid.UUID, expirySec int) error {
+	if caller != uuid.Nil {
+		allowed, err := groupCheckUserPermission(ctx, logger, db, groupID, caller, 1)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			if allowed, err = groupCheckUserRolePermission(ctx, logger, db, groupID, caller, GroupPermissionInvite); err != nil {
+				return err
+			}
+		}
+		if !allowed {
+			logger.Info("Cannot invite users as user does not have correct permissions.", zap.String("group_id", groupID.String()), zap.String("user_id", caller.String()))
+			return runtime.ErrGroupPermissionDenied
+		}
+	}
+
+	var groupName string
+	query := "SELECT name FROM groups WHERE id = $1 AND disable_time = '1970-01-01 00:00:00 UTC'"
+	if err := db.QueryRowContext(ctx, query, groupID).Scan(&groupName); err != nil {
+		if err == sql.ErrNoRows {
+			return runtime.ErrGroupNotFound
+		}
+		logger.Error("Could not look up group when inviting users.", zap.Error(err), zap.String("group_id", groupID.String()))
+		return err
+	}
+
+	if expirySec <= 0 {
+		expirySec = groupInviteDefaultExpirySec
+	}
+	expiryTime := time.Now().UTC().Add(time.Duration(expirySec) * time.Second)
+
+	notificationContentBytes, err := json.Marshal(map[string]interface{}{"group_id": groupID.String(), "name": groupName, "expiry_time": expiryTime.Unix()})
+	if err != nil {
+		logger.Error("Could not encode notification content.", zap.Error(err))
+		return err
+	}
+	notificationContent := string(notificationContentBytes)
+	notificationSubject := fmt.Sprintf("You've been invited to join group %v", groupName)
+
+	notifications := make(map[uuid.UUID][]*api.Notification, len(userIDs))
+	query = `
+INSERT INTO group_invite (group_id, user_id, inviter_id, expiry_time)
+SELECT $1, id, $3, $4 FROM users
+WHERE id = $2 AND NOT EXISTS (SELECT 1 FROM group_edge WHERE source_id = $1 AND destination_id = $2)
+ON CONFLICT (group_id, user_id) DO UPDATE SET inviter_id = $3, expiry_time = $4, create_time = now()`
+	for _, userID := range userIDs {
+		if userID == caller {
+			continue
+		}
+
+		res, err := db.ExecContext(ctx, query, groupID, userID, caller, expiryTime)
+		if err != nil {
+			logger.Error("Could not invite user to group.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+			return err
+		}
+		if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+			// User does not exist, or already has a relationship with the group.
+			continue
+		}
+
+		notifications[userID] = []*api.Notification{{
+			Id:         uuid.Must(uuid.NewV4()).String(),
+			Subject:    notificationSubject,
+			Content:    notificationContent,
+			SenderId:   caller.String(),
+			Code:       NotificationCodeGroupInvite,
+			Persistent: true,
+			CreateTime: &timestamppb.Timestamp{Seconds: time.Now().UTC().Unix()},
+		}}
+	}
+
+	if len(notifications) > 0 {
+		// Any error is already logged before it's returned here.
+		_ = NotificationSend(ctx, logger, db, tracker, router, notifications)
+	}
+
+	return nil
+}
+
+// GroupInviteAccept adds the user to the group if they hold an invite that has not expired.
+func GroupInviteAccept(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, tracker Tracker, router MessageRouter, groupID, userID uuid.UUID, username string) error {
+	inviterID, err := groupInviteGet(ctx, logger, db, groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Invites bypass the group's open state, so the user is added authoritatively.
+	if err = AddGroupUsers(ctx, logger, db, leaderboardCache, rankCache, tracker, router, uuid.Nil, groupID, []uuid.UUID{userID}); err != nil {
+		return err
+	}
+
+	groupInviteNotifyInviter(ctx, logger, db, tracker, router, groupID, userID, username, inviterID, NotificationCodeGroupInviteAccept, fmt.Sprintf("%v accepted your group invite", username))
+
+	return nil
+}
+
+// GroupInviteReject discards the user's invite to the group.
+func GroupInviteReject(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, groupID, userID uuid.UUID, username string) error {
+	inviterID, err := groupInviteGet(ctx, logger, db, groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = db.ExecContext(ctx, "DELETE FROM group_invite WHERE group_id = $1 AND user_id = $2", groupID, userID); err != nil {
+		logger.Error("Could not delete group invite.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+		return err
+	}
+
+	groupInviteNotifyInviter(ctx, logger, db, tracker, router, groupID, userID, username, inviterID, NotificationCodeGroupInviteReject, fmt.Sprintf("%v rejected your group invite", username))
+
+	return nil
+}
+
+// GroupInvitesList returns the user's pending invites that have not expired.
+func GroupInvitesList(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID) ([]*GroupInvite, error) {
+	query := `
+SELECT gi.group_id, gi.inviter_id, gi.expiry_time, gi.create_time
+FROM group_invite gi
+JOIN groups g ON g.id = gi.group_id
+WHERE gi.user_id = $1 AND gi.expiry_time > now() AND g.disable_time = '1970-01-01 00:00:00 UTC'
+ORDER BY gi.create_time DESC`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		logger.Error("Could not list group invites.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := make([]*GroupInvite, 0, 10)
+	for rows.Next() {
+		var groupID uuid.UUID
+		var inviterID uuid.UUID
+		var expiryTime pgtype.Timestamptz
+		var createTime pgtype.Timestamptz
+		if err = rows.Scan(&groupID, &inviterID, &expiryTime, &createTime); err != nil {
+			logger.Error("Could not parse group invites.", zap.Error(err), zap.String("user_id", userID.String()))
+			return nil, err
+		}
+		invites = append(invites, &GroupInvite{
+			GroupId:    groupID.String(),
+			UserId:     userID.String(),
+			InviterId:  inviterID.String(),
+			ExpiryTime: expiryTime.Time.Unix(),
+			CreateTime: createTime.Time.Unix(),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Could not list group invites.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// GroupApplicationsList returns the application metadata submitted with pending join requests to the group. Only
+// admins, and members whose role grants the invite permission, may read applications.
+func GroupApplicationsList(ctx context.Context, logger *zap.Logger, db *sql.DB, caller, groupID uuid.UUID) ([]*GroupApplication, error) {
+	if caller != uuid.Nil {
+		allowed, err := groupCheckUserPermission(ctx, logger, db, groupID, caller, 1)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			if allowed, err = groupCheckUserRolePermission(ctx, logger, db, groupID, caller, GroupPermissionInvite); err != nil {
+				return nil, err
+			}
+		}
+		if !allowed {
+			return nil, runtime.ErrGroupPermissionDenied
+		}
+	}
+
+	query := `
+SELECT ga.user_id, ga.metadata, ga.create_time
+FROM group_application ga
+JOIN group_edge ge ON ge.source_id = ga.group_id AND ge.destination_id = ga.user_id
+WHERE ga.group_id = $1 AND ge.state = 3
+ORDER BY ga.create_time ASC`
+	rows, err := db.QueryContext(ctx, query, groupID)
+	if err != nil {
+		logger.Error("Could not list group applications.", zap.Error(err), zap.String("group_id", groupID.String()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	applications := make([]*GroupApplication, 0, 10)
+	for rows.Next() {
+		var userID uuid.UUID
+		var metadata string
+		var createTime pgtype.Timestamptz
+		if err = rows.Scan(&userID, &metadata, &createTime); err != nil {
+			logger.Error("Could not parse group applications.", zap.Error(err), zap.String("group_id", groupID.String()))
+			return nil, err
+		}
+		applications = append(applications, &GroupApplication{
+			GroupId:    groupID.String(),
+			UserId:     userID.String(),
+			Metadata:   metadata,
+			CreateTime: createTime.Time.Unix(),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Could not list group applications.", zap.Error(err), zap.String("group_id", groupID.String()))
+		return nil, err
+	}
+
+	return applications, nil
+}
+
+func groupInviteGet(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID, userID uuid.UUID) (uuid.UUID, error) {
+	var inviterID uuid.UUID
+	query := `
+SELECT gi.inviter_id FROM group_invite gi
+JOIN groups g ON g.id = gi.group_id
+WHERE gi.group_id = $1 AND gi.user_id = $2 AND gi.expiry_time > now() AND g.disable_time = '1970-01-01 00:00:00 UTC'`
+	if err := db.QueryRowContext(ctx, query, groupID, userID).Scan(&inviterID); err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, ErrGroupInviteNotFound
+		}
+		logger.Error("Could not look up group invite.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+		return uuid.Nil, err
+	}
+	return inviterID, nil
+}
+
+func groupInviteNotifyInviter(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, groupID, userID uuid.UUID, username string, inviterID uuid.UUID, code int32, subject string) {
+	if inviterID == uuid.Nil {
+		// Invite was sent by the server.
+		return
+	}
+
+	contentBytes, err := json.Marshal(map[string]string{"group_id": groupID.String(), "username": username})
+	if err != nil {
+		logger.Error("Could not encode notification content.", zap.Error(err))
+		return
+	}
+
+	notifications := map[uuid.UUID][]*api.Notification{
+		inviterID: {{
+			Id:         uuid.Must(uuid.NewV4()).String(),
+			Subject:    subject,
+			Content:    string(contentBytes),
+			SenderId:   userID.String(),
+			Code:       code,
+			Persistent: true,
+			CreateTime: &timestamppb.Timestamp{Seconds: time.Now().UTC().Unix()},
+		}},
+	}
+	// Any error is already logged before it's returned here.
+	_ = NotificationSend(ctx, logger, db, tracker, router, notifications)
+}
+
+// Store the application submitted with a join request, replacing any previous one.
+func groupApplicationUpsert(ctx context.Context, db *sql.DB, groupID, userID uuid.UUID, metadata string) error {
+	query := `
+INSERT INTO group_application (group_id, user_id, metadata) VALUES ($1, $2, $3)
+ON CONFLICT (group_id, user_id) DO UPDATE SET metadata = $3, create_time = now()`
+	_, err := db.ExecContext(ctx, query, groupID, userID, metadata)
+	return err
+}
+
+// Remove any pending invite and application once the user's join request or membership is resolved, as part of the
+// membership change transaction.
+func groupInviteRemoveUser(ctx context.Context, tx *sql.Tx, groupID, userID uuid.UUID) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM group_invite WHERE group_id = $1 AND user_id = $2", groupID, userID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM group_application WHERE group_id = $1 AND user_id = $2", groupID, userID)
+	return err
+}
+
+// Look up the applications attached to any join requests in a page of group users, keyed by user ID.
+func groupApplicationsForUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID uuid.UUID, groupUsers []*api.GroupUserList_GroupUser) (map[string]string, error) {
+	userIDs := make([]string, 0, len(groupUsers))
+	for _, gu := range groupUsers {
+		if gu.State.GetValue() == int32(api.GroupUserList_GroupUser_JOIN_REQUEST) {
+			userIDs = append(userIDs, gu.User.Id)
+		}
+	}
+	if len(userIDs) == 0 {
+		return map[string]string{}, nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT user_id, metadata FROM group_application WHERE group_id = $1 AND user_id = ANY($2::UUID[])", groupID, userIDs)
+	if err != nil {
+		logger.Error("Could not look up group applications.", zap.Error(err), zap.String("group_id", groupID.String()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	applications := make(map[string]string, len(userIDs))
+	for rows.Next() {
+		var userID uuid.UUID
+		var metadata string
+		if err = rows.Scan(&userID, &metadata); err != nil {
+			logger.Error("Could not parse group applications.", zap.Error(err), zap.String("group_id", groupID.String()))
+			return nil, err
+		}
+		applications[userID.String()] = metadata
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Could not look up group applications.", zap.Error(err), zap.String("group_id", groupID.String()))
+		return nil, err
+	}
+
+	return applications, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+type groupInviteTestData struct {
+	lbCache   LeaderboardCache
+	rankCache LeaderboardRankCache
+	tracker   Tracker
+	router    MessageRouter
+	ownerID   uuid.UUID
+	memberID  uuid.UUID
+	groupID   uuid.UUID
+}
+
+// Set up a closed group with an owner and a member.
+func newGroupInviteTestData(t *testing.T, ctx context.Context, db *sql.DB) *groupInviteTestData {
+	config := NewConfig(logger)
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	data := &groupInviteTestData{
+		lbCache:   lbCache,
+		rankCache: NewLocalLeaderboardRankCache(ctx, logger, db, config.Leaderboard, lbCache),
+		tracker:   &LocalTracker{},
+		router:    &DummyMessageRouter{},
+		ownerID:   uuid.Must(uuid.NewV4()),
+		memberID:  uuid.Must(uuid.NewV4()),
+	}
+	InsertUser(t, db, data.ownerID)
+	InsertUser(t, db, data.memberID)
+
+	group, err := CreateGroup(ctx, logger, db, groupIdx, data.ownerID, data.ownerID, uuid.Must(uuid.NewV4()).String(), "en", "", "", "", false, 10)
+	require.NoError(t, err)
+	data.groupID = uuid.FromStringOrNil(group.Id)
+	require.NoError(t, AddGroupUsers(ctx, logger, db, data.lbCache, data.rankCache, data.tracker, data.router, uuid.Nil, data.groupID, []uuid.UUID{data.memberID}))
+
+	return data
+}
+
+func groupInviteEdgeState(t *testing.T, db *sql.DB, groupID, userID uuid.UUID) (int, bool) {
+	var state int
+	err := db.QueryRow("SELECT state FROM group_edge WHERE source_id = $1 AND destination_id = $2", groupID, userID).Scan(&state)
+	if err == sql.ErrNoRows {
+		return 0, false
+	}
+	require.NoError(t, err)
+	return state, true
+}
+
+func groupInviteNotified(t *testing.T, db *sql.DB, userID uuid.UUID, code int32) bool {
+	var notified bool
+	require.NoError(t, db.QueryRow("SELECT EXISTS (SELECT 1 FROM notification WHERE user_id = $1 AND code = $2)", userID, code).Scan(&notified))
+	return notified
+}
+
+func TestGroupInviteAccept(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+	data := newGroupInviteTestData(t, ctx, db)
+
+	inviteeID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, inviteeID)
+
+	require.NoError(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, data.ownerID, data.groupID, []uuid.UUID{inviteeID}, 0))
+	require.True(t, groupInviteNotified(t, db, inviteeID, NotificationCodeGroupInvite))
+
+	invites, err := GroupInvitesList(ctx, logger, db, inviteeID)
+	require.NoError(t, err)
+	require.Len(t, invites, 1)
+	require.Equal(t, data.groupID.String(), invites[0].GroupId)
+	require.Equal(t, data.ownerID.String(), invites[0].InviterId)
+	require.Greater(t, invites[0].ExpiryTime, invites[0].CreateTime)
+
+	// Invites bypass the group being closed.
+	require.NoError(t, GroupInviteAccept(ctx, logger, db, data.lbCache, data.rankCache, data.tracker, data.router, data.groupID, inviteeID, inviteeID.String()))
+	state, found := groupInviteEdgeState(t, db, data.groupID, inviteeID)
+	require.True(t, found)
+	require.Equal(t, 2, state, "Invited user should be a member.")
+	require.True(t, groupInviteNotified(t, db, data.ownerID, NotificationCodeGroupInviteAccept))
+
+	invites, err = GroupInvitesList(ctx, logger, db, inviteeID)
+	require.NoError(t, err)
+	require.Empty(t, invites)
+	require.ErrorIs(t, GroupInviteAccept(ctx, logger, db, data.lbCache, data.rankCache, data.tracker, data.router, data.groupID, inviteeID, inviteeID.String()), ErrGroupInviteNotFound)
+}
+
+func TestGroupInviteReject(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+	data := newGroupInviteTestData(t, ctx, db)
+
+	inviteeID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, inviteeID)
+
+	require.NoError(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, data.ownerID, data.groupID, []uuid.UUID{inviteeID}, 0))
+	require.NoError(t, GroupInviteReject(ctx, logger, db, data.tracker, data.router, data.groupID, inviteeID, inviteeID.String()))
+	_, found := groupInviteEdgeState(t, db, data.groupID, inviteeID)
+	require.False(t, found)
+	require.True(t, groupInviteNotified(t, db, data.ownerID, NotificationCodeGroupInviteReject))
+
+	invites, err := GroupInvitesList(ctx, logger, db, inviteeID)
+	require.NoError(t, err)
+	require.Empty(t, invites)
+	require.ErrorIs(t, GroupInviteReject(ctx, logger, db, data.tracker, data.router, data.groupID, inviteeID, inviteeID.String()), ErrGroupInviteNotFound)
+}
+
+func TestGroupInviteExpired(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+	data := newGroupInviteTestData(t, ctx, db)
+
+	inviteeID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, inviteeID)
+
+	require.NoError(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, data.ownerID, data.groupID, []uuid.UUID{inviteeID}, 60))
+	_, err := db.Exec("UPDATE group_invite SET expiry_time = now() - INTERVAL '1 hour' WHERE group_id = $1 AND user_id = $2", data.groupID, inviteeID)
+	require.NoError(t, err)
+
+	invites, err := GroupInvitesList(ctx, logger, db, inviteeID)
+	require.NoError(t, err)
+	require.Empty(t, invites)
+	require.ErrorIs(t, GroupInviteAccept(ctx, logger, db, data.lbCache, data.rankCache, data.tracker, data.router, data.groupID, inviteeID, inviteeID.String()), ErrGroupInviteNotFound)
+	_, found := groupInviteEdgeState(t, db, data.groupID, inviteeID)
+	require.False(t, found)
+}
+
+func TestGroupInvitePermissions(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+	data := newGroupInviteTestData(t, ctx, db)
+
+	inviteeID, outsiderID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, inviteeID)
+	InsertUser(t, db, outsiderID)
+
+	// Plain members and users outside the group can't invite.
+	require.ErrorIs(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, data.memberID, data.groupID, []uuid.UUID{inviteeID}, 0), runtime.ErrGroupPermissionDenied)
+	require.ErrorIs(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, outsiderID, data.groupID, []uuid.UUID{inviteeID}, 0), runtime.ErrGroupPermissionDenied)
+	_, err := GroupApplicationsList(ctx, logger, db, data.memberID, data.groupID)
+	require.ErrorIs(t, err, runtime.ErrGroupPermissionDenied)
+
+	// A role with the invite permission allows it.
+	_, err = GroupRoleUpsert(ctx, logger, db, data.ownerID, data.groupID, "recruiter", []string{GroupPermissionInvite})
+	require.NoError(t, err)
+	require.NoError(t, GroupUserRoleSet(ctx, logger, db, data.tracker, data.ownerID, data.groupID, data.memberID, "recruiter"))
+	require.NoError(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, data.memberID, data.groupID, []uuid.UUID{inviteeID}, 0))
+	_, err = GroupApplicationsList(ctx, logger, db, data.memberID, data.groupID)
+	require.NoError(t, err)
+
+	invites, err := GroupInvitesList(ctx, logger, db, inviteeID)
+	require.NoError(t, err)
+	require.Len(t, invites, 1)
+	require.Equal(t, data.memberID.String(), invites[0].InviterId)
+
+	// Existing members are skipped.
+	require.NoError(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, data.ownerID, data.groupID, []uuid.UUID{data.memberID}, 0))
+	invites, err = GroupInvitesList(ctx, logger, db, data.memberID)
+	require.NoError(t, err)
+	require.Empty(t, invites)
+
+	// Server invites need no permission.
+	require.NoError(t, GroupInviteUsers(ctx, logger, db, data.tracker, data.router, uuid.Nil, data.groupID, []uuid.UUID{outsiderID}, 0))
+	require.NoError(t, GroupInviteAccept(ctx, logger, db, data.lbCache, data.rankCache, data.tracker, data.router, data.groupID, outsiderID, outsiderID.String()))
+	state, found := groupInviteEdgeState(t, db, data.groupID, outsiderID)
+	require.True(t, found)
+	require.Equal(t, 2, state)
+}
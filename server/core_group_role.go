@@ -0,0 +1,307 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+)
+
+// Named permissions a custom group role may grant to a regular member. Superadmins and admins hold all of them.
+const (
+	GroupPermissionInvite = "invite" // Add users and accept join requests.
+	GroupPermissionKick   = "kick"   // Kick members that are not admins.
+	GroupPermissionEdit   = "edit"   // Update the group description, avatar and language.
+	GroupPermissionChat   = "chat"   // Remove any message in the group channel.
+)
+
+var (
+	ErrGroupRoleNotFound          = errors.New("group role not found")
+	ErrGroupRoleInvalidName       = errors.New("group role name must be between 1 and 64 characters")
+	ErrGroupRoleInvalidPermission = errors.New("group role permission must be one of 'invite', 'kick', 'edit' or 'chat'")
+	ErrGroupRoleUserNotMember     = errors.New("group role can only be assigned to a group member")
+)
+
+var groupPermissions = map[string]struct{}{
+	GroupPermissionInvite: {},
+	GroupPermissionKick:   {},
+	GroupPermissionEdit:   {},
+	GroupPermissionChat:   {},
+}
+
+type GroupRole struct {
+	GroupId     string
+	Name        string
+	Permissions []string
+	CreateTime  int64
+	UpdateTime  int64
+}
+
+// GroupRoleUpsert creates a role for the group or replaces the permissions of an existing role with the same name.
+func GroupRoleUpsert(ctx context.Context, logger *zap.Logger, db *sql.DB, caller, groupID uuid.UUID, name string, permissions []string) (*GroupRole, error) {
+	if len(name) < 1 || len(name) > 64 {
+		return nil, ErrGroupRoleInvalidName
+	}
+	permissions, err := groupRoleCheckPermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := groupRoleCheckCaller(ctx, logger, db, caller, groupID); err != nil {
+		return nil, err
+	}
+
+	permissionsBytes, err := json.Marshal(permissions)
+	if err != nil {
+		logger.Error("Could not encode group role permissions.", zap.Error(err))
+		return nil, err
+	}
+
+	query := `
+INSERT INTO group_role (group_id, name, permissions)
+SELECT $1, $2, $3 FROM groups WHERE id = $1 AND disable_time = '1970-01-01 00:00:00 UTC'
+ON CONFLICT (group_id, name) DO UPDATE SET permissions = $3, update_time = now()
+RETURNING create_time, update_time`
+	var createTime pgtype.Timestamptz
+	var updateTime pgtype.Timestamptz
+	if err = db.QueryRowContext(ctx, query, groupID, name, permissionsBytes).Scan(&createTime, &updateTime); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, runtime.ErrGroupNotFound
+		}
+		logger.Error("Could not write group role.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("role", name))
+		return nil, err
+	}
+
+	return &GroupRole{
+		GroupId:     groupID.String(),
+		Name:        name,
+		Permissions: permissions,
+		CreateTime:  createTime.Time.Unix(),
+		UpdateTime:  updateTime.Time.Unix(),
+	}, nil
+}
+
+// GroupRoleDelete removes a role from the group. Members holding the role return to plain members.
+func GroupRoleDelete(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, caller, groupID uuid.UUID, name string) error {
+	if err := groupRoleCheckCaller(ctx, logger, db, caller, groupID); err != nil {
+		return err
+	}
+
+	userIDs := make([]uuid.UUID, 0)
+	if err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		userIDs = userIDs[:0]
+		rows, err := tx.QueryContext(ctx, "DELETE FROM group_role_member WHERE group_id = $1 AND role = $2 RETURNING user_id", groupID, name)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var userID uuid.UUID
+			if err = rows.Scan(&userID); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			userIDs = append(userIDs, userID)
+		}
+		_ = rows.Close()
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM group_role WHERE group_id = $1 AND name = $2", groupID, name)
+		return err
+	}); err != nil {
+		logger.Error("Could not delete group role.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("role", name))
+		return err
+	}
+
+	for _, userID := range userIDs {
+		groupRoleUpdatePresences(ctx, tracker, groupID, userID, "")
+	}
+
+	return nil
+}
+
+// GroupRolesList returns all roles defined for the group, ordered by name.
+func GroupRolesList(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID uuid.UUID) ([]*GroupRole, error) {
+	query := "SELECT name, permissions, create_time, update_time FROM group_role WHERE group_id = $1 ORDER BY name"
+	rows, err := db.QueryContext(ctx, query, groupID)
+	if err != nil {
+		logger.Error("Could not list group roles.", zap.Error(err), zap.String("group_id", groupID.String()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]*GroupRole, 0, 5)
+	for rows.Next() {
+		var name string
+		var permissionsBytes []byte
+		var createTime pgtype.Timestamptz
+		var updateTime pgtype.Timestamptz
+		if err = rows.Scan(&name, &permissionsBytes, &createTime, &updateTime); err != nil {
+			logger.Error("Could not parse group roles.", zap.Error(err), zap.String("group_id", groupID.String()))
+			return nil, err
+		}
+		var permissions []string
+		if err = json.Unmarshal(permissionsBytes, &permissions); err != nil {
+			logger.Error("Could not parse group role permissions.", zap.Error(err), zap.String("group_id", groupID.String()))
+			return nil, err
+		}
+		roles = append(roles, &GroupRole{
+			GroupId:     groupID.String(),
+			Name:        name,
+			Permissions: permissions,
+			CreateTime:  createTime.Time.Unix(),
+			UpdateTime:  updateTime.Time.Unix(),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Could not list group roles.", zap.Error(err), zap.String("group_id", groupID.String()))
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GroupUserRoleSet assigns a role to a group member, replacing any previous role. An empty role name removes the assignment.
+func GroupUserRoleSet(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, caller, groupID, userID uuid.UUID, name string) error {
+	if err := groupRoleCheckCaller(ctx, logger, db, caller, groupID); err != nil {
+		return err
+	}
+
+	if name == "" {
+		if _, err := db.ExecContext(ctx, "DELETE FROM group_role_member WHERE group_id = $1 AND user_id = $2", groupID, userID); err != nil {
+			logger.Error("Could not remove group role assignment.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+			return err
+		}
+		groupRoleUpdatePresences(ctx, tracker, groupID, userID, "")
+		return nil
+	}
+
+	var state sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT state FROM group_edge WHERE source_id = $1::UUID AND destination_id = $2::UUID", groupID, userID).Scan(&state); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrGroupRoleUserNotMember
+		}
+		logger.Error("Could not retrieve state from group_edge.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+		return err
+	}
+	if state.Int64 > 2 {
+		return ErrGroupRoleUserNotMember
+	}
+
+	query := `
+INSERT INTO group_role_member (group_id, user_id, role)
+SELECT group_id, $2, name FROM group_role WHERE group_id = $1 AND name = $3
+ON CONFLICT (group_id, user_id) DO UPDATE SET role = $3, update_time = now()`
+	res, err := db.ExecContext(ctx, query, groupID, userID, name)
+	if err != nil {
+		logger.Error("Could not assign group role.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()), zap.String("role", name))
+		return err
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return ErrGroupRoleNotFound
+	}
+
+	groupRoleUpdatePresences(ctx, tracker, groupID, userID, name)
+
+	return nil
+}
+
+// Returns the name of the role held by the user in the group, or an empty string if they hold none.
+func groupUserRoleGet(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID, userID uuid.UUID) (string, error) {
+	var role string
+	if err := db.QueryRowContext(ctx, "SELECT role FROM group_role_member WHERE group_id = $1 AND user_id = $2", groupID, userID).Scan(&role); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		logger.Error("Could not look up group role.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+		return "", err
+	}
+	return role, nil
+}
+
+// Check if the user is a group member whose role grants the given permission.
+func groupCheckUserRolePermission(ctx context.Context, logger *zap.Logger, db *sql.DB, groupID, userID uuid.UUID, permission string) (bool, error) {
+	query := `
+SELECT EXISTS (
+	SELECT 1 FROM group_role_member m
+	JOIN group_role r ON r.group_id = m.group_id AND r.name = m.role
+	JOIN group_edge e ON e.source_id = m.group_id AND e.destination_id = m.user_id
+	WHERE m.group_id = $1 AND m.user_id = $2 AND e.state <= 2 AND r.permissions @> $3::JSONB
+)`
+	permissionBytes, _ := json.Marshal([]string{permission})
+	var allowed bool
+	if err := db.QueryRowContext(ctx, query, groupID, userID, permissionBytes).Scan(&allowed); err != nil {
+		logger.Error("Could not look up group role permission.", zap.Error(err), zap.String("group_id", groupID.String()), zap.String("user_id", userID.String()))
+		return false, err
+	}
+	return allowed, nil
+}
+
+// Remove any role assignment for a user leaving the group, as part of the membership change transaction.
+func groupRoleRemoveUser(ctx context.Context, tx *sql.Tx, groupID, userID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM group_role_member WHERE group_id = $1 AND user_id = $2", groupID, userID)
+	return err
+}
+
+// Only superadmins and admins may manage roles.
+func groupRoleCheckCaller(ctx context.Context, logger *zap.Logger, db *sql.DB, caller, groupID uuid.UUID) error {
+	if caller == uuid.Nil {
+		return nil
+	}
+	allowed, err := groupCheckUserPermission(ctx, logger, db, groupID, caller, 1)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		logger.Info("User does not have permission to manage group roles.", zap.String("group_id", groupID.String()), zap.String("user_id", caller.String()))
+		return runtime.ErrGroupPermissionDenied
+	}
+	return nil
+}
+
+func groupRoleCheckPermissions(permissions []string) ([]string, error) {
+	unique := make(map[string]struct{}, len(permissions))
+	for _, permission := range permissions {
+		if _, ok := groupPermissions[permission]; !ok {
+			return nil, ErrGroupRoleInvalidPermission
+		}
+		unique[permission] = struct{}{}
+	}
+	checked := make([]string, 0, len(unique))
+	for permission := range unique {
+		checked = append(checked, permission)
+	}
+	sort.Strings(checked)
+	return checked, nil
+}
+
+// Reflect a role change in the status of the user's presences on the group channel.
+func groupRoleUpdatePresences(ctx context.Context, tracker Tracker, groupID, userID uuid.UUID, role string) {
+	stream := PresenceStream{Mode: StreamModeGroup, Subject: groupID}
+	for _, presence := range tracker.ListByStream(stream, true, true) {
+		if presence.UserID != userID || presence.Meta.Status == role {
+			continue
+		}
+		meta := presence.Meta
+		meta.Status = role
+		tracker.Update(ctx, presence.ID.SessionID, stream, userID, meta)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupRoleCheckPermissions(t *testing.T) {
+	permissions, err := groupRoleCheckPermissions([]string{GroupPermissionKick, GroupPermissionChat, GroupPermissionKick})
+	require.NoError(t, err)
+	require.Equal(t, []string{GroupPermissionChat, GroupPermissionKick}, permissions, "Permissions should be deduplicated and sorted.")
+
+	permissions, err = groupRoleCheckPermissions(nil)
+	require.NoError(t, err)
+	require.Empty(t, permissions)
+
+	_, err = groupRoleCheckPermissions([]string{GroupPermissionInvite, "delete"})
+	require.ErrorIs(t, err, ErrGroupRoleInvalidPermission)
+}
@@ -0,0 +1,318 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama/v3/social"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OIDC actions passed to the OIDC hooks.
+const (
+	OIDCActionAuthenticate = "authenticate"
+	OIDCActionLink         = "link"
+	OIDCActionUnlink       = "unlink"
+)
+
+// OIDCRequest is an OpenID Connect authenticate, link or unlink request, as given to the OIDC hooks.
+type OIDCRequest struct {
+	Provider string            `json:"provider"`
+	Token    string            `json:"token"`
+	Vars     map[string]string `json:"vars"`
+	// Only used to authenticate.
+	Username string `json:"username"`
+	Create   bool   `json:"create"`
+}
+
+// Run the before hook for an OIDC request, it may return an adjusted request or an error to reject it. The provider is
+// set by the route and cannot be changed.
+func oidcBeforeHook(ctx context.Context, hookFn RuntimeBeforeOIDCFunction, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error) {
+	if hookFn == nil {
+		return request, nil
+	}
+
+	requestCopy := *request
+	updated, err, code := hookFn(ctx, userID, username, action, &requestCopy)
+	if err != nil {
+		return nil, status.Error(code, err.Error())
+	}
+	if updated == nil {
+		return request, nil
+	}
+	updated.Provider = request.Provider
+	return updated, nil
+}
+
+func oidcAfterHook(ctx context.Context, logger *zap.Logger, hookFn RuntimeAfterOIDCFunction, userID, username, action string, request *OIDCRequest) {
+	if hookFn == nil {
+		return
+	}
+	if err := hookFn(ctx, userID, username, action, request); err != nil {
+		logger.Error("Error running OIDC after hook.", zap.Error(err), zap.String("provider", request.Provider), zap.String("action", action))
+	}
+}
+
+// UserIdentity is an account link to a configured OpenID Connect provider.
+type UserIdentity struct {
+	Provider   string `json:"provider"`
+	ProviderId string `json:"provider_id"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// Look up a configured OpenID Connect provider by name.
+func oidcProviderConfig(config Config, name string) (*social.OIDCProvider, error) {
+	for _, provider := range config.GetSocial().OIDC {
+		if provider.Name == name {
+			return &social.OIDCProvider{
+				Name:             provider.Name,
+				Issuer:           provider.Issuer,
+				JwksUrl:          provider.JwksUrl,
+				Audience:         provider.Audience,
+				IdClaim:          provider.IdClaim,
+				UsernameClaim:    provider.UsernameClaim,
+				DisplayNameClaim: provider.DisplayNameClaim,
+				EmailClaim:       provider.EmailClaim,
+				AvatarUrlClaim:   provider.AvatarUrlClaim,
+			}, nil
+		}
+	}
+	return nil, status.Error(codes.FailedPrecondition, "OIDC provider is not configured.")
+}
+
+func AuthenticateOIDC(ctx context.Context, logger *zap.Logger, db *sql.DB, client *social.Client, namePolicy NamePolicy, provider *social.OIDCProvider, token, username string, create bool) (string, string, bool, error) {
+	profile, err := client.CheckOIDCToken(ctx, provider, token)
+	if err != nil {
+		logger.Info("Could not authenticate OIDC profile.", zap.String("provider", provider.Name), zap.Error(err))
+		return "", "", false, status.Error(codes.Unauthenticated, "Could not authenticate OIDC profile.")
+	}
+	found := true
+
+	// Look for an existing account.
+	query := "SELECT u.id, u.username, u.disable_time FROM users u JOIN user_identity ui ON u.id = ui.user_id WHERE ui.provider = $1 AND ui.provider_id = $2"
+	var dbUserID string
+	var dbUsername string
+	var dbDisableTime pgtype.Timestamptz
+	err = db.QueryRowContext(ctx, query, provider.Name, profile.ID).Scan(&dbUserID, &dbUsername, &dbDisableTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			found = false
+		} else {
+			logger.Error("Error looking up user by OIDC ID.", zap.Error(err), zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("username", username), zap.Bool("create", create))
+			return "", "", false, status.Error(codes.Internal, "Error finding user account.")
+		}
+	}
+
+	// Existing account found.
+	if found {
+		// Check if it's disabled.
+		if dbDisableTime.Status == pgtype.Present && dbDisableTime.Time.Unix() != 0 {
+			logger.Info("User account is disabled.", zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("username", username), zap.Bool("create", create))
+			return "", "", false, status.Error(codes.PermissionDenied, "User account banned.")
+		}
+
+		return dbUserID, dbUsername, false, nil
+	}
+
+	if !create {
+		// No user account found, and creation is not allowed.
+		return "", "", false, status.Error(codes.NotFound, "User account not found.")
+	}
+
+	// Usernames are checked against the name policy only when an account is created.
+	if err := namePolicyCheckNewUsername(namePolicy, username); err != nil {
+		return "", "", false, err
+	}
+
+	// Create a new account and its identity link together.
+	userID := uuid.Must(uuid.NewV4()).String()
+	err = ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		query := "INSERT INTO users (id, username, display_name, avatar_url, create_time, update_time) VALUES ($1, $2, nullif($3, ''), nullif($4, ''), now(), now())"
+		if _, err := tx.ExecContext(ctx, query, userID, username, profile.DisplayName, profile.AvatarUrl); err != nil {
+			return err
+		}
+		query = "INSERT INTO user_identity (provider, provider_id, user_id) VALUES ($1, $2, $3)"
+		_, err := tx.ExecContext(ctx, query, provider.Name, profile.ID, userID)
+		return err
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == dbErrorUniqueViolation {
+			if strings.Contains(pgErr.Message, "users_username_key") {
+				// Username is already in use by a different account.
+				return "", "", false, status.Error(codes.AlreadyExists, "Username is already in use.")
+			} else if strings.Contains(pgErr.Message, "user_identity_pkey") {
+				// A concurrent write has inserted this OIDC ID.
+				logger.Info("Did not insert new user as OIDC ID already exists.", zap.Error(err), zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("username", username), zap.Bool("create", create))
+				return "", "", false, status.Error(codes.Internal, "Error finding or creating user account.")
+			}
+		}
+		logger.Error("Cannot find or create user with OIDC ID.", zap.Error(err), zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("username", username), zap.Bool("create", create))
+		return "", "", false, status.Error(codes.Internal, "Error finding or creating user account.")
+	}
+
+	// Import email address, if it exists.
+	if profile.Email != "" {
+		_, err = db.ExecContext(ctx, "UPDATE users SET email = $1 WHERE id = $2", profile.Email, userID)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == dbErrorUniqueViolation && strings.Contains(pgErr.Message, "users_email_key") {
+				logger.Warn("Skipping OIDC account email import as it is already set in another user.", zap.Error(err), zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("username", username), zap.Bool("create", create), zap.String("created_user_id", userID))
+			} else {
+				logger.Error("Failed to import OIDC account email.", zap.Error(err), zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("username", username), zap.Bool("create", create), zap.String("created_user_id", userID))
+				return "", "", false, status.Error(codes.Internal, "Error importing OIDC account email.")
+			}
+		}
+	}
+
+	return userID, username, true, nil
+}
+
+func LinkOIDC(ctx context.Context, logger *zap.Logger, db *sql.DB, socialClient *social.Client, provider *social.OIDCProvider, userID uuid.UUID, token string) error {
+	if token == "" {
+		return status.Error(codes.InvalidArgument, "OIDC ID token is required.")
+	}
+
+	profile, err := socialClient.CheckOIDCToken(ctx, provider, token)
+	if err != nil {
+		logger.Info("Could not authenticate OIDC profile.", zap.String("provider", provider.Name), zap.Error(err))
+		return status.Error(codes.Unauthenticated, "Could not authenticate OIDC profile.")
+	}
+
+	// A user holds at most one identity per provider, linking again replaces it.
+	err = ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO user_identity (provider, provider_id, user_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, provider) DO UPDATE SET provider_id = $2, update_time = now()`, provider.Name, profile.ID, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET update_time = now() WHERE id = $1", userID)
+		return err
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == dbErrorUniqueViolation && strings.Contains(pgErr.Message, "user_identity_pkey") {
+			return status.Error(codes.AlreadyExists, "OIDC ID is already in use.")
+		}
+		logger.Error("Could not link OIDC ID.", zap.Error(err), zap.String("provider", provider.Name), zap.Any("input", token))
+		return status.Error(codes.Internal, "Error while trying to link OIDC ID.")
+	}
+
+	// Import email address, if it exists.
+	if profile.Email != "" {
+		_, err = db.ExecContext(ctx, "UPDATE users SET email = $1 WHERE id = $2 AND email IS NULL", profile.Email, userID)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == dbErrorUniqueViolation && strings.Contains(pgErr.Message, "users_email_key") {
+				logger.Warn("Skipping OIDC account email import as it is already set in another user.", zap.Error(err), zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("user_id", userID.String()))
+			} else {
+				logger.Error("Failed to import OIDC account email.", zap.Error(err), zap.String("provider", provider.Name), zap.String("providerID", profile.ID), zap.String("user_id", userID.String()))
+				return status.Error(codes.Internal, "Error importing OIDC account email.")
+			}
+		}
+	}
+
+	return nil
+}
+
+func UnlinkOIDC(ctx context.Context, logger *zap.Logger, db *sql.DB, socialClient *social.Client, provider *social.OIDCProvider, id uuid.UUID, token string) error {
+	params := []any{id, provider.Name}
+	query := `DELETE FROM user_identity WHERE user_id = $1 AND provider = $2`
+
+	if token != "" {
+		profile, err := socialClient.CheckOIDCToken(ctx, provider, token)
+		if err != nil {
+			logger.Info("Could not authenticate OIDC profile.", zap.String("provider", provider.Name), zap.Error(err))
+			return status.Error(codes.Unauthenticated, "Could not authenticate OIDC profile.")
+		}
+		params = append(params, profile.ID)
+		query = query + ` AND provider_id = $3`
+	}
+
+	query = query + `
+AND (EXISTS (SELECT id FROM users WHERE id = $1 AND
+    (apple_id IS NOT NULL
+     OR facebook_id IS NOT NULL
+     OR facebook_instant_game_id IS NOT NULL
+     OR google_id IS NOT NULL
+     OR gamecenter_id IS NOT NULL
+     OR steam_id IS NOT NULL
+     OR email IS NOT NULL
+     OR custom_id IS NOT NULL))
+   OR EXISTS (SELECT id FROM user_device WHERE user_id = $1 LIMIT 1)
+   OR EXISTS (SELECT user_id FROM user_identity WHERE user_id = $1 AND provider <> $2 LIMIT 1))`
+
+	err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, params...)
+		if err != nil {
+			logger.Debug("Could not unlink OIDC ID.", zap.Error(err), zap.Any("input", token))
+			return err
+		}
+		if count, _ := res.RowsAffected(); count == 0 {
+			return StatusError(codes.PermissionDenied, "Cannot unlink last account identifier. Check profile exists and is not last link.", ErrRowsAffectedCount)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE users SET update_time = now() WHERE id = $1", id)
+		return err
+	})
+
+	if err != nil {
+		if e, ok := err.(*statusError); ok {
+			return e.Status()
+		}
+		logger.Error("Error in database transaction.", zap.Error(err))
+		return status.Error(codes.Internal, "Error while trying to unlink OIDC ID.")
+	}
+	return nil
+}
+
+// List the OpenID Connect identities linked to a user.
+func UserIdentitiesList(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID) ([]*UserIdentity, error) {
+	rows, err := db.QueryContext(ctx, "SELECT provider, provider_id, create_time FROM user_identity WHERE user_id = $1 ORDER BY provider", userID)
+	if err != nil {
+		logger.Error("Error retrieving user identities.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]*UserIdentity, 0, 1)
+	for rows.Next() {
+		var createTime pgtype.Timestamptz
+		identity := &UserIdentity{}
+		if err = rows.Scan(&identity.Provider, &identity.ProviderId, &createTime); err != nil {
+			logger.Error("Error retrieving user identities.", zap.Error(err), zap.String("user_id", userID.String()))
+			return nil, err
+		}
+		identity.CreateTime = createTime.Time.Unix()
+		identities = append(identities, identity)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error retrieving user identities.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+
+	return identities, nil
+}
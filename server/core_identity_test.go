@@ -0,0 +1,53 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestOIDCBeforeHook(t *testing.T) {
+	request := &OIDCRequest{Provider: "publisher", Token: "token", Username: "player", Create: true}
+
+	hookFn := func(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+		assert.Equal(t, OIDCActionAuthenticate, action)
+		assert.Equal(t, "player", request.Username)
+		// Attempts to change the provider are ignored.
+		return &OIDCRequest{Provider: "other", Token: request.Token, Username: "renamed"}, nil, codes.OK
+	}
+	updated, err := oidcBeforeHook(context.Background(), hookFn, "", "", OIDCActionAuthenticate, request)
+	assert.NoError(t, err)
+	assert.Equal(t, &OIDCRequest{Provider: "publisher", Token: "token", Username: "renamed"}, updated)
+
+	keepFn := func(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+		request.Token = "changed"
+		return nil, nil, codes.OK
+	}
+	updated, err = oidcBeforeHook(context.Background(), keepFn, "", "", OIDCActionAuthenticate, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", updated.Token)
+
+	rejectFn := func(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+		return nil, errors.New("link not allowed"), codes.PermissionDenied
+	}
+	_, err = oidcBeforeHook(context.Background(), rejectFn, "user", "player", OIDCActionLink, request)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
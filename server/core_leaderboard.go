@@ -30,6 +30,7 @@ import (
 	"github.com/heroiclabs/nakama/v3/internal/cronexpr"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
@@ -40,6 +41,8 @@ var (
 	ErrLeaderboardAuthoritative = errors.New("leaderboard only allows authoritative submissions")
 	ErrLeaderboardInvalidCursor = errors.New("leaderboard cursor invalid")
 	ErrInvalidOperator          = errors.New("invalid operator")
+
+	ErrLeaderboardGroupAggregateSource = errors.New("group aggregate source must be a leaderboard that is not itself an aggregate")
 )
 
 type leaderboardRecordListCursor struct {
@@ -552,6 +555,8 @@ func LeaderboardRecordWrite(ctx context.Context, logger *zap.Logger, db *sql.DB,
 	} else {
 		// Ensure we have the latest dbscore, dbsubscore if there was an update.
 		rank = rankCache.Insert(leaderboardId, leaderboard.SortOrder, dbScore, dbSubscore, dbNumScore, expiryTime, uuid.Must(uuid.FromString(ownerID)))
+
+		leaderboardGroupAggregatesOwnerUpdate(ctx, logger, db, leaderboardCache, rankCache, leaderboardId, uuid.Must(uuid.FromString(ownerID)), expiryTime)
 	}
 
 	record := &api.LeaderboardRecord{
@@ -601,6 +606,8 @@ func LeaderboardRecordDelete(ctx context.Context, logger *zap.Logger, db *sql.DB
 
 	rankCache.Delete(leaderboardId, expiryTime, uuid.Must(uuid.FromString(ownerID)))
 
+	leaderboardGroupAggregatesOwnerUpdate(ctx, logger, db, leaderboardCache, rankCache, leaderboardId, uuid.Must(uuid.FromString(ownerID)), expiryTime)
+
 	return nil
 }
 
@@ -616,9 +623,9 @@ func LeaderboardRecordReadAll(ctx context.Context, logger *zap.Logger, db *sql.D
 	return parseLeaderboardRecords(logger, rows)
 }
 
-func LeaderboardRecordsDeleteAll(ctx context.Context, logger *zap.Logger, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, tx *sql.Tx, userID uuid.UUID, currentTime int64) error {
+func LeaderboardRecordsDeleteAll(ctx context.Context, logger *zap.Logger, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, tx pgx.Tx, userID uuid.UUID, currentTime int64) error {
 	query := "DELETE FROM leaderboard_record WHERE owner_id = $1 RETURNING leaderboard_id, expiry_time"
-	rows, err := tx.QueryContext(ctx, query, userID.String())
+	rows, err := tx.Query(ctx, query, userID.String())
 	if err != nil {
 		logger.Error("Error deleting all leaderboard records for user", zap.String("user_id", userID.String()), zap.Error(err))
 		return err
@@ -628,7 +635,7 @@ func LeaderboardRecordsDeleteAll(ctx context.Context, logger *zap.Logger, leader
 	var expiryTime pgtype.Timestamptz
 	for rows.Next() {
 		if err := rows.Scan(&leaderboardId, &expiryTime); err != nil {
-			_ = rows.Close()
+			rows.Close()
 			logger.Error("Error deleting all leaderboard records for user, failed to scan", zap.String("user_id", userID.String()), zap.Error(err))
 			return err
 		}
@@ -641,7 +648,7 @@ func LeaderboardRecordsDeleteAll(ctx context.Context, logger *zap.Logger, leader
 
 		leaderboardRankCache.Delete(leaderboardId, expiryUnix, userID)
 	}
-	_ = rows.Close()
+	rows.Close()
 
 	return nil
 }
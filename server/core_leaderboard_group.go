@@ -0,0 +1,338 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+)
+
+type leaderboardGroupAggregateScore struct {
+	Score    int64
+	Subscore int64
+}
+
+// LeaderboardGroupAggregateCreate creates a leaderboard whose records are owned by groups, scored from the records their
+// members hold on the source leaderboard. Existing member records for the current reset period are aggregated immediately.
+func LeaderboardGroupAggregateCreate(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, id, sourceId string, aggregateOperator int, metadata string) (*Leaderboard, bool, error) {
+	aggregate, created, err := leaderboardCache.CreateGroupAggregate(ctx, id, sourceId, aggregateOperator, metadata)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		return aggregate, false, nil
+	}
+
+	expiryTime := int64(0)
+	if aggregate.ResetSchedule != nil {
+		expiryTime = aggregate.ResetSchedule.Next(time.Now().UTC()).UTC().Unix()
+	}
+
+	query := `
+SELECT DISTINCT ge.source_id
+FROM leaderboard_record lr
+JOIN group_edge ge ON ge.destination_id = lr.owner_id
+WHERE lr.leaderboard_id = $1 AND lr.expiry_time = $2 AND ge.state >= 0 AND ge.state <= 2`
+	rows, err := db.QueryContext(ctx, query, sourceId, time.Unix(expiryTime, 0).UTC())
+	if err != nil {
+		logger.Error("Error listing groups to aggregate", zap.Error(err), zap.String("leaderboard_id", id))
+		return nil, false, err
+	}
+	groupIDs := make([]uuid.UUID, 0, 10)
+	for rows.Next() {
+		var groupID uuid.UUID
+		if err = rows.Scan(&groupID); err != nil {
+			_ = rows.Close()
+			logger.Error("Error parsing groups to aggregate", zap.Error(err), zap.String("leaderboard_id", id))
+			return nil, false, err
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	_ = rows.Close()
+
+	for _, groupID := range groupIDs {
+		if err = leaderboardGroupAggregateUpdate(ctx, logger, db, rankCache, aggregate, groupID, expiryTime); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return aggregate, true, nil
+}
+
+// Recompute the aggregates of every group the owner belongs to, following a change to their record on the source leaderboard.
+func leaderboardGroupAggregatesOwnerUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, sourceId string, ownerID uuid.UUID, expiryTime int64) {
+	aggregates := leaderboardCache.ListGroupAggregates(sourceId)
+	if len(aggregates) == 0 {
+		return
+	}
+
+	query := "SELECT destination_id FROM group_edge WHERE source_id = $1 AND state >= 0 AND state <= 2"
+	rows, err := db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		logger.Error("Error listing groups for aggregate update", zap.Error(err), zap.String("owner_id", ownerID.String()))
+		return
+	}
+	groupIDs := make([]uuid.UUID, 0, 1)
+	for rows.Next() {
+		var groupID uuid.UUID
+		if err = rows.Scan(&groupID); err != nil {
+			_ = rows.Close()
+			logger.Error("Error parsing groups for aggregate update", zap.Error(err), zap.String("owner_id", ownerID.String()))
+			return
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	_ = rows.Close()
+
+	for _, groupID := range groupIDs {
+		for _, aggregate := range aggregates {
+			// Errors are logged within and do not fail the source record operation.
+			_ = leaderboardGroupAggregateUpdate(ctx, logger, db, rankCache, aggregate, groupID, expiryTime)
+		}
+	}
+}
+
+// Recompute a group's aggregates following a change to its membership. Only aggregates whose source leaderboard has a
+// record for the current period from one of the users who joined or left the group are affected.
+func leaderboardGroupAggregatesGroupUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, groupID uuid.UUID, userIDs []uuid.UUID) {
+	aggregates := leaderboardCache.ListAllGroupAggregates()
+	if len(aggregates) == 0 || len(userIDs) == 0 {
+		return
+	}
+
+	sourceIds := make([]string, 0, len(aggregates))
+	for _, aggregate := range aggregates {
+		sourceIds = append(sourceIds, aggregate.AggregateSourceId)
+	}
+
+	type sourcePeriod struct {
+		sourceId   string
+		expiryTime int64
+	}
+	query := "SELECT DISTINCT leaderboard_id, expiry_time FROM leaderboard_record WHERE leaderboard_id = ANY($1::TEXT[]) AND owner_id = ANY($2::UUID[])"
+	rows, err := db.QueryContext(ctx, query, sourceIds, userIDs)
+	if err != nil {
+		logger.Error("Error listing member records for aggregate update", zap.Error(err), zap.String("group_id", groupID.String()))
+		return
+	}
+	changed := make(map[sourcePeriod]struct{}, len(aggregates))
+	for rows.Next() {
+		var sourceId string
+		var expiryTime pgtype.Timestamptz
+		if err = rows.Scan(&sourceId, &expiryTime); err != nil {
+			_ = rows.Close()
+			logger.Error("Error parsing member records for aggregate update", zap.Error(err), zap.String("group_id", groupID.String()))
+			return
+		}
+		changed[sourcePeriod{sourceId: sourceId, expiryTime: expiryTime.Time.Unix()}] = struct{}{}
+	}
+	_ = rows.Close()
+
+	now := time.Now().UTC()
+	for _, aggregate := range aggregates {
+		expiryTime := int64(0)
+		if aggregate.ResetSchedule != nil {
+			expiryTime = aggregate.ResetSchedule.Next(now).UTC().Unix()
+		}
+		if _, found := changed[sourcePeriod{sourceId: aggregate.AggregateSourceId, expiryTime: expiryTime}]; !found {
+			continue
+		}
+		// Errors are logged within and do not fail the membership change.
+		_ = leaderboardGroupAggregateUpdate(ctx, logger, db, rankCache, aggregate, groupID, expiryTime)
+	}
+}
+
+// Remove all aggregate records owned by a group that has been deleted.
+func leaderboardGroupAggregatesGroupDelete(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, groupID uuid.UUID) {
+	aggregates := leaderboardCache.ListAllGroupAggregates()
+	if len(aggregates) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(aggregates))
+	for _, aggregate := range aggregates {
+		ids = append(ids, aggregate.Id)
+	}
+
+	query := "DELETE FROM leaderboard_record WHERE owner_id = $1 AND leaderboard_id = ANY($2::TEXT[]) RETURNING leaderboard_id, expiry_time"
+	rows, err := db.QueryContext(ctx, query, groupID, ids)
+	if err != nil {
+		logger.Error("Error deleting group aggregate records", zap.Error(err), zap.String("group_id", groupID.String()))
+		return
+	}
+	for rows.Next() {
+		var id string
+		var expiryTime pgtype.Timestamptz
+		if err = rows.Scan(&id, &expiryTime); err != nil {
+			_ = rows.Close()
+			logger.Error("Error parsing deleted group aggregate records", zap.Error(err), zap.String("group_id", groupID.String()))
+			return
+		}
+		rankCache.Delete(id, expiryTime.Time.Unix(), groupID)
+	}
+	_ = rows.Close()
+}
+
+// Refresh the aggregates of the groups affected by an account deletion once committed. Groups deleted with the account
+// lose their aggregate records, and the current period aggregates of the groups it left are recomputed without it.
+func leaderboardGroupAggregatesGroupsRefresh(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, groupIDs ...uuid.UUID) {
+	aggregates := leaderboardCache.ListAllGroupAggregates()
+	if len(aggregates) == 0 || len(groupIDs) == 0 {
+		return
+	}
+
+	query := "SELECT id FROM groups WHERE id = ANY($1::UUID[])"
+	rows, err := db.QueryContext(ctx, query, groupIDs)
+	if err != nil {
+		logger.Error("Error listing groups for aggregate refresh", zap.Error(err))
+		return
+	}
+	found := make(map[uuid.UUID]struct{}, len(groupIDs))
+	for rows.Next() {
+		var groupID uuid.UUID
+		if err = rows.Scan(&groupID); err != nil {
+			_ = rows.Close()
+			logger.Error("Error parsing groups for aggregate refresh", zap.Error(err))
+			return
+		}
+		found[groupID] = struct{}{}
+	}
+	_ = rows.Close()
+
+	now := time.Now().UTC()
+	for _, groupID := range groupIDs {
+		if _, ok := found[groupID]; !ok {
+			leaderboardGroupAggregatesGroupDelete(ctx, logger, db, leaderboardCache, rankCache, groupID)
+			continue
+		}
+		for _, aggregate := range aggregates {
+			expiryTime := int64(0)
+			if aggregate.ResetSchedule != nil {
+				expiryTime = aggregate.ResetSchedule.Next(now).UTC().Unix()
+			}
+			// Errors are logged within and do not fail the account deletion.
+			_ = leaderboardGroupAggregateUpdate(ctx, logger, db, rankCache, aggregate, groupID, expiryTime)
+		}
+	}
+}
+
+func leaderboardGroupAggregateUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, rankCache LeaderboardRankCache, aggregate *Leaderboard, groupID uuid.UUID, expiryTime int64) error {
+	query := `
+SELECT lr.score, lr.subscore
+FROM group_edge ge
+JOIN leaderboard_record lr ON lr.owner_id = ge.destination_id
+WHERE ge.source_id = $1 AND ge.state >= 0 AND ge.state <= 2 AND lr.leaderboard_id = $2 AND lr.expiry_time = $3`
+	rows, err := db.QueryContext(ctx, query, groupID, aggregate.AggregateSourceId, time.Unix(expiryTime, 0).UTC())
+	if err != nil {
+		logger.Error("Error reading group member records", zap.Error(err), zap.String("leaderboard_id", aggregate.Id), zap.String("group_id", groupID.String()))
+		return err
+	}
+	scores := make([]*leaderboardGroupAggregateScore, 0, 10)
+	for rows.Next() {
+		score := &leaderboardGroupAggregateScore{}
+		if err = rows.Scan(&score.Score, &score.Subscore); err != nil {
+			_ = rows.Close()
+			logger.Error("Error parsing group member records", zap.Error(err), zap.String("leaderboard_id", aggregate.Id), zap.String("group_id", groupID.String()))
+			return err
+		}
+		scores = append(scores, score)
+	}
+	_ = rows.Close()
+
+	if len(scores) == 0 {
+		// No member holds a record, the group drops off the aggregate.
+		return leaderboardGroupAggregateDelete(ctx, logger, db, rankCache, aggregate, groupID, expiryTime)
+	}
+
+	score, subscore := leaderboardGroupAggregateCalculate(scores, aggregate.AggregateOperator, aggregate.SortOrder)
+
+	// Each recalculation counts as a submission so the rank cache always accepts the newest aggregate.
+	query = `INSERT INTO leaderboard_record (leaderboard_id, owner_id, username, score, subscore, expiry_time)
+SELECT $1, id, name, $3, $4, $5 FROM groups WHERE id = $2
+ON CONFLICT (owner_id, leaderboard_id, expiry_time)
+DO UPDATE SET score = $3, subscore = $4, num_score = leaderboard_record.num_score + 1, username = EXCLUDED.username, update_time = now()
+RETURNING num_score`
+	var numScore int32
+	if err = db.QueryRowContext(ctx, query, aggregate.Id, groupID, score, subscore, time.Unix(expiryTime, 0).UTC()).Scan(&numScore); err != nil {
+		if err == sql.ErrNoRows {
+			// Group no longer exists.
+			return nil
+		}
+		logger.Error("Error writing group aggregate record", zap.Error(err), zap.String("leaderboard_id", aggregate.Id), zap.String("group_id", groupID.String()))
+		return err
+	}
+
+	rankCache.Insert(aggregate.Id, aggregate.SortOrder, score, subscore, numScore, expiryTime, groupID)
+
+	return nil
+}
+
+func leaderboardGroupAggregateDelete(ctx context.Context, logger *zap.Logger, db *sql.DB, rankCache LeaderboardRankCache, aggregate *Leaderboard, groupID uuid.UUID, expiryTime int64) error {
+	query := "DELETE FROM leaderboard_record WHERE leaderboard_id = $1 AND owner_id = $2 AND expiry_time = $3"
+	if _, err := db.ExecContext(ctx, query, aggregate.Id, groupID, time.Unix(expiryTime, 0).UTC()); err != nil {
+		logger.Error("Error deleting group aggregate record", zap.Error(err), zap.String("leaderboard_id", aggregate.Id), zap.String("group_id", groupID.String()))
+		return err
+	}
+
+	rankCache.Delete(aggregate.Id, expiryTime, groupID)
+
+	return nil
+}
+
+// Combine member scores into a single group score. Averages round down. Best picks the highest ranked
+// score and subscore pair according to the leaderboard sort order.
+func leaderboardGroupAggregateCalculate(scores []*leaderboardGroupAggregateScore, aggregateOperator, sortOrder int) (int64, int64) {
+	if len(scores) == 0 {
+		return 0, 0
+	}
+
+	switch aggregateOperator {
+	case LeaderboardAggregateOperatorBest:
+		best := scores[0]
+		for _, s := range scores[1:] {
+			var better bool
+			if sortOrder == LeaderboardSortOrderAscending {
+				better = s.Score < best.Score || (s.Score == best.Score && s.Subscore < best.Subscore)
+			} else {
+				better = s.Score > best.Score || (s.Score == best.Score && s.Subscore > best.Subscore)
+			}
+			if better {
+				best = s
+			}
+		}
+		return best.Score, best.Subscore
+	case LeaderboardAggregateOperatorAverage:
+		var score, subscore int64
+		for _, s := range scores {
+			score += s.Score
+			subscore += s.Subscore
+		}
+		return score / int64(len(scores)), subscore / int64(len(scores))
+	case LeaderboardAggregateOperatorSum:
+		fallthrough
+	default:
+		var score, subscore int64
+		for _, s := range scores {
+			score += s.Score
+			subscore += s.Subscore
+		}
+		return score, subscore
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderboardGroupAggregateCalculate(t *testing.T) {
+	scores := []*leaderboardGroupAggregateScore{
+		{Score: 10, Subscore: 1},
+		{Score: 30, Subscore: 2},
+		{Score: 30, Subscore: 5},
+		{Score: 5, Subscore: 0},
+	}
+
+	score, subscore := leaderboardGroupAggregateCalculate(scores, LeaderboardAggregateOperatorSum, LeaderboardSortOrderDescending)
+	require.Equal(t, int64(75), score)
+	require.Equal(t, int64(8), subscore)
+
+	score, subscore = leaderboardGroupAggregateCalculate(scores, LeaderboardAggregateOperatorAverage, LeaderboardSortOrderDescending)
+	require.Equal(t, int64(18), score, "Average should round down.")
+	require.Equal(t, int64(2), subscore)
+
+	score, subscore = leaderboardGroupAggregateCalculate(scores, LeaderboardAggregateOperatorBest, LeaderboardSortOrderDescending)
+	require.Equal(t, int64(30), score)
+	require.Equal(t, int64(5), subscore, "Ties should be broken on subscore.")
+
+	score, subscore = leaderboardGroupAggregateCalculate(scores, LeaderboardAggregateOperatorBest, LeaderboardSortOrderAscending)
+	require.Equal(t, int64(5), score)
+	require.Equal(t, int64(0), subscore)
+}
+
+func TestLeaderboardGroupAggregateCalculateEmpty(t *testing.T) {
+	score, subscore := leaderboardGroupAggregateCalculate(nil, LeaderboardAggregateOperatorAverage, LeaderboardSortOrderDescending)
+	require.Equal(t, int64(0), score)
+	require.Equal(t, int64(0), subscore)
+}
+
+func leaderboardGroupAggregateRecord(t *testing.T, db *sql.DB, id string, groupID uuid.UUID) (int64, int32, bool) {
+	var score int64
+	var numScore int32
+	err := db.QueryRow("SELECT score, num_score FROM leaderboard_record WHERE leaderboard_id = $1 AND owner_id = $2", id, groupID).Scan(&score, &numScore)
+	if err == sql.ErrNoRows {
+		return 0, 0, false
+	}
+	require.NoError(t, err)
+	return score, numScore, true
+}
+
+func TestLeaderboardGroupAggregateMembership(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	rankCache := NewLocalLeaderboardRankCache(ctx, logger, db, config.Leaderboard, lbCache)
+	tracker := &LocalTracker{}
+	router := &DummyMessageRouter{}
+
+	sourceId := uuid.Must(uuid.NewV4()).String()
+	_, _, err := lbCache.Create(ctx, sourceId, false, LeaderboardSortOrderDescending, LeaderboardOperatorBest, "", "")
+	require.NoError(t, err)
+	aggregateId := uuid.Must(uuid.NewV4()).String()
+	_, created, err := LeaderboardGroupAggregateCreate(ctx, logger, db, lbCache, rankCache, aggregateId, sourceId, LeaderboardAggregateOperatorSum, "")
+	require.NoError(t, err)
+	require.True(t, created)
+
+	creatorID, memberID, otherID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	for _, userID := range []uuid.UUID{creatorID, memberID, otherID} {
+		InsertUser(t, db, userID)
+	}
+	group, err := CreateGroup(ctx, logger, db, groupIdx, creatorID, creatorID, uuid.Must(uuid.NewV4()).String(), "en", "", "", "", true, 10)
+	require.NoError(t, err)
+	groupID := uuid.FromStringOrNil(group.Id)
+
+	// A member's record write updates their group.
+	_, err = LeaderboardRecordWrite(ctx, logger, db, lbCache, rankCache, uuid.Nil, sourceId, creatorID.String(), creatorID.String(), 10, 0, "", api.Operator_NO_OVERRIDE)
+	require.NoError(t, err)
+	score, _, found := leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.True(t, found)
+	require.EqualValues(t, 10, score)
+	require.NotZero(t, rankCache.Get(aggregateId, 0, groupID))
+
+	// Records held before joining count once the user joins.
+	_, err = LeaderboardRecordWrite(ctx, logger, db, lbCache, rankCache, uuid.Nil, sourceId, memberID.String(), memberID.String(), 5, 0, "", api.Operator_NO_OVERRIDE)
+	require.NoError(t, err)
+	require.NoError(t, AddGroupUsers(ctx, logger, db, lbCache, rankCache, tracker, router, uuid.Nil, groupID, []uuid.UUID{memberID}))
+	score, numScore, _ := leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.EqualValues(t, 15, score)
+
+	// A user with no record joining leaves the aggregate untouched.
+	require.NoError(t, AddGroupUsers(ctx, logger, db, lbCache, rankCache, tracker, router, uuid.Nil, groupID, []uuid.UUID{otherID}))
+	score, unchangedNumScore, _ := leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.EqualValues(t, 15, score)
+	require.Equal(t, numScore, unchangedNumScore)
+
+	require.NoError(t, KickGroupUsers(ctx, logger, db, lbCache, rankCache, tracker, router, nil, uuid.Nil, groupID, []uuid.UUID{memberID}, true))
+	score, _, _ = leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.EqualValues(t, 10, score)
+
+	// Once no member holds a record the group drops off the aggregate.
+	require.NoError(t, LeaderboardRecordDelete(ctx, logger, db, lbCache, rankCache, uuid.Nil, sourceId, creatorID.String()))
+	_, _, found = leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.False(t, found)
+	require.Zero(t, rankCache.Get(aggregateId, 0, groupID))
+}
+
+func TestLeaderboardGroupAggregateGroupDelete(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	rankCache := NewLocalLeaderboardRankCache(ctx, logger, db, config.Leaderboard, lbCache)
+
+	sourceId := uuid.Must(uuid.NewV4()).String()
+	_, _, err := lbCache.Create(ctx, sourceId, false, LeaderboardSortOrderDescending, LeaderboardOperatorBest, "", "")
+	require.NoError(t, err)
+	aggregateId := uuid.Must(uuid.NewV4()).String()
+	_, _, err = LeaderboardGroupAggregateCreate(ctx, logger, db, lbCache, rankCache, aggregateId, sourceId, LeaderboardAggregateOperatorBest, "")
+	require.NoError(t, err)
+
+	creatorID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, creatorID)
+	group, err := CreateGroup(ctx, logger, db, groupIdx, creatorID, creatorID, uuid.Must(uuid.NewV4()).String(), "en", "", "", "", true, 10)
+	require.NoError(t, err)
+	groupID := uuid.FromStringOrNil(group.Id)
+
+	_, err = LeaderboardRecordWrite(ctx, logger, db, lbCache, rankCache, uuid.Nil, sourceId, creatorID.String(), creatorID.String(), 7, 0, "", api.Operator_NO_OVERRIDE)
+	require.NoError(t, err)
+	_, _, found := leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.True(t, found)
+
+	require.NoError(t, DeleteGroup(ctx, logger, db, lbCache, rankCache, groupIdx, groupID, uuid.Nil))
+	_, _, found = leaderboardGroupAggregateRecord(t, db, aggregateId, groupID)
+	require.False(t, found)
+	require.Zero(t, rankCache.Get(aggregateId, 0, groupID))
+}
+
+func TestLeaderboardGroupAggregateAccountDelete(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	sessionCache := NewLocalSessionCache(cfg.GetSession().TokenExpirySec, cfg.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	rankCache := NewLocalLeaderboardRankCache(ctx, logger, db, cfg.GetLeaderboard(), lbCache)
+	tracker := &LocalTracker{}
+	router := &DummyMessageRouter{}
+
+	sourceId := uuid.Must(uuid.NewV4()).String()
+	_, _, err := lbCache.Create(ctx, sourceId, false, LeaderboardSortOrderDescending, LeaderboardOperatorBest, "", "")
+	require.NoError(t, err)
+	aggregateId := uuid.Must(uuid.NewV4()).String()
+	_, _, err = LeaderboardGroupAggregateCreate(ctx, logger, db, lbCache, rankCache, aggregateId, sourceId, LeaderboardAggregateOperatorSum, "")
+	require.NoError(t, err)
+
+	ownerID, memberID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, ownerID)
+	InsertUser(t, db, memberID)
+	owned, err := CreateGroup(ctx, logger, db, groupIdx, ownerID, ownerID, uuid.Must(uuid.NewV4()).String(), "en", "", "", "", true, 10)
+	require.NoError(t, err)
+	ownedID := uuid.FromStringOrNil(owned.Id)
+	joined, err := CreateGroup(ctx, logger, db, groupIdx, memberID, memberID, uuid.Must(uuid.NewV4()).String(), "en", "", "", "", true, 10)
+	require.NoError(t, err)
+	joinedID := uuid.FromStringOrNil(joined.Id)
+	require.NoError(t, AddGroupUsers(ctx, logger, db, lbCache, rankCache, tracker, router, uuid.Nil, joinedID, []uuid.UUID{ownerID}))
+
+	_, err = LeaderboardRecordWrite(ctx, logger, db, lbCache, rankCache, uuid.Nil, sourceId, ownerID.String(), ownerID.String(), 10, 0, "", api.Operator_NO_OVERRIDE)
+	require.NoError(t, err)
+	_, err = LeaderboardRecordWrite(ctx, logger, db, lbCache, rankCache, uuid.Nil, sourceId, memberID.String(), memberID.String(), 5, 0, "", api.Operator_NO_OVERRIDE)
+	require.NoError(t, err)
+	score, _, _ := leaderboardGroupAggregateRecord(t, db, aggregateId, joinedID)
+	require.EqualValues(t, 15, score)
+
+	// The group deleted with its only superadmin loses its aggregate record, and the group they left no longer counts their record.
+	require.NoError(t, DeleteAccount(ctx, logger, db, cfg, metrics, lbCache, rankCache, storageIdx, storageCollections, groupIdx, NewLocalSessionRegistry(metrics), sessionCache, tracker, router, ownerID, false))
+	_, _, found := leaderboardGroupAggregateRecord(t, db, aggregateId, ownedID)
+	require.False(t, found)
+	require.Zero(t, rankCache.Get(aggregateId, 0, ownedID))
+	score, _, _ = leaderboardGroupAggregateRecord(t, db, aggregateId, joinedID)
+	require.EqualValues(t, 5, score)
+}
+
+func TestLeaderboardGroupAggregateSourceDelete(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	rankCache := NewLocalLeaderboardRankCache(ctx, logger, db, cfg.GetLeaderboard(), lbCache)
+	scheduler := NewLocalLeaderboardScheduler(logger, db, cfg, lbCache, rankCache)
+
+	sourceId := uuid.Must(uuid.NewV4()).String()
+	_, _, err := lbCache.Create(ctx, sourceId, false, LeaderboardSortOrderDescending, LeaderboardOperatorBest, "", "")
+	require.NoError(t, err)
+	aggregateId := uuid.Must(uuid.NewV4()).String()
+	_, _, err = LeaderboardGroupAggregateCreate(ctx, logger, db, lbCache, rankCache, aggregateId, sourceId, LeaderboardAggregateOperatorSum, "")
+	require.NoError(t, err)
+
+	// Deleting the source leaderboard deletes its aggregates with it.
+	_, err = lbCache.Delete(ctx, rankCache, scheduler, sourceId)
+	require.NoError(t, err)
+	require.Nil(t, lbCache.Get(aggregateId))
+	require.Empty(t, lbCache.ListGroupAggregates(sourceId))
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM leaderboard WHERE id = $1", aggregateId).Scan(&count))
+	require.Zero(t, count)
+}
@@ -0,0 +1,513 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrLeagueNotFound      = errors.New("league not found")
+	ErrLeagueInvalidConfig = errors.New("league configuration invalid")
+	ErrLeagueNotMember     = errors.New("league member not found")
+)
+
+// League is a set of tournaments, one per tier, that share a reset schedule. Members of each tier are bucketed into
+// cohorts, and at every reset the best players of each cohort are promoted one tier up and the worst are relegated.
+type League struct {
+	Id            string
+	Tiers         []string // Tournament IDs, lowest tier first.
+	CohortSize    int
+	PromoteCount  int
+	RelegateCount int
+	Metadata      string
+}
+
+// LeagueCohort describes the cohort a league member is currently competing in.
+type LeagueCohort struct {
+	LeagueId     string
+	TournamentId string
+	Tier         int
+	Cohort       int
+	OwnerIds     []string
+	Records      []*api.LeaderboardRecord
+}
+
+type leagueMember struct {
+	OwnerID  uuid.UUID
+	Username string
+	Tier     int
+	Cohort   int
+}
+
+type leagueStanding struct {
+	Score    int64
+	Subscore int64
+}
+
+func LeagueCreate(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, id string, tiers []string, cohortSize, promoteCount, relegateCount int, metadata string) error {
+	if err := leagueCheckConfig(leaderboardCache, tiers, cohortSize, promoteCount, relegateCount); err != nil {
+		logger.Error("Error while creating league", zap.Error(err), zap.String("league_id", id))
+		return err
+	}
+
+	tiersJSON, err := json.Marshal(tiers)
+	if err != nil {
+		return err
+	}
+
+	if metadata == "" {
+		metadata = "{}"
+	}
+
+	// Creation is an idempotent operation.
+	query := `INSERT INTO league (id, tiers, cohort_size, promote_count, relegate_count, metadata)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (id) DO NOTHING`
+	if _, err := db.ExecContext(ctx, query, id, tiersJSON, cohortSize, promoteCount, relegateCount, metadata); err != nil {
+		logger.Error("Error creating league", zap.Error(err), zap.String("league_id", id))
+		return err
+	}
+
+	return nil
+}
+
+func LeagueDelete(ctx context.Context, logger *zap.Logger, db *sql.DB, id string) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM league WHERE id = $1", id); err != nil {
+		logger.Error("Error deleting league", zap.Error(err), zap.String("league_id", id))
+		return err
+	}
+	return nil
+}
+
+// LeagueJoin places the owner in the lowest tier of the league, in the first cohort that still has space. Joining is
+// idempotent, owners that are already members keep their current tier and cohort.
+func LeagueJoin(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, id string, ownerID uuid.UUID) (*LeagueCohort, error) {
+	league, err := leagueGet(ctx, db, id)
+	if err != nil {
+		logger.Error("Error retrieving league", zap.Error(err), zap.String("league_id", id))
+		return nil, err
+	}
+	if league == nil {
+		return nil, ErrLeagueNotFound
+	}
+
+	var username string
+	if err := db.QueryRowContext(ctx, "SELECT username FROM users WHERE id = $1", ownerID).Scan(&username); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAccountNotFound
+		}
+		logger.Error("Error retrieving user to join league", zap.Error(err), zap.String("league_id", id))
+		return nil, err
+	}
+
+	if err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		query := `SELECT cohort FROM league_member
+WHERE league_id = $1 AND tier = 0
+GROUP BY cohort
+HAVING count(*) < $2
+ORDER BY cohort ASC
+LIMIT 1`
+		var cohort int
+		if err := tx.QueryRowContext(ctx, query, id, league.CohortSize).Scan(&cohort); err != nil {
+			if err != sql.ErrNoRows {
+				return err
+			}
+			// All cohorts in the lowest tier are full, open a new one.
+			var maxCohort sql.NullInt64
+			if err := tx.QueryRowContext(ctx, "SELECT max(cohort) FROM league_member WHERE league_id = $1 AND tier = 0", id).Scan(&maxCohort); err != nil {
+				return err
+			}
+			if maxCohort.Valid {
+				cohort = int(maxCohort.Int64) + 1
+			}
+		}
+
+		query = `INSERT INTO league_member (league_id, owner_id, tier, cohort)
+VALUES ($1, $2, 0, $3)
+ON CONFLICT (league_id, owner_id) DO NOTHING`
+		_, err := tx.ExecContext(ctx, query, id, ownerID, cohort)
+		return err
+	}); err != nil {
+		logger.Error("Error joining league", zap.Error(err), zap.String("league_id", id), zap.String("owner_id", ownerID.String()))
+		return nil, err
+	}
+
+	member, err := leagueMemberGet(ctx, db, id, ownerID)
+	if err != nil {
+		logger.Error("Error retrieving league member", zap.Error(err), zap.String("league_id", id))
+		return nil, err
+	}
+	if member == nil {
+		// Removed concurrently.
+		return nil, ErrLeagueNotMember
+	}
+
+	if tier := leaderboardCache.Get(league.Tiers[member.Tier]); tier != nil && tier.JoinRequired {
+		if err := TournamentJoin(ctx, logger, db, leaderboardCache, rankCache, ownerID, username, tier.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	return leagueCohortGet(ctx, logger, db, leaderboardCache, rankCache, league, member)
+}
+
+func LeagueLeave(ctx context.Context, logger *zap.Logger, db *sql.DB, id string, ownerID uuid.UUID) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM league_member WHERE league_id = $1 AND owner_id = $2", id, ownerID); err != nil {
+		logger.Error("Error leaving league", zap.Error(err), zap.String("league_id", id), zap.String("owner_id", ownerID.String()))
+		return err
+	}
+	return nil
+}
+
+// LeagueCohortGet returns the tier and cohort the owner is currently assigned to, along with the current records of
+// all cohort members in that tier's tournament.
+func LeagueCohortGet(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, id string, ownerID uuid.UUID) (*LeagueCohort, error) {
+	league, err := leagueGet(ctx, db, id)
+	if err != nil {
+		logger.Error("Error retrieving league", zap.Error(err), zap.String("league_id", id))
+		return nil, err
+	}
+	if league == nil {
+		return nil, ErrLeagueNotFound
+	}
+
+	member, err := leagueMemberGet(ctx, db, id, ownerID)
+	if err != nil {
+		logger.Error("Error retrieving league member", zap.Error(err), zap.String("league_id", id))
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrLeagueNotMember
+	}
+
+	return leagueCohortGet(ctx, logger, db, leaderboardCache, rankCache, league, member)
+}
+
+func leagueCohortGet(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, league *League, member *leagueMember) (*LeagueCohort, error) {
+	rows, err := db.QueryContext(ctx, "SELECT owner_id FROM league_member WHERE league_id = $1 AND tier = $2 AND cohort = $3", league.Id, member.Tier, member.Cohort)
+	if err != nil {
+		logger.Error("Error listing league cohort members", zap.Error(err), zap.String("league_id", league.Id))
+		return nil, err
+	}
+	ownerIDs := make([]string, 0, league.CohortSize)
+	for rows.Next() {
+		var dbOwnerID uuid.UUID
+		if err := rows.Scan(&dbOwnerID); err != nil {
+			_ = rows.Close()
+			logger.Error("Error scanning league cohort members", zap.Error(err), zap.String("league_id", league.Id))
+			return nil, err
+		}
+		ownerIDs = append(ownerIDs, dbOwnerID.String())
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		logger.Error("Error listing league cohort members", zap.Error(err), zap.String("league_id", league.Id))
+		return nil, err
+	}
+
+	tournamentID := league.Tiers[member.Tier]
+	records, err := TournamentRecordsList(ctx, logger, db, leaderboardCache, rankCache, tournamentID, ownerIDs, nil, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeagueCohort{
+		LeagueId:     league.Id,
+		TournamentId: tournamentID,
+		Tier:         member.Tier,
+		Cohort:       member.Cohort,
+		OwnerIds:     ownerIDs,
+		Records:      records.OwnerRecords,
+	}, nil
+}
+
+// LeagueProcessReset applies promotions and relegations for a league whose tiers have just reached the reset that
+// expires records at the given time, then reassigns all members to fresh cohorts within their new tiers.
+func LeagueProcessReset(ctx context.Context, logger *zap.Logger, db *sql.DB, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, league *League, expiryTime int64) error {
+	query := `SELECT lm.owner_id, u.username, lm.tier, lm.cohort
+FROM league_member lm, users u
+WHERE lm.league_id = $1 AND lm.owner_id = u.id`
+	rows, err := db.QueryContext(ctx, query, league.Id)
+	if err != nil {
+		return err
+	}
+	members := make([]*leagueMember, 0, 10)
+	for rows.Next() {
+		member := &leagueMember{}
+		if err := rows.Scan(&member.OwnerID, &member.Username, &member.Tier, &member.Cohort); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		members = append(members, member)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	previousTiers := make(map[uuid.UUID]int, len(members))
+	for _, member := range members {
+		previousTiers[member.OwnerID] = member.Tier
+	}
+
+	// Collect the final standings of the period that just ended in each tier.
+	standings := make(map[uuid.UUID]*leagueStanding, len(members))
+	sortOrders := make([]int, len(league.Tiers))
+	for i, tournamentID := range league.Tiers {
+		tournament := leaderboardCache.Get(tournamentID)
+		if tournament == nil {
+			logger.Warn("League tier tournament not found", zap.String("league_id", league.Id), zap.String("tournament_id", tournamentID))
+			continue
+		}
+		sortOrders[i] = tournament.SortOrder
+
+		rows, err := db.QueryContext(ctx, "SELECT owner_id, score, subscore FROM leaderboard_record WHERE leaderboard_id = $1 AND expiry_time = $2", tournamentID, time.Unix(expiryTime, 0).UTC())
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var dbOwnerID uuid.UUID
+			standing := &leagueStanding{}
+			if err := rows.Scan(&dbOwnerID, &standing.Score, &standing.Subscore); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			if tier, found := previousTiers[dbOwnerID]; found && tier == i {
+				// Only count records members submitted to their own tier.
+				standings[dbOwnerID] = standing
+			}
+		}
+		_ = rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	leagueCalculateTiers(members, standings, sortOrders, len(league.Tiers), league.PromoteCount, league.RelegateCount)
+	leagueAssignCohorts(members, league.CohortSize)
+
+	if err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		for _, member := range members {
+			if _, err := tx.ExecContext(ctx, "UPDATE league_member SET tier = $3, cohort = $4, update_time = now() WHERE league_id = $1 AND owner_id = $2", league.Id, member.OwnerID, member.Tier, member.Cohort); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Members that changed tier must be able to submit scores to their new tier straight away.
+	var promoted, relegated int
+	for _, member := range members {
+		previousTier := previousTiers[member.OwnerID]
+		if member.Tier == previousTier {
+			continue
+		}
+		if member.Tier > previousTier {
+			promoted++
+		} else {
+			relegated++
+		}
+		tier := leaderboardCache.Get(league.Tiers[member.Tier])
+		if tier == nil || !tier.JoinRequired {
+			continue
+		}
+		if err := TournamentJoin(ctx, logger, db, leaderboardCache, rankCache, member.OwnerID, member.Username, tier.Id); err != nil {
+			logger.Warn("Failed to join league member to new tier", zap.Error(err), zap.String("league_id", league.Id), zap.String("tournament_id", tier.Id), zap.String("owner_id", member.OwnerID.String()))
+		}
+	}
+
+	logger.Info("League reset processed", zap.String("league_id", league.Id), zap.Int("members", len(members)), zap.Int("promoted", promoted), zap.Int("relegated", relegated))
+	return nil
+}
+
+// LeaguesGetByEntryTier returns all leagues whose lowest tier is the given tournament. League processing is driven by
+// resets of this tournament, all other tiers share the same schedule.
+func LeaguesGetByEntryTier(ctx context.Context, db *sql.DB, tournamentID string) ([]*League, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, tiers, cohort_size, promote_count, relegate_count, metadata FROM league WHERE tiers->>0 = $1", tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leagues := make([]*League, 0, 1)
+	for rows.Next() {
+		league, err := parseLeague(rows)
+		if err != nil {
+			return nil, err
+		}
+		leagues = append(leagues, league)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return leagues, nil
+}
+
+func leagueGet(ctx context.Context, db *sql.DB, id string) (*League, error) {
+	row := db.QueryRowContext(ctx, "SELECT id, tiers, cohort_size, promote_count, relegate_count, metadata FROM league WHERE id = $1", id)
+	league, err := parseLeague(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return league, nil
+}
+
+func leagueMemberGet(ctx context.Context, db *sql.DB, id string, ownerID uuid.UUID) (*leagueMember, error) {
+	member := &leagueMember{OwnerID: ownerID}
+	if err := db.QueryRowContext(ctx, "SELECT tier, cohort FROM league_member WHERE league_id = $1 AND owner_id = $2", id, ownerID).Scan(&member.Tier, &member.Cohort); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+func parseLeague(scannable Scannable) (*League, error) {
+	var dbTiers []byte
+	league := &League{}
+	if err := scannable.Scan(&league.Id, &dbTiers, &league.CohortSize, &league.PromoteCount, &league.RelegateCount, &league.Metadata); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dbTiers, &league.Tiers); err != nil {
+		return nil, err
+	}
+	if len(league.Tiers) == 0 {
+		return nil, ErrLeagueInvalidConfig
+	}
+	return league, nil
+}
+
+func leagueCheckConfig(leaderboardCache LeaderboardCache, tiers []string, cohortSize, promoteCount, relegateCount int) error {
+	if len(tiers) == 0 {
+		return ErrLeagueInvalidConfig
+	}
+	if cohortSize < 1 || promoteCount < 0 || relegateCount < 0 || promoteCount+relegateCount > cohortSize {
+		return ErrLeagueInvalidConfig
+	}
+
+	seen := make(map[string]struct{}, len(tiers))
+	var resetSchedule string
+	for i, id := range tiers {
+		if _, found := seen[id]; found {
+			return ErrLeagueInvalidConfig
+		}
+		seen[id] = struct{}{}
+
+		tournament := leaderboardCache.Get(id)
+		if tournament == nil || !tournament.IsTournament() {
+			return runtime.ErrTournamentNotFound
+		}
+		// All tiers must roll over together so promotions and relegations land in an empty period.
+		if tournament.ResetScheduleStr == "" || (i > 0 && tournament.ResetScheduleStr != resetSchedule) {
+			return ErrLeagueInvalidConfig
+		}
+		resetSchedule = tournament.ResetScheduleStr
+	}
+
+	return nil
+}
+
+// leagueCalculateTiers updates the tier of each member based on their standing within their cohort. Members without
+// a record in the period are ranked last and are never promoted.
+func leagueCalculateTiers(members []*leagueMember, standings map[uuid.UUID]*leagueStanding, sortOrders []int, numTiers, promoteCount, relegateCount int) {
+	type cohortKey struct {
+		tier   int
+		cohort int
+	}
+	cohorts := make(map[cohortKey][]*leagueMember)
+	for _, member := range members {
+		key := cohortKey{tier: member.Tier, cohort: member.Cohort}
+		cohorts[key] = append(cohorts[key], member)
+	}
+
+	for key, cohort := range cohorts {
+		ascending := sortOrders[key.tier] == LeaderboardSortOrderAscending
+		sort.Slice(cohort, func(i, j int) bool {
+			si, sj := standings[cohort[i].OwnerID], standings[cohort[j].OwnerID]
+			switch {
+			case si == nil && sj == nil:
+				return cohort[i].OwnerID.String() < cohort[j].OwnerID.String()
+			case si == nil:
+				return false
+			case sj == nil:
+				return true
+			}
+			if si.Score != sj.Score {
+				return (si.Score < sj.Score) == ascending
+			}
+			if si.Subscore != sj.Subscore {
+				return (si.Subscore < sj.Subscore) == ascending
+			}
+			return cohort[i].OwnerID.String() < cohort[j].OwnerID.String()
+		})
+
+		promoted := 0
+		if key.tier < numTiers-1 {
+			for _, member := range cohort {
+				if promoted >= promoteCount || standings[member.OwnerID] == nil {
+					break
+				}
+				member.Tier++
+				promoted++
+			}
+		}
+
+		if key.tier > 0 {
+			// Never relegate a member that was just promoted out of a small cohort.
+			for i := len(cohort) - 1; i >= promoted && i >= len(cohort)-relegateCount; i-- {
+				cohort[i].Tier--
+			}
+		}
+	}
+}
+
+// leagueAssignCohorts shuffles the members of each tier into new cohorts of at most cohortSize members.
+func leagueAssignCohorts(members []*leagueMember, cohortSize int) {
+	tiers := make(map[int][]*leagueMember)
+	for _, member := range members {
+		tiers[member.Tier] = append(tiers[member.Tier], member)
+	}
+
+	for _, tier := range tiers {
+		rand.Shuffle(len(tier), func(i, j int) {
+			tier[i], tier[j] = tier[j], tier[i]
+		})
+		for i, member := range tier {
+			member.Cohort = i / cohortSize
+		}
+	}
+}
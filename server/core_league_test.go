@@ -0,0 +1,103 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeagueCalculateTiersPromoteRelegate(t *testing.T) {
+	members := make([]*leagueMember, 0, 5)
+	standings := make(map[uuid.UUID]*leagueStanding, 5)
+	for i := 0; i < 5; i++ {
+		member := &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: 1, Cohort: 0}
+		members = append(members, member)
+		standings[member.OwnerID] = &leagueStanding{Score: int64(i * 10)}
+	}
+
+	leagueCalculateTiers(members, standings, []int{LeaderboardSortOrderDescending, LeaderboardSortOrderDescending, LeaderboardSortOrderDescending}, 3, 1, 2)
+
+	tiers := make(map[int64]int, len(members))
+	for _, member := range members {
+		tiers[standings[member.OwnerID].Score] = member.Tier
+	}
+	require.Equal(t, 2, tiers[40], "Best score should be promoted.")
+	require.Equal(t, 1, tiers[30])
+	require.Equal(t, 1, tiers[20])
+	require.Equal(t, 0, tiers[10], "Worst scores should be relegated.")
+	require.Equal(t, 0, tiers[0], "Worst scores should be relegated.")
+}
+
+func TestLeagueCalculateTiersAscending(t *testing.T) {
+	best := &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: 0}
+	worst := &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: 0}
+	standings := map[uuid.UUID]*leagueStanding{
+		best.OwnerID:  {Score: 5},
+		worst.OwnerID: {Score: 50},
+	}
+
+	leagueCalculateTiers([]*leagueMember{worst, best}, standings, []int{LeaderboardSortOrderAscending, LeaderboardSortOrderAscending}, 2, 1, 1)
+
+	require.Equal(t, 1, best.Tier, "Lowest score should be promoted in ascending tiers.")
+	require.Equal(t, 0, worst.Tier, "Lowest tier cannot relegate.")
+}
+
+func TestLeagueCalculateTiersNoRecord(t *testing.T) {
+	scored := &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: 1}
+	idle1 := &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: 1}
+	idle2 := &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: 1}
+	standings := map[uuid.UUID]*leagueStanding{
+		scored.OwnerID: {Score: 1},
+	}
+
+	leagueCalculateTiers([]*leagueMember{idle1, scored, idle2}, standings, []int{LeaderboardSortOrderDescending, LeaderboardSortOrderDescending, LeaderboardSortOrderDescending}, 3, 2, 1)
+
+	require.Equal(t, 2, scored.Tier, "Member with a record should be promoted.")
+	require.Equal(t, 1, idle1.Tier+idle2.Tier, "Members without a record are never promoted and one is relegated.")
+}
+
+func TestLeagueCalculateTiersSmallCohort(t *testing.T) {
+	member := &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: 1}
+	standings := map[uuid.UUID]*leagueStanding{
+		member.OwnerID: {Score: 1},
+	}
+
+	leagueCalculateTiers([]*leagueMember{member}, standings, []int{LeaderboardSortOrderDescending, LeaderboardSortOrderDescending, LeaderboardSortOrderDescending}, 3, 1, 1)
+
+	require.Equal(t, 2, member.Tier, "Promoted member must not also be relegated.")
+}
+
+func TestLeagueAssignCohorts(t *testing.T) {
+	members := make([]*leagueMember, 0, 12)
+	for i := 0; i < 12; i++ {
+		members = append(members, &leagueMember{OwnerID: uuid.Must(uuid.NewV4()), Tier: i % 2, Cohort: 9})
+	}
+
+	leagueAssignCohorts(members, 4)
+
+	counts := make(map[[2]int]int)
+	for _, member := range members {
+		counts[[2]int{member.Tier, member.Cohort}]++
+	}
+	require.Equal(t, map[[2]int]int{
+		{0, 0}: 4,
+		{0, 1}: 2,
+		{1, 0}: 4,
+		{1, 1}: 2,
+	}, counts)
+}
@@ -25,7 +25,6 @@ import (
 	"github.com/heroiclabs/nakama/v3/social"
 	"github.com/jackc/pgconn"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -156,7 +155,7 @@ func LinkDevice(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid
 	return nil
 }
 
-func LinkEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, email, password string) error {
+func LinkEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, userID uuid.UUID, email, password string) error {
 	if email == "" || password == "" {
 		return status.Error(codes.InvalidArgument, "Email address and password is required.")
 	} else if invalidCharsRegex.MatchString(email) {
@@ -170,11 +169,12 @@ func LinkEmail(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.
 	}
 
 	cleanEmail := strings.ToLower(email)
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, _ := HashPassword(config, password)
 
 	res, err := db.ExecContext(ctx, `
 UPDATE users
-SET email = $2, password = $3, update_time = now()
+SET email = $2, password = $3, update_time = now(),
+    verify_time = CASE WHEN email IS DISTINCT FROM $2 THEN '1970-01-01 00:00:00 UTC' ELSE verify_time END
 WHERE (id = $1)
 AND (NOT EXISTS
     (SELECT id
@@ -24,13 +24,14 @@ import (
 	"go.uber.org/zap"
 )
 
-func MultiUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, accountUpdates []*accountUpdate, storageWrites StorageOpWrites, storageDeletes StorageOpDeletes, storageIndex StorageIndex, walletUpdates []*walletUpdate, updateLedger bool) ([]*api.StorageObjectAck, []*runtime.WalletUpdateResult, error) {
+func MultiUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, accountUpdates []*accountUpdate, storageWrites StorageOpWrites, storageDeletes StorageOpDeletes, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, walletUpdates []*walletUpdate, updateLedger bool) ([]*api.StorageObjectAck, []*runtime.WalletUpdateResult, error) {
 	if len(accountUpdates) == 0 && len(storageWrites) == 0 && len(storageDeletes) == 0 && len(walletUpdates) == 0 {
 		return nil, nil, nil
 	}
 
 	var storageWriteAcks []*api.StorageObjectAck
-	var storageWriteOps StorageOpWrites
+	var storageWritten []*api.StorageObject
+	var storageDeleted map[*StorageOpDelete]int32
 	var walletUpdateResults []*runtime.WalletUpdateResult
 
 	if err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
@@ -44,13 +45,14 @@ func MultiUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Me
 		}
 
 		// Execute any storage updates.
-		storageWriteOps, storageWriteAcks, updateErr = storageWriteObjects(ctx, logger, metrics, tx, true, storageWrites)
+		storageWriteAcks, storageWritten, updateErr = storageWriteObjects(ctx, logger, metrics, storageCollections, tx, true, storageWrites)
 		if updateErr != nil {
 			return updateErr
 		}
 
 		// Execute any storage deletes.
-		deleteErr := storageDeleteObjects(ctx, logger, tx, true, storageDeletes)
+		var deleteErr error
+		storageDeleted, deleteErr = storageDeleteObjects(ctx, logger, storageCollections, tx, true, storageDeletes)
 		if deleteErr != nil {
 			return deleteErr
 		}
@@ -71,8 +73,12 @@ func MultiUpdate(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Me
 	}
 
 	// Update storage index.
-	storageIndexWrite(ctx, storageIndex, storageWriteOps, storageWriteAcks)
+	storageIndex.Write(ctx, storageWritten)
 	storageIndex.Delete(ctx, storageDeletes)
 
+	// Notify storage subscribers.
+	storagePublishChanges(logger, tracker, router, storageWriteChanges(storageWritten))
+	storagePublishChanges(logger, tracker, router, storageDeleteChanges(storageDeletes, storageDeleted))
+
 	return storageWriteAcks, walletUpdateResults, nil
 }
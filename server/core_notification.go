@@ -32,14 +32,24 @@ import (
 )
 
 const (
-	NotificationCodeDmRequest        int32 = -1
-	NotificationCodeFriendRequest    int32 = -2
-	NotificationCodeFriendAccept     int32 = -3
-	NotificationCodeGroupAdd         int32 = -4
-	NotificationCodeGroupJoinRequest int32 = -5
-	NotificationCodeFriendJoinGame   int32 = -6
-	NotificationCodeSingleSocket     int32 = -7
-	NotificationCodeUserBanned       int32 = -8
+	NotificationCodeDmRequest         int32 = -1
+	NotificationCodeFriendRequest     int32 = -2
+	NotificationCodeFriendAccept      int32 = -3
+	NotificationCodeGroupAdd          int32 = -4
+	NotificationCodeGroupJoinRequest  int32 = -5
+	NotificationCodeFriendJoinGame    int32 = -6
+	NotificationCodeSingleSocket      int32 = -7
+	NotificationCodeUserBanned        int32 = -8
+	NotificationCodeGroupInvite       int32 = -9
+	NotificationCodeGroupInviteAccept int32 = -10
+	NotificationCodeGroupInviteReject int32 = -11
+	NotificationCodeSessionRevoked    int32 = -12
+	NotificationCodeAccountExport     int32 = -13
+	NotificationCodeTradePropose      int32 = -14
+	NotificationCodeTradeCounter      int32 = -15
+	NotificationCodeTradeAccept       int32 = -16
+	NotificationCodeTradeCancel       int32 = -17
+	NotificationCodeTradeExpire       int32 = -18
 )
 
 type notificationCacheableCursor struct {
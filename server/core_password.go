@@ -0,0 +1,158 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordAlgorithmBcrypt   = "bcrypt"
+	PasswordAlgorithmArgon2id = "argon2id"
+
+	passwordArgon2idPrefix = "$argon2id$"
+)
+
+var ErrPasswordHashInvalid = errors.New("password hash invalid")
+
+// Parameters of an Argon2id hash, as stored in the PHC string format.
+type passwordArgon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// HashPassword hashes a password with the configured algorithm. Argon2id hashes use the PHC string format and bcrypt
+// hashes their standard format, so every hash records the algorithm and parameters it was created with.
+func HashPassword(config Config, password string) ([]byte, error) {
+	passwordConfig := config.GetPassword()
+	switch passwordConfig.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		salt := make([]byte, passwordConfig.Argon2idSaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		params := &passwordArgon2idParams{
+			memory:      uint32(passwordConfig.Argon2idMemoryKib),
+			iterations:  uint32(passwordConfig.Argon2idIterations),
+			parallelism: uint8(passwordConfig.Argon2idParallelism),
+			salt:        salt,
+		}
+		params.key = argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(passwordConfig.Argon2idKeyLength))
+		return params.encode(), nil
+	default:
+		return bcrypt.GenerateFromPassword([]byte(password), passwordConfig.BcryptCost)
+	}
+}
+
+// ComparePassword checks a password against a hash created with any supported algorithm. If the password matches,
+// rehash reports whether the hash was created with a different algorithm or parameters than are now configured and
+// should be replaced with a new hash of the same password.
+func ComparePassword(config Config, hash []byte, password string) (match, rehash bool) {
+	passwordConfig := config.GetPassword()
+
+	if bytes.HasPrefix(hash, []byte(passwordArgon2idPrefix)) {
+		params, err := decodePasswordArgon2id(hash)
+		if err != nil {
+			return false, false
+		}
+		key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+		if subtle.ConstantTimeCompare(key, params.key) != 1 {
+			return false, false
+		}
+		rehash = passwordConfig.Algorithm != PasswordAlgorithmArgon2id ||
+			params.memory != uint32(passwordConfig.Argon2idMemoryKib) ||
+			params.iterations != uint32(passwordConfig.Argon2idIterations) ||
+			params.parallelism != uint8(passwordConfig.Argon2idParallelism) ||
+			len(params.salt) != passwordConfig.Argon2idSaltLength ||
+			len(params.key) != passwordConfig.Argon2idKeyLength
+		return true, rehash
+	}
+
+	// Anything else is expected to be a bcrypt hash, including all hashes created before the algorithm was configurable.
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return false, false
+	}
+	if passwordConfig.Algorithm != PasswordAlgorithmBcrypt {
+		return true, true
+	}
+	cost, err := bcrypt.Cost(hash)
+	return true, err != nil || cost != passwordConfig.BcryptCost
+}
+
+// Replace a password hash after a successful login if it no longer matches the configured algorithm or parameters.
+// The update only applies if the hash has not been changed concurrently, and failures are logged but otherwise
+// ignored since the login itself has already succeeded.
+func rehashPassword(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, table, id string, oldHash []byte, password string) {
+	newHash, err := HashPassword(config, password)
+	if err != nil {
+		logger.Error("Error rehashing password.", zap.Error(err), zap.String("id", id))
+		return
+	}
+	query := "UPDATE " + table + " SET password = $3 WHERE id = $1 AND password = $2"
+	if _, err = db.ExecContext(ctx, query, id, oldHash, newHash); err != nil {
+		logger.Error("Error updating rehashed password.", zap.Error(err), zap.String("id", id))
+	}
+}
+
+func (p *passwordArgon2idParams) encode() []byte {
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", passwordArgon2idPrefix, argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(p.salt), base64.RawStdEncoding.EncodeToString(p.key)))
+}
+
+func decodePasswordArgon2id(hash []byte) (*passwordArgon2idParams, error) {
+	// Expected format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return nil, ErrPasswordHashInvalid
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrPasswordHashInvalid
+	}
+
+	params := &passwordArgon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, ErrPasswordHashInvalid
+	}
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, ErrPasswordHashInvalid
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrPasswordHashInvalid
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, ErrPasswordHashInvalid
+	}
+
+	return params, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testPasswordConfig(algorithm string) *config {
+	c := NewConfig(logger)
+	c.Password.Algorithm = algorithm
+	c.Password.BcryptCost = bcrypt.MinCost
+	// Keep Argon2id cheap so the tests run quickly.
+	c.Password.Argon2idMemoryKib = 64
+	c.Password.Argon2idIterations = 1
+	c.Password.Argon2idParallelism = 1
+	return c
+}
+
+func TestPasswordArgon2id(t *testing.T) {
+	c := testPasswordConfig(PasswordAlgorithmArgon2id)
+
+	hash, err := HashPassword(c, "password123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	match, rehash := ComparePassword(c, hash, "password123")
+	assert.True(t, match)
+	assert.False(t, rehash)
+
+	match, rehash = ComparePassword(c, hash, "password124")
+	assert.False(t, match)
+	assert.False(t, rehash)
+
+	// Changed parameters are reported on a successful compare.
+	c.Password.Argon2idIterations = 2
+	match, rehash = ComparePassword(c, hash, "password123")
+	assert.True(t, match)
+	assert.True(t, rehash)
+}
+
+func TestPasswordBcryptUpgrade(t *testing.T) {
+	c := testPasswordConfig(PasswordAlgorithmBcrypt)
+
+	hash, err := HashPassword(c, "password123")
+	require.NoError(t, err)
+	match, rehash := ComparePassword(c, hash, "password123")
+	assert.True(t, match)
+	assert.False(t, rehash)
+
+	// A higher cost upgrades existing hashes.
+	c.Password.BcryptCost = bcrypt.MinCost + 1
+	match, rehash = ComparePassword(c, hash, "password123")
+	assert.True(t, match)
+	assert.True(t, rehash)
+
+	// Switching algorithm still accepts existing bcrypt hashes, and upgrades them.
+	c.Password.Algorithm = PasswordAlgorithmArgon2id
+	match, rehash = ComparePassword(c, hash, "password123")
+	assert.True(t, match)
+	assert.True(t, rehash)
+
+	match, _ = ComparePassword(c, hash, "password124")
+	assert.False(t, match)
+}
+
+func TestPasswordInvalidHash(t *testing.T) {
+	c := testPasswordConfig(PasswordAlgorithmArgon2id)
+
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+	} {
+		match, rehash := ComparePassword(c, []byte(hash), "password123")
+		assert.False(t, match, hash)
+		assert.False(t, rehash, hash)
+	}
+}
@@ -164,6 +164,237 @@ func ValidatePurchasesApple(ctx context.Context, logger *zap.Logger, db *sql.DB,
 	}, nil
 }
 
+// Validate a StoreKit 2 signed transaction. The JWS signature and its certificate chain are verified locally, so no
+// request to Apple is needed.
+func ValidatePurchasesAppleSigned(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, config *IAPAppleConfig, signedTransaction string, persist bool) (*api.ValidatePurchaseResponse, error) {
+	if config.BundleId == "" {
+		// Any app's transactions are signed by Apple, so only the bundle ID ties them to this game.
+		return nil, status.Error(codes.FailedPrecondition, "Apple IAP is not configured.")
+	}
+
+	roots, err := iap.ParseRootCertificatesApple(config.RootCertificates)
+	if err != nil {
+		logger.Error("Error parsing Apple root certificates", zap.Error(err))
+		return nil, err
+	}
+
+	transaction, raw, err := iap.DecodeSignedTransactionApple(signedTransaction, roots)
+	if err != nil {
+		logger.Debug("Error validating Apple signed transaction", zap.Error(err))
+		return nil, status.Error(codes.FailedPrecondition, "Invalid signed transaction.")
+	}
+
+	if transaction.BundleId != config.BundleId {
+		return nil, status.Error(codes.FailedPrecondition, "Invalid signed transaction. Bundle ID mismatch.")
+	}
+
+	if transaction.ExpiresDate != 0 || transaction.Type == iap.AppleTransactionTypeAutoRenewableSubscription {
+		return nil, status.Error(codes.FailedPrecondition, "Subscription Receipt. Use the appropriate function instead.")
+	}
+
+	env := api.StoreEnvironment_PRODUCTION
+	if transaction.Environment == iap.AppleSandboxEnvironment {
+		env = api.StoreEnvironment_SANDBOX
+	}
+
+	storagePurchases := []*storagePurchase{{
+		userID:        userID,
+		store:         api.StoreProvider_APPLE_APP_STORE,
+		productId:     transaction.ProductId,
+		transactionId: transaction.TransactionId,
+		rawResponse:   string(raw),
+		purchaseTime:  parseMillisecondUnixTimestamp(transaction.PurchaseDate),
+		refundTime:    parseMillisecondUnixTimestamp(transaction.RevocationDate),
+		environment:   env,
+	}}
+
+	if !persist {
+		// Skip storing the receipts
+		validatedPurchases := make([]*api.ValidatedPurchase, 0, len(storagePurchases))
+		for _, p := range storagePurchases {
+			validatedPurchases = append(validatedPurchases, &api.ValidatedPurchase{
+				UserId:           p.userID.String(),
+				ProductId:        p.productId,
+				TransactionId:    p.transactionId,
+				Store:            p.store,
+				PurchaseTime:     timestamppb.New(p.purchaseTime),
+				RefundTime:       timestamppb.New(p.refundTime),
+				ProviderResponse: string(raw),
+				Environment:      p.environment,
+			})
+		}
+
+		return &api.ValidatePurchaseResponse{ValidatedPurchases: validatedPurchases}, nil
+	}
+
+	purchases, err := upsertPurchases(ctx, db, storagePurchases)
+	if err != nil {
+		return nil, err
+	}
+
+	validatedPurchases := make([]*api.ValidatedPurchase, 0, len(purchases))
+	for _, p := range purchases {
+		suid := p.userID.String()
+		if p.userID.IsNil() {
+			suid = ""
+		}
+		validatedPurchases = append(validatedPurchases, &api.ValidatedPurchase{
+			UserId:           suid,
+			ProductId:        p.productId,
+			TransactionId:    p.transactionId,
+			Store:            p.store,
+			PurchaseTime:     timestamppb.New(p.purchaseTime),
+			CreateTime:       timestamppb.New(p.createTime),
+			UpdateTime:       timestamppb.New(p.updateTime),
+			RefundTime:       timestamppb.New(p.refundTime),
+			ProviderResponse: string(raw),
+			SeenBefore:       p.seenBefore,
+			Environment:      p.environment,
+		})
+	}
+
+	return &api.ValidatePurchaseResponse{
+		ValidatedPurchases: validatedPurchases,
+	}, nil
+}
+
+// List the verified transactions in a customer's App Store purchase history, from any one of their transaction IDs.
+func ListPurchaseHistoryApple(ctx context.Context, logger *zap.Logger, config *IAPAppleConfig, transactionID string) ([]*iap.AppleJWSTransaction, error) {
+	return listTransactionsApple(ctx, logger, config, transactionID, iap.ListTransactionHistoryApple)
+}
+
+// List the verified transactions the App Store refunded to a customer, from any one of their transaction IDs.
+func ListRefundedPurchasesApple(ctx context.Context, logger *zap.Logger, config *IAPAppleConfig, transactionID string) ([]*iap.AppleJWSTransaction, error) {
+	return listTransactionsApple(ctx, logger, config, transactionID, iap.ListRefundHistoryApple)
+}
+
+func listTransactionsApple(ctx context.Context, logger *zap.Logger, config *IAPAppleConfig, transactionID string, listFn func(context.Context, *http.Client, string, string, string) ([]string, error)) ([]*iap.AppleJWSTransaction, error) {
+	if !config.ServerApiEnabled() {
+		return nil, status.Error(codes.FailedPrecondition, "Apple App Store Server API is not configured.")
+	}
+
+	roots, err := iap.ParseRootCertificatesApple(config.RootCertificates)
+	if err != nil {
+		logger.Error("Error parsing Apple root certificates", zap.Error(err))
+		return nil, err
+	}
+
+	token, err := iap.GetServerApiTokenApple(config.IssuerId, config.KeyId, config.BundleId, config.PrivateKey)
+	if err != nil {
+		logger.Error("Error creating Apple App Store Server API token", zap.Error(err))
+		return nil, err
+	}
+
+	signedTransactions, err := listFn(ctx, httpc, config.ServerApiUrl, token, transactionID)
+	if err != nil {
+		if err != context.Canceled {
+			var vErr *iap.ValidationError
+			if errors.As(err, &vErr) {
+				logger.Error("Error listing Apple transactions", zap.Error(vErr.Err), zap.Int("status_code", vErr.StatusCode), zap.String("payload", vErr.Payload))
+			} else {
+				logger.Error("Error listing Apple transactions", zap.Error(err))
+			}
+		}
+		return nil, err
+	}
+
+	transactions := make([]*iap.AppleJWSTransaction, 0, len(signedTransactions))
+	for _, signedTransaction := range signedTransactions {
+		transaction, _, err := iap.DecodeSignedTransactionApple(signedTransaction, roots)
+		if err != nil {
+			logger.Error("Error validating Apple signed transaction", zap.Error(err))
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
+
+// Record an App Store refund or revocation of a one-time purchase, then invoke the runtime purchase notification
+// function with it. Refunds already recorded, for example by validating a revoked transaction, are still delivered to
+// the runtime function if that has not happened yet. Returns sql.ErrNoRows if the purchase was never validated.
+func refundPurchaseApple(ctx context.Context, logger *zap.Logger, db *sql.DB, fn RuntimePurchaseNotificationAppleFunction, transaction *iap.AppleJWSTransaction, providerPayload string) error {
+	if transaction.RevocationDate == 0 {
+		return errors.New("apple transaction is not revoked")
+	}
+
+	var exists bool
+	query := `
+WITH refund AS (
+    UPDATE purchase
+    SET refund_time = $3, update_time = now()
+    WHERE transaction_id = $1 AND store = $2 AND refund_time = '1970-01-01 00:00:00 UTC'
+)
+SELECT EXISTS (SELECT 1 FROM purchase WHERE transaction_id = $1 AND store = $2)`
+	if err := db.QueryRowContext(ctx, query, transaction.TransactionId, api.StoreProvider_APPLE_APP_STORE, parseMillisecondUnixTimestamp(transaction.RevocationDate)).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	if err := deliverPurchaseRefundApple(ctx, logger, db, fn, transaction.TransactionId, providerPayload); err != nil {
+		// The refund is recorded, the refund scheduler retries delivery.
+		logger.Warn("Failed to invoke Apple purchase refund hook", zap.Error(err), zap.String("transaction_id", transaction.TransactionId))
+	}
+	return nil
+}
+
+// Invoke the runtime purchase notification function for a refunded App Store purchase, once. The purchase is claimed
+// before the function runs so concurrent deliveries do not repeat it, and released again if the function fails.
+func deliverPurchaseRefundApple(ctx context.Context, logger *zap.Logger, db *sql.DB, fn RuntimePurchaseNotificationAppleFunction, transactionID, providerPayload string) error {
+	if fn == nil {
+		// Delivered once a function is registered.
+		return nil
+	}
+
+	var dbUserID uuid.UUID
+	var dbProductID string
+	var dbEnvironment api.StoreEnvironment
+	var dbPurchaseTime, dbCreateTime, dbUpdateTime, dbRefundTime pgtype.Timestamptz
+	query := `
+UPDATE purchase
+SET refund_callback_time = now()
+WHERE transaction_id = $1 AND store = $2 AND refund_time <> '1970-01-01 00:00:00 UTC' AND refund_callback_time = '1970-01-01 00:00:00 UTC'
+RETURNING user_id, product_id, environment, purchase_time, create_time, update_time, refund_time`
+	err := db.QueryRowContext(ctx, query, transactionID, api.StoreProvider_APPLE_APP_STORE).Scan(&dbUserID, &dbProductID, &dbEnvironment, &dbPurchaseTime, &dbCreateTime, &dbUpdateTime, &dbRefundTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Not refunded, or already delivered.
+			return nil
+		}
+		return err
+	}
+
+	if dbUserID.IsNil() {
+		// Purchase belongs to a deleted user.
+		return nil
+	}
+
+	validatedPurchase := &api.ValidatedPurchase{
+		UserId:           dbUserID.String(),
+		ProductId:        dbProductID,
+		TransactionId:    transactionID,
+		Store:            api.StoreProvider_APPLE_APP_STORE,
+		PurchaseTime:     timestamppb.New(dbPurchaseTime.Time),
+		CreateTime:       timestamppb.New(dbCreateTime.Time),
+		UpdateTime:       timestamppb.New(dbUpdateTime.Time),
+		RefundTime:       timestamppb.New(dbRefundTime.Time),
+		ProviderResponse: providerPayload,
+		Environment:      dbEnvironment,
+		SeenBefore:       true,
+	}
+
+	if err = fn(ctx, validatedPurchase, providerPayload); err != nil {
+		if _, releaseErr := db.ExecContext(context.Background(), "UPDATE purchase SET refund_callback_time = '1970-01-01 00:00:00 UTC' WHERE transaction_id = $1 AND store = $2", transactionID, api.StoreProvider_APPLE_APP_STORE); releaseErr != nil {
+			logger.Error("Failed to release Apple purchase refund for redelivery", zap.Error(releaseErr), zap.String("transaction_id", transactionID))
+		}
+		return err
+	}
+	return nil
+}
+
 func ValidatePurchaseGoogle(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, config *IAPGoogleConfig, receipt string, persist bool) (*api.ValidatePurchaseResponse, error) {
 	gResponse, gReceipt, raw, err := iap.ValidateReceiptGoogle(ctx, httpc, config.ClientEmail, config.PrivateKey, receipt)
 	if err != nil {
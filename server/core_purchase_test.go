@@ -0,0 +1,272 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama/v3/iap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testAppleBundleID = "com.example.game"
+
+// Signs App Store data with a test certificate chain, standing in for Apple.
+type testAppleSigner struct {
+	rootsPEM string
+	key      *ecdsa.PrivateKey
+	x5c      []string
+}
+
+func newTestAppleSigner(t *testing.T) *testAppleSigner {
+	t.Helper()
+
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("error generating key: %v", err)
+		}
+		return key
+	}
+	newCert := func(template, parent *x509.Certificate, pub *ecdsa.PublicKey, signer *ecdsa.PrivateKey) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+		if err != nil {
+			t.Fatalf("error creating certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("error parsing certificate: %v", err)
+		}
+		return cert
+	}
+	caTemplate := func(serial int64, name string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+	}
+
+	rootKey, interKey, leafKey := newKey(), newKey(), newKey()
+	rootTemplate := caTemplate(1, "Test Root")
+	root := newCert(rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	inter := newCert(caTemplate(2, "Test Intermediate"), root, &interKey.PublicKey, rootKey)
+	leaf := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Test Leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, inter, &leafKey.PublicKey, interKey)
+
+	return &testAppleSigner{
+		rootsPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})),
+		key:      leafKey,
+		x5c: []string{
+			base64.StdEncoding.EncodeToString(leaf.Raw),
+			base64.StdEncoding.EncodeToString(inter.Raw),
+			base64.StdEncoding.EncodeToString(root.Raw),
+		},
+	}
+}
+
+func (s *testAppleSigner) sign(t *testing.T, payload interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]interface{}{"alg": "ES256", "x5c": s.x5c})
+	body, _ := json.Marshal(payload)
+	signingString := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	digest := sha256.Sum256([]byte(signingString))
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	ss.FillBytes(sig[32:])
+
+	return signingString + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// An App Store Server API configuration pointing at a local stub, trusting the signer's root.
+func (s *testAppleSigner) config(t *testing.T, serverApiUrl string) *IAPAppleConfig {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshalling key: %v", err)
+	}
+
+	return &IAPAppleConfig{
+		BundleId:         testAppleBundleID,
+		IssuerId:         "issuer",
+		KeyId:            "key",
+		PrivateKey:       string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ServerApiUrl:     serverApiUrl,
+		RootCertificates: s.rootsPEM,
+	}
+}
+
+func testAppleTransaction(transactionID, productID string, revocationDate int64) map[string]interface{} {
+	return map[string]interface{}{
+		"transactionId":         transactionID,
+		"originalTransactionId": transactionID,
+		"bundleId":              testAppleBundleID,
+		"productId":             productID,
+		"purchaseDate":          time.Now().Add(-time.Hour).UnixMilli(),
+		"revocationDate":        revocationDate,
+		"type":                  iap.AppleTransactionTypeConsumable,
+		"environment":           iap.AppleSandboxEnvironment,
+	}
+}
+
+func TestValidatePurchasesAppleSigned(t *testing.T) {
+	signer := newTestAppleSigner(t)
+	config := signer.config(t, "")
+	userID := uuid.Must(uuid.NewV4())
+	signed := signer.sign(t, testAppleTransaction("2000000001", "gems_100", 0))
+
+	t.Run("bundle id not configured", func(t *testing.T) {
+		_, err := ValidatePurchasesAppleSigned(context.Background(), logger, nil, userID, &IAPAppleConfig{RootCertificates: signer.rootsPEM}, signed, false)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("expected failed precondition, got %v", err)
+		}
+	})
+
+	t.Run("bundle id mismatch", func(t *testing.T) {
+		other := signer.config(t, "")
+		other.BundleId = "com.example.other"
+		_, err := ValidatePurchasesAppleSigned(context.Background(), logger, nil, userID, other, signed, false)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("expected failed precondition, got %v", err)
+		}
+	})
+
+	t.Run("untrusted signature", func(t *testing.T) {
+		other := newTestAppleSigner(t)
+		_, err := ValidatePurchasesAppleSigned(context.Background(), logger, nil, userID, config, other.sign(t, testAppleTransaction("2000000001", "gems_100", 0)), false)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("expected failed precondition, got %v", err)
+		}
+	})
+
+	t.Run("subscription", func(t *testing.T) {
+		transaction := testAppleTransaction("2000000002", "pass_monthly", 0)
+		transaction["type"] = iap.AppleTransactionTypeAutoRenewableSubscription
+		transaction["expiresDate"] = time.Now().Add(time.Hour).UnixMilli()
+		_, err := ValidatePurchasesAppleSigned(context.Background(), logger, nil, userID, config, signer.sign(t, transaction), false)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("expected failed precondition, got %v", err)
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		validation, err := ValidatePurchasesAppleSigned(context.Background(), logger, nil, userID, config, signed, false)
+		if err != nil {
+			t.Fatalf("error validating: %v", err)
+		}
+		if len(validation.ValidatedPurchases) != 1 {
+			t.Fatalf("expected 1 purchase, got %d", len(validation.ValidatedPurchases))
+		}
+		if p := validation.ValidatedPurchases[0]; p.TransactionId != "2000000001" || p.ProductId != "gems_100" || p.UserId != userID.String() {
+			t.Fatalf("unexpected purchase: %+v", p)
+		}
+	})
+}
+
+func TestListPurchaseHistoryApple(t *testing.T) {
+	signer := newTestAppleSigner(t)
+	history := []string{
+		signer.sign(t, testAppleTransaction("2000000001", "gems_100", 0)),
+		signer.sign(t, testAppleTransaction("2000000002", "gems_500", time.Now().UnixMilli())),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var signedTransactions []string
+		switch r.URL.Path {
+		case "/inApps/v1/history/2000000001":
+			signedTransactions = history
+		case "/inApps/v2/refund/lookup/2000000001":
+			signedTransactions = history[1:]
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"signedTransactions": signedTransactions, "hasMore": false})
+	}))
+	defer server.Close()
+	config := signer.config(t, server.URL)
+
+	transactions, err := ListPurchaseHistoryApple(context.Background(), logger, config, "2000000001")
+	if err != nil {
+		t.Fatalf("error listing history: %v", err)
+	}
+	if len(transactions) != 2 || transactions[0].TransactionId != "2000000001" || transactions[1].ProductId != "gems_500" {
+		t.Fatalf("unexpected history: %+v", transactions)
+	}
+
+	refunds, err := ListRefundedPurchasesApple(context.Background(), logger, config, "2000000001")
+	if err != nil {
+		t.Fatalf("error listing refunds: %v", err)
+	}
+	if len(refunds) != 1 || refunds[0].TransactionId != "2000000002" || refunds[0].RevocationDate == 0 {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+
+	if _, err = ListPurchaseHistoryApple(context.Background(), logger, config, "2000000009"); err == nil {
+		t.Fatal("expected error for unknown transaction")
+	}
+
+	// Transactions signed by anyone other than the trusted root are rejected.
+	other := newTestAppleSigner(t)
+	config.RootCertificates = other.rootsPEM
+	if _, err = ListPurchaseHistoryApple(context.Background(), logger, config, "2000000001"); err == nil {
+		t.Fatal("expected error for untrusted signature")
+	}
+
+	if _, err = ListPurchaseHistoryApple(context.Background(), logger, &IAPAppleConfig{}, "2000000001"); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected failed precondition, got %v", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/jackc/pgtype"
@@ -29,15 +30,74 @@ import (
 var (
 	ErrSessionTokenInvalid = errors.New("session token invalid")
 	ErrRefreshTokenInvalid = errors.New("refresh token invalid")
+	ErrUserSessionNotFound = errors.New("user session not found")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
 )
 
-func SessionRefresh(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, sessionCache SessionCache, token string) (uuid.UUID, string, map[string]string, string, error) {
-	userID, _, vars, exp, tokenId, ok := parseToken([]byte(config.GetSession().RefreshEncryptionKey), token)
+// UserSession describes a login, identified by the token ID its session and refresh tokens share.
+type UserSession struct {
+	Id           string `json:"id"`
+	DeviceName   string `json:"device_name"`
+	Platform     string `json:"platform"`
+	ClientIp     string `json:"client_ip"`
+	CreateTime   int64  `json:"create_time"`
+	LastSeenTime int64  `json:"last_seen_time"`
+	ExpiryTime   int64  `json:"expiry_time"`
+}
+
+// Validate a refresh token, returning the session's token ID and the ID the refreshed refresh token should use. With
+// refresh token rotation enabled this is a new ID, and the token used is invalidated. Rotation relies on the session
+// recorded when it was issued, sessions that are not recorded can't be refreshed. Presenting a refresh token that has
+// already been rotated out revokes its session, and returns ErrRefreshTokenReused along with the user ID.
+func SessionRefresh(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, sessionCache SessionCache, sessionRegistry SessionRegistry, tracker Tracker, token string) (uuid.UUID, string, map[string]string, string, string, error) {
+	claims, userID, ok := parseTokenClaims([]byte(config.GetSession().RefreshEncryptionKey), token)
 	if !ok {
-		return uuid.Nil, "", nil, "", status.Error(codes.Unauthenticated, "Refresh token invalid or expired.")
+		return uuid.Nil, "", nil, "", "", status.Error(codes.Unauthenticated, "Refresh token invalid or expired.")
+	}
+	vars, exp, refreshTokenId := claims.Vars, claims.ExpiresAt, claims.TokenId
+	tokenId := refreshTokenId
+	if claims.FamilyId != "" {
+		tokenId = claims.FamilyId
+	}
+
+	// Tokens that have been rotated before must be checked against their session even if rotation is now disabled.
+	rotate := config.GetSession().RefreshTokenRotation
+	checkFamily := rotate || claims.FamilyId != ""
+
+	if !sessionCache.IsValidRefresh(userID, exp, refreshTokenId) {
+		if checkFamily {
+			if err := sessionRefreshCheckReuse(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, userID, tokenId, refreshTokenId, exp); err != nil {
+				return userID, "", nil, "", "", err
+			}
+		}
+		return uuid.Nil, "", nil, "", "", status.Error(codes.Unauthenticated, "Refresh token invalid or expired.")
 	}
-	if !sessionCache.IsValidRefresh(userID, exp, tokenId) {
-		return uuid.Nil, "", nil, "", status.Error(codes.Unauthenticated, "Refresh token invalid or expired.")
+
+	newRefreshTokenId := refreshTokenId
+	if checkFamily {
+		if rotate {
+			newRefreshTokenId = uuid.Must(uuid.NewV4()).String()
+		}
+
+		// Move the session to the new refresh token only if the one presented is still its current refresh token.
+		query := `
+UPDATE user_session SET refresh_token_id = $4, last_seen_time = now()
+WHERE user_id = $1 AND id = $2 AND (refresh_token_id = $3 OR (refresh_token_id = '' AND id = $3))`
+		res, err := db.ExecContext(ctx, query, userID, tokenId, refreshTokenId, newRefreshTokenId)
+		if err != nil {
+			logger.Error("Error rotating refresh token.", zap.Error(err), zap.String("user_id", userID.String()))
+			return uuid.Nil, "", nil, "", "", status.Error(codes.Internal, "Error refreshing session.")
+		}
+		if rowsAffected, _ := res.RowsAffected(); rowsAffected != 1 {
+			if err := sessionRefreshCheckReuse(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, userID, tokenId, refreshTokenId, exp); err != nil {
+				return userID, "", nil, "", "", err
+			}
+			// The session has been revoked, or was never recorded so reuse of its refresh tokens can't be detected.
+			return uuid.Nil, "", nil, "", "", status.Error(codes.Unauthenticated, "Refresh token invalid or expired.")
+		}
+		if newRefreshTokenId != refreshTokenId {
+			sessionCache.Remove(userID, 0, "", exp, refreshTokenId)
+		}
 	}
 
 	// Look for an existing account.
@@ -48,19 +108,49 @@ func SessionRefresh(ctx context.Context, logger *zap.Logger, db *sql.DB, config
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Account not found and creation is never allowed for this type.
-			return uuid.Nil, "", nil, "", status.Error(codes.NotFound, "User account not found.")
+			return uuid.Nil, "", nil, "", "", status.Error(codes.NotFound, "User account not found.")
 		}
 		logger.Error("Error looking up user by ID.", zap.Error(err), zap.String("id", userID.String()))
-		return uuid.Nil, "", nil, "", status.Error(codes.Internal, "Error finding user account.")
+		return uuid.Nil, "", nil, "", "", status.Error(codes.Internal, "Error finding user account.")
 	}
 
 	// Check if it's disabled.
 	if dbDisableTime.Status == pgtype.Present && dbDisableTime.Time.Unix() != 0 {
 		logger.Info("User account is disabled.", zap.String("id", userID.String()))
-		return uuid.Nil, "", nil, "", status.Error(codes.PermissionDenied, "User account banned.")
+		return uuid.Nil, "", nil, "", "", status.Error(codes.PermissionDenied, "User account banned.")
 	}
 
-	return userID, dbUsername, vars, tokenId, nil
+	return userID, dbUsername, vars, tokenId, newRefreshTokenId, nil
+}
+
+// A refresh token that is not its session's current refresh token has been rotated out, and presenting it again means
+// it may have been stolen. Revoke the whole token family so neither party can keep using it: the session token, its
+// sockets and the current refresh token are invalidated, and the recorded session is removed so no refresh token of
+// the family is accepted again.
+func sessionRefreshCheckReuse(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, sessionCache SessionCache, sessionRegistry SessionRegistry, tracker Tracker, userID uuid.UUID, familyId, refreshTokenId string, exp int64) error {
+	var currentRefreshTokenId string
+	err := db.QueryRowContext(ctx, "SELECT refresh_token_id FROM user_session WHERE user_id = $1 AND id = $2", userID, familyId).Scan(&currentRefreshTokenId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Already revoked, or never recorded, either way the family can't be refreshed.
+			return nil
+		}
+		logger.Error("Error checking refresh token reuse.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error refreshing session.")
+	}
+	if currentRefreshTokenId == "" {
+		currentRefreshTokenId = familyId
+	}
+	if currentRefreshTokenId == refreshTokenId {
+		return nil
+	}
+
+	logger.Warn("Refresh token reuse detected, revoking session.", zap.String("user_id", userID.String()), zap.String("session_id", familyId))
+	if err = SessionRevoke(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, userID, familyId, false); err != nil && err != ErrUserSessionNotFound {
+		return status.Error(codes.Internal, "Error refreshing session.")
+	}
+	sessionCache.Remove(userID, 0, "", exp, refreshTokenId)
+	return ErrRefreshTokenReused
 }
 
 func SessionLogout(config Config, sessionCache SessionCache, userID uuid.UUID, token, refreshToken string) error {
@@ -94,3 +184,116 @@ func SessionLogout(config Config, sessionCache SessionCache, userID uuid.UUID, t
 	sessionCache.Remove(userID, maybeSessionExp, maybeSessionTokenId, maybeRefreshExp, maybeRefreshTokenId)
 	return nil
 }
+
+// Record a newly issued or refreshed session. Device name and platform are read from the "device_name" and "platform"
+// session vars, the platform falls back to the client's user agent. Refresh token rotation depends on the record, so a
+// session must not be handed out if it fails.
+func SessionRecord(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, tokenID, refreshTokenID string, vars map[string]string, clientIP, userAgent string, refreshExp int64) error {
+	deviceName := vars["device_name"]
+	platform := vars["platform"]
+	if platform == "" {
+		platform = userAgent
+	}
+	if len(deviceName) > 128 {
+		deviceName = deviceName[:128]
+	}
+	if len(platform) > 128 {
+		platform = platform[:128]
+	}
+
+	query := `
+INSERT INTO user_session (user_id, id, refresh_token_id, device_name, platform, client_ip, expiry_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_id, id) DO UPDATE SET refresh_token_id = $3, client_ip = $6, last_seen_time = now(), expiry_time = $7`
+	if _, err := db.ExecContext(ctx, query, userID, tokenID, refreshTokenID, deviceName, platform, clientIP, time.Unix(refreshExp, 0).UTC()); err != nil {
+		logger.Error("Error recording user session.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error creating session.")
+	}
+	return nil
+}
+
+// List a user's sessions that have not expired or been revoked, most recently seen first.
+func SessionsList(ctx context.Context, logger *zap.Logger, db *sql.DB, sessionCache SessionCache, userID uuid.UUID) ([]*UserSession, error) {
+	// Expired sessions can no longer be refreshed, drop them first.
+	if _, err := db.ExecContext(ctx, "DELETE FROM user_session WHERE user_id = $1 AND expiry_time <= now()", userID); err != nil {
+		logger.Error("Error removing expired user sessions.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+
+	query := `
+SELECT id, refresh_token_id, device_name, platform, client_ip, create_time, last_seen_time, expiry_time
+FROM user_session
+WHERE user_id = $1
+ORDER BY last_seen_time DESC`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		logger.Error("Error listing user sessions.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*UserSession, 0, 1)
+	for rows.Next() {
+		var refreshTokenID string
+		var createTime, lastSeenTime, expiryTime pgtype.Timestamptz
+		session := &UserSession{}
+		if err = rows.Scan(&session.Id, &refreshTokenID, &session.DeviceName, &session.Platform, &session.ClientIp, &createTime, &lastSeenTime, &expiryTime); err != nil {
+			logger.Error("Error listing user sessions.", zap.Error(err), zap.String("user_id", userID.String()))
+			return nil, err
+		}
+		session.CreateTime = createTime.Time.Unix()
+		session.LastSeenTime = lastSeenTime.Time.Unix()
+		session.ExpiryTime = expiryTime.Time.Unix()
+
+		// Sessions ended through logout or a full sign out are only recorded in the session cache.
+		if refreshTokenID == "" {
+			refreshTokenID = session.Id
+		}
+		if !sessionCache.IsValidRefresh(userID, session.ExpiryTime, refreshTokenID) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error listing user sessions.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke a single session. Its refresh token is always invalidated. Unless refreshOnly is set, its session token is
+// invalidated too and any sockets connected with it are closed.
+func SessionRevoke(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, sessionCache SessionCache, sessionRegistry SessionRegistry, tracker Tracker, userID uuid.UUID, tokenID string, refreshOnly bool) error {
+	var refreshTokenID string
+	var expiryTime pgtype.Timestamptz
+	err := db.QueryRowContext(ctx, "DELETE FROM user_session WHERE user_id = $1 AND id = $2 RETURNING refresh_token_id, expiry_time", userID, tokenID).Scan(&refreshTokenID, &expiryTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserSessionNotFound
+		}
+		logger.Error("Error revoking user session.", zap.Error(err), zap.String("user_id", userID.String()), zap.String("session_id", tokenID))
+		return err
+	}
+
+	// The session's first refresh token shares its token ID, rotated refresh tokens have their own.
+	if refreshTokenID != "" && refreshTokenID != tokenID {
+		sessionCache.Remove(userID, 0, "", expiryTime.Time.Unix(), refreshTokenID)
+	}
+
+	if refreshOnly {
+		sessionCache.Remove(userID, 0, "", expiryTime.Time.Unix(), tokenID)
+		return nil
+	}
+
+	// Session tokens are reissued on refresh, the current one expires no later than a full token lifetime from now.
+	// Sessions generated by the runtime have no refresh token and may set a longer expiry, which is recorded instead.
+	sessionExp := time.Now().UTC().Unix() + config.GetSession().TokenExpirySec
+	if recordedExp := expiryTime.Time.Unix(); recordedExp > sessionExp {
+		sessionExp = recordedExp
+	}
+	sessionCache.Remove(userID, sessionExp, tokenID, expiryTime.Time.Unix(), tokenID)
+	sessionRegistry.DisconnectToken(ctx, tracker, userID, tokenID)
+
+	return nil
+}
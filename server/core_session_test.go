@@ -0,0 +1,221 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRotatedRefreshTokenClaims(t *testing.T) {
+	config := NewConfig(logger)
+	userID := uuid.Must(uuid.NewV4())
+	familyID := uuid.Must(uuid.NewV4()).String()
+	tokenID := uuid.Must(uuid.NewV4()).String()
+
+	refreshToken, exp := generateRotatedRefreshToken(config, tokenID, familyID, userID.String(), "username", map[string]string{"k": "v"})
+
+	claims, parsedUserID, ok := parseTokenClaims([]byte(config.GetSession().RefreshEncryptionKey), refreshToken)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, userID, parsedUserID)
+	assert.Equal(t, tokenID, claims.TokenId)
+	assert.Equal(t, familyID, claims.FamilyId)
+	assert.Equal(t, exp, claims.ExpiresAt)
+	assert.Equal(t, "v", claims.Vars["k"])
+
+	// Rotated refresh tokens are signed with the refresh key only.
+	_, _, ok = parseTokenClaims([]byte(config.GetSession().EncryptionKey), refreshToken)
+	assert.False(t, ok)
+
+	// Tokens issued at login have no family, their token ID identifies the session.
+	refreshToken, _ = generateRefreshToken(config, familyID, userID.String(), "username", nil)
+	claims, _, ok = parseTokenClaims([]byte(config.GetSession().RefreshEncryptionKey), refreshToken)
+	if assert.True(t, ok) {
+		assert.Equal(t, familyID, claims.TokenId)
+		assert.Equal(t, "", claims.FamilyId)
+	}
+}
+
+func TestSessionRefreshRotatedOutToken(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	config.GetSession().RefreshTokenRotation = true
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	sessionRegistry := NewLocalSessionRegistry(metrics)
+	tracker := &LocalTracker{}
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	tokenID := uuid.Must(uuid.NewV4()).String()
+	refreshToken, refreshExp := generateRefreshToken(config, tokenID, userID.String(), "username", nil)
+	if err := SessionRecord(ctx, logger, db, userID, tokenID, tokenID, nil, "", "", refreshExp); err != nil {
+		t.Fatalf("error recording session: %v", err)
+	}
+
+	// The first refresh rotates the token issued at login out.
+	_, _, _, sessionID, rotatedID, err := SessionRefresh(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, refreshToken)
+	if err != nil {
+		t.Fatalf("error refreshing session: %v", err)
+	}
+	assert.Equal(t, tokenID, sessionID)
+	assert.NotEqual(t, tokenID, rotatedID)
+	rotatedToken, _ := generateRotatedRefreshToken(config, rotatedID, tokenID, userID.String(), "username", nil)
+
+	// Presenting the rotated out token again revokes the whole family.
+	reusedUserID, _, _, _, _, err := SessionRefresh(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, refreshToken)
+	assert.Equal(t, ErrRefreshTokenReused, err)
+	assert.Equal(t, userID, reusedUserID)
+	assert.False(t, sessionCache.IsValidSession(userID, refreshExp, tokenID))
+
+	_, _, _, _, _, err = SessionRefresh(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, rotatedToken)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Revocation outlives the session cache, such as after a restart.
+	freshCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer freshCache.Stop()
+	for _, token := range []string{refreshToken, rotatedToken} {
+		_, _, _, _, _, err = SessionRefresh(ctx, logger, db, config, freshCache, sessionRegistry, tracker, token)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+}
+
+func TestSessionRefreshUnrecordedSession(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	config.GetSession().RefreshTokenRotation = true
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	refreshToken, _ := generateRefreshToken(config, uuid.Must(uuid.NewV4()).String(), userID.String(), "username", nil)
+
+	// Reuse of a session's refresh tokens can only be detected if it's recorded, so unrecorded sessions fail closed.
+	_, _, _, _, _, err := SessionRefresh(ctx, logger, db, config, sessionCache, NewLocalSessionRegistry(metrics), &LocalTracker{}, refreshToken)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	sessionRegistry := NewLocalSessionRegistry(metrics)
+	tracker := &LocalTracker{}
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	phoneID, laptopID := uuid.Must(uuid.NewV4()).String(), uuid.Must(uuid.NewV4()).String()
+	_, refreshExp := generateRefreshToken(config, phoneID, userID.String(), "username", nil)
+	if err := SessionRecord(ctx, logger, db, userID, phoneID, phoneID, map[string]string{"device_name": "phone", "platform": "ios"}, "10.0.0.1", "", refreshExp); err != nil {
+		t.Fatalf("error recording session: %v", err)
+	}
+	if err := SessionRecord(ctx, logger, db, userID, laptopID, laptopID, map[string]string{"device_name": "laptop"}, "10.0.0.2", "agent/1.0", refreshExp); err != nil {
+		t.Fatalf("error recording session: %v", err)
+	}
+
+	sessions, err := SessionsList(ctx, logger, db, sessionCache, userID)
+	if err != nil {
+		t.Fatalf("error listing sessions: %v", err)
+	}
+	if !assert.Len(t, sessions, 2) {
+		return
+	}
+	byID := map[string]*UserSession{sessions[0].Id: sessions[0], sessions[1].Id: sessions[1]}
+	if assert.Contains(t, byID, phoneID) {
+		assert.Equal(t, "phone", byID[phoneID].DeviceName)
+		assert.Equal(t, "ios", byID[phoneID].Platform)
+		assert.Equal(t, "10.0.0.1", byID[phoneID].ClientIp)
+		assert.Equal(t, refreshExp, byID[phoneID].ExpiryTime)
+	}
+	if assert.Contains(t, byID, laptopID) {
+		// The platform falls back to the user agent.
+		assert.Equal(t, "agent/1.0", byID[laptopID].Platform)
+	}
+
+	// Revoking only the refresh token leaves the session token valid until it expires.
+	sessionExp := time.Now().UTC().Unix() + config.GetSession().TokenExpirySec
+	assert.NoError(t, SessionRevoke(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, userID, phoneID, true))
+	assert.True(t, sessionCache.IsValidSession(userID, sessionExp, phoneID))
+	assert.False(t, sessionCache.IsValidRefresh(userID, refreshExp, phoneID))
+
+	assert.NoError(t, SessionRevoke(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, userID, laptopID, false))
+	assert.False(t, sessionCache.IsValidSession(userID, sessionExp, laptopID))
+	assert.False(t, sessionCache.IsValidRefresh(userID, refreshExp, laptopID))
+
+	sessions, err = SessionsList(ctx, logger, db, sessionCache, userID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 0)
+
+	assert.Equal(t, ErrUserSessionNotFound, SessionRevoke(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, userID, laptopID, false))
+	// Sessions can only be revoked by their own user.
+	tabletID := uuid.Must(uuid.NewV4()).String()
+	assert.NoError(t, SessionRecord(ctx, logger, db, userID, tabletID, tabletID, nil, "", "", refreshExp))
+	assert.Equal(t, ErrUserSessionNotFound, SessionRevoke(ctx, logger, db, config, sessionCache, sessionRegistry, tracker, uuid.Must(uuid.NewV4()), tabletID, false))
+}
+
+func TestSessionRuntimeTokenGenerateRecorded(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	nk := NewRuntimeGoNakamaModule(logger, db, nil, config, nil, nil, nil, nil, NewLocalSessionRegistry(metrics), sessionCache, nil, nil, &LocalTracker{}, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	// A runtime token may outlive the configured session token expiry.
+	exp := time.Now().UTC().Unix() + 10*config.GetSession().TokenExpirySec
+	token, _, err := nk.AuthenticateTokenGenerate(userID.String(), "username", exp, map[string]string{"device_name": "server"})
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	_, _, _, _, tokenID, ok := parseToken([]byte(config.GetSession().EncryptionKey), token)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	sessions, err := SessionsList(ctx, logger, db, sessionCache, userID)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 1) {
+		assert.Equal(t, tokenID, sessions[0].Id)
+		assert.Equal(t, "server", sessions[0].DeviceName)
+		assert.Equal(t, exp, sessions[0].ExpiryTime)
+	}
+
+	assert.NoError(t, nk.SessionRevoke(ctx, userID.String(), tokenID, false))
+	// Stays revoked for the token's whole lifetime.
+	assert.False(t, sessionCache.IsValidSession(userID, exp, tokenID))
+}
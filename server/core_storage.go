@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
@@ -38,6 +39,14 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+const (
+	// Storage objects past their expiry time are not returned, even before the expiry sweeper deletes them.
+	storageNotExpired = "(storage.expiry_time IS NULL OR storage.expiry_time > now())"
+	storageExpired    = "storage.expiry_time <= now()"
+	// Expiry time of a written object, from its TTL in seconds as parameter $8.
+	storageWriteExpiryTime = "CASE WHEN $8::INT8 > 0 THEN now() + $8::INT8 * INTERVAL '1 second' ELSE NULL END"
+)
+
 type storageCursor struct {
 	Key    string
 	UserID uuid.UUID
@@ -50,6 +59,10 @@ type StorageOpWrites []*StorageOpWrite
 type StorageOpWrite struct {
 	OwnerID string
 	Object  *api.WriteStorageObject
+	// Seconds until the object expires and is deleted, 0 if it never expires. Every write replaces any existing expiry.
+	TtlSec int64
+	// Optional patch type, to apply the object value as a patch to the existing value instead of replacing it.
+	Patch string
 }
 
 // Desired `read` persmission after this Op completes
@@ -191,14 +204,14 @@ func StorageListObjectsAll(ctx context.Context, logger *zap.Logger, db *sql.DB,
 		query = `
 SELECT collection, key, user_id, value, version, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1` + cursorQuery + `
+WHERE collection = $1 AND ` + storageNotExpired + cursorQuery + `
 ORDER BY read ASC, key ASC, user_id ASC
 LIMIT $2`
 	} else {
 		query = `
 SELECT collection, key, user_id, value, version, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1 AND read >= 2` + cursorQuery + `
+WHERE collection = $1 AND read >= 2 AND ` + storageNotExpired + cursorQuery + `
 ORDER BY read ASC, key ASC, user_id ASC
 LIMIT $2`
 	}
@@ -239,7 +252,7 @@ func StorageListObjectsPublicReadUser(ctx context.Context, logger *zap.Logger, d
 	query := `
 SELECT collection, key, user_id, value, version, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1 AND read = 2 AND user_id = $2 ` + cursorQuery + `
+WHERE collection = $1 AND read = 2 AND user_id = $2 AND ` + storageNotExpired + cursorQuery + `
 ORDER BY key ASC
 LIMIT $3`
 
@@ -279,7 +292,7 @@ func StorageListObjectsUser(ctx context.Context, logger *zap.Logger, db *sql.DB,
 	query := `
 SELECT collection, key, user_id, value, version, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1 AND user_id = $2 AND read >= 1 ` + cursorQuery + `
+WHERE collection = $1 AND user_id = $2 AND read >= 1 AND ` + storageNotExpired + cursorQuery + `
 ORDER BY read ASC, key ASC
 LIMIT $3`
 	if authoritative {
@@ -287,7 +300,7 @@ LIMIT $3`
 		query = `
 SELECT collection, key, user_id, value, version, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1 AND user_id = $2 AND read >= 0 ` + cursorQuery + `
+WHERE collection = $1 AND user_id = $2 AND read >= 0 AND ` + storageNotExpired + cursorQuery + `
 ORDER BY read ASC, key ASC
 LIMIT $3`
 	}
@@ -320,7 +333,7 @@ func StorageReadAllUserObjects(ctx context.Context, logger *zap.Logger, db *sql.
 	query := `
 SELECT collection, key, user_id, value, version, read, write, create_time, update_time
 FROM storage
-WHERE user_id = $1`
+WHERE user_id = $1 AND ` + storageNotExpired
 
 	var objects []*api.StorageObject
 	err := ExecuteRetryable(func() error {
@@ -533,15 +546,17 @@ SELECT collection, key, user_id, value, version, read, write, create_time, updat
 		return nil, errors.New("unexpected code path")
 	}
 
+	if len(distinctArgs) == 3 {
+		query += ` WHERE `
+	} else {
+		query += ` AND `
+	}
+	query += storageNotExpired
+
 	if caller != uuid.Nil {
-		if len(distinctArgs) == 3 {
-			query += ` WHERE `
-		} else {
-			query += ` AND `
-		}
 		// Caller is not nil: either read public (read=2) object from requested user
 		// or private (read=1) object owned by caller
-		query += `(read = 2 or (read = 1 and storage.user_id = $4))`
+		query += ` AND (read = 2 or (read = 1 and storage.user_id = $4))`
 		params = append(params, caller)
 	}
 
@@ -575,18 +590,25 @@ SELECT collection, key, user_id, value, version, read, write, create_time, updat
 	return objects, err
 }
 
-func StorageWriteObjects(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, authoritativeWrite bool, ops StorageOpWrites) (*api.StorageObjectAcks, codes.Code, error) {
+func StorageWriteObjects(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, authoritativeWrite bool, ops StorageOpWrites) (*api.StorageObjectAcks, codes.Code, error) {
 	var acks []*api.StorageObjectAck
-	var sortedWrites StorageOpWrites
+	var objects []*api.StorageObject
 
 	if err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
 		// If the transaction is retried ensure we wipe any acks that may have been prepared by previous attempts.
 		var writeErr error
-		sortedWrites, acks, writeErr = storageWriteObjects(ctx, logger, metrics, tx, authoritativeWrite, ops)
+		acks, objects, writeErr = storageWriteObjects(ctx, logger, metrics, storageCollections, tx, authoritativeWrite, ops)
 		if writeErr != nil {
-			if writeErr == runtime.ErrStorageRejectedVersion || writeErr == runtime.ErrStorageRejectedPermission {
+			var validationErr *StorageValidationError
+			if errors.As(writeErr, &validationErr) {
+				logger.Debug("Error writing storage objects.", zap.Error(writeErr))
+				return StatusError(codes.InvalidArgument, writeErr.Error(), writeErr)
+			} else if writeErr == runtime.ErrStorageRejectedVersion || writeErr == runtime.ErrStorageRejectedPermission {
 				logger.Debug("Error writing storage objects.", zap.Error(writeErr))
 				return StatusError(codes.InvalidArgument, "Storage write rejected.", writeErr)
+			} else if errors.Is(writeErr, ErrStoragePatchInvalid) {
+				logger.Debug("Error writing storage objects.", zap.Error(writeErr))
+				return StatusError(codes.InvalidArgument, writeErr.Error(), writeErr)
 			} else {
 				logger.Error("Error writing storage objects.", zap.Error(writeErr))
 			}
@@ -602,12 +624,31 @@ func StorageWriteObjects(ctx context.Context, logger *zap.Logger, db *sql.DB, me
 		return nil, codes.Internal, err
 	}
 
-	storageIndexWrite(ctx, storageIndex, sortedWrites, acks)
+	storageIndex.Write(ctx, objects)
+	storagePublishChanges(logger, tracker, router, storageWriteChanges(objects))
 
 	return &api.StorageObjectAcks{Acks: acks}, codes.OK, nil
 }
 
-func storageWriteObjects(ctx context.Context, logger *zap.Logger, metrics Metrics, tx pgx.Tx, authoritativeWrite bool, ops StorageOpWrites) (StorageOpWrites, []*api.StorageObjectAck, error) {
+// Returns acks, and the objects as written, in the same order as the given ops.
+func storageWriteObjects(ctx context.Context, logger *zap.Logger, metrics Metrics, storageCollections StorageCollectionRegistry, tx pgx.Tx, authoritativeWrite bool, ops StorageOpWrites) ([]*api.StorageObjectAck, []*api.StorageObject, error) {
+	// Reject writes that break the rules of their collection before running any of them.
+	rules := storageWriteRules(storageCollections, ops)
+	for _, op := range ops {
+		r, found := rules[op.Object.Collection]
+		if !found {
+			continue
+		}
+		validationErr := r.checkPermissions(op)
+		if validationErr == nil && op.Patch == "" {
+			validationErr = r.checkValue(op, op.Object.Value)
+		}
+		if validationErr != nil {
+			metrics.StorageWriteRejectCount(map[string]string{"collection": op.Object.Collection, "reason": validationErr.Reason}, 1)
+			return nil, nil, validationErr
+		}
+	}
+
 	// Ensure writes are processed in a consistent order to avoid deadlocks from concurrent operations.
 	// Sorting done on a copy to ensure we don't modify the input, which may be re-used on transaction retries.
 	sortedOps := make(StorageOpWrites, 0, len(ops))
@@ -619,15 +660,30 @@ func storageWriteObjects(ctx context.Context, logger *zap.Logger, metrics Metric
 	sort.Sort(sortedOps)
 	// Run operations in the sorted order.
 	acks := make([]*api.StorageObjectAck, ops.Len())
+	objects := make([]*api.StorageObject, ops.Len())
 
 	batch := &pgx.Batch{}
+	historyStatements := make(map[*StorageOpWrite]int)
 	for _, op := range sortedOps {
-		storagePrepBatch(batch, authoritativeWrite, op)
+		if storageCollections != nil {
+			if history := storageCollections.CollectionHistory(op.Object.Collection); history != nil {
+				historyStatements[op] = storageHistoryPrepBatch(batch, history, op)
+			}
+		}
+		if err := storagePrepBatch(batch, authoritativeWrite, op); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	br := tx.SendBatch(ctx, batch)
 	defer br.Close() // TODO: need to "drain" batch, otherwise it logs all unprocessed queries
 	for _, op := range sortedOps {
+		for i := 0; i < historyStatements[op]; i++ {
+			if _, err := br.Exec(); err != nil {
+				return nil, nil, err
+			}
+		}
+
 		object := op.Object
 		var resultRead int32
 		var resultWrite int32
@@ -635,13 +691,25 @@ func storageWriteObjects(ctx context.Context, logger *zap.Logger, metrics Metric
 		var createTime time.Time
 		var updateTime time.Time
 		var isUpsert bool
-		err := br.QueryRow().Scan(&resultRead, &resultWrite, &resultVersion, &createTime, &updateTime, &isUpsert)
+		resultValue := object.Value
+		var err error
+		if op.Patch != "" {
+			// Patched values are only known once written.
+			err = br.QueryRow().Scan(&resultRead, &resultWrite, &resultVersion, &createTime, &updateTime, &isUpsert, &resultValue)
+		} else {
+			err = br.QueryRow().Scan(&resultRead, &resultWrite, &resultVersion, &createTime, &updateTime, &isUpsert)
+		}
 		var pgErr *pgconn.PgError
 		if err != nil && errors.As(err, &pgErr) {
 			if pgErr.Code == dbErrorUniqueViolation {
 				metrics.StorageWriteRejectCount(map[string]string{"collection": object.Collection, "reason": "version"}, 1)
 				return nil, nil, runtime.ErrStorageRejectedVersion
 			}
+			if op.Patch != "" {
+				if err = storagePatchFailure(err); errors.Is(err, ErrStoragePatchInvalid) {
+					metrics.StorageWriteRejectCount(map[string]string{"collection": object.Collection, "reason": "patch"}, 1)
+				}
+			}
 			return nil, nil, err
 		} else if err == pgx.ErrNoRows {
 			// Not every case from storagePrepWriteObject can return NoRows, but those
@@ -652,6 +720,14 @@ func storageWriteObjects(ctx context.Context, logger *zap.Logger, metrics Metric
 			return nil, nil, err
 		}
 
+		if r, found := rules[object.Collection]; found && op.Patch != "" && isUpsert {
+			// Patched values are checked once known, rejecting the write rolls back the transaction.
+			if validationErr := r.checkValue(op, resultValue); validationErr != nil {
+				metrics.StorageWriteRejectCount(map[string]string{"collection": object.Collection, "reason": validationErr.Reason}, 1)
+				return nil, nil, validationErr
+			}
+		}
+
 		if !isUpsert {
 			// Conditions for successful update or insert were not met in the query, following checks are needed to disambiguate
 			// which error to return.
@@ -675,12 +751,41 @@ func storageWriteObjects(ctx context.Context, logger *zap.Logger, metrics Metric
 			UpdateTime: timestamppb.New(updateTime),
 		}
 		acks[indexedOps[op]] = ack
+		objects[indexedOps[op]] = &api.StorageObject{
+			Collection:      object.Collection,
+			Key:             object.Key,
+			UserId:          op.OwnerID,
+			Value:           resultValue,
+			Version:         resultVersion,
+			PermissionRead:  resultRead,
+			PermissionWrite: resultWrite,
+			CreateTime:      ack.CreateTime,
+			UpdateTime:      ack.UpdateTime,
+		}
 	}
 
-	return sortedOps, acks, nil
+	if len(rules) > 0 {
+		// Results must be read before other queries run in the transaction.
+		if err := br.Close(); err != nil {
+			return nil, nil, err
+		}
+		if err := storageCheckObjectCounts(ctx, tx, rules, sortedOps); err != nil {
+			var validationErr *StorageValidationError
+			if errors.As(err, &validationErr) {
+				metrics.StorageWriteRejectCount(map[string]string{"collection": validationErr.Collection, "reason": validationErr.Reason}, 1)
+			}
+			return nil, nil, err
+		}
+	}
+
+	return acks, objects, nil
 }
 
-func storagePrepBatch(batch *pgx.Batch, authoritativeWrite bool, op *StorageOpWrite) {
+func storagePrepBatch(batch *pgx.Batch, authoritativeWrite bool, op *StorageOpWrite) error {
+	if op.Patch != "" {
+		return storagePrepPatchBatch(batch, authoritativeWrite, op)
+	}
+
 	object := op.Object
 	ownerID := op.OwnerID
 
@@ -688,13 +793,13 @@ func storagePrepBatch(batch *pgx.Batch, authoritativeWrite bool, op *StorageOpWr
 	newPermissionRead := op.permissionRead()
 	newPermissionWrite := op.permissionWrite()
 
-	params := []interface{}{object.Collection, object.Key, ownerID, object.Value, newVersion, newPermissionRead, newPermissionWrite}
+	params := []interface{}{object.Collection, object.Key, ownerID, object.Value, newVersion, newPermissionRead, newPermissionWrite, op.TtlSec}
 	var query string
 
 	writeCheck := ""
-	// Respect permissions in non-authoritative writes.
+	// Respect permissions in non-authoritative writes. Expired objects are replaced as if they did not exist.
 	if !authoritativeWrite {
-		writeCheck = " AND storage.write = 1"
+		writeCheck = " AND (storage.write = 1 OR " + storageExpired + ")"
 	}
 
 	switch {
@@ -708,20 +813,20 @@ func storagePrepBatch(batch *pgx.Batch, authoritativeWrite bool, op *StorageOpWr
 		// That is returned values are final state of the row regardless of UPDATE success
 		query = `
 		WITH upd AS (
-			UPDATE storage SET value = $4, version = $5, read = $6, write = $7, update_time = now()
-			WHERE collection = $1 AND key = $2 AND user_id = $3 AND version = $8
+			UPDATE storage SET value = $4, version = $5, read = $6, write = $7, expiry_time = ` + storageWriteExpiryTime + `, update_time = now()
+			WHERE collection = $1 AND key = $2 AND user_id = $3 AND version = $9 AND ` + storageNotExpired + `
 		` + writeCheck + `
 			RETURNING read, write, version, create_time, update_time
 		)
 		(SELECT read, write, version, create_time, update_time, true AS update FROM upd)
 		UNION ALL
-		(SELECT read, write, version, create_time, update_time, false AS update FROM storage WHERE collection = $1 and key = $2 and user_id = $3 AND NOT EXISTS (SELECT 1 FROM upd))
+		(SELECT read, write, version, create_time, update_time, false AS update FROM storage WHERE collection = $1 and key = $2 and user_id = $3 AND ` + storageNotExpired + ` AND NOT EXISTS (SELECT 1 FROM upd))
 		LIMIT 1`
 
 		params = append(params, object.Version)
 
 		// Outcomes:
-		// - No rows: if no rows returned, then object was not found in DB and can't be updated
+		// - No rows: if no rows returned, then object was not found in DB, or has expired, and can't be updated
 		// - We have row returned, but now we need to know if update happened, that is if WHERE matched
 		//	 * write != 1 means no permission to write
 		//	 * dbVersion != original version means OCC failure
@@ -734,12 +839,13 @@ func storagePrepBatch(batch *pgx.Batch, authoritativeWrite bool, op *StorageOpWr
 		// check for existing row.
 		query = `
 		WITH upd AS (
-			INSERT INTO storage (collection, key, user_id, value, version, read, write, create_time, update_time)
-				VALUES ($1, $2, $3, $4, $5, $6, $7, now(), now())
+			INSERT INTO storage (collection, key, user_id, value, version, read, write, expiry_time, create_time, update_time)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, ` + storageWriteExpiryTime + `, now(), now())
 			ON CONFLICT (collection, key, user_id) DO
-				UPDATE SET value = $4, version = $5, read = $6, write = $7, update_time = now()
+				UPDATE SET value = $4, version = $5, read = $6, write = $7, expiry_time = ` + storageWriteExpiryTime + `, update_time = now(),
+					create_time = CASE WHEN ` + storageExpired + ` THEN now() ELSE storage.create_time END
 				WHERE TRUE` + writeCheck + `
-				AND NOT (storage.version = $5 AND storage.read = $6 AND storage.write = $7) -- micro optimization: don't update row unnecessarily
+				AND NOT (storage.version = $5 AND storage.read = $6 AND storage.write = $7 AND storage.expiry_time IS NULL AND $8::INT8 <= 0) -- micro optimization: don't update row unnecessarily
 			RETURNING read, write, version, create_time, update_time
 		)
 		(SELECT read, write, version, create_time, update_time, true AS upsert FROM upd)
@@ -754,21 +860,103 @@ func storagePrepBatch(batch *pgx.Batch, authoritativeWrite bool, op *StorageOpWr
 	case object.Version == "*":
 		// OCC if-not-exists, and all other non-OCC cases.
 		// Existing permission checks are not applicable for new storage objects.
+		// An expired object that has not been deleted yet is replaced.
 		query = `
-		INSERT INTO storage (collection, key, user_id, value, version, read, write, create_time, update_time)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, now(), now())
+		INSERT INTO storage (collection, key, user_id, value, version, read, write, expiry_time, create_time, update_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, ` + storageWriteExpiryTime + `, now(), now())
+		ON CONFLICT (collection, key, user_id) DO
+			UPDATE SET value = $4, version = $5, read = $6, write = $7, expiry_time = ` + storageWriteExpiryTime + `, create_time = now(), update_time = now()
+			WHERE ` + storageExpired + `
 		RETURNING read, write, version, create_time, update_time, true AS upsert`
 
 		// Outcomes:
-		// - NoRows - insert failed due to constraint violation (concurrent insert)
+		// - NoRows - an object that has not expired already exists, or insert failed due to constraint violation (concurrent insert)
 	}
 
 	batch.Queue(query, params...)
+	return nil
 }
 
-func StorageDeleteObjects(ctx context.Context, logger *zap.Logger, db *sql.DB, storageIndex StorageIndex, authoritativeDelete bool, ops StorageOpDeletes) (codes.Code, error) {
+// Same as storagePrepBatch, for writes that patch the existing value. The patch document is parameter $4, and the value
+// it is applied to when the object does not exist, or has expired, is parameter $5. Queries also return the new value.
+func storagePrepPatchBatch(batch *pgx.Batch, authoritativeWrite bool, op *StorageOpWrite) error {
+	object := op.Object
+
+	params := []interface{}{object.Collection, object.Key, op.OwnerID, object.Value, "{}", op.permissionRead(), op.permissionWrite(), op.TtlSec}
+	if object.Version != "" && object.Version != "*" {
+		params = append(params, object.Version)
+	}
+	expression, params, err := storagePatchExpression(op.Patch, object.Value, "$4::JSONB", params)
+	if err != nil {
+		return err
+	}
+	patched := func(target string) string {
+		return strings.ReplaceAll(expression, storagePatchTarget, target)
+	}
+	newValue := patched("storage.value")
+	initialValue := patched("$5::JSONB")
+
+	writeCheck := ""
+	if !authoritativeWrite {
+		writeCheck = " AND (storage.write = 1 OR " + storageExpired + ")"
+	}
+
+	var query string
+	switch {
+	case object.Version != "" && object.Version != "*":
+		// OCC if-match, see storagePrepBatch for outcomes.
+		query = `
+		WITH upd AS (
+			UPDATE storage SET value = ` + newValue + `, version = md5(` + newValue + `::TEXT), read = $6, write = $7, expiry_time = ` + storageWriteExpiryTime + `, update_time = now()
+			WHERE collection = $1 AND key = $2 AND user_id = $3 AND version = $9 AND ` + storageNotExpired + `
+		` + writeCheck + `
+			RETURNING read, write, version, create_time, update_time, value
+		)
+		(SELECT read, write, version, create_time, update_time, true AS update, value FROM upd)
+		UNION ALL
+		(SELECT read, write, version, create_time, update_time, false AS update, value FROM storage WHERE collection = $1 and key = $2 and user_id = $3 AND ` + storageNotExpired + ` AND NOT EXISTS (SELECT 1 FROM upd))
+		LIMIT 1`
+
+	case object.Version == "":
+		// Patch the existing value, or an empty object if there is none. Expired objects are replaced by the inserted row.
+		query = `
+		WITH upd AS (
+			INSERT INTO storage (collection, key, user_id, value, version, read, write, expiry_time, create_time, update_time)
+				VALUES ($1, $2, $3, ` + initialValue + `, md5(` + initialValue + `::TEXT), $6, $7, ` + storageWriteExpiryTime + `, now(), now())
+			ON CONFLICT (collection, key, user_id) DO
+				UPDATE SET value = CASE WHEN ` + storageExpired + ` THEN EXCLUDED.value ELSE ` + newValue + ` END,
+					version = CASE WHEN ` + storageExpired + ` THEN EXCLUDED.version ELSE md5(` + newValue + `::TEXT) END,
+					read = $6, write = $7, expiry_time = ` + storageWriteExpiryTime + `, update_time = now(),
+					create_time = CASE WHEN ` + storageExpired + ` THEN now() ELSE storage.create_time END
+				WHERE TRUE` + writeCheck + `
+			RETURNING read, write, version, create_time, update_time, value
+		)
+		(SELECT read, write, version, create_time, update_time, true AS upsert, value FROM upd)
+		UNION ALL
+		(SELECT read, write, version, create_time, update_time, false AS upsert, value FROM storage WHERE collection = $1 and key = $2 and user_id = $3 AND NOT EXISTS (SELECT 1 FROM upd))
+		LIMIT 1`
+
+	case object.Version == "*":
+		// OCC if-not-exists, the patch is applied to an empty object.
+		query = `
+		INSERT INTO storage (collection, key, user_id, value, version, read, write, expiry_time, create_time, update_time)
+		VALUES ($1, $2, $3, ` + initialValue + `, md5(` + initialValue + `::TEXT), $6, $7, ` + storageWriteExpiryTime + `, now(), now())
+		ON CONFLICT (collection, key, user_id) DO
+			UPDATE SET value = EXCLUDED.value, version = EXCLUDED.version, read = $6, write = $7, expiry_time = ` + storageWriteExpiryTime + `, create_time = now(), update_time = now()
+			WHERE ` + storageExpired + `
+		RETURNING read, write, version, create_time, update_time, true AS upsert, value`
+	}
+
+	batch.Queue(query, params...)
+	return nil
+}
+
+func StorageDeleteObjects(ctx context.Context, logger *zap.Logger, db *sql.DB, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, authoritativeDelete bool, ops StorageOpDeletes) (codes.Code, error) {
+	var deleted map[*StorageOpDelete]int32
+
 	if err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
-		deleteErr := storageDeleteObjects(ctx, logger, tx, authoritativeDelete, ops)
+		var deleteErr error
+		deleted, deleteErr = storageDeleteObjects(ctx, logger, storageCollections, tx, authoritativeDelete, ops)
 		if deleteErr != nil {
 			return deleteErr
 		}
@@ -782,14 +970,18 @@ func StorageDeleteObjects(ctx context.Context, logger *zap.Logger, db *sql.DB, s
 	}
 
 	storageIndex.Delete(ctx, ops)
+	storagePublishChanges(logger, tracker, router, storageDeleteChanges(ops, deleted))
 
 	return codes.OK, nil
 }
 
-func storageDeleteObjects(ctx context.Context, logger *zap.Logger, tx pgx.Tx, authoritativeDelete bool, ops StorageOpDeletes) error {
+// Returns the read permission of each object that was deleted, to publish the deletes to subscribers that could read them.
+func storageDeleteObjects(ctx context.Context, logger *zap.Logger, storageCollections StorageCollectionRegistry, tx pgx.Tx, authoritativeDelete bool, ops StorageOpDeletes) (map[*StorageOpDelete]int32, error) {
 	// Ensure deletes are processed in a consistent order.
 	sort.Sort(ops)
 
+	deleted := make(map[*StorageOpDelete]int32, len(ops))
+
 	for _, op := range ops {
 		params := []interface{}{op.ObjectID.Collection, op.ObjectID.Key, op.OwnerID}
 		var query string
@@ -805,42 +997,32 @@ func storageDeleteObjects(ctx context.Context, logger *zap.Logger, tx pgx.Tx, au
 			params = append(params, op.ObjectID.Version)
 			query += " AND version = $4"
 		}
+		query += " RETURNING read"
 
-		result, err := tx.Exec(ctx, query, params...)
-		if err != nil {
-			logger.Debug("Could not delete storage object.", zap.Error(err), zap.String("query", query), zap.Any("object_id", op.ObjectID))
-			return err
+		if history := storageCollections.CollectionHistory(op.ObjectID.Collection); history != nil {
+			// A rejected delete rolls back the transaction, so keeps no history.
+			if err := storageHistoryKeep(ctx, tx, history, op.ObjectID.Collection, op.ObjectID.Key, op.OwnerID); err != nil {
+				logger.Debug("Could not keep storage object history.", zap.Error(err), zap.Any("object_id", op.ObjectID))
+				return nil, err
+			}
 		}
 
-		if authoritativeDelete && op.ObjectID.GetVersion() == "" {
-			// If it's an authoritative delete and there is no OCC, the only reason rows affected would be 0 is having
-			// nothing to delete. In that case it's safe to assume the deletion was just a no-op and there's no need
-			// to check anything further. Should apply something similar to non-authoritative deletes too.
-			continue
-		}
-		if rowsAffected := result.RowsAffected(); rowsAffected == 0 {
-			return StatusError(codes.InvalidArgument, "Storage delete rejected.", errors.New("Storage delete rejected - not found, version check failed, or permission denied."))
+		var read int32
+		if err := tx.QueryRow(ctx, query, params...).Scan(&read); err != nil {
+			if err != pgx.ErrNoRows {
+				logger.Debug("Could not delete storage object.", zap.Error(err), zap.String("query", query), zap.Any("object_id", op.ObjectID))
+				return nil, err
+			}
+			if authoritativeDelete && op.ObjectID.GetVersion() == "" {
+				// If it's an authoritative delete and there is no OCC, the only reason no row is deleted would be having
+				// nothing to delete. In that case it's safe to assume the deletion was just a no-op and there's no need
+				// to check anything further. Should apply something similar to non-authoritative deletes too.
+				continue
+			}
+			return nil, StatusError(codes.InvalidArgument, "Storage delete rejected.", errors.New("Storage delete rejected - not found, version check failed, or permission denied."))
 		}
+		deleted[op] = read
 	}
 
-	return nil
-}
-
-func storageIndexWrite(ctx context.Context, storageIndex StorageIndex, ops StorageOpWrites, acks []*api.StorageObjectAck) {
-	sw := make([]*api.StorageObject, 0, len(ops))
-	for i, o := range ops {
-		sw = append(sw, &api.StorageObject{
-			Collection:      o.Object.Collection,
-			Key:             o.Object.Key,
-			UserId:          o.OwnerID,
-			Value:           o.Object.Value,
-			Version:         acks[i].Version,
-			PermissionRead:  o.Object.PermissionRead.GetValue(),
-			PermissionWrite: o.Object.PermissionRead.GetValue(),
-			CreateTime:      acks[i].CreateTime,
-			UpdateTime:      acks[i].UpdateTime,
-		})
-	}
-
-	storageIndex.Write(ctx, sw)
+	return deleted, nil
 }
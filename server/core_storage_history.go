@@ -0,0 +1,180 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const storageHistoryMaxList = 100
+
+var ErrStorageHistoryVersionNotFound = errors.New("storage object version not found in history")
+
+func storageHistoryConfigValid(history *StorageHistoryConfig) error {
+	if history.Collection == "" {
+		return errors.New("storage history 'collection' must be set")
+	}
+	if history.MaxVersions < 0 || history.MaxAgeSec < 0 {
+		return errors.New("storage history 'max_versions' and 'max_age_sec' must be >= 0")
+	}
+	if history.MaxVersions == 0 && history.MaxAgeSec == 0 {
+		return errors.New("storage history must set at least one of 'max_versions' and 'max_age_sec'")
+	}
+	return nil
+}
+
+// Keeps the current version of an object, if there is one. A version seen again, for example after a restore, is
+// moved to the most recent position.
+const storageHistoryKeepQuery = `
+INSERT INTO storage_history (collection, key, user_id, value, version, read, write, create_time, update_time)
+SELECT collection, key, user_id, value, version, read, write, create_time, update_time
+FROM storage
+WHERE collection = $1 AND key = $2 AND user_id = $3 AND ` + storageNotExpired + `
+ON CONFLICT (collection, key, user_id, version) DO UPDATE SET replace_time = now()`
+
+// Removes versions of an object no longer retained.
+func storageHistoryPruneQuery(history *StorageHistoryConfig, collection, key, userID string) (string, []interface{}) {
+	params := []interface{}{collection, key, userID}
+	query := "DELETE FROM storage_history WHERE collection = $1 AND key = $2 AND user_id = $3 AND ("
+	if history.MaxAgeSec > 0 {
+		params = append(params, history.MaxAgeSec)
+		query += "replace_time < now() - $" + strconv.Itoa(len(params)) + "::BIGINT * INTERVAL '1 second'"
+	}
+	if history.MaxVersions > 0 {
+		if history.MaxAgeSec > 0 {
+			query += " OR "
+		}
+		params = append(params, history.MaxVersions)
+		query += "version NOT IN (SELECT version FROM storage_history WHERE collection = $1 AND key = $2 AND user_id = $3 ORDER BY replace_time DESC, update_time DESC LIMIT $" + strconv.Itoa(len(params)) + ")"
+	}
+	return query + ")", params
+}
+
+// Queue statements that keep the current version of an object, if there is one, before the write replaces it, and
+// remove versions no longer retained. They run in the same transaction as the write, so a rejected write keeps no
+// history. Returns the number of statements queued.
+func storageHistoryPrepBatch(batch *pgx.Batch, history *StorageHistoryConfig, op *StorageOpWrite) int {
+	batch.Queue(storageHistoryKeepQuery, op.Object.Collection, op.Object.Key, op.OwnerID)
+	batch.Queue(storageHistoryPruneQuery(history, op.Object.Collection, op.Object.Key, op.OwnerID))
+	return 2
+}
+
+// Keep the current version of an object, if there is one, before it is deleted in the same transaction.
+func storageHistoryKeep(ctx context.Context, tx pgx.Tx, history *StorageHistoryConfig, collection, key, userID string) error {
+	if _, err := tx.Exec(ctx, storageHistoryKeepQuery, collection, key, userID); err != nil {
+		return err
+	}
+	query, params := storageHistoryPruneQuery(history, collection, key, userID)
+	_, err := tx.Exec(ctx, query, params...)
+	return err
+}
+
+// Keep a version of an object that was already deleted, such as an expired object removed by the expiry sweep.
+func storageHistoryKeepObject(ctx context.Context, tx pgx.Tx, history *StorageHistoryConfig, object *api.StorageObject) error {
+	query := `
+INSERT INTO storage_history (collection, key, user_id, value, version, read, write, create_time, update_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (collection, key, user_id, version) DO UPDATE SET replace_time = now()`
+	if _, err := tx.Exec(ctx, query, object.Collection, object.Key, object.UserId, object.Value, object.Version, object.PermissionRead, object.PermissionWrite, object.CreateTime.AsTime(), object.UpdateTime.AsTime()); err != nil {
+		return err
+	}
+	query, params := storageHistoryPruneQuery(history, object.Collection, object.Key, object.UserId)
+	_, err := tx.Exec(ctx, query, params...)
+	return err
+}
+
+// StorageHistoryList returns the kept previous versions of an object, most recently replaced first.
+func StorageHistoryList(ctx context.Context, logger *zap.Logger, db *sql.DB, collection, key string, userID uuid.UUID, limit int) ([]*api.StorageObject, error) {
+	if limit < 1 || limit > storageHistoryMaxList {
+		limit = storageHistoryMaxList
+	}
+
+	query := `
+SELECT value, version, read, write, create_time, update_time
+FROM storage_history
+WHERE collection = $1 AND key = $2 AND user_id = $3
+ORDER BY replace_time DESC, update_time DESC
+LIMIT $4`
+	rows, err := db.QueryContext(ctx, query, collection, key, userID, limit)
+	if err != nil {
+		logger.Error("Could not list storage history.", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := make([]*api.StorageObject, 0, limit)
+	for rows.Next() {
+		o := &api.StorageObject{Collection: collection, Key: key, UserId: userID.String()}
+		var createTime pgtype.Timestamptz
+		var updateTime pgtype.Timestamptz
+		if err := rows.Scan(&o.Value, &o.Version, &o.PermissionRead, &o.PermissionWrite, &createTime, &updateTime); err != nil {
+			logger.Error("Could not scan storage history.", zap.Error(err))
+			return nil, err
+		}
+		o.CreateTime = timestamppb.New(createTime.Time)
+		o.UpdateTime = timestamppb.New(updateTime.Time)
+		objects = append(objects, o)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("Could not list storage history.", zap.Error(err))
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// StorageHistoryRestore writes a previous version of an object back, with the permissions it had. The version being
+// replaced is kept in history as with any other write, and the collection rules still apply.
+func StorageHistoryRestore(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, collection, key string, userID uuid.UUID, version string) (*api.StorageObjectAck, codes.Code, error) {
+	var value string
+	var read int32
+	var write int32
+	query := "SELECT value, read, write FROM storage_history WHERE collection = $1 AND key = $2 AND user_id = $3 AND version = $4"
+	if err := db.QueryRowContext(ctx, query, collection, key, userID, version).Scan(&value, &read, &write); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, codes.NotFound, ErrStorageHistoryVersionNotFound
+		}
+		logger.Error("Could not read storage history.", zap.Error(err))
+		return nil, codes.Internal, err
+	}
+
+	acks, code, err := StorageWriteObjects(ctx, logger, db, metrics, storageIndex, storageCollections, tracker, router, true, StorageOpWrites{{
+		OwnerID: userID.String(),
+		Object: &api.WriteStorageObject{
+			Collection:      collection,
+			Key:             key,
+			Value:           value,
+			PermissionRead:  wrapperspb.Int32(read),
+			PermissionWrite: wrapperspb.Int32(write),
+		},
+	}})
+	if err != nil {
+		return nil, code, err
+	}
+
+	return acks.Acks[0], codes.OK, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestStorageHistoryConfigValid(t *testing.T) {
+	assert.NoError(t, storageHistoryConfigValid(&StorageHistoryConfig{Collection: "saves", MaxVersions: 10}))
+	assert.NoError(t, storageHistoryConfigValid(&StorageHistoryConfig{Collection: "saves", MaxAgeSec: 86400}))
+	assert.Error(t, storageHistoryConfigValid(&StorageHistoryConfig{Collection: "saves"}))
+	assert.Error(t, storageHistoryConfigValid(&StorageHistoryConfig{MaxVersions: 10}))
+	assert.Error(t, storageHistoryConfigValid(&StorageHistoryConfig{Collection: "saves", MaxVersions: -1, MaxAgeSec: 60}))
+}
+
+func TestStorageHistoryPrepBatch(t *testing.T) {
+	op := &StorageOpWrite{OwnerID: uuid.Must(uuid.NewV4()).String(), Object: &api.WriteStorageObject{Collection: "saves", Key: "slot1", Value: "{}"}}
+
+	for _, history := range []*StorageHistoryConfig{
+		{Collection: "saves", MaxVersions: 5},
+		{Collection: "saves", MaxAgeSec: 60},
+		{Collection: "saves", MaxVersions: 5, MaxAgeSec: 60},
+	} {
+		batch := &pgx.Batch{}
+		// Keeping the current version and pruning old versions queue before the write itself.
+		assert.Equal(t, 2, storageHistoryPrepBatch(batch, history, op))
+		assert.Equal(t, 2, batch.Len())
+	}
+}
+
+func TestStorageHistoryListRestore(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	collection := GenerateString()
+	collections, err := NewLocalStorageCollectionRegistry(logger, &StorageConfig{History: []*StorageHistoryConfig{{Collection: collection, MaxVersions: 2}}})
+	require.NoError(t, err)
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	write := func(value string) *api.StorageObjectAck {
+		acks, _, err := StorageWriteObjects(ctx, logger, db, metrics, storageIdx, collections, nil, nil, true, StorageOpWrites{{
+			OwnerID: userID.String(),
+			Object:  &api.WriteStorageObject{Collection: collection, Key: "slot1", Value: value},
+		}})
+		require.NoError(t, err)
+		return acks.Acks[0]
+	}
+
+	first := write(`{"level": 1}`)
+	second := write(`{"level": 2}`)
+	write(`{"level": 3}`)
+	write(`{"level": 4}`)
+
+	// Only the most recently replaced versions are retained.
+	versions, err := StorageHistoryList(ctx, logger, db, collection, "slot1", userID, 10)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.JSONEq(t, `{"level": 3}`, versions[0].Value)
+	assert.JSONEq(t, `{"level": 2}`, versions[1].Value)
+	assert.Equal(t, second.Version, versions[1].Version)
+
+	_, code, err := StorageHistoryRestore(ctx, logger, db, metrics, storageIdx, collections, nil, nil, collection, "slot1", userID, first.Version)
+	assert.Equal(t, codes.NotFound, code)
+	assert.ErrorIs(t, err, ErrStorageHistoryVersionNotFound)
+
+	ack, code, err := StorageHistoryRestore(ctx, logger, db, metrics, storageIdx, collections, nil, nil, collection, "slot1", userID, second.Version)
+	require.NoError(t, err)
+	assert.Equal(t, codes.OK, code)
+	assert.NotEmpty(t, ack.Version)
+
+	objects, err := StorageReadObjects(ctx, logger, db, uuid.Nil, []*api.ReadStorageObjectId{{Collection: collection, Key: "slot1", UserId: userID.String()}})
+	require.NoError(t, err)
+	require.Len(t, objects.Objects, 1)
+	assert.JSONEq(t, `{"level": 2}`, objects.Objects[0].Value)
+
+	// The replaced version is kept, and the oldest version is no longer retained.
+	versions, err = StorageHistoryList(ctx, logger, db, collection, "slot1", userID, 10)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.JSONEq(t, `{"level": 4}`, versions[0].Value)
+	assert.JSONEq(t, `{"level": 3}`, versions[1].Value)
+}
+
+func TestStorageHistoryDelete(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	collection := GenerateString()
+	collections, err := NewLocalStorageCollectionRegistry(logger, &StorageConfig{History: []*StorageHistoryConfig{{Collection: collection, MaxVersions: 5}}})
+	require.NoError(t, err)
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	for _, key := range []string{"deleted", "expired"} {
+		_, _, err = StorageWriteObjects(ctx, logger, db, metrics, storageIdx, collections, nil, nil, true, StorageOpWrites{{
+			OwnerID: userID.String(),
+			Object:  &api.WriteStorageObject{Collection: collection, Key: key, Value: `{"key": "` + key + `"}`},
+		}})
+		require.NoError(t, err)
+	}
+
+	code, err := StorageDeleteObjects(ctx, logger, db, storageIdx, collections, nil, nil, true, StorageOpDeletes{{
+		OwnerID:  userID.String(),
+		ObjectID: &api.DeleteStorageObjectId{Collection: collection, Key: "deleted"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, codes.OK, code)
+
+	_, err = db.ExecContext(ctx, "UPDATE storage SET expiry_time = now() - INTERVAL '1 second' WHERE collection = $1 AND key = 'expired'", collection)
+	require.NoError(t, err)
+	_, err = StorageExpirySweep(ctx, logger, db, storageIdx, collections, 1000)
+	require.NoError(t, err)
+
+	for _, key := range []string{"deleted", "expired"} {
+		versions, err := StorageHistoryList(ctx, logger, db, collection, key, userID, 10)
+		require.NoError(t, err)
+		if assert.Len(t, versions, 1, key) {
+			assert.JSONEq(t, `{"key": "`+key+`"}`, versions[0].Value)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+const (
+	// Storage write patch types. A patch is applied to the current value of an object, or to an empty object if it
+	// does not exist, in the same statement that writes the result so concurrent patches are never lost.
+	// RFC 7396 JSON Merge Patch.
+	StoragePatchMerge = "merge"
+	// RFC 6902 JSON Patch "add", "remove", "replace", "move", "copy" and "test" operations, and "increment" and
+	// "append" operations to add to a number or append to an array. The parent of a path must already exist, and the
+	// write fails if it does not, or if any path that is removed, replaced, moved, copied or tested does not exist.
+	StoragePatchJson = "json"
+
+	storagePatchMaxOperations = 256
+
+	// Placeholder for the JSON value a patch expression is applied to.
+	storagePatchTarget = "{{target}}"
+
+	// JSON patch operations that cannot be applied raise a database error by casting a marker to UUID, the marker
+	// names the operation and reason so the error can be reported.
+	storagePatchFailurePrefix = "nakama_storage_patch_"
+	storagePatchFailurePath   = "path"
+	storagePatchFailureTest   = "test"
+)
+
+var ErrStoragePatchInvalid = errors.New("invalid storage patch")
+
+var storagePatchFailureRegex = regexp.MustCompile(storagePatchFailurePrefix + `(\d+)_(` + storagePatchFailurePath + `|` + storagePatchFailureTest + `)`)
+
+// Converts a database error raised by a JSON patch operation that could not be applied to an ErrStoragePatchInvalid
+// error. Any other error is returned unchanged.
+func storagePatchFailure(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	match := storagePatchFailureRegex.FindStringSubmatch(pgErr.Message)
+	if match == nil {
+		return err
+	}
+	if match[2] == storagePatchFailureTest {
+		return fmt.Errorf("%w: JSON patch operation %s test failed", ErrStoragePatchInvalid, match[1])
+	}
+	return fmt.Errorf("%w: JSON patch operation %s path does not exist", ErrStoragePatchInvalid, match[1])
+}
+
+// Reports if a storage write value has the shape expected for its patch type: an array of operations for JSON Patch,
+// otherwise an object.
+func storageWriteValueValid(patch, value string) bool {
+	maybeJSON := bytes.TrimSpace([]byte(value))
+	if len(maybeJSON) == 0 || !json.Valid(maybeJSON) {
+		return false
+	}
+	if patch == StoragePatchJson {
+		return maybeJSON[0] == '['
+	}
+	return maybeJSON[0] == byteBracket
+}
+
+func storagePatchTypeValid(patch string) bool {
+	return patch == "" || patch == StoragePatchMerge || patch == StoragePatchJson
+}
+
+// Renders a patch as a SQL expression built from JSONB functions, with storagePatchTarget in place of the value it
+// applies to. The patch document is expected as the JSONB parameter in document, and values are extracted from it
+// by path, so only paths are added as new parameters numbered after the given params.
+func storagePatchExpression(patch, value, document string, params []interface{}) (string, []interface{}, error) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrStoragePatchInvalid, err.Error())
+	}
+
+	b := &storagePatchBuilder{document: document, params: params}
+	var expression string
+	var err error
+	switch patch {
+	case StoragePatchMerge:
+		object, ok := decoded.(map[string]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("%w: merge patch must be an object", ErrStoragePatchInvalid)
+		}
+		expression, err = b.merge(storagePatchTarget, nil, object)
+	case StoragePatchJson:
+		operations, ok := decoded.([]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("%w: JSON patch must be an array of operations", ErrStoragePatchInvalid)
+		}
+		expression, err = b.json(storagePatchTarget, operations)
+	default:
+		return "", nil, fmt.Errorf("%w: unknown patch type %q", ErrStoragePatchInvalid, patch)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return expression, b.params, nil
+}
+
+type storagePatchBuilder struct {
+	document   string
+	params     []interface{}
+	aliases    int
+	operations int
+}
+
+func (b *storagePatchBuilder) path(path []string) string {
+	b.params = append(b.params, path)
+	return "$" + strconv.Itoa(len(b.params)) + "::TEXT[]"
+}
+
+// The patch value at a path in the patch document.
+func (b *storagePatchBuilder) value(path []string) string {
+	return "(" + b.document + " #> " + b.path(path) + ")"
+}
+
+// Binds expression to a new alias that body can reference more than once, and returns the body expression.
+func (b *storagePatchBuilder) let(expression string, body func(alias string) string) string {
+	b.aliases++
+	n := strconv.Itoa(b.aliases)
+	return "(SELECT " + body("v"+n) + " FROM (SELECT " + expression + " AS v" + n + ") AS p" + n + ")"
+}
+
+// An expression that raises a database error when evaluated, identified by operation index and reason. It refers to
+// the current value so it is not evaluated ahead of time by the query planner.
+func (b *storagePatchBuilder) fail(v string, operation int, reason string) string {
+	return "(CASE WHEN " + v + " IS NULL THEN NULL ELSE '" + storagePatchFailurePrefix + strconv.Itoa(operation) + "_" + reason + "' END)::UUID::TEXT::JSONB"
+}
+
+// The current value if the parent of a path is an object or array, otherwise an error.
+func (b *storagePatchBuilder) parent(v string, operation int, path []string, body string) string {
+	return "CASE WHEN jsonb_typeof(" + v + " #> " + b.path(path[:len(path)-1]) + ") IN ('object', 'array') THEN " + body + " ELSE " + b.fail(v, operation, storagePatchFailurePath) + " END"
+}
+
+func (b *storagePatchBuilder) count() error {
+	if b.operations++; b.operations > storagePatchMaxOperations {
+		return fmt.Errorf("%w: too many patch operations, maximum is %d", ErrStoragePatchInvalid, storagePatchMaxOperations)
+	}
+	return nil
+}
+
+// Apply a merge patch object found at documentPath in the patch document. Any target that is not an object is replaced
+// by one, null members are removed, object members are merged recursively, and anything else is set as given.
+func (b *storagePatchBuilder) merge(target string, documentPath []string, patch map[string]interface{}) (string, error) {
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	// Consistent output for the same patch.
+	sort.Strings(keys)
+
+	var err error
+	expression := b.let(target, func(v string) string {
+		current := "CASE WHEN jsonb_typeof(" + v + ") = 'object' THEN " + v + " ELSE '{}'::JSONB END"
+		for _, key := range keys {
+			if err = b.count(); err != nil {
+				return ""
+			}
+			memberPath := append(append(make([]string, 0, len(documentPath)+1), documentPath...), key)
+			switch member := patch[key].(type) {
+			case nil:
+				current = "(" + current + " #- " + b.path([]string{key}) + ")"
+			case map[string]interface{}:
+				key := b.path([]string{key})
+				var merged string
+				current = b.let(current, func(w string) string {
+					if merged, err = b.merge("("+w+" #> "+key+")", memberPath, member); err != nil {
+						return ""
+					}
+					return "jsonb_set(" + w + ", " + key + ", " + merged + ")"
+				})
+				if err != nil {
+					return ""
+				}
+			default:
+				current = "jsonb_set(" + current + ", " + b.path([]string{key}) + ", " + b.value(memberPath) + ")"
+			}
+		}
+		return current
+	})
+	if err != nil {
+		return "", err
+	}
+	return expression, nil
+}
+
+// Apply JSON patch operations in order.
+func (b *storagePatchBuilder) json(target string, operations []interface{}) (string, error) {
+	if len(operations) == 0 {
+		return "", fmt.Errorf("%w: JSON patch must contain at least one operation", ErrStoragePatchInvalid)
+	}
+
+	current := target
+	for i, o := range operations {
+		if err := b.count(); err != nil {
+			return "", err
+		}
+		operation, ok := o.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%w: JSON patch operation %d must be an object", ErrStoragePatchInvalid, i)
+		}
+		op, _ := operation["op"].(string)
+		path, err := storagePatchPointer(operation["path"])
+		if err != nil {
+			return "", fmt.Errorf("%w: JSON patch operation %d %s", ErrStoragePatchInvalid, i, err.Error())
+		}
+		_, hasValue := operation["value"]
+		valuePath := []string{strconv.Itoa(i), "value"}
+
+		switch op {
+		case "add", "replace", "append":
+			if !hasValue {
+				return "", fmt.Errorf("%w: JSON patch operation %d must have a value", ErrStoragePatchInvalid, i)
+			}
+		case "increment":
+			if _, ok := operation["value"].(float64); !ok {
+				return "", fmt.Errorf("%w: JSON patch operation %d must have a number value", ErrStoragePatchInvalid, i)
+			}
+		case "move", "copy":
+			if _, err := storagePatchPointer(operation["from"]); err != nil {
+				return "", fmt.Errorf("%w: JSON patch operation %d from %s", ErrStoragePatchInvalid, i, err.Error())
+			}
+		case "test":
+			if !hasValue {
+				return "", fmt.Errorf("%w: JSON patch operation %d must have a value", ErrStoragePatchInvalid, i)
+			}
+		case "remove":
+		default:
+			return "", fmt.Errorf("%w: JSON patch operation %d has unsupported op %q", ErrStoragePatchInvalid, i, op)
+		}
+
+		current = b.let(current, func(v string) string {
+			switch op {
+			case "add":
+				parent := b.path(path[:len(path)-1])
+				value := b.value(valuePath)
+				if path[len(path)-1] == "-" {
+					// Append to the end of an existing array.
+					return "CASE WHEN jsonb_typeof(" + v + " #> " + parent + ") = 'array' THEN jsonb_set(" + v + ", " + parent + ", (" + v + " #> " + parent + ") || jsonb_build_array(" + value + ")) ELSE " + b.fail(v, i, storagePatchFailurePath) + " END"
+				}
+				// Insert into arrays, and set object members.
+				p := b.path(path)
+				return "CASE jsonb_typeof(" + v + " #> " + parent + ") WHEN 'array' THEN jsonb_insert(" + v + ", " + p + ", " + value + ") WHEN 'object' THEN jsonb_set(" + v + ", " + p + ", " + value + ") ELSE " + b.fail(v, i, storagePatchFailurePath) + " END"
+			case "replace":
+				p := b.path(path)
+				return "CASE WHEN " + v + " #> " + p + " IS NULL THEN " + b.fail(v, i, storagePatchFailurePath) + " ELSE jsonb_set(" + v + ", " + p + ", " + b.value(valuePath) + ", false) END"
+			case "remove":
+				p := b.path(path)
+				return "CASE WHEN " + v + " #> " + p + " IS NULL THEN " + b.fail(v, i, storagePatchFailurePath) + " ELSE " + v + " #- " + p + " END"
+			case "test":
+				// JSONB equality compares numbers by value and objects regardless of member order.
+				return "CASE WHEN " + v + " #> " + b.path(path) + " = " + b.value(valuePath) + " THEN " + v + " ELSE " + b.fail(v, i, storagePatchFailureTest) + " END"
+			case "move", "copy":
+				from, _ := storagePatchPointer(operation["from"])
+				f := b.path(from)
+				source := v
+				if op == "move" {
+					source = "(" + v + " #- " + f + ")"
+				}
+				return "CASE WHEN " + v + " #> " + f + " IS NULL THEN " + b.fail(v, i, storagePatchFailurePath) + " ELSE " + b.parent(source, i, path, "jsonb_set("+source+", "+b.path(path)+", "+v+" #> "+f+")") + " END"
+			case "increment":
+				// Anything other than a number is replaced as if it was 0.
+				p := b.path(path)
+				return b.parent(v, i, path, "jsonb_set("+v+", "+p+", to_jsonb(CASE WHEN jsonb_typeof("+v+" #> "+p+") = 'number' THEN ("+v+" #>> "+p+")::NUMERIC ELSE 0 END + ("+b.value(valuePath)+" #>> '{}')::NUMERIC))")
+			default:
+				// Append a single element, replacing anything other than an array.
+				p := b.path(path)
+				return b.parent(v, i, path, "jsonb_set("+v+", "+p+", CASE WHEN jsonb_typeof("+v+" #> "+p+") = 'array' THEN "+v+" #> "+p+" ELSE '[]'::JSONB END || jsonb_build_array("+b.value(valuePath)+"))")
+			}
+		})
+	}
+	return current, nil
+}
+
+// Parse a non-empty RFC 6901 JSON Pointer into its path segments.
+func storagePatchPointer(pointer interface{}) ([]string, error) {
+	p, ok := pointer.(string)
+	if !ok || p == "" || p[0] != '/' {
+		return nil, errors.New("path must be a non-empty JSON pointer")
+	}
+	segments := strings.Split(p[1:], "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+	}
+	return segments, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestStoragePatchExpressionMerge(t *testing.T) {
+	expression, params, err := storagePatchExpression(StoragePatchMerge, `{"b":null,"a":1,"c":{"d":2}}`, "$2::JSONB", []interface{}{"collection", "{}"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, strings.Count(expression, storagePatchTarget))
+	// Paths are numbered after the given parameters, with members in key order.
+	assert.Equal(t, []interface{}{"collection", "{}", []string{"a"}, []string{"a"}, []string{"b"}, []string{"c"}, []string{"d"}, []string{"c", "d"}}, params)
+	assert.Contains(t, expression, "$2::JSONB #> $4::TEXT[]")
+	assert.Contains(t, expression, "#- $5::TEXT[]")
+	assert.Contains(t, expression, "$2::JSONB #> $8::TEXT[]")
+}
+
+func TestStoragePatchExpressionJson(t *testing.T) {
+	expression, params, err := storagePatchExpression(StoragePatchJson, `[
+		{"op": "increment", "path": "/gold", "value": 5},
+		{"op": "append", "path": "/items", "value": {"id": "sword"}},
+		{"op": "add", "path": "/a~1b/-", "value": 1},
+		{"op": "move", "from": "/old", "path": "/new"},
+		{"op": "remove", "path": "/tmp~0"}
+	]`, "$4::JSONB", []interface{}{1, 2, 3, 4})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, strings.Count(expression, storagePatchTarget))
+	assert.Contains(t, expression, "::NUMERIC")
+	assert.Contains(t, expression, "jsonb_build_array(")
+	assert.Contains(t, params, []string{"a/b"})
+	assert.Contains(t, params, []string{"tmp~"})
+	assert.Contains(t, params, []string{"1", "value"})
+	assert.Equal(t, []interface{}{1, 2, 3, 4}, params[:4])
+}
+
+func TestStoragePatchExpressionInvalid(t *testing.T) {
+	tooMany := make([]string, 0, storagePatchMaxOperations+1)
+	for i := 0; i <= storagePatchMaxOperations; i++ {
+		tooMany = append(tooMany, `{"op": "remove", "path": "/a"}`)
+	}
+
+	for _, tc := range []struct {
+		patch string
+		value string
+	}{
+		{StoragePatchMerge, `[]`},
+		{StoragePatchMerge, `not json`},
+		{StoragePatchJson, `{}`},
+		{StoragePatchJson, `[]`},
+		{StoragePatchJson, `[1]`},
+		{StoragePatchJson, `[{"op": "test", "path": "/a"}]`},
+		{StoragePatchJson, `[{"op": "unknown", "path": "/a", "value": 1}]`},
+		{StoragePatchJson, `[{"op": "add", "path": "/a"}]`},
+		{StoragePatchJson, `[{"op": "add", "path": "", "value": 1}]`},
+		{StoragePatchJson, `[{"op": "add", "path": "a", "value": 1}]`},
+		{StoragePatchJson, `[{"op": "increment", "path": "/a", "value": "1"}]`},
+		{StoragePatchJson, `[{"op": "copy", "path": "/a"}]`},
+		{StoragePatchJson, "[" + strings.Join(tooMany, ",") + "]"},
+		{"unknown", `{}`},
+	} {
+		_, _, err := storagePatchExpression(tc.patch, tc.value, "$4::JSONB", nil)
+		assert.True(t, errors.Is(err, ErrStoragePatchInvalid), fmt.Sprintf("%s %s", tc.patch, tc.value))
+	}
+}
+
+func TestStorageWriteValueValid(t *testing.T) {
+	assert.True(t, storageWriteValueValid("", `{"a": 1}`))
+	assert.True(t, storageWriteValueValid(StoragePatchMerge, ` {"a": null}`))
+	assert.True(t, storageWriteValueValid(StoragePatchJson, `[{"op": "remove", "path": "/a"}]`))
+
+	assert.False(t, storageWriteValueValid("", `[]`))
+	assert.False(t, storageWriteValueValid(StoragePatchJson, `{}`))
+	assert.False(t, storageWriteValueValid(StoragePatchMerge, ``))
+}
+
+func TestStoragePatchFailure(t *testing.T) {
+	err := storagePatchFailure(&pgconn.PgError{Message: `invalid input syntax for type uuid: "nakama_storage_patch_2_test"`})
+	assert.True(t, errors.Is(err, ErrStoragePatchInvalid))
+	assert.Contains(t, err.Error(), "operation 2 test failed")
+
+	err = storagePatchFailure(&pgconn.PgError{Message: `could not parse "nakama_storage_patch_0_path" as type uuid`})
+	assert.True(t, errors.Is(err, ErrStoragePatchInvalid))
+	assert.Contains(t, err.Error(), "operation 0 path does not exist")
+
+	other := &pgconn.PgError{Message: "division by zero"}
+	assert.Equal(t, error(other), storagePatchFailure(other))
+}
+
+func TestStorageWritePatchJsonFailure(t *testing.T) {
+	db := NewDB(t)
+
+	key := GenerateString()
+	write := func(patch, value string) (*api.StorageObjectAcks, codes.Code, error) {
+		return StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, StorageOpWrites{&StorageOpWrite{
+			OwnerID: uuid.Nil.String(),
+			Object:  &api.WriteStorageObject{Collection: "testcollection", Key: key, Value: value},
+			Patch:   patch,
+		}})
+	}
+
+	_, code, err := write("", `{"a": {"b": 1}, "c": [1, 2]}`)
+	require.NoError(t, err)
+	require.Equal(t, codes.OK, code)
+
+	for _, value := range []string{
+		`[{"op": "replace", "path": "/missing", "value": 1}]`,
+		`[{"op": "remove", "path": "/a/missing"}]`,
+		`[{"op": "add", "path": "/missing/b", "value": 1}]`,
+		`[{"op": "add", "path": "/a/b/c", "value": 1}]`,
+		`[{"op": "add", "path": "/a/-", "value": 1}]`,
+		`[{"op": "increment", "path": "/missing/b", "value": 1}]`,
+		`[{"op": "move", "from": "/missing", "path": "/d"}]`,
+		`[{"op": "copy", "from": "/a", "path": "/missing/d"}]`,
+		`[{"op": "test", "path": "/a/b", "value": 2}]`,
+		`[{"op": "test", "path": "/missing", "value": null}]`,
+	} {
+		_, code, err = write(StoragePatchJson, value)
+		assert.True(t, errors.Is(err, ErrStoragePatchInvalid), value)
+		assert.Equal(t, codes.InvalidArgument, code, value)
+	}
+
+	// Failed patches write nothing, a test that passes lets the remaining operations apply.
+	_, code, err = write(StoragePatchJson, `[{"op": "test", "path": "/a", "value": {"b": 1.0}}, {"op": "add", "path": "/c/-", "value": 3}, {"op": "remove", "path": "/a/b"}]`)
+	require.NoError(t, err)
+	require.Equal(t, codes.OK, code)
+
+	objects, err := StorageReadObjects(context.Background(), logger, db, uuid.Nil, []*api.ReadStorageObjectId{{Collection: "testcollection", Key: key}})
+	require.NoError(t, err)
+	require.Len(t, objects.Objects, 1)
+	assert.JSONEq(t, `{"a": {}, "c": [1, 2, 3]}`, objects.Objects[0].Value)
+}
@@ -0,0 +1,457 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum number of violations reported for a single value.
+const storageSchemaMaxViolations = 20
+
+// A compiled JSON Schema, supporting the validation keywords of the 2020-12 draft that do not need references or
+// external documents: type, enum, const, the numeric, string, array and object constraints, and the allOf, anyOf,
+// oneOf and not combinators. Annotations and unknown keywords are ignored, and references are rejected.
+type storageSchema struct {
+	// Set for the boolean schemas true and false.
+	always *bool
+
+	types    map[string]bool
+	enum     []interface{}
+	constant *interface{}
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	items       *storageSchema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	properties           map[string]*storageSchema
+	required             []string
+	additionalProperties *storageSchema
+	minProperties        *int
+	maxProperties        *int
+
+	allOf []*storageSchema
+	anyOf []*storageSchema
+	oneOf []*storageSchema
+	not   *storageSchema
+}
+
+// A single reason a value does not match a schema, at a JSON pointer path within the value.
+type StorageSchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v *StorageSchemaViolation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+func compileStorageSchema(schema string) (*storageSchema, error) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(schema), &decoded); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %s", err.Error())
+	}
+	return compileStorageSchemaValue("", decoded)
+}
+
+func compileStorageSchemaValue(path string, value interface{}) (*storageSchema, error) {
+	if b, ok := value.(bool); ok {
+		return &storageSchema{always: &b}, nil
+	}
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema%s must be an object or boolean", storageSchemaLocation(path))
+	}
+
+	s := &storageSchema{}
+	var err error
+	for keyword, v := range m {
+		location := path + "/" + keyword
+		switch keyword {
+		case "$ref", "$dynamicRef", "$recursiveRef":
+			return nil, fmt.Errorf("schema%s references are not supported", storageSchemaLocation(location))
+		case "type":
+			s.types = make(map[string]bool)
+			switch t := v.(type) {
+			case string:
+				s.types[t] = true
+			case []interface{}:
+				for _, name := range t {
+					nameString, ok := name.(string)
+					if !ok {
+						return nil, fmt.Errorf("schema%s must be a string or array of strings", storageSchemaLocation(location))
+					}
+					s.types[nameString] = true
+				}
+			default:
+				return nil, fmt.Errorf("schema%s must be a string or array of strings", storageSchemaLocation(location))
+			}
+			for name := range s.types {
+				switch name {
+				case "null", "boolean", "object", "array", "number", "integer", "string":
+				default:
+					return nil, fmt.Errorf("schema%s has unknown type %q", storageSchemaLocation(location), name)
+				}
+			}
+		case "enum":
+			if s.enum, ok = v.([]interface{}); !ok {
+				return nil, fmt.Errorf("schema%s must be an array", storageSchemaLocation(location))
+			}
+		case "const":
+			constant := v
+			s.constant = &constant
+		case "minimum":
+			s.minimum, err = storageSchemaNumber(location, v)
+		case "maximum":
+			s.maximum, err = storageSchemaNumber(location, v)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = storageSchemaNumber(location, v)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = storageSchemaNumber(location, v)
+		case "multipleOf":
+			if s.multipleOf, err = storageSchemaNumber(location, v); err == nil && *s.multipleOf <= 0 {
+				err = fmt.Errorf("schema%s must be greater than 0", storageSchemaLocation(location))
+			}
+		case "minLength":
+			s.minLength, err = storageSchemaCount(location, v)
+		case "maxLength":
+			s.maxLength, err = storageSchemaCount(location, v)
+		case "pattern":
+			pattern, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("schema%s must be a string", storageSchemaLocation(location))
+			}
+			if s.pattern, err = regexp.Compile(pattern); err != nil {
+				err = fmt.Errorf("schema%s is not a valid regular expression: %s", storageSchemaLocation(location), err.Error())
+			}
+		case "items":
+			s.items, err = compileStorageSchemaValue(location, v)
+		case "minItems":
+			s.minItems, err = storageSchemaCount(location, v)
+		case "maxItems":
+			s.maxItems, err = storageSchemaCount(location, v)
+		case "uniqueItems":
+			if s.uniqueItems, ok = v.(bool); !ok {
+				return nil, fmt.Errorf("schema%s must be a boolean", storageSchemaLocation(location))
+			}
+		case "properties":
+			properties, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("schema%s must be an object", storageSchemaLocation(location))
+			}
+			s.properties = make(map[string]*storageSchema, len(properties))
+			for name, property := range properties {
+				if s.properties[name], err = compileStorageSchemaValue(location+"/"+name, property); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			required, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("schema%s must be an array of strings", storageSchemaLocation(location))
+			}
+			for _, name := range required {
+				nameString, ok := name.(string)
+				if !ok {
+					return nil, fmt.Errorf("schema%s must be an array of strings", storageSchemaLocation(location))
+				}
+				s.required = append(s.required, nameString)
+			}
+		case "additionalProperties":
+			s.additionalProperties, err = compileStorageSchemaValue(location, v)
+		case "minProperties":
+			s.minProperties, err = storageSchemaCount(location, v)
+		case "maxProperties":
+			s.maxProperties, err = storageSchemaCount(location, v)
+		case "allOf", "anyOf", "oneOf":
+			list, ok := v.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("schema%s must be a non-empty array", storageSchemaLocation(location))
+			}
+			schemas := make([]*storageSchema, 0, len(list))
+			for i, item := range list {
+				compiled, err := compileStorageSchemaValue(location+"/"+strconv.Itoa(i), item)
+				if err != nil {
+					return nil, err
+				}
+				schemas = append(schemas, compiled)
+			}
+			switch keyword {
+			case "allOf":
+				s.allOf = schemas
+			case "anyOf":
+				s.anyOf = schemas
+			default:
+				s.oneOf = schemas
+			}
+		case "not":
+			s.not, err = compileStorageSchemaValue(location, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func storageSchemaLocation(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " " + path
+}
+
+func storageSchemaNumber(location string, v interface{}) (*float64, error) {
+	n, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("schema%s must be a number", storageSchemaLocation(location))
+	}
+	return &n, nil
+}
+
+func storageSchemaCount(location string, v interface{}) (*int, error) {
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != math.Trunc(n) {
+		return nil, fmt.Errorf("schema%s must be a non-negative integer", storageSchemaLocation(location))
+	}
+	count := int(n)
+	return &count, nil
+}
+
+// Validate a JSON encoded value, returning any violations found.
+func (s *storageSchema) Validate(value string) []*StorageSchemaViolation {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return []*StorageSchemaViolation{{Message: "value is not valid JSON"}}
+	}
+	violations := make([]*StorageSchemaViolation, 0)
+	s.validate("", decoded, &violations)
+	return violations
+}
+
+func (s *storageSchema) validate(path string, value interface{}, violations *[]*StorageSchemaViolation) {
+	if len(*violations) >= storageSchemaMaxViolations {
+		return
+	}
+	add := func(format string, args ...interface{}) {
+		if len(*violations) < storageSchemaMaxViolations {
+			*violations = append(*violations, &StorageSchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			add("no value is allowed")
+		}
+		return
+	}
+
+	if len(s.types) > 0 && !s.types[storageSchemaType(value)] && !(s.types["integer"] && storageSchemaIsInteger(value)) && !(s.types["number"] && storageSchemaType(value) == "integer") {
+		types := make([]string, 0, len(s.types))
+		for t := range s.types {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		add("must be of type %s", strings.Join(types, " or "))
+		// Other constraints are not meaningful for a value of the wrong type.
+		return
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if storageSchemaEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("must be one of the allowed values")
+		}
+	}
+	if s.constant != nil && !storageSchemaEqual(*s.constant, value) {
+		add("must be the constant value")
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			add("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			add("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			add("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			add("must be < %v", *s.exclusiveMaximum)
+		}
+		if s.multipleOf != nil {
+			if q := v / *s.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+				add("must be a multiple of %v", *s.multipleOf)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			add("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			add("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			add("must match pattern %q", s.pattern.String())
+		}
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			add("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			add("must have at most %d items", *s.maxItems)
+		}
+		if s.uniqueItems {
+		unique:
+			for i := range v {
+				for j := i + 1; j < len(v); j++ {
+					if storageSchemaEqual(v[i], v[j]) {
+						add("must have unique items")
+						break unique
+					}
+				}
+			}
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(path+"/"+strconv.Itoa(i), item, violations)
+			}
+		}
+	case map[string]interface{}:
+		if s.minProperties != nil && len(v) < *s.minProperties {
+			add("must have at least %d properties", *s.minProperties)
+		}
+		if s.maxProperties != nil && len(v) > *s.maxProperties {
+			add("must have at most %d properties", *s.maxProperties)
+		}
+		for _, name := range s.required {
+			if _, found := v[name]; !found {
+				add("missing required property %q", name)
+			}
+		}
+		// Consistent violation order for the same value.
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propertyPath := path + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+			if property, found := s.properties[name]; found {
+				property.validate(propertyPath, v[name], violations)
+			} else if s.additionalProperties != nil {
+				if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+					add("property %q is not allowed", name)
+				} else {
+					s.additionalProperties.validate(propertyPath, v[name], violations)
+				}
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(path, value, violations)
+	}
+	if s.anyOf != nil {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.matches(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("must match at least one schema in anyOf")
+		}
+	}
+	if s.oneOf != nil {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.matches(value) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			add("must match exactly one schema in oneOf")
+		}
+	}
+	if s.not != nil && s.not.matches(value) {
+		add("must not match the schema in not")
+	}
+}
+
+func (s *storageSchema) matches(value interface{}) bool {
+	violations := make([]*StorageSchemaViolation, 0)
+	s.validate("", value, &violations)
+	return len(violations) == 0
+}
+
+func storageSchemaType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func storageSchemaIsInteger(value interface{}) bool {
+	return storageSchemaType(value) == "integer"
+}
+
+func storageSchemaEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
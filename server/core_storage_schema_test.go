@@ -0,0 +1,138 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestStorageSchemaValidate(t *testing.T) {
+	schema, err := compileStorageSchema(`{
+		"type": "object",
+		"required": ["name", "level"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 8, "pattern": "^[a-z]+$"},
+			"level": {"type": "integer", "minimum": 1, "maximum": 100},
+			"ratio": {"type": "number", "exclusiveMaximum": 1},
+			"tags": {"type": "array", "items": {"enum": ["red", "blue"]}, "maxItems": 2, "uniqueItems": true},
+			"mode": {"oneOf": [{"const": "solo"}, {"const": "team"}]},
+			"meta": {"type": ["object", "null"], "maxProperties": 1}
+		}
+	}`)
+	require.NoError(t, err)
+
+	assert.Empty(t, schema.Validate(`{"name": "abc", "level": 5, "ratio": 0.5, "tags": ["red"], "mode": "solo", "meta": null}`))
+	// Integers are numbers, and numbers without a fraction are integers.
+	assert.Empty(t, schema.Validate(`{"name": "abc", "level": 5.0, "ratio": 0}`))
+
+	violations := schema.Validate(`{"name": "ABCDEFGHIJ", "level": 0.5, "tags": ["red", "red", "green"], "mode": "duo", "extra": true}`)
+	messages := make(map[string][]string)
+	for _, v := range violations {
+		messages[v.Path] = append(messages[v.Path], v.Message)
+	}
+	assert.Len(t, messages["/name"], 2)
+	assert.Equal(t, []string{"must be of type integer"}, messages["/level"])
+	assert.Equal(t, []string{"must have at most 2 items", "must have unique items"}, messages["/tags"])
+	assert.Equal(t, []string{"must be one of the allowed values"}, messages["/tags/2"])
+	assert.Equal(t, []string{"must match exactly one schema in oneOf"}, messages["/mode"])
+	assert.Equal(t, []string{`property "extra" is not allowed`}, messages[""])
+
+	violations = schema.Validate(`{"level": 1}`)
+	require.Len(t, violations, 1)
+	assert.Equal(t, `missing required property "name"`, violations[0].Message)
+
+	violations = schema.Validate(`[]`)
+	require.Len(t, violations, 1)
+	assert.Equal(t, "must be of type object", violations[0].Message)
+}
+
+func TestStorageSchemaCompileInvalid(t *testing.T) {
+	for _, schema := range []string{
+		`not json`,
+		`[]`,
+		`{"type": "decimal"}`,
+		`{"minLength": -1}`,
+		`{"pattern": "("}`,
+		`{"properties": {"a": 1}}`,
+		`{"anyOf": []}`,
+		`{"$ref": "#/definitions/a"}`,
+		`{"multipleOf": 0}`,
+	} {
+		_, err := compileStorageSchema(schema)
+		assert.Error(t, err, schema)
+	}
+
+	// Unknown keywords and annotations are ignored.
+	_, err := compileStorageSchema(`{"title": "Inventory", "format": "anything", "x-custom": 1}`)
+	assert.NoError(t, err)
+}
+
+func TestStorageCollectionRules(t *testing.T) {
+	rules, err := newStorageCollectionRules(&StorageCollectionRulesConfig{
+		Collection:        "inventory",
+		Schema:            `{"type": "object", "properties": {"gold": {"type": "integer", "minimum": 0}}}`,
+		MaxValueSizeBytes: 32,
+		PermissionRead:    []int{1, 2},
+		PermissionWrite:   []int{1},
+	})
+	require.NoError(t, err)
+
+	op := &StorageOpWrite{OwnerID: "00000000-0000-0000-0000-000000000001", Object: &api.WriteStorageObject{
+		Collection:      "inventory",
+		Key:             "main",
+		PermissionRead:  wrapperspb.Int32(1),
+		PermissionWrite: wrapperspb.Int32(1),
+	}}
+	assert.Nil(t, rules.checkPermissions(op))
+	assert.Nil(t, rules.checkValue(op, `{"gold": 10}`))
+
+	validationErr := rules.checkValue(op, `{"gold": -1}`)
+	require.NotNil(t, validationErr)
+	assert.Equal(t, StorageRejectReasonSchema, validationErr.Reason)
+	require.Len(t, validationErr.Violations, 1)
+	assert.Equal(t, "/gold", validationErr.Violations[0].Path)
+	assert.Equal(t, `Storage write to collection "inventory" key "main" rejected: value does not match collection schema: /gold: must be >= 0`, validationErr.Error())
+
+	validationErr = rules.checkValue(op, `{"gold": 10, "padding": "............"}`)
+	require.NotNil(t, validationErr)
+	assert.Equal(t, StorageRejectReasonSize, validationErr.Reason)
+
+	op.Object.PermissionRead = wrapperspb.Int32(0)
+	validationErr = rules.checkPermissions(op)
+	require.NotNil(t, validationErr)
+	assert.Equal(t, StorageRejectReasonPermissionValue, validationErr.Reason)
+
+	// Permissions not set by the write are not checked.
+	op.Object.PermissionRead = nil
+	assert.Nil(t, rules.checkPermissions(op))
+
+	var target *StorageValidationError
+	assert.True(t, errors.As(error(validationErr), &target))
+	assert.Equal(t, "permission_value", target.Details().Fields["reason"].GetStringValue())
+
+	_, err = newStorageCollectionRules(&StorageCollectionRulesConfig{Collection: "inventory", PermissionRead: []int{3}})
+	assert.Error(t, err)
+	_, err = newStorageCollectionRules(&StorageCollectionRulesConfig{Collection: "inventory", Schema: `{"type": 1}`})
+	assert.Error(t, err)
+	_, err = newStorageCollectionRules(&StorageCollectionRulesConfig{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,222 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"go.uber.org/zap"
+)
+
+const (
+	// Realtime RPC IDs handled by the server itself to subscribe to and unsubscribe from storage changes.
+	StorageSubscribeRpcId   = "nakama.storage.subscribe"
+	StorageUnsubscribeRpcId = "nakama.storage.unsubscribe"
+
+	storageSubscriptionMaxPerRequest = 100
+)
+
+var (
+	ErrStorageSubscriptionEmpty       = errors.New("expects at least one object or collection")
+	ErrStorageSubscriptionTooMany     = errors.New("too many objects or collections")
+	ErrStorageSubscriptionInvalid     = errors.New("expects a non-empty collection, and a non-empty key for objects")
+	ErrStorageSubscriptionInvalidUser = errors.New("expects an empty or valid user id")
+)
+
+// Runtime RPC functions may not be registered under the storage subscription RPC IDs, they would never be called.
+func storageRpcIdsReserved(fns map[string]RuntimeRpcFunction) error {
+	for _, id := range []string{StorageSubscribeRpcId, StorageUnsubscribeRpcId} {
+		if _, found := fns[id]; found {
+			return fmt.Errorf("rpc id %q is reserved for storage subscriptions", id)
+		}
+	}
+	return nil
+}
+
+// StorageSubscription lists storage objects, and collections owned by a user, to receive realtime changes for. An
+// empty user ID refers to objects owned by the system.
+type StorageSubscription struct {
+	Objects []*StorageSubscriptionObject `json:"objects"`
+	// Collections receive changes to every object in them owned by the given user, only the key is ignored.
+	Collections []*StorageSubscriptionObject `json:"collections"`
+}
+
+type StorageSubscriptionObject struct {
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+	UserID     string `json:"user_id"`
+}
+
+// Streams returns the presence stream of each subscribed object and collection.
+func (s *StorageSubscription) Streams() ([]PresenceStream, error) {
+	count := len(s.Objects) + len(s.Collections)
+	if count == 0 {
+		return nil, ErrStorageSubscriptionEmpty
+	}
+	if count > storageSubscriptionMaxPerRequest {
+		return nil, ErrStorageSubscriptionTooMany
+	}
+
+	streams := make([]PresenceStream, 0, count)
+	for i, list := range [][]*StorageSubscriptionObject{s.Objects, s.Collections} {
+		isObject := i == 0
+		for _, o := range list {
+			if o == nil || o.Collection == "" || (isObject && o.Key == "") {
+				return nil, ErrStorageSubscriptionInvalid
+			}
+			ownerID := uuid.Nil
+			if o.UserID != "" {
+				var err error
+				if ownerID, err = uuid.FromString(o.UserID); err != nil {
+					return nil, ErrStorageSubscriptionInvalidUser
+				}
+			}
+			if isObject {
+				streams = append(streams, storageObjectStream(o.Collection, o.Key, ownerID))
+			} else {
+				streams = append(streams, storageCollectionStream(o.Collection, ownerID))
+			}
+		}
+	}
+	return streams, nil
+}
+
+// Subscribers to all objects owned by a user in a collection.
+func storageCollectionStream(collection string, ownerID uuid.UUID) PresenceStream {
+	return PresenceStream{Mode: StreamModeStorage, Subject: ownerID, Label: collection}
+}
+
+// Subscribers to a single object. Keys can be longer than a stream label allows, so are identified by a name based UUID.
+func storageObjectStream(collection, key string, ownerID uuid.UUID) PresenceStream {
+	return PresenceStream{Mode: StreamModeStorage, Subject: ownerID, Subcontext: uuid.NewV5(uuid.Nil, key), Label: collection}
+}
+
+// A committed storage write or delete to publish to subscribers.
+type storageChange struct {
+	Collection     string
+	Key            string
+	UserID         string
+	PermissionRead int32
+	// Nil for deletes.
+	Object *api.StorageObject
+}
+
+func storageWriteChanges(objects []*api.StorageObject) []*storageChange {
+	changes := make([]*storageChange, 0, len(objects))
+	for _, o := range objects {
+		if o == nil {
+			continue
+		}
+		changes = append(changes, &storageChange{
+			Collection:     o.Collection,
+			Key:            o.Key,
+			UserID:         o.UserId,
+			PermissionRead: o.PermissionRead,
+			Object:         o,
+		})
+	}
+	return changes
+}
+
+func storageDeleteChanges(ops StorageOpDeletes, permissionReads map[*StorageOpDelete]int32) []*storageChange {
+	changes := make([]*storageChange, 0, len(permissionReads))
+	for _, op := range ops {
+		permissionRead, deleted := permissionReads[op]
+		if !deleted {
+			continue
+		}
+		changes = append(changes, &storageChange{
+			Collection:     op.ObjectID.Collection,
+			Key:            op.ObjectID.Key,
+			UserID:         op.OwnerID,
+			PermissionRead: permissionRead,
+		})
+	}
+	return changes
+}
+
+// Send committed storage changes to subscribed sessions that are allowed to read the object: anyone for public read
+// objects, only the owner for owner read objects, and no one for objects only readable by the server.
+func storagePublishChanges(logger *zap.Logger, tracker Tracker, router MessageRouter, changes []*storageChange) {
+	if tracker == nil || router == nil {
+		return
+	}
+
+	for _, change := range changes {
+		if change.PermissionRead < 1 {
+			continue
+		}
+		ownerID := uuid.FromStringOrNil(change.UserID)
+
+		var data []byte
+		sent := make(map[uuid.UUID]struct{})
+		for _, stream := range []PresenceStream{storageCollectionStream(change.Collection, ownerID), storageObjectStream(change.Collection, change.Key, ownerID)} {
+			presenceIDs := make([]*PresenceID, 0)
+			for _, p := range tracker.ListByStream(stream, true, true) {
+				if change.PermissionRead < 2 && p.UserID != ownerID {
+					continue
+				}
+				if _, found := sent[p.ID.SessionID]; found {
+					// Sessions subscribed to both the collection and the object receive the change once.
+					continue
+				}
+				sent[p.ID.SessionID] = struct{}{}
+				presenceIDs = append(presenceIDs, &PresenceID{Node: p.ID.Node, SessionID: p.ID.SessionID})
+			}
+			if len(presenceIDs) == 0 {
+				continue
+			}
+
+			if data == nil {
+				var err error
+				if data, err = storageChangeData(change); err != nil {
+					logger.Error("Error encoding storage change.", zap.Error(err))
+					return
+				}
+			}
+			streamWire := &rtapi.Stream{Mode: int32(stream.Mode), Label: stream.Label, Subject: stream.Subject.String()}
+			if stream.Subcontext != uuid.Nil {
+				streamWire.Subcontext = stream.Subcontext.String()
+			}
+			router.SendToPresenceIDs(logger, presenceIDs, &rtapi.Envelope{Message: &rtapi.Envelope_StreamData{StreamData: &rtapi.StreamData{
+				Stream:   streamWire,
+				Data:     string(data),
+				Reliable: true,
+			}}}, true)
+		}
+	}
+}
+
+func storageChangeData(change *storageChange) ([]byte, error) {
+	data := map[string]interface{}{
+		"collection": change.Collection,
+		"key":        change.Key,
+		"user_id":    change.UserID,
+		"deleted":    change.Object == nil,
+	}
+	if o := change.Object; o != nil {
+		data["value"] = o.Value
+		data["version"] = o.Version
+		data["permission_read"] = o.PermissionRead
+		data["permission_write"] = o.PermissionWrite
+		data["update_time"] = o.UpdateTime.AsTime().Unix()
+	}
+	return json.Marshal(data)
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageSubscriptionStreams(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+
+	subscription := &StorageSubscription{
+		Objects:     []*StorageSubscriptionObject{{Collection: "guilds", Key: "base", UserID: userID.String()}},
+		Collections: []*StorageSubscriptionObject{{Collection: "profiles"}},
+	}
+	streams, err := subscription.Streams()
+	require.NoError(t, err)
+	require.Len(t, streams, 2)
+
+	assert.Equal(t, storageObjectStream("guilds", "base", userID), streams[0])
+	assert.Equal(t, StreamModeStorage, streams[0].Mode)
+	assert.Equal(t, userID, streams[0].Subject)
+	assert.NotEqual(t, uuid.Nil, streams[0].Subcontext)
+
+	// Empty user IDs refer to system owned objects.
+	assert.Equal(t, PresenceStream{Mode: StreamModeStorage, Subject: uuid.Nil, Label: "profiles"}, streams[1])
+
+	// Different keys in the same collection are separate streams.
+	assert.NotEqual(t, storageObjectStream("guilds", "base", userID), storageObjectStream("guilds", "hall", userID))
+}
+
+func TestStorageSubscriptionStreamsInvalid(t *testing.T) {
+	for _, subscription := range []*StorageSubscription{
+		{},
+		{Objects: []*StorageSubscriptionObject{{Collection: "guilds"}}},
+		{Collections: []*StorageSubscriptionObject{{Collection: ""}}},
+		{Collections: []*StorageSubscriptionObject{{Collection: "guilds", UserID: "invalid"}}},
+		{Collections: make([]*StorageSubscriptionObject, storageSubscriptionMaxPerRequest+1)},
+	} {
+		_, err := subscription.Streams()
+		assert.Error(t, err)
+	}
+}
+
+func TestStorageRpcIdsReserved(t *testing.T) {
+	assert.NoError(t, storageRpcIdsReserved(map[string]RuntimeRpcFunction{"custom": nil}))
+	assert.Error(t, storageRpcIdsReserved(map[string]RuntimeRpcFunction{StorageSubscribeRpcId: nil}))
+	assert.Error(t, storageRpcIdsReserved(map[string]RuntimeRpcFunction{StorageUnsubscribeRpcId: nil}))
+}
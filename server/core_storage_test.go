@@ -45,7 +45,7 @@ func TestStorageWriteRuntimeGlobalSingle(t *testing.T) {
 			PermissionWrite: &wrapperspb.Int32Value{Value: 1},
 		},
 	}}
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -116,7 +116,7 @@ func TestStorageWriteRuntimeUserMultiple(t *testing.T) {
 			},
 		},
 	}
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -149,7 +149,7 @@ func TestStorageWriteRuntimeGlobalSingleIfMatchNotExists(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -174,7 +174,7 @@ func TestStorageWriteRuntimeGlobalSingleIfMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -199,7 +199,7 @@ func TestStorageWriteRuntimeGlobalSingleIfMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not 0")
@@ -228,7 +228,7 @@ func TestStorageWriteRuntimeGlobalSingleIfMatchExistsFail(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -253,7 +253,7 @@ func TestStorageWriteRuntimeGlobalSingleIfMatchExistsFail(t *testing.T) {
 		},
 	}
 
-	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -279,7 +279,7 @@ func TestStorageWriteRuntimeGlobalSingleIfNoneMatchNotExists(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -307,7 +307,7 @@ func TestStorageWriteRuntimeGlobalSingleIfNoneMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -331,7 +331,7 @@ func TestStorageWriteRuntimeGlobalSingleIfNoneMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -367,7 +367,7 @@ func TestStorageWriteRuntimeGlobalMultipleIfMatchNotExists(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -395,7 +395,7 @@ func TestStorageWritePipelineUserSingle(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -446,7 +446,7 @@ func TestStorageWritePipelineUserMultiple(t *testing.T) {
 		},
 	}
 
-	allAcks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	allAcks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -509,7 +509,7 @@ func TestStorageWriteRuntimeGlobalMultipleSameKey(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -578,7 +578,7 @@ func TestStorageWritePipelineUserMultipleSameKey(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not 0")
@@ -632,7 +632,7 @@ func TestStorageWritePipelineIfMatchNotExists(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -660,7 +660,7 @@ func TestStorageWritePipelineIfMatchExistsFail(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -684,7 +684,7 @@ func TestStorageWritePipelineIfMatchExistsFail(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -713,7 +713,7 @@ func TestStorageWritePipelineIfMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -737,7 +737,7 @@ func TestStorageWritePipelineIfMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -769,7 +769,7 @@ func TestStorageWritePipelineIfNoneMatchNotExists(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -801,7 +801,7 @@ func TestStorageWritePipelineIfNoneMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -825,7 +825,7 @@ func TestStorageWritePipelineIfNoneMatchExists(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -854,7 +854,7 @@ func TestStorageWritePipelinePermissionFail(t *testing.T) {
 		},
 	}
 
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.NotNil(t, acks, "acks was nil")
@@ -877,7 +877,7 @@ func TestStorageWritePipelinePermissionFail(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, acks, "acks was not nil")
 	assert.Equal(t, codes.InvalidArgument, code, "code did not match")
@@ -904,7 +904,7 @@ func TestStorageFetchRuntimeGlobalPrivate(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -952,7 +952,7 @@ func TestStorageFetchRuntimeMixed(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1007,7 +1007,7 @@ func TestStorageFetchRuntimeUserPrivate(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1058,7 +1058,7 @@ func TestStorageFetchPipelineGlobalPrivate(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1103,7 +1103,7 @@ func TestStorageFetchPipelineUserPrivate(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1149,7 +1149,7 @@ func TestStorageFetchPipelineUserRead(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1202,7 +1202,7 @@ func TestStorageFetchPipelineUserPublic(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1254,7 +1254,7 @@ func TestStorageFetchPipelineUserOtherRead(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1299,7 +1299,7 @@ func TestStorageFetchPipelineUserOtherPublic(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1363,7 +1363,7 @@ func TestStorageFetchPipelineUserOtherPublicMixed(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1440,7 +1440,7 @@ func TestStorageRemoveRuntimeGlobalPublic(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1462,7 +1462,7 @@ func TestStorageRemoveRuntimeGlobalPublic(t *testing.T) {
 		},
 	}
 
-	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.Nil(t, err, "err was not nil")
 }
 
@@ -1485,7 +1485,7 @@ func TestStorageRemoveRuntimeGlobalPrivate(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1507,7 +1507,7 @@ func TestStorageRemoveRuntimeGlobalPrivate(t *testing.T) {
 		},
 	}
 
-	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.Nil(t, err, "err was not nil")
 }
 
@@ -1532,7 +1532,7 @@ func TestStorageRemoveRuntimeUserPublic(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1554,7 +1554,7 @@ func TestStorageRemoveRuntimeUserPublic(t *testing.T) {
 		},
 	}
 
-	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.Nil(t, err, "err was not nil")
 }
 
@@ -1579,7 +1579,7 @@ func TestStorageRemoveRuntimeUserPrivate(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1601,7 +1601,7 @@ func TestStorageRemoveRuntimeUserPrivate(t *testing.T) {
 		},
 	}
 
-	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.Nil(t, err, "err was not nil")
 
 	ids := []*api.ReadStorageObjectId{{
@@ -1636,7 +1636,7 @@ func TestStorageRemovePipelineUserWrite(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1658,7 +1658,7 @@ func TestStorageRemovePipelineUserWrite(t *testing.T) {
 		},
 	}
 
-	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	_, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.Nil(t, err, "err was not nil")
 }
 
@@ -1683,7 +1683,7 @@ func TestStorageRemovePipelineUserDenied(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1705,7 +1705,7 @@ func TestStorageRemovePipelineUserDenied(t *testing.T) {
 		},
 	}
 
-	code, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, false, deleteOps)
+	code, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, false, deleteOps)
 	assert.NotNil(t, err, "err was nil")
 	assert.Equal(t, code, codes.InvalidArgument, "code did not match InvalidArgument.")
 }
@@ -1725,7 +1725,7 @@ func TestStorageRemoveRuntimeGlobalIfMatchNotExists(t *testing.T) {
 		},
 	}
 
-	code, err := StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	code, err := StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.NotNil(t, err, "err was nil")
 	assert.Equal(t, code, codes.InvalidArgument, "code did not match InvalidArgument.")
 }
@@ -1749,7 +1749,7 @@ func TestStorageRemoveRuntimeGlobalIfMatchRejected(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1772,7 +1772,7 @@ func TestStorageRemoveRuntimeGlobalIfMatchRejected(t *testing.T) {
 		},
 	}
 
-	code, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	code, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.NotNil(t, err, "err was not nil")
 	assert.Equal(t, code, codes.InvalidArgument, "code did not match InvalidArgument.")
 }
@@ -1796,7 +1796,7 @@ func TestStorageRemoveRuntimeGlobalIfMatch(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1819,7 +1819,7 @@ func TestStorageRemoveRuntimeGlobalIfMatch(t *testing.T) {
 		},
 	}
 
-	code, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, deleteOps)
+	code, err = StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, deleteOps)
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, code, codes.OK, "code did not match OK.")
 }
@@ -1864,7 +1864,7 @@ func TestStorageListRuntimeUser(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1921,7 +1921,7 @@ func TestStorageListPipelineUserSelf(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -1980,7 +1980,7 @@ func TestStorageListPipelineUserOther(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -2077,7 +2077,7 @@ func TestStorageListNoRepeats(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -2115,7 +2115,7 @@ func TestStorageOverrwriteEmptyAndNonEmptyVersions(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -2135,7 +2135,7 @@ func TestStorageOverrwriteEmptyAndNonEmptyVersions(t *testing.T) {
 		},
 	}
 
-	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -2156,7 +2156,7 @@ func TestStorageOverrwriteEmptyAndNonEmptyVersions(t *testing.T) {
 		},
 	}
 
-	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not OK")
@@ -2304,7 +2304,7 @@ func writeObject(t *testing.T, db *sql.DB, collection, key string, owner uuid.UU
 			PermissionWrite: &wrapperspb.Int32Value{Value: int32(writePerm)},
 		},
 	}}
-	return StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, authoritative, ops)
+	return StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, authoritative, ops)
 }
 
 func TestOCCWriteSameValueWithOutdatedVersionFail(t *testing.T) {
@@ -2329,7 +2329,7 @@ func TestOCCWriteSameValueWithOutdatedVersionFail(t *testing.T) {
 	}
 
 	// Create object
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 	assert.Nil(t, err)
 	assert.Len(t, acks.Acks, 1)
 
@@ -2338,12 +2338,12 @@ func TestOCCWriteSameValueWithOutdatedVersionFail(t *testing.T) {
 	ops[0].Object.Version = version
 	ops[0].Object.Value = `{"closed":true}`
 
-	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 	assert.Nil(t, err)
 	assert.Len(t, acks.Acks, 1)
 
 	// Rewrite object to same value with now invalid version -- must fail
-	_, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	_, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 	assert.NotNil(t, err)
 	assert.Equal(t, "Storage write rejected - version check failed.", err.Error())
 }
@@ -2370,7 +2370,7 @@ func TestOCCWriteSameValueCorrectVersionSuccess(t *testing.T) {
 	}
 
 	// Create object
-	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 	assert.Nil(t, err)
 	assert.Len(t, acks.Acks, 1)
 
@@ -2378,14 +2378,14 @@ func TestOCCWriteSameValueCorrectVersionSuccess(t *testing.T) {
 	ops[0].Object.Version = acks.Acks[0].Version
 	ops[0].Object.Value = `{"closed":true}`
 
-	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 	assert.Nil(t, err)
 	assert.Len(t, acks.Acks, 1)
 
 	// Rewrite object to same value with correct version -- must succeed
 	ops[0].Object.Version = acks.Acks[0].Version
 
-	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, ops)
+	acks, _, err = StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
 	assert.Nil(t, err)
 	assert.Len(t, acks.Acks, 1)
 }
@@ -2422,7 +2422,7 @@ func TestStorageReadObjectsSameArgs(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not 0")
@@ -2520,7 +2520,7 @@ func TestStorageReadObjectsOneDistinctArg(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not 0")
@@ -2639,7 +2639,7 @@ func TestStorageReadObjectsTwoDistinctArgs(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not 0")
@@ -2735,7 +2735,7 @@ func TestStorageReadObjectsAllDistinctArgs(t *testing.T) {
 		},
 	}
 
-	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, false, ops)
+	acks, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, false, ops)
 
 	assert.Nil(t, err, "err was not nil")
 	assert.Equal(t, codes.OK, code, "code was not 0")
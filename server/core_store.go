@@ -0,0 +1,367 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// StoreCatalog holds the products users can buy with virtual currency or in-app purchases, loaded from config and
+// registered by the runtime.
+type StoreCatalog interface {
+	RegisterProduct(product *StoreProductConfig) error
+	Product(id string) *StoreProductConfig
+	IapProduct(iapProductID string) *StoreProductConfig
+	Products() []*StoreProductConfig
+}
+
+type LocalStoreCatalog struct {
+	sync.RWMutex
+	products []*StoreProductConfig
+	byID     map[string]*StoreProductConfig
+	byIapID  map[string]*StoreProductConfig
+}
+
+func NewLocalStoreCatalog(config *StoreConfig) (StoreCatalog, error) {
+	c := &LocalStoreCatalog{
+		products: make([]*StoreProductConfig, 0, len(config.Products)),
+		byID:     make(map[string]*StoreProductConfig, len(config.Products)),
+		byIapID:  make(map[string]*StoreProductConfig, len(config.Products)),
+	}
+	for _, product := range config.Products {
+		if err := c.RegisterProduct(product); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *LocalStoreCatalog) RegisterProduct(product *StoreProductConfig) error {
+	if err := storeProductValid(product); err != nil {
+		return err
+	}
+	product = product.Clone()
+	iapProductIDs := product.IapProductIds
+	if len(iapProductIDs) == 0 {
+		iapProductIDs = []string{product.Id}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if _, found := c.byID[product.Id]; found {
+		return fmt.Errorf("store product %q is already registered", product.Id)
+	}
+	for _, iapProductID := range iapProductIDs {
+		if existing, found := c.byIapID[iapProductID]; found {
+			return fmt.Errorf("in-app purchase product %q is already fulfilled by store product %q", iapProductID, existing.Id)
+		}
+	}
+	c.products = append(c.products, product)
+	c.byID[product.Id] = product
+	for _, iapProductID := range iapProductIDs {
+		c.byIapID[iapProductID] = product
+	}
+	return nil
+}
+
+func (c *LocalStoreCatalog) Product(id string) *StoreProductConfig {
+	c.RLock()
+	defer c.RUnlock()
+	return c.byID[id]
+}
+
+func (c *LocalStoreCatalog) IapProduct(iapProductID string) *StoreProductConfig {
+	c.RLock()
+	defer c.RUnlock()
+	return c.byIapID[iapProductID]
+}
+
+func (c *LocalStoreCatalog) Products() []*StoreProductConfig {
+	c.RLock()
+	defer c.RUnlock()
+	return append(make([]*StoreProductConfig, 0, len(c.products)), c.products...)
+}
+
+func storeProductValid(product *StoreProductConfig) error {
+	if product.Id == "" {
+		return errors.New("store product 'id' must be set")
+	}
+	for _, iapProductID := range product.IapProductIds {
+		if iapProductID == "" {
+			return errors.New("store product 'iap_product_ids' must not be empty strings")
+		}
+	}
+	for currency, amount := range product.Price {
+		if currency == "" || amount < 1 {
+			return errors.New("store product 'price' must have non-empty currencies with amounts greater than 0")
+		}
+	}
+	for currency, amount := range product.Wallet {
+		if currency == "" || amount < 1 {
+			return errors.New("store product 'wallet' must have non-empty currencies with amounts greater than 0")
+		}
+	}
+	if len(product.Wallet) == 0 && len(product.Items) == 0 {
+		return errors.New("store product must grant 'wallet' currencies or 'items'")
+	}
+	for _, item := range product.Items {
+		if item == nil || item.Collection == "" {
+			return errors.New("store product 'items' must have a collection")
+		}
+		if maybeJSON := []byte(item.Value); !json.Valid(maybeJSON) || bytes.TrimSpace(maybeJSON)[0] != byteBracket {
+			return errors.New("store product 'items' values must be JSON objects")
+		}
+		if item.PermissionRead < 0 || item.PermissionRead > 2 {
+			return errors.New("store product 'items' read permission must be 0, 1 or 2")
+		}
+		if item.PermissionWrite < 0 || item.PermissionWrite > 1 {
+			return errors.New("store product 'items' write permission must be 0 or 1")
+		}
+	}
+	return nil
+}
+
+// Convert a product given by the runtime as a map with the config field names. Item values may be given as objects.
+func storeProductFromMap(productMap map[string]interface{}) (*StoreProductConfig, error) {
+	if items, ok := productMap["items"].([]interface{}); ok {
+		for _, item := range items {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if value, ok := itemMap["value"].(map[string]interface{}); ok {
+				valueBytes, err := json.Marshal(value)
+				if err != nil {
+					return nil, err
+				}
+				itemMap["value"] = string(valueBytes)
+			}
+		}
+	}
+	productBytes, err := json.Marshal(productMap)
+	if err != nil {
+		return nil, err
+	}
+	product := &StoreProductConfig{}
+	if err = json.Unmarshal(productBytes, product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// StorePurchaseResult is what a store purchase granted.
+type StorePurchaseResult struct {
+	ProductId string `json:"product_id"`
+	// Set for in-app purchases.
+	TransactionId string `json:"transaction_id,omitempty"`
+	// Net wallet changes, the granted currencies less any price.
+	Wallet map[string]int64     `json:"wallet,omitempty"`
+	Items  []*StorePurchaseItem `json:"items,omitempty"`
+}
+
+// StorePurchaseItem is a storage object granted by a store purchase.
+type StorePurchaseItem struct {
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+	Version    string `json:"version"`
+}
+
+// StorePurchase buys a product with virtual currency, debiting its price and giving its grants in one transaction.
+func StorePurchase(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, catalog StoreCatalog, userID uuid.UUID, productID string) (*StorePurchaseResult, error) {
+	product := catalog.Product(productID)
+	if product == nil {
+		return nil, status.Error(codes.NotFound, "Store product not found.")
+	}
+	if len(product.Price) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, "Store product can only be bought with an in-app purchase.")
+	}
+
+	changeset := make(map[string]int64, len(product.Price)+len(product.Wallet))
+	for currency, amount := range product.Wallet {
+		changeset[currency] += amount
+	}
+	for currency, amount := range product.Price {
+		changeset[currency] -= amount
+	}
+	metadata, _ := json.Marshal(map[string]string{"store_product_id": product.Id})
+
+	var result *StorePurchaseResult
+	var written []*api.StorageObject
+	err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		result, written, err = storeGrant(ctx, logger, metrics, storageCollections, tx, userID, product, changeset, string(metadata))
+		return err
+	})
+	if err != nil {
+		var negativeErr *runtime.WalletNegativeError
+		if errors.As(err, &negativeErr) {
+			return nil, status.Error(codes.FailedPrecondition, "Insufficient wallet funds for store product.")
+		}
+		return nil, storeError(logger, err, "Error buying store product.")
+	}
+
+	storageIndex.Write(ctx, written)
+	storagePublishChanges(logger, tracker, router, storageWriteChanges(written))
+	return result, nil
+}
+
+// StoreFulfilPurchases gives the grants of the store products matching validated in-app purchases owned by the user.
+// Each purchase is fulfilled at most once, recorded against its transaction ID in the purchase table, so purchases
+// of store products must have been persisted. Refunded purchases and those without a matching product are skipped.
+func StoreFulfilPurchases(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, catalog StoreCatalog, userID uuid.UUID, persisted bool, purchases []*api.ValidatedPurchase) ([]*StorePurchaseResult, error) {
+	if !persisted {
+		for _, purchase := range purchases {
+			if (purchase.RefundTime == nil || purchase.RefundTime.Seconds == 0) && catalog.IapProduct(purchase.ProductId) != nil {
+				return nil, status.Error(codes.FailedPrecondition, "Purchases of store products must be persisted to be fulfilled.")
+			}
+		}
+		return []*StorePurchaseResult{}, nil
+	}
+
+	results := make([]*StorePurchaseResult, 0, len(purchases))
+	for _, purchase := range purchases {
+		if purchase.RefundTime != nil && purchase.RefundTime.Seconds > 0 {
+			continue
+		}
+		product := catalog.IapProduct(purchase.ProductId)
+		if product == nil {
+			continue
+		}
+
+		metadata, _ := json.Marshal(map[string]string{"store_product_id": product.Id, "transaction_id": purchase.TransactionId})
+		var result *StorePurchaseResult
+		var written []*api.StorageObject
+		err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+			result, written = nil, nil
+			query := `
+UPDATE purchase SET fulfilment_time = now(), update_time = now()
+WHERE transaction_id = $1 AND user_id = $2 AND fulfilment_time = '1970-01-01 00:00:00 UTC' AND refund_time = '1970-01-01 00:00:00 UTC'`
+			tag, err := tx.Exec(ctx, query, purchase.TransactionId, userID)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				// Already fulfilled, refunded, or owned by another user.
+				return nil
+			}
+			result, written, err = storeGrant(ctx, logger, metrics, storageCollections, tx, userID, product, product.Wallet, string(metadata))
+			return err
+		})
+		if err != nil {
+			// Not recorded as fulfilled, so validating the purchase again retries it.
+			logger.Error("Error fulfilling store purchase.", zap.Error(err), zap.String("transaction_id", purchase.TransactionId), zap.String("store_product_id", product.Id))
+			return results, status.Error(codes.Internal, "Error fulfilling store purchase.")
+		}
+		if result == nil {
+			continue
+		}
+
+		result.TransactionId = purchase.TransactionId
+		results = append(results, result)
+		storageIndex.Write(ctx, written)
+		storagePublishChanges(logger, tracker, router, storageWriteChanges(written))
+	}
+	return results, nil
+}
+
+// Apply a wallet changeset and give the storage objects of a product, recording the changes in the wallet ledger.
+func storeGrant(ctx context.Context, logger *zap.Logger, metrics Metrics, storageCollections StorageCollectionRegistry, tx pgx.Tx, userID uuid.UUID, product *StoreProductConfig, changeset map[string]int64, metadata string) (*StorePurchaseResult, []*api.StorageObject, error) {
+	result := &StorePurchaseResult{ProductId: product.Id, Wallet: changeset}
+	if len(changeset) > 0 {
+		if _, err := updateWallets(ctx, logger, tx, []*walletUpdate{{UserID: userID, Changeset: changeset, Metadata: metadata}}, true); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(product.Items) == 0 {
+		return result, nil, nil
+	}
+
+	ops := make(StorageOpWrites, 0, len(product.Items))
+	for _, item := range product.Items {
+		key := item.Key
+		if key == "" {
+			key = uuid.Must(uuid.NewV4()).String()
+		}
+		ops = append(ops, &StorageOpWrite{
+			OwnerID: userID.String(),
+			Object: &api.WriteStorageObject{
+				Collection:      item.Collection,
+				Key:             key,
+				Value:           item.Value,
+				PermissionRead:  &wrapperspb.Int32Value{Value: int32(item.PermissionRead)},
+				PermissionWrite: &wrapperspb.Int32Value{Value: int32(item.PermissionWrite)},
+			},
+		})
+	}
+	acks, written, err := storageWriteObjects(ctx, logger, metrics, storageCollections, tx, true, ops)
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Items = make([]*StorePurchaseItem, 0, len(acks))
+	for _, ack := range acks {
+		result.Items = append(result.Items, &StorePurchaseItem{Collection: ack.Collection, Key: ack.Key, Version: ack.Version})
+	}
+	return result, written, nil
+}
+
+func storeError(logger *zap.Logger, err error, message string) error {
+	var validationErr *StorageValidationError
+	if errors.As(err, &validationErr) {
+		return status.Error(codes.FailedPrecondition, validationErr.Error())
+	}
+	logger.Error(message, zap.Error(err))
+	return status.Error(codes.Internal, message)
+}
+
+// Products are listed to clients without their item values, which may be large or not meant for clients until bought.
+type storeCatalogProduct struct {
+	Id     string              `json:"id"`
+	Price  map[string]int64    `json:"price,omitempty"`
+	Wallet map[string]int64    `json:"wallet,omitempty"`
+	Items  []*storeCatalogItem `json:"items,omitempty"`
+}
+
+type storeCatalogItem struct {
+	Collection string `json:"collection"`
+	Key        string `json:"key,omitempty"`
+}
+
+func storeCatalogList(catalog StoreCatalog) []*storeCatalogProduct {
+	products := catalog.Products()
+	list := make([]*storeCatalogProduct, 0, len(products))
+	for _, product := range products {
+		p := &storeCatalogProduct{Id: product.Id, Price: product.Price, Wallet: product.Wallet}
+		for _, item := range product.Items {
+			p.Items = append(p.Items, &storeCatalogItem{Collection: item.Collection, Key: item.Key})
+		}
+		list = append(list, p)
+	}
+	return list
+}
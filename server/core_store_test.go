@@ -0,0 +1,108 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStoreCatalogRegisterProduct(t *testing.T) {
+	catalog, err := NewLocalStoreCatalog(&StoreConfig{Products: []*StoreProductConfig{
+		{Id: "gems_100", Wallet: map[string]int64{"gems": 100}},
+	}})
+	require.NoError(t, err)
+
+	require.NoError(t, catalog.RegisterProduct(&StoreProductConfig{
+		Id:            "starter_pack",
+		IapProductIds: []string{"com.example.starter", "starter_pack_android"},
+		Price:         map[string]int64{"gems": 50},
+		Items:         []*StoreProductItemConfig{{Collection: "inventory", Value: `{"item": "sword"}`}},
+	}))
+
+	// Products without in-app purchase product IDs are fulfilled by their own ID.
+	assert.Equal(t, "gems_100", catalog.IapProduct("gems_100").Id)
+	assert.Equal(t, "starter_pack", catalog.IapProduct("com.example.starter").Id)
+	assert.Equal(t, "starter_pack", catalog.IapProduct("starter_pack_android").Id)
+	assert.Nil(t, catalog.IapProduct("starter_pack"))
+	assert.Equal(t, "starter_pack", catalog.Product("starter_pack").Id)
+	assert.Len(t, catalog.Products(), 2)
+
+	assert.Error(t, catalog.RegisterProduct(&StoreProductConfig{Id: "gems_100", Wallet: map[string]int64{"gems": 1}}))
+	assert.Error(t, catalog.RegisterProduct(&StoreProductConfig{Id: "other", IapProductIds: []string{"com.example.starter"}, Wallet: map[string]int64{"gems": 1}}))
+}
+
+func TestStoreFulfilPurchasesNotPersisted(t *testing.T) {
+	catalog, err := NewLocalStoreCatalog(&StoreConfig{Products: []*StoreProductConfig{
+		{Id: "gems_100", IapProductIds: []string{"com.example.gems"}, Wallet: map[string]int64{"gems": 100}},
+	}})
+	require.NoError(t, err)
+	userID := uuid.Must(uuid.NewV4())
+
+	// Purchases of other products need no fulfilment.
+	results, err := StoreFulfilPurchases(context.Background(), logger, nil, nil, nil, nil, nil, nil, catalog, userID, false, []*api.ValidatedPurchase{{ProductId: "com.example.other", TransactionId: "1"}})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Store product purchases can't be fulfilled once per transaction ID without being persisted.
+	_, err = StoreFulfilPurchases(context.Background(), logger, nil, nil, nil, nil, nil, nil, catalog, userID, false, []*api.ValidatedPurchase{{ProductId: "com.example.gems", TransactionId: "2"}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestStoreProductValid(t *testing.T) {
+	for i, product := range []*StoreProductConfig{
+		{Wallet: map[string]int64{"gems": 1}},
+		{Id: "a"},
+		{Id: "a", Wallet: map[string]int64{"gems": 0}},
+		{Id: "a", Wallet: map[string]int64{"gems": 1}, Price: map[string]int64{"coins": -1}},
+		{Id: "a", Wallet: map[string]int64{"gems": 1}, IapProductIds: []string{""}},
+		{Id: "a", Items: []*StoreProductItemConfig{{Value: `{}`}}},
+		{Id: "a", Items: []*StoreProductItemConfig{{Collection: "inventory", Value: `[]`}}},
+		{Id: "a", Items: []*StoreProductItemConfig{{Collection: "inventory", Value: `{}`, PermissionRead: 3}}},
+		{Id: "a", Items: []*StoreProductItemConfig{{Collection: "inventory", Value: `{}`, PermissionWrite: 2}}},
+	} {
+		assert.Error(t, storeProductValid(product), i)
+	}
+}
+
+func TestStoreProductFromMap(t *testing.T) {
+	product, err := storeProductFromMap(map[string]interface{}{
+		"id":     "starter_pack",
+		"price":  map[string]interface{}{"gems": float64(50)},
+		"wallet": map[string]interface{}{"coins": int64(1000)},
+		"items": []interface{}{
+			map[string]interface{}{"collection": "inventory", "key": "sword", "value": map[string]interface{}{"damage": float64(10)}, "permission_read": float64(2)},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, storeProductValid(product))
+
+	assert.Equal(t, map[string]int64{"gems": 50}, product.Price)
+	assert.Equal(t, map[string]int64{"coins": 1000}, product.Wallet)
+	require.Len(t, product.Items, 1)
+	assert.Equal(t, `{"damage":10}`, product.Items[0].Value)
+	assert.Equal(t, 2, product.Items[0].PermissionRead)
+
+	list := storeCatalogList(&LocalStoreCatalog{products: []*StoreProductConfig{product}})
+	require.Len(t, list, 1)
+	assert.Equal(t, "sword", list[0].Items[0].Key)
+}
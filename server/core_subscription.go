@@ -17,8 +17,6 @@ package server
 import (
 	"bytes"
 	"context"
-	"crypto/ecdsa"
-	"crypto/x509"
 	"database/sql"
 	"encoding/base64"
 	"encoding/gob"
@@ -634,24 +632,6 @@ RETURNING
 	return nil
 }
 
-const AppleRootPEM = `
------BEGIN CERTIFICATE-----
-MIICQzCCAcmgAwIBAgIILcX8iNLFS5UwCgYIKoZIzj0EAwMwZzEbMBkGA1UEAwwS
-QXBwbGUgUm9vdCBDQSAtIEczMSYwJAYDVQQLDB1BcHBsZSBDZXJ0aWZpY2F0aW9u
-IEF1dGhvcml0eTETMBEGA1UECgwKQXBwbGUgSW5jLjELMAkGA1UEBhMCVVMwHhcN
-MTQwNDMwMTgxOTA2WhcNMzkwNDMwMTgxOTA2WjBnMRswGQYDVQQDDBJBcHBsZSBS
-b290IENBIC0gRzMxJjAkBgNVBAsMHUFwcGxlIENlcnRpZmljYXRpb24gQXV0aG9y
-aXR5MRMwEQYDVQQKDApBcHBsZSBJbmMuMQswCQYDVQQGEwJVUzB2MBAGByqGSM49
-AgEGBSuBBAAiA2IABJjpLz1AcqTtkyJygRMc3RCV8cWjTnHcFBbZDuWmBSp3ZHtf
-TjjTuxxEtX/1H7YyYl3J6YRbTzBPEVoA/VhYDKX1DyxNB0cTddqXl5dvMVztK517
-IDvYuVTZXpmkOlEKMaNCMEAwHQYDVR0OBBYEFLuw3qFYM4iapIqZ3r6966/ayySr
-MA8GA1UdEwEB/wQFMAMBAf8wDgYDVR0PAQH/BAQDAgEGMAoGCCqGSM49BAMDA2gA
-MGUCMQCD6cHEFl4aXTQY2e3v9GwOAEZLuN+yRhHFD/3meoyhpmvOwgPUnPWTxnS4
-at+qIxUCMG1mihDK1A3UT82NQz60imOlM27jbdoXt2QfyFMm+YhidDkLF1vLUagM
-6BgD56KyKA==
------END CERTIFICATE-----
-`
-
 type appleNotificationSignedPayload struct {
 	SignedPayload string `json:"signedPayload"`
 }
@@ -665,66 +645,20 @@ type appleNotificationPayload struct {
 }
 
 type appleNotificationData struct {
-	Environment           string `json:"string"`
+	Environment           string `json:"environment"`
 	BundleId              string `json:"bundleId"`
 	BundleVersion         string `json:"bundleVersion"`
 	SignedTransactionInfo string `json:"signedTransactionInfo"`
 	SignedRenewalInfo     string `json:"signedRenewalInfo"`
 }
 
-type appleNotificationTransactionInfo struct {
-	AppAccountToken        string `json:"appAccountToken"`
-	BundleId               string `json:"bundleId"`
-	Environment            string `json:"environment"`
-	TransactionId          string `json:"transactionId"`
-	OriginalTransactionId  string `json:"originalTransactionId"`
-	ProductId              string `json:"productId"`
-	ExpiresDateMs          int64  `json:"expiresDate"`
-	RevocationDateMs       int64  `json:"revocationDate"`
-	OriginalPurchaseDateMs int64  `json:"originalPurchaseDate"`
-	PurchaseDateMs         int64  `json:"purchaseDate"`
-}
-
-//nolint:unused
-func extractApplePublicKeyFromToken(tokenStr string) (*ecdsa.PublicKey, error) {
-	tokenArr := strings.Split(tokenStr, ".")
-	headerByte, err := base64.RawStdEncoding.DecodeString(tokenArr[0])
-	if err != nil {
-		return nil, err
-	}
-
-	type Header struct {
-		Alg string   `json:"alg"`
-		X5c []string `json:"x5c"`
-	}
-	var header Header
-	err = json.Unmarshal(headerByte, &header)
-	if err != nil {
-		return nil, err
-	}
-
-	certByte, err := base64.StdEncoding.DecodeString(header.X5c[0])
-	if err != nil {
-		return nil, err
-	}
-
-	cert, err := x509.ParseCertificate(certByte)
-	if err != nil {
-		return nil, err
-	}
-
-	switch pk := cert.PublicKey.(type) {
-	case *ecdsa.PublicKey:
-		return pk, nil
-	default:
-		return nil, errors.New("appstore public key must be of type ecdsa.PublicKey")
-	}
-}
-
-const AppleNotificationTypeRefund = "REFUND"
+const (
+	AppleNotificationTypeRefund = "REFUND"
+	AppleNotificationTypeRevoke = "REVOKE"
+)
 
 // Store providers notification callback handler functions
-func appleNotificationHandler(logger *zap.Logger, db *sql.DB, purchaseNotificationCallback RuntimePurchaseNotificationAppleFunction, subscriptionNotificationCallback RuntimeSubscriptionNotificationAppleFunction) http.HandlerFunc {
+func appleNotificationHandler(logger *zap.Logger, db *sql.DB, config *IAPAppleConfig, purchaseNotificationCallback RuntimePurchaseNotificationAppleFunction, subscriptionNotificationCallback RuntimeSubscriptionNotificationAppleFunction) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
@@ -741,93 +675,17 @@ func appleNotificationHandler(logger *zap.Logger, db *sql.DB, purchaseNotificati
 			return
 		}
 
-		tokens := strings.Split(applePayload.SignedPayload, ".")
-		if len(tokens) < 3 {
-			logger.Error("Unexpected App Store notification JWS token length")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		seg := tokens[0]
-		if l := len(seg) % 4; l > 0 {
-			seg += strings.Repeat("=", 4-l)
-		}
-
-		headerByte, err := base64.StdEncoding.DecodeString(seg)
-		if err != nil {
-			logger.Error("Failed to decode Apple notification JWS header", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		type Header struct {
-			Alg string   `json:"alg"`
-			X5c []string `json:"x5c"`
-		}
-		var header Header
-
-		if err = json.Unmarshal(headerByte, &header); err != nil {
-			logger.Error("Failed to unmarshal Apple notification JWS header", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		certs := make([][]byte, 0)
-		for _, encodedCert := range header.X5c {
-			cert, err := base64.StdEncoding.DecodeString(encodedCert)
-			if err != nil {
-				logger.Error("Failed to decode Apple notification JWS header certificate", zap.Error(err))
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			certs = append(certs, cert)
-		}
-
-		rootCert := x509.NewCertPool()
-		ok := rootCert.AppendCertsFromPEM([]byte(AppleRootPEM))
-		if !ok {
-			logger.Error("Failed to parse Apple root certificate", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		interCert, err := x509.ParseCertificate(certs[1])
+		roots, err := iap.ParseRootCertificatesApple(config.RootCertificates)
 		if err != nil {
-			logger.Error("Failed to parse Apple notification intermediate certificate", zap.Error(err))
+			logger.Error("Failed to parse Apple root certificates", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		intermedia := x509.NewCertPool()
-		intermedia.AddCert(interCert)
 
-		cert, err := x509.ParseCertificate(certs[2])
+		jsonPayload, err := iap.VerifySignedDataApple(applePayload.SignedPayload, roots)
 		if err != nil {
-			logger.Error("Failed to parse Apple notification certificate", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		opts := x509.VerifyOptions{
-			Roots:         rootCert,
-			Intermediates: intermedia,
-		}
-
-		_, err = cert.Verify(opts)
-		if err != nil {
-			logger.Error("Failed to validate Apple notification signature", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		seg = tokens[1]
-		if l := len(seg) % 4; l > 0 {
-			seg += strings.Repeat("=", 4-l)
-		}
-
-		jsonPayload, err := base64.StdEncoding.DecodeString(seg)
-		if err != nil {
-			logger.Error("Failed to base64 decode App Store notification payload", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
+			logger.Error("Failed to verify App Store notification signature", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
@@ -838,29 +696,34 @@ func appleNotificationHandler(logger *zap.Logger, db *sql.DB, purchaseNotificati
 			return
 		}
 
-		tokens = strings.Split(notificationPayload.Data.SignedTransactionInfo, ".")
-		if len(tokens) < 3 {
-			logger.Error("Unexpected App Store notification SignedTransactionInfo JWS token length")
-			w.WriteHeader(http.StatusInternalServerError)
+		if config.BundleId == "" {
+			// Any app's notifications are signed by Apple, so only the bundle ID ties them to this game.
+			logger.Error("Apple IAP bundle ID is not configured, cannot accept App Store notifications")
+			w.WriteHeader(http.StatusInternalServerError) // Return error to keep retrying until configured.
+			return
+		}
+		if notificationPayload.Data.BundleId != config.BundleId {
+			logger.Warn("Rejecting App Store notification for another bundle", zap.String("bundle_id", notificationPayload.Data.BundleId))
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		seg = tokens[1]
-		if l := len(seg) % 4; l > 0 {
-			seg += strings.Repeat("=", 4-l)
+		if notificationPayload.Data.SignedTransactionInfo == "" {
+			// Notifications such as TEST carry no transaction.
+			logger.Debug("Apple IAP notification without transaction received", zap.String("notification_type", notificationPayload.NotificationType))
+			w.WriteHeader(http.StatusOK)
+			return
 		}
 
-		jsonPayload, err = base64.StdEncoding.DecodeString(seg)
+		signedTransactionInfo, _, err := iap.DecodeSignedTransactionApple(notificationPayload.Data.SignedTransactionInfo, roots)
 		if err != nil {
-			logger.Error("Failed to base64 decode App Store notification payload", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
+			logger.Error("Failed to verify App Store notification SignedTransactionInfo JWS token", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-
-		var signedTransactionInfo *appleNotificationTransactionInfo
-		if err = json.Unmarshal(jsonPayload, &signedTransactionInfo); err != nil {
-			logger.Error("Failed to json unmarshal App Store notification SignedTransactionInfo JWS token", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
+		if signedTransactionInfo.BundleId != config.BundleId {
+			logger.Warn("Rejecting App Store notification transaction for another bundle", zap.String("bundle_id", signedTransactionInfo.BundleId))
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
@@ -877,12 +740,12 @@ func appleNotificationHandler(logger *zap.Logger, db *sql.DB, purchaseNotificati
 		}
 
 		env := api.StoreEnvironment_PRODUCTION
-		if notificationPayload.Data.Environment == iap.AppleSandboxEnvironment {
+		if signedTransactionInfo.Environment == iap.AppleSandboxEnvironment {
 			env = api.StoreEnvironment_SANDBOX
 		}
 
 		ctx := context.Background()
-		if signedTransactionInfo.ExpiresDateMs != 0 {
+		if signedTransactionInfo.ExpiresDate != 0 {
 			// Notification regarding a subscription.
 			if uid.IsNil() {
 				// No user ID was found in receipt, lookup a validated subscription.
@@ -903,11 +766,11 @@ func appleNotificationHandler(logger *zap.Logger, db *sql.DB, purchaseNotificati
 				originalTransactionId: signedTransactionInfo.OriginalTransactionId,
 				store:                 api.StoreProvider_APPLE_APP_STORE,
 				productId:             signedTransactionInfo.ProductId,
-				purchaseTime:          parseMillisecondUnixTimestamp(signedTransactionInfo.OriginalPurchaseDateMs),
+				purchaseTime:          parseMillisecondUnixTimestamp(signedTransactionInfo.OriginalPurchaseDate),
 				environment:           env,
-				expireTime:            parseMillisecondUnixTimestamp(signedTransactionInfo.ExpiresDateMs),
+				expireTime:            parseMillisecondUnixTimestamp(signedTransactionInfo.ExpiresDate),
 				rawNotification:       string(body),
-				refundTime:            parseMillisecondUnixTimestamp(signedTransactionInfo.RevocationDateMs),
+				refundTime:            parseMillisecondUnixTimestamp(signedTransactionInfo.RevocationDate),
 			}
 
 			if err = upsertSubscription(ctx, db, sub); err != nil {
@@ -959,65 +822,36 @@ func appleNotificationHandler(logger *zap.Logger, db *sql.DB, purchaseNotificati
 			}
 
 		} else {
-			// Notification regarding a purchase.
-			if uid.IsNil() {
-				// No user ID was found in receipt, lookup a validated subscription.
-				p, err := GetPurchaseByTransactionId(ctx, db, signedTransactionInfo.TransactionId)
-				if err != nil {
-					// User validated purchase not found.
-					if err != sql.ErrNoRows {
-						logger.Error("Failed to get purchase by transaction id", zap.Error(err))
-					}
-					w.WriteHeader(http.StatusInternalServerError) // Return error to keep retrying.
-					return
-				}
-				uid = uuid.Must(uuid.FromString(p.UserId))
+			// Notification regarding a purchase, only refunds and Family Sharing revocations need processing.
+			if notificationType := strings.ToUpper(notificationPayload.NotificationType); notificationType != AppleNotificationTypeRefund && notificationType != AppleNotificationTypeRevoke {
+				w.WriteHeader(http.StatusOK)
+				return
 			}
 
-			if strings.ToUpper(notificationPayload.NotificationType) == AppleNotificationTypeRefund {
+			err = refundPurchaseApple(ctx, logger, db, purchaseNotificationCallback, signedTransactionInfo, string(body))
+			if err == sql.ErrNoRows && !uid.IsNil() {
+				// The purchase was not validated through this server, but its app account token identifies the user.
 				purchase := &storagePurchase{
 					userID:        uid,
 					store:         api.StoreProvider_APPLE_APP_STORE,
 					productId:     signedTransactionInfo.ProductId,
 					transactionId: signedTransactionInfo.TransactionId,
-					purchaseTime:  parseMillisecondUnixTimestamp(signedTransactionInfo.PurchaseDateMs),
-					refundTime:    parseMillisecondUnixTimestamp(signedTransactionInfo.RevocationDateMs),
+					purchaseTime:  parseMillisecondUnixTimestamp(signedTransactionInfo.PurchaseDate),
 					environment:   env,
 				}
-
-				dbPurchases, err := upsertPurchases(ctx, db, []*storagePurchase{purchase})
-				if err != nil {
-					logger.Error("Failed to store App Store notification purchase data")
+				if _, err = upsertPurchases(ctx, db, []*storagePurchase{purchase}); err != nil {
+					logger.Error("Failed to store App Store notification purchase data", zap.Error(err))
 					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
-
-				if purchaseNotificationCallback != nil {
-					dbPurchase := dbPurchases[0]
-					suid := dbPurchase.userID.String()
-					if dbPurchase.userID.IsNil() {
-						suid = ""
-					}
-					validatedPurchase := &api.ValidatedPurchase{
-						UserId:           suid,
-						ProductId:        signedTransactionInfo.ProductId,
-						TransactionId:    signedTransactionInfo.TransactionId,
-						Store:            api.StoreProvider_APPLE_APP_STORE,
-						CreateTime:       timestamppb.New(dbPurchase.createTime),
-						UpdateTime:       timestamppb.New(dbPurchase.updateTime),
-						PurchaseTime:     timestamppb.New(dbPurchase.purchaseTime),
-						RefundTime:       timestamppb.New(dbPurchase.refundTime),
-						ProviderResponse: string(body),
-						Environment:      env,
-						SeenBefore:       dbPurchase.seenBefore,
-					}
-
-					if err = purchaseNotificationCallback(ctx, validatedPurchase, string(body)); err != nil {
-						logger.Error("Error invoking Apple purchase refund runtime function", zap.Error(err))
-						w.WriteHeader(http.StatusOK)
-						return
-					}
+				err = refundPurchaseApple(ctx, logger, db, purchaseNotificationCallback, signedTransactionInfo, string(body))
+			}
+			if err != nil {
+				if err != sql.ErrNoRows {
+					logger.Error("Failed to store App Store notification purchase refund", zap.Error(err))
 				}
+				w.WriteHeader(http.StatusInternalServerError) // Return error to keep retrying.
+				return
 			}
 		}
 
@@ -0,0 +1,396 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	totpPeriodSec          = 30
+	totpDigits             = 6
+	totpSkewSteps          = 1
+	totpRecoveryCodeCount  = 10
+	totpMaxFailedAttempts  = 5
+	totpLockoutDurationSec = 300
+)
+
+var totpBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TotpEnrolment holds the shared secret for an authenticator app, and the otpauth URI clients can show as a QR code.
+type TotpEnrolment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+// Start enrolling an account in two-factor authentication, replacing any enrolment that was not confirmed.
+func TotpEnrol(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, userID uuid.UUID) (*TotpEnrolment, error) {
+	var username string
+	if err := db.QueryRowContext(ctx, "SELECT username FROM users WHERE id = $1", userID).Scan(&username); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "User account not found.")
+		}
+		logger.Error("Error looking up user.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error enrolling two-factor authentication.")
+	}
+
+	secretBytes := make([]byte, 20)
+	if _, err := rand.Read(secretBytes); err != nil {
+		logger.Error("Error generating TOTP secret.", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Error enrolling two-factor authentication.")
+	}
+	secret := totpBase32.EncodeToString(secretBytes)
+
+	query := `
+INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET secret = $2, last_step = 0, failed_attempts = 0, create_time = now()
+WHERE user_totp.confirm_time = '1970-01-01 00:00:00 UTC'`
+	res, err := db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		logger.Error("Error storing TOTP secret.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error enrolling two-factor authentication.")
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected != 1 {
+		return nil, status.Error(codes.AlreadyExists, "Two-factor authentication is already enabled.")
+	}
+
+	issuer := config.GetSession().TotpIssuer
+	if issuer == "" {
+		issuer = config.GetName()
+	}
+	return &TotpEnrolment{Secret: secret, Uri: totpUri(issuer, username, secret)}, nil
+}
+
+// Confirm an enrolment with a code from the authenticator app, enabling two-factor authentication. Returns the
+// account's recovery codes, which are not stored in plain text and cannot be listed again.
+func TotpConfirm(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, code string) ([]string, error) {
+	var secret string
+	var lastStep int64
+	var confirmTime pgtype.Timestamptz
+	err := db.QueryRowContext(ctx, "SELECT secret, last_step, confirm_time FROM user_totp WHERE user_id = $1", userID).Scan(&secret, &lastStep, &confirmTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.FailedPrecondition, "Two-factor authentication enrolment not started.")
+		}
+		logger.Error("Error looking up TOTP enrolment.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error confirming two-factor authentication.")
+	}
+	if confirmTime.Time.Unix() != 0 {
+		return nil, status.Error(codes.AlreadyExists, "Two-factor authentication is already enabled.")
+	}
+
+	step, ok := totpValidate(secret, code, lastStep, time.Now())
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "Two-factor authentication code invalid.")
+	}
+
+	recoveryCodes, hashes, err := totpRecoveryCodesGenerate()
+	if err != nil {
+		logger.Error("Error generating TOTP recovery codes.", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Error confirming two-factor authentication.")
+	}
+	if err = ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE user_totp SET confirm_time = now(), last_step = $2 WHERE user_id = $1", userID, step); err != nil {
+			return err
+		}
+		return totpRecoveryCodesReplace(ctx, tx, userID, hashes)
+	}); err != nil {
+		logger.Error("Error confirming TOTP enrolment.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error confirming two-factor authentication.")
+	}
+
+	return recoveryCodes, nil
+}
+
+// Turn off two-factor authentication, which requires a current code or a recovery code.
+func TotpDisable(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, code string) error {
+	if err := TotpVerify(ctx, logger, db, userID, code, true); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		logger.Error("Error disabling TOTP.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error disabling two-factor authentication.")
+	}
+	return nil
+}
+
+// Replace an account's recovery codes, which requires a current code from the authenticator app.
+func TotpRecoveryCodesRegenerate(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, code string) ([]string, error) {
+	if err := TotpVerify(ctx, logger, db, userID, code, false); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, hashes, err := totpRecoveryCodesGenerate()
+	if err != nil {
+		logger.Error("Error generating TOTP recovery codes.", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Error generating recovery codes.")
+	}
+	if err = ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		return totpRecoveryCodesReplace(ctx, tx, userID, hashes)
+	}); err != nil {
+		logger.Error("Error storing TOTP recovery codes.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error generating recovery codes.")
+	}
+
+	return recoveryCodes, nil
+}
+
+// Check if an account has confirmed two-factor authentication.
+func TotpEnabled(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID) (bool, error) {
+	var enabled bool
+	query := "SELECT EXISTS (SELECT user_id FROM user_totp WHERE user_id = $1 AND confirm_time > '1970-01-01 00:00:00 UTC')"
+	if err := db.QueryRowContext(ctx, query, userID).Scan(&enabled); err != nil {
+		logger.Error("Error checking TOTP enrolment.", zap.Error(err), zap.String("user_id", userID.String()))
+		return false, status.Error(codes.Internal, "Error checking two-factor authentication.")
+	}
+	return enabled, nil
+}
+
+// Verify a code for an account with two-factor authentication enabled. Each code is accepted once, and recovery codes
+// are consumed when used if allowed. Repeated failures lock verification for a few minutes.
+func TotpVerify(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, code string, allowRecovery bool) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return status.Error(codes.InvalidArgument, "Two-factor authentication code is required.")
+	}
+
+	var verified bool
+	err := ExecuteInTx(ctx, db, func(tx *sql.Tx) error {
+		verified = false
+		var secret string
+		var lastStep int64
+		var failedAttempts int
+		var lockoutTime pgtype.Timestamptz
+		query := "SELECT secret, last_step, failed_attempts, lockout_time FROM user_totp WHERE user_id = $1 AND confirm_time > '1970-01-01 00:00:00 UTC' FOR UPDATE"
+		if err := tx.QueryRowContext(ctx, query, userID).Scan(&secret, &lastStep, &failedAttempts, &lockoutTime); err != nil {
+			if err == sql.ErrNoRows {
+				return StatusError(codes.FailedPrecondition, "Two-factor authentication is not enabled.", err)
+			}
+			return err
+		}
+		now := time.Now()
+		if lockoutTime.Time.After(now) {
+			return StatusError(codes.ResourceExhausted, "Too many failed two-factor authentication attempts, try again later.", ErrRowsAffectedCount)
+		}
+
+		if step, ok := totpValidate(secret, code, lastStep, now); ok {
+			verified = true
+			_, err := tx.ExecContext(ctx, "UPDATE user_totp SET last_step = $2, failed_attempts = 0 WHERE user_id = $1", userID, step)
+			return err
+		}
+		if allowRecovery {
+			res, err := tx.ExecContext(ctx, "DELETE FROM user_totp_recovery WHERE user_id = $1 AND code = $2", userID, totpRecoveryCodeHash(code))
+			if err != nil {
+				return err
+			}
+			if rowsAffected, _ := res.RowsAffected(); rowsAffected == 1 {
+				verified = true
+				_, err = tx.ExecContext(ctx, "UPDATE user_totp SET failed_attempts = 0 WHERE user_id = $1", userID)
+				return err
+			}
+		}
+
+		// Record the failure, the transaction must still commit.
+		if failedAttempts+1 >= totpMaxFailedAttempts {
+			_, err := tx.ExecContext(ctx, "UPDATE user_totp SET failed_attempts = 0, lockout_time = $2 WHERE user_id = $1", userID, now.Add(totpLockoutDurationSec*time.Second).UTC())
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE user_totp SET failed_attempts = failed_attempts + 1 WHERE user_id = $1", userID)
+		return err
+	})
+	if err != nil {
+		if e, ok := err.(*statusError); ok {
+			return e.Status()
+		}
+		logger.Error("Error verifying TOTP code.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error verifying two-factor authentication code.")
+	}
+	if !verified {
+		return status.Error(codes.InvalidArgument, "Two-factor authentication code invalid.")
+	}
+	return nil
+}
+
+// TotpChallengeCheck returns nil if the account can be issued a session. For accounts with two-factor authentication it
+// returns an unauthenticated error instead, with a challenge for the second authentication step in its details.
+func TotpChallengeCheck(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, userID uuid.UUID, username string, vars map[string]string) error {
+	enabled, err := TotpEnabled(ctx, logger, db, userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+
+	st := status.New(codes.Unauthenticated, "Two-factor authentication required.")
+	details, err := structpb.NewStruct(map[string]interface{}{"reason": "totp_required", "challenge": totpChallengeGenerate(config, userID.String(), username, vars)})
+	if err != nil {
+		logger.Error("Error encoding two-factor authentication challenge.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error issuing two-factor authentication challenge.")
+	}
+	withDetails, err := st.WithDetails(details)
+	if err != nil {
+		logger.Error("Error encoding two-factor authentication challenge.", zap.Error(err), zap.String("user_id", userID.String()))
+		return status.Error(codes.Internal, "Error issuing two-factor authentication challenge.")
+	}
+	return withDetails.Err()
+}
+
+// Issue a challenge for the second authentication step. It is signed with a key derived from the session encryption
+// key, so it can never be used as a session or refresh token.
+func totpChallengeGenerate(config Config, userID, username string, vars map[string]string) string {
+	exp := time.Now().UTC().Add(time.Duration(config.GetSession().TotpChallengeExpirySec) * time.Second).Unix()
+	token, _ := generateTokenWithExpiry(totpChallengeKey(config), uuid.Must(uuid.NewV4()).String(), userID, username, vars, exp)
+	return token
+}
+
+// Complete the second authentication step, returning the account the challenge was issued for.
+func TotpChallengeVerify(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, challenge, code string) (uuid.UUID, string, map[string]string, error) {
+	userID, _, vars, _, _, ok := parseToken([]byte(totpChallengeKey(config)), challenge)
+	if !ok {
+		return uuid.Nil, "", nil, status.Error(codes.Unauthenticated, "Two-factor authentication challenge invalid or expired.")
+	}
+
+	if err := TotpVerify(ctx, logger, db, userID, code, true); err != nil {
+		return uuid.Nil, "", nil, err
+	}
+
+	// The account may have changed since the challenge was issued.
+	var username string
+	var disableTime pgtype.Timestamptz
+	if err := db.QueryRowContext(ctx, "SELECT username, disable_time FROM users WHERE id = $1", userID).Scan(&username, &disableTime); err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, "", nil, status.Error(codes.NotFound, "User account not found.")
+		}
+		logger.Error("Error looking up user by ID.", zap.Error(err), zap.String("user_id", userID.String()))
+		return uuid.Nil, "", nil, status.Error(codes.Internal, "Error finding user account.")
+	}
+	if disableTime.Status == pgtype.Present && disableTime.Time.Unix() != 0 {
+		return uuid.Nil, "", nil, status.Error(codes.PermissionDenied, "User account banned.")
+	}
+
+	return userID, username, vars, nil
+}
+
+func totpChallengeKey(config Config) string {
+	mac := hmac.New(sha256.New, []byte(config.GetSession().EncryptionKey))
+	mac.Write([]byte("totp_challenge"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check a code against the current time step and its neighbours, rejecting steps at or before the last accepted one.
+func totpValidate(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpBase32.DecodeString(secret)
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriodSec
+	for step := current - totpSkewSteps; step <= current+totpSkewSteps; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Compute the RFC 6238 code for a time step, using HMAC-SHA1 as authenticator apps expect.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+func totpUri(issuer, username, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", totpPeriodSec))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+username) + "?" + params.Encode()
+}
+
+func totpRecoveryCodesGenerate() ([]string, []string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodes := make([]string, 0, totpRecoveryCodeCount)
+	hashes := make([]string, 0, totpRecoveryCodeCount)
+	b := make([]byte, 10)
+	for i := 0; i < totpRecoveryCodeCount; i++ {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		recoveryCodes = append(recoveryCodes, code)
+		hashes = append(hashes, totpRecoveryCodeHash(code))
+	}
+	return recoveryCodes, hashes, nil
+}
+
+func totpRecoveryCodesReplace(ctx context.Context, tx *sql.Tx, userID uuid.UUID, hashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp_recovery WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_totp_recovery (user_id, code) VALUES ($1, $2)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func totpRecoveryCodeHash(code string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(hash[:])
+}
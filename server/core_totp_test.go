@@ -0,0 +1,127 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Test vectors from RFC 6238 appendix B, truncated to 6 digits.
+func TestTotpCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for unix, expected := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		assert.Equal(t, expected, totpCode(key, unix/totpPeriodSec), "time %d", unix)
+	}
+}
+
+func TestTotpValidate(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpBase32.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriodSec
+
+	step, ok := totpValidate(secret, totpCode(key, current), 0, now)
+	assert.True(t, ok)
+	assert.Equal(t, current, step)
+
+	// Neighbouring steps are accepted to allow for clock drift, but nothing further.
+	_, ok = totpValidate(secret, totpCode(key, current-1), 0, now)
+	assert.True(t, ok)
+	_, ok = totpValidate(secret, totpCode(key, current+1), 0, now)
+	assert.True(t, ok)
+	_, ok = totpValidate(secret, totpCode(key, current-2), 0, now)
+	assert.False(t, ok)
+
+	// A code cannot be replayed once its step has been accepted.
+	_, ok = totpValidate(secret, totpCode(key, current), current, now)
+	assert.False(t, ok)
+
+	_, ok = totpValidate(secret, "12345", 0, now)
+	assert.False(t, ok)
+}
+
+func TestTotpChallengeNotSession(t *testing.T) {
+	config := NewConfig(logger)
+	userID := uuid.Must(uuid.NewV4())
+
+	challenge := totpChallengeGenerate(config, userID.String(), "username", map[string]string{"k": "v"})
+
+	_, _, _, _, _, ok := parseToken([]byte(config.GetSession().EncryptionKey), challenge)
+	assert.False(t, ok, "challenge must not be accepted as a session token")
+	_, _, _, _, _, ok = parseToken([]byte(config.GetSession().RefreshEncryptionKey), challenge)
+	assert.False(t, ok, "challenge must not be accepted as a refresh token")
+
+	parsedUserID, username, vars, _, _, ok := parseToken([]byte(totpChallengeKey(config)), challenge)
+	assert.True(t, ok)
+	assert.Equal(t, userID, parsedUserID)
+	assert.Equal(t, "username", username)
+	assert.Equal(t, map[string]string{"k": "v"}, vars)
+}
+
+func TestTotpRequiredToAuthenticate(t *testing.T) {
+	runtime, _, err := runtimeWithModules(t, map[string]string{})
+	require.NoError(t, err)
+	apiServer, _ := NewAPIServer(t, runtime)
+	defer apiServer.Stop()
+
+	customID := uuid.Must(uuid.NewV4()).String()
+	conn, client, session, ctx := NewSession(t, customID)
+	defer conn.Close()
+	userID, err := UserIDFromSession(session)
+	require.NoError(t, err)
+
+	enrolment, err := TotpEnrol(ctx, logger, apiServer.db, cfg, userID)
+	require.NoError(t, err)
+	key, err := totpBase32.DecodeString(enrolment.Secret)
+	require.NoError(t, err)
+	recoveryCodes, err := TotpConfirm(ctx, logger, apiServer.db, userID, totpCode(key, time.Now().Unix()/totpPeriodSec))
+	require.NoError(t, err)
+
+	// Authenticating again gets a challenge in the error details, never a session.
+	session, err = client.AuthenticateCustom(ctx, &api.AuthenticateCustomRequest{Account: &api.AccountCustom{Id: customID}})
+	assert.Nil(t, session)
+	st := status.Convert(err)
+	require.Equal(t, codes.Unauthenticated, st.Code())
+	require.Len(t, st.Details(), 1)
+	details, ok := st.Details()[0].(*structpb.Struct)
+	require.True(t, ok)
+	challenge := details.AsMap()["challenge"].(string)
+
+	verifiedUserID, _, _, err := TotpChallengeVerify(ctx, logger, apiServer.db, cfg, challenge, recoveryCodes[0])
+	require.NoError(t, err)
+	assert.Equal(t, userID, verifiedUserID)
+
+	// Other authentication methods linked to the account are held to the same check.
+	deviceID := uuid.Must(uuid.NewV4()).String()
+	_, err = apiServer.db.Exec("INSERT INTO user_device (id, user_id) VALUES ($1, $2)", deviceID, userID)
+	require.NoError(t, err)
+	_, err = client.AuthenticateDevice(ctx, &api.AuthenticateDeviceRequest{Account: &api.AccountDevice{Id: deviceID}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,859 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	tradeStateOpen = iota
+	tradeStateAccepted
+	tradeStateCancelled
+	tradeStateExpired
+)
+
+var tradeStates = map[int]string{
+	tradeStateOpen:      "open",
+	tradeStateAccepted:  "accepted",
+	tradeStateCancelled: "cancelled",
+	tradeStateExpired:   "expired",
+}
+
+// Trade actions passed to the trade hooks and recorded in wallet ledger metadata.
+const (
+	TradeActionPropose = "propose"
+	TradeActionCounter = "counter"
+	TradeActionAccept  = "accept"
+	TradeActionCancel  = "cancel"
+	TradeActionExpire  = "expire"
+
+	tradeListMax = 100
+)
+
+var tradeNotificationCodes = map[string]int32{
+	TradeActionPropose: NotificationCodeTradePropose,
+	TradeActionCounter: NotificationCodeTradeCounter,
+	TradeActionAccept:  NotificationCodeTradeAccept,
+	TradeActionCancel:  NotificationCodeTradeCancel,
+	TradeActionExpire:  NotificationCodeTradeExpire,
+}
+
+var tradeNotificationSubjects = map[string]string{
+	TradeActionPropose: "You received a trade offer.",
+	TradeActionCounter: "Your trade offer was countered.",
+	TradeActionAccept:  "Your trade offer was accepted.",
+	TradeActionCancel:  "A trade was cancelled.",
+	TradeActionExpire:  "A trade expired.",
+}
+
+// Trade is a player to player exchange of wallet currencies and storage objects. The proposer's side of the current
+// offer is held in escrow until the other party accepts it, counters it, or the trade is cancelled or expires.
+type Trade struct {
+	Id             string      `json:"id"`
+	SenderId       string      `json:"sender_id"`
+	RecipientId    string      `json:"recipient_id"`
+	ProposerId     string      `json:"proposer_id"`
+	State          string      `json:"state"`
+	SenderOffer    *TradeOffer `json:"sender_offer"`
+	RecipientOffer *TradeOffer `json:"recipient_offer"`
+	CreateTime     int64       `json:"create_time"`
+	UpdateTime     int64       `json:"update_time"`
+	ExpiryTime     int64       `json:"expiry_time"`
+}
+
+// TradeOffer is what one side of a trade gives.
+type TradeOffer struct {
+	Wallet map[string]int64 `json:"wallet,omitempty"`
+	Items  []*TradeItem     `json:"items,omitempty"`
+}
+
+// TradeItem identifies a storage object owned by the side of the trade offering it.
+type TradeItem struct {
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+}
+
+type TradeList struct {
+	Trades []*Trade `json:"trades"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
+type tradeListCursor struct {
+	UpdateTime int64
+	ID         uuid.UUID
+}
+
+// A storage object taken from its owner while it is offered in an open trade.
+type tradeEscrowItem struct {
+	Collection      string `json:"collection"`
+	Key             string `json:"key"`
+	Value           string `json:"value"`
+	PermissionRead  int32  `json:"permission_read"`
+	PermissionWrite int32  `json:"permission_write"`
+}
+
+// The runtime RPC functions configured to run before and after trade actions, if any.
+type tradeHooks struct {
+	before RuntimeBeforeTradeFunction
+	after  RuntimeAfterTradeFunction
+}
+
+func newTradeHooks(runtime *Runtime) *tradeHooks {
+	return &tradeHooks{
+		before: runtime.BeforeTrade(),
+		after:  runtime.AfterTrade(),
+	}
+}
+
+// Run the before hook with the trade as it would be after the action, any error it returns rejects the action.
+func (h *tradeHooks) Before(ctx context.Context, userID uuid.UUID, action string, trade *Trade) error {
+	if h == nil || h.before == nil {
+		return nil
+	}
+	if err, code := h.before(ctx, userID.String(), action, trade); err != nil {
+		return status.Error(code, err.Error())
+	}
+	return nil
+}
+
+func (h *tradeHooks) After(ctx context.Context, logger *zap.Logger, userID uuid.UUID, action string, trade *Trade) {
+	if h == nil || h.after == nil {
+		return
+	}
+	if err := h.after(ctx, userID.String(), action, trade); err != nil {
+		logger.Error("Error running trade after hook.", zap.Error(err), zap.String("trade_id", trade.Id), zap.String("action", action))
+	}
+}
+
+// Storage changes made by a trade, applied to storage indices and published to subscribers once committed.
+type tradeStorageChanges struct {
+	deletes     StorageOpDeletes
+	deleteReads map[*StorageOpDelete]int32
+	written     []*api.StorageObject
+}
+
+func (c *tradeStorageChanges) publish(ctx context.Context, logger *zap.Logger, storageIndex StorageIndex, tracker Tracker, router MessageRouter) {
+	storageIndex.Write(ctx, c.written)
+	storageIndex.Delete(ctx, c.deletes)
+	storagePublishChanges(logger, tracker, router, storageWriteChanges(c.written))
+	storagePublishChanges(logger, tracker, router, storageDeleteChanges(c.deletes, c.deleteReads))
+}
+
+func tradeOfferValid(config *TradeConfig, offer *TradeOffer) error {
+	if offer == nil {
+		return nil
+	}
+	for currency, amount := range offer.Wallet {
+		if currency == "" || amount < 1 {
+			return status.Error(codes.InvalidArgument, "Trade wallet offers must have non-empty currencies with amounts greater than 0.")
+		}
+	}
+	if len(offer.Items) == 0 {
+		return nil
+	}
+	if len(offer.Items) > config.MaxItems {
+		return status.Errorf(codes.InvalidArgument, "Trade offers can contain at most %d items.", config.MaxItems)
+	}
+	seen := make(map[TradeItem]struct{}, len(offer.Items))
+	for _, item := range offer.Items {
+		if item == nil || item.Collection == "" || item.Key == "" {
+			return status.Error(codes.InvalidArgument, "Trade items must have a collection and key.")
+		}
+		allowed := false
+		for _, collection := range config.ItemCollections {
+			if collection == item.Collection {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return status.Errorf(codes.InvalidArgument, "Storage objects in collection %q cannot be traded.", item.Collection)
+		}
+		if _, found := seen[*item]; found {
+			return status.Error(codes.InvalidArgument, "Trade items must not be repeated.")
+		}
+		seen[*item] = struct{}{}
+	}
+	return nil
+}
+
+func tradeOffersValid(config *TradeConfig, senderOffer, recipientOffer *TradeOffer) error {
+	if tradeOfferEmpty(senderOffer) && tradeOfferEmpty(recipientOffer) {
+		return status.Error(codes.InvalidArgument, "Trades must offer something on at least one side.")
+	}
+	if err := tradeOfferValid(config, senderOffer); err != nil {
+		return err
+	}
+	return tradeOfferValid(config, recipientOffer)
+}
+
+func tradeOfferEmpty(offer *TradeOffer) bool {
+	return offer == nil || (len(offer.Wallet) == 0 && len(offer.Items) == 0)
+}
+
+// The offer of the given party.
+func (t *Trade) offer(userID string) *TradeOffer {
+	if userID == t.SenderId {
+		return t.SenderOffer
+	}
+	return t.RecipientOffer
+}
+
+// TradePropose opens a trade from sender to recipient, taking the sender's offer into escrow.
+func TradePropose(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, hooks *tradeHooks, senderID, recipientID uuid.UUID, senderOffer, recipientOffer *TradeOffer, expirySec int) (*Trade, error) {
+	if senderID == recipientID {
+		return nil, status.Error(codes.InvalidArgument, "Cannot trade with yourself.")
+	}
+	if err := tradeOffersValid(config.GetTrade(), senderOffer, recipientOffer); err != nil {
+		return nil, err
+	}
+	if expirySec == 0 {
+		expirySec = config.GetTrade().DefaultExpirySec
+	}
+	if expirySec < 1 || expirySec > config.GetTrade().MaxExpirySec {
+		return nil, status.Errorf(codes.InvalidArgument, "Trade expiry must be between 1 and %d seconds.", config.GetTrade().MaxExpirySec)
+	}
+
+	now := time.Now().UTC()
+	trade := &Trade{
+		Id:             uuid.Must(uuid.NewV4()).String(),
+		SenderId:       senderID.String(),
+		RecipientId:    recipientID.String(),
+		ProposerId:     senderID.String(),
+		State:          tradeStates[tradeStateOpen],
+		SenderOffer:    senderOffer,
+		RecipientOffer: recipientOffer,
+		CreateTime:     now.Unix(),
+		UpdateTime:     now.Unix(),
+		ExpiryTime:     now.Add(time.Duration(expirySec) * time.Second).Unix(),
+	}
+	if err := hooks.Before(ctx, senderID, TradeActionPropose, trade); err != nil {
+		return nil, err
+	}
+
+	changes := &tradeStorageChanges{deleteReads: make(map[*StorageOpDelete]int32)}
+	err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		changes.deletes, changes.written = nil, nil
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND disable_time = '1970-01-01 00:00:00 UTC')", recipientID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return StatusError(codes.NotFound, "Trade recipient not found.", ErrAccountNotFound)
+		}
+
+		escrow, err := tradeTake(ctx, logger, storageCollections, tx, changes, trade, senderID, senderOffer, TradeActionPropose)
+		if err != nil {
+			return err
+		}
+		return tradeInsert(ctx, tx, trade, escrow)
+	})
+	if err != nil {
+		return nil, tradeError(logger, err, "Error proposing trade.")
+	}
+
+	tradeAfter(ctx, logger, db, storageIndex, tracker, router, hooks, changes, senderID, TradeActionPropose, trade)
+	return trade, nil
+}
+
+// TradeCounter replaces the offers of an open trade. Only the party not currently proposing can counter, their side
+// of the new offers is taken into escrow and the previous proposer's escrow is returned.
+func TradeCounter(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, hooks *tradeHooks, userID, tradeID uuid.UUID, senderOffer, recipientOffer *TradeOffer) (*Trade, error) {
+	if err := tradeOffersValid(config.GetTrade(), senderOffer, recipientOffer); err != nil {
+		return nil, err
+	}
+	if err := tradeBefore(ctx, db, hooks, userID, tradeID, TradeActionCounter, func(t *Trade) {
+		t.SenderOffer, t.RecipientOffer, t.ProposerId = senderOffer, recipientOffer, userID.String()
+	}); err != nil {
+		return nil, err
+	}
+
+	var trade *Trade
+	changes := &tradeStorageChanges{deleteReads: make(map[*StorageOpDelete]int32)}
+	err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		changes.deletes, changes.written = nil, nil
+		var escrow []*tradeEscrowItem
+		var err error
+		if trade, escrow, err = tradeLockOpen(ctx, tx, userID, tradeID, false); err != nil {
+			return err
+		}
+
+		proposerID := uuid.FromStringOrNil(trade.ProposerId)
+		if err = tradeGive(ctx, logger, metrics, storageCollections, tx, changes, trade, proposerID, trade.offer(trade.ProposerId).Wallet, escrow, true, TradeActionCounter); err != nil {
+			return err
+		}
+
+		trade.SenderOffer, trade.RecipientOffer, trade.ProposerId = senderOffer, recipientOffer, userID.String()
+		if escrow, err = tradeTake(ctx, logger, storageCollections, tx, changes, trade, userID, trade.offer(userID.String()), TradeActionCounter); err != nil {
+			return err
+		}
+		return tradeUpdate(ctx, tx, trade, tradeStateOpen, escrow)
+	})
+	if err != nil {
+		return nil, tradeError(logger, err, "Error countering trade.")
+	}
+
+	tradeAfter(ctx, logger, db, storageIndex, tracker, router, hooks, changes, userID, TradeActionCounter, trade)
+	return trade, nil
+}
+
+// TradeAccept completes an open trade. Only the party not currently proposing can accept, their side is taken and
+// both sides are given to the other party in the same transaction.
+func TradeAccept(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, hooks *tradeHooks, userID, tradeID uuid.UUID) (*Trade, error) {
+	if err := tradeBefore(ctx, db, hooks, userID, tradeID, TradeActionAccept, func(t *Trade) {
+		t.State = tradeStates[tradeStateAccepted]
+	}); err != nil {
+		return nil, err
+	}
+
+	var trade *Trade
+	changes := &tradeStorageChanges{deleteReads: make(map[*StorageOpDelete]int32)}
+	err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		changes.deletes, changes.written = nil, nil
+		var escrow []*tradeEscrowItem
+		var err error
+		if trade, escrow, err = tradeLockOpen(ctx, tx, userID, tradeID, false); err != nil {
+			return err
+		}
+
+		proposerID := uuid.FromStringOrNil(trade.ProposerId)
+		acceptorOffer := trade.offer(userID.String())
+		taken, err := tradeTake(ctx, logger, storageCollections, tx, changes, trade, userID, acceptorOffer, TradeActionAccept)
+		if err != nil {
+			return err
+		}
+		if err = tradeGive(ctx, logger, metrics, storageCollections, tx, changes, trade, userID, trade.offer(trade.ProposerId).Wallet, escrow, false, TradeActionAccept); err != nil {
+			return err
+		}
+		if err = tradeGive(ctx, logger, metrics, storageCollections, tx, changes, trade, proposerID, acceptorOffer.walletOrNil(), taken, false, TradeActionAccept); err != nil {
+			return err
+		}
+		return tradeUpdate(ctx, tx, trade, tradeStateAccepted, nil)
+	})
+	if err != nil {
+		return nil, tradeError(logger, err, "Error accepting trade.")
+	}
+
+	tradeAfter(ctx, logger, db, storageIndex, tracker, router, hooks, changes, userID, TradeActionAccept, trade)
+	return trade, nil
+}
+
+// TradeCancel closes an open trade, returning the proposer's escrow. Either party can cancel.
+func TradeCancel(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, hooks *tradeHooks, userID, tradeID uuid.UUID) (*Trade, error) {
+	if err := tradeBefore(ctx, db, hooks, userID, tradeID, TradeActionCancel, func(t *Trade) {
+		t.State = tradeStates[tradeStateCancelled]
+	}); err != nil {
+		return nil, err
+	}
+
+	trade, changes, err := tradeClose(ctx, logger, db, metrics, storageCollections, userID, tradeID, tradeStateCancelled)
+	if err != nil {
+		return nil, tradeError(logger, err, "Error cancelling trade.")
+	}
+
+	tradeAfter(ctx, logger, db, storageIndex, tracker, router, hooks, changes, userID, TradeActionCancel, trade)
+	return trade, nil
+}
+
+// TradeExpire closes up to limit open trades past their expiry time, returning the proposers' escrow. It returns the
+// number of trades expired.
+func TradeExpire(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter, hooks *tradeHooks, limit int) (int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM trade WHERE state = $1 AND expiry_time <= now() ORDER BY expiry_time LIMIT $2", tradeStateOpen, limit)
+	if err != nil {
+		logger.Error("Error listing expired trades.", zap.Error(err))
+		return 0, err
+	}
+	ids := make([]uuid.UUID, 0, limit)
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			logger.Error("Error listing expired trades.", zap.Error(err))
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	_ = rows.Close()
+
+	var expired int
+	for _, id := range ids {
+		trade, changes, err := tradeClose(ctx, logger, db, metrics, storageCollections, uuid.Nil, id, tradeStateExpired)
+		if err != nil {
+			// Retried on the next sweep. Trades closed or extended since they were listed are skipped.
+			if e, ok := err.(*statusError); !ok || e.Code() != codes.FailedPrecondition {
+				logger.Error("Error expiring trade.", zap.Error(err), zap.String("trade_id", id.String()))
+			}
+			continue
+		}
+		tradeAfter(ctx, logger, db, storageIndex, tracker, router, hooks, changes, uuid.Nil, TradeActionExpire, trade)
+		expired++
+	}
+
+	return expired, nil
+}
+
+// TradeGet returns a trade the user is a party to.
+func TradeGet(ctx context.Context, logger *zap.Logger, db *sql.DB, userID, tradeID uuid.UUID) (*Trade, error) {
+	trade, _, err := tradeRead(ctx, db, tradeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "Trade not found.")
+		}
+		logger.Error("Error reading trade.", zap.Error(err), zap.String("trade_id", tradeID.String()))
+		return nil, status.Error(codes.Internal, "Error reading trade.")
+	}
+	if trade.SenderId != userID.String() && trade.RecipientId != userID.String() {
+		return nil, status.Error(codes.NotFound, "Trade not found.")
+	}
+	return trade, nil
+}
+
+// TradeListUser returns the trades the user is a party to, most recently updated first, optionally only those in
+// the given state.
+func TradeListUser(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID, state string, limit int, cursor string) (*TradeList, error) {
+	if limit < 1 || limit > tradeListMax {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid limit - limit must be between 1 and %d.", tradeListMax)
+	}
+
+	params := []interface{}{userID, limit + 1}
+	query := "SELECT " + tradeColumns + " FROM trade WHERE (sender_id = $1 OR recipient_id = $1)"
+	if state != "" {
+		stateValue := -1
+		for value, name := range tradeStates {
+			if name == state {
+				stateValue = value
+			}
+		}
+		if stateValue < 0 {
+			return nil, status.Error(codes.InvalidArgument, "Invalid state - state must be one of 'open', 'accepted', 'cancelled' or 'expired'.")
+		}
+		params = append(params, stateValue)
+		query += " AND state = $3"
+	}
+	if cursor != "" {
+		c := &tradeListCursor{}
+		cb, err := base64.URLEncoding.DecodeString(cursor)
+		if err != nil || gob.NewDecoder(bytes.NewReader(cb)).Decode(c) != nil {
+			return nil, status.Error(codes.InvalidArgument, "Malformed cursor was used.")
+		}
+		params = append(params, time.Unix(0, c.UpdateTime).UTC(), c.ID)
+		query += " AND (update_time, id) < ($" + strconv.Itoa(len(params)-1) + ", $" + strconv.Itoa(len(params)) + ")"
+	}
+	query += " ORDER BY update_time DESC, id DESC LIMIT $2"
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		logger.Error("Error listing trades.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error listing trades.")
+	}
+	defer rows.Close()
+
+	list := &TradeList{Trades: make([]*Trade, 0, limit)}
+	var last *tradeListCursor
+	for rows.Next() {
+		trade, _, updateTime, err := tradeScan(rows)
+		if err != nil {
+			logger.Error("Error listing trades.", zap.Error(err), zap.String("user_id", userID.String()))
+			return nil, status.Error(codes.Internal, "Error listing trades.")
+		}
+		if len(list.Trades) == limit {
+			cursorBuf := &bytes.Buffer{}
+			if err = gob.NewEncoder(cursorBuf).Encode(last); err != nil {
+				logger.Error("Error creating trade list cursor.", zap.Error(err))
+				return nil, status.Error(codes.Internal, "Error listing trades.")
+			}
+			list.Cursor = base64.URLEncoding.EncodeToString(cursorBuf.Bytes())
+			break
+		}
+		list.Trades = append(list.Trades, trade)
+		last = &tradeListCursor{UpdateTime: updateTime.UnixNano(), ID: uuid.FromStringOrNil(trade.Id)}
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error listing trades.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, status.Error(codes.Internal, "Error listing trades.")
+	}
+
+	return list, nil
+}
+
+func (o *TradeOffer) walletOrNil() map[string]int64 {
+	if o == nil {
+		return nil
+	}
+	return o.Wallet
+}
+
+const tradeColumns = "id, sender_id, recipient_id, proposer_id, state, sender_offer, recipient_offer, escrow, create_time, update_time, expiry_time"
+
+func tradeScan(row Scannable) (*Trade, []*tradeEscrowItem, time.Time, error) {
+	var id, senderID, recipientID, proposerID uuid.UUID
+	var state int
+	var senderOffer, recipientOffer, escrowBytes []byte
+	var createTime, updateTime, expiryTime pgtype.Timestamptz
+	if err := row.Scan(&id, &senderID, &recipientID, &proposerID, &state, &senderOffer, &recipientOffer, &escrowBytes, &createTime, &updateTime, &expiryTime); err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	trade := &Trade{
+		Id:             id.String(),
+		SenderId:       senderID.String(),
+		RecipientId:    recipientID.String(),
+		ProposerId:     proposerID.String(),
+		State:          tradeStates[state],
+		SenderOffer:    &TradeOffer{},
+		RecipientOffer: &TradeOffer{},
+		CreateTime:     createTime.Time.Unix(),
+		UpdateTime:     updateTime.Time.Unix(),
+		ExpiryTime:     expiryTime.Time.Unix(),
+	}
+	escrow := make([]*tradeEscrowItem, 0)
+	for _, field := range []struct {
+		data []byte
+		out  interface{}
+	}{{senderOffer, trade.SenderOffer}, {recipientOffer, trade.RecipientOffer}, {escrowBytes, &escrow}} {
+		if err := json.Unmarshal(field.data, field.out); err != nil {
+			return nil, nil, time.Time{}, err
+		}
+	}
+	return trade, escrow, updateTime.Time, nil
+}
+
+func tradeRead(ctx context.Context, db *sql.DB, tradeID uuid.UUID) (*Trade, []*tradeEscrowItem, error) {
+	trade, escrow, _, err := tradeScan(db.QueryRowContext(ctx, "SELECT "+tradeColumns+" FROM trade WHERE id = $1", tradeID))
+	return trade, escrow, err
+}
+
+// Lock an open trade the user is a party to. Unless either party may act, the user must not be the proposer.
+func tradeLockOpen(ctx context.Context, tx pgx.Tx, userID, tradeID uuid.UUID, eitherParty bool) (*Trade, []*tradeEscrowItem, error) {
+	trade, escrow, _, err := tradeScan(tx.QueryRow(ctx, "SELECT "+tradeColumns+" FROM trade WHERE id = $1 FOR UPDATE", tradeID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil, StatusError(codes.NotFound, "Trade not found.", err)
+		}
+		return nil, nil, err
+	}
+	if userID != uuid.Nil {
+		if trade.SenderId != userID.String() && trade.RecipientId != userID.String() {
+			return nil, nil, StatusError(codes.NotFound, "Trade not found.", errors.New("not a party to the trade"))
+		}
+		if !eitherParty && trade.ProposerId == userID.String() {
+			return nil, nil, StatusError(codes.FailedPrecondition, "Waiting for the other party to respond to the trade.", errors.New("proposer cannot respond"))
+		}
+	}
+	if trade.State != tradeStates[tradeStateOpen] {
+		return nil, nil, StatusError(codes.FailedPrecondition, "Trade is no longer open.", errors.New("trade not open"))
+	}
+	// The expiry sweep closes trades after a delay, they can't be acted on in the meantime.
+	if userID != uuid.Nil && trade.ExpiryTime <= time.Now().Unix() {
+		return nil, nil, StatusError(codes.FailedPrecondition, "Trade has expired.", errors.New("trade expired"))
+	}
+	return trade, escrow, nil
+}
+
+// Run the before hook for an action on the trade as currently stored, after applying the change the action makes.
+func tradeBefore(ctx context.Context, db *sql.DB, hooks *tradeHooks, userID, tradeID uuid.UUID, action string, change func(t *Trade)) error {
+	if hooks == nil || hooks.before == nil {
+		return nil
+	}
+	trade, _, err := tradeRead(ctx, db, tradeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return status.Error(codes.NotFound, "Trade not found.")
+		}
+		return status.Error(codes.Internal, "Error reading trade.")
+	}
+	if trade.SenderId != userID.String() && trade.RecipientId != userID.String() {
+		return status.Error(codes.NotFound, "Trade not found.")
+	}
+	change(trade)
+	return hooks.Before(ctx, userID, action, trade)
+}
+
+// Close an open trade, returning the proposer's escrow. A nil user is the server expiring the trade.
+func tradeClose(ctx context.Context, logger *zap.Logger, db *sql.DB, metrics Metrics, storageCollections StorageCollectionRegistry, userID, tradeID uuid.UUID, state int) (*Trade, *tradeStorageChanges, error) {
+	var trade *Trade
+	changes := &tradeStorageChanges{deleteReads: make(map[*StorageOpDelete]int32)}
+	err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		changes.deletes, changes.written = nil, nil
+		var escrow []*tradeEscrowItem
+		var err error
+		if trade, escrow, err = tradeLockOpen(ctx, tx, userID, tradeID, true); err != nil {
+			return err
+		}
+		if state == tradeStateExpired && trade.ExpiryTime > time.Now().Unix() {
+			return StatusError(codes.FailedPrecondition, "Trade has not expired.", errors.New("trade not expired"))
+		}
+		action := TradeActionCancel
+		if state == tradeStateExpired {
+			action = TradeActionExpire
+		}
+		if err = tradeGive(ctx, logger, metrics, storageCollections, tx, changes, trade, uuid.FromStringOrNil(trade.ProposerId), trade.offer(trade.ProposerId).walletOrNil(), escrow, true, action); err != nil {
+			return err
+		}
+		return tradeUpdate(ctx, tx, trade, state, nil)
+	})
+	return trade, changes, err
+}
+
+// Cancel every open trade the user is a party to, as part of deleting or merging the account in the same transaction.
+// The other party's escrow is returned to them. The user's own escrow is only returned if the account is kept, a
+// deleted account's escrow goes with the rest of its data. Returns the trades cancelled.
+func tradeCancelUser(ctx context.Context, logger *zap.Logger, tx pgx.Tx, metrics Metrics, storageCollections StorageCollectionRegistry, changes *tradeStorageChanges, userID uuid.UUID, deleted bool) ([]*Trade, error) {
+	rows, err := tx.Query(ctx, "SELECT id FROM trade WHERE state = $1 AND (sender_id = $2 OR recipient_id = $2) ORDER BY id", tradeStateOpen, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, 1)
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	trades := make([]*Trade, 0, len(ids))
+	for _, id := range ids {
+		trade, escrow, err := tradeLockOpen(ctx, tx, uuid.Nil, id, true)
+		if err != nil {
+			return nil, err
+		}
+		if proposerID := uuid.FromStringOrNil(trade.ProposerId); !deleted || proposerID != userID {
+			if err = tradeGive(ctx, logger, metrics, storageCollections, tx, changes, trade, proposerID, trade.offer(trade.ProposerId).walletOrNil(), escrow, true, TradeActionCancel); err != nil {
+				return nil, err
+			}
+		}
+		if err = tradeUpdate(ctx, tx, trade, tradeStateCancelled, nil); err != nil {
+			return nil, err
+		}
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// Take the offered currencies and storage objects from a party, returning the objects taken.
+func tradeTake(ctx context.Context, logger *zap.Logger, storageCollections StorageCollectionRegistry, tx pgx.Tx, changes *tradeStorageChanges, trade *Trade, userID uuid.UUID, offer *TradeOffer, action string) ([]*tradeEscrowItem, error) {
+	if offer == nil {
+		return []*tradeEscrowItem{}, nil
+	}
+	if len(offer.Wallet) > 0 {
+		changeset := make(map[string]int64, len(offer.Wallet))
+		for currency, amount := range offer.Wallet {
+			changeset[currency] = -amount
+		}
+		if err := tradeWalletUpdate(ctx, logger, tx, trade, userID, changeset, action); err != nil {
+			return nil, err
+		}
+	}
+
+	taken := make([]*tradeEscrowItem, 0, len(offer.Items))
+	for _, item := range offer.Items {
+		if history := storageCollections.CollectionHistory(item.Collection); history != nil {
+			if err := storageHistoryKeep(ctx, tx, history, item.Collection, item.Key, userID.String()); err != nil {
+				return nil, err
+			}
+		}
+		query := "DELETE FROM storage WHERE collection = $1 AND key = $2 AND user_id = $3 AND " + storageNotExpired + " RETURNING value, read, write"
+		escrowItem := &tradeEscrowItem{Collection: item.Collection, Key: item.Key}
+		if err := tx.QueryRow(ctx, query, item.Collection, item.Key, userID).Scan(&escrowItem.Value, &escrowItem.PermissionRead, &escrowItem.PermissionWrite); err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, StatusError(codes.FailedPrecondition, "Trade item not found: "+item.Collection+"/"+item.Key+".", err)
+			}
+			return nil, err
+		}
+		taken = append(taken, escrowItem)
+
+		op := &StorageOpDelete{OwnerID: userID.String(), ObjectID: &api.DeleteStorageObjectId{Collection: item.Collection, Key: item.Key}}
+		changes.deletes = append(changes.deletes, op)
+		changes.deleteReads[op] = escrowItem.PermissionRead
+	}
+	return taken, nil
+}
+
+// Give currencies and storage objects to a party. Objects are only given if the party does not already have one
+// with the same collection and key. Returning escrow to its owner can't be refused, so an object the owner wrote under
+// the same key while the trade was open is kept, and the escrowed object is returned under a fresh key instead.
+func tradeGive(ctx context.Context, logger *zap.Logger, metrics Metrics, storageCollections StorageCollectionRegistry, tx pgx.Tx, changes *tradeStorageChanges, trade *Trade, userID uuid.UUID, wallet map[string]int64, items []*tradeEscrowItem, returned bool, action string) error {
+	if len(wallet) > 0 {
+		if err := tradeWalletUpdate(ctx, logger, tx, trade, userID, wallet, action); err != nil {
+			return err
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	ops := make(StorageOpWrites, 0, len(items))
+	for _, item := range items {
+		key := item.Key
+		if returned {
+			var exists bool
+			query := "SELECT EXISTS (SELECT 1 FROM storage WHERE collection = $1 AND key = $2 AND user_id = $3 AND " + storageNotExpired + ")"
+			if err := tx.QueryRow(ctx, query, item.Collection, item.Key, userID).Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				key = tradeReturnedKey(item.Key, trade.Id)
+			}
+		}
+		ops = append(ops, &StorageOpWrite{
+			OwnerID: userID.String(),
+			Object: &api.WriteStorageObject{
+				Collection:      item.Collection,
+				Key:             key,
+				Value:           item.Value,
+				Version:         "*",
+				PermissionRead:  &wrapperspb.Int32Value{Value: item.PermissionRead},
+				PermissionWrite: &wrapperspb.Int32Value{Value: item.PermissionWrite},
+			},
+		})
+	}
+	_, written, err := storageWriteObjects(ctx, logger, metrics, storageCollections, tx, true, ops)
+	if err != nil {
+		if err == runtime.ErrStorageRejectedVersion {
+			return StatusError(codes.FailedPrecondition, "Trade items cannot be given to a player who already has an object with the same key.", err)
+		}
+		return err
+	}
+	changes.written = append(changes.written, written...)
+	return nil
+}
+
+// The key escrow is returned under when its owner wrote another object under the original key while the trade was open.
+func tradeReturnedKey(key, tradeID string) string {
+	return key + "." + tradeID
+}
+
+func tradeWalletUpdate(ctx context.Context, logger *zap.Logger, tx pgx.Tx, trade *Trade, userID uuid.UUID, changeset map[string]int64, action string) error {
+	metadata, _ := json.Marshal(map[string]string{"trade_id": trade.Id, "trade_action": action})
+	if _, err := updateWallets(ctx, logger, tx, []*walletUpdate{{UserID: userID, Changeset: changeset, Metadata: string(metadata)}}, true); err != nil {
+		var negativeErr *runtime.WalletNegativeError
+		if errors.As(err, &negativeErr) {
+			return StatusError(codes.FailedPrecondition, "Insufficient wallet funds for trade.", err)
+		}
+		return err
+	}
+	return nil
+}
+
+func tradeInsert(ctx context.Context, tx pgx.Tx, trade *Trade, escrow []*tradeEscrowItem) error {
+	senderOffer, recipientOffer, escrowBytes, err := tradeEncode(trade, escrow)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO trade (id, sender_id, recipient_id, proposer_id, state, sender_offer, recipient_offer, escrow, create_time, update_time, expiry_time) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10)"
+	_, err = tx.Exec(ctx, query, trade.Id, trade.SenderId, trade.RecipientId, trade.ProposerId, tradeStateOpen, senderOffer, recipientOffer, escrowBytes, time.Unix(trade.CreateTime, 0).UTC(), time.Unix(trade.ExpiryTime, 0).UTC())
+	return err
+}
+
+func tradeUpdate(ctx context.Context, tx pgx.Tx, trade *Trade, state int, escrow []*tradeEscrowItem) error {
+	senderOffer, recipientOffer, escrowBytes, err := tradeEncode(trade, escrow)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	query := "UPDATE trade SET proposer_id = $2, state = $3, sender_offer = $4, recipient_offer = $5, escrow = $6, update_time = $7 WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, trade.Id, trade.ProposerId, state, senderOffer, recipientOffer, escrowBytes, now); err != nil {
+		return err
+	}
+	trade.State = tradeStates[state]
+	trade.UpdateTime = now.Unix()
+	return nil
+}
+
+func tradeEncode(trade *Trade, escrow []*tradeEscrowItem) ([]byte, []byte, []byte, error) {
+	if escrow == nil {
+		escrow = []*tradeEscrowItem{}
+	}
+	senderOffer, err := json.Marshal(trade.SenderOffer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	recipientOffer, err := json.Marshal(trade.RecipientOffer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	escrowBytes, err := json.Marshal(escrow)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return senderOffer, recipientOffer, escrowBytes, nil
+}
+
+func tradeError(logger *zap.Logger, err error, message string) error {
+	if e, ok := err.(*statusError); ok {
+		return e.Status()
+	}
+	var validationErr *StorageValidationError
+	if errors.As(err, &validationErr) {
+		return status.Error(codes.FailedPrecondition, validationErr.Error())
+	}
+	logger.Error(message, zap.Error(err))
+	return status.Error(codes.Internal, message)
+}
+
+// Publish committed storage changes, notify the other party, and run the after hook.
+func tradeAfter(ctx context.Context, logger *zap.Logger, db *sql.DB, storageIndex StorageIndex, tracker Tracker, router MessageRouter, hooks *tradeHooks, changes *tradeStorageChanges, userID uuid.UUID, action string, trade *Trade) {
+	changes.publish(ctx, logger, storageIndex, tracker, router)
+	tradeNotify(ctx, logger, db, tracker, router, userID, action, trade)
+	hooks.After(ctx, logger, userID, action, trade)
+}
+
+// Notify the parties to a trade, other than the user acting on it, of a change.
+func tradeNotify(ctx context.Context, logger *zap.Logger, db *sql.DB, tracker Tracker, router MessageRouter, userID uuid.UUID, action string, trade *Trade) {
+	content, _ := json.Marshal(map[string]interface{}{"trade_id": trade.Id, "action": action, "state": trade.State})
+	notifications := make(map[uuid.UUID][]*api.Notification, 2)
+	for _, party := range []string{trade.SenderId, trade.RecipientId} {
+		if party == userID.String() {
+			// The user acting on the trade already knows.
+			continue
+		}
+		notifications[uuid.FromStringOrNil(party)] = []*api.Notification{{
+			Id:         uuid.Must(uuid.NewV4()).String(),
+			Subject:    tradeNotificationSubjects[action],
+			Content:    string(content),
+			Code:       tradeNotificationCodes[action],
+			SenderId:   userID.String(),
+			Persistent: true,
+			CreateTime: &timestamppb.Timestamp{Seconds: trade.UpdateTime},
+		}}
+	}
+	// Any error is already logged before it's returned here.
+	_ = NotificationSend(ctx, logger, db, tracker, router, notifications)
+}
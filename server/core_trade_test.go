@@ -0,0 +1,182 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTradeOffersValid(t *testing.T) {
+	config := NewTradeConfig()
+	config.ItemCollections = []string{"inventory"}
+	config.MaxItems = 2
+
+	valid := []struct {
+		sender    *TradeOffer
+		recipient *TradeOffer
+	}{
+		{&TradeOffer{Wallet: map[string]int64{"gold": 10}}, nil},
+		{nil, &TradeOffer{Items: []*TradeItem{{Collection: "inventory", Key: "sword"}}}},
+		{&TradeOffer{Items: []*TradeItem{{Collection: "inventory", Key: "sword"}, {Collection: "inventory", Key: "shield"}}}, &TradeOffer{Wallet: map[string]int64{"gems": 1}}},
+	}
+	for i, tc := range valid {
+		assert.NoError(t, tradeOffersValid(config, tc.sender, tc.recipient), i)
+	}
+
+	invalid := []struct {
+		sender    *TradeOffer
+		recipient *TradeOffer
+	}{
+		{nil, nil},
+		{&TradeOffer{}, &TradeOffer{Wallet: map[string]int64{}}},
+		{&TradeOffer{Wallet: map[string]int64{"gold": 0}}, nil},
+		{&TradeOffer{Wallet: map[string]int64{"gold": -5}}, nil},
+		{&TradeOffer{Wallet: map[string]int64{"": 5}}, nil},
+		{&TradeOffer{Items: []*TradeItem{{Collection: "profile", Key: "avatar"}}}, nil},
+		{&TradeOffer{Items: []*TradeItem{{Collection: "inventory", Key: ""}}}, nil},
+		{nil, &TradeOffer{Items: []*TradeItem{{Collection: "inventory", Key: "sword"}, {Collection: "inventory", Key: "sword"}}}},
+		{&TradeOffer{Items: []*TradeItem{{Collection: "inventory", Key: "a"}, {Collection: "inventory", Key: "b"}, {Collection: "inventory", Key: "c"}}}, nil},
+	}
+	for i, tc := range invalid {
+		err := tradeOffersValid(config, tc.sender, tc.recipient)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), i)
+	}
+}
+
+func TestTradeOffer(t *testing.T) {
+	trade := &Trade{
+		SenderId:       "a",
+		RecipientId:    "b",
+		SenderOffer:    &TradeOffer{Wallet: map[string]int64{"gold": 1}},
+		RecipientOffer: &TradeOffer{Wallet: map[string]int64{"gems": 1}},
+	}
+	assert.Equal(t, trade.SenderOffer, trade.offer("a"))
+	assert.Equal(t, trade.RecipientOffer, trade.offer("b"))
+}
+
+func TestTradeEscrowReturnedUnderFreshKey(t *testing.T) {
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	config.Trade.ItemCollections = []string{"inventory"}
+	tracker := &LocalTracker{}
+	router := &DummyMessageRouter{}
+
+	writeSword := func(userID uuid.UUID, value string) {
+		ops := StorageOpWrites{{OwnerID: userID.String(), Object: &api.WriteStorageObject{Collection: "inventory", Key: "sword", Value: value}}}
+		_, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
+		require.NoError(t, err)
+	}
+	readSword := func(userID uuid.UUID, key string) string {
+		objects, err := StorageReadObjects(context.Background(), logger, db, uuid.Nil, []*api.ReadStorageObjectId{{Collection: "inventory", Key: key, UserId: userID.String()}})
+		require.NoError(t, err)
+		require.Len(t, objects.Objects, 1)
+		return objects.Objects[0].Value
+	}
+	propose := func(senderID, recipientID uuid.UUID) *Trade {
+		writeSword(senderID, `{"damage":10}`)
+		offer := &TradeOffer{Items: []*TradeItem{{Collection: "inventory", Key: "sword"}}}
+		trade, err := TradePropose(context.Background(), logger, db, config, storageIdx, storageCollections, tracker, router, nil, senderID, recipientID, offer, nil, 0)
+		require.NoError(t, err)
+		// Written while the sword is in escrow.
+		writeSword(senderID, `{"damage":1}`)
+		return trade
+	}
+
+	senderID, recipientID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, senderID)
+	InsertUser(t, db, recipientID)
+
+	t.Run("cancel", func(t *testing.T) {
+		trade := propose(senderID, recipientID)
+		trade, err := TradeCancel(context.Background(), logger, db, metrics, storageIdx, storageCollections, tracker, router, nil, recipientID, uuid.FromStringOrNil(trade.Id))
+		require.NoError(t, err)
+		assert.Equal(t, "cancelled", trade.State)
+		// The owner's own write is kept and the escrow returned next to it.
+		assert.Equal(t, `{"damage": 1}`, readSword(senderID, "sword"))
+		assert.Equal(t, `{"damage": 10}`, readSword(senderID, "sword."+trade.Id))
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		trade := propose(senderID, recipientID)
+		_, err := db.Exec("UPDATE trade SET expiry_time = now() - INTERVAL '1 minute' WHERE id = $1", trade.Id)
+		require.NoError(t, err)
+
+		_, err = TradeExpire(context.Background(), logger, db, metrics, storageIdx, storageCollections, tracker, router, nil, 100)
+		require.NoError(t, err)
+		trade, err = TradeGet(context.Background(), logger, db, senderID, uuid.FromStringOrNil(trade.Id))
+		require.NoError(t, err)
+		assert.Equal(t, "expired", trade.State)
+		assert.Equal(t, `{"damage": 1}`, readSword(senderID, "sword"))
+		assert.Equal(t, `{"damage": 10}`, readSword(senderID, "sword."+trade.Id))
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		// The other party is still refused items they already have.
+		trade := propose(senderID, recipientID)
+		writeSword(recipientID, `{"damage":5}`)
+		_, err := TradeAccept(context.Background(), logger, db, metrics, storageIdx, storageCollections, tracker, router, nil, recipientID, uuid.FromStringOrNil(trade.Id))
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
+
+func TestTradeCancelledOnAccountDelete(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	config := NewConfig(logger)
+	config.Trade.ItemCollections = []string{"inventory"}
+	tracker := &LocalTracker{}
+	router := &DummyMessageRouter{}
+	sessionCache := NewLocalSessionCache(config.GetSession().TokenExpirySec, config.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	lbRankCache := NewLocalLeaderboardRankCache(ctx, logger, db, config.Leaderboard, lbCache)
+
+	senderID, recipientID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, senderID)
+	InsertUser(t, db, recipientID)
+	ops := StorageOpWrites{{OwnerID: senderID.String(), Object: &api.WriteStorageObject{Collection: "inventory", Key: "sword", Value: `{"damage":10}`}}}
+	_, _, err := StorageWriteObjects(ctx, logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
+	require.NoError(t, err)
+
+	offer := &TradeOffer{Items: []*TradeItem{{Collection: "inventory", Key: "sword"}}}
+	trade, err := TradePropose(ctx, logger, db, config, storageIdx, storageCollections, tracker, router, nil, senderID, recipientID, offer, nil, 0)
+	require.NoError(t, err)
+
+	// Deleting the other party cancels the trade and returns the escrow to the proposer.
+	err = DeleteAccount(ctx, logger, db, config, metrics, lbCache, lbRankCache, storageIdx, storageCollections, groupIdx, NewLocalSessionRegistry(metrics), sessionCache, tracker, router, recipientID, false)
+	require.NoError(t, err)
+
+	trade, err = TradeGet(ctx, logger, db, senderID, uuid.FromStringOrNil(trade.Id))
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", trade.State)
+	assert.Equal(t, recipientID.String(), trade.RecipientId)
+
+	objects, err := StorageReadObjects(ctx, logger, db, uuid.Nil, []*api.ReadStorageObjectId{{Collection: "inventory", Key: "sword", UserId: senderID.String()}})
+	require.NoError(t, err)
+	require.Len(t, objects.Objects, 1)
+	assert.Equal(t, `{"damage": 10}`, objects.Objects[0].Value)
+}
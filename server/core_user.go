@@ -22,6 +22,7 @@ import (
 	"github.com/gofrs/uuid/v5"
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -153,13 +154,13 @@ LIMIT $2`
 	return users, nil
 }
 
-func DeleteUser(ctx context.Context, tx *sql.Tx, userID uuid.UUID) (int64, error) {
-	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+func DeleteUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (int64, error) {
+	res, err := tx.Exec(ctx, "DELETE FROM users WHERE id = $1", userID)
 	if err != nil {
 		return 0, err
 	}
 
-	return res.RowsAffected()
+	return res.RowsAffected(), nil
 }
 
 func BanUsers(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, sessionCache SessionCache, sessionRegistry SessionRegistry, tracker Tracker, ids []uuid.UUID) error {
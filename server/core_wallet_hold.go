@@ -0,0 +1,349 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	walletHoldStateHeld = iota
+	walletHoldStateCaptured
+	walletHoldStateReleased
+	walletHoldStateExpired
+)
+
+var walletHoldStates = map[int]string{
+	walletHoldStateHeld:     "held",
+	walletHoldStateCaptured: "captured",
+	walletHoldStateReleased: "released",
+	walletHoldStateExpired:  "expired",
+}
+
+// Wallet hold actions recorded in wallet ledger metadata, along with the hold ID.
+const (
+	WalletHoldActionHold    = "hold"
+	WalletHoldActionCapture = "capture"
+	WalletHoldActionRelease = "release"
+	WalletHoldActionExpire  = "expire"
+)
+
+var (
+	ErrWalletHoldNotFound    = errors.New("wallet hold not found")
+	ErrWalletHoldNotHeld     = errors.New("wallet hold is already captured, released or expired")
+	ErrWalletHoldChangeset   = errors.New("wallet hold amounts must have non-empty currencies and be greater than 0")
+	ErrWalletHoldOverCapture = errors.New("wallet hold capture amounts must not exceed the held amounts")
+)
+
+// WalletHold is an amount of currency taken from a user's wallet until it is captured, keeping all or part of it, or
+// released back to the wallet. Holds not captured or released by their expiry time are released automatically.
+type WalletHold struct {
+	Id         string
+	UserId     string
+	State      string
+	Changeset  map[string]int64
+	Captured   map[string]int64
+	Metadata   map[string]interface{}
+	CreateTime int64
+	UpdateTime int64
+	ExpiryTime int64
+}
+
+// WalletHoldCreate takes the changeset amounts from the user's wallet and holds them. It returns a
+// *runtime.WalletNegativeError if the wallet does not have enough funds.
+func WalletHoldCreate(ctx context.Context, logger *zap.Logger, db *sql.DB, config Config, userID uuid.UUID, changeset map[string]int64, metadata map[string]interface{}, expirySec int) (*WalletHold, error) {
+	if !walletHoldChangesetValid(changeset) {
+		return nil, ErrWalletHoldChangeset
+	}
+	if expirySec == 0 {
+		expirySec = config.GetWallet().HoldDefaultExpirySec
+	}
+	if expirySec < 1 || expirySec > config.GetWallet().HoldMaxExpirySec {
+		return nil, fmt.Errorf("wallet hold expiry must be between 1 and %d seconds", config.GetWallet().HoldMaxExpirySec)
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+
+	now := time.Now().UTC()
+	hold := &WalletHold{
+		Id:         uuid.Must(uuid.NewV4()).String(),
+		UserId:     userID.String(),
+		State:      walletHoldStates[walletHoldStateHeld],
+		Changeset:  changeset,
+		Captured:   make(map[string]int64),
+		Metadata:   metadata,
+		CreateTime: now.Unix(),
+		UpdateTime: now.Unix(),
+		ExpiryTime: now.Add(time.Duration(expirySec) * time.Second).Unix(),
+	}
+	changesetBytes, err := json.Marshal(changeset)
+	if err != nil {
+		return nil, err
+	}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert metadata: %s", err.Error())
+	}
+
+	debit := make(map[string]int64, len(changeset))
+	for currency, amount := range changeset {
+		debit[currency] = -amount
+	}
+	err = ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		results, err := walletHoldUpdate(ctx, logger, tx, hold, debit, WalletHoldActionHold, metadata)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return ErrAccountNotFound
+		}
+		query := "INSERT INTO wallet_hold (id, user_id, state, changeset, metadata, create_time, update_time, expiry_time) VALUES ($1, $2, $3, $4, $5, $6, $6, $7)"
+		_, err = tx.Exec(ctx, query, hold.Id, userID, walletHoldStateHeld, changesetBytes, metadataBytes, now, time.Unix(hold.ExpiryTime, 0).UTC())
+		return err
+	})
+	if err != nil {
+		return nil, walletHoldError(logger, err, "Error creating wallet hold.")
+	}
+
+	return hold, nil
+}
+
+// WalletHoldCapture completes a hold, keeping the given amounts and returning the rest of the hold to the wallet. A
+// nil changeset keeps the whole hold.
+func WalletHoldCapture(ctx context.Context, logger *zap.Logger, db *sql.DB, holdID uuid.UUID, changeset map[string]int64, metadata map[string]interface{}) (*WalletHold, error) {
+	if changeset != nil {
+		for currency, amount := range changeset {
+			if currency == "" || amount < 0 {
+				return nil, ErrWalletHoldChangeset
+			}
+		}
+	}
+	return walletHoldClose(ctx, logger, db, holdID, walletHoldStateCaptured, changeset, metadata)
+}
+
+// WalletHoldRelease cancels a hold, returning all of it to the wallet.
+func WalletHoldRelease(ctx context.Context, logger *zap.Logger, db *sql.DB, holdID uuid.UUID, metadata map[string]interface{}) (*WalletHold, error) {
+	return walletHoldClose(ctx, logger, db, holdID, walletHoldStateReleased, map[string]int64{}, metadata)
+}
+
+// WalletHoldExpire releases up to limit holds past their expiry time. It returns the number of holds expired.
+func WalletHoldExpire(ctx context.Context, logger *zap.Logger, db *sql.DB, limit int) (int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM wallet_hold WHERE state = $1 AND expiry_time <= now() ORDER BY expiry_time LIMIT $2", walletHoldStateHeld, limit)
+	if err != nil {
+		logger.Error("Error listing expired wallet holds.", zap.Error(err))
+		return 0, err
+	}
+	ids := make([]uuid.UUID, 0, limit)
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			logger.Error("Error listing expired wallet holds.", zap.Error(err))
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	_ = rows.Close()
+
+	var expired int
+	for _, id := range ids {
+		if _, err = walletHoldClose(ctx, logger, db, id, walletHoldStateExpired, map[string]int64{}, nil); err != nil {
+			// Logged if unexpected, and retried on the next sweep.
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// WalletHoldsList returns the user's holds that are still held, oldest first.
+func WalletHoldsList(ctx context.Context, logger *zap.Logger, db *sql.DB, userID uuid.UUID) ([]*WalletHold, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+walletHoldColumns+" FROM wallet_hold WHERE user_id = $1 AND state = $2 ORDER BY create_time", userID, walletHoldStateHeld)
+	if err != nil {
+		logger.Error("Error listing wallet holds.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := make([]*WalletHold, 0)
+	for rows.Next() {
+		hold, err := walletHoldScan(rows)
+		if err != nil {
+			logger.Error("Error reading wallet holds.", zap.Error(err), zap.String("user_id", userID.String()))
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error reading wallet holds.", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+	return holds, nil
+}
+
+// Close a hold, keeping the kept amounts and returning the rest of the hold to the wallet. A nil kept changeset keeps
+// the whole hold.
+func walletHoldClose(ctx context.Context, logger *zap.Logger, db *sql.DB, holdID uuid.UUID, state int, kept map[string]int64, metadata map[string]interface{}) (*WalletHold, error) {
+	action := map[int]string{
+		walletHoldStateCaptured: WalletHoldActionCapture,
+		walletHoldStateReleased: WalletHoldActionRelease,
+		walletHoldStateExpired:  WalletHoldActionExpire,
+	}[state]
+
+	var hold *WalletHold
+	err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		if hold, err = walletHoldScan(tx.QueryRow(ctx, "SELECT "+walletHoldColumns+" FROM wallet_hold WHERE id = $1 FOR UPDATE", holdID)); err != nil {
+			if err == pgx.ErrNoRows {
+				return ErrWalletHoldNotFound
+			}
+			return err
+		}
+		if hold.State != walletHoldStates[walletHoldStateHeld] {
+			return ErrWalletHoldNotHeld
+		}
+		// The sweep may find a hold just before it is captured or released.
+		if state == walletHoldStateExpired && hold.ExpiryTime > time.Now().Unix() {
+			return ErrWalletHoldNotHeld
+		}
+
+		captured := kept
+		if captured == nil {
+			captured = hold.Changeset
+		}
+		refund := make(map[string]int64, len(hold.Changeset))
+		for currency, amount := range hold.Changeset {
+			if captured[currency] < amount {
+				refund[currency] = amount - captured[currency]
+			}
+		}
+		for currency, amount := range captured {
+			if amount > hold.Changeset[currency] {
+				return ErrWalletHoldOverCapture
+			}
+		}
+
+		hold.Captured = captured
+		// Closing metadata is only recorded in the ledger, the hold keeps the metadata it was created with.
+		if _, err = walletHoldUpdate(ctx, logger, tx, hold, refund, action, walletHoldMergeMetadata(hold.Metadata, metadata)); err != nil {
+			return err
+		}
+
+		capturedBytes, err := json.Marshal(captured)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if _, err = tx.Exec(ctx, "UPDATE wallet_hold SET state = $2, captured = $3, update_time = $4 WHERE id = $1", holdID, state, capturedBytes, now); err != nil {
+			return err
+		}
+		hold.State = walletHoldStates[state]
+		hold.UpdateTime = now.Unix()
+		return nil
+	})
+	if err != nil {
+		return nil, walletHoldError(logger, err, "Error closing wallet hold.")
+	}
+
+	return hold, nil
+}
+
+// Apply a changeset to the hold owner's wallet, with a ledger entry linked to the hold. Entries that do not change the
+// wallet, such as captures of whole holds, are still recorded so every hold has a ledger entry for its outcome.
+func walletHoldUpdate(ctx context.Context, logger *zap.Logger, tx pgx.Tx, hold *WalletHold, changeset map[string]int64, action string, metadata map[string]interface{}) ([]*runtime.WalletUpdateResult, error) {
+	ledgerMetadata := walletHoldMergeMetadata(metadata, map[string]interface{}{"hold_id": hold.Id, "hold_action": action})
+	if action == WalletHoldActionCapture {
+		ledgerMetadata["hold_captured"] = hold.Captured
+	}
+	metadataBytes, err := json.Marshal(ledgerMetadata)
+	if err != nil {
+		return nil, err
+	}
+	return updateWallets(ctx, logger, tx, []*walletUpdate{{UserID: uuid.FromStringOrNil(hold.UserId), Changeset: changeset, Metadata: string(metadataBytes)}}, true)
+}
+
+func walletHoldMergeMetadata(metadata, extra map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(metadata)+len(extra))
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+func walletHoldChangesetValid(changeset map[string]int64) bool {
+	if len(changeset) == 0 {
+		return false
+	}
+	for currency, amount := range changeset {
+		if currency == "" || amount < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Expected errors are returned as they are, others are logged first.
+func walletHoldError(logger *zap.Logger, err error, message string) error {
+	var negativeErr *runtime.WalletNegativeError
+	if errors.As(err, &negativeErr) || errors.Is(err, ErrWalletHoldNotFound) || errors.Is(err, ErrWalletHoldNotHeld) || errors.Is(err, ErrWalletHoldOverCapture) || errors.Is(err, ErrAccountNotFound) {
+		return err
+	}
+	logger.Error(message, zap.Error(err))
+	return err
+}
+
+const walletHoldColumns = "id, user_id, state, changeset, captured, metadata, create_time, update_time, expiry_time"
+
+func walletHoldScan(row Scannable) (*WalletHold, error) {
+	var id, userID uuid.UUID
+	var state int
+	var changeset, captured, metadata []byte
+	var createTime, updateTime, expiryTime pgtype.Timestamptz
+	if err := row.Scan(&id, &userID, &state, &changeset, &captured, &metadata, &createTime, &updateTime, &expiryTime); err != nil {
+		return nil, err
+	}
+	hold := &WalletHold{
+		Id:         id.String(),
+		UserId:     userID.String(),
+		State:      walletHoldStates[state],
+		CreateTime: createTime.Time.Unix(),
+		UpdateTime: updateTime.Time.Unix(),
+		ExpiryTime: expiryTime.Time.Unix(),
+	}
+	for _, field := range []struct {
+		data []byte
+		out  interface{}
+	}{{changeset, &hold.Changeset}, {captured, &hold.Captured}, {metadata, &hold.Metadata}} {
+		if err := json.Unmarshal(field.data, field.out); err != nil {
+			return nil, err
+		}
+	}
+	return hold, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestWalletHoldChangesetValid(t *testing.T) {
+	assert.True(t, walletHoldChangesetValid(map[string]int64{"coins": 10, "gems": 1}))
+
+	assert.False(t, walletHoldChangesetValid(nil))
+	assert.False(t, walletHoldChangesetValid(map[string]int64{}))
+	assert.False(t, walletHoldChangesetValid(map[string]int64{"coins": 0}))
+	assert.False(t, walletHoldChangesetValid(map[string]int64{"coins": -10}))
+	assert.False(t, walletHoldChangesetValid(map[string]int64{"": 10}))
+}
+
+func TestWalletHoldCreateInvalid(t *testing.T) {
+	config := NewConfig(zap.NewNop())
+	userID := uuid.Must(uuid.NewV4())
+
+	// Rejected before the database is used.
+	_, err := WalletHoldCreate(context.Background(), zap.NewNop(), nil, config, userID, map[string]int64{"coins": -1}, nil, 0)
+	assert.ErrorIs(t, err, ErrWalletHoldChangeset)
+	_, err = WalletHoldCreate(context.Background(), zap.NewNop(), nil, config, userID, map[string]int64{"coins": 1}, nil, config.GetWallet().HoldMaxExpirySec+1)
+	assert.Error(t, err)
+	_, err = WalletHoldCapture(context.Background(), zap.NewNop(), nil, userID, map[string]int64{"coins": -1}, nil)
+	assert.ErrorIs(t, err, ErrWalletHoldChangeset)
+}
+
+func TestWalletHoldMergeMetadata(t *testing.T) {
+	metadata := map[string]interface{}{"match_id": "m1", "hold_id": "spoofed"}
+	merged := walletHoldMergeMetadata(metadata, map[string]interface{}{"hold_id": "h1", "hold_action": WalletHoldActionHold})
+
+	assert.Equal(t, map[string]interface{}{"match_id": "m1", "hold_id": "h1", "hold_action": "hold"}, merged)
+	// The hold's own metadata is not changed.
+	assert.Equal(t, "spoofed", metadata["hold_id"])
+}
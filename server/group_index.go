@@ -0,0 +1,352 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/search"
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// GroupIndex maintains a searchable index of group names, descriptions and selected metadata fields. Search results
+// are group IDs, callers read the current group state from the database.
+type GroupIndex interface {
+	Write(ctx context.Context, groups []*api.Group)
+	Delete(ctx context.Context, groupIDs []uuid.UUID)
+	List(ctx context.Context, query string, limit, offset int) ([]uuid.UUID, error)
+	Load(ctx context.Context) error
+}
+
+type LocalGroupIndex struct {
+	logger         *zap.Logger
+	db             *sql.DB
+	metadataFields []string
+	index          *bluge.Writer
+}
+
+func NewLocalGroupIndex(logger *zap.Logger, db *sql.DB, config *GroupConfig) (GroupIndex, error) {
+	idx, err := bluge.OpenWriter(BlugeInMemoryConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalGroupIndex{
+		logger:         logger,
+		db:             db,
+		metadataFields: config.IndexMetadataFields,
+		index:          idx,
+	}, nil
+}
+
+func (gi *LocalGroupIndex) Write(ctx context.Context, groups []*api.Group) {
+	batch := bluge.NewBatch()
+	for _, group := range groups {
+		doc, err := gi.mapIndexGroupFields(group)
+		if err != nil {
+			gi.logger.Error("Failed to map group values to index", zap.String("group_id", group.Id), zap.Error(err))
+			continue
+		}
+		batch.Update(doc.ID(), doc)
+	}
+
+	if err := gi.index.Batch(batch); err != nil {
+		gi.logger.Error("Failed to update group index", zap.Error(err))
+	}
+}
+
+func (gi *LocalGroupIndex) Delete(ctx context.Context, groupIDs []uuid.UUID) {
+	batch := bluge.NewBatch()
+	for _, groupID := range groupIDs {
+		batch.Delete(bluge.Identifier(groupID.String()))
+	}
+
+	if err := gi.index.Batch(batch); err != nil {
+		gi.logger.Error("Failed to evict entries from group index", zap.Error(err))
+	}
+}
+
+func (gi *LocalGroupIndex) List(ctx context.Context, query string, limit, offset int) ([]uuid.UUID, error) {
+	if query == "" {
+		query = "*"
+	}
+
+	parsedQuery, err := ParseQueryString(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scores are constant, order by identifier so pages are stable.
+	searchReq := bluge.NewTopNSearch(limit, parsedQuery).SetFrom(offset)
+	searchReq.SortBy([]string{"_id"})
+
+	indexReader, err := gi.index.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer indexReader.Close()
+
+	results, err := indexReader.Search(ctx, searchReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return gi.queryMatchesToGroupIds(results)
+}
+
+func (gi *LocalGroupIndex) Load(ctx context.Context) error {
+	t := time.Now()
+
+	query := `
+SELECT id, creator_id, name, description, avatar_url, state, edge_count, lang_tag, max_count, metadata, create_time, update_time
+FROM groups
+WHERE disable_time = '1970-01-01 00:00:00 UTC'
+ORDER BY id
+LIMIT $1`
+	params := []any{10_000}
+
+	var count int
+	for {
+		rows, err := gi.db.QueryContext(ctx, query, params...)
+		if err != nil {
+			return err
+		}
+
+		// Rows closed in groupConvertRows()
+		groups, _, err := groupConvertRows(rows, 10_000)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			break
+		}
+
+		gi.Write(ctx, groups)
+		count += len(groups)
+
+		query = `
+SELECT id, creator_id, name, description, avatar_url, state, edge_count, lang_tag, max_count, metadata, create_time, update_time
+FROM groups
+WHERE disable_time = '1970-01-01 00:00:00 UTC'
+AND id > $2
+ORDER BY id
+LIMIT $1`
+		params = []any{10_000, groups[len(groups)-1].Id}
+	}
+
+	gi.logger.Info("Group index loaded.", zap.Int("count", count), zap.Int64("elapsed_time_ms", time.Since(t).Milliseconds()))
+
+	return nil
+}
+
+func (gi *LocalGroupIndex) mapIndexGroupFields(group *api.Group) (*bluge.Document, error) {
+	rv := bluge.NewDocument(group.Id)
+	rv.AddField(bluge.NewTextField("name", group.Name))
+	rv.AddField(bluge.NewTextField("description", group.Description))
+	rv.AddField(bluge.NewKeywordField("lang_tag", group.LangTag))
+	if group.Open.GetValue() {
+		rv.AddField(bluge.NewKeywordField("open", "T"))
+	} else {
+		rv.AddField(bluge.NewKeywordField("open", "F"))
+	}
+	rv.AddField(bluge.NewNumericField("max_count", float64(group.MaxCount)))
+
+	if len(gi.metadataFields) == 0 || group.Metadata == "" {
+		return rv, nil
+	}
+
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(group.Metadata), &metadata); err != nil {
+		return nil, err
+	}
+
+	// Index only the configured subset of top level metadata fields.
+	filteredValues := make(map[string]any, len(gi.metadataFields))
+	for _, f := range gi.metadataFields {
+		if v, found := metadata[f]; found {
+			filteredValues[f] = v
+		}
+	}
+
+	BlugeWalkDocument(filteredValues, []string{"metadata"}, rv)
+
+	return rv, nil
+}
+
+func (gi *LocalGroupIndex) queryMatchesToGroupIds(dmi search.DocumentMatchIterator) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0)
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == "_id" {
+				id, vErr := uuid.FromString(string(value))
+				if vErr != nil {
+					err = vErr
+				} else {
+					ids = append(ids, id)
+				}
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Re-index groups after an update, reading their current state from the database.
+func groupIndexRefresh(ctx context.Context, logger *zap.Logger, db *sql.DB, groupIndex GroupIndex, groupIDs ...uuid.UUID) {
+	if groupIndex == nil || len(groupIDs) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		ids = append(ids, groupID.String())
+	}
+
+	groups, err := GetGroups(ctx, logger, db, ids)
+	if err != nil {
+		// Already logged, the index will catch up on the next write or restart.
+		return
+	}
+
+	found := make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		found[group.Id] = struct{}{}
+	}
+	deletes := make([]uuid.UUID, 0)
+	for _, groupID := range groupIDs {
+		if _, ok := found[groupID.String()]; !ok {
+			deletes = append(deletes, groupID)
+		}
+	}
+
+	if len(groups) > 0 {
+		groupIndex.Write(ctx, groups)
+	}
+	if len(deletes) > 0 {
+		groupIndex.Delete(ctx, deletes)
+	}
+}
+
+// Search the group index, applying any lang tag and open state filters within the index query and the edge count filter
+// against current group state. Pages may hold fewer than limit groups when indexed groups have since been deleted or
+// exceed the edge count filter, the cursor is set as long as more index results remain.
+func listGroupsIndexed(ctx context.Context, logger *zap.Logger, db *sql.DB, groupIndex GroupIndex, search, langTag string, open *bool, edgeCount, limit int, cursor *groupListCursor) (*api.GroupList, error) {
+	if groupIndex == nil {
+		return nil, StatusError(codes.Unimplemented, "group search is not available", nil)
+	}
+
+	filters := make([]string, 0, 2)
+	if langTag != "" {
+		filters = append(filters, "+lang_tag:"+strconv.Quote(langTag))
+	}
+	if open != nil {
+		if *open {
+			filters = append(filters, "+open:T")
+		} else {
+			filters = append(filters, "+open:F")
+		}
+	}
+	indexQuery := search
+	if len(filters) > 0 {
+		indexQuery = strings.Join(filters, " ")
+		if search != "*" {
+			indexQuery = "+(" + search + ") " + indexQuery
+		}
+	}
+
+	var offset int
+	if cursor != nil {
+		offset = cursor.Offset
+	}
+
+	groupIDs, err := groupIndex.List(ctx, indexQuery, limit+1, offset)
+	if err != nil {
+		logger.Warn("Could not search group index.", zap.Error(err), zap.String("query", search))
+		return nil, StatusError(codes.InvalidArgument, "Invalid search query.", err)
+	}
+
+	groupList := &api.GroupList{Groups: make([]*api.Group, 0, limit)}
+	if len(groupIDs) == 0 {
+		return groupList, nil
+	}
+
+	var nextCursor string
+	if len(groupIDs) > limit {
+		groupIDs = groupIDs[:limit]
+		cursorBuf := new(bytes.Buffer)
+		if err = gob.NewEncoder(cursorBuf).Encode(&groupListCursor{Offset: offset + limit}); err != nil {
+			logger.Error("Could not create group listing cursor.", zap.Error(err))
+			return nil, err
+		}
+		nextCursor = base64.RawURLEncoding.EncodeToString(cursorBuf.Bytes())
+	}
+
+	query := `
+SELECT id, creator_id, name, description, avatar_url, state, edge_count, lang_tag, max_count, metadata, create_time, update_time
+FROM groups
+WHERE disable_time = '1970-01-01 00:00:00 UTC' AND id = ANY($1::UUID[])`
+	params := []any{groupIDs}
+	if edgeCount > -1 {
+		query += " AND edge_count <= $2"
+		params = append(params, edgeCount)
+	}
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		logger.Error("Could not list groups.", zap.Error(err), zap.String("query", search))
+		return nil, err
+	}
+
+	// Rows closed in groupConvertRows()
+	groups, _, err := groupConvertRows(rows, len(groupIDs))
+	if err != nil {
+		logger.Error("Could not list groups.", zap.Error(err), zap.String("query", search))
+		return nil, err
+	}
+
+	// Return groups in index order.
+	groupsByID := make(map[string]*api.Group, len(groups))
+	for _, group := range groups {
+		groupsByID[group.Id] = group
+	}
+	for _, groupID := range groupIDs {
+		if group, found := groupsByID[groupID.String()]; found {
+			groupList.Groups = append(groupList.Groups, group)
+		}
+	}
+	groupList.Cursor = nextCursor
+
+	return groupList, nil
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestLocalGroupIndex_List(t *testing.T) {
+	ctx := context.Background()
+
+	groupIdx, err := NewLocalGroupIndex(logger, nil, &GroupConfig{IndexMetadataFields: []string{"region", "style"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	g1 := uuid.Must(uuid.NewV4())
+	g2 := uuid.Must(uuid.NewV4())
+	g3 := uuid.Must(uuid.NewV4())
+
+	groupIdx.Write(ctx, []*api.Group{
+		{
+			Id:          g1.String(),
+			Name:        "Red Dragons",
+			Description: "Casual raiders",
+			LangTag:     "en",
+			Open:        wrapperspb.Bool(true),
+			Metadata:    `{"region": "eu", "style": "casual", "secret": "hidden"}`,
+		},
+		{
+			Id:          g2.String(),
+			Name:        "Blue Dragons",
+			Description: "Competitive ranked play",
+			LangTag:     "de",
+			Open:        wrapperspb.Bool(false),
+			Metadata:    `{"region": "eu", "style": "competitive"}`,
+		},
+		{
+			Id:          g3.String(),
+			Name:        "Night Owls",
+			Description: "Late night casual play",
+			LangTag:     "en",
+			Open:        wrapperspb.Bool(true),
+			Metadata:    `{"region": "na", "style": "casual"}`,
+		},
+	})
+
+	t.Run("full text name", func(t *testing.T) {
+		ids, err := groupIdx.List(ctx, "name:dragons", 10, 0)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{g1, g2}, ids)
+	})
+
+	t.Run("full text description", func(t *testing.T) {
+		ids, err := groupIdx.List(ctx, "description:casual", 10, 0)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{g1, g3}, ids)
+	})
+
+	t.Run("metadata fields", func(t *testing.T) {
+		ids, err := groupIdx.List(ctx, "+metadata.region:eu +metadata.style:casual", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{g1}, ids)
+	})
+
+	t.Run("unselected metadata fields are not indexed", func(t *testing.T) {
+		ids, err := groupIdx.List(ctx, "metadata.secret:hidden", 10, 0)
+		assert.NoError(t, err)
+		assert.Len(t, ids, 0)
+	})
+
+	t.Run("lang tag and open", func(t *testing.T) {
+		ids, err := groupIdx.List(ctx, "+lang_tag:en +open:T", 10, 0)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{g1, g3}, ids)
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		first, err := groupIdx.List(ctx, "*", 2, 0)
+		assert.NoError(t, err)
+		assert.Len(t, first, 2)
+		second, err := groupIdx.List(ctx, "*", 2, 2)
+		assert.NoError(t, err)
+		assert.Len(t, second, 1)
+		assert.ElementsMatch(t, []uuid.UUID{g1, g2, g3}, append(first, second...))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		groupIdx.Delete(ctx, []uuid.UUID{g2})
+		ids, err := groupIdx.List(ctx, "name:dragons", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{g1}, ids)
+	})
+}
+
+func TestGroupListSearch(t *testing.T) {
+	assert.Equal(t, "", groupMetadataValue(context.Background(), groupListSearchMetadataKey))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(groupListSearchMetadataKey, "name:dragons"))
+	assert.Equal(t, "name:dragons", groupMetadataValue(ctx, groupListSearchMetadataKey))
+
+	md, found := groupQueryMetadata(httptest.NewRequest(http.MethodGet, "/v2/group?search=name%3Adragons&limit=10", nil))
+	assert.True(t, found)
+	assert.Equal(t, []string{"name:dragons"}, md.Get(groupListSearchMetadataKey))
+}
+
+func TestGroupIndexAccountDelete(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	groupIdx, err := NewLocalGroupIndex(logger, db, &GroupConfig{})
+	require.NoError(t, err)
+	sessionCache := NewLocalSessionCache(cfg.GetSession().TokenExpirySec, cfg.GetSession().RefreshTokenExpirySec)
+	defer sessionCache.Stop()
+	lbCache := NewLocalLeaderboardCache(ctx, logger, logger, db)
+	lbRankCache := NewLocalLeaderboardRankCache(ctx, logger, db, cfg.GetLeaderboard(), lbCache)
+
+	ownerID, memberID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	InsertUser(t, db, ownerID)
+	InsertUser(t, db, memberID)
+	owned, err := CreateGroup(ctx, logger, db, groupIdx, ownerID, ownerID, "indexed-"+GenerateString(), "en", "", "", "", true, 10)
+	require.NoError(t, err)
+	joined, err := CreateGroup(ctx, logger, db, groupIdx, memberID, memberID, "indexed-"+GenerateString(), "en", "", "", "", true, 10)
+	require.NoError(t, err)
+	require.NoError(t, JoinGroup(ctx, logger, db, lbCache, lbRankCache, &LocalTracker{}, &DummyMessageRouter{}, uuid.FromStringOrNil(joined.Id), ownerID, "owner", ""))
+
+	// Groups deleted with their only superadmin leave the index, and the groups they were a member of are refreshed.
+	err = DeleteAccount(ctx, logger, db, cfg, metrics, lbCache, lbRankCache, storageIdx, storageCollections, groupIdx, NewLocalSessionRegistry(metrics), sessionCache, &LocalTracker{}, &DummyMessageRouter{}, ownerID, false)
+	require.NoError(t, err)
+	ids, err := groupIdx.List(ctx, "*", 10, 0)
+	require.NoError(t, err)
+	assert.NotContains(t, ids, uuid.FromStringOrNil(owned.Id))
+	assert.Contains(t, ids, uuid.FromStringOrNil(joined.Id))
+}
@@ -45,6 +45,12 @@ const (
 	LeaderboardOperatorDecrement
 )
 
+const (
+	LeaderboardAggregateOperatorSum = iota
+	LeaderboardAggregateOperatorAverage
+	LeaderboardAggregateOperatorBest
+)
+
 type Leaderboard struct {
 	Id               string
 	Authoritative    bool
@@ -63,11 +69,17 @@ type Leaderboard struct {
 	MaxNumScore      int
 	Title            string
 	StartTime        int64
+
+	AggregateSourceId string // Set if this is a group aggregate of another leaderboard.
+	AggregateOperator int
 }
 
 func (l *Leaderboard) IsTournament() bool {
 	return l.Duration != 0
 }
+func (l *Leaderboard) IsGroupAggregate() bool {
+	return l.AggregateSourceId != ""
+}
 func (l *Leaderboard) HasMaxSize() bool {
 	return l.MaxSize != math.MaxInt32
 }
@@ -160,6 +172,9 @@ type LeaderboardCache interface {
 	ListTournaments(now int64, categoryStart, categoryEnd int, startTime, endTime int64, limit int, cursor *TournamentListCursor) ([]*Leaderboard, *TournamentListCursor, error)
 	Delete(ctx context.Context, rankCache LeaderboardRankCache, scheduler LeaderboardScheduler, id string) (bool, error)
 	Remove(id string)
+	CreateGroupAggregate(ctx context.Context, id, sourceId string, aggregateOperator int, metadata string) (*Leaderboard, bool, error)
+	ListGroupAggregates(sourceId string) []*Leaderboard
+	ListAllGroupAggregates() []*Leaderboard
 }
 
 type LocalLeaderboardCache struct {
@@ -172,6 +187,8 @@ type LocalLeaderboardCache struct {
 	allList         []*Leaderboard
 	leaderboardList []*Leaderboard // Non-tournament only
 	tournamentList  []*Leaderboard
+
+	groupAggregates map[string][]*Leaderboard // Keyed by source leaderboard ID.
 }
 
 func NewLocalLeaderboardCache(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB) LeaderboardCache {
@@ -184,6 +201,8 @@ func NewLocalLeaderboardCache(ctx context.Context, logger, startupLogger *zap.Lo
 		allList:         make([]*Leaderboard, 0),
 		leaderboardList: make([]*Leaderboard, 0),
 		tournamentList:  make([]*Leaderboard, 0),
+
+		groupAggregates: make(map[string][]*Leaderboard),
 	}
 
 	if err := l.RefreshAllLeaderboards(ctx); err != nil {
@@ -198,6 +217,7 @@ func (l *LocalLeaderboardCache) RefreshAllLeaderboards(ctx context.Context) erro
 	tournamentList := make([]*Leaderboard, 0, 100)
 	leaderboardList := make([]*Leaderboard, 0, 100)
 	allList := make([]*Leaderboard, 0, 100)
+	groupAggregates := make(map[string][]*Leaderboard)
 
 	const limit = 10_000
 
@@ -206,7 +226,8 @@ func (l *LocalLeaderboardCache) RefreshAllLeaderboards(ctx context.Context) erro
 	for {
 		query := `
 SELECT id, authoritative, sort_order, operator, reset_schedule, metadata, create_time,
-category, description, duration, end_time, join_required, max_size, max_num_score, title, start_time
+category, description, duration, end_time, join_required, max_size, max_num_score, title, start_time,
+aggregate_source_id, aggregate_operator
 FROM leaderboard`
 		params := make([]interface{}, 0, 3)
 		params = append(params, limit)
@@ -238,9 +259,12 @@ FROM leaderboard`
 			var maxNumScore int
 			var title string
 			var startTime pgtype.Timestamptz
+			var aggregateSourceId sql.NullString
+			var aggregateOperator int
 
 			err = rows.Scan(&id, &authoritative, &sortOrder, &operator, &resetSchedule, &metadata, &createTime,
-				&category, &description, &duration, &endTime, &joinRequired, &maxSize, &maxNumScore, &title, &startTime)
+				&category, &description, &duration, &endTime, &joinRequired, &maxSize, &maxNumScore, &title, &startTime,
+				&aggregateSourceId, &aggregateOperator)
 			if err != nil {
 				_ = rows.Close()
 				l.logger.Error("Error parsing leaderboard cache from database", zap.Error(err))
@@ -264,6 +288,9 @@ FROM leaderboard`
 				MaxNumScore:  maxNumScore,
 				Title:        title,
 				StartTime:    startTime.Time.Unix(),
+
+				AggregateSourceId: aggregateSourceId.String,
+				AggregateOperator: aggregateOperator,
 			}
 			if resetSchedule.Valid {
 				expr, err := cronexpr.Parse(resetSchedule.String)
@@ -288,6 +315,9 @@ FROM leaderboard`
 			} else {
 				leaderboardList = append(leaderboardList, leaderboard)
 			}
+			if leaderboard.IsGroupAggregate() {
+				groupAggregates[leaderboard.AggregateSourceId] = append(groupAggregates[leaderboard.AggregateSourceId], leaderboard)
+			}
 		}
 		_ = rows.Close()
 
@@ -303,6 +333,7 @@ FROM leaderboard`
 	l.allList = allList
 	l.tournamentList = tournamentList
 	l.leaderboardList = leaderboardList
+	l.groupAggregates = groupAggregates
 	l.Unlock()
 
 	return nil
@@ -797,6 +828,9 @@ func (l *LocalLeaderboardCache) Delete(ctx context.Context, rankCache Leaderboar
 			}
 		}
 	}
+	if leaderboard.IsGroupAggregate() {
+		l.removeGroupAggregate(leaderboard)
+	}
 	l.Unlock()
 
 	scheduler.Update()
@@ -806,6 +840,14 @@ func (l *LocalLeaderboardCache) Delete(ctx context.Context, rankCache Leaderboar
 		rankCache.DeleteLeaderboard(id, expiryUnix)
 	}
 
+	// Group aggregates of a deleted leaderboard have no records left to aggregate.
+	for _, aggregate := range l.ListGroupAggregates(id) {
+		if _, err := l.Delete(ctx, rankCache, scheduler, aggregate.Id); err != nil {
+			l.logger.Error("Error deleting group aggregate leaderboard", zap.Error(err), zap.String("leaderboard_id", aggregate.Id), zap.String("source_id", id))
+			return false, err
+		}
+	}
+
 	return rowsAffected != 0 || err != nil, nil
 }
 
@@ -840,8 +882,122 @@ func (l *LocalLeaderboardCache) Remove(id string) {
 				}
 			}
 		}
+		if leaderboard.IsGroupAggregate() {
+			l.removeGroupAggregate(leaderboard)
+		}
+	}
+	l.Unlock()
+}
+
+func (l *LocalLeaderboardCache) CreateGroupAggregate(ctx context.Context, id, sourceId string, aggregateOperator int, metadata string) (*Leaderboard, bool, error) {
+	l.RLock()
+	if leaderboard, ok := l.leaderboards[id]; ok {
+		// Creation is an idempotent operation.
+		l.RUnlock()
+		return leaderboard, false, nil
+	}
+	source, ok := l.leaderboards[sourceId]
+	l.RUnlock()
+
+	if !ok {
+		return nil, false, ErrLeaderboardNotFound
+	}
+	if source.IsTournament() || source.IsGroupAggregate() {
+		return nil, false, ErrLeaderboardGroupAggregateSource
+	}
+	if aggregateOperator < LeaderboardAggregateOperatorSum || aggregateOperator > LeaderboardAggregateOperatorBest {
+		return nil, false, ErrInvalidOperator
+	}
+
+	// Aggregates are authoritative and share the source sort order and reset schedule so record expiries line up.
+	query := "INSERT INTO leaderboard (id, authoritative, sort_order, operator, metadata, aggregate_source_id, aggregate_operator"
+	if source.ResetScheduleStr != "" {
+		query += ", reset_schedule"
+	}
+	query += ") VALUES ($1, $2, $3, $4, $5, $6, $7"
+	if source.ResetScheduleStr != "" {
+		query += ", $8"
+	}
+	query += ") ON CONFLICT (id) DO NOTHING RETURNING create_time"
+	params := []interface{}{id, true, source.SortOrder, LeaderboardOperatorSet, metadata, sourceId, aggregateOperator}
+	if source.ResetScheduleStr != "" {
+		params = append(params, source.ResetScheduleStr)
+	}
+	var createTime pgtype.Timestamptz
+	if err := l.db.QueryRowContext(ctx, query, params...).Scan(&createTime); err != nil {
+		if err == sql.ErrNoRows {
+			// Concurrent creation of a leaderboard with this ID, refresh to pick it up.
+			if err = l.RefreshAllLeaderboards(ctx); err != nil {
+				return nil, false, err
+			}
+			if leaderboard := l.Get(id); leaderboard != nil {
+				return leaderboard, false, nil
+			}
+			return nil, false, ErrLeaderboardNotFound
+		}
+		l.logger.Error("Error creating group aggregate leaderboard", zap.Error(err))
+		return nil, false, err
+	}
+
+	leaderboard := &Leaderboard{
+		Id:                id,
+		Authoritative:     true,
+		SortOrder:         source.SortOrder,
+		Operator:          LeaderboardOperatorSet,
+		ResetScheduleStr:  source.ResetScheduleStr,
+		ResetSchedule:     source.ResetSchedule,
+		Metadata:          metadata,
+		CreateTime:        createTime.Time.Unix(),
+		AggregateSourceId: sourceId,
+		AggregateOperator: aggregateOperator,
 	}
+
+	l.Lock()
+	if existing, ok := l.leaderboards[id]; ok {
+		// Maybe multiple concurrent creations for this ID.
+		l.Unlock()
+		return existing, false, nil
+	}
+	l.leaderboards[id] = leaderboard
+	l.allList = append(l.allList, leaderboard)
+	l.leaderboardList = append(l.leaderboardList, leaderboard)
+	l.groupAggregates[sourceId] = append(l.groupAggregates[sourceId], leaderboard)
 	l.Unlock()
+
+	return leaderboard, true, nil
+}
+
+func (l *LocalLeaderboardCache) ListGroupAggregates(sourceId string) []*Leaderboard {
+	l.RLock()
+	list := l.groupAggregates[sourceId]
+	l.RUnlock()
+	return list
+}
+
+func (l *LocalLeaderboardCache) ListAllGroupAggregates() []*Leaderboard {
+	list := make([]*Leaderboard, 0)
+	l.RLock()
+	for _, aggregates := range l.groupAggregates {
+		list = append(list, aggregates...)
+	}
+	l.RUnlock()
+	return list
+}
+
+// Must be called with the write lock held.
+func (l *LocalLeaderboardCache) removeGroupAggregate(leaderboard *Leaderboard) {
+	aggregates := l.groupAggregates[leaderboard.AggregateSourceId]
+	filtered := make([]*Leaderboard, 0, len(aggregates))
+	for _, aggregate := range aggregates {
+		if aggregate.Id != leaderboard.Id {
+			filtered = append(filtered, aggregate)
+		}
+	}
+	if len(filtered) == 0 {
+		delete(l.groupAggregates, leaderboard.AggregateSourceId)
+	} else {
+		l.groupAggregates[leaderboard.AggregateSourceId] = filtered
+	}
 }
 
 func checkTournamentConfig(resetSchedule string, startTime, endTime, duration, maxSize, maxNumScore int) (*cronexpr.Expression, error) {
@@ -414,6 +414,9 @@ WHERE id = $1`
 						ls.logger.Error("Could not reset leaderboard size", zap.Error(err), zap.String("id", callback.id))
 					}
 
+					// Promote and relegate members of any leagues driven by this tournament before the reset callback runs.
+					ls.processLeagueResets(callback.id, callback.ts)
+
 					if ls.fnTournamentReset != nil {
 						if err := ls.fnTournamentReset(ls.ctx, tournament, int64(tournament.EndActive), int64(tournament.NextReset)); err != nil {
 							ls.logger.Warn("Failed to invoke tournament reset callback", zap.Error(err))
@@ -460,3 +463,17 @@ WHERE id = $1`
 		}
 	}
 }
+
+func (ls *LocalLeaderboardScheduler) processLeagueResets(tournamentID string, ts int64) {
+	leagues, err := LeaguesGetByEntryTier(ls.ctx, ls.db, tournamentID)
+	if err != nil {
+		ls.logger.Error("Error retrieving leagues to process reset", zap.Error(err), zap.String("id", tournamentID))
+		return
+	}
+
+	for _, league := range leagues {
+		if err := LeagueProcessReset(ls.ctx, ls.logger, ls.db, ls.cache, ls.rankCache, league, ts); err != nil {
+			ls.logger.Error("Error processing league reset", zap.Error(err), zap.String("league_id", league.Id))
+		}
+	}
+}
@@ -313,5 +313,8 @@ func (s *testSessionRegistry) Disconnect(ctx context.Context, sessionID uuid.UUI
 func (s *testSessionRegistry) SingleSession(ctx context.Context, tracker Tracker, userID, sessionID uuid.UUID) {
 }
 
+func (s *testSessionRegistry) DisconnectToken(ctx context.Context, tracker Tracker, userID uuid.UUID, tokenID string) {
+}
+
 func (s *testSessionRegistry) Range(fn func(session Session) bool) {
 }
@@ -0,0 +1,358 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"go.uber.org/zap"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	NamePolicyFieldUsername       = "username"
+	NamePolicyFieldDisplayName    = "display_name"
+	NamePolicyFieldGroupName      = "group_name"
+	NamePolicyFieldChannelMessage = "channel_message"
+
+	NamePolicyReasonBannedWord       = "banned_word"
+	NamePolicyReasonReserved         = "reserved"
+	NamePolicyReasonInvalidCharacter = "invalid_character"
+	NamePolicyReasonRenameCooldown   = "rename_cooldown"
+)
+
+var namePolicyFieldLabels = map[string]string{
+	NamePolicyFieldUsername:       "Username",
+	NamePolicyFieldDisplayName:    "Display name",
+	NamePolicyFieldGroupName:      "Group name",
+	NamePolicyFieldChannelMessage: "Message",
+}
+
+var namePolicyCharacterClasses = map[string]func(rune) bool{
+	"letter":      unicode.IsLetter,
+	"digit":       unicode.IsDigit,
+	"space":       func(r rune) bool { return r == ' ' },
+	"punctuation": unicode.IsPunct,
+	"symbol":      unicode.IsSymbol,
+	"mark":        unicode.IsMark,
+}
+
+// Characters commonly substituted for letters. Both names and banned words are normalised with these, so "h4x0r"
+// matches a banned "haxor". Lower case L and I are folded together as they are easily confused.
+var namePolicyLeetspeak = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'9': 'g',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'i',
+	'+': 't',
+	'l': 'i',
+}
+
+// NamePolicyViolation describes why a name or message was rejected.
+type NamePolicyViolation struct {
+	Field  string
+	Reason string
+	// The banned word, disallowed character or seconds until a rename is allowed, depending on the reason.
+	Value string
+}
+
+func (v *NamePolicyViolation) Error() string {
+	label := namePolicyFieldLabels[v.Field]
+	switch v.Reason {
+	case NamePolicyReasonBannedWord:
+		return label + " invalid, contains a banned word."
+	case NamePolicyReasonReserved:
+		return label + " invalid, name is reserved."
+	case NamePolicyReasonInvalidCharacter:
+		return fmt.Sprintf("%s invalid, character %q is not allowed.", label, v.Value)
+	case NamePolicyReasonRenameCooldown:
+		return fmt.Sprintf("%s cannot be changed again for %s seconds.", label, v.Value)
+	default:
+		return label + " invalid."
+	}
+}
+
+// Status converts the violation to an invalid argument error, with the field, reason and value as error details.
+func (v *NamePolicyViolation) Status() error {
+	st := status.New(codes.InvalidArgument, v.Error())
+	details, err := structpb.NewStruct(v.Map())
+	if err != nil {
+		return st.Err()
+	}
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func (v *NamePolicyViolation) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"field":  v.Field,
+		"reason": v.Reason,
+		"value":  v.Value,
+	}
+}
+
+// Convert a name policy check error to a status error for clients.
+func namePolicyStatus(err error) error {
+	if v, ok := err.(*NamePolicyViolation); ok {
+		return v.Status()
+	}
+	return err
+}
+
+// Build a realtime error for a name policy check error, with the field, reason and value in the error context.
+func namePolicyErrorEnvelope(cid string, err error) *rtapi.Envelope {
+	rtErr := &rtapi.Error{Code: int32(rtapi.Error_BAD_INPUT), Message: err.Error()}
+	if v, ok := err.(*NamePolicyViolation); ok {
+		rtErr.Context = map[string]string{"field": v.Field, "reason": v.Reason, "value": v.Value}
+	}
+	return &rtapi.Envelope{Cid: cid, Message: &rtapi.Envelope_Error{Error: rtErr}}
+}
+
+// Check the username of an account about to be created, so existing accounts can still log in when the policy changes.
+// A nil policy allows any username.
+func namePolicyCheckNewUsername(namePolicy NamePolicy, username string) error {
+	if namePolicy == nil {
+		return nil
+	}
+	if err := namePolicy.Check(NamePolicyFieldUsername, username); err != nil {
+		return namePolicyStatus(err)
+	}
+	return nil
+}
+
+type NamePolicy interface {
+	// Check a username, display name, group name or channel message against the policy. Returns a
+	// *NamePolicyViolation if it does not pass.
+	Check(field, value string) error
+	// RenameCooldown is the minimum time between username changes made by a player.
+	RenameCooldown() time.Duration
+	// FilterChannelMessages is true if channel messages are checked for banned words.
+	FilterChannelMessages() bool
+}
+
+type LocalNamePolicy struct {
+	bannedWords           []string
+	reservedNames         map[string]struct{}
+	allowedClasses        []func(rune) bool
+	renameCooldown        time.Duration
+	filterChannelMessages bool
+	bannedWordSubstrings  bool
+}
+
+func NewLocalNamePolicy(logger *zap.Logger, config Config) NamePolicy {
+	namePolicyConfig := config.GetNamePolicy()
+
+	words := namePolicyConfig.BannedWords
+	if namePolicyConfig.BannedWordsFile != "" {
+		fileWords, err := readNamePolicyWords(namePolicyConfig.BannedWordsFile)
+		if err != nil {
+			logger.Fatal("Failed to read name policy banned words file", zap.String("path", namePolicyConfig.BannedWordsFile), zap.Error(err))
+		}
+		words = append(words, fileWords...)
+	}
+
+	p := &LocalNamePolicy{
+		bannedWords:           make([]string, 0, len(words)),
+		reservedNames:         make(map[string]struct{}, len(namePolicyConfig.ReservedNames)),
+		allowedClasses:        make([]func(rune) bool, 0, len(namePolicyConfig.AllowedCharacterClasses)),
+		renameCooldown:        time.Duration(namePolicyConfig.RenameCooldownSec) * time.Second,
+		filterChannelMessages: namePolicyConfig.FilterChannelMessages,
+		bannedWordSubstrings:  namePolicyConfig.BannedWordSubstrings,
+	}
+	seen := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		if word = namePolicyNormalise(word); word == "" {
+			continue
+		}
+		if _, found := seen[word]; !found {
+			seen[word] = struct{}{}
+			p.bannedWords = append(p.bannedWords, word)
+		}
+	}
+	for _, name := range namePolicyConfig.ReservedNames {
+		if name = namePolicyNormalise(name); name != "" {
+			p.reservedNames[name] = struct{}{}
+		}
+	}
+	for _, class := range namePolicyConfig.AllowedCharacterClasses {
+		// Unknown classes are rejected by config validation.
+		if fn, found := namePolicyCharacterClasses[class]; found {
+			p.allowedClasses = append(p.allowedClasses, fn)
+		}
+	}
+
+	return p
+}
+
+func (p *LocalNamePolicy) Check(field, value string) error {
+	if field == NamePolicyFieldChannelMessage {
+		// Messages are always checked word by word, and are not limited to the allowed character classes.
+		return p.checkBannedWords(field, value, false)
+	}
+
+	if len(p.allowedClasses) > 0 {
+		for _, r := range value {
+			if !p.allowedCharacter(r) {
+				return &NamePolicyViolation{Field: field, Reason: NamePolicyReasonInvalidCharacter, Value: string(r)}
+			}
+		}
+	}
+
+	normalised := namePolicyNormalise(value)
+	if _, found := p.reservedNames[normalised]; found {
+		return &NamePolicyViolation{Field: field, Reason: NamePolicyReasonReserved, Value: value}
+	}
+	return p.checkBannedWords(field, value, p.bannedWordSubstrings)
+}
+
+// Banned words match whole words, and the whole value, unless substring matching is enabled. This keeps names like
+// "Scunthorpe" usable when a word they contain is banned.
+func (p *LocalNamePolicy) checkBannedWords(field, value string, substrings bool) error {
+	if len(p.bannedWords) == 0 {
+		return nil
+	}
+	normalised := namePolicyNormalise(value)
+	tokens := namePolicyWords(value)
+	for _, word := range p.bannedWords {
+		if substrings {
+			if strings.Contains(normalised, word) {
+				return &NamePolicyViolation{Field: field, Reason: NamePolicyReasonBannedWord, Value: word}
+			}
+			continue
+		}
+		if normalised == word {
+			return &NamePolicyViolation{Field: field, Reason: NamePolicyReasonBannedWord, Value: word}
+		}
+		for _, token := range tokens {
+			if token == word {
+				return &NamePolicyViolation{Field: field, Reason: NamePolicyReasonBannedWord, Value: word}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *LocalNamePolicy) RenameCooldown() time.Duration {
+	return p.renameCooldown
+}
+
+func (p *LocalNamePolicy) FilterChannelMessages() bool {
+	return p.filterChannelMessages
+}
+
+func (p *LocalNamePolicy) allowedCharacter(r rune) bool {
+	for _, fn := range p.allowedClasses {
+		if fn(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reduce a name to lower case letters and digits with accents removed, leetspeak substitutions replaced and repeated
+// characters collapsed, so simple variations of a word compare equal.
+func namePolicyNormalise(value string) string {
+	var b strings.Builder
+	b.Grow(len(value))
+	var last rune
+	for _, r := range norm.NFKD.String(value) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if sub, found := namePolicyLeetspeak[r]; found {
+			r = sub
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if r == last {
+			continue
+		}
+		last = r
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Words in messages are separated by anything that is not a letter, digit or leetspeak substitution.
+// Split a value into normalised words at separators and at lower to upper case changes, so "the_badword" and
+// "TheBadword" both contain the word "badword".
+func namePolicyWords(value string) []string {
+	words := make([]string, 0, 1)
+	for _, field := range strings.FieldsFunc(value, namePolicySeparator) {
+		start := 0
+		var last rune
+		for i, r := range field {
+			if i > start && unicode.IsLower(last) && unicode.IsUpper(r) {
+				if word := namePolicyNormalise(field[start:i]); word != "" {
+					words = append(words, word)
+				}
+				start = i
+			}
+			last = r
+		}
+		if word := namePolicyNormalise(field[start:]); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func namePolicySeparator(r rune) bool {
+	if _, found := namePolicyLeetspeak[r]; found {
+		return false
+	}
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Read one word per line, ignoring blank lines and lines starting with #.
+func readNamePolicyWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := make([]string, 0, 100)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func testNamePolicy(t *testing.T) NamePolicy {
+	t.Helper()
+	c := NewConfig(logger)
+	c.NamePolicy.BannedWords = []string{"badword"}
+	c.NamePolicy.ReservedNames = []string{"Admin"}
+	c.NamePolicy.AllowedCharacterClasses = []string{"letter", "digit", "punctuation"}
+	return NewLocalNamePolicy(logger, c)
+}
+
+func TestNamePolicyNormalise(t *testing.T) {
+	// Lower case L folds into I, and repeated characters collapse.
+	assert.Equal(t, "heio", namePolicyNormalise("H3ll0"))
+	assert.Equal(t, "cafe", namePolicyNormalise("Café"))
+	assert.Equal(t, "badword", namePolicyNormalise("b_a_a_d-w0rd"))
+}
+
+func TestNamePolicyCheck(t *testing.T) {
+	p := testNamePolicy(t)
+
+	assert.NoError(t, p.Check(NamePolicyFieldUsername, "player_one"))
+
+	for name, reason := range map[string]string{
+		"xX_B4DW0RD_Xx": NamePolicyReasonBannedWord,
+		"TheBadword":    NamePolicyReasonBannedWord,
+		"bbaaddword":    NamePolicyReasonBannedWord,
+		"4dm1n":         NamePolicyReasonReserved,
+		"ADMIN":         NamePolicyReasonReserved,
+		"player one":    NamePolicyReasonInvalidCharacter,
+	} {
+		err := p.Check(NamePolicyFieldDisplayName, name)
+		if assert.IsType(t, &NamePolicyViolation{}, err, name) {
+			assert.Equal(t, reason, err.(*NamePolicyViolation).Reason, name)
+			assert.Equal(t, NamePolicyFieldDisplayName, err.(*NamePolicyViolation).Field, name)
+		}
+	}
+
+	// Reserved names only match whole names.
+	assert.NoError(t, p.Check(NamePolicyFieldGroupName, "AdminFans"))
+}
+
+func TestNamePolicyCheckWordBoundaries(t *testing.T) {
+	c := NewConfig(logger)
+	c.NamePolicy.BannedWords = []string{"cunt"}
+	p := NewLocalNamePolicy(logger, c)
+
+	// Banned words inside longer words are allowed by default.
+	assert.NoError(t, p.Check(NamePolicyFieldDisplayName, "Scunthorpe"))
+	assert.NoError(t, p.Check(NamePolicyFieldChannelMessage, "Scunthorpe"))
+
+	c.NamePolicy.BannedWordSubstrings = true
+	p = NewLocalNamePolicy(logger, c)
+	err := p.Check(NamePolicyFieldDisplayName, "Scunthorpe")
+	if assert.IsType(t, &NamePolicyViolation{}, err) {
+		assert.Equal(t, NamePolicyReasonBannedWord, err.(*NamePolicyViolation).Reason)
+	}
+	// Substring matching does not apply to channel messages.
+	assert.NoError(t, p.Check(NamePolicyFieldChannelMessage, "Scunthorpe"))
+}
+
+func TestNamePolicyCheckChannelMessage(t *testing.T) {
+	p := testNamePolicy(t)
+
+	// Messages are matched word by word, and are not limited to the allowed character classes.
+	assert.NoError(t, p.Check(NamePolicyFieldChannelMessage, `{"text": "notbadwords here"}`))
+	err := p.Check(NamePolicyFieldChannelMessage, `{"text": "what a B4DW0RD"}`)
+	if assert.IsType(t, &NamePolicyViolation{}, err) {
+		assert.Equal(t, "badword", err.(*NamePolicyViolation).Value)
+	}
+}
+
+func TestNamePolicyNewUsernameOnly(t *testing.T) {
+	db := NewDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	p := testNamePolicy(t)
+
+	customID := GenerateString()
+	_, _, _, err := AuthenticateCustom(ctx, logger, db, p, customID, "badword_"+customID, true)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Accounts created before the word was banned can still log in.
+	userID, username, _, err := AuthenticateCustom(ctx, logger, db, nil, customID, "badword_"+customID, true)
+	require.NoError(t, err)
+	_, loginUsername, created, err := AuthenticateCustom(ctx, logger, db, p, customID, "badword_"+customID, true)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, username, loginUsername)
+
+	// Updates leaving the username unchanged are not checked, renames are.
+	update := &accountUpdate{userID: uuid.FromStringOrNil(userID), username: username, namePolicy: p}
+	require.NoError(t, UpdateAccounts(ctx, logger, db, []*accountUpdate{update}))
+	update.username = "badword_" + GenerateString()
+	var violation *NamePolicyViolation
+	assert.ErrorAs(t, UpdateAccounts(ctx, logger, db, []*accountUpdate{update}), &violation)
+}
+
+func TestNamePolicyViolationStatus(t *testing.T) {
+	st, _ := status.FromError((&NamePolicyViolation{Field: NamePolicyFieldUsername, Reason: NamePolicyReasonReserved, Value: "admin"}).Status())
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, "Username invalid, name is reserved.", st.Message())
+	if assert.Len(t, st.Details(), 1) {
+		details := st.Details()[0].(*structpb.Struct).AsMap()
+		assert.Equal(t, NamePolicyReasonReserved, details["reason"])
+		assert.Equal(t, "admin", details["value"])
+	}
+}
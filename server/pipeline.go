@@ -17,6 +17,7 @@ package server
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/heroiclabs/nakama-common/rtapi"
@@ -37,11 +38,13 @@ type Pipeline struct {
 	matchmaker           Matchmaker
 	tracker              Tracker
 	router               MessageRouter
+	rateLimiter          RateLimiter
+	namePolicy           NamePolicy
 	runtime              *Runtime
 	node                 string
 }
 
-func NewPipeline(logger *zap.Logger, config Config, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, sessionRegistry SessionRegistry, statusRegistry StatusRegistry, matchRegistry MatchRegistry, partyRegistry PartyRegistry, matchmaker Matchmaker, tracker Tracker, router MessageRouter, runtime *Runtime) *Pipeline {
+func NewPipeline(logger *zap.Logger, config Config, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, sessionRegistry SessionRegistry, statusRegistry StatusRegistry, matchRegistry MatchRegistry, partyRegistry PartyRegistry, matchmaker Matchmaker, tracker Tracker, router MessageRouter, rateLimiter RateLimiter, namePolicy NamePolicy, runtime *Runtime) *Pipeline {
 	return &Pipeline{
 		logger:               logger,
 		config:               config,
@@ -55,6 +58,8 @@ func NewPipeline(logger *zap.Logger, config Config, db *sql.DB, protojsonMarshal
 		matchmaker:           matchmaker,
 		tracker:              tracker,
 		router:               router,
+		rateLimiter:          rateLimiter,
+		namePolicy:           namePolicy,
 		runtime:              runtime,
 		node:                 config.GetName(),
 	}
@@ -143,6 +148,26 @@ func (p *Pipeline) ProcessRequest(logger *zap.Logger, session Session, in *rtapi
 		return false
 	}
 
+	switch in.Message.(type) {
+	case *rtapi.Envelope_Ping, *rtapi.Envelope_Pong:
+		// Keepalive messages are never rate limited.
+	default:
+		var rpcID string
+		if rpc, ok := in.Message.(*rtapi.Envelope_Rpc); ok {
+			rpcID = rpc.Rpc.Id
+		}
+		method := strings.TrimPrefix(fmt.Sprintf("%T", in.Message), "*rtapi.Envelope_")
+		if allowed, wait := p.rateLimiter.AllowRequest(method, rpcID, session.UserID(), session.ClientIP()); !allowed {
+			// Rate limited messages do not close the session.
+			_ = session.Send(&rtapi.Envelope{Cid: in.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
+				Code:    int32(rtapi.Error_RUNTIME_EXCEPTION),
+				Message: "Rate limit exceeded",
+				Context: map[string]string{"retry_after": strconv.FormatInt(rateLimitRetryAfterSec(wait), 10)},
+			}}}, true)
+			return true
+		}
+	}
+
 	var messageName, messageNameID string
 
 	switch in.Message.(type) {
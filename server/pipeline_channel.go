@@ -28,6 +28,7 @@ import (
 	"github.com/heroiclabs/nakama-common/runtime"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 const (
@@ -71,6 +72,18 @@ func (p *Pipeline) channelJoin(logger *zap.Logger, session Session, envelope *rt
 		Persistence: incoming.Persistence == nil || incoming.Persistence.Value,
 		Username:    session.Username(),
 	}
+	if stream.Mode == StreamModeGroup {
+		// Group channel presences carry the member's custom role, if any, as their status.
+		role, err := groupUserRoleGet(session.Context(), logger, p.db, stream.Subject, session.UserID())
+		if err != nil {
+			_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
+				Code:    int32(rtapi.Error_RUNTIME_EXCEPTION),
+				Message: "Error joining channel",
+			}}}, true)
+			return false, nil
+		}
+		meta.Status = role
+	}
 	success, isNew := p.tracker.Track(session.Context(), session.ID(), stream, session.UserID(), meta)
 	if !success {
 		_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
@@ -132,12 +145,16 @@ func (p *Pipeline) channelJoin(logger *zap.Logger, session Session, envelope *rt
 			// Only for new joins, not if the user is joining a channel they're already part of.
 			continue
 		}
-		userPresences = append(userPresences, &rtapi.UserPresence{
+		userPresence := &rtapi.UserPresence{
 			UserId:      presence.UserID.String(),
 			SessionId:   presence.ID.SessionID.String(),
 			Username:    presence.Meta.Username,
 			Persistence: presence.Meta.Persistence,
-		})
+		}
+		if stream.Mode == StreamModeGroup {
+			userPresence.Status = &wrapperspb.StringValue{Value: presence.Meta.Status}
+		}
+		userPresences = append(userPresences, userPresence)
 	}
 
 	channel := &rtapi.Channel{
@@ -155,6 +172,7 @@ func (p *Pipeline) channelJoin(logger *zap.Logger, session Session, envelope *rt
 		channel.RoomName = stream.Label
 	case StreamModeGroup:
 		channel.GroupId = stream.Subject.String()
+		channel.Self.Status = &wrapperspb.StringValue{Value: meta.Status}
 	case StreamModeDM:
 		channel.UserIdOne = stream.Subject.String()
 		channel.UserIdTwo = stream.Subcontext.String()
@@ -215,6 +233,13 @@ func (p *Pipeline) channelMessageSend(logger *zap.Logger, session Session, envel
 		return false, nil
 	}
 
+	if p.namePolicy.FilterChannelMessages() {
+		if err := p.namePolicy.Check(NamePolicyFieldChannelMessage, incoming.Content); err != nil {
+			_ = session.Send(namePolicyErrorEnvelope(envelope.Cid, err), true)
+			return false, nil
+		}
+	}
+
 	ack, err := ChannelMessageSend(session.Context(), p.logger, p.db, p.router, streamConversionResult.Stream, incoming.ChannelId, incoming.Content, session.UserID().String(), session.Username(), meta.Persistence)
 	switch err {
 	case errChannelMessagePersist:
@@ -268,6 +293,13 @@ func (p *Pipeline) channelMessageUpdate(logger *zap.Logger, session Session, env
 		return false, nil
 	}
 
+	if p.namePolicy.FilterChannelMessages() {
+		if err := p.namePolicy.Check(NamePolicyFieldChannelMessage, incoming.Content); err != nil {
+			_ = session.Send(namePolicyErrorEnvelope(envelope.Cid, err), true)
+			return false, nil
+		}
+	}
+
 	ack, err := ChannelMessageUpdate(session.Context(), p.logger, p.db, p.router, streamConversionResult.Stream, incoming.ChannelId, incoming.MessageId, incoming.Content, session.UserID().String(), session.Username(), meta.Persistence)
 	switch err {
 	case errChannelMessageNotFound:
@@ -318,7 +350,19 @@ func (p *Pipeline) channelMessageRemove(logger *zap.Logger, session Session, env
 		return false, nil
 	}
 
-	ack, err := ChannelMessageRemove(session.Context(), p.logger, p.db, p.router, streamConversionResult.Stream, incoming.ChannelId, incoming.MessageId, session.UserID().String(), session.Username(), meta.Persistence)
+	senderId, senderUsername := session.UserID().String(), session.Username()
+	if moderatedSenderId, moderatedSenderUsername, ok, err := channelGroupMessageModerateSender(session.Context(), logger, p.db, streamConversionResult.Stream, incoming.MessageId, session.UserID()); err != nil {
+		_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
+			Code:    int32(rtapi.Error_RUNTIME_EXCEPTION),
+			Message: "Could not look up message to remove in channel history",
+		}}}, true)
+		return false, nil
+	} else if ok {
+		// Moderators remove messages on behalf of their original sender.
+		senderId, senderUsername = moderatedSenderId, moderatedSenderUsername
+	}
+
+	ack, err := ChannelMessageRemove(session.Context(), p.logger, p.db, p.router, streamConversionResult.Stream, incoming.ChannelId, incoming.MessageId, senderId, senderUsername, meta.Persistence)
 	switch err {
 	case errChannelMessageNotFound:
 		_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
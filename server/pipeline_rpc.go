@@ -34,6 +34,14 @@ func (p *Pipeline) rpc(logger *zap.Logger, session Session, envelope *rtapi.Enve
 
 	id := strings.ToLower(rpcMessage.Id)
 
+	// Storage subscriptions are handled by the server rather than a runtime function.
+	switch id {
+	case StorageSubscribeRpcId:
+		return p.storageSubscribe(logger, session, envelope)
+	case StorageUnsubscribeRpcId:
+		return p.storageUnsubscribe(logger, session, envelope)
+	}
+
 	fn := p.runtime.Rpc(id)
 	if fn == nil {
 		_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
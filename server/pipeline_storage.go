@@ -0,0 +1,95 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"go.uber.org/zap"
+)
+
+// Subscribe the session to realtime changes of storage objects and collections. Read permissions are checked when each
+// change is published, so subscriptions to objects the session cannot read are accepted but never receive changes.
+func (p *Pipeline) storageSubscribe(logger *zap.Logger, session Session, envelope *rtapi.Envelope) (bool, *rtapi.Envelope) {
+	streams, ok := p.storageSubscriptionStreams(session, envelope)
+	if !ok {
+		return false, nil
+	}
+
+	for _, stream := range streams {
+		// Hidden so subscribers do not receive presence events for each other.
+		success, _ := p.tracker.Track(session.Context(), session.ID(), stream, session.UserID(), PresenceMeta{
+			Format:   session.Format(),
+			Hidden:   true,
+			Username: session.Username(),
+		})
+		if !success {
+			_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
+				Code:    int32(rtapi.Error_RUNTIME_EXCEPTION),
+				Message: "Error tracking storage subscription",
+			}}}, true)
+			return false, nil
+		}
+	}
+
+	return p.storageSubscriptionAck(session, envelope)
+}
+
+func (p *Pipeline) storageUnsubscribe(logger *zap.Logger, session Session, envelope *rtapi.Envelope) (bool, *rtapi.Envelope) {
+	streams, ok := p.storageSubscriptionStreams(session, envelope)
+	if !ok {
+		return false, nil
+	}
+
+	for _, stream := range streams {
+		p.tracker.Untrack(session.ID(), stream, session.UserID())
+	}
+
+	return p.storageSubscriptionAck(session, envelope)
+}
+
+func (p *Pipeline) storageSubscriptionStreams(session Session, envelope *rtapi.Envelope) ([]PresenceStream, bool) {
+	subscription := &StorageSubscription{}
+	if err := json.Unmarshal([]byte(envelope.GetRpc().Payload), subscription); err != nil {
+		_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
+			Code:    int32(rtapi.Error_BAD_INPUT),
+			Message: "Invalid storage subscription payload",
+		}}}, true)
+		return nil, false
+	}
+
+	streams, err := subscription.Streams()
+	if err != nil {
+		_ = session.Send(&rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Error{Error: &rtapi.Error{
+			Code:    int32(rtapi.Error_BAD_INPUT),
+			Message: fmt.Sprintf("Invalid storage subscription: %s", err.Error()),
+		}}}, true)
+		return nil, false
+	}
+	return streams, true
+}
+
+func (p *Pipeline) storageSubscriptionAck(session Session, envelope *rtapi.Envelope) (bool, *rtapi.Envelope) {
+	out := &rtapi.Envelope{Cid: envelope.Cid, Message: &rtapi.Envelope_Rpc{Rpc: &api.Rpc{
+		Id:      envelope.GetRpc().Id,
+		Payload: "{}",
+	}}}
+	_ = session.Send(out, true)
+
+	return true, out
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Response header, and gRPC metadata key, holding the whole seconds a rate limited client should wait before retrying.
+const rateLimitRetryAfterHeader = "retry-after"
+
+type RateLimiter interface {
+	Stop()
+	// AllowRequest checks an API method, realtime message or RPC against the configured limits for the user and client
+	// IP. Tokens are only taken if every applicable bucket allows the request, otherwise the wait before retrying is returned.
+	AllowRequest(method, rpcID string, userID uuid.UUID, clientIP string) (bool, time.Duration)
+	// Take checks whether cost tokens are available in a runtime defined bucket, and removes them if consume is set.
+	// Returns the tokens left in the bucket and the wait until cost tokens would be available.
+	Take(key string, rate float64, burst, cost int, consume bool) (bool, float64, time.Duration)
+}
+
+type rateLimitRule struct {
+	ipRate    float64
+	ipBurst   int
+	userRate  float64
+	userBurst int
+}
+
+type tokenBucket struct {
+	rate       float64
+	burst      float64
+	tokens     float64
+	updateTime time.Time
+}
+
+// Refill the bucket for the time passed since it was last updated.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updateTime).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+	}
+	b.tokens = math.Min(b.burst, b.tokens)
+	b.updateTime = now
+}
+
+func (b *tokenBucket) wait(cost float64) time.Duration {
+	if b.tokens >= cost {
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((cost - b.tokens) / b.rate * float64(time.Second))
+}
+
+type LocalRateLimiter struct {
+	sync.Mutex
+	ctx         context.Context
+	ctxCancelFn context.CancelFunc
+
+	ip      *rateLimitRule
+	user    *rateLimitRule
+	methods map[string]*rateLimitRule
+	rpcs    map[string]*rateLimitRule
+
+	buckets map[string]*tokenBucket
+}
+
+func NewLocalRateLimiter(config Config) RateLimiter {
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+
+	rateLimitConfig := config.GetRateLimit()
+	c := &LocalRateLimiter{
+		ctx:         ctx,
+		ctxCancelFn: ctxCancelFn,
+
+		ip:      &rateLimitRule{ipRate: rateLimitConfig.IpRate, ipBurst: rateLimitConfig.IpBurst},
+		user:    &rateLimitRule{userRate: rateLimitConfig.UserRate, userBurst: rateLimitConfig.UserBurst},
+		methods: make(map[string]*rateLimitRule),
+		rpcs:    make(map[string]*rateLimitRule),
+
+		buckets: make(map[string]*tokenBucket),
+	}
+	for _, ruleConfig := range rateLimitConfig.Rules {
+		rule := &rateLimitRule{
+			ipRate:    ruleConfig.IpRate,
+			ipBurst:   ruleConfig.IpBurst,
+			userRate:  ruleConfig.UserRate,
+			userBurst: ruleConfig.UserBurst,
+		}
+		if ruleConfig.RpcId != "" {
+			// RPC IDs are matched case insensitively, as they are when registered.
+			c.rpcs[strings.ToLower(ruleConfig.RpcId)] = rule
+		} else {
+			c.methods[ruleConfig.Method] = rule
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for {
+			select {
+			case <-c.ctx.Done():
+				ticker.Stop()
+				return
+			case t := <-ticker.C:
+				// Buckets that have refilled behave the same as new ones, drop them.
+				now := t.UTC()
+				c.Lock()
+				for key, bucket := range c.buckets {
+					bucket.refill(now)
+					if bucket.tokens >= bucket.burst {
+						delete(c.buckets, key)
+					}
+				}
+				c.Unlock()
+			}
+		}
+	}()
+
+	return c
+}
+
+func (c *LocalRateLimiter) Stop() {
+	c.ctxCancelFn()
+}
+
+func (c *LocalRateLimiter) AllowRequest(method, rpcID string, userID uuid.UUID, clientIP string) (bool, time.Duration) {
+	now := time.Now().UTC()
+	buckets := make([]*tokenBucket, 0, 4)
+
+	c.Lock()
+	defer c.Unlock()
+
+	appendBuckets := func(prefix string, rule *rateLimitRule) {
+		if rule.ipRate > 0 && clientIP != "" {
+			buckets = append(buckets, c.bucket(prefix+"ip:"+clientIP, rule.ipRate, rule.ipBurst, now))
+		}
+		if rule.userRate > 0 && userID != uuid.Nil {
+			buckets = append(buckets, c.bucket(prefix+"user:"+userID.String(), rule.userRate, rule.userBurst, now))
+		}
+	}
+	appendBuckets("", c.ip)
+	appendBuckets("", c.user)
+	if rpcID != "" {
+		rpcID = strings.ToLower(rpcID)
+		if rule, found := c.rpcs[rpcID]; found {
+			appendBuckets("rpc:"+rpcID+":", rule)
+		}
+	} else if rule, found := c.methods[method]; found {
+		appendBuckets("method:"+method+":", rule)
+	}
+
+	var wait time.Duration
+	for _, bucket := range buckets {
+		if w := bucket.wait(1); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true, 0
+}
+
+func (c *LocalRateLimiter) Take(key string, rate float64, burst, cost int, consume bool) (bool, float64, time.Duration) {
+	now := time.Now().UTC()
+
+	c.Lock()
+	defer c.Unlock()
+
+	// Keep runtime buckets apart from those used for configured limits.
+	bucket := c.bucket("runtime:"+key, rate, burst, now)
+	wait := bucket.wait(float64(cost))
+	if wait > 0 {
+		return false, bucket.tokens, wait
+	}
+	if consume {
+		bucket.tokens -= float64(cost)
+	}
+	return true, bucket.tokens, 0
+}
+
+// Get or create a full bucket, adopting the given rate and burst if they changed since it was last used.
+func (c *LocalRateLimiter) bucket(key string, rate float64, burst int, now time.Time) *tokenBucket {
+	bucket, found := c.buckets[key]
+	if !found {
+		bucket = &tokenBucket{tokens: float64(burst), updateTime: now}
+		c.buckets[key] = bucket
+	}
+	bucket.rate = rate
+	bucket.burst = float64(burst)
+	bucket.refill(now)
+	return bucket
+}
+
+// Whole seconds to wait before retrying, rounded up so clients never retry early.
+func rateLimitRetryAfterSec(wait time.Duration) int64 {
+	return int64(math.Ceil(wait.Seconds()))
+}
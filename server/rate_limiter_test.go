@@ -0,0 +1,92 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterAllowRequest(t *testing.T) {
+	config := NewConfig(logger)
+	config.GetRateLimit().IpRate = 0.1
+	config.GetRateLimit().IpBurst = 3
+	config.GetRateLimit().Rules = []*RateLimitRuleConfig{
+		{Method: "AuthenticateEmail", IpRate: 0.1, IpBurst: 1},
+		{RpcId: "Wallet_Transfer", UserRate: 0.1, UserBurst: 1},
+	}
+	rateLimiter := NewLocalRateLimiter(config)
+	defer rateLimiter.Stop()
+	userID := uuid.Must(uuid.NewV4())
+
+	allowed, _ := rateLimiter.AllowRequest("AuthenticateEmail", "", uuid.Nil, "10.0.0.1")
+	assert.True(t, allowed)
+	allowed, wait := rateLimiter.AllowRequest("AuthenticateEmail", "", uuid.Nil, "10.0.0.1")
+	assert.False(t, allowed)
+	assert.True(t, wait > 0 && wait <= 10*time.Second, "unexpected wait %v", wait)
+	assert.Equal(t, int64(10), rateLimitRetryAfterSec(wait))
+
+	// The rejected request took nothing from the IP bucket, other IPs are limited separately.
+	allowed, _ = rateLimiter.AllowRequest("AuthenticateDevice", "", uuid.Nil, "10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _ = rateLimiter.AllowRequest("AuthenticateDevice", "", uuid.Nil, "10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _ = rateLimiter.AllowRequest("AuthenticateDevice", "", uuid.Nil, "10.0.0.1")
+	assert.False(t, allowed)
+	allowed, _ = rateLimiter.AllowRequest("AuthenticateEmail", "", uuid.Nil, "10.0.0.2")
+	assert.True(t, allowed)
+
+	// RPC rules match IDs case insensitively, and apply per user.
+	allowed, _ = rateLimiter.AllowRequest("", "wallet_transfer", userID, "10.0.0.3")
+	assert.True(t, allowed)
+	allowed, _ = rateLimiter.AllowRequest("", "WALLET_TRANSFER", userID, "10.0.0.3")
+	assert.False(t, allowed)
+	allowed, _ = rateLimiter.AllowRequest("", "wallet_transfer", uuid.Must(uuid.NewV4()), "10.0.0.3")
+	assert.True(t, allowed)
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	rateLimiter := NewLocalRateLimiter(NewConfig(logger))
+	defer rateLimiter.Stop()
+
+	allowed, remaining, _ := rateLimiter.Take("key", 1, 5, 3, false)
+	assert.True(t, allowed)
+	assert.Equal(t, 5.0, remaining)
+
+	allowed, remaining, _ = rateLimiter.Take("key", 1, 5, 3, true)
+	assert.True(t, allowed)
+	assert.InDelta(t, 2.0, remaining, 0.1)
+
+	allowed, remaining, wait := rateLimiter.Take("key", 1, 5, 3, true)
+	assert.False(t, allowed)
+	assert.InDelta(t, 2.0, remaining, 0.1)
+	assert.InDelta(t, time.Second.Seconds(), wait.Seconds(), 0.1)
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	now := time.Now()
+	bucket := &tokenBucket{rate: 2, burst: 10, tokens: 0, updateTime: now}
+
+	bucket.refill(now.Add(2 * time.Second))
+	assert.Equal(t, 4.0, bucket.tokens)
+	assert.Equal(t, 500*time.Millisecond, bucket.wait(5))
+
+	bucket.refill(now.Add(time.Minute))
+	assert.Equal(t, 10.0, bucket.tokens)
+	assert.Equal(t, time.Duration(0), bucket.wait(10))
+}
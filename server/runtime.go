@@ -17,6 +17,7 @@ package server
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
@@ -228,6 +229,14 @@ type (
 
 	RuntimeStorageIndexFilterFunction func(ctx context.Context, write *StorageOpWrite) (bool, error)
 
+	RuntimeBeforeAccountMergeFunction func(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code)
+	RuntimeBeforeTradeFunction        func(ctx context.Context, userID, action string, trade *Trade) (error, codes.Code)
+	RuntimeAfterTradeFunction         func(ctx context.Context, userID, action string, trade *Trade) error
+	RuntimeBeforeOIDCFunction         func(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code)
+	RuntimeAfterOIDCFunction          func(ctx context.Context, userID, username, action string, request *OIDCRequest) error
+	RuntimeStorageExpiryFunction      func(ctx context.Context, objects []*api.StorageObject) error
+	RuntimeEmailTemplateFunction      func(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error)
+
 	RuntimeEventFunction func(ctx context.Context, logger runtime.Logger, evt *api.Event)
 
 	RuntimeEventCustomFunction       func(ctx context.Context, evt *api.Event)
@@ -255,6 +264,13 @@ const (
 	RuntimeExecutionModePurchaseNotificationGoogle
 	RuntimeExecutionModeSubscriptionNotificationGoogle
 	RuntimeExecutionModeStorageIndexFilter
+	RuntimeExecutionModeBeforeAccountMerge
+	RuntimeExecutionModeBeforeTrade
+	RuntimeExecutionModeAfterTrade
+	RuntimeExecutionModeStorageExpiry
+	RuntimeExecutionModeBeforeOIDC
+	RuntimeExecutionModeAfterOIDC
+	RuntimeExecutionModeEmailTemplate
 )
 
 func (e RuntimeExecutionMode) String() string {
@@ -293,6 +309,20 @@ func (e RuntimeExecutionMode) String() string {
 		return "subscription_notification_google"
 	case RuntimeExecutionModeStorageIndexFilter:
 		return "storage_index_filter"
+	case RuntimeExecutionModeBeforeAccountMerge:
+		return "before_account_merge"
+	case RuntimeExecutionModeBeforeTrade:
+		return "before_trade"
+	case RuntimeExecutionModeAfterTrade:
+		return "after_trade"
+	case RuntimeExecutionModeStorageExpiry:
+		return "storage_expiry"
+	case RuntimeExecutionModeBeforeOIDC:
+		return "before_oidc"
+	case RuntimeExecutionModeAfterOIDC:
+		return "after_oidc"
+	case RuntimeExecutionModeEmailTemplate:
+		return "email_template"
 	}
 
 	return ""
@@ -315,6 +345,39 @@ type RuntimeMatchCore interface {
 	Cleanup()
 }
 
+// Runtime functions called around server features rather than API requests.
+type RuntimeServerHookFunctions struct {
+	beforeAccountMergeFunction RuntimeBeforeAccountMergeFunction
+	beforeTradeFunction        RuntimeBeforeTradeFunction
+	afterTradeFunction         RuntimeAfterTradeFunction
+	storageExpiryFunction      RuntimeStorageExpiryFunction
+	beforeOIDCFunction         RuntimeBeforeOIDCFunction
+	afterOIDCFunction          RuntimeAfterOIDCFunction
+	emailTemplateFunction      RuntimeEmailTemplateFunction
+}
+
+// Convert a value to a generic map through its JSON form, for passing to Lua and JavaScript runtime functions.
+func runtimeValueToMap(value interface{}) (map[string]interface{}, error) {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var valueMap map[string]interface{}
+	if err = json.Unmarshal(valueJSON, &valueMap); err != nil {
+		return nil, err
+	}
+	return valueMap, nil
+}
+
+// Convert a generic value returned by a Lua or JavaScript runtime function back through its JSON form.
+func runtimeValueFromMap(valueMap interface{}, value interface{}) error {
+	valueJSON, err := json.Marshal(valueMap)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(valueJSON, value)
+}
+
 type RuntimeEventFunctions struct {
 	sessionStartFunction RuntimeEventSessionStartFunction
 	sessionEndFunction   RuntimeEventSessionEndFunction
@@ -522,6 +585,10 @@ type Runtime struct {
 
 	storageIndexFilterFunctions map[string]RuntimeStorageIndexFilterFunction
 
+	serverHookFunctions *RuntimeServerHookFunctions
+
+	storeCatalog StoreCatalog
+
 	leaderboardResetFunction RuntimeLeaderboardResetFunction
 
 	eventFunctions *RuntimeEventFunctions
@@ -627,7 +694,7 @@ func CheckRuntime(logger *zap.Logger, config Config, version string) error {
 	return nil
 }
 
-func NewRuntime(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, storageIndex StorageIndex, fmCallbackHandler runtime.FmCallbackHandler) (*Runtime, *RuntimeInfo, error) {
+func NewRuntime(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy, fmCallbackHandler runtime.FmCallbackHandler) (*Runtime, *RuntimeInfo, error) {
 	runtimeConfig := config.GetRuntime()
 	startupLogger.Info("Initialising runtime", zap.String("path", runtimeConfig.Path))
 
@@ -642,19 +709,25 @@ func NewRuntime(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.
 
 	matchProvider := NewMatchProvider()
 
-	goModules, goRPCFns, goBeforeRtFns, goAfterRtFns, goBeforeReqFns, goAfterReqFns, goMatchmakerMatchedFn, goMatchmakerCustomMatchingFn, goTournamentEndFn, goTournamentResetFn, goLeaderboardResetFn, goPurchaseNotificationAppleFn, goSubscriptionNotificationAppleFn, goPurchaseNotificationGoogleFn, goSubscriptionNotificationGoogleFn, goIndexFilterFns, fleetManager, allEventFns, goMatchNamesListFn, err := NewRuntimeProviderGo(ctx, logger, startupLogger, db, protojsonMarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, storageIndex, runtimeConfig.Path, paths, eventQueue, matchProvider, fmCallbackHandler)
+	storeCatalog, err := NewLocalStoreCatalog(config.GetStore())
+	if err != nil {
+		logger.Error("Error loading store catalog.", zap.Error(err))
+		return nil, nil, err
+	}
+
+	goModules, goRPCFns, goBeforeRtFns, goAfterRtFns, goBeforeReqFns, goAfterReqFns, goMatchmakerMatchedFn, goMatchmakerCustomMatchingFn, goTournamentEndFn, goTournamentResetFn, goLeaderboardResetFn, goPurchaseNotificationAppleFn, goSubscriptionNotificationAppleFn, goPurchaseNotificationGoogleFn, goSubscriptionNotificationGoogleFn, goIndexFilterFns, goServerHookFns, fleetManager, allEventFns, goMatchNamesListFn, err := NewRuntimeProviderGo(ctx, logger, startupLogger, db, protojsonMarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy, runtimeConfig.Path, paths, eventQueue, matchProvider, fmCallbackHandler)
 	if err != nil {
 		startupLogger.Error("Error initialising Go runtime provider", zap.Error(err))
 		return nil, nil, err
 	}
 
-	luaModules, luaRPCFns, luaBeforeRtFns, luaAfterRtFns, luaBeforeReqFns, luaAfterReqFns, luaMatchmakerMatchedFn, luaTournamentEndFn, luaTournamentResetFn, luaLeaderboardResetFn, luaPurchaseNotificationAppleFn, luaSubscriptionNotificationAppleFn, luaPurchaseNotificationGoogleFn, luaSubscriptionNotificationGoogleFn, luaIndexFilterFns, err := NewRuntimeProviderLua(ctx, logger, startupLogger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, allEventFns.eventFunction, runtimeConfig.Path, paths, matchProvider, storageIndex)
+	luaModules, luaRPCFns, luaBeforeRtFns, luaAfterRtFns, luaBeforeReqFns, luaAfterReqFns, luaMatchmakerMatchedFn, luaTournamentEndFn, luaTournamentResetFn, luaLeaderboardResetFn, luaPurchaseNotificationAppleFn, luaSubscriptionNotificationAppleFn, luaPurchaseNotificationGoogleFn, luaSubscriptionNotificationGoogleFn, luaIndexFilterFns, luaServerHookFns, err := NewRuntimeProviderLua(ctx, logger, startupLogger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, allEventFns.eventFunction, runtimeConfig.Path, paths, matchProvider, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy)
 	if err != nil {
 		startupLogger.Error("Error initialising Lua runtime provider", zap.Error(err))
 		return nil, nil, err
 	}
 
-	jsModules, jsRPCFns, jsBeforeRtFns, jsAfterRtFns, jsBeforeReqFns, jsAfterReqFns, jsMatchmakerMatchedFn, jsTournamentEndFn, jsTournamentResetFn, jsLeaderboardResetFn, jsPurchaseNotificationAppleFn, jsSubscriptionNotificationAppleFn, jsPurchaseNotificationGoogleFn, jsSubscriptionNotificationGoogleFn, jsIndexFilterFns, err := NewRuntimeProviderJS(ctx, logger, startupLogger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, allEventFns.eventFunction, runtimeConfig.Path, runtimeConfig.JsEntrypoint, matchProvider, storageIndex)
+	jsModules, jsRPCFns, jsBeforeRtFns, jsAfterRtFns, jsBeforeReqFns, jsAfterReqFns, jsMatchmakerMatchedFn, jsTournamentEndFn, jsTournamentResetFn, jsLeaderboardResetFn, jsPurchaseNotificationAppleFn, jsSubscriptionNotificationAppleFn, jsPurchaseNotificationGoogleFn, jsSubscriptionNotificationGoogleFn, jsIndexFilterFns, jsServerHookFns, err := NewRuntimeProviderJS(ctx, logger, startupLogger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, allEventFns.eventFunction, runtimeConfig.Path, runtimeConfig.JsEntrypoint, matchProvider, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy)
 	if err != nil {
 		startupLogger.Error("Error initialising JavaScript runtime provider", zap.Error(err))
 		return nil, nil, err
@@ -677,6 +750,14 @@ func NewRuntime(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.
 		startupLogger.Info("Registered event function invocation", zap.String("id", "session_end"))
 	}
 
+	// Storage subscriptions are handled by the server under reserved RPC IDs.
+	for _, fns := range []map[string]RuntimeRpcFunction{goRPCFns, luaRPCFns, jsRPCFns} {
+		if err = storageRpcIdsReserved(fns); err != nil {
+			startupLogger.Error("Error registering RPC functions", zap.Error(err))
+			return nil, nil, err
+		}
+	}
+
 	allRPCFunctions := make(map[string]RuntimeRpcFunction, len(goRPCFns)+len(luaRPCFns)+len(jsRPCFns))
 	jsRpcIDs := make(map[string]bool, len(jsRPCFns))
 	for id, fn := range jsRPCFns {
@@ -2604,6 +2685,85 @@ func NewRuntime(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.
 		startupLogger.Info("Registered Go runtime storage index filter function invocation", zap.String("index_name", id))
 	}
 
+	allServerHookFunctions := &RuntimeServerHookFunctions{}
+	switch {
+	case goServerHookFns.beforeAccountMergeFunction != nil:
+		allServerHookFunctions.beforeAccountMergeFunction = goServerHookFns.beforeAccountMergeFunction
+		startupLogger.Info("Registered Go runtime Before Account Merge function invocation")
+	case luaServerHookFns.beforeAccountMergeFunction != nil:
+		allServerHookFunctions.beforeAccountMergeFunction = luaServerHookFns.beforeAccountMergeFunction
+		startupLogger.Info("Registered Lua runtime Before Account Merge function invocation")
+	case jsServerHookFns.beforeAccountMergeFunction != nil:
+		allServerHookFunctions.beforeAccountMergeFunction = jsServerHookFns.beforeAccountMergeFunction
+		startupLogger.Info("Registered JavaScript runtime Before Account Merge function invocation")
+	}
+	switch {
+	case goServerHookFns.beforeTradeFunction != nil:
+		allServerHookFunctions.beforeTradeFunction = goServerHookFns.beforeTradeFunction
+		startupLogger.Info("Registered Go runtime Before Trade function invocation")
+	case luaServerHookFns.beforeTradeFunction != nil:
+		allServerHookFunctions.beforeTradeFunction = luaServerHookFns.beforeTradeFunction
+		startupLogger.Info("Registered Lua runtime Before Trade function invocation")
+	case jsServerHookFns.beforeTradeFunction != nil:
+		allServerHookFunctions.beforeTradeFunction = jsServerHookFns.beforeTradeFunction
+		startupLogger.Info("Registered JavaScript runtime Before Trade function invocation")
+	}
+	switch {
+	case goServerHookFns.afterTradeFunction != nil:
+		allServerHookFunctions.afterTradeFunction = goServerHookFns.afterTradeFunction
+		startupLogger.Info("Registered Go runtime After Trade function invocation")
+	case luaServerHookFns.afterTradeFunction != nil:
+		allServerHookFunctions.afterTradeFunction = luaServerHookFns.afterTradeFunction
+		startupLogger.Info("Registered Lua runtime After Trade function invocation")
+	case jsServerHookFns.afterTradeFunction != nil:
+		allServerHookFunctions.afterTradeFunction = jsServerHookFns.afterTradeFunction
+		startupLogger.Info("Registered JavaScript runtime After Trade function invocation")
+	}
+	switch {
+	case goServerHookFns.storageExpiryFunction != nil:
+		allServerHookFunctions.storageExpiryFunction = goServerHookFns.storageExpiryFunction
+		startupLogger.Info("Registered Go runtime Storage Expiry function invocation")
+	case luaServerHookFns.storageExpiryFunction != nil:
+		allServerHookFunctions.storageExpiryFunction = luaServerHookFns.storageExpiryFunction
+		startupLogger.Info("Registered Lua runtime Storage Expiry function invocation")
+	case jsServerHookFns.storageExpiryFunction != nil:
+		allServerHookFunctions.storageExpiryFunction = jsServerHookFns.storageExpiryFunction
+		startupLogger.Info("Registered JavaScript runtime Storage Expiry function invocation")
+	}
+	switch {
+	case goServerHookFns.beforeOIDCFunction != nil:
+		allServerHookFunctions.beforeOIDCFunction = goServerHookFns.beforeOIDCFunction
+		startupLogger.Info("Registered Go runtime Before OIDC function invocation")
+	case luaServerHookFns.beforeOIDCFunction != nil:
+		allServerHookFunctions.beforeOIDCFunction = luaServerHookFns.beforeOIDCFunction
+		startupLogger.Info("Registered Lua runtime Before OIDC function invocation")
+	case jsServerHookFns.beforeOIDCFunction != nil:
+		allServerHookFunctions.beforeOIDCFunction = jsServerHookFns.beforeOIDCFunction
+		startupLogger.Info("Registered JavaScript runtime Before OIDC function invocation")
+	}
+	switch {
+	case goServerHookFns.afterOIDCFunction != nil:
+		allServerHookFunctions.afterOIDCFunction = goServerHookFns.afterOIDCFunction
+		startupLogger.Info("Registered Go runtime After OIDC function invocation")
+	case luaServerHookFns.afterOIDCFunction != nil:
+		allServerHookFunctions.afterOIDCFunction = luaServerHookFns.afterOIDCFunction
+		startupLogger.Info("Registered Lua runtime After OIDC function invocation")
+	case jsServerHookFns.afterOIDCFunction != nil:
+		allServerHookFunctions.afterOIDCFunction = jsServerHookFns.afterOIDCFunction
+		startupLogger.Info("Registered JavaScript runtime After OIDC function invocation")
+	}
+	switch {
+	case goServerHookFns.emailTemplateFunction != nil:
+		allServerHookFunctions.emailTemplateFunction = goServerHookFns.emailTemplateFunction
+		startupLogger.Info("Registered Go runtime Email Template function invocation")
+	case luaServerHookFns.emailTemplateFunction != nil:
+		allServerHookFunctions.emailTemplateFunction = luaServerHookFns.emailTemplateFunction
+		startupLogger.Info("Registered Lua runtime Email Template function invocation")
+	case jsServerHookFns.emailTemplateFunction != nil:
+		allServerHookFunctions.emailTemplateFunction = jsServerHookFns.emailTemplateFunction
+		startupLogger.Info("Registered JavaScript runtime Email Template function invocation")
+	}
+
 	// Lua matches are not registered the same, list only Go ones.
 	goMatchNames := goMatchNamesListFn()
 	for _, name := range goMatchNames {
@@ -2634,6 +2794,10 @@ func NewRuntime(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.
 		subscriptionNotificationGoogleFunction: allSubscriptionNotificationGoogleFunction,
 		storageIndexFilterFunctions:            allStorageIndexFilterFunctions,
 
+		serverHookFunctions: allServerHookFunctions,
+
+		storeCatalog: storeCatalog,
+
 		fleetManager: fleetManager,
 
 		eventFunctions: allEventFns,
@@ -3382,6 +3546,38 @@ func (r *Runtime) StorageIndexFilterFunction(indexName string) RuntimeStorageInd
 	return r.storageIndexFilterFunctions[indexName]
 }
 
+func (r *Runtime) BeforeAccountMerge() RuntimeBeforeAccountMergeFunction {
+	return r.serverHookFunctions.beforeAccountMergeFunction
+}
+
+func (r *Runtime) BeforeTrade() RuntimeBeforeTradeFunction {
+	return r.serverHookFunctions.beforeTradeFunction
+}
+
+func (r *Runtime) AfterTrade() RuntimeAfterTradeFunction {
+	return r.serverHookFunctions.afterTradeFunction
+}
+
+func (r *Runtime) BeforeOIDC() RuntimeBeforeOIDCFunction {
+	return r.serverHookFunctions.beforeOIDCFunction
+}
+
+func (r *Runtime) AfterOIDC() RuntimeAfterOIDCFunction {
+	return r.serverHookFunctions.afterOIDCFunction
+}
+
+func (r *Runtime) EmailTemplate() RuntimeEmailTemplateFunction {
+	return r.serverHookFunctions.emailTemplateFunction
+}
+
+func (r *Runtime) StorageExpiry() RuntimeStorageExpiryFunction {
+	return r.serverHookFunctions.storageExpiryFunction
+}
+
+func (r *Runtime) StoreCatalog() StoreCatalog {
+	return r.storeCatalog
+}
+
 func (r *Runtime) SubscriptionNotificationGoogle() RuntimeSubscriptionNotificationGoogleFunction {
 	return r.subscriptionNotificationGoogleFunction
 }
@@ -61,6 +61,7 @@ type RuntimeGoInitializer struct {
 	subscriptionNotificationGoogle RuntimeSubscriptionNotificationGoogleFunction
 	matchmakerOverride             RuntimeMatchmakerOverrideFunction
 	storageIndexFunctions          map[string]RuntimeStorageIndexFilterFunction
+	serverHooks                    *RuntimeServerHookFunctions
 
 	fleetManager runtime.FleetManager
 
@@ -70,6 +71,9 @@ type RuntimeGoInitializer struct {
 
 	storageIndex StorageIndex
 
+	storageCollections StorageCollectionRegistry
+	storeCatalog       StoreCatalog
+
 	match     map[string]func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error)
 	matchLock *sync.RWMutex
 
@@ -2607,6 +2611,27 @@ func (ri *RuntimeGoInitializer) RegisterStorageIndex(name, collection, key strin
 	return ri.storageIndex.CreateIndex(context.Background(), name, collection, key, fields, maxEntries, indexOnly)
 }
 
+// RegisterStorageCollectionRules sets rules enforced on every write to a storage collection: a JSON Schema object values
+// must match, a maximum value size in bytes and number of objects per user, and the permission values writes may set.
+// Empty or zero values are not enforced. Schemas support the type, enum, const, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength, pattern, items, minItems, maxItems, uniqueItems, properties, required, additionalProperties, minProperties, maxProperties, allOf, anyOf, oneOf and not keywords.
+// Other keywords are ignored, and references are not supported.
+func (ri *RuntimeGoInitializer) RegisterStorageCollectionRules(collection, schema string, maxValueSizeBytes, maxObjectsPerUser int, permissionRead, permissionWrite []int) error {
+	return ri.storageCollections.RegisterCollectionRules(&StorageCollectionRulesConfig{
+		Collection:        collection,
+		Schema:            schema,
+		MaxValueSizeBytes: maxValueSizeBytes,
+		MaxObjectsPerUser: maxObjectsPerUser,
+		PermissionRead:    permissionRead,
+		PermissionWrite:   permissionWrite,
+	})
+}
+
+// RegisterStoreProduct adds a product to the store catalog, in addition to those in the server config. Its grants
+// are given to users who buy it with virtual currency, or whose validated in-app purchases match it.
+func (ri *RuntimeGoInitializer) RegisterStoreProduct(product *StoreProductConfig) error {
+	return ri.storeCatalog.RegisterProduct(product)
+}
+
 func (ri *RuntimeGoInitializer) RegisterStorageIndexFilter(indexName string, fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, write *runtime.StorageWrite) bool) error {
 	ri.storageIndexFunctions[indexName] = func(ctx context.Context, write *StorageOpWrite) (bool, error) {
 		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeStorageIndexFilter, nil, nil, 0, "", "", nil, "", "", "", "")
@@ -2626,6 +2651,85 @@ func (ri *RuntimeGoInitializer) RegisterStorageIndexFilter(indexName string, fn
 	return nil
 }
 
+// RegisterBeforeAccountMerge sets a function called before a player initiated account merge, with the default merge
+// policy. It may return an adjusted policy, or an error to reject the merge.
+func (ri *RuntimeGoInitializer) RegisterBeforeAccountMerge(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, policy *AccountMergePolicy) (*AccountMergePolicy, error)) error {
+	ri.serverHooks.beforeAccountMergeFunction = func(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeBeforeAccountMerge, nil, nil, 0, userID, username, nil, "", "", "", "")
+		result, fnErr := fn(ctx, ri.logger.WithField("mode", RuntimeExecutionModeBeforeAccountMerge.String()), ri.db, ri.nk, policy)
+		if fnErr != nil {
+			return nil, fnErr, runtimeGoErrorCode(fnErr)
+		}
+		return result, nil, codes.OK
+	}
+	return nil
+}
+
+// RegisterBeforeTrade sets a function called before each trade action with the trade as it would be after the action.
+// Returning an error rejects the action.
+func (ri *RuntimeGoInitializer) RegisterBeforeTrade(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, action string, trade *Trade) error) error {
+	ri.serverHooks.beforeTradeFunction = func(ctx context.Context, userID, action string, trade *Trade) (error, codes.Code) {
+		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeBeforeTrade, nil, nil, 0, userID, "", nil, "", "", "", "")
+		if fnErr := fn(ctx, ri.logger.WithField("mode", RuntimeExecutionModeBeforeTrade.String()), ri.db, ri.nk, action, trade); fnErr != nil {
+			return fnErr, runtimeGoErrorCode(fnErr)
+		}
+		return nil, codes.OK
+	}
+	return nil
+}
+
+// RegisterAfterTrade sets a function called after each trade action, including expiry by the server.
+func (ri *RuntimeGoInitializer) RegisterAfterTrade(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, action string, trade *Trade) error) error {
+	ri.serverHooks.afterTradeFunction = func(ctx context.Context, userID, action string, trade *Trade) error {
+		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeAfterTrade, nil, nil, 0, userID, "", nil, "", "", "", "")
+		return fn(ctx, ri.logger.WithField("mode", RuntimeExecutionModeAfterTrade.String()), ri.db, ri.nk, action, trade)
+	}
+	return nil
+}
+
+// RegisterBeforeOIDC sets a function called before each OpenID Connect authenticate, link or unlink request, with the
+// action name. It may return an adjusted request, or an error to reject it.
+func (ri *RuntimeGoInitializer) RegisterBeforeOIDC(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, action string, request *OIDCRequest) (*OIDCRequest, error)) error {
+	ri.serverHooks.beforeOIDCFunction = func(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeBeforeOIDC, nil, nil, 0, userID, username, request.Vars, "", "", "", "")
+		result, fnErr := fn(ctx, ri.logger.WithField("mode", RuntimeExecutionModeBeforeOIDC.String()), ri.db, ri.nk, action, request)
+		if fnErr != nil {
+			return nil, fnErr, runtimeGoErrorCode(fnErr)
+		}
+		return result, nil, codes.OK
+	}
+	return nil
+}
+
+// RegisterAfterOIDC sets a function called after each successful OpenID Connect authenticate, link or unlink request.
+func (ri *RuntimeGoInitializer) RegisterAfterOIDC(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, action string, request *OIDCRequest) error) error {
+	ri.serverHooks.afterOIDCFunction = func(ctx context.Context, userID, username, action string, request *OIDCRequest) error {
+		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeAfterOIDC, nil, nil, 0, userID, username, request.Vars, "", "", "", "")
+		return fn(ctx, ri.logger.WithField("mode", RuntimeExecutionModeAfterOIDC.String()), ri.db, ri.nk, action, request)
+	}
+	return nil
+}
+
+// RegisterEmailTemplate sets a function that renders verification, password reset and email change emails. It is
+// called with the recipient's user ID and username in the context, and may return a nil template, or leave fields
+// empty, to keep the built-in content.
+func (ri *RuntimeGoInitializer) RegisterEmailTemplate(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, request *EmailTemplateRequest) (*EmailTemplate, error)) error {
+	ri.serverHooks.emailTemplateFunction = func(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error) {
+		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeEmailTemplate, nil, nil, 0, userID, username, nil, "", "", "", "")
+		return fn(ctx, ri.logger.WithField("mode", RuntimeExecutionModeEmailTemplate.String()), ri.db, ri.nk, request)
+	}
+	return nil
+}
+
+// RegisterStorageExpiry sets a function called with each batch of expired storage objects deleted by the server.
+func (ri *RuntimeGoInitializer) RegisterStorageExpiry(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, objects []*api.StorageObject) error) error {
+	ri.serverHooks.storageExpiryFunction = func(ctx context.Context, objects []*api.StorageObject) error {
+		ctx = NewRuntimeGoContext(ctx, ri.node, ri.version, ri.env, RuntimeExecutionModeStorageExpiry, nil, nil, 0, "", "", nil, "", "", "", "")
+		return fn(ctx, ri.logger.WithField("mode", RuntimeExecutionModeStorageExpiry.String()), ri.db, ri.nk, objects)
+	}
+	return nil
+}
+
 func (ri *RuntimeGoInitializer) RegisterFleetManager(fleetManager runtime.FleetManagerInitializer) error {
 	if fleetManager == nil {
 		return errors.New("fleet manager cannot be nil")
@@ -2648,12 +2752,20 @@ func (ri *RuntimeGoInitializer) RegisterMatch(name string, fn func(ctx context.C
 	return nil
 }
 
-func NewRuntimeProviderGo(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, storageIndex StorageIndex, rootPath string, paths []string, eventQueue *RuntimeEventQueue, matchProvider *MatchProvider, fmCallbackHandler runtime.FmCallbackHandler) ([]string, map[string]RuntimeRpcFunction, map[string]RuntimeBeforeRtFunction, map[string]RuntimeAfterRtFunction, *RuntimeBeforeReqFunctions, *RuntimeAfterReqFunctions, RuntimeMatchmakerMatchedFunction, RuntimeMatchmakerOverrideFunction, RuntimeTournamentEndFunction, RuntimeTournamentResetFunction, RuntimeLeaderboardResetFunction, RuntimePurchaseNotificationAppleFunction, RuntimeSubscriptionNotificationAppleFunction, RuntimePurchaseNotificationGoogleFunction, RuntimeSubscriptionNotificationGoogleFunction, map[string]RuntimeStorageIndexFilterFunction, runtime.FleetManager, *RuntimeEventFunctions, func() []string, error) {
+// The status code carried by an error returned from a Go runtime function, Internal if it doesn't carry a valid one.
+func runtimeGoErrorCode(err error) codes.Code {
+	if runtimeErr, ok := err.(*runtime.Error); ok && runtimeErr.Code > 0 && runtimeErr.Code < 17 {
+		return codes.Code(runtimeErr.Code)
+	}
+	return codes.Internal
+}
+
+func NewRuntimeProviderGo(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy, rootPath string, paths []string, eventQueue *RuntimeEventQueue, matchProvider *MatchProvider, fmCallbackHandler runtime.FmCallbackHandler) ([]string, map[string]RuntimeRpcFunction, map[string]RuntimeBeforeRtFunction, map[string]RuntimeAfterRtFunction, *RuntimeBeforeReqFunctions, *RuntimeAfterReqFunctions, RuntimeMatchmakerMatchedFunction, RuntimeMatchmakerOverrideFunction, RuntimeTournamentEndFunction, RuntimeTournamentResetFunction, RuntimeLeaderboardResetFunction, RuntimePurchaseNotificationAppleFunction, RuntimeSubscriptionNotificationAppleFunction, RuntimePurchaseNotificationGoogleFunction, RuntimeSubscriptionNotificationGoogleFunction, map[string]RuntimeStorageIndexFilterFunction, *RuntimeServerHookFunctions, runtime.FleetManager, *RuntimeEventFunctions, func() []string, error) {
 	runtimeLogger := NewRuntimeGoLogger(logger)
 	node := config.GetName()
 	env := config.GetRuntime().Environment
 
-	nk := NewRuntimeGoNakamaModule(logger, db, protojsonMarshaler, config, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, storageIndex)
+	nk := NewRuntimeGoNakamaModule(logger, db, protojsonMarshaler, config, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy)
 
 	match := make(map[string]func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error), 0)
 
@@ -2706,7 +2818,10 @@ func NewRuntimeProviderGo(ctx context.Context, logger, startupLogger *zap.Logger
 		afterReq:  &RuntimeAfterReqFunctions{},
 
 		storageIndexFunctions: make(map[string]RuntimeStorageIndexFilterFunction, 0),
+		serverHooks:           &RuntimeServerHookFunctions{},
 		storageIndex:          storageIndex,
+		storageCollections:    storageCollections,
+		storeCatalog:          storeCatalog,
 
 		eventFunctions:        make([]RuntimeEventFunction, 0),
 		sessionStartFunctions: make([]RuntimeEventFunction, 0),
@@ -2734,13 +2849,13 @@ func NewRuntimeProviderGo(ctx context.Context, logger, startupLogger *zap.Logger
 		relPath, name, fn, err := openGoModule(startupLogger, rootPath, path)
 		if err != nil {
 			// Errors are already logged in the function above.
-			return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
 		}
 
 		// Run the initialisation.
 		if err = fn(ctx, runtimeLogger, db, nk, initializer); err != nil {
 			startupLogger.Fatal("Error returned by InitModule function in Go module", zap.String("name", name), zap.Error(err))
-			return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, errors.New("error returned by InitModule function in Go module")
+			return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, errors.New("error returned by InitModule function in Go module")
 		}
 		modulePaths = append(modulePaths, relPath)
 	}
@@ -2788,7 +2903,7 @@ func NewRuntimeProviderGo(ctx context.Context, logger, startupLogger *zap.Logger
 		}
 	}
 
-	return modulePaths, initializer.rpc, initializer.beforeRt, initializer.afterRt, initializer.beforeReq, initializer.afterReq, initializer.matchmakerMatched, initializer.matchmakerOverride, initializer.tournamentEnd, initializer.tournamentReset, initializer.leaderboardReset, initializer.purchaseNotificationApple, initializer.subscriptionNotificationApple, initializer.purchaseNotificationGoogle, initializer.subscriptionNotificationGoogle, initializer.storageIndexFunctions, initializer.fleetManager, events, matchNamesListFn, nil
+	return modulePaths, initializer.rpc, initializer.beforeRt, initializer.afterRt, initializer.beforeReq, initializer.afterReq, initializer.matchmakerMatched, initializer.matchmakerOverride, initializer.tournamentEnd, initializer.tournamentReset, initializer.leaderboardReset, initializer.purchaseNotificationApple, initializer.subscriptionNotificationApple, initializer.purchaseNotificationGoogle, initializer.subscriptionNotificationGoogle, initializer.storageIndexFunctions, initializer.serverHooks, initializer.fleetManager, events, matchNamesListFn, nil
 }
 
 func CheckRuntimeProviderGo(logger *zap.Logger, rootPath string, paths []string) error {
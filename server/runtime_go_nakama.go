@@ -32,6 +32,7 @@ import (
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/rtapi"
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/heroiclabs/nakama/v3/iap"
 	"github.com/heroiclabs/nakama/v3/internal/cronexpr"
 	"github.com/heroiclabs/nakama/v3/internal/satori"
 	"github.com/heroiclabs/nakama/v3/social"
@@ -65,9 +66,14 @@ type RuntimeGoNakamaModule struct {
 	satori               runtime.Satori
 	fleetManager         runtime.FleetManager
 	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	storeCatalog         StoreCatalog
+	groupIndex           GroupIndex
+	rateLimiter          RateLimiter
+	namePolicy           NamePolicy
 }
 
-func NewRuntimeGoNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, config Config, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, storageIndex StorageIndex) *RuntimeGoNakamaModule {
+func NewRuntimeGoNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, config Config, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy) *RuntimeGoNakamaModule {
 	return &RuntimeGoNakamaModule{
 		logger:               logger,
 		db:                   db,
@@ -86,6 +92,11 @@ func NewRuntimeGoNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshaler
 		streamManager:        streamManager,
 		router:               router,
 		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		storeCatalog:         storeCatalog,
+		groupIndex:           groupIndex,
+		rateLimiter:          rateLimiter,
+		namePolicy:           namePolicy,
 
 		node: config.GetName(),
 
@@ -120,7 +131,7 @@ func (n *RuntimeGoNakamaModule) AuthenticateApple(ctx context.Context, token, us
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	return AuthenticateApple(ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().Apple.BundleId, token, username, create)
+	return AuthenticateApple(ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().Apple.BundleId, token, username, create)
 }
 
 // @group authenticate
@@ -150,7 +161,7 @@ func (n *RuntimeGoNakamaModule) AuthenticateCustom(ctx context.Context, id, user
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	return AuthenticateCustom(ctx, n.logger, n.db, id, username, create)
+	return AuthenticateCustom(ctx, n.logger, n.db, nil, id, username, create)
 }
 
 // @group authenticate
@@ -180,7 +191,7 @@ func (n *RuntimeGoNakamaModule) AuthenticateDevice(ctx context.Context, id, user
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	return AuthenticateDevice(ctx, n.logger, n.db, id, username, create)
+	return AuthenticateDevice(ctx, n.logger, n.db, nil, id, username, create)
 }
 
 // @group authenticate
@@ -225,13 +236,13 @@ func (n *RuntimeGoNakamaModule) AuthenticateEmail(ctx context.Context, email, pa
 	}
 
 	if attemptUsernameLogin {
-		dbUserID, err := AuthenticateUsername(ctx, n.logger, n.db, username, password)
+		dbUserID, err := AuthenticateUsername(ctx, n.logger, n.db, n.config, username, password)
 		return dbUserID, username, false, err
 	}
 
 	cleanEmail := strings.ToLower(email)
 
-	return AuthenticateEmail(ctx, n.logger, n.db, cleanEmail, password, username, create)
+	return AuthenticateEmail(ctx, n.logger, n.db, n.config, nil, cleanEmail, password, username, create)
 }
 
 // @group authenticate
@@ -258,7 +269,7 @@ func (n *RuntimeGoNakamaModule) AuthenticateFacebook(ctx context.Context, token
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().FacebookLimitedLogin.AppId, token, username, create)
+	dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().FacebookLimitedLogin.AppId, token, username, create)
 	if err == nil && importFriends && importFriendsPossible {
 		// Errors are logged before this point and failure here does not invalidate the whole operation.
 		_ = importFacebookFriends(ctx, n.logger, n.db, n.tracker, n.router, n.socialClient, uuid.FromStringOrNil(dbUserID), dbUsername, token, false)
@@ -290,7 +301,7 @@ func (n *RuntimeGoNakamaModule) AuthenticateFacebookInstantGame(ctx context.Cont
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	return AuthenticateFacebookInstantGame(ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().FacebookInstantGame.AppSecret, signedPlayerInfo, username, create)
+	return AuthenticateFacebookInstantGame(ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().FacebookInstantGame.AppSecret, signedPlayerInfo, username, create)
 }
 
 // @group authenticate
@@ -336,7 +347,7 @@ func (n *RuntimeGoNakamaModule) AuthenticateGameCenter(ctx context.Context, play
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	return AuthenticateGameCenter(ctx, n.logger, n.db, n.socialClient, playerID, bundleID, timestamp, salt, signature, publicKeyUrl, username, create)
+	return AuthenticateGameCenter(ctx, n.logger, n.db, n.socialClient, nil, playerID, bundleID, timestamp, salt, signature, publicKeyUrl, username, create)
 }
 
 // @group authenticate
@@ -362,7 +373,7 @@ func (n *RuntimeGoNakamaModule) AuthenticateGoogle(ctx context.Context, token, u
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	return AuthenticateGoogle(ctx, n.logger, n.db, n.socialClient, token, username, create)
+	return AuthenticateGoogle(ctx, n.logger, n.db, n.socialClient, nil, token, username, create)
 }
 
 // @group authenticate
@@ -392,11 +403,43 @@ func (n *RuntimeGoNakamaModule) AuthenticateSteam(ctx context.Context, token, us
 		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
 	}
 
-	userID, username, _, created, err := AuthenticateSteam(ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().Steam.AppID, n.config.GetSocial().Steam.PublisherKey, token, username, create)
+	userID, username, _, created, err := AuthenticateSteam(ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().Steam.AppID, n.config.GetSocial().Steam.PublisherKey, token, username, create)
 
 	return userID, username, created, err
 }
 
+// @group authenticate
+// @summary Authenticate user and create a session token using an ID token issued by a configured OpenID Connect provider.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string) ID token issued by the provider.
+// @param username(type=string, optional=true) The user's username. If left empty, one is generated.
+// @param create(type=bool, optional=true, default=true) Create user if one didn't exist previously.
+// @return userID(string) The user ID of the authenticated user.
+// @return username(string) The username of the authenticated user.
+// @return create(bool) Value indicating if this account was just created or already existed.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) AuthenticateOIDC(ctx context.Context, provider, token, username string, create bool) (string, string, bool, error) {
+	oidcProvider, err := oidcProviderConfig(n.config, provider)
+	if err != nil {
+		return "", "", false, errors.New("OIDC provider is not configured")
+	}
+
+	if token == "" {
+		return "", "", false, errors.New("expects token string")
+	}
+
+	if username == "" {
+		username = generateUsername()
+	} else if invalidUsernameRegex.MatchString(username) {
+		return "", "", false, errors.New("expects username to be valid, no spaces or control characters allowed")
+	} else if len(username) > 128 {
+		return "", "", false, errors.New("expects id to be valid, must be 1-128 bytes")
+	}
+
+	return AuthenticateOIDC(ctx, n.logger, n.db, n.socialClient, nil, oidcProvider, token, username, create)
+}
+
 // @group authenticate
 // @summary Generate a Nakama session token from a user ID.
 // @param userId(type=string) User ID to use to generate the token.
@@ -426,6 +469,10 @@ func (n *RuntimeGoNakamaModule) AuthenticateTokenGenerate(userID, username strin
 
 	tokenId := uuid.Must(uuid.NewV4()).String()
 	token, exp := generateTokenWithExpiry(n.config.GetSession().EncryptionKey, tokenId, userID, username, vars, exp)
+	// Recorded so it can be listed and revoked like sessions issued by authentication.
+	if err = SessionRecord(context.Background(), n.logger, n.db, uid, tokenId, tokenId, vars, "", "", exp); err != nil {
+		return "", 0, err
+	}
 	n.sessionCache.Add(uid, exp, tokenId, 0, "")
 	return token, exp, nil
 }
@@ -542,7 +589,40 @@ func (n *RuntimeGoNakamaModule) AccountDeleteId(ctx context.Context, userID stri
 		return errors.New("expects user ID to be a valid identifier")
 	}
 
-	return DeleteAccount(ctx, n.logger, n.db, n.config, n.leaderboardCache, n.leaderboardRankCache, n.sessionRegistry, n.sessionCache, n.tracker, u, recorded)
+	return DeleteAccount(ctx, n.logger, n.db, n.config, n.metrics, n.leaderboardCache, n.leaderboardRankCache, n.storageIndex, n.storageCollections, n.groupIndex, n.sessionRegistry, n.sessionCache, n.tracker, n.router, u, recorded)
+}
+
+// @group accounts
+// @summary Merge a source account into a target account. Linked identities, friends, group memberships, storage objects, wallet balances and leaderboard records are moved to the target, then the source account is deleted.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param sourceUserId(type=string) User ID of the account merged and deleted. Must be valid UUID.
+// @param targetUserId(type=string) User ID of the account kept. Must be valid UUID.
+// @param storage(type=string, default="target") Which storage object is kept when both accounts have one with the same collection and key, "target" or "source".
+// @param leaderboard(type=string, default="best") Which leaderboard record is kept when both accounts have one, "best", "target" or "source".
+// @param wallet(type=string, default="sum") Whether the source wallet is added to the target wallet, "sum", or dropped, "target".
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) AccountsMerge(ctx context.Context, sourceUserID, targetUserID, storage, leaderboard, wallet string) error {
+	sourceID, err := uuid.FromString(sourceUserID)
+	if err != nil {
+		return errors.New("expects source user ID to be a valid identifier")
+	}
+	targetID, err := uuid.FromString(targetUserID)
+	if err != nil {
+		return errors.New("expects target user ID to be a valid identifier")
+	}
+
+	policy := NewAccountMergePolicy(sourceID, targetID)
+	if storage != "" {
+		policy.Storage = storage
+	}
+	if leaderboard != "" {
+		policy.Leaderboard = leaderboard
+	}
+	if wallet != "" {
+		policy.Wallet = wallet
+	}
+
+	return AccountMerge(ctx, n.logger, n.db, n.config, n.metrics, n.leaderboardCache, n.leaderboardRankCache, n.storageIndex, n.storageCollections, n.groupIndex, n.sessionRegistry, n.sessionCache, n.tracker, n.router, policy)
 }
 
 // @group accounts
@@ -740,7 +820,7 @@ func (n *RuntimeGoNakamaModule) LinkEmail(ctx context.Context, userID, email, pa
 		return errors.New("user ID must be a valid identifier")
 	}
 
-	return LinkEmail(ctx, n.logger, n.db, id, email, password)
+	return LinkEmail(ctx, n.logger, n.db, n.config, id, email, password)
 }
 
 // @group authenticate
@@ -827,6 +907,27 @@ func (n *RuntimeGoNakamaModule) LinkSteam(ctx context.Context, userID, username,
 	return LinkSteam(ctx, n.logger, n.db, n.config, n.socialClient, n.tracker, n.router, id, username, token, importFriends)
 }
 
+// @group authenticate
+// @summary Link an OpenID Connect provider identity to a user ID.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The user ID to be linked.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string) ID token issued by the provider.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LinkOIDC(ctx context.Context, userID, provider, token string) error {
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("user ID must be a valid identifier")
+	}
+
+	oidcProvider, err := oidcProviderConfig(n.config, provider)
+	if err != nil {
+		return errors.New("OIDC provider is not configured")
+	}
+
+	return LinkOIDC(ctx, n.logger, n.db, n.socialClient, oidcProvider, id, token)
+}
+
 // @group utils
 // @summary Parses a CRON expression and a timestamp in UTC seconds, and returns the next matching timestamp in UTC seconds.
 // @param expression(type=string) A valid CRON expression in standard format, for example "0 0 * * *" (meaning at midnight).
@@ -874,6 +975,67 @@ func (n *RuntimeGoNakamaModule) ReadFile(relPath string) (*os.File, error) {
 	return FileRead(n.config.GetRuntime().Path, relPath)
 }
 
+// @group utils
+// @summary Check whether a runtime defined rate limit bucket has enough tokens for a request, without consuming them.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param key(type=string) Bucket key, for example an operation name combined with a user ID.
+// @param rate(type=float64) Tokens added to the bucket per second.
+// @param burst(type=int) Maximum tokens the bucket holds, and the tokens in a new bucket.
+// @param cost(type=int) Tokens the request needs.
+// @return allowed(bool) True if the bucket has enough tokens.
+// @return remaining(float64) Tokens currently in the bucket.
+// @return retryAfterSec(int64) Seconds until the bucket would have enough tokens, 0 if it already has.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) RateLimitCheck(ctx context.Context, key string, rate float64, burst, cost int) (bool, float64, int64, error) {
+	return n.rateLimitTake(key, rate, burst, cost, false)
+}
+
+// @group utils
+// @summary Consume tokens from a runtime defined rate limit bucket if it has enough for a request.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param key(type=string) Bucket key, for example an operation name combined with a user ID.
+// @param rate(type=float64) Tokens added to the bucket per second.
+// @param burst(type=int) Maximum tokens the bucket holds, and the tokens in a new bucket.
+// @param cost(type=int) Tokens the request needs.
+// @return allowed(bool) True if the tokens were consumed.
+// @return remaining(float64) Tokens left in the bucket.
+// @return retryAfterSec(int64) Seconds until the bucket would have enough tokens, 0 if the tokens were consumed.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) RateLimitConsume(ctx context.Context, key string, rate float64, burst, cost int) (bool, float64, int64, error) {
+	return n.rateLimitTake(key, rate, burst, cost, true)
+}
+
+func (n *RuntimeGoNakamaModule) rateLimitTake(key string, rate float64, burst, cost int, consume bool) (bool, float64, int64, error) {
+	if key == "" {
+		return false, 0, 0, errors.New("expects key")
+	}
+	if rate <= 0 {
+		return false, 0, 0, errors.New("expects rate to be > 0")
+	}
+	if burst < 1 {
+		return false, 0, 0, errors.New("expects burst to be >= 1")
+	}
+	if cost < 1 || cost > burst {
+		return false, 0, 0, errors.New("expects cost to be >= 1 and <= burst")
+	}
+
+	allowed, remaining, wait := n.rateLimiter.Take(key, rate, burst, cost, consume)
+	return allowed, remaining, rateLimitRetryAfterSec(wait), nil
+}
+
+// @group utils
+// @summary Check a username, display name, group name or channel message against the configured name policy.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param field(type=string) What is checked, one of "username", "display_name", "group_name" or "channel_message".
+// @param value(type=string) The name or message to check.
+// @return error(error) A *server.NamePolicyViolation with the field, reason and value if the check fails, or another error value if an error occurred.
+func (n *RuntimeGoNakamaModule) NamePolicyCheck(ctx context.Context, field, value string) error {
+	if _, found := namePolicyFieldLabels[field]; !found {
+		return errors.New("expects field to be one of username, display_name, group_name or channel_message")
+	}
+	return n.namePolicy.Check(field, value)
+}
+
 // @group authenticate
 // @summary Unlink Apple authentication from a user ID.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
@@ -1014,6 +1176,42 @@ func (n *RuntimeGoNakamaModule) UnlinkSteam(ctx context.Context, userID, token s
 	return UnlinkSteam(ctx, n.logger, n.db, n.config, n.socialClient, id, token)
 }
 
+// @group authenticate
+// @summary Unlink an OpenID Connect provider identity from a user ID.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The user ID to be unlinked.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string, optional=true) ID token issued by the provider. If set, only unlinks the identity it belongs to.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) UnlinkOIDC(ctx context.Context, userID, provider, token string) error {
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("user ID must be a valid identifier")
+	}
+
+	oidcProvider, err := oidcProviderConfig(n.config, provider)
+	if err != nil {
+		return errors.New("OIDC provider is not configured")
+	}
+
+	return UnlinkOIDC(ctx, n.logger, n.db, n.socialClient, oidcProvider, id, token)
+}
+
+// @group authenticate
+// @summary List the OpenID Connect provider identities linked to a user ID.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The user ID to list identities for.
+// @return identities([]*UserIdentity) The linked provider names and provider user IDs.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) UserIdentitiesList(ctx context.Context, userID string) ([]*UserIdentity, error) {
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, errors.New("user ID must be a valid identifier")
+	}
+
+	return UserIdentitiesList(ctx, n.logger, n.db, id)
+}
+
 // @group streams
 // @summary List all users currently online and connected to a stream.
 // @param mode(type=uint8) The type of stream, '2' for a chat channel for example.
@@ -1508,6 +1706,74 @@ func (n *RuntimeGoNakamaModule) SessionLogout(userID, token, refreshToken string
 	return SessionLogout(n.config, n.sessionCache, uid, token, refreshToken)
 }
 
+// @group sessions
+// @summary List a user's active sessions, with the device and client address each was issued to.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The ID of the user to list sessions for.
+// @return sessions([]*UserSession) The user's sessions, most recently seen first.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) SessionsList(ctx context.Context, userID string) ([]*UserSession, error) {
+	uid, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, errors.New("expects valid user id")
+	}
+
+	return SessionsList(ctx, n.logger, n.db, n.sessionCache, uid)
+}
+
+// @group sessions
+// @summary Revoke one of a user's sessions, disconnecting any sockets opened with it.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The ID of the user the session belongs to.
+// @param sessionId(type=string) The ID of the session to revoke.
+// @param refreshOnly(type=bool) Only revoke the session's refresh token, leaving its current session token and sockets valid until they expire.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) SessionRevoke(ctx context.Context, userID, sessionID string, refreshOnly bool) error {
+	uid, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("expects valid user id")
+	}
+	if sessionID == "" {
+		return errors.New("expects session id")
+	}
+
+	return SessionRevoke(ctx, n.logger, n.db, n.config, n.sessionCache, n.sessionRegistry, n.tracker, uid, sessionID, refreshOnly)
+}
+
+// @group sessions
+// @summary Check whether a user has two-factor authentication enabled.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The ID of the user to check.
+// @return enabled(bool) True if the user has confirmed two-factor authentication enrolment.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) TotpEnabled(ctx context.Context, userID string) (bool, error) {
+	uid, err := uuid.FromString(userID)
+	if err != nil {
+		return false, errors.New("expects valid user id")
+	}
+
+	return TotpEnabled(ctx, n.logger, n.db, uid)
+}
+
+// @group sessions
+// @summary Verify a two-factor authentication code, for step-up checks before sensitive operations. Each code is accepted once and repeated failures lock the user out of verification for a few minutes.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The ID of the user to verify.
+// @param code(type=string) The code from the user's authenticator app.
+// @param allowRecovery(type=bool) Also accept, and consume, one of the user's recovery codes.
+// @return error(error) An error if the code is invalid or verification failed.
+func (n *RuntimeGoNakamaModule) TotpVerify(ctx context.Context, userID, code string, allowRecovery bool) error {
+	uid, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("expects valid user id")
+	}
+	if code == "" {
+		return errors.New("expects code")
+	}
+
+	return TotpVerify(ctx, n.logger, n.db, uid, code, allowRecovery)
+}
+
 // @group matches
 // @summary Create a new authoritative realtime multiplayer match running on the given runtime module name. The given params are passed to the match's init hook.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
@@ -1903,6 +2169,72 @@ func (n *RuntimeGoNakamaModule) WalletLedgerList(ctx context.Context, userID str
 	return runtimeItems, newCursor, nil
 }
 
+// @group wallets
+// @summary Take amounts from a user's wallet and hold them until the hold is captured or released, or expires and is released automatically.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The ID of the user whose wallet the amounts are taken from.
+// @param changeset(type=map[string]int64) The amounts to hold, by currency. Amounts must be greater than 0.
+// @param metadata(type=map[string]interface{}, optional=true) Metadata kept with the hold and recorded in its wallet ledger entries.
+// @param expirySec(type=int, optional=true, default=0) Seconds until the hold expires, or 0 for the configured default.
+// @return hold(*WalletHold) The created hold.
+// @return error(error) An optional error value if an error occurred, a *runtime.WalletNegativeError if the wallet does not have enough funds.
+func (n *RuntimeGoNakamaModule) WalletHold(ctx context.Context, userID string, changeset map[string]int64, metadata map[string]interface{}, expirySec int) (*WalletHold, error) {
+	uid, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, errors.New("expects a valid user id")
+	}
+
+	return WalletHoldCreate(ctx, n.logger, n.db, n.config, uid, changeset, metadata, expirySec)
+}
+
+// @group wallets
+// @summary Complete a wallet hold, keeping the given amounts and returning the rest of the hold to the wallet.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param holdId(type=string) The ID of the hold.
+// @param changeset(type=map[string]int64, optional=true) The amounts to keep, by currency, at most the held amounts. Nil keeps the whole hold.
+// @param metadata(type=map[string]interface{}, optional=true) Metadata recorded in the wallet ledger entry for the capture.
+// @return hold(*WalletHold) The captured hold.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) WalletHoldCapture(ctx context.Context, holdID string, changeset map[string]int64, metadata map[string]interface{}) (*WalletHold, error) {
+	id, err := uuid.FromString(holdID)
+	if err != nil {
+		return nil, errors.New("expects a valid hold id")
+	}
+
+	return WalletHoldCapture(ctx, n.logger, n.db, id, changeset, metadata)
+}
+
+// @group wallets
+// @summary Cancel a wallet hold, returning all of it to the wallet.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param holdId(type=string) The ID of the hold.
+// @param metadata(type=map[string]interface{}, optional=true) Metadata recorded in the wallet ledger entry for the release.
+// @return hold(*WalletHold) The released hold.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) WalletHoldRelease(ctx context.Context, holdID string, metadata map[string]interface{}) (*WalletHold, error) {
+	id, err := uuid.FromString(holdID)
+	if err != nil {
+		return nil, errors.New("expects a valid hold id")
+	}
+
+	return WalletHoldRelease(ctx, n.logger, n.db, id, metadata)
+}
+
+// @group wallets
+// @summary List the wallet holds of a user that are still held, oldest first.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The ID of the user to list holds for.
+// @return holds([]*WalletHold) The user's open holds.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) WalletHoldsList(ctx context.Context, userID string) ([]*WalletHold, error) {
+	uid, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, errors.New("expects a valid user id")
+	}
+
+	return WalletHoldsList(ctx, n.logger, n.db, uid)
+}
+
 // @group storage
 // @summary List records in a collection and page through results. The records returned can be filtered to those owned by the user or "" for public records.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
@@ -1996,6 +2328,41 @@ func (n *RuntimeGoNakamaModule) StorageRead(ctx context.Context, reads []*runtim
 // @return acks([]*api.StorageObjectAck) A list of acks with the version of the written objects.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeGoNakamaModule) StorageWrite(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	return n.StorageWriteTtl(ctx, writes, 0)
+}
+
+// @group storage
+// @summary Write one or more objects by their collection/keyname and optional user, expiring after a TTL. Expired objects are no longer returned, and are deleted in the background.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param objectIds(type=[]*runtime.StorageWrite) An array of object identifiers to be written.
+// @param ttlSec(type=int64) Seconds until the written objects expire, 0 for no expiry.
+// @return acks([]*api.StorageObjectAck) A list of acks with the version of the written objects.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) StorageWriteTtl(ctx context.Context, writes []*runtime.StorageWrite, ttlSec int64) ([]*api.StorageObjectAck, error) {
+	if ttlSec < 0 {
+		return nil, errors.New("expects ttl seconds to be >= 0")
+	}
+
+	return n.storageWrite(ctx, writes, ttlSec, "")
+}
+
+// @group storage
+// @summary Patch one or more objects by their collection/keyname and optional user. Each patch is applied to the existing value of an object, or to an empty object if it does not exist.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param objectIds(type=[]*runtime.StorageWrite) An array of object identifiers to be written, with patches as their values.
+// @param patch(type=string) The patch type, "merge" for JSON Merge Patch objects or "json" for arrays of JSON Patch operations, including "increment" and "append".
+// @return acks([]*api.StorageObjectAck) A list of acks with the version of the written objects.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) StorageWritePatch(ctx context.Context, writes []*runtime.StorageWrite, patch string) ([]*api.StorageObjectAck, error) {
+	if patch == "" || !storagePatchTypeValid(patch) {
+		return nil, errors.New("expects patch to be 'merge' or 'json'")
+	}
+
+	return n.storageWrite(ctx, writes, 0, patch)
+}
+
+func (n *RuntimeGoNakamaModule) storageWrite(ctx context.Context, writes []*runtime.StorageWrite, ttlSec int64, patch string) ([]*api.StorageObjectAck, error) {
+
 	size := len(writes)
 	if size == 0 {
 		return make([]*api.StorageObjectAck, 0), nil
@@ -2015,7 +2382,10 @@ func (n *RuntimeGoNakamaModule) StorageWrite(ctx context.Context, writes []*runt
 				return nil, errors.New("expects an empty or valid user id")
 			}
 		}
-		if maybeJSON := []byte(write.Value); !json.Valid(maybeJSON) || bytes.TrimSpace(maybeJSON)[0] != byteBracket {
+		if !storageWriteValueValid(patch, write.Value) {
+			if patch == StoragePatchJson {
+				return nil, errors.New("value must be a JSON-encoded array of patch operations")
+			}
 			return nil, errors.New("value must be a JSON-encoded object")
 		}
 
@@ -2028,6 +2398,8 @@ func (n *RuntimeGoNakamaModule) StorageWrite(ctx context.Context, writes []*runt
 				PermissionRead:  &wrapperspb.Int32Value{Value: int32(write.PermissionRead)},
 				PermissionWrite: &wrapperspb.Int32Value{Value: int32(write.PermissionWrite)},
 			},
+			TtlSec: ttlSec,
+			Patch:  patch,
 		}
 		if write.UserID == "" {
 			op.OwnerID = uuid.Nil.String()
@@ -2038,7 +2410,7 @@ func (n *RuntimeGoNakamaModule) StorageWrite(ctx context.Context, writes []*runt
 		ops = append(ops, op)
 	}
 
-	acks, _, err := StorageWriteObjects(ctx, n.logger, n.db, n.metrics, n.storageIndex, true, ops)
+	acks, _, err := StorageWriteObjects(ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, true, ops)
 	if err != nil {
 		return nil, err
 	}
@@ -2046,6 +2418,67 @@ func (n *RuntimeGoNakamaModule) StorageWrite(ctx context.Context, writes []*runt
 	return acks.Acks, nil
 }
 
+// @group storage
+// @summary List the kept previous versions of a storage object in a collection with history enabled, most recently replaced first.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param collection(type=string) The collection of the object.
+// @param key(type=string) The key of the object.
+// @param userId(type=string) The owner of the object, or empty for objects owned by the system.
+// @param limit(type=int) The maximum number of versions to return, between 1 and 100.
+// @return objects([]*api.StorageObject) The previous versions of the object.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) StorageHistoryList(ctx context.Context, collection, key, userID string, limit int) ([]*api.StorageObject, error) {
+	if collection == "" {
+		return nil, errors.New("expects collection to be a non-empty string")
+	}
+	if key == "" {
+		return nil, errors.New("expects key to be a non-empty string")
+	}
+	uid := uuid.Nil
+	if userID != "" {
+		var err error
+		if uid, err = uuid.FromString(userID); err != nil {
+			return nil, errors.New("expects an empty or valid user id")
+		}
+	}
+	if limit < 1 || limit > storageHistoryMaxList {
+		return nil, errors.New("expects limit to be 1-100")
+	}
+
+	return StorageHistoryList(ctx, n.logger, n.db, collection, key, uid, limit)
+}
+
+// @group storage
+// @summary Write a previous version of a storage object back, with the permissions it had.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param collection(type=string) The collection of the object.
+// @param key(type=string) The key of the object.
+// @param userId(type=string) The owner of the object, or empty for objects owned by the system.
+// @param version(type=string) The version to restore, as returned by the history listing.
+// @return ack(*api.StorageObjectAck) An ack with the new version of the object.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) StorageHistoryRestore(ctx context.Context, collection, key, userID, version string) (*api.StorageObjectAck, error) {
+	if collection == "" {
+		return nil, errors.New("expects collection to be a non-empty string")
+	}
+	if key == "" {
+		return nil, errors.New("expects key to be a non-empty string")
+	}
+	uid := uuid.Nil
+	if userID != "" {
+		var err error
+		if uid, err = uuid.FromString(userID); err != nil {
+			return nil, errors.New("expects an empty or valid user id")
+		}
+	}
+	if version == "" {
+		return nil, errors.New("expects version to be a non-empty string")
+	}
+
+	ack, _, err := StorageHistoryRestore(ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, collection, key, uid, version)
+	return ack, err
+}
+
 // @group storage
 // @summary Remove one or more objects by their collection/keyname and optional user.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
@@ -2088,7 +2521,7 @@ func (n *RuntimeGoNakamaModule) StorageDelete(ctx context.Context, deletes []*ru
 		ops = append(ops, op)
 	}
 
-	_, err := StorageDeleteObjects(ctx, n.logger, n.db, n.storageIndex, true, ops)
+	_, err := StorageDeleteObjects(ctx, n.logger, n.db, n.storageIndex, n.storageCollections, n.tracker, n.router, true, ops)
 
 	return err
 }
@@ -2134,6 +2567,26 @@ func (n *RuntimeGoNakamaModule) StorageIndexList(ctx context.Context, callerID,
 // @return walletUpdateOps([]*runtime.WalletUpdateResult) A list of wallet updates results.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeGoNakamaModule) MultiUpdate(ctx context.Context, accountUpdates []*runtime.AccountUpdate, storageWrites []*runtime.StorageWrite, storageDeletes []*runtime.StorageDelete, walletUpdates []*runtime.WalletUpdate, updateLedger bool) ([]*api.StorageObjectAck, []*runtime.WalletUpdateResult, error) {
+	return n.MultiUpdatePatch(ctx, accountUpdates, storageWrites, "", storageDeletes, walletUpdates, updateLedger)
+}
+
+// @group users
+// @summary Update account, storage, and wallet information simultaneously, with storage writes applied as patches to the existing value of each object.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param accountUpdates(type=[]*runtime.AccountUpdate) Array of account information to be updated.
+// @param storageWrites(type=[]*runtime.StorageWrite) Array of storage objects to be updated.
+// @param storagePatch(type=string) The patch type of storage writes, "merge" or "json", or empty to replace values.
+// @param storageDeletes(type=[]*runtime.StorageDelete) Array of storage objects to be deleted.
+// @param walletUpdates(type=[]*runtime.WalletUpdate) Array of wallet updates to be made.
+// @param updateLedger(type=bool, optional=true, default=false) Whether to record this wallet update in the ledger.
+// @return storageWriteOps([]*api.StorageObjectAck) A list of acks with the version of the written objects.
+// @return walletUpdateOps([]*runtime.WalletUpdateResult) A list of wallet updates results.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) MultiUpdatePatch(ctx context.Context, accountUpdates []*runtime.AccountUpdate, storageWrites []*runtime.StorageWrite, storagePatch string, storageDeletes []*runtime.StorageDelete, walletUpdates []*runtime.WalletUpdate, updateLedger bool) ([]*api.StorageObjectAck, []*runtime.WalletUpdateResult, error) {
+	if !storagePatchTypeValid(storagePatch) {
+		return nil, nil, errors.New("expects storage patch to be empty, 'merge' or 'json'")
+	}
+
 	// Process account update inputs.
 	accountUpdateOps := make([]*accountUpdate, 0, len(accountUpdates))
 	for _, update := range accountUpdates {
@@ -2198,7 +2651,10 @@ func (n *RuntimeGoNakamaModule) MultiUpdate(ctx context.Context, accountUpdates
 				return nil, nil, errors.New("expects an empty or valid user id")
 			}
 		}
-		if maybeJSON := []byte(write.Value); !json.Valid(maybeJSON) || bytes.TrimSpace(maybeJSON)[0] != byteBracket {
+		if !storageWriteValueValid(storagePatch, write.Value) {
+			if storagePatch == StoragePatchJson {
+				return nil, nil, errors.New("value must be a JSON-encoded array of patch operations")
+			}
 			return nil, nil, errors.New("value must be a JSON-encoded object")
 		}
 
@@ -2211,6 +2667,7 @@ func (n *RuntimeGoNakamaModule) MultiUpdate(ctx context.Context, accountUpdates
 				PermissionRead:  &wrapperspb.Int32Value{Value: int32(write.PermissionRead)},
 				PermissionWrite: &wrapperspb.Int32Value{Value: int32(write.PermissionWrite)},
 			},
+			Patch: storagePatch,
 		}
 		if write.UserID == "" {
 			op.OwnerID = uuid.Nil.String()
@@ -2275,7 +2732,7 @@ func (n *RuntimeGoNakamaModule) MultiUpdate(ctx context.Context, accountUpdates
 		}
 	}
 
-	return MultiUpdate(ctx, n.logger, n.db, n.metrics, accountUpdateOps, storageWriteOps, storageDeleteOps, n.storageIndex, walletUpdateOps, updateLedger)
+	return MultiUpdate(ctx, n.logger, n.db, n.metrics, accountUpdateOps, storageWriteOps, storageDeleteOps, n.storageIndex, n.storageCollections, n.tracker, n.router, walletUpdateOps, updateLedger)
 }
 
 // @group leaderboards
@@ -2346,35 +2803,86 @@ func (n *RuntimeGoNakamaModule) LeaderboardCreate(ctx context.Context, id string
 }
 
 // @group leaderboards
-// @summary Delete a leaderboard and all scores that belong to it.
+// @summary Setup a new leaderboard whose records are owned by groups, scored by aggregating the records group members hold on a source leaderboard. The aggregate shares the sort order and reset schedule of the source, and is kept up to date as members submit scores and group membership changes.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
-// @param id(type=string) The unique identifier for the leaderboard to delete.
+// @param id(type=string) The unique identifier for the new group leaderboard.
+// @param sourceId(type=string) The unique identifier of the leaderboard member records are read from.
+// @param aggregateOperator(type=string, default="sum") How member scores combine into the group score. Possible values are "sum", "average" or "best".
+// @param metadata(type=map[string]interface{}) The metadata you want associated to the leaderboard.
 // @return error(error) An optional error value if an error occurred.
-func (n *RuntimeGoNakamaModule) LeaderboardDelete(ctx context.Context, id string) error {
+func (n *RuntimeGoNakamaModule) LeaderboardGroupAggregateCreate(ctx context.Context, id, sourceId, aggregateOperator string, metadata map[string]interface{}) error {
 	if id == "" {
 		return errors.New("expects a leaderboard ID string")
 	}
 
-	_, err := n.leaderboardCache.Delete(ctx, n.leaderboardRankCache, n.leaderboardScheduler, id)
-	if err != nil {
-		return err
+	if sourceId == "" {
+		return errors.New("expects a source leaderboard ID string")
 	}
 
-	return nil
-}
-
-// @group leaderboards
-// @summary Find leaderboards which have been created on the server. Leaderboards can be filtered with categories.
-// @param limit(type=int) Return only the required number of leaderboards denoted by this limit value.
-// @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
-// @return leaderboardList(*api.LeaderboardList) A list of leaderboard results and possibly a cursor. If cursor is empty/nil there are no further results.
-// @return error(error) An optional error value if an error occurred.
-func (n *RuntimeGoNakamaModule) LeaderboardList(limit int, cursor string) (*api.LeaderboardList, error) {
-	if limit < 1 || limit > 100 {
-		return nil, errors.New("limit must be 1-100")
+	oper := LeaderboardAggregateOperatorSum //nolint:ineffassign
+	switch aggregateOperator {
+	case "", "sum":
+		oper = LeaderboardAggregateOperatorSum
+	case "avg", "average":
+		oper = LeaderboardAggregateOperatorAverage
+	case "best":
+		oper = LeaderboardAggregateOperatorBest
+	default:
+		return errors.New("expects aggregate operator to be 'sum', 'average' or 'best'")
 	}
 
-	var cursorPtr *LeaderboardListCursor
+	metadataStr := "{}"
+	if metadata != nil {
+		metadataBytes, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("error encoding metadata: %v", err.Error())
+		}
+		metadataStr = string(metadataBytes)
+	}
+
+	_, created, err := LeaderboardGroupAggregateCreate(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, id, sourceId, oper, metadataStr)
+	if err != nil {
+		return err
+	}
+
+	if created {
+		// Only need to update the scheduler for newly created leaderboards.
+		n.leaderboardScheduler.Update()
+	}
+
+	return nil
+}
+
+// @group leaderboards
+// @summary Delete a leaderboard and all scores that belong to it.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param id(type=string) The unique identifier for the leaderboard to delete.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LeaderboardDelete(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("expects a leaderboard ID string")
+	}
+
+	_, err := n.leaderboardCache.Delete(ctx, n.leaderboardRankCache, n.leaderboardScheduler, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// @group leaderboards
+// @summary Find leaderboards which have been created on the server. Leaderboards can be filtered with categories.
+// @param limit(type=int) Return only the required number of leaderboards denoted by this limit value.
+// @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
+// @return leaderboardList(*api.LeaderboardList) A list of leaderboard results and possibly a cursor. If cursor is empty/nil there are no further results.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LeaderboardList(limit int, cursor string) (*api.LeaderboardList, error) {
+	if limit < 1 || limit > 100 {
+		return nil, errors.New("limit must be 1-100")
+	}
+
+	var cursorPtr *LeaderboardListCursor
 	if cursor != "" {
 		cb, err := base64.StdEncoding.DecodeString(cursor)
 		if err != nil {
@@ -2945,17 +3453,135 @@ func (n *RuntimeGoNakamaModule) TournamentRecordsHaystack(ctx context.Context, i
 	return TournamentRecordsHaystack(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, id, cursor, owner, limit, expiry)
 }
 
+// @group leagues
+// @summary Setup a league made of existing tournaments, one per tier. Tiers must share the same reset schedule, at every reset the top members of each cohort are promoted and the bottom members relegated. The league configuration will not be updated if it already exists.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param id(type=string) The unique identifier for the new league.
+// @param tiers(type=[]string) The IDs of the tournaments that make up the league tiers, lowest tier first.
+// @param cohortSize(type=int) Maximum number of members competing against each other in a cohort.
+// @param promoteCount(type=int) Number of best ranked members of each cohort moved one tier up at every reset.
+// @param relegateCount(type=int) Number of worst ranked members of each cohort moved one tier down at every reset.
+// @param metadata(type=map[string]interface{}) The metadata you want associated to the league.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LeagueCreate(ctx context.Context, id string, tiers []string, cohortSize, promoteCount, relegateCount int, metadata map[string]interface{}) error {
+	if id == "" {
+		return errors.New("expects a league ID string")
+	}
+
+	if len(tiers) == 0 {
+		return errors.New("expects at least one tier tournament ID")
+	}
+
+	if cohortSize < 1 {
+		return errors.New("cohortSize must be > 0")
+	}
+	if promoteCount < 0 {
+		return errors.New("promoteCount must be >= 0")
+	}
+	if relegateCount < 0 {
+		return errors.New("relegateCount must be >= 0")
+	}
+	if promoteCount+relegateCount > cohortSize {
+		return errors.New("promoteCount and relegateCount must not exceed cohortSize")
+	}
+
+	metadataStr := "{}"
+	if metadata != nil {
+		metadataBytes, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("error encoding metadata: %v", err.Error())
+		}
+		metadataStr = string(metadataBytes)
+	}
+
+	return LeagueCreate(ctx, n.logger, n.db, n.leaderboardCache, id, tiers, cohortSize, promoteCount, relegateCount, metadataStr)
+}
+
+// @group leagues
+// @summary Delete a league and all of its member assignments. The tier tournaments are not deleted.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param id(type=string) The unique identifier for the league to delete.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LeagueDelete(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("expects a league ID string")
+	}
+
+	return LeagueDelete(ctx, n.logger, n.db, id)
+}
+
+// @group leagues
+// @summary Join a league. New members are placed in the lowest tier, in the first cohort with space available. This operation is idempotent.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param id(type=string) The unique identifier for the league to join.
+// @param ownerId(type=string) The user joining the league.
+// @return cohort(*LeagueCohort) The cohort the user is competing in.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LeagueJoin(ctx context.Context, id, ownerID string) (*LeagueCohort, error) {
+	if id == "" {
+		return nil, errors.New("expects a league ID string")
+	}
+
+	oid, err := uuid.FromString(ownerID)
+	if err != nil {
+		return nil, errors.New("expects owner ID to be a valid identifier")
+	}
+
+	return LeagueJoin(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, id, oid)
+}
+
+// @group leagues
+// @summary Remove a member from a league. Records already submitted to tier tournaments are kept.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param id(type=string) The unique identifier for the league to leave.
+// @param ownerId(type=string) The user leaving the league.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LeagueLeave(ctx context.Context, id, ownerID string) error {
+	if id == "" {
+		return errors.New("expects a league ID string")
+	}
+
+	oid, err := uuid.FromString(ownerID)
+	if err != nil {
+		return errors.New("expects owner ID to be a valid identifier")
+	}
+
+	return LeagueLeave(ctx, n.logger, n.db, id, oid)
+}
+
+// @group leagues
+// @summary Fetch the current tier and cohort of a league member, along with the records of all cohort members for the current period.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param id(type=string) The unique identifier for the league.
+// @param ownerId(type=string) The league member.
+// @return cohort(*LeagueCohort) The cohort the user is competing in.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) LeagueCohortGet(ctx context.Context, id, ownerID string) (*LeagueCohort, error) {
+	if id == "" {
+		return nil, errors.New("expects a league ID string")
+	}
+
+	oid, err := uuid.FromString(ownerID)
+	if err != nil {
+		return nil, errors.New("expects owner ID to be a valid identifier")
+	}
+
+	return LeagueCohortGet(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, id, oid)
+}
+
 // @group purchases
 // @summary Validates and stores the purchases present in an Apple App Store Receipt.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) Base-64 encoded receipt data returned by the purchase operation itself.
-// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @param passwordOverride(type=string, optional=true) Override the iap.apple.shared_password provided in your configuration.
 // @return validation(*api.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeGoNakamaModule) PurchaseValidateApple(ctx context.Context, userID, receipt string, persist bool, passwordOverride ...string) (*api.ValidatePurchaseResponse, error) {
-	if n.config.GetIAP().Apple.SharedPassword == "" && len(passwordOverride) == 0 {
+	// StoreKit 2 signed transactions are verified locally and need no shared password.
+	signed := iap.IsSignedDataApple(receipt)
+	if !signed && n.config.GetIAP().Apple.SharedPassword == "" && len(passwordOverride) == 0 {
 		return nil, errors.New("apple IAP is not configured")
 	}
 	password := n.config.GetIAP().Apple.SharedPassword
@@ -2974,11 +3600,20 @@ func (n *RuntimeGoNakamaModule) PurchaseValidateApple(ctx context.Context, userI
 		return nil, errors.New("receipt cannot be empty string")
 	}
 
-	validation, err := ValidatePurchasesApple(ctx, n.logger, n.db, uid, password, receipt, persist)
+	var validation *api.ValidatePurchaseResponse
+	if signed {
+		validation, err = ValidatePurchasesAppleSigned(ctx, n.logger, n.db, uid, n.config.GetIAP().Apple, receipt, persist)
+	} else {
+		validation, err = ValidatePurchasesApple(ctx, n.logger, n.db, uid, password, receipt, persist)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	return validation, nil
 }
 
@@ -2987,7 +3622,7 @@ func (n *RuntimeGoNakamaModule) PurchaseValidateApple(ctx context.Context, userI
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) JSON encoded Google receipt.
-// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @param overrides(type=string, optional=true) Override the iap.google.client_email and iap.google.private_key provided in your configuration.
 // @return validation(*api.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
@@ -3032,6 +3667,10 @@ func (n *RuntimeGoNakamaModule) PurchaseValidateGoogle(ctx context.Context, user
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	return validation, nil
 }
 
@@ -3041,7 +3680,7 @@ func (n *RuntimeGoNakamaModule) PurchaseValidateGoogle(ctx context.Context, user
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) The Huawei receipt data.
 // @param signature(type=string) The receipt signature.
-// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @return validation(*api.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeGoNakamaModule) PurchaseValidateHuawei(ctx context.Context, userID, signature, inAppPurchaseData string, persist bool) (*api.ValidatePurchaseResponse, error) {
@@ -3069,6 +3708,10 @@ func (n *RuntimeGoNakamaModule) PurchaseValidateHuawei(ctx context.Context, user
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	return validation, nil
 }
 
@@ -3077,7 +3720,7 @@ func (n *RuntimeGoNakamaModule) PurchaseValidateHuawei(ctx context.Context, user
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param signedRequest(type=string) The Facebook Instant signedRequest receipt data.
-// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @return validation(*api.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeGoNakamaModule) PurchaseValidateFacebookInstant(ctx context.Context, userID, signedRequest string, persist bool) (*api.ValidatePurchaseResponse, error) {
@@ -3099,6 +3742,10 @@ func (n *RuntimeGoNakamaModule) PurchaseValidateFacebookInstant(ctx context.Cont
 		return nil, err
 	}
 
+	if _, err = StoreFulfilPurchases(ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+		return nil, err
+	}
+
 	return validation, nil
 }
 
@@ -3138,6 +3785,34 @@ func (n *RuntimeGoNakamaModule) PurchaseGetByTransactionId(ctx context.Context,
 	return GetPurchaseByTransactionId(ctx, n.db, transactionID)
 }
 
+// @group purchases
+// @summary List a customer's App Store purchase history through the App Store Server API.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param transactionId(type=string) Any transaction ID of the customer.
+// @return transactions([]*iap.AppleJWSTransaction) The customer's verified transactions.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) PurchaseHistoryApple(ctx context.Context, transactionID string) ([]*iap.AppleJWSTransaction, error) {
+	if transactionID == "" {
+		return nil, errors.New("expects a transaction id string")
+	}
+
+	return ListPurchaseHistoryApple(ctx, n.logger, n.config.GetIAP().Apple, transactionID)
+}
+
+// @group purchases
+// @summary List a customer's refunded App Store purchases through the App Store Server API.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param transactionId(type=string) Any transaction ID of the customer.
+// @return transactions([]*iap.AppleJWSTransaction) The customer's verified refunded transactions.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) PurchaseRefundsApple(ctx context.Context, transactionID string) ([]*iap.AppleJWSTransaction, error) {
+	if transactionID == "" {
+		return nil, errors.New("expects a transaction id string")
+	}
+
+	return ListRefundedPurchasesApple(ctx, n.logger, n.config.GetIAP().Apple, transactionID)
+}
+
 // @group subscriptions
 // @summary Validates and stores the subscription present in an Apple App Store Receipt.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
@@ -3334,7 +4009,7 @@ func (n *RuntimeGoNakamaModule) GroupCreate(ctx context.Context, userID, name, c
 		return nil, errors.New("expects max_count to be >= 1")
 	}
 
-	return CreateGroup(ctx, n.logger, n.db, uid, cid, name, langTag, description, avatarUrl, metadataStr, open, maxCount)
+	return CreateGroup(ctx, n.logger, n.db, n.groupIndex, uid, cid, name, langTag, description, avatarUrl, metadataStr, open, maxCount)
 }
 
 // @group groups
@@ -3407,7 +4082,7 @@ func (n *RuntimeGoNakamaModule) GroupUpdate(ctx context.Context, id, userID, nam
 		metadataWrapper = &wrapperspb.StringValue{Value: string(metadataBytes)}
 	}
 
-	return UpdateGroup(ctx, n.logger, n.db, groupID, uid, creator, nameWrapper, langTagWrapper, descriptionWrapper, avatarURLWrapper, metadataWrapper, openWrapper, maxCount)
+	return UpdateGroup(ctx, n.logger, n.db, n.groupIndex, groupID, uid, creator, nameWrapper, langTagWrapper, descriptionWrapper, avatarURLWrapper, metadataWrapper, openWrapper, maxCount)
 }
 
 // @group groups
@@ -3421,7 +4096,7 @@ func (n *RuntimeGoNakamaModule) GroupDelete(ctx context.Context, id string) erro
 		return errors.New("expects group ID to be a valid identifier")
 	}
 
-	return DeleteGroup(ctx, n.logger, n.db, groupID, uuid.Nil)
+	return DeleteGroup(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.groupIndex, groupID, uuid.Nil)
 }
 
 // @group groups
@@ -3446,7 +4121,42 @@ func (n *RuntimeGoNakamaModule) GroupUserJoin(ctx context.Context, groupID, user
 		return errors.New("expects a username string")
 	}
 
-	return JoinGroup(ctx, n.logger, n.db, n.tracker, n.router, group, user, username)
+	return JoinGroup(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.tracker, n.router, group, user, username, "")
+}
+
+// @group groups
+// @summary Request to join a closed group for a particular user, attaching an application that group admins can review alongside the join request. Open groups are joined immediately and the application is discarded.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param groupId(type=string) The ID of the group to join.
+// @param userId(type=string) The user ID to add to this group.
+// @param username(type=string) The username of the user to add to this group.
+// @param application(type=map[string]interface{}) The application form submitted with the join request.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupUserApply(ctx context.Context, groupID, userID, username string, application map[string]interface{}) error {
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return errors.New("expects group ID to be a valid identifier")
+	}
+
+	user, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("expects user ID to be a valid identifier")
+	}
+
+	if username == "" {
+		return errors.New("expects a username string")
+	}
+
+	applicationStr := ""
+	if application != nil {
+		applicationBytes, err := json.Marshal(application)
+		if err != nil {
+			return fmt.Errorf("error encoding application: %v", err.Error())
+		}
+		applicationStr = string(applicationBytes)
+	}
+
+	return JoinGroup(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.tracker, n.router, group, user, username, applicationStr)
 }
 
 // @group groups
@@ -3471,7 +4181,7 @@ func (n *RuntimeGoNakamaModule) GroupUserLeave(ctx context.Context, groupID, use
 		return errors.New("expects a username string")
 	}
 
-	return LeaveGroup(ctx, n.logger, n.db, n.tracker, n.router, n.streamManager, group, user, username)
+	return LeaveGroup(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.tracker, n.router, n.streamManager, group, user, username)
 }
 
 // @group groups
@@ -3511,7 +4221,7 @@ func (n *RuntimeGoNakamaModule) GroupUsersAdd(ctx context.Context, callerID, gro
 		users = append(users, uid)
 	}
 
-	return AddGroupUsers(ctx, n.logger, n.db, n.tracker, n.router, caller, group, users)
+	return AddGroupUsers(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.tracker, n.router, caller, group, users)
 }
 
 // @group groups
@@ -3551,7 +4261,7 @@ func (n *RuntimeGoNakamaModule) GroupUsersBan(ctx context.Context, callerID, gro
 		users = append(users, uid)
 	}
 
-	return BanGroupUsers(ctx, n.logger, n.db, n.tracker, n.router, n.streamManager, caller, group, users)
+	return BanGroupUsers(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.tracker, n.router, n.streamManager, caller, group, users)
 }
 
 // @group groups
@@ -3591,7 +4301,244 @@ func (n *RuntimeGoNakamaModule) GroupUsersKick(ctx context.Context, callerID, gr
 		users = append(users, uid)
 	}
 
-	return KickGroupUsers(ctx, n.logger, n.db, n.tracker, n.router, n.streamManager, caller, group, users, false)
+	return KickGroupUsers(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.tracker, n.router, n.streamManager, caller, group, users, false)
+}
+
+// @group groups
+// @summary Create a custom role for a group, or replace the permissions of an existing role with the same name. Members holding the role gain the listed permissions.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @param groupId(type=string) The ID of the group to define the role for.
+// @param name(type=string) The name of the role, for example "officer".
+// @param permissions(type=[]string) The permissions granted by the role. Possible values are "invite", "kick", "edit" and "chat".
+// @return role(*GroupRole) The created or updated role.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupRoleUpsert(ctx context.Context, callerID, groupID, name string, permissions []string) (*GroupRole, error) {
+	caller := uuid.Nil
+	if callerID != "" {
+		var err error
+		if caller, err = uuid.FromString(callerID); err != nil {
+			return nil, errors.New("expects caller ID to be empty or a valid identifier")
+		}
+	}
+
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return nil, errors.New("expects group ID to be a valid identifier")
+	}
+
+	if name == "" {
+		return nil, errors.New("expects a role name string")
+	}
+
+	return GroupRoleUpsert(ctx, n.logger, n.db, caller, group, name, permissions)
+}
+
+// @group groups
+// @summary Delete a custom role from a group. Members holding the role become regular members.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @param groupId(type=string) The ID of the group to delete the role from.
+// @param name(type=string) The name of the role to delete.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupRoleDelete(ctx context.Context, callerID, groupID, name string) error {
+	caller := uuid.Nil
+	if callerID != "" {
+		var err error
+		if caller, err = uuid.FromString(callerID); err != nil {
+			return errors.New("expects caller ID to be empty or a valid identifier")
+		}
+	}
+
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return errors.New("expects group ID to be a valid identifier")
+	}
+
+	if name == "" {
+		return errors.New("expects a role name string")
+	}
+
+	return GroupRoleDelete(ctx, n.logger, n.db, n.tracker, caller, group, name)
+}
+
+// @group groups
+// @summary List the custom roles defined for a group.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param groupId(type=string) The ID of the group to list roles for.
+// @return roles([]*GroupRole) The roles defined for the group.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupRolesList(ctx context.Context, groupID string) ([]*GroupRole, error) {
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return nil, errors.New("expects group ID to be a valid identifier")
+	}
+
+	return GroupRolesList(ctx, n.logger, n.db, group)
+}
+
+// @group groups
+// @summary Assign a custom role to a group member, replacing any role they already hold. The role is reflected in the status of their group channel presences.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @param groupId(type=string) The ID of the group.
+// @param userId(type=string) The ID of the member to assign the role to.
+// @param role(type=string) The name of the role to assign. An empty string removes the member's role.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupUserRoleSet(ctx context.Context, callerID, groupID, userID, role string) error {
+	caller := uuid.Nil
+	if callerID != "" {
+		var err error
+		if caller, err = uuid.FromString(callerID); err != nil {
+			return errors.New("expects caller ID to be empty or a valid identifier")
+		}
+	}
+
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return errors.New("expects group ID to be a valid identifier")
+	}
+
+	user, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("expects user ID to be a valid identifier")
+	}
+
+	return GroupUserRoleSet(ctx, n.logger, n.db, n.tracker, caller, group, user, role)
+}
+
+// @group groups
+// @summary Invite users to join a group. Invited users can accept or reject the invite, and accepting it adds them to the group even if the group is closed.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @param groupId(type=string) The ID of the group to invite users to.
+// @param userIds(type=[]string) Table array of user IDs to invite.
+// @param expirySec(type=int, optional=true, default=604800) The number of seconds until the invites expire.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupUsersInvite(ctx context.Context, callerID, groupID string, userIDs []string, expirySec int) error {
+	caller := uuid.Nil
+	if callerID != "" {
+		var err error
+		if caller, err = uuid.FromString(callerID); err != nil {
+			return errors.New("expects caller ID to be empty or a valid identifier")
+		}
+	}
+
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return errors.New("expects group ID to be a valid identifier")
+	}
+
+	if expirySec < 0 {
+		return errors.New("expects expiry to be 0 or greater")
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	users := make([]uuid.UUID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		uid, err := uuid.FromString(userID)
+		if err != nil {
+			return errors.New("expects each user ID to be a valid identifier")
+		}
+		if uid == uuid.Nil {
+			return errors.New("cannot invite the root user")
+		}
+		users = append(users, uid)
+	}
+
+	return GroupInviteUsers(ctx, n.logger, n.db, n.tracker, n.router, caller, group, users, expirySec)
+}
+
+// @group groups
+// @summary Accept a pending group invite for a particular user, adding them to the group.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param groupId(type=string) The ID of the group the user was invited to.
+// @param userId(type=string) The ID of the invited user.
+// @param username(type=string) The username of the invited user.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupInviteAccept(ctx context.Context, groupID, userID, username string) error {
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return errors.New("expects group ID to be a valid identifier")
+	}
+
+	user, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("expects user ID to be a valid identifier")
+	}
+
+	if username == "" {
+		return errors.New("expects a username string")
+	}
+
+	return GroupInviteAccept(ctx, n.logger, n.db, n.leaderboardCache, n.leaderboardRankCache, n.tracker, n.router, group, user, username)
+}
+
+// @group groups
+// @summary Reject a pending group invite for a particular user.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param groupId(type=string) The ID of the group the user was invited to.
+// @param userId(type=string) The ID of the invited user.
+// @param username(type=string) The username of the invited user.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupInviteReject(ctx context.Context, groupID, userID, username string) error {
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return errors.New("expects group ID to be a valid identifier")
+	}
+
+	user, err := uuid.FromString(userID)
+	if err != nil {
+		return errors.New("expects user ID to be a valid identifier")
+	}
+
+	if username == "" {
+		return errors.New("expects a username string")
+	}
+
+	return GroupInviteReject(ctx, n.logger, n.db, n.tracker, n.router, group, user, username)
+}
+
+// @group groups
+// @summary List the pending, unexpired group invites for a user.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param userId(type=string) The ID of the user to list invites for.
+// @return invites([]*GroupInvite) The user's pending group invites.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupInvitesList(ctx context.Context, userID string) ([]*GroupInvite, error) {
+	user, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, errors.New("expects user ID to be a valid identifier")
+	}
+
+	return GroupInvitesList(ctx, n.logger, n.db, user)
+}
+
+// @group groups
+// @summary List the applications submitted with pending join requests to a group.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @param groupId(type=string) The ID of the group to list applications for.
+// @return applications([]*GroupApplication) The applications attached to pending join requests.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupApplicationsList(ctx context.Context, callerID, groupID string) ([]*GroupApplication, error) {
+	caller := uuid.Nil
+	if callerID != "" {
+		var err error
+		if caller, err = uuid.FromString(callerID); err != nil {
+			return nil, errors.New("expects caller ID to be empty or a valid identifier")
+		}
+	}
+
+	group, err := uuid.FromString(groupID)
+	if err != nil {
+		return nil, errors.New("expects group ID to be a valid identifier")
+	}
+
+	return GroupApplicationsList(ctx, n.logger, n.db, caller, group)
 }
 
 // @group groups
@@ -3675,7 +4622,7 @@ func (n *RuntimeGoNakamaModule) GroupUsersDemote(ctx context.Context, callerID,
 }
 
 // @group groups
-// @summary List all members, admins and superadmins which belong to a group. This also lists incoming join requests.
+// @summary List all members, admins and superadmins which belong to a group. This also lists incoming join requests, whose applications are listed with GroupApplicationsList.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
 // @param groupId(type=string) The ID of the group to list members for.
 // @param limit(type=int) Return only the required number of users denoted by this limit value.
@@ -3711,7 +4658,7 @@ func (n *RuntimeGoNakamaModule) GroupUsersList(ctx context.Context, id string, l
 }
 
 // @group groups
-// @summary Find groups based on the entered criteria.
+// @summary Find groups based on the entered criteria. Use GroupsSearch to search the group index with a query string.
 // @param ctx(type=context.Context) The context object represents information about the server and requester.
 // @param name(type=string, optional=true) Search for groups that contain this value in their name. Cannot be combined with any other filter.
 // @param langTag(type=string, optional=true) Filter based upon the entered language tag.
@@ -3736,7 +4683,41 @@ func (n *RuntimeGoNakamaModule) GroupsList(ctx context.Context, name, langTag st
 		return nil, "", errors.New("expects limit to be 1-100")
 	}
 
-	groups, err := ListGroups(ctx, n.logger, n.db, name, langTag, open, edgeCount, limit, cursor)
+	groups, err := ListGroups(ctx, n.logger, n.db, n.groupIndex, name, langTag, "", open, edgeCount, limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return groups.Groups, groups.Cursor, nil
+}
+
+// @group groups
+// @summary Search groups with a query string over their name, description, language tag, open state and configured metadata fields.
+// @param ctx(type=context.Context) The context object represents information about the server and requester.
+// @param query(type=string) Query string to match groups against, for example "+name:dragons +metadata.region:eu".
+// @param langTag(type=string, optional=true) Filter based upon the entered language tag.
+// @param members(type=int, optional=true) Search by number of group members.
+// @param open(type=bool, optional=true) Filter based on whether groups are Open or Closed.
+// @param limit(type=int, optional=true) Return only the required number of groups denoted by this limit value.
+// @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
+// @return groups([]*api.Group) A list of groups.
+// @return cursor(string) An optional next page cursor that can be used to retrieve the next page of records (if any). Will be set to "" or nil when fetching last available page.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeGoNakamaModule) GroupsSearch(ctx context.Context, query, langTag string, members *int, open *bool, limit int, cursor string) ([]*api.Group, string, error) {
+	if query == "" {
+		return nil, "", errors.New("expects a query string")
+	}
+
+	edgeCount := -1
+	if members != nil {
+		edgeCount = *members
+	}
+
+	if limit < 1 || limit > 100 {
+		return nil, "", errors.New("expects limit to be 1-100")
+	}
+
+	groups, err := ListGroups(ctx, n.logger, n.db, n.groupIndex, "", langTag, query, open, edgeCount, limit, cursor)
 	if err != nil {
 		return nil, "", err
 	}
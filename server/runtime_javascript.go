@@ -101,6 +101,20 @@ func (r *RuntimeJS) GetCallback(e RuntimeExecutionMode, key string) string {
 			return ""
 		}
 		return fnId
+	case RuntimeExecutionModeBeforeAccountMerge:
+		return r.callbacks.BeforeAccountMerge
+	case RuntimeExecutionModeBeforeTrade:
+		return r.callbacks.BeforeTrade
+	case RuntimeExecutionModeAfterTrade:
+		return r.callbacks.AfterTrade
+	case RuntimeExecutionModeStorageExpiry:
+		return r.callbacks.StorageExpiry
+	case RuntimeExecutionModeBeforeOIDC:
+		return r.callbacks.BeforeOIDC
+	case RuntimeExecutionModeAfterOIDC:
+		return r.callbacks.AfterOIDC
+	case RuntimeExecutionModeEmailTemplate:
+		return r.callbacks.EmailTemplate
 	}
 
 	return ""
@@ -169,6 +183,11 @@ type RuntimeProviderJS struct {
 	newFn                func() *RuntimeJS
 	metrics              Metrics
 	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	storeCatalog         StoreCatalog
+	groupIndex           GroupIndex
+	rateLimiter          RateLimiter
+	namePolicy           NamePolicy
 }
 
 func (rp *RuntimeProviderJS) Rpc(ctx context.Context, id string, headers, queryParams map[string][]string, userID, username string, vars map[string]string, expiry int64, sessionID, clientIP, clientPort, lang, payload string) (string, error, codes.Code) {
@@ -630,7 +649,7 @@ func (rp *RuntimeProviderJS) Put(r *RuntimeJS) {
 	}
 }
 
-func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, eventFn RuntimeEventCustomFunction, path, entrypoint string, matchProvider *MatchProvider, storageIndex StorageIndex) ([]string, map[string]RuntimeRpcFunction, map[string]RuntimeBeforeRtFunction, map[string]RuntimeAfterRtFunction, *RuntimeBeforeReqFunctions, *RuntimeAfterReqFunctions, RuntimeMatchmakerMatchedFunction, RuntimeTournamentEndFunction, RuntimeTournamentResetFunction, RuntimeLeaderboardResetFunction, RuntimePurchaseNotificationAppleFunction, RuntimeSubscriptionNotificationAppleFunction, RuntimePurchaseNotificationGoogleFunction, RuntimeSubscriptionNotificationGoogleFunction, map[string]RuntimeStorageIndexFilterFunction, error) {
+func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, eventFn RuntimeEventCustomFunction, path, entrypoint string, matchProvider *MatchProvider, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy) ([]string, map[string]RuntimeRpcFunction, map[string]RuntimeBeforeRtFunction, map[string]RuntimeAfterRtFunction, *RuntimeBeforeReqFunctions, *RuntimeAfterReqFunctions, RuntimeMatchmakerMatchedFunction, RuntimeTournamentEndFunction, RuntimeTournamentResetFunction, RuntimeLeaderboardResetFunction, RuntimePurchaseNotificationAppleFunction, RuntimeSubscriptionNotificationAppleFunction, RuntimePurchaseNotificationGoogleFunction, RuntimeSubscriptionNotificationGoogleFunction, map[string]RuntimeStorageIndexFilterFunction, *RuntimeServerHookFunctions, error) {
 	startupLogger.Info("Initialising JavaScript runtime provider", zap.String("path", path), zap.String("entrypoint", entrypoint))
 
 	modCache, err := cacheJavascriptModules(startupLogger, path, entrypoint)
@@ -671,6 +690,11 @@ func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger
 		maxCount:             uint32(config.GetRuntime().JsMaxCount),
 		currentCount:         atomic.NewUint32(uint32(config.GetRuntime().JsMinCount)),
 		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		storeCatalog:         storeCatalog,
+		groupIndex:           groupIndex,
+		rateLimiter:          rateLimiter,
+		namePolicy:           namePolicy,
 	}
 
 	rpcFunctions := make(map[string]RuntimeRpcFunction, 0)
@@ -687,6 +711,7 @@ func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger
 	var purchaseNotificationGoogleFunction RuntimePurchaseNotificationGoogleFunction
 	var subscriptionNotificationGoogleFunction RuntimeSubscriptionNotificationGoogleFunction
 	storageIndexFilterFunctions := make(map[string]RuntimeStorageIndexFilterFunction, 0)
+	serverHookFunctions := &RuntimeServerHookFunctions{}
 
 	matchHandlers := &RuntimeJavascriptMatchHandlers{
 		mapping: make(map[string]*jsMatchHandlers, 0),
@@ -699,10 +724,10 @@ func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger
 				return nil, nil
 			}
 
-			return NewRuntimeJavascriptMatchCore(logger, name, db, protojsonMarshaler, protojsonUnmarshaler, config, socialClient, leaderboardCache, leaderboardRankCache, localCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, matchProvider.CreateMatch, eventFn, id, node, version, stopped, mc, modCache, storageIndex)
+			return NewRuntimeJavascriptMatchCore(logger, name, db, protojsonMarshaler, protojsonUnmarshaler, config, socialClient, leaderboardCache, leaderboardRankCache, localCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, matchProvider.CreateMatch, eventFn, id, node, version, stopped, mc, modCache, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy)
 		})
 
-	callbacks, err := evalRuntimeModules(runtimeProviderJS, modCache, matchHandlers, matchProvider, leaderboardScheduler, storageIndex, localCache, func(mode RuntimeExecutionMode, id string) {
+	callbacks, err := evalRuntimeModules(runtimeProviderJS, modCache, matchHandlers, matchProvider, leaderboardScheduler, storageIndex, storageCollections, storeCatalog, localCache, func(mode RuntimeExecutionMode, id string) {
 		switch mode {
 		case RuntimeExecutionModeRPC:
 			rpcFunctions[id] = func(ctx context.Context, headers, queryParams map[string][]string, userID, username string, vars map[string]string, expiry int64, sessionID, clientIP, clientPort, lang, payload string) (string, error, codes.Code) {
@@ -1688,11 +1713,39 @@ func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger
 			storageIndexFilterFunctions[id] = func(ctx context.Context, write *StorageOpWrite) (bool, error) {
 				return runtimeProviderJS.StorageIndexFilter(ctx, id, write)
 			}
+		case RuntimeExecutionModeBeforeAccountMerge:
+			serverHookFunctions.beforeAccountMergeFunction = func(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+				return runtimeProviderJS.BeforeAccountMerge(ctx, userID, username, policy)
+			}
+		case RuntimeExecutionModeBeforeTrade:
+			serverHookFunctions.beforeTradeFunction = func(ctx context.Context, userID, action string, trade *Trade) (error, codes.Code) {
+				return runtimeProviderJS.BeforeTrade(ctx, userID, action, trade)
+			}
+		case RuntimeExecutionModeAfterTrade:
+			serverHookFunctions.afterTradeFunction = func(ctx context.Context, userID, action string, trade *Trade) error {
+				return runtimeProviderJS.AfterTrade(ctx, userID, action, trade)
+			}
+		case RuntimeExecutionModeStorageExpiry:
+			serverHookFunctions.storageExpiryFunction = func(ctx context.Context, objects []*api.StorageObject) error {
+				return runtimeProviderJS.StorageExpiry(ctx, objects)
+			}
+		case RuntimeExecutionModeBeforeOIDC:
+			serverHookFunctions.beforeOIDCFunction = func(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+				return runtimeProviderJS.BeforeOIDC(ctx, userID, username, action, request)
+			}
+		case RuntimeExecutionModeAfterOIDC:
+			serverHookFunctions.afterOIDCFunction = func(ctx context.Context, userID, username, action string, request *OIDCRequest) error {
+				return runtimeProviderJS.AfterOIDC(ctx, userID, username, action, request)
+			}
+		case RuntimeExecutionModeEmailTemplate:
+			serverHookFunctions.emailTemplateFunction = func(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error) {
+				return runtimeProviderJS.EmailTemplate(ctx, userID, username, request)
+			}
 		}
 	}, false)
 	if err != nil {
 		logger.Error("Failed to eval JavaScript modules.", zap.Error(err))
-		return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
 	}
 
 	runtimeProviderJS.newFn = func() *RuntimeJS {
@@ -1709,7 +1762,7 @@ func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger
 			logger.Fatal("Failed to initialize JavaScript runtime", zap.Error(err))
 		}
 
-		nakamaModule := NewRuntimeJavascriptNakamaModule(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, socialClient, leaderboardCache, leaderboardRankCache, storageIndex, localCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, eventFn, matchProvider.CreateMatch)
+		nakamaModule := NewRuntimeJavascriptNakamaModule(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, socialClient, leaderboardCache, leaderboardRankCache, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy, localCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, eventFn, matchProvider.CreateMatch)
 		nk, err := nakamaModule.Constructor(runtime)
 		if err != nil {
 			logger.Fatal("Failed to initialize JavaScript runtime", zap.Error(err))
@@ -1741,7 +1794,7 @@ func NewRuntimeProviderJS(ctx context.Context, logger, startupLogger *zap.Logger
 	}
 	startupLogger.Info("Allocated minimum JavaScript runtime pool")
 
-	return modCache.Names, rpcFunctions, beforeRtFunctions, afterRtFunctions, beforeReqFunctions, afterReqFunctions, matchmakerMatchedFunction, tournamentEndFunction, tournamentResetFunction, leaderboardResetFunction, purchaseNotificationAppleFunction, subscriptionNotificationAppleFunction, purchaseNotificationGoogleFunction, subscriptionNotificationGoogleFunction, storageIndexFilterFunctions, nil
+	return modCache.Names, rpcFunctions, beforeRtFunctions, afterRtFunctions, beforeReqFunctions, afterReqFunctions, matchmakerMatchedFunction, tournamentEndFunction, tournamentResetFunction, leaderboardResetFunction, purchaseNotificationAppleFunction, subscriptionNotificationAppleFunction, purchaseNotificationGoogleFunction, subscriptionNotificationGoogleFunction, storageIndexFilterFunctions, serverHookFunctions, nil
 }
 
 func CheckRuntimeProviderJavascript(logger *zap.Logger, config Config, version string) error {
@@ -1759,7 +1812,7 @@ func CheckRuntimeProviderJavascript(logger *zap.Logger, config Config, version s
 		mapping: make(map[string]*jsMatchHandlers, 0),
 	}
 
-	_, err = evalRuntimeModules(rp, modCache, matchHandlers, nil, nil, nil, nil, func(RuntimeExecutionMode, string) {}, true)
+	_, err = evalRuntimeModules(rp, modCache, matchHandlers, nil, nil, nil, nil, nil, nil, func(RuntimeExecutionMode, string) {}, true)
 	if err != nil {
 		logger.Error("Failed to load JavaScript module.", zap.Error(err))
 	}
@@ -2108,6 +2161,368 @@ func (rp *RuntimeProviderJS) LeaderboardReset(ctx context.Context, leaderboard *
 	return errors.New("Unexpected return type from runtime Leaderboard Reset hook, must be nil.")
 }
 
+func (rp *RuntimeProviderJS) BeforeAccountMerge(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return nil, err, codes.Internal
+	}
+	jsFn := r.GetCallback(RuntimeExecutionModeBeforeAccountMerge, "")
+	if jsFn == "" {
+		rp.Put(r)
+		return nil, errors.New("Runtime Before Account Merge function not found."), codes.NotFound
+	}
+
+	policyMap, err := runtimeValueToMap(policy)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert account merge policy", zap.Error(err))
+		return nil, errors.New("Could not run runtime Before Account Merge function."), codes.Internal
+	}
+
+	fn, ok := goja.AssertFunction(r.vm.Get(jsFn))
+	if !ok {
+		rp.Put(r)
+		rp.logger.Error("JavaScript runtime function invalid.", zap.String("key", jsFn), zap.Error(err))
+		return nil, errors.New("Could not run runtime Before Account Merge function."), codes.Internal
+	}
+
+	jsLogger, err := NewJsLogger(r.vm, r.logger, zap.String("mode", RuntimeExecutionModeBeforeAccountMerge.String()))
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not instantiate js logger.", zap.Error(err))
+		return nil, errors.New("Could not run runtime Before Account Merge function."), codes.Internal
+	}
+
+	r.SetContext(ctx)
+	result, fnErr, code := r.InvokeFunction(RuntimeExecutionModeBeforeAccountMerge, "beforeAccountMerge", fn, jsLogger, nil, nil, userID, username, nil, 0, "", "", "", "", policyMap)
+	r.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if jsErr, ok := fnErr.(*jsError); ok {
+			if !jsErr.custom {
+				rp.logger.Error("Runtime Before Account Merge function caused an error.", zap.Error(fnErr))
+			}
+		}
+		return nil, fnErr, code
+	}
+
+	if result == nil {
+		// No return value, the policy is used as-is.
+		return nil, nil, codes.OK
+	}
+
+	updated := &AccountMergePolicy{}
+	if err = runtimeValueFromMap(result, updated); err != nil {
+		rp.logger.Error("Could not convert Before Account Merge result", zap.Any("result", result), zap.Error(err))
+		return nil, errors.New("Invalid return type from runtime Before Account Merge function, must be an object."), codes.Internal
+	}
+	return updated, nil, codes.OK
+}
+
+func (rp *RuntimeProviderJS) BeforeTrade(ctx context.Context, userID, action string, trade *Trade) (error, codes.Code) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err, codes.Internal
+	}
+	jsFn := r.GetCallback(RuntimeExecutionModeBeforeTrade, "")
+	if jsFn == "" {
+		rp.Put(r)
+		return errors.New("Runtime Before Trade function not found."), codes.NotFound
+	}
+
+	tradeMap, err := runtimeValueToMap(trade)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert trade", zap.Error(err))
+		return errors.New("Could not run runtime Before Trade function."), codes.Internal
+	}
+
+	fn, ok := goja.AssertFunction(r.vm.Get(jsFn))
+	if !ok {
+		rp.Put(r)
+		rp.logger.Error("JavaScript runtime function invalid.", zap.String("key", jsFn), zap.Error(err))
+		return errors.New("Could not run runtime Before Trade function."), codes.Internal
+	}
+
+	jsLogger, err := NewJsLogger(r.vm, r.logger, zap.String("mode", RuntimeExecutionModeBeforeTrade.String()))
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not instantiate js logger.", zap.Error(err))
+		return errors.New("Could not run runtime Before Trade function."), codes.Internal
+	}
+
+	r.SetContext(ctx)
+	_, fnErr, code := r.InvokeFunction(RuntimeExecutionModeBeforeTrade, "beforeTrade", fn, jsLogger, nil, nil, userID, "", nil, 0, "", "", "", "", action, tradeMap)
+	r.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if jsErr, ok := fnErr.(*jsError); ok {
+			if !jsErr.custom {
+				rp.logger.Error("Runtime Before Trade function caused an error.", zap.Error(fnErr))
+			}
+		}
+		return fnErr, code
+	}
+	return nil, codes.OK
+}
+
+func (rp *RuntimeProviderJS) AfterTrade(ctx context.Context, userID, action string, trade *Trade) error {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err
+	}
+	jsFn := r.GetCallback(RuntimeExecutionModeAfterTrade, "")
+	if jsFn == "" {
+		rp.Put(r)
+		return errors.New("Runtime After Trade function not found.")
+	}
+
+	tradeMap, err := runtimeValueToMap(trade)
+	if err != nil {
+		rp.Put(r)
+		return fmt.Errorf("Error running runtime After Trade hook: %v", err.Error())
+	}
+
+	fn, ok := goja.AssertFunction(r.vm.Get(jsFn))
+	if !ok {
+		rp.Put(r)
+		rp.logger.Error("JavaScript runtime function invalid.", zap.String("key", jsFn), zap.Error(err))
+		return errors.New("Could not run After Trade hook.")
+	}
+
+	jsLogger, err := NewJsLogger(r.vm, r.logger, zap.String("mode", RuntimeExecutionModeAfterTrade.String()))
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not instantiate js logger.", zap.Error(err))
+		return errors.New("Could not run After Trade hook.")
+	}
+
+	r.SetContext(ctx)
+	_, err, _ = r.InvokeFunction(RuntimeExecutionModeAfterTrade, "afterTrade", fn, jsLogger, nil, nil, userID, "", nil, 0, "", "", "", "", action, tradeMap)
+	r.SetContext(context.Background())
+	rp.Put(r)
+	if err != nil {
+		return fmt.Errorf("Error running runtime After Trade hook: %v", err.Error())
+	}
+	return nil
+}
+
+func (rp *RuntimeProviderJS) BeforeOIDC(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return nil, err, codes.Internal
+	}
+	jsFn := r.GetCallback(RuntimeExecutionModeBeforeOIDC, "")
+	if jsFn == "" {
+		rp.Put(r)
+		return nil, errors.New("Runtime Before OIDC function not found."), codes.NotFound
+	}
+
+	requestMap, err := runtimeValueToMap(request)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert OIDC request", zap.Error(err))
+		return nil, errors.New("Could not run runtime Before OIDC function."), codes.Internal
+	}
+
+	fn, ok := goja.AssertFunction(r.vm.Get(jsFn))
+	if !ok {
+		rp.Put(r)
+		rp.logger.Error("JavaScript runtime function invalid.", zap.String("key", jsFn), zap.Error(err))
+		return nil, errors.New("Could not run runtime Before OIDC function."), codes.Internal
+	}
+
+	jsLogger, err := NewJsLogger(r.vm, r.logger, zap.String("mode", RuntimeExecutionModeBeforeOIDC.String()))
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not instantiate js logger.", zap.Error(err))
+		return nil, errors.New("Could not run runtime Before OIDC function."), codes.Internal
+	}
+
+	r.SetContext(ctx)
+	result, fnErr, code := r.InvokeFunction(RuntimeExecutionModeBeforeOIDC, "beforeOIDC", fn, jsLogger, nil, nil, userID, username, request.Vars, 0, "", "", "", "", action, requestMap)
+	r.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if jsErr, ok := fnErr.(*jsError); ok {
+			if !jsErr.custom {
+				rp.logger.Error("Runtime Before OIDC function caused an error.", zap.Error(fnErr))
+			}
+		}
+		return nil, fnErr, code
+	}
+
+	if result == nil {
+		// No return value, the request is used as-is.
+		return nil, nil, codes.OK
+	}
+
+	updated := &OIDCRequest{}
+	if err = runtimeValueFromMap(result, updated); err != nil {
+		rp.logger.Error("Could not convert Before OIDC result", zap.Any("result", result), zap.Error(err))
+		return nil, errors.New("Invalid return type from runtime Before OIDC function, must be an object."), codes.Internal
+	}
+	return updated, nil, codes.OK
+}
+
+func (rp *RuntimeProviderJS) AfterOIDC(ctx context.Context, userID, username, action string, request *OIDCRequest) error {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err
+	}
+	jsFn := r.GetCallback(RuntimeExecutionModeAfterOIDC, "")
+	if jsFn == "" {
+		rp.Put(r)
+		return errors.New("Runtime After OIDC function not found.")
+	}
+
+	requestMap, err := runtimeValueToMap(request)
+	if err != nil {
+		rp.Put(r)
+		return fmt.Errorf("Error running runtime After OIDC hook: %v", err.Error())
+	}
+
+	fn, ok := goja.AssertFunction(r.vm.Get(jsFn))
+	if !ok {
+		rp.Put(r)
+		rp.logger.Error("JavaScript runtime function invalid.", zap.String("key", jsFn), zap.Error(err))
+		return errors.New("Could not run After OIDC hook.")
+	}
+
+	jsLogger, err := NewJsLogger(r.vm, r.logger, zap.String("mode", RuntimeExecutionModeAfterOIDC.String()))
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not instantiate js logger.", zap.Error(err))
+		return errors.New("Could not run After OIDC hook.")
+	}
+
+	r.SetContext(ctx)
+	_, err, _ = r.InvokeFunction(RuntimeExecutionModeAfterOIDC, "afterOIDC", fn, jsLogger, nil, nil, userID, username, request.Vars, 0, "", "", "", "", action, requestMap)
+	r.SetContext(context.Background())
+	rp.Put(r)
+	if err != nil {
+		return fmt.Errorf("Error running runtime After OIDC hook: %v", err.Error())
+	}
+	return nil
+}
+
+func (rp *RuntimeProviderJS) EmailTemplate(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jsFn := r.GetCallback(RuntimeExecutionModeEmailTemplate, "")
+	if jsFn == "" {
+		rp.Put(r)
+		return nil, errors.New("Runtime Email Template function not found.")
+	}
+
+	requestMap, err := runtimeValueToMap(request)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert email template request", zap.Error(err))
+		return nil, errors.New("Could not run runtime Email Template function.")
+	}
+
+	fn, ok := goja.AssertFunction(r.vm.Get(jsFn))
+	if !ok {
+		rp.Put(r)
+		rp.logger.Error("JavaScript runtime function invalid.", zap.String("key", jsFn), zap.Error(err))
+		return nil, errors.New("Could not run runtime Email Template function.")
+	}
+
+	jsLogger, err := NewJsLogger(r.vm, r.logger, zap.String("mode", RuntimeExecutionModeEmailTemplate.String()))
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not instantiate js logger.", zap.Error(err))
+		return nil, errors.New("Could not run runtime Email Template function.")
+	}
+
+	r.SetContext(ctx)
+	result, fnErr, _ := r.InvokeFunction(RuntimeExecutionModeEmailTemplate, "emailTemplate", fn, jsLogger, nil, nil, userID, username, nil, 0, "", "", "", "", requestMap)
+	r.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if jsErr, ok := fnErr.(*jsError); ok {
+			if !jsErr.custom {
+				rp.logger.Error("Runtime Email Template function caused an error.", zap.Error(fnErr))
+			}
+		}
+		return nil, fnErr
+	}
+
+	if result == nil {
+		// No return value, the built-in template is used.
+		return nil, nil
+	}
+
+	template := &EmailTemplate{}
+	if err = runtimeValueFromMap(result, template); err != nil {
+		rp.logger.Error("Could not convert Email Template result", zap.Any("result", result), zap.Error(err))
+		return nil, errors.New("Invalid return type from runtime Email Template function, must be an object.")
+	}
+	return template, nil
+}
+
+func (rp *RuntimeProviderJS) StorageExpiry(ctx context.Context, objects []*api.StorageObject) error {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err
+	}
+	jsFn := r.GetCallback(RuntimeExecutionModeStorageExpiry, "")
+	if jsFn == "" {
+		rp.Put(r)
+		return errors.New("Runtime Storage Expiry function not found.")
+	}
+
+	objectMaps := make([]interface{}, 0, len(objects))
+	for _, o := range objects {
+		valueMap := make(map[string]interface{})
+		if err = json.Unmarshal([]byte(o.Value), &valueMap); err != nil {
+			rp.Put(r)
+			return fmt.Errorf("failed to convert value to json: %s", err.Error())
+		}
+		objectMaps = append(objectMaps, map[string]interface{}{
+			"key":             o.Key,
+			"collection":      o.Collection,
+			"userId":          o.UserId,
+			"version":         o.Version,
+			"permissionRead":  o.PermissionRead,
+			"permissionWrite": o.PermissionWrite,
+			"createTime":      o.CreateTime.GetSeconds(),
+			"updateTime":      o.UpdateTime.GetSeconds(),
+			"value":           valueMap,
+		})
+	}
+
+	fn, ok := goja.AssertFunction(r.vm.Get(jsFn))
+	if !ok {
+		rp.Put(r)
+		rp.logger.Error("JavaScript runtime function invalid.", zap.String("key", jsFn), zap.Error(err))
+		return errors.New("Could not run Storage Expiry hook.")
+	}
+
+	jsLogger, err := NewJsLogger(r.vm, r.logger, zap.String("mode", RuntimeExecutionModeStorageExpiry.String()))
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not instantiate js logger.", zap.Error(err))
+		return errors.New("Could not run Storage Expiry hook.")
+	}
+
+	r.SetContext(ctx)
+	_, err, _ = r.InvokeFunction(RuntimeExecutionModeStorageExpiry, "storageExpiry", fn, jsLogger, nil, nil, "", "", nil, 0, "", "", "", "", objectMaps)
+	r.SetContext(context.Background())
+	rp.Put(r)
+	if err != nil {
+		return fmt.Errorf("Error running runtime Storage Expiry hook: %v", err.Error())
+	}
+	return nil
+}
+
 func (rp *RuntimeProviderJS) PurchaseNotificationApple(ctx context.Context, purchase *api.ValidatedPurchase, providerPayload string) error {
 	r, err := rp.Get(ctx)
 	if err != nil {
@@ -2342,7 +2757,7 @@ func (rp *RuntimeProviderJS) StorageIndexFilter(ctx context.Context, indexName s
 	return filterResult, nil
 }
 
-func evalRuntimeModules(rp *RuntimeProviderJS, modCache *RuntimeJSModuleCache, matchHandlers *RuntimeJavascriptMatchHandlers, matchProvider *MatchProvider, leaderboardScheduler LeaderboardScheduler, storageIndex StorageIndex, localCache *RuntimeJavascriptLocalCache, announceCallbackFn func(RuntimeExecutionMode, string), dryRun bool) (*RuntimeJavascriptCallbacks, error) {
+func evalRuntimeModules(rp *RuntimeProviderJS, modCache *RuntimeJSModuleCache, matchHandlers *RuntimeJavascriptMatchHandlers, matchProvider *MatchProvider, leaderboardScheduler LeaderboardScheduler, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, localCache *RuntimeJavascriptLocalCache, announceCallbackFn func(RuntimeExecutionMode, string), dryRun bool) (*RuntimeJavascriptCallbacks, error) {
 	logger := rp.logger
 
 	r := goja.New()
@@ -2360,7 +2775,7 @@ func evalRuntimeModules(rp *RuntimeProviderJS, modCache *RuntimeJSModuleCache, m
 	}
 	modName := modCache.Names[0]
 
-	initializer := NewRuntimeJavascriptInitModule(logger, modCache.Modules[modName].Ast, storageIndex, callbacks, matchHandlers, announceCallbackFn)
+	initializer := NewRuntimeJavascriptInitModule(logger, modCache.Modules[modName].Ast, storageIndex, storageCollections, storeCatalog, callbacks, matchHandlers, announceCallbackFn)
 	init, err := initializer.Constructor(r)
 	if err != nil {
 		return nil, err
@@ -2371,7 +2786,7 @@ func evalRuntimeModules(rp *RuntimeProviderJS, modCache *RuntimeJSModuleCache, m
 		return nil, err
 	}
 
-	nakamaModule := NewRuntimeJavascriptNakamaModule(rp.logger, rp.db, rp.protojsonMarshaler, rp.protojsonUnmarshaler, rp.config, rp.socialClient, rp.leaderboardCache, rp.leaderboardRankCache, storageIndex, localCache, leaderboardScheduler, rp.sessionRegistry, rp.sessionCache, rp.statusRegistry, rp.matchRegistry, rp.tracker, rp.metrics, rp.streamManager, rp.router, rp.eventFn, matchProvider.CreateMatch)
+	nakamaModule := NewRuntimeJavascriptNakamaModule(rp.logger, rp.db, rp.protojsonMarshaler, rp.protojsonUnmarshaler, rp.config, rp.socialClient, rp.leaderboardCache, rp.leaderboardRankCache, storageIndex, storageCollections, storeCatalog, rp.groupIndex, rp.rateLimiter, rp.namePolicy, localCache, leaderboardScheduler, rp.sessionRegistry, rp.sessionCache, rp.statusRegistry, rp.matchRegistry, rp.tracker, rp.metrics, rp.streamManager, rp.router, rp.eventFn, matchProvider.CreateMatch)
 	nk, err := nakamaModule.Constructor(r)
 	if err != nil {
 		return nil, err
@@ -16,6 +16,7 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -73,6 +74,13 @@ type RuntimeJavascriptCallbacks struct {
 	SubscriptionNotificationApple  string
 	PurchaseNotificationGoogle     string
 	SubscriptionNotificationGoogle string
+	BeforeAccountMerge             string
+	BeforeTrade                    string
+	AfterTrade                     string
+	StorageExpiry                  string
+	BeforeOIDC                     string
+	AfterOIDC                      string
+	EmailTemplate                  string
 }
 
 type RuntimeJavascriptInitModule struct {
@@ -81,13 +89,17 @@ type RuntimeJavascriptInitModule struct {
 	MatchCallbacks     *RuntimeJavascriptMatchHandlers
 	announceCallbackFn func(RuntimeExecutionMode, string)
 	storageIndex       StorageIndex
+	storageCollections StorageCollectionRegistry
+	storeCatalog       StoreCatalog
 	ast                *ast.Program
 }
 
-func NewRuntimeJavascriptInitModule(logger *zap.Logger, ast *ast.Program, storageIndex StorageIndex, callbacks *RuntimeJavascriptCallbacks, matchCallbacks *RuntimeJavascriptMatchHandlers, announceCallbackFn func(RuntimeExecutionMode, string)) *RuntimeJavascriptInitModule {
+func NewRuntimeJavascriptInitModule(logger *zap.Logger, ast *ast.Program, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, callbacks *RuntimeJavascriptCallbacks, matchCallbacks *RuntimeJavascriptMatchHandlers, announceCallbackFn func(RuntimeExecutionMode, string)) *RuntimeJavascriptInitModule {
 	return &RuntimeJavascriptInitModule{
 		Logger:             logger,
 		storageIndex:       storageIndex,
+		storageCollections: storageCollections,
+		storeCatalog:       storeCatalog,
 		announceCallbackFn: announceCallbackFn,
 		Callbacks:          callbacks,
 		MatchCallbacks:     matchCallbacks,
@@ -265,6 +277,15 @@ func (im *RuntimeJavascriptInitModule) mappings(r *goja.Runtime) map[string]func
 		"registerAfterEvent":                              im.registerAfterEvent(r),
 		"registerStorageIndex":                            im.registerStorageIndex(r),
 		"registerStorageIndexFilter":                      im.registerStorageIndexFilter(r),
+		"registerStorageExpiry":                           im.registerStorageExpiry(r),
+		"registerBeforeAccountMerge":                      im.registerBeforeAccountMerge(r),
+		"registerBeforeTrade":                             im.registerBeforeTrade(r),
+		"registerAfterTrade":                              im.registerAfterTrade(r),
+		"registerBeforeOIDC":                              im.registerBeforeOIDC(r),
+		"registerAfterOIDC":                               im.registerAfterOIDC(r),
+		"registerEmailTemplate":                           im.registerEmailTemplate(r),
+		"registerStorageCollectionRules":                  im.registerStorageCollectionRules(r),
+		"registerStoreProduct":                            im.registerStoreProduct(r),
 	}
 }
 
@@ -1035,6 +1056,80 @@ func (im *RuntimeJavascriptInitModule) registerStorageIndex(r *goja.Runtime) fun
 	}
 }
 
+func (im *RuntimeJavascriptInitModule) registerStorageCollectionRules(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		config := &StorageCollectionRulesConfig{Collection: getJsString(r, f.Argument(0))}
+
+		if schema := f.Argument(1); !goja.IsUndefined(schema) && !goja.IsNull(schema) {
+			switch exported := schema.Export().(type) {
+			case string:
+				config.Schema = exported
+			case map[string]any:
+				schemaBytes, err := json.Marshal(exported)
+				if err != nil {
+					panic(r.NewTypeError(fmt.Sprintf("failed to convert schema: %s", err.Error())))
+				}
+				config.Schema = string(schemaBytes)
+			default:
+				panic(r.NewTypeError("expects schema to be an object or string"))
+			}
+		}
+
+		if !goja.IsUndefined(f.Argument(2)) && !goja.IsNull(f.Argument(2)) {
+			config.MaxValueSizeBytes = int(getJsInt(r, f.Argument(2)))
+		}
+		if !goja.IsUndefined(f.Argument(3)) && !goja.IsNull(f.Argument(3)) {
+			config.MaxObjectsPerUser = int(getJsInt(r, f.Argument(3)))
+		}
+
+		for i, permissions := range []*[]int{&config.PermissionRead, &config.PermissionWrite} {
+			permissionsArray := f.Argument(4 + i)
+			if goja.IsUndefined(permissionsArray) || goja.IsNull(permissionsArray) {
+				continue
+			}
+			values, err := exportToSlice[[]any](permissionsArray)
+			if err != nil {
+				panic(r.NewTypeError("expects an array of permission numbers"))
+			}
+			for _, value := range values {
+				switch v := value.(type) {
+				case int64:
+					*permissions = append(*permissions, int(v))
+				case float64:
+					*permissions = append(*permissions, int(v))
+				default:
+					panic(r.NewTypeError("expects an array of permission numbers"))
+				}
+			}
+		}
+
+		if err := im.storageCollections.RegisterCollectionRules(config); err != nil {
+			panic(r.NewGoError(fmt.Errorf("Failed to register storage collection rules: %s", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+func (im *RuntimeJavascriptInitModule) registerStoreProduct(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		productMap, ok := f.Argument(0).Export().(map[string]any)
+		if !ok {
+			panic(r.NewTypeError("expects a product object"))
+		}
+		product, err := storeProductFromMap(productMap)
+		if err != nil {
+			panic(r.NewTypeError(fmt.Sprintf("invalid product: %s", err.Error())))
+		}
+
+		if err = im.storeCatalog.RegisterProduct(product); err != nil {
+			panic(r.NewGoError(fmt.Errorf("Failed to register store product: %s", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
 func (im *RuntimeJavascriptInitModule) registerStorageIndexFilter(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
 	return func(f goja.FunctionCall) goja.Value {
 		fName := f.Argument(0)
@@ -1353,6 +1448,139 @@ func (im *RuntimeJavascriptInitModule) registerLeaderboardReset(r *goja.Runtime)
 	}
 }
 
+func (im *RuntimeJavascriptInitModule) registerStorageExpiry(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		fn := f.Argument(0)
+		_, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.NewTypeError("expects a function"))
+		}
+
+		fnKey, err := im.extractHookFn("registerStorageExpiry")
+		if err != nil {
+			panic(r.NewGoError(err))
+		}
+		im.registerCallbackFn(RuntimeExecutionModeStorageExpiry, "", fnKey)
+		im.announceCallbackFn(RuntimeExecutionModeStorageExpiry, "")
+
+		return goja.Undefined()
+	}
+}
+
+func (im *RuntimeJavascriptInitModule) registerBeforeAccountMerge(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		fn := f.Argument(0)
+		_, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.NewTypeError("expects a function"))
+		}
+
+		fnKey, err := im.extractHookFn("registerBeforeAccountMerge")
+		if err != nil {
+			panic(r.NewGoError(err))
+		}
+		im.registerCallbackFn(RuntimeExecutionModeBeforeAccountMerge, "", fnKey)
+		im.announceCallbackFn(RuntimeExecutionModeBeforeAccountMerge, "")
+
+		return goja.Undefined()
+	}
+}
+
+func (im *RuntimeJavascriptInitModule) registerBeforeTrade(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		fn := f.Argument(0)
+		_, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.NewTypeError("expects a function"))
+		}
+
+		fnKey, err := im.extractHookFn("registerBeforeTrade")
+		if err != nil {
+			panic(r.NewGoError(err))
+		}
+		im.registerCallbackFn(RuntimeExecutionModeBeforeTrade, "", fnKey)
+		im.announceCallbackFn(RuntimeExecutionModeBeforeTrade, "")
+
+		return goja.Undefined()
+	}
+}
+
+func (im *RuntimeJavascriptInitModule) registerAfterTrade(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		fn := f.Argument(0)
+		_, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.NewTypeError("expects a function"))
+		}
+
+		fnKey, err := im.extractHookFn("registerAfterTrade")
+		if err != nil {
+			panic(r.NewGoError(err))
+		}
+		im.registerCallbackFn(RuntimeExecutionModeAfterTrade, "", fnKey)
+		im.announceCallbackFn(RuntimeExecutionModeAfterTrade, "")
+
+		return goja.Undefined()
+	}
+}
+
+func (im *RuntimeJavascriptInitModule) registerBeforeOIDC(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		fn := f.Argument(0)
+		_, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.NewTypeError("expects a function"))
+		}
+
+		fnKey, err := im.extractHookFn("registerBeforeOIDC")
+		if err != nil {
+			panic(r.NewGoError(err))
+		}
+		im.registerCallbackFn(RuntimeExecutionModeBeforeOIDC, "", fnKey)
+		im.announceCallbackFn(RuntimeExecutionModeBeforeOIDC, "")
+
+		return goja.Undefined()
+	}
+}
+
+func (im *RuntimeJavascriptInitModule) registerAfterOIDC(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		fn := f.Argument(0)
+		_, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.NewTypeError("expects a function"))
+		}
+
+		fnKey, err := im.extractHookFn("registerAfterOIDC")
+		if err != nil {
+			panic(r.NewGoError(err))
+		}
+		im.registerCallbackFn(RuntimeExecutionModeAfterOIDC, "", fnKey)
+		im.announceCallbackFn(RuntimeExecutionModeAfterOIDC, "")
+
+		return goja.Undefined()
+	}
+}
+
+func (im *RuntimeJavascriptInitModule) registerEmailTemplate(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		fn := f.Argument(0)
+		_, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.NewTypeError("expects a function"))
+		}
+
+		fnKey, err := im.extractHookFn("registerEmailTemplate")
+		if err != nil {
+			panic(r.NewGoError(err))
+		}
+		im.registerCallbackFn(RuntimeExecutionModeEmailTemplate, "", fnKey)
+		im.announceCallbackFn(RuntimeExecutionModeEmailTemplate, "")
+
+		return goja.Undefined()
+	}
+}
+
 func (im *RuntimeJavascriptInitModule) registerPurchaseNotificationApple(r *goja.Runtime) func(call goja.FunctionCall) goja.Value {
 	return func(f goja.FunctionCall) goja.Value {
 		fn := f.Argument(0)
@@ -1663,5 +1891,19 @@ func (im *RuntimeJavascriptInitModule) registerCallbackFn(mode RuntimeExecutionM
 		im.Callbacks.SubscriptionNotificationGoogle = fn
 	case RuntimeExecutionModeStorageIndexFilter:
 		im.Callbacks.StorageIndexFilter[key] = fn
+	case RuntimeExecutionModeBeforeAccountMerge:
+		im.Callbacks.BeforeAccountMerge = fn
+	case RuntimeExecutionModeBeforeTrade:
+		im.Callbacks.BeforeTrade = fn
+	case RuntimeExecutionModeAfterTrade:
+		im.Callbacks.AfterTrade = fn
+	case RuntimeExecutionModeStorageExpiry:
+		im.Callbacks.StorageExpiry = fn
+	case RuntimeExecutionModeBeforeOIDC:
+		im.Callbacks.BeforeOIDC = fn
+	case RuntimeExecutionModeAfterOIDC:
+		im.Callbacks.AfterOIDC = fn
+	case RuntimeExecutionModeEmailTemplate:
+		im.Callbacks.EmailTemplate = fn
 	}
 }
@@ -47,6 +47,7 @@ import (
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/rtapi"
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/heroiclabs/nakama/v3/iap"
 	"github.com/heroiclabs/nakama/v3/internal/cronexpr"
 	"github.com/heroiclabs/nakama/v3/internal/satori"
 	"github.com/heroiclabs/nakama/v3/social"
@@ -80,6 +81,11 @@ type runtimeJavascriptNakamaModule struct {
 	streamManager        StreamManager
 	router               MessageRouter
 	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	storeCatalog         StoreCatalog
+	groupIndex           GroupIndex
+	rateLimiter          RateLimiter
+	namePolicy           NamePolicy
 
 	node          string
 	matchCreateFn RuntimeMatchCreateFunction
@@ -88,7 +94,7 @@ type runtimeJavascriptNakamaModule struct {
 	satori runtime.Satori
 }
 
-func NewRuntimeJavascriptNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, socialClient *social.Client, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, storageIndex StorageIndex, localCache *RuntimeJavascriptLocalCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, eventFn RuntimeEventCustomFunction, matchCreateFn RuntimeMatchCreateFunction) *runtimeJavascriptNakamaModule {
+func NewRuntimeJavascriptNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, socialClient *social.Client, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy, localCache *RuntimeJavascriptLocalCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, eventFn RuntimeEventCustomFunction, matchCreateFn RuntimeMatchCreateFunction) *runtimeJavascriptNakamaModule {
 	return &runtimeJavascriptNakamaModule{
 		ctx:                  context.Background(),
 		logger:               logger,
@@ -112,6 +118,11 @@ func NewRuntimeJavascriptNakamaModule(logger *zap.Logger, db *sql.DB, protojsonM
 		httpClient:           &http.Client{},
 		httpClientInsecure:   &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}},
 		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		storeCatalog:         storeCatalog,
+		groupIndex:           groupIndex,
+		rateLimiter:          rateLimiter,
+		namePolicy:           namePolicy,
 
 		node:          config.GetName(),
 		eventFn:       eventFn,
@@ -148,6 +159,9 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"metricsTimerRecord":                   n.metricsTimerRecord(r),
 		"uuidv4":                               n.uuidV4(r),
 		"cronPrev":                             n.cronPrev(r),
+		"rateLimitCheck":                       n.rateLimitCheck(r),
+		"rateLimitConsume":                     n.rateLimitConsume(r),
+		"namePolicyCheck":                      n.namePolicyCheck(r),
 		"cronNext":                             n.cronNext(r),
 		"sqlExec":                              n.sqlExec(r),
 		"sqlQuery":                             n.sqlQuery(r),
@@ -178,11 +192,13 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"authenticateGameCenter":               n.authenticateGameCenter(r),
 		"authenticateGoogle":                   n.authenticateGoogle(r),
 		"authenticateSteam":                    n.authenticateSteam(r),
+		"authenticateOidc":                     n.authenticateOIDC(r),
 		"authenticateTokenGenerate":            n.authenticateTokenGenerate(r),
 		"accountGetId":                         n.accountGetId(r),
 		"accountsGetId":                        n.accountsGetId(r),
 		"accountUpdateId":                      n.accountUpdateId(r),
 		"accountDeleteId":                      n.accountDeleteId(r),
+		"accountsMerge":                        n.accountsMerge(r),
 		"accountExportId":                      n.accountExportId(r),
 		"usersGetId":                           n.usersGetId(r),
 		"usersGetUsername":                     n.usersGetUsername(r),
@@ -198,6 +214,7 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"linkGameCenter":                       n.linkGameCenter(r),
 		"linkGoogle":                           n.linkGoogle(r),
 		"linkSteam":                            n.linkSteam(r),
+		"linkOidc":                             n.linkOIDC(r),
 		"unlinkApple":                          n.unlinkApple(r),
 		"unlinkCustom":                         n.unlinkCustom(r),
 		"unlinkDevice":                         n.unlinkDevice(r),
@@ -207,6 +224,8 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"unlinkGameCenter":                     n.unlinkGameCenter(r),
 		"unlinkGoogle":                         n.unlinkGoogle(r),
 		"unlinkSteam":                          n.unlinkSteam(r),
+		"unlinkOidc":                           n.unlinkOIDC(r),
+		"userIdentitiesList":                   n.userIdentitiesList(r),
 		"streamUserList":                       n.streamUserList(r),
 		"streamUserGet":                        n.streamUserGet(r),
 		"streamUserJoin":                       n.streamUserJoin(r),
@@ -219,6 +238,10 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"streamSendRaw":                        n.streamSendRaw(r),
 		"sessionDisconnect":                    n.sessionDisconnect(r),
 		"sessionLogout":                        n.sessionLogout(r),
+		"sessionsList":                         n.sessionsList(r),
+		"totpEnabled":                          n.totpEnabled(r),
+		"totpVerify":                           n.totpVerify(r),
+		"sessionRevoke":                        n.sessionRevoke(r),
 		"matchCreate":                          n.matchCreate(r),
 		"matchGet":                             n.matchGet(r),
 		"matchList":                            n.matchList(r),
@@ -231,12 +254,19 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"walletsUpdate":                        n.walletsUpdate(r),
 		"walletLedgerUpdate":                   n.walletLedgerUpdate(r),
 		"walletLedgerList":                     n.walletLedgerList(r),
+		"walletHold":                           n.walletHold(r),
+		"walletHoldCapture":                    n.walletHoldCapture(r),
+		"walletHoldRelease":                    n.walletHoldRelease(r),
+		"walletHoldsList":                      n.walletHoldsList(r),
 		"storageList":                          n.storageList(r),
 		"storageRead":                          n.storageRead(r),
 		"storageWrite":                         n.storageWrite(r),
 		"storageDelete":                        n.storageDelete(r),
+		"storageHistoryList":                   n.storageHistoryList(r),
+		"storageHistoryRestore":                n.storageHistoryRestore(r),
 		"multiUpdate":                          n.multiUpdate(r),
 		"leaderboardCreate":                    n.leaderboardCreate(r),
+		"leaderboardGroupAggregateCreate":      n.leaderboardGroupAggregateCreate(r),
 		"leaderboardDelete":                    n.leaderboardDelete(r),
 		"leaderboardList":                      n.leaderboardList(r),
 		"leaderboardRecordsList":               n.leaderboardRecordsList(r),
@@ -250,6 +280,8 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"purchaseValidateHuawei":               n.purchaseValidateHuawei(r),
 		"purchaseValidateFacebookInstant":      n.purchaseValidateFacebookInstant(r),
 		"purchaseGetByTransactionId":           n.purchaseGetByTransactionId(r),
+		"purchaseHistoryApple":                 n.purchaseHistoryApple(r),
+		"purchaseRefundsApple":                 n.purchaseRefundsApple(r),
 		"purchasesList":                        n.purchasesList(r),
 		"subscriptionValidateApple":            n.subscriptionValidateApple(r),
 		"subscriptionValidateGoogle":           n.subscriptionValidateGoogle(r),
@@ -265,11 +297,25 @@ func (n *runtimeJavascriptNakamaModule) mappings(r *goja.Runtime) map[string]fun
 		"tournamentRecordWrite":                n.tournamentRecordWrite(r),
 		"tournamentRecordDelete":               n.tournamentRecordDelete(r),
 		"tournamentRecordsHaystack":            n.tournamentRecordsHaystack(r),
+		"leagueCreate":                         n.leagueCreate(r),
+		"leagueDelete":                         n.leagueDelete(r),
+		"leagueJoin":                           n.leagueJoin(r),
+		"leagueLeave":                          n.leagueLeave(r),
+		"leagueCohortGet":                      n.leagueCohortGet(r),
 		"groupsGetId":                          n.groupsGetId(r),
 		"groupCreate":                          n.groupCreate(r),
 		"groupUpdate":                          n.groupUpdate(r),
 		"groupDelete":                          n.groupDelete(r),
 		"groupUsersKick":                       n.groupUsersKick(r),
+		"groupRoleUpsert":                      n.groupRoleUpsert(r),
+		"groupRoleDelete":                      n.groupRoleDelete(r),
+		"groupRolesList":                       n.groupRolesList(r),
+		"groupUserRoleSet":                     n.groupUserRoleSet(r),
+		"groupUsersInvite":                     n.groupUsersInvite(r),
+		"groupInviteAccept":                    n.groupInviteAccept(r),
+		"groupInviteReject":                    n.groupInviteReject(r),
+		"groupInvitesList":                     n.groupInvitesList(r),
+		"groupApplicationsList":                n.groupApplicationsList(r),
 		"groupUsersList":                       n.groupUsersList(r),
 		"userGroupsList":                       n.userGroupsList(r),
 		"friendsList":                          n.friendsList(r),
@@ -550,6 +596,91 @@ func (n *runtimeJavascriptNakamaModule) cronPrev(r *goja.Runtime) func(goja.Func
 	}
 }
 
+// @group utils
+// @summary Check whether a runtime defined rate limit bucket has enough tokens for a request, without consuming them.
+// @param key(type=string) Bucket key, for example an operation name combined with a user ID.
+// @param rate(type=number) Tokens added to the bucket per second.
+// @param burst(type=number) Maximum tokens the bucket holds, and the tokens in a new bucket.
+// @param cost(type=number, optional=true, default=1) Tokens the request needs.
+// @return result(nkruntime.RateLimitResult) Whether the bucket has enough tokens, the tokens in it, and the seconds until it would have enough.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) rateLimitCheck(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return n.rateLimitTake(r, false)
+}
+
+// @group utils
+// @summary Consume tokens from a runtime defined rate limit bucket if it has enough for a request.
+// @param key(type=string) Bucket key, for example an operation name combined with a user ID.
+// @param rate(type=number) Tokens added to the bucket per second.
+// @param burst(type=number) Maximum tokens the bucket holds, and the tokens in a new bucket.
+// @param cost(type=number, optional=true, default=1) Tokens the request needs.
+// @return result(nkruntime.RateLimitResult) Whether the tokens were consumed, the tokens left, and the seconds until the bucket would have enough.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) rateLimitConsume(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return n.rateLimitTake(r, true)
+}
+
+func (n *runtimeJavascriptNakamaModule) rateLimitTake(r *goja.Runtime, consume bool) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		key := getJsString(r, f.Argument(0))
+		if key == "" {
+			panic(r.NewTypeError("expects key"))
+		}
+
+		rate := getJsFloat(r, f.Argument(1))
+		if rate <= 0 {
+			panic(r.NewTypeError("expects rate to be > 0"))
+		}
+
+		burst := int(getJsInt(r, f.Argument(2)))
+		if burst < 1 {
+			panic(r.NewTypeError("expects burst to be >= 1"))
+		}
+
+		cost := 1
+		if f.Argument(3) != goja.Undefined() && f.Argument(3) != goja.Null() {
+			cost = int(getJsInt(r, f.Argument(3)))
+		}
+		if cost < 1 || cost > burst {
+			panic(r.NewTypeError("expects cost to be >= 1 and <= burst"))
+		}
+
+		allowed, remaining, wait := n.rateLimiter.Take(key, rate, burst, cost, consume)
+
+		return r.ToValue(map[string]interface{}{
+			"allowed":       allowed,
+			"remaining":     remaining,
+			"retryAfterSec": rateLimitRetryAfterSec(wait),
+		})
+	}
+}
+
+// @group utils
+// @summary Check a username, display name, group name or channel message against the configured name policy.
+// @param field(type=string) What is checked, one of "username", "display_name", "group_name" or "channel_message".
+// @param value(type=string) The name or message to check.
+// @return violation(nkruntime.NamePolicyViolation) An object with the field, reason and value if the check fails, or null if it passes.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) namePolicyCheck(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		field := getJsString(r, f.Argument(0))
+		if _, found := namePolicyFieldLabels[field]; !found {
+			panic(r.NewTypeError("expects field to be one of username, display_name, group_name or channel_message"))
+		}
+		value := getJsString(r, f.Argument(1))
+
+		if err := n.namePolicy.Check(field, value); err != nil {
+			v, ok := err.(*NamePolicyViolation)
+			if !ok {
+				panic(r.NewGoError(fmt.Errorf("error checking name policy: %v", err.Error())))
+			}
+			return r.ToValue(v.Map())
+		}
+
+		return goja.Null()
+	}
+}
+
 // @group utils
 // @summary Execute an arbitrary SQL query and return the number of rows affected. Typically, an "INSERT", "DELETE", or "UPDATE" statement with no return columns.
 // @param query(type=string) A SQL query to execute.
@@ -1316,7 +1447,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateApple(r *goja.Runtime) func(
 			create = getJsBool(r, f.Argument(2))
 		}
 
-		dbUserID, dbUsername, created, err := AuthenticateApple(n.ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().Apple.BundleId, token, username, create)
+		dbUserID, dbUsername, created, err := AuthenticateApple(n.ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().Apple.BundleId, token, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1367,7 +1498,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateCustom(r *goja.Runtime) func
 			create = getJsBool(r, f.Argument(2))
 		}
 
-		dbUserID, dbUsername, created, err := AuthenticateCustom(n.ctx, n.logger, n.db, id, username, create)
+		dbUserID, dbUsername, created, err := AuthenticateCustom(n.ctx, n.logger, n.db, nil, id, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1418,7 +1549,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateDevice(r *goja.Runtime) func
 			create = getJsBool(r, f.Argument(2))
 		}
 
-		dbUserID, dbUsername, created, err := AuthenticateDevice(n.ctx, n.logger, n.db, id, username, create)
+		dbUserID, dbUsername, created, err := AuthenticateDevice(n.ctx, n.logger, n.db, nil, id, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1491,11 +1622,11 @@ func (n *runtimeJavascriptNakamaModule) authenticateEmail(r *goja.Runtime) func(
 		var err error
 
 		if attemptUsernameLogin {
-			dbUserID, err = AuthenticateUsername(n.ctx, n.logger, n.db, username, password)
+			dbUserID, err = AuthenticateUsername(n.ctx, n.logger, n.db, n.config, username, password)
 		} else {
 			cleanEmail := strings.ToLower(email)
 
-			dbUserID, username, created, err = AuthenticateEmail(n.ctx, n.logger, n.db, cleanEmail, password, username, create)
+			dbUserID, username, created, err = AuthenticateEmail(n.ctx, n.logger, n.db, n.config, nil, cleanEmail, password, username, create)
 		}
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
@@ -1549,7 +1680,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateFacebook(r *goja.Runtime) fu
 			create = getJsBool(r, f.Argument(3))
 		}
 
-		dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(n.ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().FacebookLimitedLogin.AppId, token, username, create)
+		dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(n.ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().FacebookLimitedLogin.AppId, token, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1601,7 +1732,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateFacebookInstantGame(r *goja.
 			create = getJsBool(r, f.Argument(2))
 		}
 
-		dbUserID, dbUsername, created, err := AuthenticateFacebookInstantGame(n.ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().FacebookInstantGame.AppSecret, signedPlayerInfo, username, create)
+		dbUserID, dbUsername, created, err := AuthenticateFacebookInstantGame(n.ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().FacebookInstantGame.AppSecret, signedPlayerInfo, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1673,7 +1804,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateGameCenter(r *goja.Runtime)
 			create = getJsBool(r, f.Argument(7))
 		}
 
-		dbUserID, dbUsername, created, err := AuthenticateGameCenter(n.ctx, n.logger, n.db, n.socialClient, playerID, bundleID, ts, salt, signature, publicKeyURL, username, create)
+		dbUserID, dbUsername, created, err := AuthenticateGameCenter(n.ctx, n.logger, n.db, n.socialClient, nil, playerID, bundleID, ts, salt, signature, publicKeyURL, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1720,7 +1851,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateGoogle(r *goja.Runtime) func
 			create = getJsBool(r, f.Argument(2))
 		}
 
-		dbUserID, dbUsername, created, err := AuthenticateGoogle(n.ctx, n.logger, n.db, n.socialClient, token, username, create)
+		dbUserID, dbUsername, created, err := AuthenticateGoogle(n.ctx, n.logger, n.db, n.socialClient, nil, token, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1777,7 +1908,7 @@ func (n *runtimeJavascriptNakamaModule) authenticateSteam(r *goja.Runtime) func(
 			create = getJsBool(r, f.Argument(3))
 		}
 
-		dbUserID, dbUsername, steamID, created, err := AuthenticateSteam(n.ctx, n.logger, n.db, n.socialClient, n.config.GetSocial().Steam.AppID, n.config.GetSocial().Steam.PublisherKey, token, username, create)
+		dbUserID, dbUsername, steamID, created, err := AuthenticateSteam(n.ctx, n.logger, n.db, n.socialClient, nil, n.config.GetSocial().Steam.AppID, n.config.GetSocial().Steam.PublisherKey, token, username, create)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
 		}
@@ -1796,6 +1927,59 @@ func (n *runtimeJavascriptNakamaModule) authenticateSteam(r *goja.Runtime) func(
 	}
 }
 
+// @group authenticate
+// @summary Authenticate user and create a session token using an ID token issued by a configured OpenID Connect provider.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string) ID token issued by the provider.
+// @param username(type=string, optional=true) The user's username. If left empty, one is generated.
+// @param create(type=bool, optional=true, default=true) Create user if one didn't exist previously.
+// @return userID(string) The user ID of the authenticated user.
+// @return username(string) The username of the authenticated user.
+// @return create(bool) Value indicating if this account was just created or already existed.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) authenticateOIDC(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		provider, err := oidcProviderConfig(n.config, getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects a configured OIDC provider name"))
+		}
+
+		token := getJsString(r, f.Argument(1))
+		if token == "" {
+			panic(r.NewTypeError("expects token string"))
+		}
+
+		username := ""
+		if f.Argument(2) != goja.Undefined() {
+			username = getJsString(r, f.Argument(2))
+		}
+
+		if username == "" {
+			username = generateUsername()
+		} else if invalidUsernameRegex.MatchString(username) {
+			panic(r.NewTypeError("expects username to be valid, no spaces or control characters allowed"))
+		} else if len(username) > 128 {
+			panic(r.NewTypeError("expects id to be valid, must be 1-128 bytes"))
+		}
+
+		create := true
+		if f.Argument(3) != goja.Undefined() {
+			create = getJsBool(r, f.Argument(3))
+		}
+
+		dbUserID, dbUsername, created, err := AuthenticateOIDC(n.ctx, n.logger, n.db, n.socialClient, nil, provider, token, username, create)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error authenticating: %v", err.Error())))
+		}
+
+		return r.ToValue(map[string]interface{}{
+			"userId":   dbUserID,
+			"username": dbUsername,
+			"created":  created,
+		})
+	}
+}
+
 // @group authenticate
 // @summary Generate a Nakama session token from a user ID.
 // @param userId(type=string) User ID to use to generate the token.
@@ -1838,6 +2022,10 @@ func (n *runtimeJavascriptNakamaModule) authenticateTokenGenerate(r *goja.Runtim
 
 		tokenId := uuid.Must(uuid.NewV4()).String()
 		token, exp := generateTokenWithExpiry(n.config.GetSession().EncryptionKey, tokenId, userIDString, username, vars, exp)
+		// Recorded so it can be listed and revoked like sessions issued by authentication.
+		if err = SessionRecord(n.ctx, n.logger, n.db, uid, tokenId, tokenId, vars, "", "", exp); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error recording session: %v", err.Error())))
+		}
 		n.sessionCache.Add(uid, exp, tokenId, 0, "")
 
 		return r.ToValue(map[string]interface{}{
@@ -2012,7 +2200,7 @@ func (n *runtimeJavascriptNakamaModule) accountDeleteId(r *goja.Runtime) func(go
 			recorded = getJsBool(r, f.Argument(1))
 		}
 
-		if err := DeleteAccount(n.ctx, n.logger, n.db, n.config, n.leaderboardCache, n.rankCache, n.sessionRegistry, n.sessionCache, n.tracker, userID, recorded); err != nil {
+		if err := DeleteAccount(n.ctx, n.logger, n.db, n.config, n.metrics, n.leaderboardCache, n.rankCache, n.storageIndex, n.storageCollections, n.groupIndex, n.sessionRegistry, n.sessionCache, n.tracker, n.router, userID, recorded); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to delete account: %v", err.Error())))
 		}
 
@@ -2020,6 +2208,44 @@ func (n *runtimeJavascriptNakamaModule) accountDeleteId(r *goja.Runtime) func(go
 	}
 }
 
+// @group accounts
+// @summary Merge a source account into a target account. Linked identities, friends, group memberships, storage objects, wallet balances and leaderboard records are moved to the target, then the source account is deleted.
+// @param sourceUserId(type=string) User ID of the account merged and deleted. Must be valid UUID.
+// @param targetUserId(type=string) User ID of the account kept. Must be valid UUID.
+// @param storage(type=string, optional=true, default="target") Which storage object is kept when both accounts have one with the same collection and key, "target" or "source".
+// @param leaderboard(type=string, optional=true, default="best") Which leaderboard record is kept when both accounts have one, "best", "target" or "source".
+// @param wallet(type=string, optional=true, default="sum") Whether the source wallet is added to the target wallet, "sum", or dropped, "target".
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) accountsMerge(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		sourceID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("invalid source user id"))
+		}
+		targetID, err := uuid.FromString(getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("invalid target user id"))
+		}
+
+		policy := NewAccountMergePolicy(sourceID, targetID)
+		if !goja.IsUndefined(f.Argument(2)) && !goja.IsNull(f.Argument(2)) {
+			policy.Storage = getJsString(r, f.Argument(2))
+		}
+		if !goja.IsUndefined(f.Argument(3)) && !goja.IsNull(f.Argument(3)) {
+			policy.Leaderboard = getJsString(r, f.Argument(3))
+		}
+		if !goja.IsUndefined(f.Argument(4)) && !goja.IsNull(f.Argument(4)) {
+			policy.Wallet = getJsString(r, f.Argument(4))
+		}
+
+		if err := AccountMerge(n.ctx, n.logger, n.db, n.config, n.metrics, n.leaderboardCache, n.rankCache, n.storageIndex, n.storageCollections, n.groupIndex, n.sessionRegistry, n.sessionCache, n.tracker, n.router, policy); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to merge accounts: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
 // @group accounts
 // @summary Export account information for a specified user ID.
 // @param userId(type=string) User ID for the account to be exported. Must be valid UUID.
@@ -2333,7 +2559,7 @@ func (n *runtimeJavascriptNakamaModule) linkEmail(r *goja.Runtime) func(goja.Fun
 			panic(r.NewTypeError("expects password string"))
 		}
 
-		if err := LinkEmail(n.ctx, n.logger, n.db, id, email, password); err != nil {
+		if err := LinkEmail(n.ctx, n.logger, n.db, n.config, id, email, password); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error linking: %v", err.Error())))
 		}
 
@@ -2516,6 +2742,38 @@ func (n *runtimeJavascriptNakamaModule) linkSteam(r *goja.Runtime) func(goja.Fun
 	}
 }
 
+// @group authenticate
+// @summary Link an OpenID Connect provider identity to a user ID.
+// @param userId(type=string) The user ID to be linked.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string) ID token issued by the provider.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) linkOIDC(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID := getJsString(r, f.Argument(0))
+		id, err := uuid.FromString(userID)
+		if err != nil {
+			panic(r.NewTypeError("invalid user id"))
+		}
+
+		provider, err := oidcProviderConfig(n.config, getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("expects a configured OIDC provider name"))
+		}
+
+		token := getJsString(r, f.Argument(2))
+		if token == "" {
+			panic(r.NewTypeError("expects token string"))
+		}
+
+		if err := LinkOIDC(n.ctx, n.logger, n.db, n.socialClient, provider, id, token); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error linking: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
 // @group authenticate
 // @summary Unlink Apple authentication from a user ID.
 // @param userId(type=string) The user ID to be unlinked.
@@ -2775,6 +3033,69 @@ func (n *runtimeJavascriptNakamaModule) unlinkSteam(r *goja.Runtime) func(goja.F
 	}
 }
 
+// @group authenticate
+// @summary Unlink an OpenID Connect provider identity from a user ID.
+// @param userId(type=string) The user ID to be unlinked.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string, optional=true) ID token issued by the provider. If set, only unlinks the identity it belongs to.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) unlinkOIDC(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID := getJsString(r, f.Argument(0))
+		id, err := uuid.FromString(userID)
+		if err != nil {
+			panic(r.NewTypeError("invalid user id"))
+		}
+
+		provider, err := oidcProviderConfig(n.config, getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("expects a configured OIDC provider name"))
+		}
+
+		token := ""
+		if f.Argument(2) != goja.Undefined() {
+			token = getJsString(r, f.Argument(2))
+		}
+
+		if err := UnlinkOIDC(n.ctx, n.logger, n.db, n.socialClient, provider, id, token); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error unlinking: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group authenticate
+// @summary List the OpenID Connect provider identities linked to a user ID.
+// @param userId(type=string) The user ID to list identities for.
+// @return identities(nkruntime.UserIdentity[]) The linked provider names and provider user IDs.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) userIdentitiesList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID := getJsString(r, f.Argument(0))
+		id, err := uuid.FromString(userID)
+		if err != nil {
+			panic(r.NewTypeError("invalid user id"))
+		}
+
+		identities, err := UserIdentitiesList(n.ctx, n.logger, n.db, id)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error listing identities: %v", err.Error())))
+		}
+
+		identitiesArray := make([]interface{}, 0, len(identities))
+		for _, identity := range identities {
+			identitiesArray = append(identitiesArray, map[string]interface{}{
+				"provider":   identity.Provider,
+				"providerId": identity.ProviderId,
+				"createTime": identity.CreateTime,
+			})
+		}
+
+		return r.ToValue(identitiesArray)
+	}
+}
+
 // @group streams
 // @summary List all users currently online and connected to a stream.
 // @param stream(type=nkruntime.Stream) A stream object.
@@ -3451,6 +3772,123 @@ func (n *runtimeJavascriptNakamaModule) sessionLogout(r *goja.Runtime) func(goja
 	}
 }
 
+// @group sessions
+// @summary List a user's active sessions, with the device and client address each was issued to.
+// @param userId(type=string) The ID of the user to list sessions for.
+// @return sessions(nkruntime.UserSession[]) The user's sessions, most recently seen first.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) sessionsList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects valid user id"))
+		}
+
+		sessions, err := SessionsList(n.ctx, n.logger, n.db, n.sessionCache, userID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to list sessions: %s", err.Error())))
+		}
+
+		sessionsArray := make([]interface{}, 0, len(sessions))
+		for _, session := range sessions {
+			sessionsArray = append(sessionsArray, map[string]interface{}{
+				"id":           session.Id,
+				"deviceName":   session.DeviceName,
+				"platform":     session.Platform,
+				"clientIp":     session.ClientIp,
+				"createTime":   session.CreateTime,
+				"lastSeenTime": session.LastSeenTime,
+				"expiryTime":   session.ExpiryTime,
+			})
+		}
+
+		return r.ToValue(sessionsArray)
+	}
+}
+
+// @group sessions
+// @summary Revoke one of a user's sessions, disconnecting any sockets opened with it.
+// @param userId(type=string) The ID of the user the session belongs to.
+// @param sessionId(type=string) The ID of the session to revoke.
+// @param refreshOnly(type=bool, optional=true, default=false) Only revoke the session's refresh token, leaving its current session token and sockets valid until they expire.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) sessionRevoke(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects valid user id"))
+		}
+
+		sessionID := getJsString(r, f.Argument(1))
+		if sessionID == "" {
+			panic(r.NewTypeError("expects session id"))
+		}
+
+		refreshOnly := false
+		if f.Argument(2) != goja.Undefined() && f.Argument(2) != goja.Null() {
+			refreshOnly = getJsBool(r, f.Argument(2))
+		}
+
+		if err := SessionRevoke(n.ctx, n.logger, n.db, n.config, n.sessionCache, n.sessionRegistry, n.tracker, userID, sessionID, refreshOnly); err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to revoke session: %s", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group sessions
+// @summary Check whether a user has two-factor authentication enabled.
+// @param userId(type=string) The ID of the user to check.
+// @return enabled(bool) True if the user has confirmed two-factor authentication enrolment.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) totpEnabled(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects valid user id"))
+		}
+
+		enabled, err := TotpEnabled(n.ctx, n.logger, n.db, userID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to check two-factor authentication: %s", err.Error())))
+		}
+
+		return r.ToValue(enabled)
+	}
+}
+
+// @group sessions
+// @summary Verify a two-factor authentication code, for step-up checks before sensitive operations. Each code is accepted once and repeated failures lock the user out of verification for a few minutes.
+// @param userId(type=string) The ID of the user to verify.
+// @param code(type=string) The code from the user's authenticator app.
+// @param allowRecovery(type=bool, optional=true, default=false) Also accept, and consume, one of the user's recovery codes.
+// @return error(error) An error if the code is invalid or verification failed.
+func (n *runtimeJavascriptNakamaModule) totpVerify(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects valid user id"))
+		}
+
+		code := getJsString(r, f.Argument(1))
+		if code == "" {
+			panic(r.NewTypeError("expects code"))
+		}
+
+		allowRecovery := false
+		if f.Argument(2) != goja.Undefined() && f.Argument(2) != goja.Null() {
+			allowRecovery = getJsBool(r, f.Argument(2))
+		}
+
+		if err := TotpVerify(n.ctx, n.logger, n.db, userID, code, allowRecovery); err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to verify two-factor authentication code: %s", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
 // @group matches
 // @summary Create a new authoritative realtime multiplayer match running on the given runtime module name. The given params are passed to the match's init hook.
 // @param module(type=string) The name of an available runtime module that will be responsible for the match. This was registered in InitModule.
@@ -4182,20 +4620,170 @@ func (n *runtimeJavascriptNakamaModule) walletLedgerList(r *goja.Runtime) func(g
 	}
 }
 
-// @group storage
-// @summary List records in a collection and page through results. The records returned can be filtered to those owned by the user or "" for public records.
-// @param userId(type=string) User ID to list records for or "" (empty string) for public records.
-// @param collection(type=string) Collection to list data from.
-// @param limit(type=number, optional=true, default=100) Limit number of records retrieved.
-// @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
-// @return objects(nkruntime.StorageObjectList) A list of storage objects.
-// @return cursor(string) Pagination cursor. Will be set to "" or null when fetching last available page.
+// @group wallets
+// @summary Take amounts from a user's wallet and hold them until the hold is captured or released, or expires and is released automatically.
+// @param userId(type=string) The ID of the user whose wallet the amounts are taken from.
+// @param changeset(type={[key: string]: number}) The amounts to hold, by currency. Amounts must be greater than 0.
+// @param metadata(type=object, optional=true) Metadata kept with the hold and recorded in its wallet ledger entries.
+// @param expirySec(type=number, optional=true, default=0) Seconds until the hold expires, or 0 for the configured default.
+// @return hold(nkruntime.WalletHold) The created hold.
 // @return error(error) An optional error value if an error occurred.
-func (n *runtimeJavascriptNakamaModule) storageList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+func (n *runtimeJavascriptNakamaModule) walletHold(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
 	return func(f goja.FunctionCall) goja.Value {
-		var uid *uuid.UUID
-		if f.Argument(0) != goja.Undefined() && f.Argument(0) != goja.Null() {
-			userIDString := getJsString(r, f.Argument(0))
+		userID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects a valid user id"))
+		}
+
+		changeset := jsWalletHoldChangeset(r, f.Argument(1))
+		if changeset == nil {
+			panic(r.NewTypeError("expects a changeset object"))
+		}
+		metadata := jsWalletHoldMetadata(r, f.Argument(2))
+
+		expirySec := 0
+		if !goja.IsUndefined(f.Argument(3)) && !goja.IsNull(f.Argument(3)) {
+			expirySec = int(getJsInt(r, f.Argument(3)))
+		}
+
+		hold, err := WalletHoldCreate(n.ctx, n.logger, n.db, n.config, userID, changeset, metadata, expirySec)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to create wallet hold: %s", err.Error())))
+		}
+
+		return r.ToValue(jsWalletHold(hold))
+	}
+}
+
+// @group wallets
+// @summary Complete a wallet hold, keeping the given amounts and returning the rest of the hold to the wallet.
+// @param holdId(type=string) The ID of the hold.
+// @param changeset(type={[key: string]: number}, optional=true) The amounts to keep, by currency, at most the held amounts. Null keeps the whole hold.
+// @param metadata(type=object, optional=true) Metadata recorded in the wallet ledger entry for the capture.
+// @return hold(nkruntime.WalletHold) The captured hold.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) walletHoldCapture(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		holdID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects a valid hold id"))
+		}
+
+		hold, err := WalletHoldCapture(n.ctx, n.logger, n.db, holdID, jsWalletHoldChangeset(r, f.Argument(1)), jsWalletHoldMetadata(r, f.Argument(2)))
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to capture wallet hold: %s", err.Error())))
+		}
+
+		return r.ToValue(jsWalletHold(hold))
+	}
+}
+
+// @group wallets
+// @summary Cancel a wallet hold, returning all of it to the wallet.
+// @param holdId(type=string) The ID of the hold.
+// @param metadata(type=object, optional=true) Metadata recorded in the wallet ledger entry for the release.
+// @return hold(nkruntime.WalletHold) The released hold.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) walletHoldRelease(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		holdID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects a valid hold id"))
+		}
+
+		hold, err := WalletHoldRelease(n.ctx, n.logger, n.db, holdID, jsWalletHoldMetadata(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to release wallet hold: %s", err.Error())))
+		}
+
+		return r.ToValue(jsWalletHold(hold))
+	}
+}
+
+// @group wallets
+// @summary List the wallet holds of a user that are still held, oldest first.
+// @param userId(type=string) The ID of the user to list holds for.
+// @return holds(nkruntime.WalletHold[]) The user's open holds.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) walletHoldsList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects a valid user id"))
+		}
+
+		holds, err := WalletHoldsList(n.ctx, n.logger, n.db, userID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to list wallet holds: %s", err.Error())))
+		}
+
+		results := make([]interface{}, 0, len(holds))
+		for _, hold := range holds {
+			results = append(results, jsWalletHold(hold))
+		}
+		return r.ToValue(results)
+	}
+}
+
+// Read an optional changeset object argument.
+func jsWalletHoldChangeset(r *goja.Runtime, v goja.Value) map[string]int64 {
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	changesetMap, ok := v.Export().(map[string]interface{})
+	if !ok {
+		panic(r.NewTypeError("expects a changeset object"))
+	}
+	changeset := make(map[string]int64, len(changesetMap))
+	for k, value := range changesetMap {
+		i64, ok := value.(int64)
+		if !ok {
+			panic(r.NewTypeError("expects changeset values to be whole numbers"))
+		}
+		changeset[k] = i64
+	}
+	return changeset
+}
+
+func jsWalletHoldMetadata(r *goja.Runtime, v goja.Value) map[string]interface{} {
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	metadata, ok := v.Export().(map[string]interface{})
+	if !ok {
+		panic(r.NewTypeError("expects metadata to be a key value object"))
+	}
+	return metadata
+}
+
+func jsWalletHold(hold *WalletHold) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         hold.Id,
+		"userId":     hold.UserId,
+		"state":      hold.State,
+		"changeset":  hold.Changeset,
+		"captured":   hold.Captured,
+		"metadata":   hold.Metadata,
+		"createTime": hold.CreateTime,
+		"updateTime": hold.UpdateTime,
+		"expiryTime": hold.ExpiryTime,
+	}
+}
+
+// @group storage
+// @summary List records in a collection and page through results. The records returned can be filtered to those owned by the user or "" for public records.
+// @param userId(type=string) User ID to list records for or "" (empty string) for public records.
+// @param collection(type=string) Collection to list data from.
+// @param limit(type=number, optional=true, default=100) Limit number of records retrieved.
+// @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
+// @return objects(nkruntime.StorageObjectList) A list of storage objects.
+// @return cursor(string) Pagination cursor. Will be set to "" or null when fetching last available page.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) storageList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		var uid *uuid.UUID
+		if f.Argument(0) != goja.Undefined() && f.Argument(0) != goja.Null() {
+			userIDString := getJsString(r, f.Argument(0))
 			u, err := uuid.FromString(userIDString)
 			if err != nil {
 				panic(r.NewTypeError("expects empty or valid user id"))
@@ -4379,7 +4967,7 @@ func (n *runtimeJavascriptNakamaModule) storageRead(r *goja.Runtime) func(goja.F
 
 // @group storage
 // @summary Write one or more objects by their collection/keyname and optional user.
-// @param objectIds(type=nkruntime.StorageWriteRequest[]) An array of object identifiers to be written.
+// @param objectIds(type=nkruntime.StorageWriteRequest[]) An array of object identifiers to be written. An optional ttlSec expires an object after that many seconds, and an optional patch of "merge" or "json" applies the value as a JSON Merge Patch or JSON Patch to the existing object.
 // @return acks(nkruntime.StorageWriteAck[]) A list of acks with the version of the written objects.
 // @return error(error) An optional error value if an error occurred.
 func (n *runtimeJavascriptNakamaModule) storageWrite(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
@@ -4399,7 +4987,7 @@ func (n *runtimeJavascriptNakamaModule) storageWrite(r *goja.Runtime) func(goja.
 			panic(r.NewTypeError(err.Error()))
 		}
 
-		acks, _, err := StorageWriteObjects(n.ctx, n.logger, n.db, n.metrics, n.storageIndex, true, ops)
+		acks, _, err := StorageWriteObjects(n.ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, true, ops)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("failed to write storage objects: %s", err.Error())))
 		}
@@ -4461,12 +5049,23 @@ func jsArrayToStorageOpWrites(dataSlice []map[string]any) (StorageOpWrites, erro
 			}
 		}
 
+		var patch string
+		if patchIn, ok := dataMap["patch"]; ok {
+			if patch, ok = patchIn.(string); !ok || !storagePatchTypeValid(patch) {
+				return nil, errors.New("expects 'patch' value to be 'merge' or 'json'")
+			}
+		}
+
+		// JSON patches are arrays of operations, any other value is an object.
 		valueIn := dataMap["value"]
-		valueMap, ok := valueIn.(map[string]interface{})
-		if !ok {
+		if patch == StoragePatchJson {
+			if _, ok := valueIn.([]interface{}); !ok {
+				return nil, errors.New("expects 'value' value to be an array of patch operations")
+			}
+		} else if _, ok := valueIn.(map[string]interface{}); !ok {
 			return nil, errors.New("expects 'value' value to be an object")
 		}
-		valueBytes, err := json.Marshal(valueMap)
+		valueBytes, err := json.Marshal(valueIn)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert value: %s", err.Error())
 		}
@@ -4503,6 +5102,17 @@ func jsArrayToStorageOpWrites(dataSlice []map[string]any) (StorageOpWrites, erro
 			writeOp.PermissionWrite = &wrapperspb.Int32Value{Value: 1}
 		}
 
+		var ttlSec int64
+		if ttlSecIn, ok := dataMap["ttlSec"]; ok {
+			ttlSec, ok = ttlSecIn.(int64)
+			if !ok {
+				return nil, errors.New("expects 'ttlSec' value to be a number")
+			}
+			if ttlSec < 0 {
+				return nil, errors.New("expects 'ttlSec' value to be >= 0")
+			}
+		}
+
 		if writeOp.Collection == "" {
 			return nil, errors.New("expects collection to be supplied")
 		} else if writeOp.Key == "" {
@@ -4514,12 +5124,116 @@ func jsArrayToStorageOpWrites(dataSlice []map[string]any) (StorageOpWrites, erro
 		ops = append(ops, &StorageOpWrite{
 			OwnerID: userID.String(),
 			Object:  writeOp,
+			TtlSec:  ttlSec,
+			Patch:   patch,
 		})
 	}
 
 	return ops, nil
 }
 
+// @group storage
+// @summary List the kept previous versions of a storage object in a collection with history enabled, most recently replaced first.
+// @param collection(type=string) The collection of the object.
+// @param key(type=string) The key of the object.
+// @param userId(type=string, optional=true) The owner of the object, or null for objects owned by the system.
+// @param limit(type=number, optional=true, default=100) The maximum number of versions to return, between 1 and 100.
+// @return objects(nkruntime.StorageObject[]) The previous versions of the object.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) storageHistoryList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		collection, key, userID := jsStorageHistoryObjectID(r, f)
+
+		limit := storageHistoryMaxList
+		if !goja.IsUndefined(f.Argument(3)) && !goja.IsNull(f.Argument(3)) {
+			limit = int(getJsInt(r, f.Argument(3)))
+			if limit < 1 || limit > storageHistoryMaxList {
+				panic(r.NewTypeError("expects limit to be 1-100"))
+			}
+		}
+
+		objects, err := StorageHistoryList(n.ctx, n.logger, n.db, collection, key, userID, limit)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to list storage history: %s", err.Error())))
+		}
+
+		results := make([]interface{}, 0, len(objects))
+		for _, o := range objects {
+			oMap := make(map[string]interface{})
+
+			oMap["key"] = o.Key
+			oMap["collection"] = o.Collection
+			oMap["userId"] = o.UserId
+			oMap["version"] = o.Version
+			oMap["permissionRead"] = o.PermissionRead
+			oMap["permissionWrite"] = o.PermissionWrite
+			oMap["createTime"] = o.CreateTime.Seconds
+			oMap["updateTime"] = o.UpdateTime.Seconds
+
+			valueMap := make(map[string]interface{})
+			if err = json.Unmarshal([]byte(o.Value), &valueMap); err != nil {
+				panic(r.NewGoError(fmt.Errorf("failed to convert value to json: %s", err.Error())))
+			}
+			pointerizeSlices(valueMap)
+			oMap["value"] = valueMap
+
+			results = append(results, oMap)
+		}
+
+		return r.ToValue(results)
+	}
+}
+
+// @group storage
+// @summary Write a previous version of a storage object back, with the permissions it had.
+// @param collection(type=string) The collection of the object.
+// @param key(type=string) The key of the object.
+// @param userId(type=string) The owner of the object, or null for objects owned by the system.
+// @param version(type=string) The version to restore, as returned by the history listing.
+// @return ack(nkruntime.StorageWriteAck) An ack with the new version of the object.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) storageHistoryRestore(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		collection, key, userID := jsStorageHistoryObjectID(r, f)
+
+		version := getJsString(r, f.Argument(3))
+		if version == "" {
+			panic(r.NewTypeError("expects version to be a non-empty string"))
+		}
+
+		ack, _, err := StorageHistoryRestore(n.ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, collection, key, userID, version)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("failed to restore storage object: %s", err.Error())))
+		}
+
+		return r.ToValue(map[string]interface{}{
+			"key":        ack.Key,
+			"collection": ack.Collection,
+			"userId":     ack.UserId,
+			"version":    ack.Version,
+		})
+	}
+}
+
+func jsStorageHistoryObjectID(r *goja.Runtime, f goja.FunctionCall) (string, string, uuid.UUID) {
+	collection := getJsString(r, f.Argument(0))
+	if collection == "" {
+		panic(r.NewTypeError("expects collection to be a non-empty string"))
+	}
+	key := getJsString(r, f.Argument(1))
+	if key == "" {
+		panic(r.NewTypeError("expects key to be a non-empty string"))
+	}
+	userID := uuid.Nil
+	if !goja.IsUndefined(f.Argument(2)) && !goja.IsNull(f.Argument(2)) {
+		var err error
+		if userID, err = uuid.FromString(getJsString(r, f.Argument(2))); err != nil {
+			panic(r.NewTypeError("expects userId to be a valid ID"))
+		}
+	}
+	return collection, key, userID
+}
+
 // @group storage
 // @summary Remove one or more objects by their collection/keyname and optional user.
 // @param objectIds(type=nkruntime.StorageDeleteRequest[]) An array of object identifiers to be deleted.
@@ -4597,7 +5311,7 @@ func (n *runtimeJavascriptNakamaModule) storageDelete(r *goja.Runtime) func(goja
 			})
 		}
 
-		if _, err := StorageDeleteObjects(n.ctx, n.logger, n.db, n.storageIndex, true, ops); err != nil {
+		if _, err := StorageDeleteObjects(n.ctx, n.logger, n.db, n.storageIndex, n.storageCollections, n.tracker, n.router, true, ops); err != nil {
 			panic(r.NewGoError(fmt.Errorf("failed to remove storage: %s", err.Error())))
 		}
 
@@ -4752,12 +5466,23 @@ func (n *runtimeJavascriptNakamaModule) multiUpdate(r *goja.Runtime) func(goja.F
 					}
 				}
 
+				var patch string
+				if patchIn, ok := dataMap["patch"]; ok {
+					if patch, ok = patchIn.(string); !ok || !storagePatchTypeValid(patch) {
+						panic(r.NewTypeError("expects 'patch' value to be 'merge' or 'json'"))
+					}
+				}
+
 				if valueIn, ok := dataMap["value"]; ok {
-					valueMap, ok := valueIn.(map[string]interface{})
-					if !ok {
+					// JSON patches are arrays of operations, any other value is an object.
+					if patch == StoragePatchJson {
+						if _, ok := valueIn.([]interface{}); !ok {
+							panic(r.NewTypeError("expects 'value' value to be an array of patch operations"))
+						}
+					} else if _, ok := valueIn.(map[string]interface{}); !ok {
 						panic(r.NewTypeError("expects 'value' value to be an object"))
 					}
-					valueBytes, err := json.Marshal(valueMap)
+					valueBytes, err := json.Marshal(valueIn)
 					if err != nil {
 						panic(r.NewGoError(fmt.Errorf("failed to convert value: %s", err.Error())))
 					}
@@ -4795,6 +5520,17 @@ func (n *runtimeJavascriptNakamaModule) multiUpdate(r *goja.Runtime) func(goja.F
 					writeOp.PermissionWrite = &wrapperspb.Int32Value{Value: 1}
 				}
 
+				var ttlSec int64
+				if ttlSecIn, ok := dataMap["ttlSec"]; ok {
+					ttlSec, ok = ttlSecIn.(int64)
+					if !ok {
+						panic(r.NewTypeError("expects 'ttlSec' value to be a number"))
+					}
+					if ttlSec < 0 {
+						panic(r.NewTypeError("expects 'ttlSec' value to be >= 0"))
+					}
+				}
+
 				if writeOp.Collection == "" {
 					panic(r.NewTypeError("expects collection to be supplied"))
 				} else if writeOp.Key == "" {
@@ -4806,6 +5542,8 @@ func (n *runtimeJavascriptNakamaModule) multiUpdate(r *goja.Runtime) func(goja.F
 				storageWriteOps = append(storageWriteOps, &StorageOpWrite{
 					OwnerID: userID.String(),
 					Object:  writeOp,
+					TtlSec:  ttlSec,
+					Patch:   patch,
 				})
 			}
 		}
@@ -4951,7 +5689,7 @@ func (n *runtimeJavascriptNakamaModule) multiUpdate(r *goja.Runtime) func(goja.F
 			updateLedger = getJsBool(r, f.Argument(4))
 		}
 
-		acks, results, err := MultiUpdate(n.ctx, n.logger, n.db, n.metrics, accountUpdates, storageWriteOps, storageDeleteOps, n.storageIndex, walletUpdates, updateLedger)
+		acks, results, err := MultiUpdate(n.ctx, n.logger, n.db, n.metrics, accountUpdates, storageWriteOps, storageDeleteOps, n.storageIndex, n.storageCollections, n.tracker, n.router, walletUpdates, updateLedger)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error running multi update: %s", err.Error())))
 		}
@@ -5082,6 +5820,68 @@ func (n *runtimeJavascriptNakamaModule) leaderboardCreate(r *goja.Runtime) func(
 	}
 }
 
+// @group leaderboards
+// @summary Setup a new leaderboard whose records are owned by groups, scored by aggregating the records group members hold on a source leaderboard. The aggregate shares the sort order and reset schedule of the source, and is kept up to date as members submit scores and group membership changes.
+// @param id(type=string) The unique identifier for the new group leaderboard.
+// @param sourceId(type=string) The unique identifier of the leaderboard member records are read from.
+// @param aggregateOperator(type=string, optional=true, default="sum") How member scores combine into the group score. Possible values are "sum", "average" or "best".
+// @param metadata(type=object, optional=true) The metadata you want associated to the leaderboard.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) leaderboardGroupAggregateCreate(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		id := getJsString(r, f.Argument(0))
+		if id == "" {
+			panic(r.NewTypeError("expects a leaderboard ID string"))
+		}
+
+		sourceId := getJsString(r, f.Argument(1))
+		if sourceId == "" {
+			panic(r.NewTypeError("expects a source leaderboard ID string"))
+		}
+
+		aggregateOperator := "sum"
+		if f.Argument(2) != goja.Undefined() && f.Argument(2) != goja.Null() {
+			aggregateOperator = getJsString(r, f.Argument(2))
+		}
+		var aggregateOperatorNumber int
+		switch aggregateOperator {
+		case "sum":
+			aggregateOperatorNumber = LeaderboardAggregateOperatorSum
+		case "avg", "average":
+			aggregateOperatorNumber = LeaderboardAggregateOperatorAverage
+		case "best":
+			aggregateOperatorNumber = LeaderboardAggregateOperatorBest
+		default:
+			panic(r.NewTypeError("expects aggregate operator to be 'sum', 'average' or 'best'"))
+		}
+
+		metadataStr := "{}"
+		if f.Argument(3) != goja.Undefined() && f.Argument(3) != goja.Null() {
+			metadataMap, ok := f.Argument(3).Export().(map[string]interface{})
+			if !ok {
+				panic(r.NewTypeError("expects metadata to be an object"))
+			}
+			metadataBytes, err := json.Marshal(metadataMap)
+			if err != nil {
+				panic(r.NewTypeError(fmt.Sprintf("error encoding metadata: %v", err.Error())))
+			}
+			metadataStr = string(metadataBytes)
+		}
+
+		_, created, err := LeaderboardGroupAggregateCreate(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, id, sourceId, aggregateOperatorNumber, metadataStr)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error creating group leaderboard: %v", err.Error())))
+		}
+
+		if created {
+			// Only need to update the scheduler for newly created leaderboards.
+			n.leaderboardScheduler.Update()
+		}
+
+		return goja.Undefined()
+	}
+}
+
 // @group leaderboards
 // @summary Delete a leaderboard and all scores that belong to it.
 // @param id(type=string) The unique identifier for the leaderboard to delete.
@@ -5475,7 +6275,7 @@ func (n *runtimeJavascriptNakamaModule) leaderboardRecordsHaystack(r *goja.Runti
 // @summary Validates and stores the purchases present in an Apple App Store Receipt.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) Base-64 encoded receipt data returned by the purchase operation itself.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @param passwordOverride(type=string, optional=true) Override the iap.apple.shared_password provided in your configuration.
 // @return validation(nkruntime.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
@@ -5486,7 +6286,8 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateApple(r *goja.Runtime) f
 			password = getJsString(r, f.Argument(3))
 		}
 
-		if password == "" {
+		// StoreKit 2 signed transactions are verified locally and need no shared password.
+		if password == "" && !iap.IsSignedDataApple(getJsString(r, f.Argument(1))) {
 			panic(r.NewGoError(errors.New("apple IAP is not configured")))
 		}
 
@@ -5509,11 +6310,20 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateApple(r *goja.Runtime) f
 			persist = getJsBool(r, f.Argument(2))
 		}
 
-		validation, err := ValidatePurchasesApple(n.ctx, n.logger, n.db, uid, password, receipt, persist)
+		var validation *api.ValidatePurchaseResponse
+		if iap.IsSignedDataApple(receipt) {
+			validation, err = ValidatePurchasesAppleSigned(n.ctx, n.logger, n.db, uid, n.config.GetIAP().Apple, receipt, persist)
+		} else {
+			validation, err = ValidatePurchasesApple(n.ctx, n.logger, n.db, uid, password, receipt, persist)
+		}
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error validating Apple receipt: %s", err.Error())))
 		}
 
+		if _, err = StoreFulfilPurchases(n.ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error fulfilling store purchases: %s", err.Error())))
+		}
+
 		validationResult := purchaseResponseToJsObject(validation)
 
 		return r.ToValue(validationResult)
@@ -5524,7 +6334,7 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateApple(r *goja.Runtime) f
 // @summary Validates and stores a purchase receipt from the Google Play Store.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) JSON encoded Google receipt.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @return validation(nkruntime.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *runtimeJavascriptNakamaModule) purchaseValidateGoogle(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
@@ -5566,6 +6376,10 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateGoogle(r *goja.Runtime)
 			panic(r.NewGoError(fmt.Errorf("error validating Google receipt: %s", err.Error())))
 		}
 
+		if _, err = StoreFulfilPurchases(n.ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error fulfilling store purchases: %s", err.Error())))
+		}
+
 		validationResult := purchaseResponseToJsObject(validation)
 
 		return r.ToValue(validationResult)
@@ -5577,7 +6391,7 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateGoogle(r *goja.Runtime)
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) The Huawei receipt data.
 // @param signature(type=string) The receipt signature.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @return validation(nkruntime.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *runtimeJavascriptNakamaModule) purchaseValidateHuawei(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
@@ -5617,6 +6431,10 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateHuawei(r *goja.Runtime)
 			panic(r.NewGoError(fmt.Errorf("error validating Huawei receipt: %s", err.Error())))
 		}
 
+		if _, err = StoreFulfilPurchases(n.ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error fulfilling store purchases: %s", err.Error())))
+		}
+
 		validationResult := purchaseResponseToJsObject(validation)
 
 		return r.ToValue(validationResult)
@@ -5627,7 +6445,7 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateHuawei(r *goja.Runtime)
 // @summary Validates and stores a purchase receipt from Facebook Instant Games.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param signedRequest(type=string) The Facebook Instant signedRequest receipt data.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @return validation(nkruntime.ValidatePurchaseResponse) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *runtimeJavascriptNakamaModule) purchaseValidateFacebookInstant(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
@@ -5660,6 +6478,10 @@ func (n *runtimeJavascriptNakamaModule) purchaseValidateFacebookInstant(r *goja.
 			panic(r.NewGoError(fmt.Errorf("error validating Facebook Instant receipt: %s", err.Error())))
 		}
 
+		if _, err = StoreFulfilPurchases(n.ctx, n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, uid, persist, validation.ValidatedPurchases); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error fulfilling store purchases: %s", err.Error())))
+		}
+
 		validationResult := purchaseResponseToJsObject(validation)
 
 		return r.ToValue(validationResult)
@@ -5687,6 +6509,48 @@ func (n *runtimeJavascriptNakamaModule) purchaseGetByTransactionId(r *goja.Runti
 	}
 }
 
+// @group purchases
+// @summary List a customer's App Store purchase history through the App Store Server API.
+// @param transactionId(type=string) Any transaction ID of the customer.
+// @return transactions(nkruntime.AppleTransaction[]) The customer's verified transactions.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) purchaseHistoryApple(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		transactionID := getJsString(r, f.Argument(0))
+		if transactionID == "" {
+			panic(r.NewTypeError("expects a transaction id string"))
+		}
+
+		transactions, err := ListPurchaseHistoryApple(n.ctx, n.logger, n.config.GetIAP().Apple, transactionID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error listing Apple purchase history: %s", err.Error())))
+		}
+
+		return r.ToValue(appleTransactionsToJsArray(transactions))
+	}
+}
+
+// @group purchases
+// @summary List a customer's refunded App Store purchases through the App Store Server API.
+// @param transactionId(type=string) Any transaction ID of the customer.
+// @return transactions(nkruntime.AppleTransaction[]) The customer's verified refunded transactions.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) purchaseRefundsApple(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		transactionID := getJsString(r, f.Argument(0))
+		if transactionID == "" {
+			panic(r.NewTypeError("expects a transaction id string"))
+		}
+
+		transactions, err := ListRefundedPurchasesApple(n.ctx, n.logger, n.config.GetIAP().Apple, transactionID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error listing Apple refunded purchases: %s", err.Error())))
+		}
+
+		return r.ToValue(appleTransactionsToJsArray(transactions))
+	}
+}
+
 // @group purchases
 // @summary List stored validated purchase receipts.
 // @param userId(type=string, optional=true) Filter by user ID. Can be an empty string to list purchases for all users.
@@ -6601,16 +7465,201 @@ func (n *runtimeJavascriptNakamaModule) tournamentRecordsHaystack(r *goja.Runtim
 	}
 }
 
-// @group groups
-// @summary Fetch one or more groups by their ID.
-// @param groupIds(type=string[]) An array of strings of the IDs for the groups to get.
-// @return getGroups(nkruntime.Group[]) An array of groups with their fields.
+// @group leagues
+// @summary Setup a league made of existing tournaments, one per tier. Tiers must share the same reset schedule, at every reset the top members of each cohort are promoted and the bottom members relegated. The league configuration will not be updated if it already exists.
+// @param id(type=string) The unique identifier for the new league.
+// @param tiers(type=string[]) The IDs of the tournaments that make up the league tiers, lowest tier first.
+// @param cohortSize(type=number) Maximum number of members competing against each other in a cohort.
+// @param promoteCount(type=number) Number of best ranked members of each cohort moved one tier up at every reset.
+// @param relegateCount(type=number) Number of worst ranked members of each cohort moved one tier down at every reset.
+// @param metadata(type=object, optional=true) The metadata you want associated to the league.
 // @return error(error) An optional error value if an error occurred.
-func (n *runtimeJavascriptNakamaModule) groupsGetId(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+func (n *runtimeJavascriptNakamaModule) leagueCreate(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
 	return func(f goja.FunctionCall) goja.Value {
-		groupIdsIn := f.Argument(0)
-		if groupIdsIn == goja.Undefined() || groupIdsIn == goja.Null() {
-			panic(r.NewTypeError("expects an array of group ids"))
+		id := getJsString(r, f.Argument(0))
+		if id == "" {
+			panic(r.NewTypeError("expects a league ID string"))
+		}
+
+		tiersIn := f.Argument(1)
+		if tiersIn == goja.Undefined() || tiersIn == goja.Null() {
+			panic(r.NewTypeError("expects an array of tier tournament ids"))
+		}
+		tiers, err := exportToSlice[[]string](tiersIn)
+		if err != nil {
+			panic(r.NewTypeError("expects an array of strings"))
+		}
+		if len(tiers) == 0 {
+			panic(r.NewTypeError("expects at least one tier tournament ID"))
+		}
+
+		cohortSize := int(getJsInt(r, f.Argument(2)))
+		if cohortSize < 1 {
+			panic(r.NewTypeError("cohortSize must be > 0"))
+		}
+		promoteCount := int(getJsInt(r, f.Argument(3)))
+		if promoteCount < 0 {
+			panic(r.NewTypeError("promoteCount must be >= 0"))
+		}
+		relegateCount := int(getJsInt(r, f.Argument(4)))
+		if relegateCount < 0 {
+			panic(r.NewTypeError("relegateCount must be >= 0"))
+		}
+		if promoteCount+relegateCount > cohortSize {
+			panic(r.NewTypeError("promoteCount and relegateCount must not exceed cohortSize"))
+		}
+
+		metadata := f.Argument(5)
+		metadataStr := "{}"
+		if metadata != goja.Undefined() && metadata != goja.Null() {
+			metadataMap, ok := metadata.Export().(map[string]interface{})
+			if !ok {
+				panic(r.NewTypeError("expects metadata to be an object"))
+			}
+			metadataBytes, err := json.Marshal(metadataMap)
+			if err != nil {
+				panic(r.NewGoError(fmt.Errorf("error encoding metadata: %v", err.Error())))
+			}
+			metadataStr = string(metadataBytes)
+		}
+
+		if err := LeagueCreate(n.ctx, n.logger, n.db, n.leaderboardCache, id, tiers, cohortSize, promoteCount, relegateCount, metadataStr); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error creating league: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group leagues
+// @summary Delete a league and all of its member assignments. The tier tournaments are not deleted.
+// @param id(type=string) The unique identifier for the league to delete.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) leagueDelete(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		id := getJsString(r, f.Argument(0))
+		if id == "" {
+			panic(r.NewTypeError("expects a league ID string"))
+		}
+
+		if err := LeagueDelete(n.ctx, n.logger, n.db, id); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error deleting league: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group leagues
+// @summary Join a league. New members are placed in the lowest tier, in the first cohort with space available. This operation is idempotent.
+// @param id(type=string) The unique identifier for the league to join.
+// @param ownerId(type=string) The user joining the league.
+// @return cohort(nkruntime.LeagueCohort) The cohort the user is competing in.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) leagueJoin(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		id := getJsString(r, f.Argument(0))
+		if id == "" {
+			panic(r.NewTypeError("expects a league ID string"))
+		}
+
+		ownerID, err := uuid.FromString(getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("expects owner ID to be a valid identifier"))
+		}
+
+		cohort, err := LeagueJoin(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, id, ownerID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error joining league: %v", err.Error())))
+		}
+
+		return r.ToValue(leagueCohortToJsObject(r, cohort))
+	}
+}
+
+// @group leagues
+// @summary Remove a member from a league. Records already submitted to tier tournaments are kept.
+// @param id(type=string) The unique identifier for the league to leave.
+// @param ownerId(type=string) The user leaving the league.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) leagueLeave(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		id := getJsString(r, f.Argument(0))
+		if id == "" {
+			panic(r.NewTypeError("expects a league ID string"))
+		}
+
+		ownerID, err := uuid.FromString(getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("expects owner ID to be a valid identifier"))
+		}
+
+		if err := LeagueLeave(n.ctx, n.logger, n.db, id, ownerID); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error leaving league: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group leagues
+// @summary Fetch the current tier and cohort of a league member, along with the records of all cohort members for the current period.
+// @param id(type=string) The unique identifier for the league.
+// @param ownerId(type=string) The league member.
+// @return cohort(nkruntime.LeagueCohort) The cohort the user is competing in.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) leagueCohortGet(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		id := getJsString(r, f.Argument(0))
+		if id == "" {
+			panic(r.NewTypeError("expects a league ID string"))
+		}
+
+		ownerID, err := uuid.FromString(getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("expects owner ID to be a valid identifier"))
+		}
+
+		cohort, err := LeagueCohortGet(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, id, ownerID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error getting league cohort: %v", err.Error())))
+		}
+
+		return r.ToValue(leagueCohortToJsObject(r, cohort))
+	}
+}
+
+func leagueCohortToJsObject(r *goja.Runtime, cohort *LeagueCohort) map[string]interface{} {
+	records := make([]interface{}, 0, len(cohort.Records))
+	for _, record := range cohort.Records {
+		records = append(records, leaderboardRecordToJsMap(r, record))
+	}
+
+	ownerIDs := make([]interface{}, 0, len(cohort.OwnerIds))
+	for _, ownerID := range cohort.OwnerIds {
+		ownerIDs = append(ownerIDs, ownerID)
+	}
+
+	return map[string]interface{}{
+		"leagueId":     cohort.LeagueId,
+		"tournamentId": cohort.TournamentId,
+		"tier":         cohort.Tier,
+		"cohort":       cohort.Cohort,
+		"ownerIds":     ownerIDs,
+		"records":      records,
+	}
+}
+
+// @group groups
+// @summary Fetch one or more groups by their ID.
+// @param groupIds(type=string[]) An array of strings of the IDs for the groups to get.
+// @return getGroups(nkruntime.Group[]) An array of groups with their fields.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupsGetId(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupIdsIn := f.Argument(0)
+		if groupIdsIn == goja.Undefined() || groupIdsIn == goja.Null() {
+			panic(r.NewTypeError("expects an array of group ids"))
 		}
 		groupIDs, err := exportToSlice[[]string](groupIdsIn)
 		if err != nil {
@@ -6728,7 +7777,7 @@ func (n *runtimeJavascriptNakamaModule) groupCreate(r *goja.Runtime) func(goja.F
 			maxCount = int(getJsInt(r, f.Argument(8)))
 		}
 
-		group, err := CreateGroup(n.ctx, n.logger, n.db, userID, creatorID, name, lang, desc, avatarURL, metadataStr, open, maxCount)
+		group, err := CreateGroup(n.ctx, n.logger, n.db, n.groupIndex, userID, creatorID, name, lang, desc, avatarURL, metadataStr, open, maxCount)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to create group: %v", err.Error())))
 		}
@@ -6847,7 +7896,7 @@ func (n *runtimeJavascriptNakamaModule) groupUpdate(r *goja.Runtime) func(goja.F
 			maxCount = int(getJsInt(r, f.Argument(9)))
 		}
 
-		if err = UpdateGroup(n.ctx, n.logger, n.db, groupID, userId, creatorID, name, lang, desc, avatarURL, metadata, open, maxCount); err != nil {
+		if err = UpdateGroup(n.ctx, n.logger, n.db, n.groupIndex, groupID, userId, creatorID, name, lang, desc, avatarURL, metadata, open, maxCount); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to update group: %v", err.Error())))
 		}
 
@@ -6867,7 +7916,7 @@ func (n *runtimeJavascriptNakamaModule) groupDelete(r *goja.Runtime) func(goja.F
 			panic(r.NewTypeError("expects group ID to be a valid identifier"))
 		}
 
-		if err = DeleteGroup(n.ctx, n.logger, n.db, groupID, uuid.Nil); err != nil {
+		if err = DeleteGroup(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, n.groupIndex, groupID, uuid.Nil); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to delete group: %v", err.Error())))
 		}
 
@@ -6920,7 +7969,7 @@ func (n *runtimeJavascriptNakamaModule) groupUsersKick(r *goja.Runtime) func(goj
 			callerID = cid
 		}
 
-		if err := KickGroupUsers(n.ctx, n.logger, n.db, n.tracker, n.router, n.streamManager, callerID, groupID, userIDs, false); err != nil {
+		if err := KickGroupUsers(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, n.streamManager, callerID, groupID, userIDs, false); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to kick users from a group: %v", err.Error())))
 		}
 
@@ -6928,13 +7977,393 @@ func (n *runtimeJavascriptNakamaModule) groupUsersKick(r *goja.Runtime) func(goj
 	}
 }
 
+// @group groups
+// @summary Create a custom role for a group, or replace the permissions of an existing role with the same name. Members holding the role gain the listed permissions.
+// @param groupId(type=string) The ID of the group to define the role for.
+// @param name(type=string) The name of the role, for example "officer".
+// @param permissions(type=string[]) The permissions granted by the role. Possible values are "invite", "kick", "edit" and "chat".
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permission checks are bypassed.
+// @return role(nkruntime.GroupRole) The created or updated role.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupRoleUpsert(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupIDStr := getJsString(r, f.Argument(0))
+		groupID, err := uuid.FromString(groupIDStr)
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		name := getJsString(r, f.Argument(1))
+		if name == "" {
+			panic(r.NewTypeError("expects a role name string"))
+		}
+
+		permissions := make([]string, 0)
+		if !goja.IsUndefined(f.Argument(2)) && !goja.IsNull(f.Argument(2)) {
+			permissions, err = exportToSlice[[]string](f.Argument(2))
+			if err != nil {
+				panic(r.NewTypeError("expects an array of permission strings"))
+			}
+		}
+
+		callerID := uuid.Nil
+		if !goja.IsUndefined(f.Argument(3)) && !goja.IsNull(f.Argument(3)) {
+			callerIdStr := getJsString(r, f.Argument(3))
+			cid, err := uuid.FromString(callerIdStr)
+			if err != nil {
+				panic(r.NewTypeError("expects caller id to be valid identifier"))
+			}
+			callerID = cid
+		}
+
+		role, err := GroupRoleUpsert(n.ctx, n.logger, n.db, callerID, groupID, name, permissions)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to write group role: %v", err.Error())))
+		}
+
+		return r.ToValue(groupRoleToJsObject(role))
+	}
+}
+
+// @group groups
+// @summary Delete a custom role from a group. Members holding the role become regular members.
+// @param groupId(type=string) The ID of the group to delete the role from.
+// @param name(type=string) The name of the role to delete.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permission checks are bypassed.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupRoleDelete(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupIDStr := getJsString(r, f.Argument(0))
+		groupID, err := uuid.FromString(groupIDStr)
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		name := getJsString(r, f.Argument(1))
+		if name == "" {
+			panic(r.NewTypeError("expects a role name string"))
+		}
+
+		callerID := uuid.Nil
+		if !goja.IsUndefined(f.Argument(2)) && !goja.IsNull(f.Argument(2)) {
+			callerIdStr := getJsString(r, f.Argument(2))
+			cid, err := uuid.FromString(callerIdStr)
+			if err != nil {
+				panic(r.NewTypeError("expects caller id to be valid identifier"))
+			}
+			callerID = cid
+		}
+
+		if err := GroupRoleDelete(n.ctx, n.logger, n.db, n.tracker, callerID, groupID, name); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to delete group role: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group groups
+// @summary List the custom roles defined for a group.
+// @param groupId(type=string) The ID of the group to list roles for.
+// @return roles(nkruntime.GroupRole[]) The roles defined for the group.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupRolesList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupIDStr := getJsString(r, f.Argument(0))
+		groupID, err := uuid.FromString(groupIDStr)
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		roles, err := GroupRolesList(n.ctx, n.logger, n.db, groupID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to list group roles: %v", err.Error())))
+		}
+
+		rolesArray := make([]interface{}, 0, len(roles))
+		for _, role := range roles {
+			rolesArray = append(rolesArray, groupRoleToJsObject(role))
+		}
+
+		return r.ToValue(rolesArray)
+	}
+}
+
+// @group groups
+// @summary Assign a custom role to a group member, replacing any role they already hold. The role is reflected in the status of their group channel presences.
+// @param groupId(type=string) The ID of the group.
+// @param userId(type=string) The ID of the member to assign the role to.
+// @param role(type=string) The name of the role to assign. An empty string removes the member's role.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permission checks are bypassed.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupUserRoleSet(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupIDStr := getJsString(r, f.Argument(0))
+		groupID, err := uuid.FromString(groupIDStr)
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		userIDStr := getJsString(r, f.Argument(1))
+		userID, err := uuid.FromString(userIDStr)
+		if err != nil {
+			panic(r.NewTypeError("expects user ID to be a valid identifier"))
+		}
+
+		role := ""
+		if !goja.IsUndefined(f.Argument(2)) && !goja.IsNull(f.Argument(2)) {
+			role = getJsString(r, f.Argument(2))
+		}
+
+		callerID := uuid.Nil
+		if !goja.IsUndefined(f.Argument(3)) && !goja.IsNull(f.Argument(3)) {
+			callerIdStr := getJsString(r, f.Argument(3))
+			cid, err := uuid.FromString(callerIdStr)
+			if err != nil {
+				panic(r.NewTypeError("expects caller id to be valid identifier"))
+			}
+			callerID = cid
+		}
+
+		if err := GroupUserRoleSet(n.ctx, n.logger, n.db, n.tracker, callerID, groupID, userID, role); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to set group user role: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+func groupRoleToJsObject(role *GroupRole) map[string]interface{} {
+	permissions := make([]interface{}, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		permissions = append(permissions, permission)
+	}
+
+	return map[string]interface{}{
+		"groupId":     role.GroupId,
+		"name":        role.Name,
+		"permissions": permissions,
+		"createTime":  role.CreateTime,
+		"updateTime":  role.UpdateTime,
+	}
+}
+
+// @group groups
+// @summary Invite users to join a group. Invited users can accept or reject the invite, and accepting it adds them to the group even if the group is closed.
+// @param groupId(type=string) The ID of the group to invite users to.
+// @param userIds(type=string[]) Array of user IDs to invite.
+// @param expirySec(type=number, optional=true, default=604800) The number of seconds until the invites expire.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permission checks are bypassed.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupUsersInvite(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupIDString := getJsString(r, f.Argument(0))
+		if groupIDString == "" {
+			panic(r.NewTypeError("expects a group ID string"))
+		}
+		groupID, err := uuid.FromString(groupIDString)
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		usersIn := f.Argument(1)
+		if goja.IsUndefined(usersIn) || goja.IsNull(usersIn) {
+			panic(r.NewTypeError("expects an array of user ids"))
+		}
+		userIDs, err := exportToSlice[[]string](usersIn)
+		if err != nil {
+			panic(r.NewTypeError("expects an array of strings"))
+		}
+
+		uids := make([]uuid.UUID, 0, len(userIDs))
+		for _, id := range userIDs {
+			uid, err := uuid.FromString(id)
+			if err != nil {
+				panic(r.NewTypeError("expects user id to be valid identifier"))
+			}
+			if uid == uuid.Nil {
+				panic(r.NewTypeError("cannot invite the root user"))
+			}
+			uids = append(uids, uid)
+		}
+
+		expirySec := 0
+		if !goja.IsUndefined(f.Argument(2)) && !goja.IsNull(f.Argument(2)) {
+			expirySec = int(getJsInt(r, f.Argument(2)))
+			if expirySec < 0 {
+				panic(r.NewTypeError("expects expiry to be 0 or greater"))
+			}
+		}
+
+		if len(userIDs) == 0 {
+			return goja.Undefined()
+		}
+
+		callerID := uuid.Nil
+		if !goja.IsUndefined(f.Argument(3)) && !goja.IsNull(f.Argument(3)) {
+			callerIdStr := getJsString(r, f.Argument(3))
+			cid, err := uuid.FromString(callerIdStr)
+			if err != nil {
+				panic(r.NewTypeError("expects caller id to be valid identifier"))
+			}
+			callerID = cid
+		}
+
+		if err := GroupInviteUsers(n.ctx, n.logger, n.db, n.tracker, n.router, callerID, groupID, uids, expirySec); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to invite users to group: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group groups
+// @summary Accept a pending group invite for a particular user, adding them to the group.
+// @param groupId(type=string) The ID of the group the user was invited to.
+// @param userId(type=string) The ID of the invited user.
+// @param username(type=string) The username of the invited user.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupInviteAccept(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		userID, err := uuid.FromString(getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("expects user ID to be a valid identifier"))
+		}
+
+		username := getJsString(r, f.Argument(2))
+		if username == "" {
+			panic(r.NewTypeError("expects a username string"))
+		}
+
+		if err := GroupInviteAccept(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, groupID, userID, username); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to accept group invite: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group groups
+// @summary Reject a pending group invite for a particular user.
+// @param groupId(type=string) The ID of the group the user was invited to.
+// @param userId(type=string) The ID of the invited user.
+// @param username(type=string) The username of the invited user.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupInviteReject(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		userID, err := uuid.FromString(getJsString(r, f.Argument(1)))
+		if err != nil {
+			panic(r.NewTypeError("expects user ID to be a valid identifier"))
+		}
+
+		username := getJsString(r, f.Argument(2))
+		if username == "" {
+			panic(r.NewTypeError("expects a username string"))
+		}
+
+		if err := GroupInviteReject(n.ctx, n.logger, n.db, n.tracker, n.router, groupID, userID, username); err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to reject group invite: %v", err.Error())))
+		}
+
+		return goja.Undefined()
+	}
+}
+
+// @group groups
+// @summary List the pending, unexpired group invites for a user.
+// @param userId(type=string) The ID of the user to list invites for.
+// @return invites(nkruntime.GroupInvite[]) The user's pending group invites.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupInvitesList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		userID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects user ID to be a valid identifier"))
+		}
+
+		invites, err := GroupInvitesList(n.ctx, n.logger, n.db, userID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to list group invites: %v", err.Error())))
+		}
+
+		invitesArray := make([]interface{}, 0, len(invites))
+		for _, invite := range invites {
+			invitesArray = append(invitesArray, map[string]interface{}{
+				"groupId":    invite.GroupId,
+				"userId":     invite.UserId,
+				"inviterId":  invite.InviterId,
+				"expiryTime": invite.ExpiryTime,
+				"createTime": invite.CreateTime,
+			})
+		}
+
+		return r.ToValue(invitesArray)
+	}
+}
+
+// @group groups
+// @summary List the applications submitted with pending join requests to a group.
+// @param groupId(type=string) The ID of the group to list applications for.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permission checks are bypassed.
+// @return applications(nkruntime.GroupApplication[]) The applications attached to pending join requests.
+// @return error(error) An optional error value if an error occurred.
+func (n *runtimeJavascriptNakamaModule) groupApplicationsList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	return func(f goja.FunctionCall) goja.Value {
+		groupID, err := uuid.FromString(getJsString(r, f.Argument(0)))
+		if err != nil {
+			panic(r.NewTypeError("expects group ID to be a valid identifier"))
+		}
+
+		callerID := uuid.Nil
+		if !goja.IsUndefined(f.Argument(1)) && !goja.IsNull(f.Argument(1)) {
+			callerIdStr := getJsString(r, f.Argument(1))
+			cid, err := uuid.FromString(callerIdStr)
+			if err != nil {
+				panic(r.NewTypeError("expects caller id to be valid identifier"))
+			}
+			callerID = cid
+		}
+
+		applications, err := GroupApplicationsList(n.ctx, n.logger, n.db, callerID, groupID)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to list group applications: %v", err.Error())))
+		}
+
+		applicationsArray := make([]interface{}, 0, len(applications))
+		for _, application := range applications {
+			metadataMap := make(map[string]interface{})
+			if err = json.Unmarshal([]byte(application.Metadata), &metadataMap); err != nil {
+				panic(r.NewGoError(fmt.Errorf("failed to convert application metadata to json: %s", err.Error())))
+			}
+			applicationsArray = append(applicationsArray, map[string]interface{}{
+				"groupId":    application.GroupId,
+				"userId":     application.UserId,
+				"metadata":   metadataMap,
+				"createTime": application.CreateTime,
+			})
+		}
+
+		return r.ToValue(applicationsArray)
+	}
+}
+
 // @group groups
 // @summary List all members, admins and superadmins which belong to a group. This also list incoming join requests.
 // @param groupId(type=string) The ID of the group to list members for.
 // @param limit(type=int, optional=true, default=100) The maximum number of entries in the listing.
 // @param state(type=int, optional=true, default=null) The state of the user within the group. If unspecified this returns users in all states.
 // @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
-// @return groupUsers(nkruntime.GroupUserList) The user information for members, admins and superadmins for the group. Also users who sent a join request.
+// @return groupUsers(nkruntime.GroupUserList) The user information for members, admins and superadmins for the group. Also users who sent a join request, along with any application they submitted.
 // @return error(error) An optional error value if an error occurred.
 func (n *runtimeJavascriptNakamaModule) groupUsersList(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
 	return func(f goja.FunctionCall) goja.Value {
@@ -6973,6 +8402,11 @@ func (n *runtimeJavascriptNakamaModule) groupUsersList(r *goja.Runtime) func(goj
 			panic(r.NewGoError(fmt.Errorf("error while trying to list users in a group: %v", err.Error())))
 		}
 
+		applications, err := groupApplicationsForUsers(n.ctx, n.logger, n.db, groupID, res.GroupUsers)
+		if err != nil {
+			panic(r.NewGoError(fmt.Errorf("error while trying to list group applications: %v", err.Error())))
+		}
+
 		groupUsers := make([]interface{}, 0, len(res.GroupUsers))
 		for _, gu := range res.GroupUsers {
 			u := gu.User
@@ -7017,10 +8451,20 @@ func (n *runtimeJavascriptNakamaModule) groupUsersList(r *goja.Runtime) func(goj
 			pointerizeSlices(metadataMap)
 			guMap["metadata"] = metadataMap
 
-			groupUsers = append(groupUsers, map[string]interface{}{
+			groupUser := map[string]interface{}{
 				"user":  guMap,
 				"state": gu.State.Value,
-			})
+			}
+			if application, found := applications[u.Id]; found {
+				applicationMap := make(map[string]interface{})
+				if err = json.Unmarshal([]byte(application), &applicationMap); err != nil {
+					panic(r.NewGoError(fmt.Errorf("failed to convert application to json: %s", err.Error())))
+				}
+				pointerizeSlices(applicationMap)
+				groupUser["application"] = applicationMap
+			}
+
+			groupUsers = append(groupUsers, groupUser)
 		}
 
 		result := make(map[string]interface{}, 2)
@@ -7442,6 +8886,7 @@ func (n *runtimeJavascriptNakamaModule) friendsBlock(r *goja.Runtime) func(goja.
 // @param groupId(type=string) The ID of the group to join.
 // @param userId(type=string) The user ID to add to this group.
 // @param username(type=string) The username of the user to add to this group.
+// @param application(type=object, optional=true) An application form to attach to the join request if the group is closed.
 // @return error(error) An optional error value if an error occurred.
 func (n *runtimeJavascriptNakamaModule) groupUserJoin(r *goja.Runtime) func(goja.FunctionCall) goja.Value {
 	return func(f goja.FunctionCall) goja.Value {
@@ -7468,7 +8913,20 @@ func (n *runtimeJavascriptNakamaModule) groupUserJoin(r *goja.Runtime) func(goja
 			panic(r.NewTypeError("expects a username string"))
 		}
 
-		if err := JoinGroup(n.ctx, n.logger, n.db, n.tracker, n.router, groupID, userID, username); err != nil {
+		application := ""
+		if f.Argument(3) != goja.Undefined() && f.Argument(3) != goja.Null() {
+			applicationMap, ok := f.Argument(3).Export().(map[string]interface{})
+			if !ok {
+				panic(r.NewTypeError("expects application to be an object"))
+			}
+			applicationBytes, err := json.Marshal(applicationMap)
+			if err != nil {
+				panic(r.NewGoError(fmt.Errorf("failed to convert application: %s", err.Error())))
+			}
+			application = string(applicationBytes)
+		}
+
+		if err := JoinGroup(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, groupID, userID, username, application); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to join group: %v", err.Error())))
 		}
 
@@ -7507,7 +8965,7 @@ func (n *runtimeJavascriptNakamaModule) groupUserLeave(r *goja.Runtime) func(goj
 			panic(r.NewTypeError("expects a username string"))
 		}
 
-		if err := LeaveGroup(n.ctx, n.logger, n.db, n.tracker, n.router, n.streamManager, groupID, userID, username); err != nil {
+		if err := LeaveGroup(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, n.streamManager, groupID, userID, username); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to leave group: %v", err.Error())))
 		}
 
@@ -7566,7 +9024,7 @@ func (n *runtimeJavascriptNakamaModule) groupUsersAdd(r *goja.Runtime) func(goja
 			callerID = cid
 		}
 
-		if err := AddGroupUsers(n.ctx, n.logger, n.db, n.tracker, n.router, callerID, groupID, uids); err != nil {
+		if err := AddGroupUsers(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, callerID, groupID, uids); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to add users into group: %v", err.Error())))
 		}
 
@@ -7625,7 +9083,7 @@ func (n *runtimeJavascriptNakamaModule) groupUsersBan(r *goja.Runtime) func(goja
 			callerID = cid
 		}
 
-		if err := BanGroupUsers(n.ctx, n.logger, n.db, n.tracker, n.router, n.streamManager, callerID, groupID, uids); err != nil {
+		if err := BanGroupUsers(n.ctx, n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, n.streamManager, callerID, groupID, uids); err != nil {
 			panic(r.NewGoError(fmt.Errorf("error while trying to ban users from group: %v", err.Error())))
 		}
 
@@ -7759,6 +9217,7 @@ func (n *runtimeJavascriptNakamaModule) groupUsersDemote(r *goja.Runtime) func(g
 // @param open(type=bool, optional=true) Filter based on whether groups are Open or Closed.
 // @param limit(type=number, optional=true, default=100) Return only the required number of groups denoted by this limit value.
 // @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
+// @param query(type=string, optional=true, default="") Query string search over group name, description, lang_tag, open and configured metadata fields, for example "+name:dragons +metadata.region:eu". Cannot be combined with the name filter.
 // @return groups(nkruntime.GroupList) A list of groups.
 // @return cursor(string) An optional next page cursor that can be used to retrieve the next page of records (if any). Will be set to "" or null when fetching last available page.
 // @return error(error) An optional error value if an error occurred.
@@ -7798,7 +9257,12 @@ func (n *runtimeJavascriptNakamaModule) groupsList(r *goja.Runtime) func(goja.Fu
 			cursor = getJsString(r, f.Argument(5))
 		}
 
-		groups, err := ListGroups(n.ctx, n.logger, n.db, name, langTag, open, edgeCount, limit, cursor)
+		query := ""
+		if !goja.IsUndefined(f.Argument(6)) && !goja.IsNull(f.Argument(6)) {
+			query = getJsString(r, f.Argument(6))
+		}
+
+		groups, err := ListGroups(n.ctx, n.logger, n.db, n.groupIndex, name, langTag, query, open, edgeCount, limit, cursor)
 		if err != nil {
 			panic(r.NewGoError(fmt.Errorf("error listing groups: %s", err.Error())))
 		}
@@ -8862,6 +10326,34 @@ func validatedPurchaseToJsObject(purchase *api.ValidatedPurchase) map[string]int
 	return validatedPurchaseMap
 }
 
+func appleTransactionsToJsArray(transactions []*iap.AppleJWSTransaction) []interface{} {
+	transactionsArray := make([]interface{}, 0, len(transactions))
+	for _, t := range transactions {
+		transactionMap := make(map[string]interface{}, 14)
+		transactionMap["transactionId"] = t.TransactionId
+		transactionMap["originalTransactionId"] = t.OriginalTransactionId
+		transactionMap["bundleId"] = t.BundleId
+		transactionMap["productId"] = t.ProductId
+		transactionMap["type"] = t.Type
+		transactionMap["quantity"] = t.Quantity
+		transactionMap["environment"] = t.Environment
+		transactionMap["appAccountToken"] = t.AppAccountToken
+		transactionMap["price"] = t.Price
+		transactionMap["currency"] = t.Currency
+		transactionMap["purchaseTime"] = t.PurchaseDate / 1000
+		transactionMap["originalPurchaseTime"] = t.OriginalPurchaseDate / 1000
+		if t.ExpiresDate != 0 {
+			transactionMap["expiryTime"] = t.ExpiresDate / 1000
+		}
+		if t.RevocationDate != 0 {
+			transactionMap["refundTime"] = t.RevocationDate / 1000
+		}
+		transactionsArray = append(transactionsArray, transactionMap)
+	}
+
+	return transactionsArray
+}
+
 func subscriptionResponseToJsObject(validation *api.ValidateSubscriptionResponse) map[string]interface{} {
 	return map[string]interface{}{"validatedSubscription": subscriptionToJsObject(validation.ValidatedSubscription)}
 }
@@ -64,6 +64,13 @@ type RuntimeLuaCallbacks struct {
 	PurchaseNotificationGoogle     *lua.LFunction
 	SubscriptionNotificationGoogle *lua.LFunction
 	StorageIndexFilter             *MapOf[string, *lua.LFunction]
+	BeforeAccountMerge             *lua.LFunction
+	BeforeTrade                    *lua.LFunction
+	AfterTrade                     *lua.LFunction
+	StorageExpiry                  *lua.LFunction
+	BeforeOIDC                     *lua.LFunction
+	AfterOIDC                      *lua.LFunction
+	EmailTemplate                  *lua.LFunction
 }
 
 type RuntimeLuaModule struct {
@@ -95,6 +102,10 @@ type RuntimeProviderLua struct {
 	leaderboardCache     LeaderboardCache
 	leaderboardRankCache LeaderboardRankCache
 	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	groupIndex           GroupIndex
+	rateLimiter          RateLimiter
+	namePolicy           NamePolicy
 	sessionRegistry      SessionRegistry
 	matchRegistry        MatchRegistry
 	tracker              Tracker
@@ -111,14 +122,14 @@ type RuntimeProviderLua struct {
 	statsCtx context.Context
 }
 
-func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, eventFn RuntimeEventCustomFunction, rootPath string, paths []string, matchProvider *MatchProvider, storageIndex StorageIndex) ([]string, map[string]RuntimeRpcFunction, map[string]RuntimeBeforeRtFunction, map[string]RuntimeAfterRtFunction, *RuntimeBeforeReqFunctions, *RuntimeAfterReqFunctions, RuntimeMatchmakerMatchedFunction, RuntimeTournamentEndFunction, RuntimeTournamentResetFunction, RuntimeLeaderboardResetFunction, RuntimePurchaseNotificationAppleFunction, RuntimeSubscriptionNotificationAppleFunction, RuntimePurchaseNotificationGoogleFunction, RuntimeSubscriptionNotificationGoogleFunction, map[string]RuntimeStorageIndexFilterFunction, error) {
+func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, leaderboardRankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, eventFn RuntimeEventCustomFunction, rootPath string, paths []string, matchProvider *MatchProvider, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy) ([]string, map[string]RuntimeRpcFunction, map[string]RuntimeBeforeRtFunction, map[string]RuntimeAfterRtFunction, *RuntimeBeforeReqFunctions, *RuntimeAfterReqFunctions, RuntimeMatchmakerMatchedFunction, RuntimeTournamentEndFunction, RuntimeTournamentResetFunction, RuntimeLeaderboardResetFunction, RuntimePurchaseNotificationAppleFunction, RuntimeSubscriptionNotificationAppleFunction, RuntimePurchaseNotificationGoogleFunction, RuntimeSubscriptionNotificationGoogleFunction, map[string]RuntimeStorageIndexFilterFunction, *RuntimeServerHookFunctions, error) {
 	startupLogger.Info("Initialising Lua runtime provider", zap.String("path", rootPath))
 
 	// Load Lua modules into memory by reading the file contents. No evaluation/execution at this stage.
 	moduleCache, modulePaths, stdLibs, err := openLuaModules(startupLogger, rootPath, paths)
 	if err != nil {
 		// Errors already logged in the function call above.
-		return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
 	}
 
 	once := &sync.Once{}
@@ -137,6 +148,7 @@ func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logge
 	var purchaseNotificationGoogleFunction RuntimePurchaseNotificationGoogleFunction
 	var subscriptionNotificationGoogleFunction RuntimeSubscriptionNotificationGoogleFunction
 	storageIndexFilterFunctions := make(map[string]RuntimeStorageIndexFilterFunction, 0)
+	serverHookFunctions := &RuntimeServerHookFunctions{}
 
 	var sharedReg *lua.LTable
 	var sharedGlobals *lua.LTable
@@ -151,6 +163,10 @@ func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logge
 		leaderboardCache:     leaderboardCache,
 		leaderboardRankCache: leaderboardRankCache,
 		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		groupIndex:           groupIndex,
+		rateLimiter:          rateLimiter,
+		namePolicy:           namePolicy,
 		sessionRegistry:      sessionRegistry,
 		matchRegistry:        matchRegistry,
 		tracker:              tracker,
@@ -169,11 +185,11 @@ func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logge
 
 	matchProvider.RegisterCreateFn("lua",
 		func(ctx context.Context, logger *zap.Logger, id uuid.UUID, node string, stopped *atomic.Bool, name string) (RuntimeMatchCore, error) {
-			return NewRuntimeLuaMatchCore(logger, name, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, stdLibs, once, localCache, eventFn, nil, nil, id, node, stopped, name, matchProvider, storageIndex)
+			return NewRuntimeLuaMatchCore(logger, name, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, stdLibs, once, localCache, eventFn, nil, nil, id, node, stopped, name, matchProvider, storageIndex, storageCollections, groupIndex, rateLimiter, namePolicy)
 		},
 	)
 
-	r, err := newRuntimeLuaVM(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, stdLibs, moduleCache, once, localCache, storageIndex, matchProvider.CreateMatch, eventFn, func(execMode RuntimeExecutionMode, id string) {
+	r, err := newRuntimeLuaVM(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, stdLibs, moduleCache, once, localCache, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy, matchProvider.CreateMatch, eventFn, func(execMode RuntimeExecutionMode, id string) {
 		switch execMode {
 		case RuntimeExecutionModeRPC:
 			rpcFunctions[id] = func(ctx context.Context, headers, queryParams map[string][]string, userID, username string, vars map[string]string, expiry int64, sessionID, clientIP, clientPort, lang, payload string) (string, error, codes.Code) {
@@ -1159,10 +1175,38 @@ func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logge
 			storageIndexFilterFunctions[id] = func(ctx context.Context, write *StorageOpWrite) (bool, error) {
 				return runtimeProviderLua.StorageIndexFilter(ctx, id, write)
 			}
+		case RuntimeExecutionModeBeforeAccountMerge:
+			serverHookFunctions.beforeAccountMergeFunction = func(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+				return runtimeProviderLua.BeforeAccountMerge(ctx, userID, username, policy)
+			}
+		case RuntimeExecutionModeBeforeTrade:
+			serverHookFunctions.beforeTradeFunction = func(ctx context.Context, userID, action string, trade *Trade) (error, codes.Code) {
+				return runtimeProviderLua.BeforeTrade(ctx, userID, action, trade)
+			}
+		case RuntimeExecutionModeAfterTrade:
+			serverHookFunctions.afterTradeFunction = func(ctx context.Context, userID, action string, trade *Trade) error {
+				return runtimeProviderLua.AfterTrade(ctx, userID, action, trade)
+			}
+		case RuntimeExecutionModeStorageExpiry:
+			serverHookFunctions.storageExpiryFunction = func(ctx context.Context, objects []*api.StorageObject) error {
+				return runtimeProviderLua.StorageExpiry(ctx, objects)
+			}
+		case RuntimeExecutionModeBeforeOIDC:
+			serverHookFunctions.beforeOIDCFunction = func(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+				return runtimeProviderLua.BeforeOIDC(ctx, userID, username, action, request)
+			}
+		case RuntimeExecutionModeAfterOIDC:
+			serverHookFunctions.afterOIDCFunction = func(ctx context.Context, userID, username, action string, request *OIDCRequest) error {
+				return runtimeProviderLua.AfterOIDC(ctx, userID, username, action, request)
+			}
+		case RuntimeExecutionModeEmailTemplate:
+			serverHookFunctions.emailTemplateFunction = func(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error) {
+				return runtimeProviderLua.EmailTemplate(ctx, userID, username, request)
+			}
 		}
 	})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, err
 	}
 
 	if config.GetRuntime().GetLuaReadOnlyGlobals() {
@@ -1209,7 +1253,7 @@ func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logge
 		r.Stop()
 
 		runtimeProviderLua.newFn = func() *RuntimeLua {
-			r, err := newRuntimeLuaVM(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, stdLibs, moduleCache, once, localCache, storageIndex, matchProvider.CreateMatch, eventFn, nil)
+			r, err := newRuntimeLuaVM(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, leaderboardRankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, stdLibs, moduleCache, once, localCache, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy, matchProvider.CreateMatch, eventFn, nil)
 			if err != nil {
 				logger.Fatal("Failed to initialize Lua runtime", zap.Error(err))
 			}
@@ -1230,7 +1274,7 @@ func NewRuntimeProviderLua(ctx context.Context, logger, startupLogger *zap.Logge
 	}
 	startupLogger.Info("Allocated minimum Lua runtime pool")
 
-	return modulePaths, rpcFunctions, beforeRtFunctions, afterRtFunctions, beforeReqFunctions, afterReqFunctions, matchmakerMatchedFunction, tournamentEndFunction, tournamentResetFunction, leaderboardResetFunction, purchaseNotificationAppleFunction, subscriptionNotificationAppleFunction, purchaseNotificationGoogleFunction, subscriptionNotificationGoogleFunction, storageIndexFilterFunctions, nil
+	return modulePaths, rpcFunctions, beforeRtFunctions, afterRtFunctions, beforeReqFunctions, afterReqFunctions, matchmakerMatchedFunction, tournamentEndFunction, tournamentResetFunction, leaderboardResetFunction, purchaseNotificationAppleFunction, subscriptionNotificationAppleFunction, purchaseNotificationGoogleFunction, subscriptionNotificationGoogleFunction, storageIndexFilterFunctions, serverHookFunctions, nil
 }
 
 func CheckRuntimeProviderLua(logger *zap.Logger, config Config, version string, paths []string) error {
@@ -2079,6 +2123,276 @@ func (rp *RuntimeProviderLua) StorageIndexFilter(ctx context.Context, indexName
 	return lua.LVAsBool(retValue), nil
 }
 
+func (rp *RuntimeProviderLua) BeforeAccountMerge(ctx context.Context, userID, username string, policy *AccountMergePolicy) (*AccountMergePolicy, error, codes.Code) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return nil, err, codes.Internal
+	}
+	lf := r.GetCallback(RuntimeExecutionModeBeforeAccountMerge, "")
+	if lf == nil {
+		rp.Put(r)
+		return nil, errors.New("Runtime Before Account Merge function not found."), codes.NotFound
+	}
+
+	policyMap, err := runtimeValueToMap(policy)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert account merge policy", zap.Error(err))
+		return nil, errors.New("Could not run runtime Before Account Merge function."), codes.Internal
+	}
+
+	// Set context value used for logging
+	vmCtx := context.WithValue(ctx, ctxLoggerFields{}, map[string]string{"mode": RuntimeExecutionModeBeforeAccountMerge.String()})
+	r.vm.SetContext(vmCtx)
+	result, fnErr, code, isCustomErr := r.InvokeFunction(RuntimeExecutionModeBeforeAccountMerge, lf, nil, nil, userID, username, nil, 0, "", "", "", "", policyMap)
+	r.vm.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if !isCustomErr {
+			rp.logger.Error("Runtime Before Account Merge function caused an error.", zap.Error(fnErr))
+		}
+		return nil, clearFnError(fnErr, rp, lf), code
+	}
+
+	if result == nil {
+		// No return value, the policy is used as-is.
+		return nil, nil, codes.OK
+	}
+
+	updated := &AccountMergePolicy{}
+	if err = runtimeValueFromMap(result, updated); err != nil {
+		rp.logger.Error("Could not convert Before Account Merge result", zap.Any("result", result), zap.Error(err))
+		return nil, errors.New("Invalid return type from runtime Before Account Merge function, must be a table."), codes.Internal
+	}
+	return updated, nil, codes.OK
+}
+
+func (rp *RuntimeProviderLua) BeforeTrade(ctx context.Context, userID, action string, trade *Trade) (error, codes.Code) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err, codes.Internal
+	}
+	lf := r.GetCallback(RuntimeExecutionModeBeforeTrade, "")
+	if lf == nil {
+		rp.Put(r)
+		return errors.New("Runtime Before Trade function not found."), codes.NotFound
+	}
+
+	tradeMap, err := runtimeValueToMap(trade)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert trade", zap.Error(err))
+		return errors.New("Could not run runtime Before Trade function."), codes.Internal
+	}
+
+	// Set context value used for logging
+	vmCtx := context.WithValue(ctx, ctxLoggerFields{}, map[string]string{"mode": RuntimeExecutionModeBeforeTrade.String()})
+	r.vm.SetContext(vmCtx)
+	_, fnErr, code, isCustomErr := r.InvokeFunction(RuntimeExecutionModeBeforeTrade, lf, nil, nil, userID, "", nil, 0, "", "", "", "", action, tradeMap)
+	r.vm.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if !isCustomErr {
+			rp.logger.Error("Runtime Before Trade function caused an error.", zap.Error(fnErr))
+		}
+		return clearFnError(fnErr, rp, lf), code
+	}
+	return nil, codes.OK
+}
+
+func (rp *RuntimeProviderLua) AfterTrade(ctx context.Context, userID, action string, trade *Trade) error {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err
+	}
+	lf := r.GetCallback(RuntimeExecutionModeAfterTrade, "")
+	if lf == nil {
+		rp.Put(r)
+		return errors.New("Runtime After Trade function not found.")
+	}
+
+	tradeMap, err := runtimeValueToMap(trade)
+	if err != nil {
+		rp.Put(r)
+		return fmt.Errorf("Error running runtime After Trade hook: %v", err.Error())
+	}
+
+	// Set context value used for logging
+	vmCtx := context.WithValue(ctx, ctxLoggerFields{}, map[string]string{"mode": RuntimeExecutionModeAfterTrade.String()})
+	r.vm.SetContext(vmCtx)
+	_, fnErr, _, _ := r.InvokeFunction(RuntimeExecutionModeAfterTrade, lf, nil, nil, userID, "", nil, 0, "", "", "", "", action, tradeMap)
+	r.vm.SetContext(context.Background())
+	rp.Put(r)
+	if fnErr != nil {
+		return fmt.Errorf("Error running runtime After Trade hook: %v", clearFnError(fnErr, rp, lf).Error())
+	}
+	return nil
+}
+
+func (rp *RuntimeProviderLua) BeforeOIDC(ctx context.Context, userID, username, action string, request *OIDCRequest) (*OIDCRequest, error, codes.Code) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return nil, err, codes.Internal
+	}
+	lf := r.GetCallback(RuntimeExecutionModeBeforeOIDC, "")
+	if lf == nil {
+		rp.Put(r)
+		return nil, errors.New("Runtime Before OIDC function not found."), codes.NotFound
+	}
+
+	requestMap, err := runtimeValueToMap(request)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert OIDC request", zap.Error(err))
+		return nil, errors.New("Could not run runtime Before OIDC function."), codes.Internal
+	}
+
+	// Set context value used for logging
+	vmCtx := context.WithValue(ctx, ctxLoggerFields{}, map[string]string{"mode": RuntimeExecutionModeBeforeOIDC.String()})
+	r.vm.SetContext(vmCtx)
+	result, fnErr, code, isCustomErr := r.InvokeFunction(RuntimeExecutionModeBeforeOIDC, lf, nil, nil, userID, username, request.Vars, 0, "", "", "", "", action, requestMap)
+	r.vm.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if !isCustomErr {
+			rp.logger.Error("Runtime Before OIDC function caused an error.", zap.Error(fnErr))
+		}
+		return nil, clearFnError(fnErr, rp, lf), code
+	}
+
+	if result == nil {
+		// No return value, the request is used as-is.
+		return nil, nil, codes.OK
+	}
+
+	updated := &OIDCRequest{}
+	if err = runtimeValueFromMap(result, updated); err != nil {
+		rp.logger.Error("Could not convert Before OIDC result", zap.Any("result", result), zap.Error(err))
+		return nil, errors.New("Invalid return type from runtime Before OIDC function, must be a table."), codes.Internal
+	}
+	return updated, nil, codes.OK
+}
+
+func (rp *RuntimeProviderLua) AfterOIDC(ctx context.Context, userID, username, action string, request *OIDCRequest) error {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err
+	}
+	lf := r.GetCallback(RuntimeExecutionModeAfterOIDC, "")
+	if lf == nil {
+		rp.Put(r)
+		return errors.New("Runtime After OIDC function not found.")
+	}
+
+	requestMap, err := runtimeValueToMap(request)
+	if err != nil {
+		rp.Put(r)
+		return fmt.Errorf("Error running runtime After OIDC hook: %v", err.Error())
+	}
+
+	// Set context value used for logging
+	vmCtx := context.WithValue(ctx, ctxLoggerFields{}, map[string]string{"mode": RuntimeExecutionModeAfterOIDC.String()})
+	r.vm.SetContext(vmCtx)
+	_, fnErr, _, _ := r.InvokeFunction(RuntimeExecutionModeAfterOIDC, lf, nil, nil, userID, username, request.Vars, 0, "", "", "", "", action, requestMap)
+	r.vm.SetContext(context.Background())
+	rp.Put(r)
+	if fnErr != nil {
+		return fmt.Errorf("Error running runtime After OIDC hook: %v", clearFnError(fnErr, rp, lf).Error())
+	}
+	return nil
+}
+
+func (rp *RuntimeProviderLua) EmailTemplate(ctx context.Context, userID, username string, request *EmailTemplateRequest) (*EmailTemplate, error) {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lf := r.GetCallback(RuntimeExecutionModeEmailTemplate, "")
+	if lf == nil {
+		rp.Put(r)
+		return nil, errors.New("Runtime Email Template function not found.")
+	}
+
+	requestMap, err := runtimeValueToMap(request)
+	if err != nil {
+		rp.Put(r)
+		rp.logger.Error("Could not convert email template request", zap.Error(err))
+		return nil, errors.New("Could not run runtime Email Template function.")
+	}
+
+	// Set context value used for logging
+	vmCtx := context.WithValue(ctx, ctxLoggerFields{}, map[string]string{"mode": RuntimeExecutionModeEmailTemplate.String()})
+	r.vm.SetContext(vmCtx)
+	result, fnErr, _, isCustomErr := r.InvokeFunction(RuntimeExecutionModeEmailTemplate, lf, nil, nil, userID, username, nil, 0, "", "", "", "", requestMap)
+	r.vm.SetContext(context.Background())
+	rp.Put(r)
+
+	if fnErr != nil {
+		if !isCustomErr {
+			rp.logger.Error("Runtime Email Template function caused an error.", zap.Error(fnErr))
+		}
+		return nil, clearFnError(fnErr, rp, lf)
+	}
+
+	if result == nil {
+		// No return value, the built-in template is used.
+		return nil, nil
+	}
+
+	template := &EmailTemplate{}
+	if err = runtimeValueFromMap(result, template); err != nil {
+		rp.logger.Error("Could not convert Email Template result", zap.Any("result", result), zap.Error(err))
+		return nil, errors.New("Invalid return type from runtime Email Template function, must be a table.")
+	}
+	return template, nil
+}
+
+func (rp *RuntimeProviderLua) StorageExpiry(ctx context.Context, objects []*api.StorageObject) error {
+	r, err := rp.Get(ctx)
+	if err != nil {
+		return err
+	}
+	lf := r.GetCallback(RuntimeExecutionModeStorageExpiry, "")
+	if lf == nil {
+		rp.Put(r)
+		return errors.New("Runtime Storage Expiry function not found.")
+	}
+
+	objectMaps := make([]interface{}, 0, len(objects))
+	for _, o := range objects {
+		valueMap := make(map[string]interface{})
+		if err = json.Unmarshal([]byte(o.Value), &valueMap); err != nil {
+			rp.Put(r)
+			return fmt.Errorf("failed to convert value to json: %s", err.Error())
+		}
+		objectMaps = append(objectMaps, map[string]interface{}{
+			"key":              o.Key,
+			"collection":       o.Collection,
+			"user_id":          o.UserId,
+			"version":          o.Version,
+			"permission_read":  o.PermissionRead,
+			"permission_write": o.PermissionWrite,
+			"create_time":      o.CreateTime.GetSeconds(),
+			"update_time":      o.UpdateTime.GetSeconds(),
+			"value":            valueMap,
+		})
+	}
+
+	// Set context value used for logging
+	vmCtx := context.WithValue(ctx, ctxLoggerFields{}, map[string]string{"mode": RuntimeExecutionModeStorageExpiry.String()})
+	r.vm.SetContext(vmCtx)
+	_, fnErr, _, _ := r.InvokeFunction(RuntimeExecutionModeStorageExpiry, lf, nil, nil, "", "", nil, 0, "", "", "", "", objectMaps)
+	r.vm.SetContext(context.Background())
+	rp.Put(r)
+	if fnErr != nil {
+		return fmt.Errorf("Error running runtime Storage Expiry hook: %v", clearFnError(fnErr, rp, lf).Error())
+	}
+	return nil
+}
+
 func (rp *RuntimeProviderLua) Get(ctx context.Context) (*RuntimeLua, error) {
 	select {
 	case <-ctx.Done():
@@ -2247,6 +2561,20 @@ func (r *RuntimeLua) GetCallback(e RuntimeExecutionMode, key string) *lua.LFunct
 			return nil
 		}
 		return fn
+	case RuntimeExecutionModeBeforeAccountMerge:
+		return r.callbacks.BeforeAccountMerge
+	case RuntimeExecutionModeBeforeTrade:
+		return r.callbacks.BeforeTrade
+	case RuntimeExecutionModeAfterTrade:
+		return r.callbacks.AfterTrade
+	case RuntimeExecutionModeStorageExpiry:
+		return r.callbacks.StorageExpiry
+	case RuntimeExecutionModeBeforeOIDC:
+		return r.callbacks.BeforeOIDC
+	case RuntimeExecutionModeAfterOIDC:
+		return r.callbacks.AfterOIDC
+	case RuntimeExecutionModeEmailTemplate:
+		return r.callbacks.EmailTemplate
 	}
 
 	return nil
@@ -2369,7 +2697,7 @@ func checkRuntimeLuaVM(logger *zap.Logger, config Config, version string, stdLib
 		vm.Push(lua.LString(name))
 		vm.Call(1, 0)
 	}
-	nakamaModule := NewRuntimeLuaNakamaModule(logger, nil, nil, nil, config, version, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	nakamaModule := NewRuntimeLuaNakamaModule(logger, nil, nil, nil, config, version, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 	vm.PreloadModule("nakama", nakamaModule.Loader)
 
 	preload := vm.GetField(vm.GetField(vm.Get(lua.EnvironIndex), "package"), "preload")
@@ -2390,7 +2718,7 @@ func checkRuntimeLuaVM(logger *zap.Logger, config Config, version string, stdLib
 	return nil
 }
 
-func newRuntimeLuaVM(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, stdLibs map[string]lua.LGFunction, moduleCache *RuntimeLuaModuleCache, once *sync.Once, localCache *RuntimeLuaLocalCache, storageIndex StorageIndex, matchCreateFn RuntimeMatchCreateFunction, eventFn RuntimeEventCustomFunction, announceCallbackFn func(RuntimeExecutionMode, string)) (*RuntimeLua, error) {
+func newRuntimeLuaVM(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, stdLibs map[string]lua.LGFunction, moduleCache *RuntimeLuaModuleCache, once *sync.Once, localCache *RuntimeLuaLocalCache, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy, matchCreateFn RuntimeMatchCreateFunction, eventFn RuntimeEventCustomFunction, announceCallbackFn func(RuntimeExecutionMode, string)) (*RuntimeLua, error) {
 	vm := lua.NewState(lua.Options{
 		CallStackSize:       config.GetRuntime().GetLuaCallStackSize(),
 		RegistrySize:        config.GetRuntime().GetLuaRegistrySize(),
@@ -2435,9 +2763,23 @@ func newRuntimeLuaVM(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojs
 			callbacks.SubscriptionNotificationGoogle = fn
 		case RuntimeExecutionModeStorageIndexFilter:
 			callbacks.StorageIndexFilter.Store(key, fn)
+		case RuntimeExecutionModeBeforeAccountMerge:
+			callbacks.BeforeAccountMerge = fn
+		case RuntimeExecutionModeBeforeTrade:
+			callbacks.BeforeTrade = fn
+		case RuntimeExecutionModeAfterTrade:
+			callbacks.AfterTrade = fn
+		case RuntimeExecutionModeStorageExpiry:
+			callbacks.StorageExpiry = fn
+		case RuntimeExecutionModeBeforeOIDC:
+			callbacks.BeforeOIDC = fn
+		case RuntimeExecutionModeAfterOIDC:
+			callbacks.AfterOIDC = fn
+		case RuntimeExecutionModeEmailTemplate:
+			callbacks.EmailTemplate = fn
 		}
 	}
-	nakamaModule := NewRuntimeLuaNakamaModule(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, rankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, once, localCache, storageIndex, matchCreateFn, eventFn, registerCallbackFn, announceCallbackFn)
+	nakamaModule := NewRuntimeLuaNakamaModule(logger, db, protojsonMarshaler, protojsonUnmarshaler, config, version, socialClient, leaderboardCache, rankCache, leaderboardScheduler, sessionRegistry, sessionCache, statusRegistry, matchRegistry, tracker, metrics, streamManager, router, once, localCache, storageIndex, storageCollections, storeCatalog, groupIndex, rateLimiter, namePolicy, matchCreateFn, eventFn, registerCallbackFn, announceCallbackFn)
 	vm.PreloadModule("nakama", nakamaModule.Loader)
 	r := &RuntimeLua{
 		logger:    logger,
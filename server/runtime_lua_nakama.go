@@ -47,6 +47,7 @@ import (
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/rtapi"
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/heroiclabs/nakama/v3/iap"
 	"github.com/heroiclabs/nakama/v3/internal/cronexpr"
 	lua "github.com/heroiclabs/nakama/v3/internal/gopher-lua"
 	"github.com/heroiclabs/nakama/v3/internal/satori"
@@ -78,6 +79,11 @@ type RuntimeLuaNakamaModule struct {
 	tracker              Tracker
 	metrics              Metrics
 	storageIndex         StorageIndex
+	storageCollections   StorageCollectionRegistry
+	storeCatalog         StoreCatalog
+	groupIndex           GroupIndex
+	rateLimiter          RateLimiter
+	namePolicy           NamePolicy
 	streamManager        StreamManager
 	router               MessageRouter
 	once                 *sync.Once
@@ -94,7 +100,7 @@ type RuntimeLuaNakamaModule struct {
 	satori runtime.Satori
 }
 
-func NewRuntimeLuaNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, once *sync.Once, localCache *RuntimeLuaLocalCache, storageIndex StorageIndex, matchCreateFn RuntimeMatchCreateFunction, eventFn RuntimeEventCustomFunction, registerCallbackFn func(RuntimeExecutionMode, string, *lua.LFunction), announceCallbackFn func(RuntimeExecutionMode, string)) *RuntimeLuaNakamaModule {
+func NewRuntimeLuaNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, config Config, version string, socialClient *social.Client, leaderboardCache LeaderboardCache, rankCache LeaderboardRankCache, leaderboardScheduler LeaderboardScheduler, sessionRegistry SessionRegistry, sessionCache SessionCache, statusRegistry StatusRegistry, matchRegistry MatchRegistry, tracker Tracker, metrics Metrics, streamManager StreamManager, router MessageRouter, once *sync.Once, localCache *RuntimeLuaLocalCache, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, storeCatalog StoreCatalog, groupIndex GroupIndex, rateLimiter RateLimiter, namePolicy NamePolicy, matchCreateFn RuntimeMatchCreateFunction, eventFn RuntimeEventCustomFunction, registerCallbackFn func(RuntimeExecutionMode, string, *lua.LFunction), announceCallbackFn func(RuntimeExecutionMode, string)) *RuntimeLuaNakamaModule {
 	return &RuntimeLuaNakamaModule{
 		logger:               logger,
 		db:                   db,
@@ -117,6 +123,11 @@ func NewRuntimeLuaNakamaModule(logger *zap.Logger, db *sql.DB, protojsonMarshale
 		once:                 once,
 		localCache:           localCache,
 		storageIndex:         storageIndex,
+		storageCollections:   storageCollections,
+		storeCatalog:         storeCatalog,
+		groupIndex:           groupIndex,
+		rateLimiter:          rateLimiter,
+		namePolicy:           namePolicy,
 		registerCallbackFn:   registerCallbackFn,
 		announceCallbackFn:   announceCallbackFn,
 		httpClient:           &http.Client{},
@@ -143,6 +154,15 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"register_leaderboard_reset":         n.registerLeaderboardReset,
 		"register_storage_index":             n.registerStorageIndex,
 		"register_storage_index_filter":      n.registerStorageIndexFilter,
+		"register_storage_collection_rules":  n.registerStorageCollectionRules,
+		"register_storage_expiry":            n.registerStorageExpiry,
+		"register_before_account_merge":      n.registerBeforeAccountMerge,
+		"register_before_trade":              n.registerBeforeTrade,
+		"register_after_trade":               n.registerAfterTrade,
+		"register_before_oidc":               n.registerBeforeOIDC,
+		"register_after_oidc":                n.registerAfterOIDC,
+		"register_email_template":            n.registerEmailTemplate,
+		"register_store_product":             n.registerStoreProduct,
 		"run_once":                           n.runOnce,
 		"get_context":                        n.getContext,
 		"event":                              n.event,
@@ -155,6 +175,9 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"localcache_clear":                   n.localcacheClear,
 		"time":                               n.time,
 		"cron_prev":                          n.cronPrev,
+		"rate_limit_check":                   n.rateLimitCheck,
+		"rate_limit_consume":                 n.rateLimitConsume,
+		"name_policy_check":                  n.namePolicyCheck,
 		"cron_next":                          n.cronNext,
 		"sql_exec":                           n.sqlExec,
 		"sql_query":                          n.sqlQuery,
@@ -190,6 +213,7 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"authenticate_game_center":           n.authenticateGameCenter,
 		"authenticate_google":                n.authenticateGoogle,
 		"authenticate_steam":                 n.authenticateSteam,
+		"authenticate_oidc":                  n.authenticateOIDC,
 		"authenticate_token_generate":        n.authenticateTokenGenerate,
 		"logger_debug":                       n.loggerDebug,
 		"logger_info":                        n.loggerInfo,
@@ -199,6 +223,7 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"accounts_get_id":                    n.accountsGetId,
 		"account_update_id":                  n.accountUpdateId,
 		"account_delete_id":                  n.accountDeleteId,
+		"accounts_merge":                     n.accountsMerge,
 		"account_export_id":                  n.accountExportId,
 		"users_get_id":                       n.usersGetId,
 		"users_get_username":                 n.usersGetUsername,
@@ -214,6 +239,7 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"link_gamecenter":                    n.linkGameCenter,
 		"link_google":                        n.linkGoogle,
 		"link_steam":                         n.linkSteam,
+		"link_oidc":                          n.linkOIDC,
 		"unlink_apple":                       n.unlinkApple,
 		"unlink_custom":                      n.unlinkCustom,
 		"unlink_device":                      n.unlinkDevice,
@@ -223,6 +249,8 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"unlink_gamecenter":                  n.unlinkGameCenter,
 		"unlink_google":                      n.unlinkGoogle,
 		"unlink_steam":                       n.unlinkSteam,
+		"unlink_oidc":                        n.unlinkOIDC,
+		"user_identities_list":               n.userIdentitiesList,
 		"stream_user_list":                   n.streamUserList,
 		"stream_user_get":                    n.streamUserGet,
 		"stream_user_join":                   n.streamUserJoin,
@@ -235,6 +263,10 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"stream_send_raw":                    n.streamSendRaw,
 		"session_disconnect":                 n.sessionDisconnect,
 		"session_logout":                     n.sessionLogout,
+		"sessions_list":                      n.sessionsList,
+		"totp_enabled":                       n.totpEnabled,
+		"totp_verify":                        n.totpVerify,
+		"session_revoke":                     n.sessionRevoke,
 		"match_create":                       n.matchCreate,
 		"match_get":                          n.matchGet,
 		"match_list":                         n.matchList,
@@ -247,12 +279,19 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"wallets_update":                     n.walletsUpdate,
 		"wallet_ledger_update":               n.walletLedgerUpdate,
 		"wallet_ledger_list":                 n.walletLedgerList,
+		"wallet_hold":                        n.walletHold,
+		"wallet_hold_capture":                n.walletHoldCapture,
+		"wallet_hold_release":                n.walletHoldRelease,
+		"wallet_holds_list":                  n.walletHoldsList,
 		"storage_list":                       n.storageList,
 		"storage_read":                       n.storageRead,
 		"storage_write":                      n.storageWrite,
 		"storage_delete":                     n.storageDelete,
+		"storage_history_list":               n.storageHistoryList,
+		"storage_history_restore":            n.storageHistoryRestore,
 		"multi_update":                       n.multiUpdate,
 		"leaderboard_create":                 n.leaderboardCreate,
+		"leaderboard_group_aggregate_create": n.leaderboardGroupAggregateCreate,
 		"leaderboard_delete":                 n.leaderboardDelete,
 		"leaderboard_list":                   n.leaderboardList,
 		"leaderboard_records_list":           n.leaderboardRecordsList,
@@ -266,6 +305,8 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"purchase_validate_huawei":                  n.purchaseValidateHuawei,
 		"purchase_validate_facebook_instant":        n.purchaseValidateFacebookInstant,
 		"purchase_get_by_transaction_id":            n.purchaseGetByTransactionId,
+		"purchase_history_apple":                    n.purchaseHistoryApple,
+		"purchase_refunds_apple":                    n.purchaseRefundsApple,
 		"purchases_list":                            n.purchasesList,
 		"subscription_validate_apple":               n.subscriptionValidateApple,
 		"subscription_validate_google":              n.subscriptionValidateGoogle,
@@ -281,6 +322,11 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"tournament_record_write":                   n.tournamentRecordWrite,
 		"tournament_record_delete":                  n.tournamentRecordDelete,
 		"tournament_records_haystack":               n.tournamentRecordsHaystack,
+		"league_create":                             n.leagueCreate,
+		"league_delete":                             n.leagueDelete,
+		"league_join":                               n.leagueJoin,
+		"league_leave":                              n.leagueLeave,
+		"league_cohort_get":                         n.leagueCohortGet,
 		"groups_get_id":                             n.groupsGetId,
 		"group_create":                              n.groupCreate,
 		"group_update":                              n.groupUpdate,
@@ -293,6 +339,15 @@ func (n *RuntimeLuaNakamaModule) Loader(l *lua.LState) int {
 		"group_users_demote":                        n.groupUsersDemote,
 		"group_users_list":                          n.groupUsersList,
 		"group_users_kick":                          n.groupUsersKick,
+		"group_role_upsert":                         n.groupRoleUpsert,
+		"group_role_delete":                         n.groupRoleDelete,
+		"group_roles_list":                          n.groupRolesList,
+		"group_user_role_set":                       n.groupUserRoleSet,
+		"group_users_invite":                        n.groupUsersInvite,
+		"group_invite_accept":                       n.groupInviteAccept,
+		"group_invite_reject":                       n.groupInviteReject,
+		"group_invites_list":                        n.groupInvitesList,
+		"group_applications_list":                   n.groupApplicationsList,
 		"groups_list":                               n.groupsList,
 		"groups_get_random":                         n.groupsGetRandom,
 		"user_groups_list":                          n.userGroupsList,
@@ -536,11 +591,85 @@ func (n *RuntimeLuaNakamaModule) registerStorageIndex(l *lua.LState) int {
 	return 0
 }
 
+// @group storage
+// @summary Set rules enforced on every write to a storage collection.
+// @param collection(type=string) Collection the rules apply to.
+// @param schema(type=table, optional=true) JSON Schema that object values must match, as a table or JSON string. Supports the type, enum, const, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength, pattern, items, minItems, maxItems, uniqueItems, properties, required, additionalProperties, minProperties, maxProperties, allOf, anyOf, oneOf and not keywords. Other keywords are ignored, and references are not supported.
+// @param maxValueSizeBytes(type=number, optional=true, default=0) Maximum size of object values in bytes. 0 is unlimited.
+// @param maxObjectsPerUser(type=number, optional=true, default=0) Maximum number of objects each user can own in the collection. 0 is unlimited.
+// @param permissionRead(type=table, optional=true) A table of read permission values writes may set. Default all.
+// @param permissionWrite(type=table, optional=true) A table of write permission values writes may set. Default all.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerStorageCollectionRules(l *lua.LState) int {
+	config := &StorageCollectionRulesConfig{Collection: l.CheckString(1)}
+
+	switch schema := l.Get(2).(type) {
+	case *lua.LNilType:
+	case lua.LString:
+		config.Schema = schema.String()
+	case *lua.LTable:
+		schemaBytes, err := json.Marshal(RuntimeLuaConvertLuaValue(schema))
+		if err != nil {
+			l.ArgError(2, fmt.Sprintf("failed to convert schema: %s", err.Error()))
+			return 0
+		}
+		config.Schema = string(schemaBytes)
+	default:
+		l.ArgError(2, "expects schema to be a table or string")
+		return 0
+	}
+
+	config.MaxValueSizeBytes = l.OptInt(3, 0)
+	config.MaxObjectsPerUser = l.OptInt(4, 0)
+
+	for i, permissions := range []*[]int{&config.PermissionRead, &config.PermissionWrite} {
+		table := l.OptTable(5+i, nil)
+		if table == nil {
+			continue
+		}
+		table.ForEach(func(k, v lua.LValue) {
+			if v.Type() != lua.LTNumber {
+				l.ArgError(5+i, "expects each permission to be a number")
+				return
+			}
+			*permissions = append(*permissions, int(lua.LVAsNumber(v)))
+		})
+	}
+
+	if err := n.storageCollections.RegisterCollectionRules(config); err != nil {
+		l.RaiseError("failed to register storage collection rules: %s", err.Error())
+	}
+
+	return 0
+}
+
 // @group storage
 // @summary List storage index entries
 // @param indexName(type=string) Name of the index to register filter function.
 // @param fn(type=function) A function reference which will be executed on each storage object to be written that is a candidate for the index.
 // @return error(error) An optional error value if an error occurred.
+// @group store
+// @summary Add a product to the store catalog, in addition to those in the server config.
+// @param product(type=table) The product, with 'id', optional 'iap_product_ids', 'price' and 'wallet' currency tables, and 'items' storage objects with 'collection', optional 'key', 'value', 'permission_read' and 'permission_write'.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerStoreProduct(l *lua.LState) int {
+	product, err := storeProductFromMap(RuntimeLuaConvertLuaTable(l.CheckTable(1)))
+	if err != nil {
+		l.ArgError(1, fmt.Sprintf("invalid product: %s", err.Error()))
+		return 0
+	}
+
+	// Modules are loaded again in each pooled VM, only register the product once.
+	if n.registerCallbackFn == nil {
+		return 0
+	}
+	if err = n.storeCatalog.RegisterProduct(product); err != nil {
+		l.RaiseError("failed to register store product: %s", err.Error())
+	}
+
+	return 0
+}
+
 func (n *RuntimeLuaNakamaModule) registerStorageIndexFilter(l *lua.LState) int {
 	fn := l.CheckFunction(1)
 
@@ -553,6 +682,118 @@ func (n *RuntimeLuaNakamaModule) registerStorageIndexFilter(l *lua.LState) int {
 	return 0
 }
 
+// @group hooks
+// @summary Registers a function to be run with each batch of expired storage objects deleted by the server.
+// @param fn(type=function) A function reference which will be executed with the list of expired storage objects.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerStorageExpiry(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	if n.registerCallbackFn != nil {
+		n.registerCallbackFn(RuntimeExecutionModeStorageExpiry, "", fn)
+	}
+	if n.announceCallbackFn != nil {
+		n.announceCallbackFn(RuntimeExecutionModeStorageExpiry, "")
+	}
+	return 0
+}
+
+// @group hooks
+// @summary Registers a function to be run before a player initiated account merge. It receives the merge policy and may return an adjusted policy, or raise an error to reject the merge.
+// @param fn(type=function) A function reference which will be executed before each account merge.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerBeforeAccountMerge(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	if n.registerCallbackFn != nil {
+		n.registerCallbackFn(RuntimeExecutionModeBeforeAccountMerge, "", fn)
+	}
+	if n.announceCallbackFn != nil {
+		n.announceCallbackFn(RuntimeExecutionModeBeforeAccountMerge, "")
+	}
+	return 0
+}
+
+// @group hooks
+// @summary Registers a function to be run before each trade action, with the action name and the trade as it would be after the action. Raising an error rejects the action.
+// @param fn(type=function) A function reference which will be executed before each trade action.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerBeforeTrade(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	if n.registerCallbackFn != nil {
+		n.registerCallbackFn(RuntimeExecutionModeBeforeTrade, "", fn)
+	}
+	if n.announceCallbackFn != nil {
+		n.announceCallbackFn(RuntimeExecutionModeBeforeTrade, "")
+	}
+	return 0
+}
+
+// @group hooks
+// @summary Registers a function to be run after each trade action, including trades expired by the server.
+// @param fn(type=function) A function reference which will be executed after each trade action.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerAfterTrade(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	if n.registerCallbackFn != nil {
+		n.registerCallbackFn(RuntimeExecutionModeAfterTrade, "", fn)
+	}
+	if n.announceCallbackFn != nil {
+		n.announceCallbackFn(RuntimeExecutionModeAfterTrade, "")
+	}
+	return 0
+}
+
+// @group hooks
+// @summary Registers a function to be run before each OpenID Connect authenticate, link or unlink request, with the action name and the request. It may return an adjusted request table, raising an error rejects the request.
+// @param fn(type=function) A function reference which will be executed before each OpenID Connect request.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerBeforeOIDC(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	if n.registerCallbackFn != nil {
+		n.registerCallbackFn(RuntimeExecutionModeBeforeOIDC, "", fn)
+	}
+	if n.announceCallbackFn != nil {
+		n.announceCallbackFn(RuntimeExecutionModeBeforeOIDC, "")
+	}
+	return 0
+}
+
+// @group hooks
+// @summary Registers a function to be run after each successful OpenID Connect authenticate, link or unlink request.
+// @param fn(type=function) A function reference which will be executed after each OpenID Connect request.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerAfterOIDC(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	if n.registerCallbackFn != nil {
+		n.registerCallbackFn(RuntimeExecutionModeAfterOIDC, "", fn)
+	}
+	if n.announceCallbackFn != nil {
+		n.announceCallbackFn(RuntimeExecutionModeAfterOIDC, "")
+	}
+	return 0
+}
+
+// @group hooks
+// @summary Registers a function to render verification, password reset and email change emails. It is called with a table of the purpose, recipient email, token and expiry time, and may return a table with a subject, body and optional html body. Fields left empty keep the built-in content.
+// @param fn(type=function) A function reference which will be executed for each email sent.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) registerEmailTemplate(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	if n.registerCallbackFn != nil {
+		n.registerCallbackFn(RuntimeExecutionModeEmailTemplate, "", fn)
+	}
+	if n.announceCallbackFn != nil {
+		n.announceCallbackFn(RuntimeExecutionModeEmailTemplate, "")
+	}
+	return 0
+}
+
 // @group hooks
 // @summary Registers a function to be run only once.
 // @param fn(type=function) A function reference which will be executed only once.
@@ -858,6 +1099,94 @@ func (n *RuntimeLuaNakamaModule) cronPrev(l *lua.LState) int {
 	return 1
 }
 
+// @group utils
+// @summary Check whether a runtime defined rate limit bucket has enough tokens for a request, without consuming them.
+// @param key(type=string) Bucket key, for example an operation name combined with a user ID.
+// @param rate(type=number) Tokens added to the bucket per second.
+// @param burst(type=number) Maximum tokens the bucket holds, and the tokens in a new bucket.
+// @param cost(type=number, optional=true, default=1) Tokens the request needs.
+// @return allowed(bool) True if the bucket has enough tokens.
+// @return remaining(number) Tokens currently in the bucket.
+// @return retry_after_sec(number) Seconds until the bucket would have enough tokens, 0 if it already has.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) rateLimitCheck(l *lua.LState) int {
+	return n.rateLimitTake(l, false)
+}
+
+// @group utils
+// @summary Consume tokens from a runtime defined rate limit bucket if it has enough for a request.
+// @param key(type=string) Bucket key, for example an operation name combined with a user ID.
+// @param rate(type=number) Tokens added to the bucket per second.
+// @param burst(type=number) Maximum tokens the bucket holds, and the tokens in a new bucket.
+// @param cost(type=number, optional=true, default=1) Tokens the request needs.
+// @return allowed(bool) True if the tokens were consumed.
+// @return remaining(number) Tokens left in the bucket.
+// @return retry_after_sec(number) Seconds until the bucket would have enough tokens, 0 if the tokens were consumed.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) rateLimitConsume(l *lua.LState) int {
+	return n.rateLimitTake(l, true)
+}
+
+func (n *RuntimeLuaNakamaModule) rateLimitTake(l *lua.LState, consume bool) int {
+	key := l.CheckString(1)
+	if key == "" {
+		l.ArgError(1, "expects key")
+		return 0
+	}
+
+	rate := float64(l.CheckNumber(2))
+	if rate <= 0 {
+		l.ArgError(2, "expects rate to be > 0")
+		return 0
+	}
+
+	burst := l.CheckInt(3)
+	if burst < 1 {
+		l.ArgError(3, "expects burst to be >= 1")
+		return 0
+	}
+
+	cost := l.OptInt(4, 1)
+	if cost < 1 || cost > burst {
+		l.ArgError(4, "expects cost to be >= 1 and <= burst")
+		return 0
+	}
+
+	allowed, remaining, wait := n.rateLimiter.Take(key, rate, burst, cost, consume)
+	l.Push(lua.LBool(allowed))
+	l.Push(lua.LNumber(remaining))
+	l.Push(lua.LNumber(rateLimitRetryAfterSec(wait)))
+	return 3
+}
+
+// @group utils
+// @summary Check a username, display name, group name or channel message against the configured name policy.
+// @param field(type=string) What is checked, one of "username", "display_name", "group_name" or "channel_message".
+// @param value(type=string) The name or message to check.
+// @return violation(table) A table with the field, reason and value if the check fails, or nil if it passes.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) namePolicyCheck(l *lua.LState) int {
+	field := l.CheckString(1)
+	if _, found := namePolicyFieldLabels[field]; !found {
+		l.ArgError(1, "expects field to be one of username, display_name, group_name or channel_message")
+		return 0
+	}
+	value := l.CheckString(2)
+
+	if err := n.namePolicy.Check(field, value); err != nil {
+		v, ok := err.(*NamePolicyViolation)
+		if !ok {
+			l.RaiseError("error checking name policy: %v", err.Error())
+			return 0
+		}
+		l.Push(RuntimeLuaConvertMap(l, v.Map()))
+		return 1
+	}
+
+	l.Push(lua.LNil)
+	return 1
+}
+
 // @group utils
 // @summary Execute an arbitrary SQL query and return the number of rows affected. Typically an "INSERT", "DELETE", or "UPDATE" statement with no return columns.
 // @param query(type=string) A SQL query to execute.
@@ -1698,7 +2027,7 @@ func (n *RuntimeLuaNakamaModule) authenticateApple(l *lua.LState) int {
 	// Parse create flag, if any.
 	create := l.OptBool(3, true)
 
-	dbUserID, dbUsername, created, err := AuthenticateApple(l.Context(), n.logger, n.db, n.socialClient, n.config.GetSocial().Apple.BundleId, token, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateApple(l.Context(), n.logger, n.db, n.socialClient, nil, n.config.GetSocial().Apple.BundleId, token, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -1748,7 +2077,7 @@ func (n *RuntimeLuaNakamaModule) authenticateCustom(l *lua.LState) int {
 	// Parse create flag, if any.
 	create := l.OptBool(3, true)
 
-	dbUserID, dbUsername, created, err := AuthenticateCustom(l.Context(), n.logger, n.db, id, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateCustom(l.Context(), n.logger, n.db, nil, id, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -1798,7 +2127,7 @@ func (n *RuntimeLuaNakamaModule) authenticateDevice(l *lua.LState) int {
 	// Parse create flag, if any.
 	create := l.OptBool(3, true)
 
-	dbUserID, dbUsername, created, err := AuthenticateDevice(l.Context(), n.logger, n.db, id, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateDevice(l.Context(), n.logger, n.db, nil, id, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -1872,11 +2201,11 @@ func (n *RuntimeLuaNakamaModule) authenticateEmail(l *lua.LState) int {
 	var err error
 
 	if attemptUsernameLogin {
-		dbUserID, err = AuthenticateUsername(l.Context(), n.logger, n.db, username, password)
+		dbUserID, err = AuthenticateUsername(l.Context(), n.logger, n.db, n.config, username, password)
 	} else {
 		cleanEmail := strings.ToLower(email)
 
-		dbUserID, username, created, err = AuthenticateEmail(l.Context(), n.logger, n.db, cleanEmail, password, username, create)
+		dbUserID, username, created, err = AuthenticateEmail(l.Context(), n.logger, n.db, n.config, nil, cleanEmail, password, username, create)
 	}
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
@@ -1925,7 +2254,7 @@ func (n *RuntimeLuaNakamaModule) authenticateFacebook(l *lua.LState) int {
 	// Parse create flag, if any.
 	create := l.OptBool(4, true)
 
-	dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(l.Context(), n.logger, n.db, n.socialClient, n.config.GetSocial().FacebookLimitedLogin.AppId, token, username, create)
+	dbUserID, dbUsername, created, importFriendsPossible, err := AuthenticateFacebook(l.Context(), n.logger, n.db, n.socialClient, nil, n.config.GetSocial().FacebookLimitedLogin.AppId, token, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -1975,7 +2304,7 @@ func (n *RuntimeLuaNakamaModule) authenticateFacebookInstantGame(l *lua.LState)
 	// Parse create flag, if any.
 	create := l.OptBool(3, true)
 
-	dbUserID, dbUsername, created, err := AuthenticateFacebookInstantGame(l.Context(), n.logger, n.db, n.socialClient, n.config.GetSocial().FacebookInstantGame.AppSecret, signedPlayerInfo, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateFacebookInstantGame(l.Context(), n.logger, n.db, n.socialClient, nil, n.config.GetSocial().FacebookInstantGame.AppSecret, signedPlayerInfo, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -2049,7 +2378,7 @@ func (n *RuntimeLuaNakamaModule) authenticateGameCenter(l *lua.LState) int {
 	// Parse create flag, if any.
 	create := l.OptBool(8, true)
 
-	dbUserID, dbUsername, created, err := AuthenticateGameCenter(l.Context(), n.logger, n.db, n.socialClient, playerID, bundleID, ts, salt, signature, publicKeyURL, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateGameCenter(l.Context(), n.logger, n.db, n.socialClient, nil, playerID, bundleID, ts, salt, signature, publicKeyURL, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -2093,7 +2422,7 @@ func (n *RuntimeLuaNakamaModule) authenticateGoogle(l *lua.LState) int {
 	// Parse create flag, if any.
 	create := l.OptBool(3, true)
 
-	dbUserID, dbUsername, created, err := AuthenticateGoogle(l.Context(), n.logger, n.db, n.socialClient, token, username, create)
+	dbUserID, dbUsername, created, err := AuthenticateGoogle(l.Context(), n.logger, n.db, n.socialClient, nil, token, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -2146,7 +2475,7 @@ func (n *RuntimeLuaNakamaModule) authenticateSteam(l *lua.LState) int {
 	// Parse create flag, if any.
 	create := l.OptBool(4, true)
 
-	dbUserID, dbUsername, steamID, created, err := AuthenticateSteam(l.Context(), n.logger, n.db, n.socialClient, n.config.GetSocial().Steam.AppID, n.config.GetSocial().Steam.PublisherKey, token, username, create)
+	dbUserID, dbUsername, steamID, created, err := AuthenticateSteam(l.Context(), n.logger, n.db, n.socialClient, nil, n.config.GetSocial().Steam.AppID, n.config.GetSocial().Steam.PublisherKey, token, username, create)
 	if err != nil {
 		l.RaiseError("error authenticating: %v", err.Error())
 		return 0
@@ -2164,6 +2493,57 @@ func (n *RuntimeLuaNakamaModule) authenticateSteam(l *lua.LState) int {
 	return 3
 }
 
+// @group authenticate
+// @summary Authenticate user and create a session token using an ID token issued by a configured OpenID Connect provider.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string) ID token issued by the provider.
+// @param username(type=string, optional=true) The user's username. If left empty, one is generated.
+// @param create(type=bool, optional=true, default=true) Create user if one didn't exist previously.
+// @return userID(string) The user ID of the authenticated user.
+// @return username(string) The username of the authenticated user.
+// @return created(bool) Value indicating if this account was just created or already existed.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) authenticateOIDC(l *lua.LState) int {
+	provider, err := oidcProviderConfig(n.config, l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects a configured OIDC provider name")
+		return 0
+	}
+
+	// Parse ID token.
+	token := l.CheckString(2)
+	if token == "" {
+		l.ArgError(2, "expects ID token string")
+		return 0
+	}
+
+	// Parse username, if any.
+	username := l.OptString(3, "")
+	if username == "" {
+		username = generateUsername()
+	} else if invalidUsernameRegex.MatchString(username) {
+		l.ArgError(3, "expects username to be valid, no spaces or control characters allowed")
+		return 0
+	} else if len(username) > 128 {
+		l.ArgError(3, "expects id to be valid, must be 1-128 bytes")
+		return 0
+	}
+
+	// Parse create flag, if any.
+	create := l.OptBool(4, true)
+
+	dbUserID, dbUsername, created, err := AuthenticateOIDC(l.Context(), n.logger, n.db, n.socialClient, nil, provider, token, username, create)
+	if err != nil {
+		l.RaiseError("error authenticating: %v", err.Error())
+		return 0
+	}
+
+	l.Push(lua.LString(dbUserID))
+	l.Push(lua.LString(dbUsername))
+	l.Push(lua.LBool(created))
+	return 3
+}
+
 // @group authenticate
 // @summary Generate a Nakama session token from a user ID.
 // @param userId(type=string) User ID to use to generate the token.
@@ -2228,6 +2608,11 @@ func (n *RuntimeLuaNakamaModule) authenticateTokenGenerate(l *lua.LState) int {
 
 	tokenId := uuid.Must(uuid.NewV4()).String()
 	token, exp := generateTokenWithExpiry(n.config.GetSession().EncryptionKey, tokenId, userIDString, username, varsMap, exp)
+	// Recorded so it can be listed and revoked like sessions issued by authentication.
+	if err = SessionRecord(l.Context(), n.logger, n.db, uid, tokenId, tokenId, varsMap, "", "", exp); err != nil {
+		l.RaiseError("error recording session: %v", err.Error())
+		return 0
+	}
 	n.sessionCache.Add(uid, exp, tokenId, 0, "")
 
 	l.Push(lua.LString(token))
@@ -2790,6 +3175,34 @@ func purchaseToLuaTable(l *lua.LState, p *api.ValidatedPurchase) *lua.LTable {
 	return validatedPurchaseTable
 }
 
+func appleTransactionsToLuaTable(l *lua.LState, transactions []*iap.AppleJWSTransaction) *lua.LTable {
+	transactionsTable := l.CreateTable(len(transactions), 0)
+	for i, t := range transactions {
+		transactionTable := l.CreateTable(0, 14)
+		transactionTable.RawSetString("transaction_id", lua.LString(t.TransactionId))
+		transactionTable.RawSetString("original_transaction_id", lua.LString(t.OriginalTransactionId))
+		transactionTable.RawSetString("bundle_id", lua.LString(t.BundleId))
+		transactionTable.RawSetString("product_id", lua.LString(t.ProductId))
+		transactionTable.RawSetString("type", lua.LString(t.Type))
+		transactionTable.RawSetString("quantity", lua.LNumber(t.Quantity))
+		transactionTable.RawSetString("environment", lua.LString(t.Environment))
+		transactionTable.RawSetString("app_account_token", lua.LString(t.AppAccountToken))
+		transactionTable.RawSetString("price", lua.LNumber(t.Price))
+		transactionTable.RawSetString("currency", lua.LString(t.Currency))
+		transactionTable.RawSetString("purchase_time", lua.LNumber(t.PurchaseDate/1000))
+		transactionTable.RawSetString("original_purchase_time", lua.LNumber(t.OriginalPurchaseDate/1000))
+		if t.ExpiresDate != 0 {
+			transactionTable.RawSetString("expiry_time", lua.LNumber(t.ExpiresDate/1000))
+		}
+		if t.RevocationDate != 0 {
+			transactionTable.RawSetString("refund_time", lua.LNumber(t.RevocationDate/1000))
+		}
+		transactionsTable.RawSetInt(i+1, transactionTable)
+	}
+
+	return transactionsTable
+}
+
 func subscriptionValidationToLuaTable(l *lua.LState, validation *api.ValidateSubscriptionResponse) *lua.LTable {
 	validatedSubscriptionResTable := l.CreateTable(0, 1)
 	validatedSubscriptionResTable.RawSetString("validated_subscription", subscriptionToLuaTable(l, validation.ValidatedSubscription))
@@ -3115,7 +3528,7 @@ func (n *RuntimeLuaNakamaModule) linkEmail(l *lua.LState) int {
 		return 0
 	}
 
-	if err := LinkEmail(l.Context(), n.logger, n.db, id, email, password); err != nil {
+	if err := LinkEmail(l.Context(), n.logger, n.db, n.config, id, email, password); err != nil {
 		l.RaiseError("error linking: %v", err.Error())
 	}
 	return 0
@@ -3292,6 +3705,38 @@ func (n *RuntimeLuaNakamaModule) linkSteam(l *lua.LState) int {
 	return 0
 }
 
+// @group authenticate
+// @summary Link an OpenID Connect provider identity to a user ID.
+// @param userId(type=string) The user ID to be linked.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string) ID token issued by the provider.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) linkOIDC(l *lua.LState) int {
+	userID := l.CheckString(1)
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		l.ArgError(1, "user ID must be a valid identifier")
+		return 0
+	}
+
+	provider, err := oidcProviderConfig(n.config, l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects a configured OIDC provider name")
+		return 0
+	}
+
+	token := l.CheckString(3)
+	if token == "" {
+		l.ArgError(3, "expects token string")
+		return 0
+	}
+
+	if err := LinkOIDC(l.Context(), n.logger, n.db, n.socialClient, provider, id, token); err != nil {
+		l.RaiseError("error linking: %v", err.Error())
+	}
+	return 0
+}
+
 // @group authenticate
 // @summary Unlink Apple authentication from a user ID.
 // @param userId(type=string) The user ID to be unlinked.
@@ -3519,34 +3964,93 @@ func (n *RuntimeLuaNakamaModule) unlinkSteam(l *lua.LState) int {
 	return 0
 }
 
-// @group streams
-// @summary List all users currently online and connected to a stream.
-// @param stream(type=table) A stream object consisting of a `mode` (int), `subject` (string), `descriptor` (string) and `label` (string).
-// @param includeHidden(type=bool, optional=true, default=true) Include stream presences marked as hidden in the results.
-// @param includeNotHidden(type=bool, optional=true, default=true) Include stream presences not marked as hidden in the results.
-// @return presences(table) Table of stream presences and their information.
+// @group authenticate
+// @summary Unlink an OpenID Connect provider identity from a user ID.
+// @param userId(type=string) The user ID to be unlinked.
+// @param provider(type=string) The name of the OIDC provider as set in the server configuration.
+// @param token(type=string, optional=true) ID token issued by the provider. If set, only unlinks the identity it belongs to.
 // @return error(error) An optional error value if an error occurred.
-func (n *RuntimeLuaNakamaModule) streamUserList(l *lua.LState) int {
-	// Parse input stream identifier.
-	streamTable := l.CheckTable(1)
-	if streamTable == nil {
-		l.ArgError(1, "expects a valid stream")
+func (n *RuntimeLuaNakamaModule) unlinkOIDC(l *lua.LState) int {
+	userID := l.CheckString(1)
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		l.ArgError(1, "user ID must be a valid identifier")
 		return 0
 	}
-	stream := PresenceStream{}
-	conversionError := ""
-	streamTable.ForEach(func(k lua.LValue, v lua.LValue) {
-		switch k.String() {
-		case "mode":
-			if v.Type() != lua.LTNumber {
-				conversionError = "stream mode must be a number"
-				return
-			}
-			stream.Mode = uint8(lua.LVAsNumber(v))
-		case "subject":
-			if v.Type() != lua.LTString {
-				conversionError = "stream subject must be a string"
-				return
+
+	provider, err := oidcProviderConfig(n.config, l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects a configured OIDC provider name")
+		return 0
+	}
+
+	token := l.OptString(3, "")
+
+	if err := UnlinkOIDC(l.Context(), n.logger, n.db, n.socialClient, provider, id, token); err != nil {
+		l.RaiseError("error unlinking: %v", err.Error())
+	}
+	return 0
+}
+
+// @group authenticate
+// @summary List the OpenID Connect provider identities linked to a user ID.
+// @param userId(type=string) The user ID to list identities for.
+// @return identities(table) The linked provider names and provider user IDs.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) userIdentitiesList(l *lua.LState) int {
+	userID := l.CheckString(1)
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		l.ArgError(1, "user ID must be a valid identifier")
+		return 0
+	}
+
+	identities, err := UserIdentitiesList(l.Context(), n.logger, n.db, id)
+	if err != nil {
+		l.RaiseError("error listing identities: %v", err.Error())
+		return 0
+	}
+
+	identitiesTable := l.CreateTable(len(identities), 0)
+	for i, identity := range identities {
+		it := l.CreateTable(0, 3)
+		it.RawSetString("provider", lua.LString(identity.Provider))
+		it.RawSetString("provider_id", lua.LString(identity.ProviderId))
+		it.RawSetString("create_time", lua.LNumber(identity.CreateTime))
+		identitiesTable.RawSetInt(i+1, it)
+	}
+	l.Push(identitiesTable)
+	return 1
+}
+
+// @group streams
+// @summary List all users currently online and connected to a stream.
+// @param stream(type=table) A stream object consisting of a `mode` (int), `subject` (string), `descriptor` (string) and `label` (string).
+// @param includeHidden(type=bool, optional=true, default=true) Include stream presences marked as hidden in the results.
+// @param includeNotHidden(type=bool, optional=true, default=true) Include stream presences not marked as hidden in the results.
+// @return presences(table) Table of stream presences and their information.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) streamUserList(l *lua.LState) int {
+	// Parse input stream identifier.
+	streamTable := l.CheckTable(1)
+	if streamTable == nil {
+		l.ArgError(1, "expects a valid stream")
+		return 0
+	}
+	stream := PresenceStream{}
+	conversionError := ""
+	streamTable.ForEach(func(k lua.LValue, v lua.LValue) {
+		switch k.String() {
+		case "mode":
+			if v.Type() != lua.LTNumber {
+				conversionError = "stream mode must be a number"
+				return
+			}
+			stream.Mode = uint8(lua.LVAsNumber(v))
+		case "subject":
+			if v.Type() != lua.LTString {
+				conversionError = "stream subject must be a string"
+				return
 			}
 			sid, err := uuid.FromString(v.String())
 			if err != nil {
@@ -4691,6 +5195,116 @@ func (n *RuntimeLuaNakamaModule) sessionLogout(l *lua.LState) int {
 	return 0
 }
 
+// @group sessions
+// @summary List a user's active sessions, with the device and client address each was issued to.
+// @param userId(type=string) The ID of the user to list sessions for.
+// @return sessions(table) The user's sessions, most recently seen first.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) sessionsList(l *lua.LState) int {
+	userID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects valid user id")
+		return 0
+	}
+
+	sessions, err := SessionsList(l.Context(), n.logger, n.db, n.sessionCache, userID)
+	if err != nil {
+		l.RaiseError("failed to list sessions: %s", err.Error())
+		return 0
+	}
+
+	sessionsTable := l.CreateTable(len(sessions), 0)
+	for i, session := range sessions {
+		st := l.CreateTable(0, 7)
+		st.RawSetString("id", lua.LString(session.Id))
+		st.RawSetString("device_name", lua.LString(session.DeviceName))
+		st.RawSetString("platform", lua.LString(session.Platform))
+		st.RawSetString("client_ip", lua.LString(session.ClientIp))
+		st.RawSetString("create_time", lua.LNumber(session.CreateTime))
+		st.RawSetString("last_seen_time", lua.LNumber(session.LastSeenTime))
+		st.RawSetString("expiry_time", lua.LNumber(session.ExpiryTime))
+		sessionsTable.RawSetInt(i+1, st)
+	}
+	l.Push(sessionsTable)
+	return 1
+}
+
+// @group sessions
+// @summary Revoke one of a user's sessions, disconnecting any sockets opened with it.
+// @param userId(type=string) The ID of the user the session belongs to.
+// @param sessionId(type=string) The ID of the session to revoke.
+// @param refreshOnly(type=bool, optional=true, default=false) Only revoke the session's refresh token, leaving its current session token and sockets valid until they expire.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) sessionRevoke(l *lua.LState) int {
+	userID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects valid user id")
+		return 0
+	}
+
+	sessionID := l.CheckString(2)
+	if sessionID == "" {
+		l.ArgError(2, "expects session id")
+		return 0
+	}
+
+	refreshOnly := l.OptBool(3, false)
+
+	if err := SessionRevoke(l.Context(), n.logger, n.db, n.config, n.sessionCache, n.sessionRegistry, n.tracker, userID, sessionID, refreshOnly); err != nil {
+		l.RaiseError("failed to revoke session: %s", err.Error())
+	}
+	return 0
+}
+
+// @group sessions
+// @summary Check whether a user has two-factor authentication enabled.
+// @param userId(type=string) The ID of the user to check.
+// @return enabled(bool) True if the user has confirmed two-factor authentication enrolment.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) totpEnabled(l *lua.LState) int {
+	userID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects valid user id")
+		return 0
+	}
+
+	enabled, err := TotpEnabled(l.Context(), n.logger, n.db, userID)
+	if err != nil {
+		l.RaiseError("failed to check two-factor authentication: %s", err.Error())
+		return 0
+	}
+
+	l.Push(lua.LBool(enabled))
+	return 1
+}
+
+// @group sessions
+// @summary Verify a two-factor authentication code, for step-up checks before sensitive operations. Each code is accepted once and repeated failures lock the user out of verification for a few minutes.
+// @param userId(type=string) The ID of the user to verify.
+// @param code(type=string) The code from the user's authenticator app.
+// @param allowRecovery(type=bool, optional=true, default=false) Also accept, and consume, one of the user's recovery codes.
+// @return error(error) An error if the code is invalid or verification failed.
+func (n *RuntimeLuaNakamaModule) totpVerify(l *lua.LState) int {
+	userID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects valid user id")
+		return 0
+	}
+
+	code := l.CheckString(2)
+	if code == "" {
+		l.ArgError(2, "expects code")
+		return 0
+	}
+
+	allowRecovery := l.OptBool(3, false)
+
+	if err := TotpVerify(l.Context(), n.logger, n.db, userID, code, allowRecovery); err != nil {
+		l.RaiseError("failed to verify two-factor authentication code: %s", err.Error())
+	}
+	return 0
+}
+
 // @group matches
 // @summary Create a new authoritative realtime multiplayer match running on the given runtime module name. The given params are passed to the match's init hook.
 // @param module(type=string) The name of an available runtime module that will be responsible for the match. This was registered in InitModule.
@@ -5584,6 +6198,166 @@ func (n *RuntimeLuaNakamaModule) walletLedgerList(l *lua.LState) int {
 	return 2
 }
 
+// @group wallets
+// @summary Take amounts from a user's wallet and hold them until the hold is captured or released, or expires and is released automatically.
+// @param userId(type=string) The ID of the user whose wallet the amounts are taken from.
+// @param changeset(type=table) The amounts to hold, by currency. Amounts must be greater than 0.
+// @param metadata(type=table, optional=true) Metadata kept with the hold and recorded in its wallet ledger entries.
+// @param expirySec(type=number, optional=true, default=0) Seconds until the hold expires, or 0 for the configured default.
+// @return hold(table) The created hold.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) walletHold(l *lua.LState) int {
+	userID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects a valid user id")
+		return 0
+	}
+
+	changeset, ok := luaWalletHoldChangeset(l, 2)
+	if !ok {
+		return 0
+	}
+	if changeset == nil {
+		l.ArgError(2, "expects a table as changeset value")
+		return 0
+	}
+
+	var metadata map[string]interface{}
+	if metadataTable := l.OptTable(3, nil); metadataTable != nil {
+		metadata = RuntimeLuaConvertLuaTable(metadataTable)
+	}
+
+	hold, err := WalletHoldCreate(l.Context(), n.logger, n.db, n.config, userID, changeset, metadata, l.OptInt(4, 0))
+	if err != nil {
+		l.RaiseError("failed to create wallet hold: %s", err.Error())
+		return 0
+	}
+
+	l.Push(luaWalletHold(l, hold))
+	return 1
+}
+
+// @group wallets
+// @summary Complete a wallet hold, keeping the given amounts and returning the rest of the hold to the wallet.
+// @param holdId(type=string) The ID of the hold.
+// @param changeset(type=table, optional=true) The amounts to keep, by currency, at most the held amounts. Nil keeps the whole hold.
+// @param metadata(type=table, optional=true) Metadata recorded in the wallet ledger entry for the capture.
+// @return hold(table) The captured hold.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) walletHoldCapture(l *lua.LState) int {
+	holdID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects a valid hold id")
+		return 0
+	}
+
+	changeset, ok := luaWalletHoldChangeset(l, 2)
+	if !ok {
+		return 0
+	}
+
+	var metadata map[string]interface{}
+	if metadataTable := l.OptTable(3, nil); metadataTable != nil {
+		metadata = RuntimeLuaConvertLuaTable(metadataTable)
+	}
+
+	hold, err := WalletHoldCapture(l.Context(), n.logger, n.db, holdID, changeset, metadata)
+	if err != nil {
+		l.RaiseError("failed to capture wallet hold: %s", err.Error())
+		return 0
+	}
+
+	l.Push(luaWalletHold(l, hold))
+	return 1
+}
+
+// @group wallets
+// @summary Cancel a wallet hold, returning all of it to the wallet.
+// @param holdId(type=string) The ID of the hold.
+// @param metadata(type=table, optional=true) Metadata recorded in the wallet ledger entry for the release.
+// @return hold(table) The released hold.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) walletHoldRelease(l *lua.LState) int {
+	holdID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects a valid hold id")
+		return 0
+	}
+
+	var metadata map[string]interface{}
+	if metadataTable := l.OptTable(2, nil); metadataTable != nil {
+		metadata = RuntimeLuaConvertLuaTable(metadataTable)
+	}
+
+	hold, err := WalletHoldRelease(l.Context(), n.logger, n.db, holdID, metadata)
+	if err != nil {
+		l.RaiseError("failed to release wallet hold: %s", err.Error())
+		return 0
+	}
+
+	l.Push(luaWalletHold(l, hold))
+	return 1
+}
+
+// @group wallets
+// @summary List the wallet holds of a user that are still held, oldest first.
+// @param userId(type=string) The ID of the user to list holds for.
+// @return holds(table) The user's open holds.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) walletHoldsList(l *lua.LState) int {
+	userID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects a valid user id")
+		return 0
+	}
+
+	holds, err := WalletHoldsList(l.Context(), n.logger, n.db, userID)
+	if err != nil {
+		l.RaiseError("failed to list wallet holds: %s", err.Error())
+		return 0
+	}
+
+	holdsTable := l.CreateTable(len(holds), 0)
+	for i, hold := range holds {
+		holdsTable.RawSetInt(i+1, luaWalletHold(l, hold))
+	}
+	l.Push(holdsTable)
+	return 1
+}
+
+// Read an optional changeset table argument, returning false if it was invalid.
+func luaWalletHoldChangeset(l *lua.LState, n int) (map[string]int64, bool) {
+	changesetTable := l.OptTable(n, nil)
+	if changesetTable == nil {
+		return nil, true
+	}
+	changesetMap := RuntimeLuaConvertLuaTable(changesetTable)
+	changeset := make(map[string]int64, len(changesetMap))
+	for k, v := range changesetMap {
+		vi, ok := v.(int64)
+		if !ok {
+			l.ArgError(n, "expects changeset values to be whole numbers")
+			return nil, false
+		}
+		changeset[k] = vi
+	}
+	return changeset, true
+}
+
+func luaWalletHold(l *lua.LState, hold *WalletHold) *lua.LTable {
+	holdTable := l.CreateTable(0, 9)
+	holdTable.RawSetString("id", lua.LString(hold.Id))
+	holdTable.RawSetString("user_id", lua.LString(hold.UserId))
+	holdTable.RawSetString("state", lua.LString(hold.State))
+	holdTable.RawSetString("changeset", RuntimeLuaConvertMapInt64(l, hold.Changeset))
+	holdTable.RawSetString("captured", RuntimeLuaConvertMapInt64(l, hold.Captured))
+	holdTable.RawSetString("metadata", RuntimeLuaConvertMap(l, hold.Metadata))
+	holdTable.RawSetString("create_time", lua.LNumber(hold.CreateTime))
+	holdTable.RawSetString("update_time", lua.LNumber(hold.UpdateTime))
+	holdTable.RawSetString("expiry_time", lua.LNumber(hold.ExpiryTime))
+	return holdTable
+}
+
 // @group storage
 // @summary List records in a collection and page through results. The records returned can be filtered to those owned by the user or "" for public records.
 // @param userId(type=string) User ID to list records for or "" (empty string) | void for public records.
@@ -5814,7 +6588,7 @@ func (n *RuntimeLuaNakamaModule) storageRead(l *lua.LState) int {
 
 // @group storage
 // @summary Write one or more objects by their collection/keyname and optional user.
-// @param objectIds(type=table) A table of object identifiers to be written.
+// @param objectIds(type=table) A table of object identifiers to be written. An optional ttl_sec expires an object after that many seconds, and an optional patch of "merge" or "json" applies the value as a JSON Merge Patch or JSON Patch to the existing object.
 // @return acks(table) A list of acks with the version of the written objects.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeLuaNakamaModule) storageWrite(l *lua.LState) int {
@@ -5835,7 +6609,7 @@ func (n *RuntimeLuaNakamaModule) storageWrite(l *lua.LState) int {
 		return 0
 	}
 
-	acks, _, err := StorageWriteObjects(l.Context(), n.logger, n.db, n.metrics, n.storageIndex, true, ops)
+	acks, _, err := StorageWriteObjects(l.Context(), n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, true, ops)
 	if err != nil {
 		l.RaiseError(fmt.Sprintf("failed to write storage objects: %s", err.Error()))
 		return 0
@@ -5872,6 +6646,9 @@ func tableToStorageWrites(l *lua.LState, dataTable *lua.LTable) (StorageOpWrites
 		}
 
 		var userID uuid.UUID
+		var ttlSec int64
+		var patch string
+		var valueTable *lua.LTable
 		d := &api.WriteStorageObject{}
 		dataTable.ForEach(func(k, v lua.LValue) {
 			if conversionError {
@@ -5921,14 +6698,8 @@ func tableToStorageWrites(l *lua.LState, dataTable *lua.LTable) (StorageOpWrites
 					l.ArgError(1, "expects value to be table")
 					return
 				}
-				valueMap := RuntimeLuaConvertLuaTable(v.(*lua.LTable))
-				valueBytes, err := json.Marshal(valueMap)
-				if err != nil {
-					conversionError = true
-					l.ArgError(1, fmt.Sprintf("failed to convert value: %s", err.Error()))
-					return
-				}
-				d.Value = string(valueBytes)
+				// Converted once the patch type is known.
+				valueTable = v.(*lua.LTable)
 			case "version":
 				if v.Type() != lua.LTString {
 					conversionError = true
@@ -5955,6 +6726,28 @@ func tableToStorageWrites(l *lua.LState, dataTable *lua.LTable) (StorageOpWrites
 					return
 				}
 				d.PermissionWrite = &wrapperspb.Int32Value{Value: int32(v.(lua.LNumber))}
+			case "ttl_sec":
+				if v.Type() != lua.LTNumber {
+					conversionError = true
+					l.ArgError(1, "expects ttl_sec to be number")
+					return
+				}
+				if ttlSec = int64(v.(lua.LNumber)); ttlSec < 0 {
+					conversionError = true
+					l.ArgError(1, "expects ttl_sec to be >= 0")
+					return
+				}
+			case "patch":
+				if v.Type() != lua.LTString {
+					conversionError = true
+					l.ArgError(1, "expects patch to be string")
+					return
+				}
+				if patch = v.String(); !storagePatchTypeValid(patch) {
+					conversionError = true
+					l.ArgError(1, "expects patch to be 'merge' or 'json'")
+					return
+				}
 			}
 		})
 
@@ -5962,6 +6755,23 @@ func tableToStorageWrites(l *lua.LState, dataTable *lua.LTable) (StorageOpWrites
 			return
 		}
 
+		if valueTable != nil {
+			// JSON patches are arrays of operations, any other value is an object.
+			var value interface{}
+			if patch == StoragePatchJson {
+				value = RuntimeLuaConvertLuaValue(valueTable)
+			} else {
+				value = RuntimeLuaConvertLuaTable(valueTable)
+			}
+			valueBytes, err := json.Marshal(value)
+			if err != nil {
+				conversionError = true
+				l.ArgError(1, fmt.Sprintf("failed to convert value: %s", err.Error()))
+				return
+			}
+			d.Value = string(valueBytes)
+		}
+
 		if d.Collection == "" {
 			conversionError = true
 			l.ArgError(1, "expects collection to be supplied")
@@ -5988,6 +6798,8 @@ func tableToStorageWrites(l *lua.LState, dataTable *lua.LTable) (StorageOpWrites
 		ops = append(ops, &StorageOpWrite{
 			OwnerID: userID.String(),
 			Object:  d,
+			TtlSec:  ttlSec,
+			Patch:   patch,
 		})
 	})
 
@@ -6026,30 +6838,142 @@ func storageOpWritesToTable(l *lua.LState, ops StorageOpWrites) (*lua.LTable, er
 }
 
 // @group storage
-// @summary Remove one or more objects by their collection/keyname and optional user.
-// @param objectIds(type=table) A list of object identifiers to be deleted.
+// @summary List the kept previous versions of a storage object in a collection with history enabled, most recently replaced first.
+// @param collection(type=string) The collection of the object.
+// @param key(type=string) The key of the object.
+// @param userId(type=string, optional=true) The owner of the object, or nil for objects owned by the system.
+// @param limit(type=number, optional=true, default=100) The maximum number of versions to return, between 1 and 100.
+// @return objects(table) A list of the previous versions of the object.
 // @return error(error) An optional error value if an error occurred.
-func (n *RuntimeLuaNakamaModule) storageDelete(l *lua.LState) int {
-	keysTable := l.CheckTable(1)
-	if keysTable == nil {
-		l.ArgError(1, "expects a valid set of object IDs")
+func (n *RuntimeLuaNakamaModule) storageHistoryList(l *lua.LState) int {
+	collection := l.CheckString(1)
+	if collection == "" {
+		l.ArgError(1, "expects collection to be a non-empty string")
 		return 0
 	}
-
-	size := keysTable.Len()
-	if size == 0 {
+	key := l.CheckString(2)
+	if key == "" {
+		l.ArgError(2, "expects key to be a non-empty string")
 		return 0
 	}
-
-	ops := make(StorageOpDeletes, 0, size)
-	conversionError := false
-	keysTable.ForEach(func(k, v lua.LValue) {
-		if conversionError {
-			return
+	userID := uuid.Nil
+	if userIDString := l.OptString(3, ""); userIDString != "" {
+		var err error
+		if userID, err = uuid.FromString(userIDString); err != nil {
+			l.ArgError(3, "expects user_id to be a valid ID")
+			return 0
 		}
+	}
+	limit := l.OptInt(4, storageHistoryMaxList)
+	if limit < 1 || limit > storageHistoryMaxList {
+		l.ArgError(4, "expects limit to be 1-100")
+		return 0
+	}
 
-		keyTable, ok := v.(*lua.LTable)
-		if !ok {
+	objects, err := StorageHistoryList(l.Context(), n.logger, n.db, collection, key, userID, limit)
+	if err != nil {
+		l.RaiseError(fmt.Sprintf("failed to list storage history: %s", err.Error()))
+		return 0
+	}
+
+	lv := l.CreateTable(len(objects), 0)
+	for i, v := range objects {
+		vt := l.CreateTable(0, 9)
+		vt.RawSetString("key", lua.LString(v.Key))
+		vt.RawSetString("collection", lua.LString(v.Collection))
+		vt.RawSetString("user_id", lua.LString(v.UserId))
+		vt.RawSetString("version", lua.LString(v.Version))
+		vt.RawSetString("permission_read", lua.LNumber(v.PermissionRead))
+		vt.RawSetString("permission_write", lua.LNumber(v.PermissionWrite))
+		vt.RawSetString("create_time", lua.LNumber(v.CreateTime.Seconds))
+		vt.RawSetString("update_time", lua.LNumber(v.UpdateTime.Seconds))
+
+		valueMap := make(map[string]interface{})
+		if err = json.Unmarshal([]byte(v.Value), &valueMap); err != nil {
+			l.RaiseError(fmt.Sprintf("failed to convert value to json: %s", err.Error()))
+			return 0
+		}
+		vt.RawSetString("value", RuntimeLuaConvertMap(l, valueMap))
+
+		lv.RawSetInt(i+1, vt)
+	}
+	l.Push(lv)
+	return 1
+}
+
+// @group storage
+// @summary Write a previous version of a storage object back, with the permissions it had.
+// @param collection(type=string) The collection of the object.
+// @param key(type=string) The key of the object.
+// @param userId(type=string) The owner of the object, or nil for objects owned by the system.
+// @param version(type=string) The version to restore, as returned by the history listing.
+// @return ack(table) An ack with the new version of the object.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) storageHistoryRestore(l *lua.LState) int {
+	collection := l.CheckString(1)
+	if collection == "" {
+		l.ArgError(1, "expects collection to be a non-empty string")
+		return 0
+	}
+	key := l.CheckString(2)
+	if key == "" {
+		l.ArgError(2, "expects key to be a non-empty string")
+		return 0
+	}
+	userID := uuid.Nil
+	if userIDString := l.OptString(3, ""); userIDString != "" {
+		var err error
+		if userID, err = uuid.FromString(userIDString); err != nil {
+			l.ArgError(3, "expects user_id to be a valid ID")
+			return 0
+		}
+	}
+	version := l.CheckString(4)
+	if version == "" {
+		l.ArgError(4, "expects version to be a non-empty string")
+		return 0
+	}
+
+	ack, _, err := StorageHistoryRestore(l.Context(), n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, collection, key, userID, version)
+	if err != nil {
+		l.RaiseError(fmt.Sprintf("failed to restore storage object: %s", err.Error()))
+		return 0
+	}
+
+	kt := l.CreateTable(0, 4)
+	kt.RawSetString("key", lua.LString(ack.Key))
+	kt.RawSetString("collection", lua.LString(ack.Collection))
+	kt.RawSetString("user_id", lua.LString(ack.UserId))
+	kt.RawSetString("version", lua.LString(ack.Version))
+	l.Push(kt)
+	return 1
+}
+
+// @group storage
+// @summary Remove one or more objects by their collection/keyname and optional user.
+// @param objectIds(type=table) A list of object identifiers to be deleted.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) storageDelete(l *lua.LState) int {
+	keysTable := l.CheckTable(1)
+	if keysTable == nil {
+		l.ArgError(1, "expects a valid set of object IDs")
+		return 0
+	}
+
+	size := keysTable.Len()
+	if size == 0 {
+		return 0
+	}
+
+	ops := make(StorageOpDeletes, 0, size)
+	conversionError := false
+	keysTable.ForEach(func(k, v lua.LValue) {
+		if conversionError {
+			return
+		}
+
+		keyTable, ok := v.(*lua.LTable)
+		if !ok {
 			conversionError = true
 			l.ArgError(1, "expects a valid set of object IDs")
 			return
@@ -6137,7 +7061,7 @@ func (n *RuntimeLuaNakamaModule) storageDelete(l *lua.LState) int {
 		return 0
 	}
 
-	if _, err := StorageDeleteObjects(l.Context(), n.logger, n.db, n.storageIndex, true, ops); err != nil {
+	if _, err := StorageDeleteObjects(l.Context(), n.logger, n.db, n.storageIndex, n.storageCollections, n.tracker, n.router, true, ops); err != nil {
 		l.RaiseError(fmt.Sprintf("failed to remove storage: %s", err.Error()))
 	}
 
@@ -6286,6 +7210,9 @@ func (n *RuntimeLuaNakamaModule) multiUpdate(l *lua.LState) int {
 			}
 
 			var userID uuid.UUID
+			var ttlSec int64
+			var patch string
+			var valueTable *lua.LTable
 			d := &api.WriteStorageObject{}
 			dataTable.ForEach(func(k, v lua.LValue) {
 				if conversionError {
@@ -6335,14 +7262,8 @@ func (n *RuntimeLuaNakamaModule) multiUpdate(l *lua.LState) int {
 						l.ArgError(2, "expects value to be table")
 						return
 					}
-					valueMap := RuntimeLuaConvertLuaTable(v.(*lua.LTable))
-					valueBytes, err := json.Marshal(valueMap)
-					if err != nil {
-						conversionError = true
-						l.ArgError(2, fmt.Sprintf("failed to convert value: %s", err.Error()))
-						return
-					}
-					d.Value = string(valueBytes)
+					// Converted once the patch type is known.
+					valueTable = v.(*lua.LTable)
 				case "version":
 					if v.Type() != lua.LTString {
 						conversionError = true
@@ -6369,6 +7290,28 @@ func (n *RuntimeLuaNakamaModule) multiUpdate(l *lua.LState) int {
 						return
 					}
 					d.PermissionWrite = &wrapperspb.Int32Value{Value: int32(v.(lua.LNumber))}
+				case "ttl_sec":
+					if v.Type() != lua.LTNumber {
+						conversionError = true
+						l.ArgError(2, "expects ttl_sec to be number")
+						return
+					}
+					if ttlSec = int64(v.(lua.LNumber)); ttlSec < 0 {
+						conversionError = true
+						l.ArgError(2, "expects ttl_sec to be >= 0")
+						return
+					}
+				case "patch":
+					if v.Type() != lua.LTString {
+						conversionError = true
+						l.ArgError(2, "expects patch to be string")
+						return
+					}
+					if patch = v.String(); !storagePatchTypeValid(patch) {
+						conversionError = true
+						l.ArgError(2, "expects patch to be 'merge' or 'json'")
+						return
+					}
 				}
 			})
 
@@ -6376,6 +7319,23 @@ func (n *RuntimeLuaNakamaModule) multiUpdate(l *lua.LState) int {
 				return
 			}
 
+			if valueTable != nil {
+				// JSON patches are arrays of operations, any other value is an object.
+				var value interface{}
+				if patch == StoragePatchJson {
+					value = RuntimeLuaConvertLuaValue(valueTable)
+				} else {
+					value = RuntimeLuaConvertLuaTable(valueTable)
+				}
+				valueBytes, err := json.Marshal(value)
+				if err != nil {
+					conversionError = true
+					l.ArgError(2, fmt.Sprintf("failed to convert value: %s", err.Error()))
+					return
+				}
+				d.Value = string(valueBytes)
+			}
+
 			if d.Collection == "" {
 				conversionError = true
 				l.ArgError(2, "expects collection to be supplied")
@@ -6402,6 +7362,8 @@ func (n *RuntimeLuaNakamaModule) multiUpdate(l *lua.LState) int {
 			storageWriteOps = append(storageWriteOps, &StorageOpWrite{
 				OwnerID: userID.String(),
 				Object:  d,
+				TtlSec:  ttlSec,
+				Patch:   patch,
 			})
 		})
 		if conversionError {
@@ -6608,7 +7570,7 @@ func (n *RuntimeLuaNakamaModule) multiUpdate(l *lua.LState) int {
 
 	updateLedger := l.OptBool(5, false)
 
-	acks, results, err := MultiUpdate(l.Context(), n.logger, n.db, n.metrics, accountUpdates, storageWriteOps, storageDeleteOps, n.storageIndex, walletUpdates, updateLedger)
+	acks, results, err := MultiUpdate(l.Context(), n.logger, n.db, n.metrics, accountUpdates, storageWriteOps, storageDeleteOps, n.storageIndex, n.storageCollections, n.tracker, n.router, walletUpdates, updateLedger)
 	if err != nil {
 		l.RaiseError("error running multi update: %v", err.Error())
 		return 0
@@ -6738,6 +7700,65 @@ func (n *RuntimeLuaNakamaModule) leaderboardCreate(l *lua.LState) int {
 	return 0
 }
 
+// @group leaderboards
+// @summary Setup a new leaderboard whose records are owned by groups, scored by aggregating the records group members hold on a source leaderboard. The aggregate shares the sort order and reset schedule of the source, and is kept up to date as members submit scores and group membership changes.
+// @param id(type=string) The unique identifier for the new group leaderboard.
+// @param sourceId(type=string) The unique identifier of the leaderboard member records are read from.
+// @param aggregateOperator(type=string, optional=true, default="sum") How member scores combine into the group score. Possible values are "sum", "average" or "best".
+// @param metadata(type=table, optional=true) The metadata you want associated to the leaderboard.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) leaderboardGroupAggregateCreate(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a leaderboard ID string")
+		return 0
+	}
+
+	sourceId := l.CheckString(2)
+	if sourceId == "" {
+		l.ArgError(2, "expects a source leaderboard ID string")
+		return 0
+	}
+
+	aggregateOperator := l.OptString(3, "sum")
+	var aggregateOperatorNumber int
+	switch aggregateOperator {
+	case "sum":
+		aggregateOperatorNumber = LeaderboardAggregateOperatorSum
+	case "avg", "average":
+		aggregateOperatorNumber = LeaderboardAggregateOperatorAverage
+	case "best":
+		aggregateOperatorNumber = LeaderboardAggregateOperatorBest
+	default:
+		l.ArgError(3, "expects aggregate operator to be 'sum', 'average' or 'best'")
+		return 0
+	}
+
+	metadata := l.OptTable(4, nil)
+	metadataStr := "{}"
+	if metadata != nil {
+		metadataMap := RuntimeLuaConvertLuaTable(metadata)
+		metadataBytes, err := json.Marshal(metadataMap)
+		if err != nil {
+			l.RaiseError("error encoding metadata: %v", err.Error())
+			return 0
+		}
+		metadataStr = string(metadataBytes)
+	}
+
+	_, created, err := LeaderboardGroupAggregateCreate(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, id, sourceId, aggregateOperatorNumber, metadataStr)
+	if err != nil {
+		l.RaiseError("error creating group leaderboard: %v", err.Error())
+	}
+
+	if created {
+		// Only need to update the scheduler for newly created leaderboards.
+		n.leaderboardScheduler.Update()
+	}
+
+	return 0
+}
+
 // @group leaderboards
 // @summary Delete a leaderboard and all scores that belong to it.
 // @param id(type=string) The unique identifier for the leaderboard to delete.
@@ -7188,13 +8209,14 @@ func leaderboardToLuaTable(l *lua.LState, leaderboard *api.Leaderboard) (*lua.LT
 // @summary Validates and stores the purchases present in an Apple App Store Receipt.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) Base-64 encoded receipt data returned by the purchase operation itself.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @param passwordOverride(type=string, optional=true) Override the iap.apple.shared_password provided in your configuration.
 // @return validation(table) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeLuaNakamaModule) purchaseValidateApple(l *lua.LState) int {
 	password := l.OptString(4, n.config.GetIAP().Apple.SharedPassword)
-	if password == "" {
+	// StoreKit 2 signed transactions are verified locally and need no shared password.
+	if password == "" && !iap.IsSignedDataApple(l.CheckString(2)) {
 		l.RaiseError("Apple IAP is not configured.")
 		return 0
 	}
@@ -7218,12 +8240,22 @@ func (n *RuntimeLuaNakamaModule) purchaseValidateApple(l *lua.LState) int {
 
 	persist := l.OptBool(3, true)
 
-	validation, err := ValidatePurchasesApple(l.Context(), n.logger, n.db, userID, password, receipt, persist)
+	var validation *api.ValidatePurchaseResponse
+	if iap.IsSignedDataApple(receipt) {
+		validation, err = ValidatePurchasesAppleSigned(l.Context(), n.logger, n.db, userID, n.config.GetIAP().Apple, receipt, persist)
+	} else {
+		validation, err = ValidatePurchasesApple(l.Context(), n.logger, n.db, userID, password, receipt, persist)
+	}
 	if err != nil {
 		l.RaiseError("error validating Apple receipt: %v", err.Error())
 		return 0
 	}
 
+	if _, err = StoreFulfilPurchases(l.Context(), n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, userID, persist, validation.ValidatedPurchases); err != nil {
+		l.RaiseError("error fulfilling store purchases: %v", err.Error())
+		return 0
+	}
+
 	l.Push(purchaseValidationToLuaTable(l, validation))
 	return 1
 }
@@ -7232,7 +8264,7 @@ func (n *RuntimeLuaNakamaModule) purchaseValidateApple(l *lua.LState) int {
 // @summary Validates and stores a purchase receipt from the Google Play Store.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) JSON encoded Google receipt.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @param clientEmailOverride(type=string, optional=true) Override the iap.google.client_email provided in your configuration.
 // @param privateKeyOverride(type=string, optional=true) Override the iap.google.private_key provided in your configuration.
 // @return validation(table) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
@@ -7277,6 +8309,11 @@ func (n *RuntimeLuaNakamaModule) purchaseValidateGoogle(l *lua.LState) int {
 		return 0
 	}
 
+	if _, err = StoreFulfilPurchases(l.Context(), n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, userID, persist, validation.ValidatedPurchases); err != nil {
+		l.RaiseError("error fulfilling store purchases: %v", err.Error())
+		return 0
+	}
+
 	l.Push(purchaseValidationToLuaTable(l, validation))
 	return 1
 }
@@ -7286,7 +8323,7 @@ func (n *RuntimeLuaNakamaModule) purchaseValidateGoogle(l *lua.LState) int {
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param receipt(type=string) The Huawei receipt data.
 // @param signature(type=string) The receipt signature.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @return validation(table) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeLuaNakamaModule) purchaseValidateHuawei(l *lua.LState) int {
@@ -7328,6 +8365,11 @@ func (n *RuntimeLuaNakamaModule) purchaseValidateHuawei(l *lua.LState) int {
 		return 0
 	}
 
+	if _, err = StoreFulfilPurchases(l.Context(), n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, userID, persist, validation.ValidatedPurchases); err != nil {
+		l.RaiseError("error fulfilling store purchases: %v", err.Error())
+		return 0
+	}
+
 	l.Push(purchaseValidationToLuaTable(l, validation))
 	return 1
 }
@@ -7336,7 +8378,7 @@ func (n *RuntimeLuaNakamaModule) purchaseValidateHuawei(l *lua.LState) int {
 // @summary Validates and stores a purchase receipt from the Facebook Instant Games.
 // @param userId(type=string) The user ID of the owner of the receipt.
 // @param signedRequest(type=string) The Facebook Instant signedRequest receipt data.
-// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks.
+// @param persist(type=bool, optional=true, default=true) Persist the purchase so that seenBefore can be computed to protect against replay attacks. Purchases of store products must be persisted to be fulfilled.
 // @return validation(table) The resulting successfully validated purchases. Any previously validated purchases are returned with a seenBefore flag.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeLuaNakamaModule) purchaseValidateFacebookInstant(l *lua.LState) int {
@@ -7370,6 +8412,11 @@ func (n *RuntimeLuaNakamaModule) purchaseValidateFacebookInstant(l *lua.LState)
 		return 0
 	}
 
+	if _, err = StoreFulfilPurchases(l.Context(), n.logger, n.db, n.metrics, n.storageIndex, n.storageCollections, n.tracker, n.router, n.storeCatalog, userID, persist, validation.ValidatedPurchases); err != nil {
+		l.RaiseError("error fulfilling store purchases: %v", err.Error())
+		return 0
+	}
+
 	l.Push(purchaseValidationToLuaTable(l, validation))
 	return 1
 }
@@ -7396,6 +8443,50 @@ func (n *RuntimeLuaNakamaModule) purchaseGetByTransactionId(l *lua.LState) int {
 	return 1
 }
 
+// @group purchases
+// @summary List a customer's App Store purchase history through the App Store Server API.
+// @param transactionId(type=string) Any transaction ID of the customer.
+// @return transactions(table) The customer's verified transactions.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) purchaseHistoryApple(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a transaction ID string")
+		return 0
+	}
+
+	transactions, err := ListPurchaseHistoryApple(l.Context(), n.logger, n.config.GetIAP().Apple, id)
+	if err != nil {
+		l.RaiseError("error listing Apple purchase history: %v", err.Error())
+		return 0
+	}
+
+	l.Push(appleTransactionsToLuaTable(l, transactions))
+	return 1
+}
+
+// @group purchases
+// @summary List a customer's refunded App Store purchases through the App Store Server API.
+// @param transactionId(type=string) Any transaction ID of the customer.
+// @return transactions(table) The customer's verified refunded transactions.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) purchaseRefundsApple(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a transaction ID string")
+		return 0
+	}
+
+	transactions, err := ListRefundedPurchasesApple(l.Context(), n.logger, n.config.GetIAP().Apple, id)
+	if err != nil {
+		l.RaiseError("error listing Apple refunded purchases: %v", err.Error())
+		return 0
+	}
+
+	l.Push(appleTransactionsToLuaTable(l, transactions))
+	return 1
+}
+
 // @group purchases
 // @summary List stored validated purchase receipts.
 // @param userId(type=string, optional=true) Filter by user ID. Can be an empty string to list purchases for all users.
@@ -8333,59 +9424,270 @@ func (n *RuntimeLuaNakamaModule) tournamentRecordsHaystack(l *lua.LState) int {
 	return leaderboardRecordsToLua(l, records.Records, records.OwnerRecords, records.PrevCursor, records.NextCursor, records.RankCount, true)
 }
 
-// @group groups
-// @summary Fetch one or more groups by their ID.
-// @param groupIds(type=table) A list of strings of the IDs for the groups to get.
-// @return getGroups(table) A table of groups with their fields.
+// @group leagues
+// @summary Setup a league made of existing tournaments, one per tier. Tiers must share the same reset schedule, at every reset the top members of each cohort are promoted and the bottom members relegated. The league configuration will not be updated if it already exists.
+// @param id(type=string) The unique identifier for the new league.
+// @param tiers(type=table) The IDs of the tournaments that make up the league tiers, lowest tier first.
+// @param cohortSize(type=number) Maximum number of members competing against each other in a cohort.
+// @param promoteCount(type=number) Number of best ranked members of each cohort moved one tier up at every reset.
+// @param relegateCount(type=number) Number of worst ranked members of each cohort moved one tier down at every reset.
+// @param metadata(type=table, optional=true) The metadata you want associated to the league.
 // @return error(error) An optional error value if an error occurred.
-func (n *RuntimeLuaNakamaModule) groupsGetId(l *lua.LState) int {
-	// Input table validation.
-	input := l.OptTable(1, nil)
-	if input == nil {
-		l.ArgError(1, "invalid group id list")
+func (n *RuntimeLuaNakamaModule) leagueCreate(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a league ID string")
 		return 0
 	}
-	if input.Len() == 0 {
-		l.Push(l.CreateTable(0, 0))
-		return 1
+
+	input := l.CheckTable(2)
+	tiers := make([]string, 0, input.Len())
+	conversionError := false
+	input.ForEach(func(k lua.LValue, v lua.LValue) {
+		if conversionError {
+			return
+		}
+		if v.Type() != lua.LTString || v.String() == "" {
+			conversionError = true
+			return
+		}
+		tiers = append(tiers, v.String())
+	})
+	if conversionError {
+		l.ArgError(2, "expects each tier to be a tournament ID string")
+		return 0
 	}
-	groupIDs, ok := RuntimeLuaConvertLuaValue(input).([]interface{})
-	if !ok {
-		l.ArgError(1, "invalid group id data")
+	if len(tiers) == 0 {
+		l.ArgError(2, "expects at least one tier tournament ID")
 		return 0
 	}
-	if len(groupIDs) == 0 {
-		l.Push(l.CreateTable(0, 0))
-		return 1
+
+	cohortSize := l.CheckInt(3)
+	if cohortSize < 1 {
+		l.ArgError(3, "cohortSize must be > 0")
+		return 0
+	}
+	promoteCount := l.CheckInt(4)
+	if promoteCount < 0 {
+		l.ArgError(4, "promoteCount must be >= 0")
+		return 0
+	}
+	relegateCount := l.CheckInt(5)
+	if relegateCount < 0 {
+		l.ArgError(5, "relegateCount must be >= 0")
+		return 0
+	}
+	if promoteCount+relegateCount > cohortSize {
+		l.ArgError(5, "promoteCount and relegateCount must not exceed cohortSize")
+		return 0
 	}
 
-	// Input individual ID validation.
-	groupIDStrings := make([]string, 0, len(groupIDs))
-	for _, id := range groupIDs {
-		if ids, ok := id.(string); !ok || ids == "" {
-			l.ArgError(1, "each group id must be a string")
-			return 0
-		} else if _, err := uuid.FromString(ids); err != nil {
-			l.ArgError(1, "each group id must be a valid id string")
+	metadata := l.OptTable(6, nil)
+	metadataStr := "{}"
+	if metadata != nil {
+		metadataMap := RuntimeLuaConvertLuaTable(metadata)
+		metadataBytes, err := json.Marshal(metadataMap)
+		if err != nil {
+			l.RaiseError("error encoding metadata: %v", err.Error())
 			return 0
-		} else {
-			groupIDStrings = append(groupIDStrings, ids)
 		}
+		metadataStr = string(metadataBytes)
 	}
 
-	// Get the groups.
-	groups, err := GetGroups(l.Context(), n.logger, n.db, groupIDStrings)
-	if err != nil {
-		l.RaiseError(fmt.Sprintf("failed to get groups: %s", err.Error()))
+	if err := LeagueCreate(l.Context(), n.logger, n.db, n.leaderboardCache, id, tiers, cohortSize, promoteCount, relegateCount, metadataStr); err != nil {
+		l.RaiseError("error creating league: %v", err.Error())
+	}
+	return 0
+}
+
+// @group leagues
+// @summary Delete a league and all of its member assignments. The tier tournaments are not deleted.
+// @param id(type=string) The unique identifier for the league to delete.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) leagueDelete(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a league ID string")
 		return 0
 	}
 
-	groupsTable := l.CreateTable(len(groups), 0)
-	for i, g := range groups {
-		gt := l.CreateTable(0, 12)
-		gt.RawSetString("id", lua.LString(g.Id))
-		gt.RawSetString("creator_id", lua.LString(g.CreatorId))
-		gt.RawSetString("name", lua.LString(g.Name))
+	if err := LeagueDelete(l.Context(), n.logger, n.db, id); err != nil {
+		l.RaiseError("error deleting league: %v", err.Error())
+	}
+	return 0
+}
+
+// @group leagues
+// @summary Join a league. New members are placed in the lowest tier, in the first cohort with space available. This operation is idempotent.
+// @param id(type=string) The unique identifier for the league to join.
+// @param ownerId(type=string) The user joining the league.
+// @return cohort(table) The cohort the user is competing in.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) leagueJoin(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a league ID string")
+		return 0
+	}
+
+	ownerID, err := uuid.FromString(l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects owner ID to be a valid identifier")
+		return 0
+	}
+
+	cohort, err := LeagueJoin(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, id, ownerID)
+	if err != nil {
+		l.RaiseError("error joining league: %v", err.Error())
+		return 0
+	}
+
+	cohortTable, err := leagueCohortToLuaTable(l, cohort)
+	if err != nil {
+		l.RaiseError(err.Error())
+		return 0
+	}
+	l.Push(cohortTable)
+	return 1
+}
+
+// @group leagues
+// @summary Remove a member from a league. Records already submitted to tier tournaments are kept.
+// @param id(type=string) The unique identifier for the league to leave.
+// @param ownerId(type=string) The user leaving the league.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) leagueLeave(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a league ID string")
+		return 0
+	}
+
+	ownerID, err := uuid.FromString(l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects owner ID to be a valid identifier")
+		return 0
+	}
+
+	if err := LeagueLeave(l.Context(), n.logger, n.db, id, ownerID); err != nil {
+		l.RaiseError("error leaving league: %v", err.Error())
+	}
+	return 0
+}
+
+// @group leagues
+// @summary Fetch the current tier and cohort of a league member, along with the records of all cohort members for the current period.
+// @param id(type=string) The unique identifier for the league.
+// @param ownerId(type=string) The league member.
+// @return cohort(table) The cohort the user is competing in.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) leagueCohortGet(l *lua.LState) int {
+	id := l.CheckString(1)
+	if id == "" {
+		l.ArgError(1, "expects a league ID string")
+		return 0
+	}
+
+	ownerID, err := uuid.FromString(l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects owner ID to be a valid identifier")
+		return 0
+	}
+
+	cohort, err := LeagueCohortGet(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, id, ownerID)
+	if err != nil {
+		l.RaiseError("error getting league cohort: %v", err.Error())
+		return 0
+	}
+
+	cohortTable, err := leagueCohortToLuaTable(l, cohort)
+	if err != nil {
+		l.RaiseError(err.Error())
+		return 0
+	}
+	l.Push(cohortTable)
+	return 1
+}
+
+func leagueCohortToLuaTable(l *lua.LState, cohort *LeagueCohort) (*lua.LTable, error) {
+	ct := l.CreateTable(0, 6)
+	ct.RawSetString("league_id", lua.LString(cohort.LeagueId))
+	ct.RawSetString("tournament_id", lua.LString(cohort.TournamentId))
+	ct.RawSetString("tier", lua.LNumber(cohort.Tier))
+	ct.RawSetString("cohort", lua.LNumber(cohort.Cohort))
+
+	ownerIDsTable := l.CreateTable(len(cohort.OwnerIds), 0)
+	for i, ownerID := range cohort.OwnerIds {
+		ownerIDsTable.RawSetInt(i+1, lua.LString(ownerID))
+	}
+	ct.RawSetString("owner_ids", ownerIDsTable)
+
+	recordsTable := l.CreateTable(len(cohort.Records), 0)
+	for i, record := range cohort.Records {
+		recordTable, err := recordToLuaTable(l, record)
+		if err != nil {
+			return nil, err
+		}
+		recordsTable.RawSetInt(i+1, recordTable)
+	}
+	ct.RawSetString("records", recordsTable)
+
+	return ct, nil
+}
+
+// @group groups
+// @summary Fetch one or more groups by their ID.
+// @param groupIds(type=table) A list of strings of the IDs for the groups to get.
+// @return getGroups(table) A table of groups with their fields.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupsGetId(l *lua.LState) int {
+	// Input table validation.
+	input := l.OptTable(1, nil)
+	if input == nil {
+		l.ArgError(1, "invalid group id list")
+		return 0
+	}
+	if input.Len() == 0 {
+		l.Push(l.CreateTable(0, 0))
+		return 1
+	}
+	groupIDs, ok := RuntimeLuaConvertLuaValue(input).([]interface{})
+	if !ok {
+		l.ArgError(1, "invalid group id data")
+		return 0
+	}
+	if len(groupIDs) == 0 {
+		l.Push(l.CreateTable(0, 0))
+		return 1
+	}
+
+	// Input individual ID validation.
+	groupIDStrings := make([]string, 0, len(groupIDs))
+	for _, id := range groupIDs {
+		if ids, ok := id.(string); !ok || ids == "" {
+			l.ArgError(1, "each group id must be a string")
+			return 0
+		} else if _, err := uuid.FromString(ids); err != nil {
+			l.ArgError(1, "each group id must be a valid id string")
+			return 0
+		} else {
+			groupIDStrings = append(groupIDStrings, ids)
+		}
+	}
+
+	// Get the groups.
+	groups, err := GetGroups(l.Context(), n.logger, n.db, groupIDStrings)
+	if err != nil {
+		l.RaiseError(fmt.Sprintf("failed to get groups: %s", err.Error()))
+		return 0
+	}
+
+	groupsTable := l.CreateTable(len(groups), 0)
+	for i, g := range groups {
+		gt := l.CreateTable(0, 12)
+		gt.RawSetString("id", lua.LString(g.Id))
+		gt.RawSetString("creator_id", lua.LString(g.CreatorId))
+		gt.RawSetString("name", lua.LString(g.Name))
 		gt.RawSetString("description", lua.LString(g.Description))
 		gt.RawSetString("avatar_url", lua.LString(g.AvatarUrl))
 		gt.RawSetString("lang_tag", lua.LString(g.LangTag))
@@ -8464,7 +9766,7 @@ func (n *RuntimeLuaNakamaModule) groupCreate(l *lua.LState) int {
 		return 0
 	}
 
-	group, err := CreateGroup(l.Context(), n.logger, n.db, userID, creatorID, name, lang, desc, avatarURL, metadataStr, open, maxCount)
+	group, err := CreateGroup(l.Context(), n.logger, n.db, n.groupIndex, userID, creatorID, name, lang, desc, avatarURL, metadataStr, open, maxCount)
 	if err != nil {
 		l.RaiseError("error while trying to create group: %v", err.Error())
 		return 0
@@ -8582,7 +9884,7 @@ func (n *RuntimeLuaNakamaModule) groupUpdate(l *lua.LState) int {
 
 	maxCount := l.OptInt(10, 0)
 
-	if err = UpdateGroup(l.Context(), n.logger, n.db, groupID, userID, creatorID, name, lang, desc, avatarURL, metadata, open, maxCount); err != nil {
+	if err = UpdateGroup(l.Context(), n.logger, n.db, n.groupIndex, groupID, userID, creatorID, name, lang, desc, avatarURL, metadata, open, maxCount); err != nil {
 		l.RaiseError("error while trying to update group: %v", err.Error())
 		return 0
 	}
@@ -8601,7 +9903,7 @@ func (n *RuntimeLuaNakamaModule) groupDelete(l *lua.LState) int {
 		return 0
 	}
 
-	if err = DeleteGroup(l.Context(), n.logger, n.db, groupID, uuid.Nil); err != nil {
+	if err = DeleteGroup(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, n.groupIndex, groupID, uuid.Nil); err != nil {
 		l.RaiseError("error while trying to delete group: %v", err.Error())
 		return 0
 	}
@@ -8614,6 +9916,7 @@ func (n *RuntimeLuaNakamaModule) groupDelete(l *lua.LState) int {
 // @param groupId(type=string) The ID of the group to join.
 // @param userId(type=string) The user ID to add to this group.
 // @param username(type=string) The username of the user to add to this group.
+// @param application(type=table, optional=true) An application form to attach to the join request if the group is closed.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeLuaNakamaModule) groupUserJoin(l *lua.LState) int {
 	groupID, err := uuid.FromString(l.CheckString(1))
@@ -8634,7 +9937,18 @@ func (n *RuntimeLuaNakamaModule) groupUserJoin(l *lua.LState) int {
 		return 0
 	}
 
-	if err := JoinGroup(l.Context(), n.logger, n.db, n.tracker, n.router, groupID, userID, username); err != nil {
+	application := ""
+	applicationTable := l.OptTable(4, nil)
+	if applicationTable != nil {
+		applicationBytes, err := json.Marshal(RuntimeLuaConvertLuaTable(applicationTable))
+		if err != nil {
+			l.ArgError(4, fmt.Sprintf("failed to convert application: %s", err.Error()))
+			return 0
+		}
+		application = string(applicationBytes)
+	}
+
+	if err := JoinGroup(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, groupID, userID, username, application); err != nil {
 		l.RaiseError("error while trying to join a group: %v", err.Error())
 		return 0
 	}
@@ -8666,7 +9980,7 @@ func (n *RuntimeLuaNakamaModule) groupUserLeave(l *lua.LState) int {
 		return 0
 	}
 
-	if err := LeaveGroup(l.Context(), n.logger, n.db, n.tracker, n.router, n.streamManager, groupID, userID, username); err != nil {
+	if err := LeaveGroup(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, n.streamManager, groupID, userID, username); err != nil {
 		l.RaiseError("error while trying to leave a group: %v", err.Error())
 	}
 	return 0
@@ -8729,7 +10043,7 @@ func (n *RuntimeLuaNakamaModule) groupUsersAdd(l *lua.LState) int {
 		}
 	}
 
-	if err := AddGroupUsers(l.Context(), n.logger, n.db, n.tracker, n.router, callerID, groupID, userIDs); err != nil {
+	if err := AddGroupUsers(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, callerID, groupID, userIDs); err != nil {
 		l.RaiseError("error while trying to add users into a group: %v", err.Error())
 	}
 	return 0
@@ -8792,7 +10106,7 @@ func (n *RuntimeLuaNakamaModule) groupUsersBan(l *lua.LState) int {
 		}
 	}
 
-	if err := BanGroupUsers(l.Context(), n.logger, n.db, n.tracker, n.router, n.streamManager, callerID, groupID, userIDs); err != nil {
+	if err := BanGroupUsers(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, n.streamManager, callerID, groupID, userIDs); err != nil {
 		l.RaiseError("error while trying to add users into a group: %v", err.Error())
 	}
 	return 0
@@ -8981,12 +10295,402 @@ func (n *RuntimeLuaNakamaModule) groupUsersKick(l *lua.LState) int {
 		}
 	}
 
-	if err := KickGroupUsers(l.Context(), n.logger, n.db, n.tracker, n.router, n.streamManager, callerID, groupID, userIDs, false); err != nil {
+	if err := KickGroupUsers(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, n.streamManager, callerID, groupID, userIDs, false); err != nil {
 		l.RaiseError("error while trying to kick users from a group: %v", err.Error())
 	}
 	return 0
 }
 
+// @group groups
+// @summary Create a custom role for a group, or replace the permissions of an existing role with the same name. Members holding the role gain the listed permissions.
+// @param groupId(type=string) The ID of the group to define the role for.
+// @param name(type=string) The name of the role, for example "officer".
+// @param permissions(type=table) The permissions granted by the role. Possible values are "invite", "kick", "edit" and "chat".
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @return role(table) The created or updated role.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupRoleUpsert(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	name := l.CheckString(2)
+	if name == "" {
+		l.ArgError(2, "expects a role name string")
+		return 0
+	}
+
+	input := l.OptTable(3, l.CreateTable(0, 0))
+	permissions := make([]string, 0, input.Len())
+	conversionError := false
+	input.ForEach(func(k lua.LValue, v lua.LValue) {
+		if conversionError {
+			return
+		}
+		if v.Type() != lua.LTString {
+			conversionError = true
+			return
+		}
+		permissions = append(permissions, v.String())
+	})
+	if conversionError {
+		l.ArgError(3, "expects each permission to be a string")
+		return 0
+	}
+
+	callerID := uuid.Nil
+	callerIDStr := l.OptString(4, "")
+	if callerIDStr != "" {
+		callerID, err = uuid.FromString(callerIDStr)
+		if err != nil {
+			l.ArgError(4, "expects caller ID to be empty or a valid identifier")
+			return 0
+		}
+	}
+
+	role, err := GroupRoleUpsert(l.Context(), n.logger, n.db, callerID, groupID, name, permissions)
+	if err != nil {
+		l.RaiseError("error while trying to write group role: %v", err.Error())
+		return 0
+	}
+
+	l.Push(groupRoleToLuaTable(l, role))
+	return 1
+}
+
+// @group groups
+// @summary Delete a custom role from a group. Members holding the role become regular members.
+// @param groupId(type=string) The ID of the group to delete the role from.
+// @param name(type=string) The name of the role to delete.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupRoleDelete(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	name := l.CheckString(2)
+	if name == "" {
+		l.ArgError(2, "expects a role name string")
+		return 0
+	}
+
+	callerID := uuid.Nil
+	callerIDStr := l.OptString(3, "")
+	if callerIDStr != "" {
+		callerID, err = uuid.FromString(callerIDStr)
+		if err != nil {
+			l.ArgError(3, "expects caller ID to be empty or a valid identifier")
+			return 0
+		}
+	}
+
+	if err := GroupRoleDelete(l.Context(), n.logger, n.db, n.tracker, callerID, groupID, name); err != nil {
+		l.RaiseError("error while trying to delete group role: %v", err.Error())
+	}
+
+	return 0
+}
+
+// @group groups
+// @summary List the custom roles defined for a group.
+// @param groupId(type=string) The ID of the group to list roles for.
+// @return roles(table) The roles defined for the group.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupRolesList(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	roles, err := GroupRolesList(l.Context(), n.logger, n.db, groupID)
+	if err != nil {
+		l.RaiseError("error while trying to list group roles: %v", err.Error())
+		return 0
+	}
+
+	rolesTable := l.CreateTable(len(roles), 0)
+	for i, role := range roles {
+		rolesTable.RawSetInt(i+1, groupRoleToLuaTable(l, role))
+	}
+	l.Push(rolesTable)
+	return 1
+}
+
+// @group groups
+// @summary Assign a custom role to a group member, replacing any role they already hold. The role is reflected in the status of their group channel presences.
+// @param groupId(type=string) The ID of the group.
+// @param userId(type=string) The ID of the member to assign the role to.
+// @param role(type=string) The name of the role to assign. An empty string removes the member's role.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupUserRoleSet(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	userID, err := uuid.FromString(l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects user ID to be a valid identifier")
+		return 0
+	}
+
+	role := l.OptString(3, "")
+
+	callerID := uuid.Nil
+	callerIDStr := l.OptString(4, "")
+	if callerIDStr != "" {
+		callerID, err = uuid.FromString(callerIDStr)
+		if err != nil {
+			l.ArgError(4, "expects caller ID to be empty or a valid identifier")
+			return 0
+		}
+	}
+
+	if err := GroupUserRoleSet(l.Context(), n.logger, n.db, n.tracker, callerID, groupID, userID, role); err != nil {
+		l.RaiseError("error while trying to set group user role: %v", err.Error())
+	}
+
+	return 0
+}
+
+func groupRoleToLuaTable(l *lua.LState, role *GroupRole) *lua.LTable {
+	rt := l.CreateTable(0, 5)
+	rt.RawSetString("group_id", lua.LString(role.GroupId))
+	rt.RawSetString("name", lua.LString(role.Name))
+
+	permissionsTable := l.CreateTable(len(role.Permissions), 0)
+	for i, permission := range role.Permissions {
+		permissionsTable.RawSetInt(i+1, lua.LString(permission))
+	}
+	rt.RawSetString("permissions", permissionsTable)
+
+	rt.RawSetString("create_time", lua.LNumber(role.CreateTime))
+	rt.RawSetString("update_time", lua.LNumber(role.UpdateTime))
+
+	return rt
+}
+
+// @group groups
+// @summary Invite users to join a group. Invited users can accept or reject the invite, and accepting it adds them to the group even if the group is closed.
+// @param groupId(type=string) The ID of the group to invite users to.
+// @param userIds(type=table) Table array of user IDs to invite.
+// @param expirySec(type=number, optional=true, default=604800) The number of seconds until the invites expire.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupUsersInvite(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	users := l.CheckTable(2)
+	if users == nil {
+		l.ArgError(2, "expects user IDs to be a table")
+		return 0
+	}
+
+	userIDs := make([]uuid.UUID, 0, users.Len())
+	conversionError := false
+	users.ForEach(func(k lua.LValue, v lua.LValue) {
+		if v.Type() != lua.LTString {
+			l.ArgError(2, "expects each user ID to be a string")
+			conversionError = true
+			return
+		}
+		userID, err := uuid.FromString(v.String())
+		if err != nil {
+			l.ArgError(2, "expects each user ID to be a valid identifier")
+			conversionError = true
+			return
+		}
+		if userID == uuid.Nil {
+			l.ArgError(2, "cannot invite the root user")
+			conversionError = true
+			return
+		}
+		userIDs = append(userIDs, userID)
+	})
+	if conversionError {
+		return 0
+	}
+
+	expirySec := l.OptInt(3, 0)
+	if expirySec < 0 {
+		l.ArgError(3, "expects expiry to be 0 or greater")
+		return 0
+	}
+
+	if len(userIDs) == 0 {
+		return 0
+	}
+
+	callerID := uuid.Nil
+	callerIDStr := l.OptString(4, "")
+	if callerIDStr != "" {
+		callerID, err = uuid.FromString(callerIDStr)
+		if err != nil {
+			l.ArgError(4, "expects caller ID to be empty or a valid identifier")
+			return 0
+		}
+	}
+
+	if err := GroupInviteUsers(l.Context(), n.logger, n.db, n.tracker, n.router, callerID, groupID, userIDs, expirySec); err != nil {
+		l.RaiseError("error while trying to invite users to a group: %v", err.Error())
+	}
+	return 0
+}
+
+// @group groups
+// @summary Accept a pending group invite for a particular user, adding them to the group.
+// @param groupId(type=string) The ID of the group the user was invited to.
+// @param userId(type=string) The ID of the invited user.
+// @param username(type=string) The username of the invited user.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupInviteAccept(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	userID, err := uuid.FromString(l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects user ID to be a valid identifier")
+		return 0
+	}
+
+	username := l.CheckString(3)
+	if username == "" {
+		l.ArgError(3, "expects username string")
+		return 0
+	}
+
+	if err := GroupInviteAccept(l.Context(), n.logger, n.db, n.leaderboardCache, n.rankCache, n.tracker, n.router, groupID, userID, username); err != nil {
+		l.RaiseError("error while trying to accept group invite: %v", err.Error())
+	}
+	return 0
+}
+
+// @group groups
+// @summary Reject a pending group invite for a particular user.
+// @param groupId(type=string) The ID of the group the user was invited to.
+// @param userId(type=string) The ID of the invited user.
+// @param username(type=string) The username of the invited user.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupInviteReject(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	userID, err := uuid.FromString(l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects user ID to be a valid identifier")
+		return 0
+	}
+
+	username := l.CheckString(3)
+	if username == "" {
+		l.ArgError(3, "expects username string")
+		return 0
+	}
+
+	if err := GroupInviteReject(l.Context(), n.logger, n.db, n.tracker, n.router, groupID, userID, username); err != nil {
+		l.RaiseError("error while trying to reject group invite: %v", err.Error())
+	}
+	return 0
+}
+
+// @group groups
+// @summary List the pending, unexpired group invites for a user.
+// @param userId(type=string) The ID of the user to list invites for.
+// @return invites(table) The user's pending group invites.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupInvitesList(l *lua.LState) int {
+	userID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects user ID to be a valid identifier")
+		return 0
+	}
+
+	invites, err := GroupInvitesList(l.Context(), n.logger, n.db, userID)
+	if err != nil {
+		l.RaiseError("error while trying to list group invites: %v", err.Error())
+		return 0
+	}
+
+	invitesTable := l.CreateTable(len(invites), 0)
+	for i, invite := range invites {
+		it := l.CreateTable(0, 5)
+		it.RawSetString("group_id", lua.LString(invite.GroupId))
+		it.RawSetString("user_id", lua.LString(invite.UserId))
+		it.RawSetString("inviter_id", lua.LString(invite.InviterId))
+		it.RawSetString("expiry_time", lua.LNumber(invite.ExpiryTime))
+		it.RawSetString("create_time", lua.LNumber(invite.CreateTime))
+		invitesTable.RawSetInt(i+1, it)
+	}
+	l.Push(invitesTable)
+	return 1
+}
+
+// @group groups
+// @summary List the applications submitted with pending join requests to a group.
+// @param groupId(type=string) The ID of the group to list applications for.
+// @param callerId(type=string, optional=true) User ID of the caller, will apply permissions checks of the user. If empty defaults to system user and permissions are bypassed.
+// @return applications(table) The applications attached to pending join requests.
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) groupApplicationsList(l *lua.LState) int {
+	groupID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects group ID to be a valid identifier")
+		return 0
+	}
+
+	callerID := uuid.Nil
+	callerIDStr := l.OptString(2, "")
+	if callerIDStr != "" {
+		callerID, err = uuid.FromString(callerIDStr)
+		if err != nil {
+			l.ArgError(2, "expects caller ID to be empty or a valid identifier")
+			return 0
+		}
+	}
+
+	applications, err := GroupApplicationsList(l.Context(), n.logger, n.db, callerID, groupID)
+	if err != nil {
+		l.RaiseError("error while trying to list group applications: %v", err.Error())
+		return 0
+	}
+
+	applicationsTable := l.CreateTable(len(applications), 0)
+	for i, application := range applications {
+		metadataMap := make(map[string]interface{})
+		if err = json.Unmarshal([]byte(application.Metadata), &metadataMap); err != nil {
+			l.RaiseError("failed to convert application metadata to json: %s", err.Error())
+			return 0
+		}
+
+		at := l.CreateTable(0, 4)
+		at.RawSetString("group_id", lua.LString(application.GroupId))
+		at.RawSetString("user_id", lua.LString(application.UserId))
+		at.RawSetString("metadata", RuntimeLuaConvertMap(l, metadataMap))
+		at.RawSetString("create_time", lua.LNumber(application.CreateTime))
+		applicationsTable.RawSetInt(i+1, at)
+	}
+	l.Push(applicationsTable)
+	return 1
+}
+
 // @group groups
 // @summary Find groups based on the entered criteria.
 // @param name(type=string) Search for groups that contain this value in their name.
@@ -8995,6 +10699,7 @@ func (n *RuntimeLuaNakamaModule) groupUsersKick(l *lua.LState) int {
 // @param open(type=bool) Filter based on whether groups are Open or Closed.
 // @param limit(type=number, optional=true, default=100) Return only the required number of groups denoted by this limit value.
 // @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
+// @param query(type=string, optional=true, default="") Query string search over group name, description, lang_tag, open and configured metadata fields, for example "+name:dragons +metadata.region:eu". Cannot be combined with the name filter.
 // @return cursor(string) An optional next page cursor that can be used to retrieve the next page of records (if any). Will be set to "" or nil when fetching last available page.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeLuaNakamaModule) groupsList(l *lua.LState) int {
@@ -9018,7 +10723,9 @@ func (n *RuntimeLuaNakamaModule) groupsList(l *lua.LState) int {
 
 	cursor := l.OptString(6, "")
 
-	groups, err := ListGroups(l.Context(), n.logger, n.db, name, langTag, open, edgeCount, limit, cursor)
+	query := l.OptString(7, "")
+
+	groups, err := ListGroups(l.Context(), n.logger, n.db, n.groupIndex, name, langTag, query, open, edgeCount, limit, cursor)
 	if err != nil {
 		l.RaiseError("error listing groups: %v", err.Error())
 		return 0
@@ -9084,7 +10791,7 @@ func (n *RuntimeLuaNakamaModule) groupsGetRandom(l *lua.LState) int {
 // @param limit(type=int, optional=true, default=100) The maximum number of entries in the listing.
 // @param state(type=int, optional=true, default=null) The state of the user within the group. If unspecified this returns users in all states.
 // @param cursor(type=string, optional=true, default="") Pagination cursor from previous result. Don't set to start fetching from the beginning.
-// @return groupUsers(table) The user information for members, admins and superadmins for the group. Also users who sent a join request.
+// @return groupUsers(table) The user information for members, admins and superadmins for the group. Also users who sent a join request, along with any application they submitted.
 // @return error(error) An optional error value if an error occurred.
 func (n *RuntimeLuaNakamaModule) groupUsersList(l *lua.LState) int {
 	groupID, err := uuid.FromString(l.CheckString(1))
@@ -9117,6 +10824,12 @@ func (n *RuntimeLuaNakamaModule) groupUsersList(l *lua.LState) int {
 		return 0
 	}
 
+	applications, err := groupApplicationsForUsers(l.Context(), n.logger, n.db, groupID, res.GroupUsers)
+	if err != nil {
+		l.RaiseError("error while trying to list group applications: %v", err.Error())
+		return 0
+	}
+
 	groupUsers := l.CreateTable(len(res.GroupUsers), 0)
 	for i, ug := range res.GroupUsers {
 		u := ug.User
@@ -9161,9 +10874,17 @@ func (n *RuntimeLuaNakamaModule) groupUsersList(l *lua.LState) int {
 		metadataTable := RuntimeLuaConvertMap(l, metadataMap)
 		ut.RawSetString("metadata", metadataTable)
 
-		gt := l.CreateTable(0, 2)
+		gt := l.CreateTable(0, 3)
 		gt.RawSetString("user", ut)
 		gt.RawSetString("state", lua.LNumber(ug.State.Value))
+		if application, found := applications[u.Id]; found {
+			applicationMap := make(map[string]interface{})
+			if err = json.Unmarshal([]byte(application), &applicationMap); err != nil {
+				l.RaiseError(fmt.Sprintf("failed to convert application to json: %s", err.Error()))
+				return 0
+			}
+			gt.RawSetString("application", RuntimeLuaConvertMap(l, applicationMap))
+		}
 
 		groupUsers.RawSetInt(i+1, gt)
 	}
@@ -9348,13 +11069,45 @@ func (n *RuntimeLuaNakamaModule) accountDeleteId(l *lua.LState) int {
 
 	recorded := l.OptBool(2, false)
 
-	if err := DeleteAccount(l.Context(), n.logger, n.db, n.config, n.leaderboardCache, n.rankCache, n.sessionRegistry, n.sessionCache, n.tracker, userID, recorded); err != nil {
+	if err := DeleteAccount(l.Context(), n.logger, n.db, n.config, n.metrics, n.leaderboardCache, n.rankCache, n.storageIndex, n.storageCollections, n.groupIndex, n.sessionRegistry, n.sessionCache, n.tracker, n.router, userID, recorded); err != nil {
 		l.RaiseError("error while trying to delete account: %v", err.Error())
 	}
 
 	return 0
 }
 
+// @group accounts
+// @summary Merge a source account into a target account. Linked identities, friends, group memberships, storage objects, wallet balances and leaderboard records are moved to the target, then the source account is deleted.
+// @param sourceUserId(type=string) User ID of the account merged and deleted. Must be valid UUID.
+// @param targetUserId(type=string) User ID of the account kept. Must be valid UUID.
+// @param storage(type=string, optional=true, default="target") Which storage object is kept when both accounts have one with the same collection and key, "target" or "source".
+// @param leaderboard(type=string, optional=true, default="best") Which leaderboard record is kept when both accounts have one, "best", "target" or "source".
+// @param wallet(type=string, optional=true, default="sum") Whether the source wallet is added to the target wallet, "sum", or dropped, "target".
+// @return error(error) An optional error value if an error occurred.
+func (n *RuntimeLuaNakamaModule) accountsMerge(l *lua.LState) int {
+	sourceID, err := uuid.FromString(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, "expects source user ID to be a valid identifier")
+		return 0
+	}
+	targetID, err := uuid.FromString(l.CheckString(2))
+	if err != nil {
+		l.ArgError(2, "expects target user ID to be a valid identifier")
+		return 0
+	}
+
+	policy := NewAccountMergePolicy(sourceID, targetID)
+	policy.Storage = l.OptString(3, policy.Storage)
+	policy.Leaderboard = l.OptString(4, policy.Leaderboard)
+	policy.Wallet = l.OptString(5, policy.Wallet)
+
+	if err := AccountMerge(l.Context(), n.logger, n.db, n.config, n.metrics, n.leaderboardCache, n.rankCache, n.storageIndex, n.storageCollections, n.groupIndex, n.sessionRegistry, n.sessionCache, n.tracker, n.router, policy); err != nil {
+		l.RaiseError("error while trying to merge accounts: %v", err.Error())
+	}
+
+	return 0
+}
+
 // @group accounts
 // @summary Export account information for a specified user ID.
 // @param userId(type=string) User ID for the account to be exported. Must be valid UUID.
@@ -30,6 +30,7 @@ import (
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/rtapi"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -104,7 +105,7 @@ func runtimeWithModulesWithData(t *testing.T, modules map[string]string) (*Runti
 	tracker := &LocalTracker{sessionRegistry: sessionRegistry}
 	statusRegistry := NewLocalStatusRegistry(logger, cfg, sessionRegistry, protojsonMarshaler)
 
-	rt, rtInfo, err := NewRuntime(ctx, logger, logger, db, protojsonMarshaler, protojsonUnmarshaler, cfg, "", nil, lbCache, lbRankCache, lbSched, sessionRegistry, nil, statusRegistry, nil, tracker, metrics, nil, &DummyMessageRouter{}, storageIdx, nil)
+	rt, rtInfo, err := NewRuntime(ctx, logger, logger, db, protojsonMarshaler, protojsonUnmarshaler, cfg, "", nil, lbCache, lbRankCache, lbSched, sessionRegistry, nil, statusRegistry, nil, tracker, metrics, nil, &DummyMessageRouter{}, storageIdx, storageCollections, groupIdx, nil, nil, nil)
 
 	return rt, rtInfo, data, err
 }
@@ -383,8 +384,10 @@ nakama.register_rpc(test.printWorld, "helloworld")`,
 	}
 
 	db := NewDB(t)
-	pipeline := NewPipeline(logger, cfg, db, protojsonMarshaler, protojsonUnmarshaler, nil, nil, nil, nil, nil, nil, nil, runtime)
-	apiServer := StartApiServer(logger, logger, db, protojsonMarshaler, protojsonUnmarshaler, cfg, "", nil, storageIdx, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, metrics, pipeline, runtime)
+	rateLimiter := NewLocalRateLimiter(cfg)
+	namePolicy := NewLocalNamePolicy(logger, cfg)
+	pipeline := NewPipeline(logger, cfg, db, protojsonMarshaler, protojsonUnmarshaler, nil, nil, nil, nil, nil, nil, nil, rateLimiter, namePolicy, runtime)
+	apiServer := StartApiServer(logger, logger, db, protojsonMarshaler, protojsonUnmarshaler, cfg, "", nil, storageIdx, storageCollections, groupIdx, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, metrics, rateLimiter, namePolicy, pipeline, runtime)
 	defer apiServer.Stop()
 
 	WaitForSocket(nil, cfg)
@@ -1016,6 +1019,80 @@ nakama.register_rt_after(after_match_create, "MatchCreate")`,
 	}
 }
 
+func TestRuntimeServerHooks(t *testing.T) {
+	modules := map[string]string{
+		"test": `
+local nakama = require("nakama")
+local function before_account_merge(ctx, policy)
+	if ctx.user_id ~= policy.target_user_id then
+		error({"unexpected user", 3})
+	end
+	if policy.source_user_id == "00000000-0000-0000-0000-000000000001" then
+		error({"merge not allowed", 9})
+	end
+	policy.storage = "source"
+	return policy
+end
+nakama.register_before_account_merge(before_account_merge)
+local function before_trade(ctx, action, trade)
+	if action == "cancel" and trade.state == "open" then
+		error({"trade cannot be cancelled", 9})
+	end
+end
+nakama.register_before_trade(before_trade)
+local function storage_expiry(ctx, objects)
+	if objects[1].value.expired ~= true then
+		error("unexpected object value")
+	end
+end
+nakama.register_storage_expiry(storage_expiry)`,
+	}
+
+	runtime, _, err := runtimeWithModules(t, modules)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	targetID := uuid.Must(uuid.NewV4())
+	mergeFn := runtime.BeforeAccountMerge()
+	if mergeFn == nil {
+		t.Fatal("Expected before account merge function to be registered")
+	}
+	policy, err, _ := mergeFn(context.Background(), targetID.String(), "target", NewAccountMergePolicy(uuid.Must(uuid.NewV4()), targetID))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if policy.Storage != AccountMergeStorageSource || policy.Wallet != AccountMergeWalletSum {
+		t.Fatalf("Unexpected policy: %+v", policy)
+	}
+	_, err, code := mergeFn(context.Background(), targetID.String(), "target", NewAccountMergePolicy(uuid.FromStringOrNil("00000000-0000-0000-0000-000000000001"), targetID))
+	if err == nil || code != codes.FailedPrecondition {
+		t.Fatalf("Expected merge to be rejected, got %v %v", err, code)
+	}
+
+	tradeFn := runtime.BeforeTrade()
+	if tradeFn == nil {
+		t.Fatal("Expected before trade function to be registered")
+	}
+	if err, _ = tradeFn(context.Background(), targetID.String(), "accept", &Trade{State: "accepted"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err, code = tradeFn(context.Background(), targetID.String(), "cancel", &Trade{State: "open"}); err == nil || code != codes.FailedPrecondition {
+		t.Fatalf("Expected trade action to be rejected, got %v %v", err, code)
+	}
+	if runtime.AfterTrade() != nil {
+		t.Fatal("Expected no after trade function to be registered")
+	}
+
+	expiryFn := runtime.StorageExpiry()
+	if expiryFn == nil {
+		t.Fatal("Expected storage expiry function to be registered")
+	}
+	if err = expiryFn(context.Background(), []*api.StorageObject{{Collection: "c", Key: "k", Value: `{"expired":true}`}}); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
 func TestRuntimeGroupTests(t *testing.T) {
 	modules := map[string]string{
 		"test": `
@@ -49,6 +49,7 @@ type Session interface {
 	SetUsername(string)
 
 	Expiry() int64
+	TokenID() string
 	Consume()
 
 	Format() SessionFormat
@@ -68,6 +69,7 @@ type SessionRegistry interface {
 	Remove(sessionID uuid.UUID)
 	Disconnect(ctx context.Context, sessionID uuid.UUID, ban bool, reason ...runtime.PresenceReason) error
 	SingleSession(ctx context.Context, tracker Tracker, userID, sessionID uuid.UUID)
+	DisconnectToken(ctx context.Context, tracker Tracker, userID uuid.UUID, tokenID string)
 	Range(fn func(session Session) bool)
 }
 
@@ -176,6 +178,32 @@ func (r *LocalSessionRegistry) SingleSession(ctx context.Context, tracker Tracke
 	}
 }
 
+func (r *LocalSessionRegistry) DisconnectToken(ctx context.Context, tracker Tracker, userID uuid.UUID, tokenID string) {
+	sessionIDs := tracker.ListLocalSessionIDByStream(PresenceStream{Mode: StreamModeNotifications, Subject: userID})
+	for _, foundSessionID := range sessionIDs {
+		session, ok := r.sessions.Load(foundSessionID)
+		if ok && session.TokenID() == tokenID {
+			// No need to remove the session from the map, session.Close() will do that.
+			session.Close("server-side session disconnect", runtime.PresenceReasonDisconnect,
+				&rtapi.Envelope{Message: &rtapi.Envelope_Notifications{
+					Notifications: &rtapi.Notifications{
+						Notifications: []*api.Notification{
+							{
+								Id:         uuid.Must(uuid.NewV4()).String(),
+								Subject:    "session_revoked",
+								Content:    "{}",
+								Code:       NotificationCodeSessionRevoked,
+								SenderId:   "",
+								CreateTime: &timestamppb.Timestamp{Seconds: time.Now().Unix()},
+								Persistent: false,
+							},
+						},
+					},
+				}})
+		}
+	}
+}
+
 func (r *LocalSessionRegistry) Range(fn func(Session) bool) {
 	r.sessions.Range(func(id uuid.UUID, session Session) bool {
 		return fn(session)
@@ -44,6 +44,7 @@ type sessionWS struct {
 	username   *atomic.String
 	vars       map[string]string
 	expiry     int64
+	tokenID    string
 	clientIP   string
 	clientPort string
 	lang       string
@@ -75,7 +76,7 @@ type sessionWS struct {
 	closeMu                sync.Mutex
 }
 
-func NewSessionWS(logger *zap.Logger, config Config, format SessionFormat, sessionID, userID uuid.UUID, username string, vars map[string]string, expiry int64, clientIP, clientPort, lang string, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, conn *websocket.Conn, sessionRegistry SessionRegistry, statusRegistry StatusRegistry, matchmaker Matchmaker, tracker Tracker, metrics Metrics, pipeline *Pipeline, runtime *Runtime) Session {
+func NewSessionWS(logger *zap.Logger, config Config, format SessionFormat, sessionID, userID uuid.UUID, username string, vars map[string]string, expiry int64, tokenID, clientIP, clientPort, lang string, protojsonMarshaler *protojson.MarshalOptions, protojsonUnmarshaler *protojson.UnmarshalOptions, conn *websocket.Conn, sessionRegistry SessionRegistry, statusRegistry StatusRegistry, matchmaker Matchmaker, tracker Tracker, metrics Metrics, pipeline *Pipeline, runtime *Runtime) Session {
 	sessionLogger := logger.With(zap.String("uid", userID.String()), zap.String("sid", sessionID.String()))
 
 	sessionLogger.Info("New WebSocket session connected", zap.Uint8("format", uint8(format)))
@@ -96,6 +97,7 @@ func NewSessionWS(logger *zap.Logger, config Config, format SessionFormat, sessi
 		username:   atomic.NewString(username),
 		vars:       vars,
 		expiry:     expiry,
+		tokenID:    tokenID,
 		clientIP:   clientIP,
 		clientPort: clientPort,
 		lang:       lang,
@@ -171,6 +173,10 @@ func (s *sessionWS) Expiry() int64 {
 	return s.expiry
 }
 
+func (s *sessionWS) TokenID() string {
+	return s.tokenID
+}
+
 func (s *sessionWS) Consume() {
 	// Fire an event for session start.
 	if fn := s.runtime.EventSessionStart(); fn != nil {
@@ -0,0 +1,106 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// StorageCollectionRegistry holds configuration that applies to whole storage collections: the rules enforced on
+// writes, and how many previous versions of each object are kept. Collections are registered from the server
+// configuration and by runtime modules at startup, and are read on every storage write.
+type StorageCollectionRegistry interface {
+	RegisterCollectionRules(rules *StorageCollectionRulesConfig) error
+	CollectionRules(collection string) *storageCollectionRules
+	RegisterCollectionHistory(history *StorageHistoryConfig) error
+	CollectionHistory(collection string) *StorageHistoryConfig
+}
+
+type LocalStorageCollectionRegistry struct {
+	logger            *zap.Logger
+	collectionRules   map[string]*storageCollectionRules
+	collectionHistory map[string]*StorageHistoryConfig
+}
+
+func NewLocalStorageCollectionRegistry(logger *zap.Logger, config *StorageConfig) (StorageCollectionRegistry, error) {
+	r := &LocalStorageCollectionRegistry{
+		logger:            logger,
+		collectionRules:   make(map[string]*storageCollectionRules),
+		collectionHistory: make(map[string]*StorageHistoryConfig),
+	}
+
+	for _, rules := range config.CollectionRules {
+		if err := r.RegisterCollectionRules(rules); err != nil {
+			return nil, err
+		}
+	}
+	for _, history := range config.History {
+		if err := r.RegisterCollectionHistory(history); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *LocalStorageCollectionRegistry) RegisterCollectionRules(config *StorageCollectionRulesConfig) error {
+	rules, err := newStorageCollectionRules(config)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.collectionRules[rules.collection]; ok {
+		return fmt.Errorf("cannot register collection rules: rules for collection %q already exist", rules.collection)
+	}
+	r.collectionRules[rules.collection] = rules
+
+	r.logger.Info("Initialized storage collection rules", zap.Any("configuration", map[string]any{
+		"collection":           config.Collection,
+		"schema":               config.Schema != "",
+		"max_value_size_bytes": config.MaxValueSizeBytes,
+		"max_objects_per_user": config.MaxObjectsPerUser,
+		"permission_read":      config.PermissionRead,
+		"permission_write":     config.PermissionWrite,
+	}))
+
+	return nil
+}
+
+func (r *LocalStorageCollectionRegistry) CollectionRules(collection string) *storageCollectionRules {
+	return r.collectionRules[collection]
+}
+
+func (r *LocalStorageCollectionRegistry) RegisterCollectionHistory(history *StorageHistoryConfig) error {
+	if err := storageHistoryConfigValid(history); err != nil {
+		return err
+	}
+	if _, ok := r.collectionHistory[history.Collection]; ok {
+		return fmt.Errorf("cannot register collection history: history for collection %q already exists", history.Collection)
+	}
+	r.collectionHistory[history.Collection] = history
+
+	r.logger.Info("Initialized storage collection history", zap.Any("configuration", map[string]any{
+		"collection":   history.Collection,
+		"max_versions": history.MaxVersions,
+		"max_age_sec":  history.MaxAgeSec,
+	}))
+
+	return nil
+}
+
+func (r *LocalStorageCollectionRegistry) CollectionHistory(collection string) *StorageHistoryConfig {
+	return r.collectionHistory[collection]
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageCollectionRegistry(t *testing.T) {
+	collections, err := NewLocalStorageCollectionRegistry(logger, &StorageConfig{
+		CollectionRules: []*StorageCollectionRulesConfig{{Collection: "inventory", MaxObjectsPerUser: 10}},
+		History:         []*StorageHistoryConfig{{Collection: "saves", MaxVersions: 5}},
+	})
+	require.NoError(t, err)
+
+	assert.NotNil(t, collections.CollectionRules("inventory"))
+	assert.Nil(t, collections.CollectionRules("saves"))
+	assert.Equal(t, 5, collections.CollectionHistory("saves").MaxVersions)
+	assert.Nil(t, collections.CollectionHistory("inventory"))
+
+	// Runtime registrations add to the configured collections, but cannot replace them.
+	assert.NoError(t, collections.RegisterCollectionRules(&StorageCollectionRulesConfig{Collection: "saves", MaxValueSizeBytes: 1024}))
+	assert.Error(t, collections.RegisterCollectionRules(&StorageCollectionRulesConfig{Collection: "inventory"}))
+	assert.Error(t, collections.RegisterCollectionHistory(&StorageHistoryConfig{Collection: "saves", MaxAgeSec: 60}))
+
+	_, err = NewLocalStorageCollectionRegistry(logger, &StorageConfig{History: []*StorageHistoryConfig{{Collection: "saves"}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/jackc/pgtype"
+	pgx "github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// StorageExpiryScheduler deletes storage objects past their TTL in the background, removes them from storage indices,
+// and passes them to the configured expiry hook.
+type StorageExpiryScheduler interface {
+	Start(runtime *Runtime)
+	Stop()
+}
+
+type LocalStorageExpiryScheduler struct {
+	logger             *zap.Logger
+	db                 *sql.DB
+	config             Config
+	storageIndex       StorageIndex
+	storageCollections StorageCollectionRegistry
+	tracker            Tracker
+	router             MessageRouter
+
+	ctx         context.Context
+	ctxCancelFn context.CancelFunc
+}
+
+func NewLocalStorageExpiryScheduler(logger *zap.Logger, db *sql.DB, config Config, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter) StorageExpiryScheduler {
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+
+	return &LocalStorageExpiryScheduler{
+		logger:             logger,
+		db:                 db,
+		config:             config,
+		storageIndex:       storageIndex,
+		storageCollections: storageCollections,
+		tracker:            tracker,
+		router:             router,
+
+		ctx:         ctx,
+		ctxCancelFn: ctxCancelFn,
+	}
+}
+
+func (s *LocalStorageExpiryScheduler) Start(runtime *Runtime) {
+	hookFn := runtime.StorageExpiry()
+	batchSize := s.config.GetStorage().ExpirySweepBatchSize
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.config.GetStorage().ExpirySweepIntervalSec) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				for {
+					// Keep going while full batches are found, so a backlog is cleared without waiting for more ticks.
+					// Errors are logged by the sweep, and retried on the next tick.
+					count, err := s.sweep(hookFn, batchSize)
+					if err != nil || count < batchSize || s.ctx.Err() != nil {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (s *LocalStorageExpiryScheduler) Stop() {
+	s.ctxCancelFn()
+}
+
+// Delete one batch of expired objects, then publish them and pass them to the hook. Returns the number deleted.
+func (s *LocalStorageExpiryScheduler) sweep(hookFn RuntimeStorageExpiryFunction, batchSize int) (int, error) {
+	objects, err := StorageExpirySweep(s.ctx, s.logger, s.db, s.storageIndex, s.storageCollections, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, nil
+	}
+	s.publish(objects)
+	if hookFn != nil {
+		s.callHook(hookFn, objects)
+	}
+	return len(objects), nil
+}
+
+// Expired objects are deleted, so are published to storage subscribers as deletes.
+func (s *LocalStorageExpiryScheduler) publish(objects []*api.StorageObject) {
+	changes := make([]*storageChange, 0, len(objects))
+	for _, o := range objects {
+		changes = append(changes, &storageChange{
+			Collection:     o.Collection,
+			Key:            o.Key,
+			UserID:         o.UserId,
+			PermissionRead: o.PermissionRead,
+		})
+	}
+	storagePublishChanges(s.logger, s.tracker, s.router, changes)
+}
+
+func (s *LocalStorageExpiryScheduler) callHook(hookFn RuntimeStorageExpiryFunction, objects []*api.StorageObject) {
+	if err := hookFn(s.ctx, objects); err != nil {
+		s.logger.Error("Error running storage expiry hook.", zap.Error(err), zap.Int("count", len(objects)))
+	}
+}
+
+// StorageExpirySweep deletes up to limit storage objects past their expiry time and removes them from storage indices.
+// It returns the deleted objects.
+func StorageExpirySweep(ctx context.Context, logger *zap.Logger, db *sql.DB, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, limit int) ([]*api.StorageObject, error) {
+	// The expiry time is checked again in case the object was written since it was selected.
+	query := `
+DELETE FROM storage
+WHERE (collection, key, user_id) IN (
+	SELECT collection, key, user_id FROM storage
+	WHERE expiry_time IS NOT NULL AND expiry_time <= now()
+	ORDER BY expiry_time
+	LIMIT $1
+) AND ` + storageExpired + `
+RETURNING collection, key, user_id, value, version, read, write, create_time, update_time`
+
+	var objects []*api.StorageObject
+	var deletes StorageOpDeletes
+	if err := ExecuteInTxPgx(ctx, db, func(tx pgx.Tx) error {
+		objects = make([]*api.StorageObject, 0, limit)
+		deletes = make(StorageOpDeletes, 0, limit)
+
+		rows, err := tx.Query(ctx, query, limit)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			o := &api.StorageObject{}
+			var createTime pgtype.Timestamptz
+			var updateTime pgtype.Timestamptz
+			if err = rows.Scan(&o.Collection, &o.Key, &o.UserId, &o.Value, &o.Version, &o.PermissionRead, &o.PermissionWrite, &createTime, &updateTime); err != nil {
+				rows.Close()
+				return err
+			}
+			o.CreateTime = timestamppb.New(createTime.Time)
+			o.UpdateTime = timestamppb.New(updateTime.Time)
+
+			objects = append(objects, o)
+			deletes = append(deletes, &StorageOpDelete{
+				OwnerID:  o.UserId,
+				ObjectID: &api.DeleteStorageObjectId{Collection: o.Collection, Key: o.Key},
+			})
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		// Expired objects are kept in history like any other deleted object.
+		for _, o := range objects {
+			if history := storageCollections.CollectionHistory(o.Collection); history != nil {
+				if err = storageHistoryKeepObject(ctx, tx, history, o); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		logger.Error("Error deleting expired storage objects.", zap.Error(err))
+		return nil, err
+	}
+
+	if len(deletes) > 0 {
+		storageIndex.Delete(ctx, deletes)
+		logger.Debug("Deleted expired storage objects.", zap.Int("count", len(deletes)))
+	}
+	return objects, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/jackc/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func storageExpiryWrite(t *testing.T, db *sql.DB, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, userID uuid.UUID, collection, key string, ttlSec int64) {
+	ops := StorageOpWrites{&StorageOpWrite{
+		OwnerID: userID.String(),
+		Object: &api.WriteStorageObject{
+			Collection:      collection,
+			Key:             key,
+			Value:           `{"foo":"bar"}`,
+			PermissionRead:  &wrapperspb.Int32Value{Value: 2},
+			PermissionWrite: &wrapperspb.Int32Value{Value: 1},
+		},
+		TtlSec: ttlSec,
+	}}
+	_, code, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIndex, storageCollections, nil, nil, true, ops)
+	require.NoError(t, err)
+	require.Equal(t, codes.OK, code)
+}
+
+// Move an object's expiry into the past. Far enough back that the sweep picks it before any other expired objects.
+func storageExpiryExpire(t *testing.T, db *sql.DB, userID uuid.UUID, collection, key string) {
+	_, err := db.Exec("UPDATE storage SET expiry_time = '1970-01-02 00:00:00 UTC' WHERE collection = $1 AND key = $2 AND user_id = $3", collection, key, userID)
+	require.NoError(t, err)
+}
+
+func storageExpiryTime(t *testing.T, db *sql.DB, userID uuid.UUID, collection, key string) pgtype.Timestamptz {
+	var expiryTime pgtype.Timestamptz
+	require.NoError(t, db.QueryRow("SELECT expiry_time FROM storage WHERE collection = $1 AND key = $2 AND user_id = $3", collection, key, userID).Scan(&expiryTime))
+	return expiryTime
+}
+
+func TestStorageWriteTtl(t *testing.T) {
+	db := NewDB(t)
+	defer db.Close()
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	collection, key := GenerateString(), GenerateString()
+
+	storageExpiryWrite(t, db, storageIdx, storageCollections, userID, collection, key, 3600)
+	expiryTime := storageExpiryTime(t, db, userID, collection, key)
+	require.Equal(t, pgtype.Present, expiryTime.Status)
+	assert.InDelta(t, time.Now().UTC().Unix()+3600, expiryTime.Time.Unix(), 5)
+
+	// Every write replaces the expiry, a write without a TTL clears it.
+	storageExpiryWrite(t, db, storageIdx, storageCollections, userID, collection, key, 0)
+	assert.Equal(t, pgtype.Null, storageExpiryTime(t, db, userID, collection, key).Status)
+}
+
+func TestStorageExpiredObjectsHidden(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	collection := GenerateString()
+	liveKey, expiredKey := GenerateString(), GenerateString()
+
+	storageExpiryWrite(t, db, storageIdx, storageCollections, userID, collection, liveKey, 3600)
+	storageExpiryWrite(t, db, storageIdx, storageCollections, userID, collection, expiredKey, 3600)
+	storageExpiryExpire(t, db, userID, collection, expiredKey)
+
+	// Expired objects are hidden until the sweep deletes them.
+	objects, err := StorageReadObjects(ctx, logger, db, uuid.Nil, []*api.ReadStorageObjectId{
+		{Collection: collection, Key: liveKey, UserId: userID.String()},
+		{Collection: collection, Key: expiredKey, UserId: userID.String()},
+	})
+	require.NoError(t, err)
+	require.Len(t, objects.Objects, 1)
+	assert.Equal(t, liveKey, objects.Objects[0].Key)
+
+	list, code, err := StorageListObjects(ctx, logger, db, uuid.Nil, &userID, collection, 10, "")
+	require.NoError(t, err)
+	require.Equal(t, codes.OK, code)
+	require.Len(t, list.Objects, 1)
+	assert.Equal(t, liveKey, list.Objects[0].Key)
+
+	list, _, err = StorageListObjects(ctx, logger, db, userID, &userID, collection, 10, "")
+	require.NoError(t, err)
+	require.Len(t, list.Objects, 1)
+
+	all, err := StorageReadAllUserObjects(ctx, logger, db, userID)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+
+	// An expired object counts as missing for conditional writes.
+	ops := StorageOpWrites{&StorageOpWrite{
+		OwnerID: userID.String(),
+		Object: &api.WriteStorageObject{
+			Collection: collection,
+			Key:        expiredKey,
+			Value:      `{"foo":"baz"}`,
+			Version:    "*",
+		},
+	}}
+	_, code, err = StorageWriteObjects(ctx, logger, db, metrics, storageIdx, storageCollections, nil, nil, true, ops)
+	require.NoError(t, err)
+	require.Equal(t, codes.OK, code)
+	assert.Equal(t, pgtype.Null, storageExpiryTime(t, db, userID, collection, expiredKey).Status)
+}
+
+func TestStorageExpirySweep(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB(t)
+	defer db.Close()
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	collection := GenerateString()
+
+	storageIndex, err := NewLocalStorageIndex(logger, db, &StorageConfig{}, metrics)
+	require.NoError(t, err)
+	indexName := GenerateString()
+	require.NoError(t, storageIndex.CreateIndex(ctx, indexName, collection, "", []string{"foo"}, 10, false))
+
+	expiredKeys := []string{GenerateString(), GenerateString(), GenerateString()}
+	liveKey := GenerateString()
+	for _, key := range expiredKeys {
+		storageExpiryWrite(t, db, storageIndex, storageCollections, userID, collection, key, 3600)
+		storageExpiryExpire(t, db, userID, collection, key)
+	}
+	storageExpiryWrite(t, db, storageIndex, storageCollections, userID, collection, liveKey, 3600)
+
+	entries, err := storageIndex.List(ctx, uuid.Nil, indexName, "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries.Objects, 4)
+
+	// Objects are deleted in batches up to the limit.
+	swept, err := StorageExpirySweep(ctx, logger, db, storageIndex, storageCollections, 2)
+	require.NoError(t, err)
+	require.Len(t, swept, 2)
+	for _, o := range swept {
+		assert.Equal(t, collection, o.Collection)
+		assert.Contains(t, expiredKeys, o.Key)
+		assert.Equal(t, userID.String(), o.UserId)
+		assert.Equal(t, `{"foo": "bar"}`, o.Value)
+	}
+
+	swept, err = StorageExpirySweep(ctx, logger, db, storageIndex, storageCollections, 2)
+	require.NoError(t, err)
+	var found bool
+	for _, o := range swept {
+		if o.Collection == collection {
+			found = true
+			assert.NotEqual(t, liveKey, o.Key)
+		}
+	}
+	assert.True(t, found, "The last expired object should be swept.")
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM storage WHERE collection = $1", collection).Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// Swept objects are removed from storage indices.
+	entries, err = storageIndex.List(ctx, uuid.Nil, indexName, "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries.Objects, 1)
+	assert.Equal(t, liveKey, entries.Objects[0].Key)
+}
+
+// Reports a single session subscribed to every storage stream.
+type storageExpiryTestTracker struct {
+	testTracker
+	sessionID uuid.UUID
+}
+
+func (s *storageExpiryTestTracker) ListByStream(stream PresenceStream, includeHidden bool, includeNotHidden bool) []*Presence {
+	if stream.Mode != StreamModeStorage {
+		return nil
+	}
+	return []*Presence{{ID: PresenceID{Node: "node", SessionID: s.sessionID}, Stream: stream}}
+}
+
+func TestStorageExpirySchedulerPublish(t *testing.T) {
+	db := NewDB(t)
+	defer db.Close()
+
+	userID := uuid.Must(uuid.NewV4())
+	InsertUser(t, db, userID)
+	collection, key := GenerateString(), GenerateString()
+	storageExpiryWrite(t, db, storageIdx, storageCollections, userID, collection, key, 3600)
+	storageExpiryExpire(t, db, userID, collection, key)
+
+	tracker := &storageExpiryTestTracker{sessionID: uuid.Must(uuid.NewV4())}
+	changes := make([]map[string]interface{}, 0, 1)
+	router := &testMessageRouter{sendToPresence: func(presences []*PresenceID, envelope *rtapi.Envelope) {
+		require.Len(t, presences, 1)
+		assert.Equal(t, tracker.sessionID, presences[0].SessionID)
+		var change map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(envelope.GetStreamData().Data), &change))
+		if change["collection"] == collection {
+			changes = append(changes, change)
+		}
+	}}
+	var hooked bool
+	hookFn := func(ctx context.Context, objects []*api.StorageObject) error {
+		for _, o := range objects {
+			hooked = hooked || (o.Collection == collection && o.Key == key)
+		}
+		return nil
+	}
+
+	scheduler := NewLocalStorageExpiryScheduler(logger, db, cfg, storageIdx, storageCollections, tracker, router).(*LocalStorageExpiryScheduler)
+	count, err := scheduler.sweep(hookFn, 10)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, count, 1)
+	assert.True(t, hooked)
+
+	// Swept objects are published to subscribers as deletes.
+	require.Len(t, changes, 1)
+	assert.Equal(t, key, changes[0]["key"])
+	assert.Equal(t, userID.String(), changes[0]["user_id"])
+	assert.Equal(t, true, changes[0]["deleted"])
+}
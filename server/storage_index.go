@@ -332,7 +332,7 @@ func (si *LocalStorageIndex) load(ctx context.Context, idx *storageIndex) error
 	query := `
 SELECT user_id, key, version, value, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1
+WHERE collection = $1 AND ` + storageNotExpired + `
 ORDER BY collection, key, user_id
 LIMIT $2`
 	params := []any{idx.Collection, 10_000}
@@ -341,7 +341,7 @@ LIMIT $2`
 		query = `
 SELECT user_id, key, version, value, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1 AND key = $3
+WHERE collection = $1 AND ` + storageNotExpired + ` AND key = $3
 ORDER BY collection, key, user_id
 LIMIT $2`
 		params = append(params, idx.Key)
@@ -424,7 +424,7 @@ LIMIT $2`
 		query = `
 SELECT user_id, key, version, value, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1
+WHERE collection = $1 AND ` + storageNotExpired + `
 AND (collection, key, user_id) > ($1, $3, $4)
 ORDER BY collection, key, user_id
 LIMIT $2`
@@ -432,7 +432,7 @@ LIMIT $2`
 			query = `
 SELECT user_id, key, version, value, read, write, create_time, update_time
 FROM storage
-WHERE collection = $1
+WHERE collection = $1 AND ` + storageNotExpired + `
 AND key = $3
 AND user_id > $4
 ORDER BY collection, key, user_id
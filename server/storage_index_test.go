@@ -121,7 +121,7 @@ func TestLocalStorageIndex_Write(t *testing.T) {
 
 		writeOps := StorageOpWrites{so1, so2, so3, so4, so5, so6}
 
-		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, writeOps); err != nil {
+		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, writeOps); err != nil {
 			t.Fatal(err.Error())
 		}
 
@@ -147,7 +147,7 @@ func TestLocalStorageIndex_Write(t *testing.T) {
 				},
 			})
 		}
-		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, true, delOps); err != nil {
+		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, storageCollections, nil, nil, true, delOps); err != nil {
 			t.Fatalf("Failed to teardown: %s", err.Error())
 		}
 	})
@@ -168,7 +168,7 @@ func TestLocalStorageIndex_Write(t *testing.T) {
 			},
 		}
 
-		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, StorageOpWrites{so1}); err != nil {
+		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, StorageOpWrites{so1}); err != nil {
 			t.Fatal(err.Error())
 		}
 
@@ -187,7 +187,7 @@ func TestLocalStorageIndex_Write(t *testing.T) {
 				},
 			},
 		}
-		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, true, deletes); err != nil {
+		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, storageCollections, nil, nil, true, deletes); err != nil {
 			t.Fatalf("Failed to teardown: %s", err.Error())
 		}
 	})
@@ -271,7 +271,7 @@ func TestLocalStorageIndex_Write(t *testing.T) {
 
 		writeOps := StorageOpWrites{so1, so2, so3, so4}
 
-		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, writeOps); err != nil {
+		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, writeOps); err != nil {
 			t.Fatal(err.Error())
 		}
 
@@ -295,7 +295,7 @@ func TestLocalStorageIndex_Write(t *testing.T) {
 				},
 			})
 		}
-		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, true, delOps); err != nil {
+		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, storageCollections, nil, nil, true, delOps); err != nil {
 			t.Fatalf("Failed to teardown: %s", err.Error())
 		}
 	})
@@ -367,7 +367,7 @@ func TestLocalStorageIndex_List(t *testing.T) {
 
 		writeOps := StorageOpWrites{so1, so2, so3}
 
-		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, writeOps); err != nil {
+		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, writeOps); err != nil {
 			t.Fatal(err.Error())
 		}
 
@@ -390,7 +390,7 @@ func TestLocalStorageIndex_List(t *testing.T) {
 				},
 			})
 		}
-		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, true, delOps); err != nil {
+		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, storageCollections, nil, nil, true, delOps); err != nil {
 			t.Fatalf("Failed to teardown: %s", err.Error())
 		}
 	})
@@ -460,7 +460,7 @@ func TestLocalStorageIndex_List(t *testing.T) {
 
 		writeOps := StorageOpWrites{so1, so2, so3}
 
-		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, writeOps); err != nil {
+		if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, writeOps); err != nil {
 			t.Fatal(err.Error())
 		}
 
@@ -483,7 +483,7 @@ func TestLocalStorageIndex_List(t *testing.T) {
 				},
 			})
 		}
-		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, true, delOps); err != nil {
+		if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, storageCollections, nil, nil, true, delOps); err != nil {
 			t.Fatalf("Failed to teardown: %s", err.Error())
 		}
 	})
@@ -536,7 +536,7 @@ func TestLocalStorageIndex_Delete(t *testing.T) {
 
 	writeOps := StorageOpWrites{so1, so2}
 
-	if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, true, writeOps); err != nil {
+	if _, _, err := StorageWriteObjects(context.Background(), logger, db, metrics, storageIdx, storageCollections, nil, nil, true, writeOps); err != nil {
 		t.Fatal(err.Error())
 	}
 
@@ -553,7 +553,7 @@ func TestLocalStorageIndex_Delete(t *testing.T) {
 			Key:        "key2",
 		},
 	}
-	if _, err := StorageDeleteObjects(context.Background(), logger, db, storageIdx, true, StorageOpDeletes{delOp}); err != nil {
+	if _, err := StorageDeleteObjects(context.Background(), logger, db, storageIdx, storageCollections, nil, nil, true, StorageOpDeletes{delOp}); err != nil {
 		t.Fatal(err.Error())
 	}
 
@@ -574,7 +574,7 @@ func TestLocalStorageIndex_Delete(t *testing.T) {
 			},
 		})
 	}
-	if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, true, delOps); err != nil {
+	if _, err = StorageDeleteObjects(ctx, logger, db, storageIdx, storageCollections, nil, nil, true, delOps); err != nil {
 		t.Fatalf("Failed to teardown: %s", err.Error())
 	}
 }
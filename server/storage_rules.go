@@ -0,0 +1,211 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v4"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Storage write reject reasons reported in metrics and validation errors, in addition to "version" and "permission".
+const (
+	StorageRejectReasonSchema          = "schema"
+	StorageRejectReasonSize            = "size"
+	StorageRejectReasonCount           = "count"
+	StorageRejectReasonPermissionValue = "permission_value"
+)
+
+// StorageValidationError is returned when a storage write does not satisfy the rules of its collection.
+type StorageValidationError struct {
+	Collection string
+	Key        string
+	UserID     string
+	// One of the StorageRejectReason values.
+	Reason  string
+	Message string
+	// Set for schema violations.
+	Violations []*StorageSchemaViolation
+}
+
+func (e *StorageValidationError) Error() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "Storage write to collection %q key %q rejected: %s", e.Collection, e.Key, e.Message)
+	for i, violation := range e.Violations {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(violation.String())
+	}
+	return b.String()
+}
+
+// Details returns the error as a struct, to attach to gRPC statuses.
+func (e *StorageValidationError) Details() *structpb.Struct {
+	violations := make([]interface{}, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		violations = append(violations, map[string]interface{}{"path": violation.Path, "message": violation.Message})
+	}
+	details, _ := structpb.NewStruct(map[string]interface{}{
+		"collection": e.Collection,
+		"key":        e.Key,
+		"user_id":    e.UserID,
+		"reason":     e.Reason,
+		"message":    e.Message,
+		"violations": violations,
+	})
+	return details
+}
+
+// Rules enforced on every write to a storage collection.
+type storageCollectionRules struct {
+	collection        string
+	schema            *storageSchema
+	maxValueSizeBytes int
+	maxObjectsPerUser int
+	permissionRead    map[int32]bool
+	permissionWrite   map[int32]bool
+}
+
+func newStorageCollectionRules(config *StorageCollectionRulesConfig) (*storageCollectionRules, error) {
+	if config.Collection == "" {
+		return nil, errors.New("storage collection rules 'collection' must be set")
+	}
+	if config.MaxValueSizeBytes < 0 {
+		return nil, errors.New("storage collection rules 'max_value_size_bytes' must be >= 0")
+	}
+	if config.MaxObjectsPerUser < 0 {
+		return nil, errors.New("storage collection rules 'max_objects_per_user' must be >= 0")
+	}
+
+	rules := &storageCollectionRules{
+		collection:        config.Collection,
+		maxValueSizeBytes: config.MaxValueSizeBytes,
+		maxObjectsPerUser: config.MaxObjectsPerUser,
+	}
+	if config.Schema != "" {
+		var err error
+		if rules.schema, err = compileStorageSchema(config.Schema); err != nil {
+			return nil, fmt.Errorf("storage collection rules 'schema' is invalid: %s", err.Error())
+		}
+	}
+	for _, permissions := range []struct {
+		name    string
+		values  []int
+		allowed *map[int32]bool
+	}{{"permission_read", config.PermissionRead, &rules.permissionRead}, {"permission_write", config.PermissionWrite, &rules.permissionWrite}} {
+		if len(permissions.values) == 0 {
+			continue
+		}
+		*permissions.allowed = make(map[int32]bool, len(permissions.values))
+		for _, value := range permissions.values {
+			if value < 0 || value > 2 {
+				return nil, fmt.Errorf("storage collection rules '%s' values must be 0, 1 or 2", permissions.name)
+			}
+			(*permissions.allowed)[int32(value)] = true
+		}
+	}
+	return rules, nil
+}
+
+func (r *storageCollectionRules) reject(op *StorageOpWrite, reason, message string, violations []*StorageSchemaViolation) *StorageValidationError {
+	return &StorageValidationError{
+		Collection: op.Object.Collection,
+		Key:        op.Object.Key,
+		UserID:     op.OwnerID,
+		Reason:     reason,
+		Message:    message,
+		Violations: violations,
+	}
+}
+
+// Check the permissions a write will set. Writes that do not set a permission keep the existing value, or the default
+// for new objects, so only permissions given in the write are checked.
+func (r *storageCollectionRules) checkPermissions(op *StorageOpWrite) *StorageValidationError {
+	if r.permissionRead != nil && op.Object.PermissionRead != nil && !r.permissionRead[op.Object.PermissionRead.Value] {
+		return r.reject(op, StorageRejectReasonPermissionValue, fmt.Sprintf("read permission %d is not allowed", op.Object.PermissionRead.Value), nil)
+	}
+	if r.permissionWrite != nil && op.Object.PermissionWrite != nil && !r.permissionWrite[op.Object.PermissionWrite.Value] {
+		return r.reject(op, StorageRejectReasonPermissionValue, fmt.Sprintf("write permission %d is not allowed", op.Object.PermissionWrite.Value), nil)
+	}
+	return nil
+}
+
+// Check a complete object value, as written or as produced by a patch.
+func (r *storageCollectionRules) checkValue(op *StorageOpWrite, value string) *StorageValidationError {
+	if r.maxValueSizeBytes > 0 && len(value) > r.maxValueSizeBytes {
+		return r.reject(op, StorageRejectReasonSize, fmt.Sprintf("value size %d bytes exceeds maximum of %d bytes", len(value), r.maxValueSizeBytes), nil)
+	}
+	if r.schema != nil {
+		if violations := r.schema.Validate(value); len(violations) > 0 {
+			return r.reject(op, StorageRejectReasonSchema, "value does not match collection schema", violations)
+		}
+	}
+	return nil
+}
+
+// Rules for the collections of the given writes, keyed by collection, or nil if none have rules.
+func storageWriteRules(storageCollections StorageCollectionRegistry, ops StorageOpWrites) map[string]*storageCollectionRules {
+	if storageCollections == nil {
+		return nil
+	}
+	var rules map[string]*storageCollectionRules
+	for _, op := range ops {
+		if r := storageCollections.CollectionRules(op.Object.Collection); r != nil {
+			if rules == nil {
+				rules = make(map[string]*storageCollectionRules)
+			}
+			rules[op.Object.Collection] = r
+		}
+	}
+	return rules
+}
+
+// Check the number of objects each user owns in collections with a limit, once the writes are applied in the
+// transaction. Objects owned by the system are not limited.
+func storageCheckObjectCounts(ctx context.Context, tx pgx.Tx, rules map[string]*storageCollectionRules, ops StorageOpWrites) error {
+	type collectionOwner struct {
+		collection string
+		ownerID    string
+	}
+	checked := make(map[collectionOwner]bool)
+	for _, op := range ops {
+		r, found := rules[op.Object.Collection]
+		if !found || r.maxObjectsPerUser == 0 || op.OwnerID == uuid.Nil.String() {
+			continue
+		}
+		owner := collectionOwner{collection: op.Object.Collection, ownerID: op.OwnerID}
+		if checked[owner] {
+			continue
+		}
+		checked[owner] = true
+
+		var count int
+		if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM storage WHERE collection = $1 AND user_id = $2 AND "+storageNotExpired, owner.collection, owner.ownerID).Scan(&count); err != nil {
+			return err
+		}
+		if count > r.maxObjectsPerUser {
+			return r.reject(op, StorageRejectReasonCount, fmt.Sprintf("user would own %d objects, maximum is %d", count, r.maxObjectsPerUser), nil)
+		}
+	}
+	return nil
+}
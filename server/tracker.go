@@ -40,6 +40,7 @@ const (
 	StreamModeMatchRelayed
 	StreamModeMatchAuthoritative
 	StreamModeParty
+	StreamModeStorage
 )
 
 type PresenceID struct {
@@ -931,8 +932,8 @@ func (t *LocalTracker) processEvent(e *PresenceEvent) {
 			Username:    p.Meta.Username,
 			Persistence: p.Meta.Persistence,
 		}
-		if p.Stream.Mode == StreamModeStatus {
-			// Status field is only populated for status stream presences.
+		if p.Stream.Mode == StreamModeStatus || p.Stream.Mode == StreamModeGroup {
+			// Status field is only populated for status stream presences, and with the member role for group channels.
 			pWire.Status = &wrapperspb.StringValue{Value: p.Meta.Status}
 		}
 		if j, ok := streamJoins[p.Stream]; ok {
@@ -974,8 +975,8 @@ func (t *LocalTracker) processEvent(e *PresenceEvent) {
 			Username:    p.Meta.Username,
 			Persistence: p.Meta.Persistence,
 		}
-		if p.Stream.Mode == StreamModeStatus {
-			// Status field is only populated for status stream presences.
+		if p.Stream.Mode == StreamModeStatus || p.Stream.Mode == StreamModeGroup {
+			// Status field is only populated for status stream presences, and with the member role for group channels.
 			pWire.Status = &wrapperspb.StringValue{Value: p.Meta.Status}
 		}
 		if l, ok := streamLeaves[p.Stream]; ok {
@@ -0,0 +1,92 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const tradeExpiryBatchSize = 100
+
+// TradeScheduler expires open trades past their expiry time in the background, returning escrowed assets to the
+// trade proposers.
+type TradeScheduler interface {
+	Start(runtime *Runtime)
+	Stop()
+}
+
+type LocalTradeScheduler struct {
+	logger             *zap.Logger
+	db                 *sql.DB
+	config             Config
+	metrics            Metrics
+	storageIndex       StorageIndex
+	storageCollections StorageCollectionRegistry
+	tracker            Tracker
+	router             MessageRouter
+
+	ctx         context.Context
+	ctxCancelFn context.CancelFunc
+}
+
+func NewLocalTradeScheduler(logger *zap.Logger, db *sql.DB, config Config, metrics Metrics, storageIndex StorageIndex, storageCollections StorageCollectionRegistry, tracker Tracker, router MessageRouter) TradeScheduler {
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+
+	return &LocalTradeScheduler{
+		logger:             logger,
+		db:                 db,
+		config:             config,
+		metrics:            metrics,
+		storageIndex:       storageIndex,
+		storageCollections: storageCollections,
+		tracker:            tracker,
+		router:             router,
+
+		ctx:         ctx,
+		ctxCancelFn: ctxCancelFn,
+	}
+}
+
+func (s *LocalTradeScheduler) Start(runtime *Runtime) {
+	hooks := newTradeHooks(runtime)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.config.GetTrade().ExpirySweepIntervalSec) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				for {
+					// Keep going while full batches are found, so a backlog is cleared without waiting for more ticks.
+					count, err := TradeExpire(s.ctx, s.logger, s.db, s.metrics, s.storageIndex, s.storageCollections, s.tracker, s.router, hooks, tradeExpiryBatchSize)
+					if err != nil || count < tradeExpiryBatchSize || s.ctx.Err() != nil {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (s *LocalTradeScheduler) Stop() {
+	s.ctxCancelFn()
+}
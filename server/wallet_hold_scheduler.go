@@ -0,0 +1,80 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const walletHoldExpiryBatchSize = 100
+
+// WalletHoldScheduler releases wallet holds past their expiry time in the background, returning the held amounts to
+// their wallets.
+type WalletHoldScheduler interface {
+	Start()
+	Stop()
+}
+
+type LocalWalletHoldScheduler struct {
+	logger *zap.Logger
+	db     *sql.DB
+	config Config
+
+	ctx         context.Context
+	ctxCancelFn context.CancelFunc
+}
+
+func NewLocalWalletHoldScheduler(logger *zap.Logger, db *sql.DB, config Config) WalletHoldScheduler {
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+
+	return &LocalWalletHoldScheduler{
+		logger: logger,
+		db:     db,
+		config: config,
+
+		ctx:         ctx,
+		ctxCancelFn: ctxCancelFn,
+	}
+}
+
+func (s *LocalWalletHoldScheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.config.GetWallet().HoldExpirySweepIntervalSec) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				for {
+					// Keep going while full batches are expired, so a backlog is cleared without waiting for more ticks.
+					count, err := WalletHoldExpire(s.ctx, s.logger, s.db, walletHoldExpiryBatchSize)
+					if err != nil || count < walletHoldExpiryBatchSize || s.ctx.Err() != nil {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (s *LocalWalletHoldScheduler) Stop() {
+	s.ctxCancelFn()
+}
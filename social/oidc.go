@@ -0,0 +1,245 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package social
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// OIDCProvider describes a generic OpenID Connect identity provider. ID tokens are verified against the keys published
+// at the JWKS URL, and profile fields are read from the configured claims.
+type OIDCProvider struct {
+	Name     string
+	Issuer   string
+	JwksUrl  string
+	Audience string
+
+	// Claim names used to build the profile, "sub", "preferred_username", "name", "email" and "picture" if not set.
+	IdClaim          string
+	UsernameClaim    string
+	DisplayNameClaim string
+	EmailClaim       string
+	AvatarUrlClaim   string
+}
+
+// OIDCProfile is an abbreviated profile extracted from a verified OpenID Connect ID token.
+type OIDCProfile struct {
+	ID          string
+	Username    string
+	DisplayName string
+	Email       string
+	AvatarUrl   string
+	Claims      map[string]interface{}
+}
+
+type oidcCerts struct {
+	certs     map[string]*JwksCert
+	refreshAt int64
+}
+
+func (c *Client) CheckOIDCToken(ctx context.Context, provider *OIDCProvider, idToken string) (*OIDCProfile, error) {
+	c.logger.Debug("Checking OIDC token", zap.String("provider", provider.Name), zap.String("idToken", idToken))
+
+	if provider.Issuer == "" || provider.JwksUrl == "" || provider.Audience == "" {
+		return nil, fmt.Errorf("oidc provider %v not enabled", provider.Name)
+	}
+
+	certs, err := c.oidcProviderCerts(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to parse and validate the JWT token.
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		// Only accept RSA signed tokens, the keys we hold cannot verify anything else.
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Method.Alg())
+		}
+
+		// Grab the token's "kid" (key id) claim and see if we have a JWK certificate that matches it.
+		kid, ok := token.Header["kid"]
+		if !ok {
+			return nil, fmt.Errorf("missing kid claim: %v", kid)
+		}
+		kidString, ok := kid.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid kid claim: %v", kid)
+		}
+		cert, ok := certs[kidString]
+		if !ok {
+			return nil, fmt.Errorf("invalid kid claim: %v", kid)
+		}
+
+		// Check the token signing algorithm and the certificate signing algorithm match, if the provider publishes one.
+		if cert.Alg != "" && token.Method.Alg() != cert.Alg {
+			return nil, fmt.Errorf("invalid alg: %v, expected %v", token.Method.Alg(), cert.Alg)
+		}
+
+		claims := token.Claims.(jwt.MapClaims)
+
+		// Verify the issuer.
+		if !claims.VerifyIssuer(provider.Issuer, true) {
+			return nil, fmt.Errorf("unexpected issuer: %v", claims["iss"])
+		}
+
+		// Verify the audience matches the configured client ID.
+		if !claims.VerifyAudience(provider.Audience, true) {
+			return nil, fmt.Errorf("unexpected audience: %v", claims["aud"])
+		}
+
+		return cert.key, nil
+	})
+
+	// Check if verification attempt has failed.
+	if err != nil {
+		return nil, fmt.Errorf("%v id token invalid: %s", provider.Name, err.Error())
+	} else if token == nil {
+		return nil, fmt.Errorf("%v id token invalid", provider.Name)
+	}
+
+	// Extract the claims we need now that we know the token is valid.
+	claims := token.Claims.(jwt.MapClaims)
+	profile := &OIDCProfile{Claims: claims}
+	idClaim := oidcClaimName(provider.IdClaim, "sub")
+	var found bool
+	if profile.ID, found, err = oidcClaimString(claims, idClaim); err != nil {
+		return nil, fmt.Errorf("%v id token %v field invalid", provider.Name, idClaim)
+	} else if !found || profile.ID == "" {
+		return nil, fmt.Errorf("%v id token %v field missing", provider.Name, idClaim)
+	}
+	for _, field := range []struct {
+		name   string
+		target *string
+	}{
+		{oidcClaimName(provider.UsernameClaim, "preferred_username"), &profile.Username},
+		{oidcClaimName(provider.DisplayNameClaim, "name"), &profile.DisplayName},
+		{oidcClaimName(provider.EmailClaim, "email"), &profile.Email},
+		{oidcClaimName(provider.AvatarUrlClaim, "picture"), &profile.AvatarUrl},
+	} {
+		if *field.target, _, err = oidcClaimString(claims, field.name); err != nil {
+			return nil, fmt.Errorf("%v id token %v field invalid", provider.Name, field.name)
+		}
+	}
+
+	return profile, nil
+}
+
+// Fetch the signing keys for a provider, refreshing them every 60 minutes.
+func (c *Client) oidcProviderCerts(ctx context.Context, provider *OIDCProvider) (map[string]*JwksCert, error) {
+	c.oidcMutex.RLock()
+	providerCerts, found := c.oidcCerts[provider.JwksUrl]
+	c.oidcMutex.RUnlock()
+	if found && providerCerts.refreshAt >= time.Now().UTC().Unix() {
+		return providerCerts.certs, nil
+	}
+
+	c.oidcMutex.Lock()
+	defer c.oidcMutex.Unlock()
+	if providerCerts, found = c.oidcCerts[provider.JwksUrl]; found && providerCerts.refreshAt >= time.Now().UTC().Unix() {
+		// Another caller completed the refresh while waiting for the lock.
+		return providerCerts.certs, nil
+	}
+
+	var certs JwksCerts
+	if err := c.request(ctx, provider.Name+" cert", provider.JwksUrl, nil, &certs); err != nil {
+		return nil, err
+	}
+	newCerts := make(map[string]*JwksCert, len(certs.Keys))
+	for _, cert := range certs.Keys {
+		// Check if certificate is an RSA key with all required fields, "use" and "alg" are optional in JWKS documents.
+		if cert.Kty != "RSA" || cert.Kid == "" || cert.N == "" || cert.E == "" || (cert.Use != "" && cert.Use != "sig") {
+			// Invalid or unsupported certificate, skip it.
+			continue
+		}
+
+		// Parse certificate's RSA Public Key encoded components.
+		nBytes, err := base64.RawURLEncoding.DecodeString(cert.N)
+		if err != nil {
+			// Invalid modulus, skip certificate.
+			continue
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(cert.E)
+		if err != nil || len(eBytes) > 8 {
+			// Invalid exponent, skip certificate.
+			continue
+		}
+		if len(eBytes) < 8 {
+			// Pad the front of the exponent bytes with zeroes to ensure it's 8 bytes long.
+			eBytes = append(make([]byte, 8-len(eBytes), 8), eBytes...)
+		}
+		var e uint64
+		err = binary.Read(bytes.NewReader(eBytes), binary.BigEndian, &e)
+		if err != nil {
+			// Invalid exponent contents, skip certificate.
+			continue
+		}
+
+		cert.key = &rsa.PublicKey{
+			N: &big.Int{},
+			E: int(e),
+		}
+		cert.key.N.SetBytes(nBytes)
+
+		newCerts[cert.Kid] = cert
+	}
+	if len(newCerts) == 0 {
+		return nil, fmt.Errorf("error finding valid %v cert", provider.Name)
+	}
+
+	if c.oidcCerts == nil {
+		c.oidcCerts = make(map[string]*oidcCerts, 1)
+	}
+	c.oidcCerts[provider.JwksUrl] = &oidcCerts{
+		certs:     newCerts,
+		refreshAt: time.Now().UTC().Add(60 * time.Minute).Unix(),
+	}
+
+	return newCerts, nil
+}
+
+func oidcClaimName(name, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// Read a claim as a string, some providers issue numeric account identifiers.
+func oidcClaimString(claims jwt.MapClaims, name string) (string, bool, error) {
+	v, found := claims[name]
+	if !found || v == nil {
+		return "", false, nil
+	}
+	switch val := v.(type) {
+	case string:
+		return val, true, nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true, nil
+	default:
+		return "", true, errors.New("unexpected claim type")
+	}
+}
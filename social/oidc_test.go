@@ -0,0 +1,174 @@
+// Copyright 2024 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package social
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCheckOIDCToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var jwksRequests int
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwksRequests++
+		_ = json.NewEncoder(w).Encode(&JwksCerts{Keys: []*JwksCert{
+			{
+				Kty: "RSA",
+				Kid: "key1",
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		}})
+	}))
+	defer jwks.Close()
+
+	provider := &OIDCProvider{
+		Name:          "publisher",
+		Issuer:        "https://sso.example.com",
+		JwksUrl:       jwks.URL,
+		Audience:      "game-client",
+		IdClaim:       "account_id",
+		UsernameClaim: "gamertag",
+	}
+
+	sign := func(signingKey *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(signingKey)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return signed
+	}
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":        "https://sso.example.com",
+			"aud":        []string{"game-client"},
+			"exp":        time.Now().Add(time.Hour).Unix(),
+			"sub":        "ignored",
+			"account_id": float64(123456789),
+			"gamertag":   "dragonslayer",
+			"name":       "Dragon Slayer",
+			"email":      "slayer@example.com",
+		}
+	}
+
+	client := NewClient(zap.NewNop(), 5*time.Second, nil)
+	ctx := context.Background()
+
+	t.Run("valid token with claim mapping", func(t *testing.T) {
+		profile, err := client.CheckOIDCToken(ctx, provider, sign(key, "key1", validClaims()))
+		assert.NoError(t, err)
+		if assert.NotNil(t, profile) {
+			assert.Equal(t, "123456789", profile.ID)
+			assert.Equal(t, "dragonslayer", profile.Username)
+			assert.Equal(t, "Dragon Slayer", profile.DisplayName)
+			assert.Equal(t, "slayer@example.com", profile.Email)
+			assert.Equal(t, "", profile.AvatarUrl)
+		}
+	})
+
+	t.Run("keys are cached", func(t *testing.T) {
+		_, err := client.CheckOIDCToken(ctx, provider, sign(key, "key1", validClaims()))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, jwksRequests)
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		claims := validClaims()
+		claims["iss"] = "https://evil.example.com"
+		_, err := client.CheckOIDCToken(ctx, provider, sign(key, "key1", claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		claims := validClaims()
+		claims["aud"] = "other-client"
+		_, err := client.CheckOIDCToken(ctx, provider, sign(key, "key1", claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("missing audience", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "aud")
+		_, err := client.CheckOIDCToken(ctx, provider, sign(key, "key1", claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("provider without audience", func(t *testing.T) {
+		noAudience := *provider
+		noAudience.Audience = ""
+		_, err := client.CheckOIDCToken(ctx, &noAudience, sign(key, "key1", validClaims()))
+		assert.Error(t, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		claims := validClaims()
+		claims["exp"] = time.Now().Add(-time.Minute).Unix()
+		_, err := client.CheckOIDCToken(ctx, provider, sign(key, "key1", claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		_, err := client.CheckOIDCToken(ctx, provider, sign(key, "key2", validClaims()))
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong signing key", func(t *testing.T) {
+		_, err := client.CheckOIDCToken(ctx, provider, sign(otherKey, "key1", validClaims()))
+		assert.Error(t, err)
+	})
+
+	t.Run("missing id claim", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "account_id")
+		_, err := client.CheckOIDCToken(ctx, provider, sign(key, "key1", claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("hmac token rejected", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+		token.Header["kid"] = "key1"
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		_, err = client.CheckOIDCToken(ctx, provider, signed)
+		assert.Error(t, err)
+	})
+}
@@ -58,6 +58,9 @@ type Client struct {
 	appleCerts          map[string]*JwksCert
 	appleCertsRefreshAt int64
 
+	oidcMutex sync.RWMutex
+	oidcCerts map[string]*oidcCerts
+
 	config *oauth2.Config
 }
 